@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -12,18 +14,39 @@ import (
 
 	"github.com/base48/member-portal/internal/config"
 	"github.com/base48/member-portal/internal/db"
-	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/jobs"
+	"github.com/base48/member-portal/internal/migrate"
+	"github.com/base48/member-portal/internal/scheduler"
 )
 
 // Automatické vytváření měsíčních poplatků pro všechny aktivní členy
 //
 // Použití:
-//   go run cmd/cron/create_monthly_fees.go
+//   go run cmd/cron/create_monthly_fees.go                              # aktuální měsíc (+ zmeškané měsíce)
+//   go run cmd/cron/create_monthly_fees.go --period 2024-03             # jen zvolený měsíc
+//   go run cmd/cron/create_monthly_fees.go --from 2024-01 --to 2024-06  # zvolené období
+//   go run cmd/cron/create_monthly_fees.go --dry-run [...]              # jen vypíše, co by vytvořil
 //
-// Nebo v crontab (běží první den v měsíci):
-//   0 0 1 * * cd /path/to/portal && ./create_monthly_fees >> logs/fees.log 2>&1
+// Bez parametrů předepíše aktuální měsíc. Jen s nastaveným FEES_CATCHUP_FROM
+// doplní i měsíce, které člen od date_joined nezaplatil (ale ne před ním).
+// Členům přijatým nebo pozastaveným v průběhu měsíce se poplatek poměrně
+// krátí, za dny pozastavení se neplatí. Existující poplatky se nemění.
+//
+// Úloha běží automaticky i uvnitř serveru (SCHEDULE_MONTHLY_FEES, výchozí
+// první den v měsíci), tento příkaz ji spustí ručně. Historie běhů: /admin/jobs
 
 func main() {
+	period := flag.String("period", "", "Bill only this month (YYYY-MM)")
+	from := flag.String("from", "", "First month to bill (YYYY-MM)")
+	to := flag.String("to", "", "Last month to bill (YYYY-MM, default current month)")
+	dryRun := flag.Bool("dry-run", false, "Only show what would be created")
+	flag.Parse()
+
+	opts, err := parseOptions(*period, *from, *to, *dryRun)
+	if err != nil {
+		log.Fatalf("Invalid arguments: %v", err)
+	}
+
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
 	}
@@ -39,123 +62,100 @@ func main() {
 	}
 	defer database.Close()
 
+	// Refuse to run against an outdated schema
+	if err := migrate.Verify(context.Background(), database); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
+	}
+
 	queries := db.New(database)
-	emailClient := email.New(cfg, queries)
-	ctx := context.Background()
+	deps := jobs.NewDeps(cfg, queries)
 
-	// Získáme první den aktuálního měsíce
-	now := time.Now()
-	periodStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	// A dry run writes nothing, no need to record it in job_runs
+	if opts.DryRun {
+		result, err := jobs.CreateMonthlyFees(context.Background(), deps, log.Default(), opts)
+		if err != nil {
+			log.Fatalf("Dry run failed: %v", err)
+		}
+		printFees(result)
+		log.Printf("✓ Dry run finished, nothing was written: %s", result.Summary())
+		return
+	}
 
-	log.Printf("Creating fees for period: %s", periodStart.Format("2006-01"))
+	// Run through the scheduler so the run is recorded in job_runs and cannot
+	// overlap with a run started by the server
+	sched := scheduler.New(queries)
+	if err := sched.Register(jobs.MonthlyFeesJob(deps, opts)); err != nil {
+		log.Fatalf("Failed to register job: %v", err)
+	}
 
-	// Načteme všechny accepted členy s jejich úrovněmi
-	users, err := queries.ListAcceptedUsersForFees(ctx)
+	run, err := sched.Run(jobs.JobMonthlyFees, scheduler.SourceCLI)
 	if err != nil {
-		log.Fatalf("Failed to list users: %v", err)
+		log.Fatalf("Job failed: %v", err)
 	}
 
-	log.Printf("Processing %d accepted members...", len(users))
-
-	created := 0
-	skipped := 0
-	errors := 0
-	emailsSent := 0
-
-	for _, user := range users {
-		// Zkontrolujeme, jestli už fee pro tento měsíc neexistuje
-		existingFee, err := queries.GetFeeByUserAndPeriod(ctx, db.GetFeeByUserAndPeriodParams{
-			UserID:      user.ID,
-			PeriodStart: periodStart,
-		})
+	log.Printf("✓ Job completed successfully: %s", run.Summary.String)
+}
 
-		if err == nil && existingFee.ID > 0 {
-			log.Printf("  ⊘ Skipping %s - fee already exists for %s", user.Email, periodStart.Format("2006-01"))
-			skipped++
-			continue
-		}
+// parseOptions converts the command line flags to job options
+func parseOptions(period, from, to string, dryRun bool) (jobs.MonthlyFeesOptions, error) {
+	opts := jobs.MonthlyFeesOptions{DryRun: dryRun}
 
-		// Určíme částku - vždy používáme level_actual_amount, fallback na level.amount
-		feeAmount := user.LevelActualAmount
-		if feeAmount == "0" || feeAmount == "" {
-			feeAmount = user.LevelAmount
-			log.Printf("  ⚠ User %s has no level_actual_amount, using level default: %s", user.Email, feeAmount)
-		}
-
-		// Vytvoříme fee záznam
-		fee, err := queries.CreateFee(ctx, db.CreateFeeParams{
-			UserID:      user.ID,
-			LevelID:     user.LevelID,
-			PeriodStart: periodStart,
-			Amount:      feeAmount,
-		})
+	if period != "" && (from != "" || to != "") {
+		return opts, fmt.Errorf("--period cannot be combined with --from or --to")
+	}
+	if to != "" && from == "" {
+		return opts, fmt.Errorf("--to requires --from")
+	}
 
+	month := func(flagName, value string) (time.Time, error) {
+		t, err := time.Parse("2006-01", value)
 		if err != nil {
-			log.Printf("  ✗ Failed to create fee for %s: %v", user.Email, err)
-			errors++
-			continue
+			return time.Time{}, fmt.Errorf("invalid --%s month '%s' (use YYYY-MM)", flagName, value)
 		}
+		return t, nil
+	}
 
-		log.Printf("  ✓ Created fee for %s: %s Kč (fee_id: %d)", user.Email, fee.Amount, fee.ID)
-		created++
-
-		// Po vytvoření fee zkontrolujeme balance a případně pošleme upozornění
-		balance, err := queries.GetUserBalance(ctx, db.GetUserBalanceParams{
-			UserID:   sql.NullInt64{Int64: user.ID, Valid: true},
-			UserID_2: user.ID,
-		})
-		if err != nil {
-			log.Printf("  ⚠ Failed to get balance for %s: %v", user.Email, err)
-			continue
+	var err error
+	switch {
+	case period != "":
+		if opts.From, err = month("period", period); err != nil {
+			return opts, err
 		}
-
-		// Pokud je balance záporná a větší než 2x měsíční poplatek, pošleme warning
-		var monthlyFee float64
-		fmt.Sscanf(feeAmount, "%f", &monthlyFee)
-		balanceFloat := float64(balance)
-
-		if balanceFloat < -(2 * monthlyFee) {
-			// Načteme celý user záznam pro email
-			fullUser, err := queries.GetUserByID(ctx, user.ID)
-			if err != nil {
-				log.Printf("  ⚠ Failed to get user record for email: %v", err)
-				continue
+		opts.To = opts.From
+	case from != "":
+		if opts.From, err = month("from", from); err != nil {
+			return opts, err
+		}
+		if to != "" {
+			if opts.To, err = month("to", to); err != nil {
+				return opts, err
 			}
-
-			// Pošleme debt warning email (gracefully - necrashne když selže)
-			if err := emailClient.SendDebtWarning(ctx, &fullUser, balanceFloat, monthlyFee); err != nil {
-				log.Printf("  ⚠ Failed to send debt warning email: %v", err)
-			} else {
-				log.Printf("  ✉ Sent debt warning email (balance: %.0f Kč)", balanceFloat)
-				emailsSent++
+			if opts.To.Before(opts.From) {
+				return opts, fmt.Errorf("--to is before --from")
 			}
 		}
 	}
 
-	log.Printf("\nSummary:")
-	log.Printf("  Period: %s", periodStart.Format("2006-01"))
-	log.Printf("  Total users: %d", len(users))
-	log.Printf("  Created: %d", created)
-	log.Printf("  Skipped (already exists): %d", skipped)
-	log.Printf("  Debt warning emails sent: %d", emailsSent)
-	log.Printf("  Errors: %d", errors)
-
-	// Log cron job completion
-	level := "success"
-	if errors > 0 {
-		level = "warning"
-	}
-	queries.CreateLog(ctx, db.CreateLogParams{
-		Subsystem: "cron",
-		Level:     level,
-		UserID:    sql.NullInt64{},
-		Message:   fmt.Sprintf("Monthly fees created for %s: %d fees, %d emails sent", periodStart.Format("2006-01"), created, emailsSent),
-		Metadata:  sql.NullString{String: fmt.Sprintf(`{"period":"%s","created":%d,"skipped":%d,"emails":%d,"errors":%d}`, periodStart.Format("2006-01"), created, skipped, emailsSent, errors), Valid: true},
-	})
-
-	if errors > 0 {
-		log.Fatal("Job completed with errors")
-	}
+	return opts, nil
+}
 
-	log.Println("✓ Job completed successfully")
+func printFees(result *jobs.MonthlyFeesResult) {
+	fmt.Println("\n" + strings.Repeat("=", 80))
+	fmt.Printf("%-8s %-8s %-36s %14s %10s\n", "Period", "User", "Email", "Amount", "Days")
+	fmt.Println(strings.Repeat("-", 80))
+
+	for _, f := range result.Fees {
+		days := fmt.Sprintf("%d", f.Days)
+		if f.Prorated() {
+			days = fmt.Sprintf("%d/%d", f.Days, f.PeriodDays)
+		}
+		fmt.Printf("%-8s %-8d %-36s %14s %10s\n",
+			f.Period.Format("2006-01"),
+			f.UserID,
+			f.Email,
+			f.Amount.Format(),
+			days,
+		)
+	}
+	fmt.Println(strings.Repeat("=", 80))
 }
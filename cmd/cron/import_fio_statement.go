@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joho/godotenv"
+	_ "modernc.org/sqlite"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/jobs"
+	"github.com/base48/member-portal/internal/migrate"
+)
+
+// Import payments from a statement downloaded from FIO internet banking
+// (for when the API token is rotated or the API is down)
+//
+// Usage:
+//   go run cmd/cron/import_fio_statement.go --dry-run vypis.gpc   # show what would be imported
+//   go run cmd/cron/import_fio_statement.go vypis.gpc
+//
+// Supported formats: GPC/ABO (.gpc), CSV (.csv) and CAMT.053 XML (.xml).
+// Payments are matched by VS like in sync_fio_payments and stored with the
+// bank's transaction ID, so already synced payments are not duplicated.
+// The same import is available at /admin/payments/import.
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "Only show what would be imported")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: import_fio_statement [--dry-run] <statement file>")
+	}
+	path := flag.Arg(0)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read statement: %v", err)
+	}
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Connect to database
+	database, err := sql.Open("sqlite", cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	// Refuse to run against an outdated schema
+	if err := migrate.Verify(context.Background(), database); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
+	}
+
+	queries := db.New(database)
+	deps := jobs.NewDeps(cfg, queries)
+
+	result, err := jobs.ImportFIOStatement(context.Background(), deps, log.Default(), filepath.Base(path), data, *dryRun, sql.NullInt64{})
+	if result != nil && *dryRun {
+		printOutcomes(result)
+	}
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+
+	if *dryRun {
+		log.Printf("✓ Dry run finished, nothing was written: %s", result.Summary())
+	} else {
+		log.Printf("✓ Import completed successfully: %s", result.Summary())
+	}
+}
+
+func printOutcomes(result *jobs.FIOImportResult) {
+	fmt.Println("\n" + strings.Repeat("=", 100))
+	fmt.Printf("%-8s %-14s %-12s %14s %-10s %-8s %s\n",
+		"Action", "FIO ID", "Date", "Amount", "VS", "User", "Counterparty / note")
+	fmt.Println(strings.Repeat("-", 100))
+
+	for _, o := range result.Outcomes {
+		user := "-"
+		if o.UserID.Valid {
+			user = fmt.Sprintf("%d", o.UserID.Int64)
+		}
+		note := o.Transaction.RemoteName
+		if o.Note != "" {
+			note = strings.TrimSpace(note + " (" + o.Note + ")")
+		}
+
+		fmt.Printf("%-8s %-14s %-12s %14s %-10s %-8s %s\n",
+			o.Action,
+			o.Transaction.KindID,
+			o.Transaction.Date.Format("2006-01-02"),
+			o.Transaction.Amount.Format(),
+			o.VariableSymbol,
+			user,
+			note,
+		)
+	}
+	fmt.Println(strings.Repeat("=", 100))
+}
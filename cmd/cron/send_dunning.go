@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	_ "modernc.org/sqlite"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dunning"
+	"github.com/base48/member-portal/internal/jobs"
+	"github.com/base48/member-portal/internal/migrate"
+	"github.com/base48/member-portal/internal/scheduler"
+)
+
+// Upomínky dlužníkům: připomínka, varování, poslední výzva a pozastavení
+//
+// Použití:
+//   go run cmd/cron/send_dunning.go            # pošle upomínky
+//   go run cmd/cron/send_dunning.go --dry-run  # jen vypíše, co by poslal
+//
+// Každý stupeň dostane člen jednou za jeden dluh, mezi upomínkami je aspoň
+// DUNNING_COOLDOWN_DAYS dní. Jakmile člen přestane být v dluhu, jeho upomínky
+// se uzavřou. Odeslané upomínky jsou v tabulce dunning_notices a na
+// /admin/dunning.
+//
+// Uvnitř serveru úloha běží automaticky, jen když je nastaven SCHEDULE_DUNNING
+// (a SCHEDULER_ENABLED=true), tento příkaz ji spustí ručně. Historie běhů:
+// /admin/jobs
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "Only show the notices, do not send them")
+	flag.Parse()
+
+	opts := jobs.DunningOptions{DryRun: *dryRun}
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Connect to database
+	database, err := sql.Open("sqlite", cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	// Refuse to run against an outdated schema
+	if err := migrate.Verify(context.Background(), database); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
+	}
+
+	queries := db.New(database)
+	deps := jobs.NewDeps(cfg, queries)
+
+	// A dry run changes nothing, no need to record it in job_runs
+	if opts.DryRun {
+		result, err := jobs.RunDunning(context.Background(), deps, log.Default(), opts, time.Now())
+		if err != nil {
+			log.Fatalf("Dry run failed: %v", err)
+		}
+		printActions(result)
+		log.Printf("✓ Dry run finished, nothing was sent: %s", result.Summary())
+		return
+	}
+
+	// Run through the scheduler so the run is recorded in job_runs and cannot
+	// overlap with a run started by the server
+	sched := scheduler.New(queries)
+	if err := sched.Register(jobs.DunningJob(deps, opts)); err != nil {
+		log.Fatalf("Failed to register job: %v", err)
+	}
+
+	run, err := sched.Run(jobs.JobDunning, scheduler.SourceCLI)
+	if err != nil {
+		log.Fatalf("Job failed: %v", err)
+	}
+
+	log.Printf("✓ Job completed successfully: %s", run.Summary.String)
+}
+
+func printActions(result *jobs.DunningResult) {
+	fmt.Println("\n" + strings.Repeat("=", 80))
+	fmt.Printf("%-16s %-8s %-36s %s\n", "Stage", "User", "Email", "Balance")
+	fmt.Println(strings.Repeat("-", 80))
+
+	for _, a := range result.Actions {
+		stage := "uzavřít"
+		if !a.Resolve() {
+			stage = dunning.StageLabel(a.Stage)
+		}
+		fmt.Printf("%-16s %-8d %-36s %s\n", stage, a.UserID, a.Email, a.Balance.Format())
+	}
+	fmt.Println(strings.Repeat("=", 80))
+}
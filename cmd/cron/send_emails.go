@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/joho/godotenv"
+	_ "modernc.org/sqlite"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/migrate"
+)
+
+// Odeslání emailů z fronty (email_outbox)
+//
+// Použití:
+//   go run cmd/cron/send_emails.go
+//
+// Emaily z obsluhy požadavků i z úloh se jen zařadí do fronty, doručuje je
+// server na pozadí. Tento příkaz jednou odešle všechny emaily, které jsou na
+// řadě (např. když server neběží). Neúspěšný pokus se zopakuje později,
+// stav fronty: /admin/emails
+
+func main() {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Connect to database
+	database, err := sql.Open("sqlite", cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	// Refuse to run against an outdated schema
+	if err := migrate.Verify(context.Background(), database); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
+	}
+
+	client := email.New(cfg, db.New(database))
+	if !client.Enabled() {
+		log.Fatalf("Emails are disabled, set SMTP_HOST or EMAIL_TRANSPORT")
+	}
+
+	var total email.DeliveryResult
+	for {
+		result, err := client.Deliver(context.Background(), time.Now())
+		total.Sent += result.Sent
+		total.Retried += result.Retried
+		total.Failed += result.Failed
+		if err != nil {
+			log.Fatalf("Delivery failed: %v", err)
+		}
+		if result.Sent+result.Retried+result.Failed == 0 {
+			break
+		}
+	}
+
+	log.Printf("✓ Outbox delivered: %d sent, %d to retry, %d failed", total.Sent, total.Retried, total.Failed)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/joho/godotenv"
+	_ "modernc.org/sqlite"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/jobs"
+	"github.com/base48/member-portal/internal/migrate"
+	"github.com/base48/member-portal/internal/scheduler"
+)
+
+// Pozastavení členství členům s dlouhodobým dluhem (DEBT_SUSPEND_THRESHOLD,
+// DEBT_SUSPEND_DAYS), kterým upomínky (dunning) už poslaly poslední výzvu.
+// Se zapnutým DUNNING_SUSPEND_DAYS pozastaví člena to pravidlo, které je
+// splněno dřív.
+//
+// Použití:
+//   go run cmd/cron/suspend_debtors.go
+//
+// Úloha běží automaticky i uvnitř serveru (SCHEDULE_DEBT_SUSPENSION), tento
+// příkaz ji spustí ručně. Historie běhů: /admin/jobs
+
+func main() {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Connect to database
+	database, err := sql.Open("sqlite", cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	// Refuse to run against an outdated schema
+	if err := migrate.Verify(context.Background(), database); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
+	}
+
+	queries := db.New(database)
+
+	// Run through the scheduler so the run is recorded in job_runs and cannot
+	// overlap with a run started by the server
+	sched := scheduler.New(queries)
+	if err := jobs.Register(sched, jobs.NewDeps(cfg, queries)); err != nil {
+		log.Fatalf("Failed to register jobs: %v", err)
+	}
+
+	run, err := sched.Run(jobs.JobDebtSuspension, scheduler.SourceCLI)
+	if err != nil {
+		log.Fatalf("Job failed: %v", err)
+	}
+
+	log.Printf("✓ Job completed successfully: %s", run.Summary.String)
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"time"
@@ -13,20 +13,40 @@ import (
 
 	"github.com/base48/member-portal/internal/config"
 	"github.com/base48/member-portal/internal/db"
-	"github.com/base48/member-portal/internal/fio"
+	"github.com/base48/member-portal/internal/jobs"
+	"github.com/base48/member-portal/internal/migrate"
+	"github.com/base48/member-portal/internal/scheduler"
 )
 
 // Sync payments from FIO Bank API to local database
 //
 // Usage:
-//   go run cmd/cron/sync_fio_payments.go
-//   go run cmd/cron/sync_fio_payments.go --since-last  # Fetch only new transactions
-//   go run cmd/cron/sync_fio_payments.go --days 7      # Fetch last 7 days
+//   go run cmd/cron/sync_fio_payments.go                  # new transactions since the stored cursor (default)
+//   go run cmd/cron/sync_fio_payments.go --since-last     # same as above
+//   go run cmd/cron/sync_fio_payments.go --days 30        # backfill the last 30 days
+//   go run cmd/cron/sync_fio_payments.go --from 2023-01-01 --to 2023-12-31 [--window 90]
 //
-// Nebo v crontab (každý den ve 3:00):
-//   0 3 * * * cd /path/to/portal && ./sync_fio_payments --since-last >> logs/fio-sync.log 2>&1
+// Incremental sync continues from the last transaction ID stored in
+// sync_cursors. Backfill fetches a date range in windows of --window days
+// (one API request each, 30 s apart because of the FIO rate limit) and does
+// not move the cursor.
+//
+// The job also runs inside the server (SCHEDULE_FIO_SYNC, daily at 3:00 by
+// default); this command runs it by hand. Run history: /admin/jobs
 
 func main() {
+	sinceLast := flag.Bool("since-last", false, "Fetch new transactions since the stored cursor (default)")
+	days := flag.Int("days", 0, "Backfill the last N days")
+	from := flag.String("from", "", "Backfill start date (YYYY-MM-DD)")
+	to := flag.String("to", "", "Backfill end date (YYYY-MM-DD, default today)")
+	window := flag.Int("window", jobs.DefaultBackfillWindowDays, "Backfill window size in days (one API request per window)")
+	flag.Parse()
+
+	opts, err := parseOptions(*sinceLast, *days, *from, *to, *window)
+	if err != nil {
+		log.Fatalf("Invalid arguments: %v", err)
+	}
+
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
@@ -37,11 +57,6 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// Check FIO token
-	if cfg.BankFIOToken == "" {
-		log.Fatal("BANK_FIO_TOKEN is required")
-	}
-
 	// Connect to database
 	database, err := sql.Open("sqlite", cfg.DatabaseURL)
 	if err != nil {
@@ -49,257 +64,63 @@ func main() {
 	}
 	defer database.Close()
 
-	queries := db.New(database)
-	ctx := context.Background()
-
-	// Create FIO API client
-	fioClient := fio.NewClient(cfg.BankFIOToken)
-
-	// Determine which transactions to fetch
-	var transactions []fio.Transaction
-	var fetchErr error
-
-	// Default: fetch last 90 days (FIO API limit)
-	// You can modify this based on command line arguments
-	daysBack := 90
-	dateFrom := time.Now().AddDate(0, 0, -daysBack)
-	dateTo := time.Now()
-
-	log.Printf("Fetching FIO transactions from %s to %s...",
-		fio.FormatDate(dateFrom), fio.FormatDate(dateTo))
-
-	transactions, fetchErr = fioClient.FetchTransactionsByPeriod(
-		ctx,
-		fio.FormatDate(dateFrom),
-		fio.FormatDate(dateTo),
-	)
-
-	if fetchErr != nil {
-		log.Fatalf("Failed to fetch transactions: %v", fetchErr)
+	// Refuse to run against an outdated schema
+	if err := migrate.Verify(context.Background(), database); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
 	}
 
-	log.Printf("Fetched %d transactions from FIO API", len(transactions))
+	queries := db.New(database)
 
-	if len(transactions) == 0 {
-		log.Println("✓ No new transactions to sync")
-		return
+	// Run through the scheduler so the run is recorded in job_runs and cannot
+	// overlap with a run started by the server
+	sched := scheduler.New(queries)
+	if err := sched.Register(jobs.FIOSyncJob(jobs.NewDeps(cfg, queries), opts)); err != nil {
+		log.Fatalf("Failed to register job: %v", err)
 	}
 
-	// Process transactions
-	inserted := 0
-	updated := 0
-	skipped := 0
-	errors := 0
-	unmatchedVS := []fio.Transaction{}
-	emptyVS := []fio.Transaction{}
-
-	for _, tx := range transactions {
-		// Skip transactions with zero or negative amounts (outgoing payments, fees, etc.)
-		// Only process incoming payments (positive amounts)
-		if tx.Amount <= 0 {
-			skipped++
-			continue
-		}
+	run, err := sched.Run(jobs.JobFIOSync, scheduler.SourceCLI)
+	if err != nil {
+		log.Fatalf("Job failed: %v", err)
+	}
 
-		// Try to match user by variable symbol (payments_id)
-		// IMPORTANT: VS is NOT the user.id, it's the user.payments_id!
-		// Edge case: Some users put VS in Message field instead of VS field
-		variableSymbol := tx.VariableSymbol
-		if variableSymbol == "" && tx.Message != "" {
-			// Check if Message contains only digits (likely a VS)
-			isNumeric := true
-			for _, ch := range tx.Message {
-				if ch < '0' || ch > '9' {
-					isNumeric = false
-					break
-				}
-			}
-			if isNumeric {
-				variableSymbol = tx.Message
-				log.Printf("ℹ Using Message field as VS: '%s' (%.2f CZK from %s)", variableSymbol, tx.Amount, tx.AccountName)
-			}
-		}
+	log.Printf("✓ Job completed successfully: %s", run.Summary.String)
+}
 
-		var userID sql.NullInt64
-		if variableSymbol != "" {
-			// Look up user by payments_id (VS), not by user.id
-			if user, err := queries.GetUserByPaymentsID(ctx, sql.NullString{String: variableSymbol, Valid: true}); err == nil {
-				userID = sql.NullInt64{Int64: user.ID, Valid: true}
-			} else if err == sql.ErrNoRows {
-				log.Printf("⚠ User with payments_id (VS) '%s' not found in database (%.2f CZK from %s)",
-					variableSymbol, tx.Amount, tx.AccountName)
-				unmatchedVS = append(unmatchedVS, tx)
-			} else {
-				log.Printf("⚠ Database error looking up user by payments_id '%s': %v", variableSymbol, err)
-				errors++
-			}
-		} else {
-			if tx.Amount > 0 {
-				log.Printf("⚠ Empty VS - %.2f CZK from %s", tx.Amount, tx.AccountName)
-				emptyVS = append(emptyVS, tx)
-			}
-		}
+// parseOptions converts the command line flags to sync options
+func parseOptions(sinceLast bool, days int, from, to string, window int) (jobs.FIOSyncOptions, error) {
+	opts := jobs.FIOSyncOptions{WindowDays: window}
 
-		// Parse transaction date
-		txDate, err := fio.ParseDate(tx.Date)
-		if err != nil {
-			log.Printf("⚠ Failed to parse date %s: %v", tx.Date, err)
-			txDate = time.Now() // fallback
-		}
+	if sinceLast && (days > 0 || from != "" || to != "") {
+		return opts, fmt.Errorf("--since-last cannot be combined with --days, --from or --to")
+	}
+	if days > 0 && (from != "" || to != "") {
+		return opts, fmt.Errorf("--days cannot be combined with --from or --to")
+	}
+	if to != "" && from == "" {
+		return opts, fmt.Errorf("--to requires --from")
+	}
+	if window <= 0 {
+		return opts, fmt.Errorf("--window must be positive")
+	}
 
-		// Prepare raw data JSON
-		rawDataJSON, err := json.Marshal(tx)
+	switch {
+	case days > 0:
+		opts.To = time.Now()
+		opts.From = opts.To.AddDate(0, 0, -days)
+	case from != "":
+		t, err := time.Parse("2006-01-02", from)
 		if err != nil {
-			log.Printf("⚠ Failed to marshal transaction data: %v", err)
-			rawDataJSON = []byte("{}")
-		}
-
-		// Build remote account string (account + bank code)
-		remoteAccount := tx.AccountNumber
-		if tx.BankCode != "" {
-			remoteAccount = fmt.Sprintf("%s/%s", tx.AccountNumber, tx.BankCode)
+			return opts, fmt.Errorf("invalid --from date: %w", err)
 		}
-
-		// Check if payment already exists
-		existingPayment, err := queries.GetPaymentByKindAndID(ctx, db.GetPaymentByKindAndIDParams{
-			Kind:   "fio",
-			KindID: fmt.Sprintf("%d", tx.ID),
-		})
-
-		if err == sql.ErrNoRows {
-			// Insert new payment
-			_, err = queries.UpsertPayment(ctx, db.UpsertPaymentParams{
-				UserID:         userID,
-				ProjectID:      sql.NullInt64{}, // Not set during FIO import
-				Date:           txDate,
-				Amount:         fmt.Sprintf("%.2f", tx.Amount),
-				Kind:           "fio",
-				KindID:         fmt.Sprintf("%d", tx.ID),
-				LocalAccount:   "FIO", // Could be parsed from API info
-				RemoteAccount:  remoteAccount,
-				Identification: variableSymbol,
-				RawData:        sql.NullString{String: string(rawDataJSON), Valid: true},
-				StaffComment:   sql.NullString{},
-			})
-
+		opts.From = t
+		if to != "" {
+			t, err := time.Parse("2006-01-02", to)
 			if err != nil {
-				log.Printf("✗ Failed to insert payment (FIO ID %d): %v", tx.ID, err)
-				errors++
-			} else {
-				log.Printf("✓ Inserted payment: %.2f CZK from %s (VS: %s, FIO ID: %d)",
-					tx.Amount, tx.AccountName, tx.VariableSymbol, tx.ID)
-				inserted++
-			}
-		} else if err != nil {
-			log.Printf("⚠ Error checking existing payment: %v", err)
-			errors++
-		} else {
-			// Payment exists - check if it needs update
-			needsUpdate := false
-
-			// Check if user_id changed (manual assignment)
-			if userID.Valid && (!existingPayment.UserID.Valid || existingPayment.UserID.Int64 != userID.Int64) {
-				needsUpdate = true
-			}
-
-			if needsUpdate {
-				_, err = queries.UpsertPayment(ctx, db.UpsertPaymentParams{
-					UserID:         userID,
-					ProjectID:      existingPayment.ProjectID, // Preserve project assignment
-					Date:           txDate,
-					Amount:         fmt.Sprintf("%.2f", tx.Amount),
-					Kind:           "fio",
-					KindID:         fmt.Sprintf("%d", tx.ID),
-					LocalAccount:   "FIO",
-					RemoteAccount:  remoteAccount,
-					Identification: variableSymbol,
-					RawData:        sql.NullString{String: string(rawDataJSON), Valid: true},
-					StaffComment:   existingPayment.StaffComment, // Preserve staff comment
-				})
-
-				if err != nil {
-					log.Printf("✗ Failed to update payment (FIO ID %d): %v", tx.ID, err)
-					errors++
-				} else {
-					log.Printf("↻ Updated payment: %.2f CZK (FIO ID: %d)", tx.Amount, tx.ID)
-					updated++
-				}
-			} else {
-				// No changes needed
-				skipped++
+				return opts, fmt.Errorf("invalid --to date: %w", err)
 			}
+			opts.To = t
 		}
 	}
 
-	log.Println("\n" + repeat("=", 80))
-	log.Println("SYNC SUMMARY")
-	log.Println(repeat("=", 80))
-	log.Printf("Total transactions fetched: %d", len(transactions))
-	log.Printf("  ✓ Inserted: %d", inserted)
-	log.Printf("  ↻ Updated: %d", updated)
-	log.Printf("  - Skipped (negative/zero): %d", skipped)
-	log.Printf("  ✗ Errors: %d", errors)
-	log.Println(repeat("-", 80))
-
-	// Report problematic payments
-	totalUnmatched := len(unmatchedVS) + len(emptyVS)
-	if totalUnmatched > 0 {
-		log.Printf("\n⚠️  PROBLEMATIC PAYMENTS: %d", totalUnmatched)
-
-		if len(emptyVS) > 0 {
-			totalAmount := 0.0
-			log.Printf("\n  📝 Empty variable symbol: %d payments", len(emptyVS))
-			for _, tx := range emptyVS {
-				totalAmount += tx.Amount
-				log.Printf("     - %.2f CZK from %s on %s", tx.Amount, tx.AccountName, tx.Date[:10])
-			}
-			log.Printf("     Total: %.2f CZK", totalAmount)
-		}
-
-		if len(unmatchedVS) > 0 {
-			totalAmount := 0.0
-			log.Printf("\n  ❌ User not found: %d payments", len(unmatchedVS))
-			for _, tx := range unmatchedVS {
-				totalAmount += tx.Amount
-				log.Printf("     - %.2f CZK (VS/payments_id: %s) from %s", tx.Amount, tx.VariableSymbol, tx.AccountName)
-			}
-			log.Printf("     Total: %.2f CZK", totalAmount)
-			log.Println("\n     💡 These payments have VS that doesn't match any user's payments_id.")
-			log.Println("        Check if users need to be imported or VS is incorrect.")
-		}
-
-		log.Printf("\n💡 Run 'go run cmd/cron/report_unmatched_payments.go' for detailed report")
-	}
-
-	log.Println("\n" + repeat("=", 80))
-
-	// Log FIO sync completion
-	level := "success"
-	if errors > 0 {
-		level = "warning"
-	} else if totalUnmatched > 0 {
-		level = "info"
-	}
-	queries.CreateLog(ctx, db.CreateLogParams{
-		Subsystem: "fio_sync",
-		Level:     level,
-		UserID:    sql.NullInt64{},
-		Message:   fmt.Sprintf("FIO sync completed: %d new, %d updated, %d unmatched", inserted, updated, totalUnmatched),
-		Metadata:  sql.NullString{String: fmt.Sprintf(`{"inserted":%d,"updated":%d,"skipped":%d,"unmatched":%d,"errors":%d}`, inserted, updated, skipped, totalUnmatched, errors), Valid: true},
-	})
-
-	if errors > 0 {
-		log.Fatal("Job completed with errors")
-	}
-
-	log.Println("✓ Job completed successfully")
-}
-
-// Helper to repeat strings (since strings.Repeat might not be imported)
-func repeat(s string, count int) string {
-	result := ""
-	for i := 0; i < count; i++ {
-		result += s
-	}
-	return result
+	return opts, nil
 }
@@ -3,26 +3,44 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/joho/godotenv"
 	_ "modernc.org/sqlite"
 
-	"github.com/base48/member-portal/internal/auth"
 	"github.com/base48/member-portal/internal/config"
 	"github.com/base48/member-portal/internal/db"
-	"github.com/base48/member-portal/internal/keycloak"
+	"github.com/base48/member-portal/internal/jobs"
+	"github.com/base48/member-portal/internal/migrate"
+	"github.com/base48/member-portal/internal/scheduler"
 )
 
-// Příklad cron jobu: Automatická aktualizace role in_debt na základě balance
+// Synchronizace rolí in_debt a active_member v Keycloaku podle databáze
 //
 // Použití:
-//   go run cmd/cron/update_debt_status.go
+//   go run cmd/cron/update_debt_status.go            # aplikuje rozdíly
+//   go run cmd/cron/update_debt_status.go --dry-run  # jen vypíše, co by změnil
 //
-// Nebo v crontab:
-//   0 2 * * * cd /path/to/portal && ./update_debt_status >> logs/cron.log 2>&1
+// Členové rolí se z Keycloaku stahují hromadně a mění se jen to, co nesedí:
+// in_debt mají členové v dluhu podle pravidel debt.Policy – dluh alespoň
+// DEBT_THRESHOLD (Kč nebo měsíční příspěvky), do kterého se příspěvky počítají
+// až DEBT_GRACE_DAYS dní po vystavení, a členové s výjimkou nikdy;
+// active_member mají přijatí členové.
+// Provedené změny se zapisují do system_logs (subsystém debt_status).
+//
+// Uvnitř serveru úloha běží automaticky, jen když je nastaven
+// SCHEDULE_DEBT_STATUS (a SCHEDULER_ENABLED=true), tento příkaz ji spustí
+// ručně. Historie běhů: /admin/jobs
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "Only show the role changes, do not apply them")
+	flag.Parse()
+
+	opts := jobs.DebtStatusOptions{DryRun: *dryRun}
+
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
@@ -33,11 +51,6 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// Check service account credentials
-	if cfg.KeycloakServiceAccountClientID == "" || cfg.KeycloakServiceAccountClientSecret == "" {
-		log.Fatal("KEYCLOAK_SERVICE_ACCOUNT_CLIENT_ID and KEYCLOAK_SERVICE_ACCOUNT_CLIENT_SECRET are required")
-	}
-
 	// Connect to database
 	database, err := sql.Open("sqlite", cfg.DatabaseURL)
 	if err != nil {
@@ -45,103 +58,51 @@ func main() {
 	}
 	defer database.Close()
 
-	queries := db.New(database)
-
-	ctx := context.Background()
-
-	// Create service account client (uses application credentials, not user)
-	serviceClient, err := auth.NewServiceAccountClient(
-		ctx,
-		cfg,
-		cfg.KeycloakServiceAccountClientID,
-		cfg.KeycloakServiceAccountClientSecret,
-	)
-	if err != nil {
-		log.Fatalf("Failed to create service account: %v", err)
+	// Refuse to run against an outdated schema
+	if err := migrate.Verify(context.Background(), database); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
 	}
 
-	log.Println("✓ Service account authenticated")
+	queries := db.New(database)
+	deps := jobs.NewDeps(cfg, queries)
 
-	// Get access token for Keycloak API
-	token, err := serviceClient.GetAccessToken(ctx)
-	if err != nil {
-		log.Fatalf("Failed to get access token: %v", err)
+	// A dry run changes nothing, no need to record it in job_runs
+	if opts.DryRun {
+		result, err := jobs.UpdateDebtStatus(context.Background(), deps, log.Default(), opts)
+		if err != nil {
+			log.Fatalf("Dry run failed: %v", err)
+		}
+		printChanges(result)
+		log.Printf("✓ Dry run finished, nothing was changed: %s", result.Summary())
+		return
 	}
 
-	// Create Keycloak client
-	kcClient := keycloak.NewClient(cfg, token)
+	// Run through the scheduler so the run is recorded in job_runs and cannot
+	// overlap with a run started by the server
+	sched := scheduler.New(queries)
+	if err := sched.Register(jobs.DebtStatusJob(deps, opts)); err != nil {
+		log.Fatalf("Failed to register job: %v", err)
+	}
 
-	// Get all users from database
-	users, err := queries.ListUsers(ctx)
+	run, err := sched.Run(jobs.JobDebtStatus, scheduler.SourceCLI)
 	if err != nil {
-		log.Fatalf("Failed to list users: %v", err)
+		log.Fatalf("Job failed: %v", err)
 	}
 
-	log.Printf("Processing %d users...", len(users))
-
-	updated := 0
-	errors := 0
-
-	for _, user := range users {
-		// Skip users without Keycloak ID
-		if !user.KeycloakID.Valid || user.KeycloakID.String == "" {
-			continue
-		}
-
-		keycloakID := user.KeycloakID.String
-
-		// Get user's balance
-		balance, err := queries.GetUserBalance(ctx, db.GetUserBalanceParams{
-			UserID:   sql.NullInt64{Int64: user.ID, Valid: true},
-			UserID_2: user.ID,
-		})
-		if err != nil {
-			log.Printf("⚠ Error getting balance for user %s: %v", user.Email, err)
-			errors++
-			continue
-		}
+	log.Printf("✓ Job completed successfully: %s", run.Summary.String)
+}
 
-		// Check if user has in_debt role
-		hasDebtRole, err := kcClient.UserHasRole(ctx, keycloakID, "in_debt")
-		if err != nil {
-			log.Printf("⚠ Error checking roles for user %s: %v", user.Email, err)
-			errors++
-			continue
-		}
+func printChanges(result *jobs.DebtStatusResult) {
+	fmt.Println("\n" + strings.Repeat("=", 80))
+	fmt.Printf("%-8s %-14s %-8s %-32s %s\n", "Change", "Role", "User", "Email", "Reason")
+	fmt.Println(strings.Repeat("-", 80))
 
-		// Determine if user should have in_debt role (balance < 0)
-		shouldHaveDebt := balance < 0
-
-		// Update role if needed
-		if shouldHaveDebt && !hasDebtRole {
-			// User is in debt but doesn't have the role - assign it
-			if err := kcClient.AssignRoleToUser(ctx, keycloakID, "in_debt"); err != nil {
-				log.Printf("✗ Failed to assign in_debt to %s: %v", user.Email, err)
-				errors++
-			} else {
-				log.Printf("✓ Assigned in_debt to %s (balance: %d)", user.Email, balance)
-				updated++
-			}
-		} else if !shouldHaveDebt && hasDebtRole {
-			// User paid off debt but still has the role - remove it
-			if err := kcClient.RemoveRoleFromUser(ctx, keycloakID, "in_debt"); err != nil {
-				log.Printf("✗ Failed to remove in_debt from %s: %v", user.Email, err)
-				errors++
-			} else {
-				log.Printf("✓ Removed in_debt from %s (balance: %d)", user.Email, balance)
-				updated++
-			}
+	for _, c := range result.Changes {
+		change := "remove"
+		if c.Assign {
+			change = "assign"
 		}
+		fmt.Printf("%-8s %-14s %-8d %-32s %s\n", change, c.Role, c.UserID, c.Email, c.Reason)
 	}
-
-	log.Printf("\nSummary:")
-	log.Printf("  Total users: %d", len(users))
-	log.Printf("  Updated: %d", updated)
-	log.Printf("  Errors: %d", errors)
-
-	if errors > 0 {
-		log.Fatal("Job completed with errors")
-	}
-
-	log.Println("✓ Job completed successfully")
+	fmt.Println(strings.Repeat("=", 80))
 }
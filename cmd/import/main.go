@@ -8,6 +8,8 @@ import (
 	"time"
 
 	_ "modernc.org/sqlite"
+
+	"github.com/base48/member-portal/internal/money"
 )
 
 type OldUser struct {
@@ -87,19 +89,24 @@ func importLevels(oldDB, newDB *sql.DB) error {
 	// Clear existing levels (except we might want to keep them)
 	// Let's just insert/update instead
 	for _, level := range levels {
+		amount, err := money.Parse(level.Amount)
+		if err != nil {
+			return fmt.Errorf("level %d: %w", level.ID, err)
+		}
+
 		activeInt := 0
 		if level.Active {
 			activeInt = 1
 		}
 
-		_, err := newDB.Exec(`
+		_, err = newDB.Exec(`
 			INSERT INTO levels (id, name, amount, active)
 			VALUES (?, ?, ?, ?)
 			ON CONFLICT(id) DO UPDATE SET
 				name = excluded.name,
 				amount = excluded.amount,
 				active = excluded.active
-		`, level.ID, level.Name, level.Amount, activeInt)
+		`, level.ID, level.Name, amount, activeInt)
 
 		if err != nil {
 			return fmt.Errorf("insert level %d: %w", level.ID, err)
@@ -153,6 +160,12 @@ func importUsers(oldDB, newDB *sql.DB) error {
 			levelID = user.Level.Int64
 		}
 
+		// Amounts are stored with two decimals
+		amount, err := money.Parse(user.LevelActualAmount)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", user.Email, err)
+		}
+
 		// Convert payments_id to string
 		var paymentsID sql.NullString
 		if user.PaymentsID.Valid {
@@ -182,7 +195,7 @@ func importUsers(oldDB, newDB *sql.DB) error {
 			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`,
 			user.Email, user.Realname, user.Phone, user.AltContact,
-			levelID, user.LevelActualAmount, paymentsID,
+			levelID, amount, paymentsID,
 			user.DateJoined, state, isCouncil, isStaff,
 			nil, // NULL keycloak_id, will be linked on first login via LinkKeycloakID
 		)
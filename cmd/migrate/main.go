@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+	_ "modernc.org/sqlite"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/migrate"
+)
+
+// Správa databázových migrací (schema_migrations)
+//
+// Použití:
+//   go run ./cmd/migrate status    # Přehled aplikovaných a čekajících migrací
+//   go run ./cmd/migrate up        # Aplikuje všechny čekající migrace
+//   go run ./cmd/migrate down [n]  # Vrátí posledních n migrací (výchozí 1)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	database, err := sql.Open("sqlite", config.LoadDatabaseURL())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	migrator, err := migrate.New(database)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+
+		fmt.Printf("%-8s %-45s %-10s %s\n", "Version", "Name", "State", "Applied at")
+		for _, st := range statuses {
+			state := "pending"
+			appliedAt := "-"
+			if st.Applied {
+				state = "applied"
+				appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if st.ChecksumMismatch {
+				state = "MODIFIED"
+			}
+			fmt.Printf("%03d      %-45s %-10s %s\n", st.Version, st.Name, state, appliedAt)
+		}
+
+	case "up":
+		count, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("Migration failed after %d applied: %v", count, err)
+		}
+		if count == 0 {
+			log.Println("✓ Database schema is up to date")
+		} else {
+			log.Printf("✓ Applied %d migration(s)", count)
+		}
+
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps: %s", os.Args[2])
+			}
+		}
+
+		count, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Fatalf("Down migration failed after %d reverted: %v", count, err)
+		}
+		log.Printf("✓ Reverted %d migration(s)", count)
+
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: migrate status|up|down [n]")
+	os.Exit(2)
+}
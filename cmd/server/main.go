@@ -20,6 +20,9 @@ import (
 	"github.com/base48/member-portal/internal/config"
 	"github.com/base48/member-portal/internal/db"
 	"github.com/base48/member-portal/internal/handler"
+	"github.com/base48/member-portal/internal/jobs"
+	"github.com/base48/member-portal/internal/migrate"
+	"github.com/base48/member-portal/internal/scheduler"
 )
 
 func main() {
@@ -44,8 +47,18 @@ func main() {
 		log.Fatalf("Failed to enable foreign keys: %v", err)
 	}
 
-	// Initialize queries
 	ctx := context.Background()
+
+	// Apply pending schema migrations before touching any tables
+	applied, err := migrate.Up(ctx, database)
+	if err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	if applied > 0 {
+		log.Printf("✓ Applied %d database migration(s)", applied)
+	}
+
+	// Initialize queries
 	queries := db.New(database)
 
 	// Initialize authenticator
@@ -60,6 +73,29 @@ func main() {
 		log.Fatalf("Failed to create handler: %v", err)
 	}
 
+	// Initialize job scheduler (replaces the crontab entries for cmd/cron)
+	sched := scheduler.New(queries)
+	jobDeps := jobs.NewDeps(cfg, queries)
+	if err := jobs.Register(sched, jobDeps); err != nil {
+		log.Fatalf("Failed to register jobs: %v", err)
+	}
+	if cfg.SchedulerEnabled {
+		if err := sched.Start(); err != nil {
+			log.Fatalf("Failed to start scheduler: %v", err)
+		}
+	} else {
+		log.Println("⚠ Scheduler disabled (set SCHEDULER_ENABLED=true), jobs run only manually")
+	}
+	h.SetJobs(sched, jobDeps)
+
+	// Deliver queued emails in the background (email_outbox)
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		jobDeps.Email.RunWorker(workerCtx)
+	}()
+
 	// Setup router
 	r := chi.NewRouter()
 
@@ -88,6 +124,9 @@ func main() {
 		r.Use(authenticator.RequireAuth)
 		r.Get("/profile", h.ProfileHandler)
 		r.Post("/profile", h.ProfileHandler)
+		r.Get("/profile/statement", h.ProfileStatementHandler)
+		r.Get("/application", h.ApplicationHandler)
+		r.Post("/application", h.ApplicationHandler)
 	})
 
 	// Admin routes (requires memberportal_admin role)
@@ -95,9 +134,26 @@ func main() {
 		r.Use(authenticator.RequireAuth)
 		r.Get("/users", h.RequireAdmin(h.AdminUsersHandler))
 		r.Get("/users/{id}", h.RequireAdmin(h.AdminUserProfileHandler))
+		r.Get("/users/{id}/statement", h.RequireAdmin(h.AdminUserStatementHandler))
+		r.Get("/users/{id}/edit", h.RequireAdmin(h.AdminEditUserHandler))
+		r.Get("/applications", h.AdminApplicationsHandler) // Council or admin, checked in the handler
+		r.Get("/payments", h.RequireAdmin(h.AdminPaymentsHandler))
+		r.Get("/payments/export", h.RequireAdmin(h.AdminExportPaymentsHandler))
 		r.Get("/payments/unmatched", h.RequireAdmin(h.AdminUnmatchedPaymentsHandler))
+		r.Get("/payments/import", h.RequireAdmin(h.AdminImportStatementHandler))
+		r.Post("/payments/import", h.RequireAdmin(h.AdminImportStatementHandler))
+		r.Get("/payments/new", h.RequireAdmin(h.AdminNewPaymentHandler))
+		r.Get("/payments/{id}/edit", h.RequireAdmin(h.AdminEditPaymentHandler))
 		r.Get("/projects", h.RequireAdmin(h.AdminProjectsHandler))
+		r.Get("/levels", h.RequireAdmin(h.AdminLevelsHandler))
+		r.Get("/debt", h.RequireAdmin(h.AdminDebtHandler))
+		r.Get("/dunning", h.RequireAdmin(h.AdminDunningHandler))
 		r.Get("/logs", h.RequireAdmin(h.AdminLogsHandler))
+		r.Get("/emails", h.RequireAdmin(h.AdminEmailsHandler))
+		r.Get("/email-templates", h.RequireAdmin(h.AdminEmailTemplatesHandler))
+		r.Get("/email-templates/{name}", h.RequireAdmin(h.AdminEmailTemplateHandler))
+		r.Get("/announcements", h.RequireAdmin(h.AdminAnnouncementsHandler))
+		r.Get("/jobs", h.RequireAdmin(h.AdminJobsHandler))
 		r.Get("/settings", h.RequireAdmin(h.AdminSettingsHandler))
 	})
 
@@ -105,16 +161,37 @@ func main() {
 	r.Route("/api/admin", func(r chi.Router) {
 		r.Use(authenticator.RequireAuth)
 		r.Get("/users", h.RequireAdmin(h.AdminUsersAPIHandler))
+		r.Put("/users/{id}", h.RequireAdmin(h.AdminUpdateUserHandler))
+		r.Post("/users/{id}/payments-id", h.RequireAdmin(h.AdminReassignPaymentsIDHandler))
+		r.Post("/applications/{id}/approve", h.AdminApproveApplicationHandler) // Council or admin
+		r.Post("/applications/{id}/reject", h.AdminRejectApplicationHandler)   // Council or admin
 		r.Post("/roles/assign", h.RequireAdmin(h.AdminAssignRoleHandler))
 		r.Post("/roles/remove", h.RequireAdmin(h.AdminRemoveRoleHandler))
 		r.Get("/users/roles", h.RequireAdmin(h.AdminGetUserRolesHandler))
 		r.Post("/test-email", h.RequireAdmin(h.AdminTestEmailHandler))
+		r.Post("/emails/{id}/resend", h.RequireAdmin(h.AdminResendEmailHandler))
+		r.Post("/emails/{id}/cancel", h.RequireAdmin(h.AdminCancelEmailHandler))
+		r.Put("/email-templates/{name}", h.RequireAdmin(h.AdminSaveEmailTemplateHandler))
+		r.Post("/email-templates/{name}/preview", h.RequireAdmin(h.AdminPreviewEmailTemplateHandler))
+		r.Post("/email-templates/{name}/reset", h.RequireAdmin(h.AdminResetEmailTemplateHandler))
+		r.Post("/email-templates/{name}/versions/{version}/restore", h.RequireAdmin(h.AdminRestoreEmailTemplateHandler))
+		r.Post("/announcements/preview", h.RequireAdmin(h.AdminPreviewAnnouncementHandler))
+		r.Post("/announcements", h.RequireAdmin(h.AdminSendAnnouncementHandler))
 		r.Post("/payments/assign", h.RequireAdmin(h.AdminAssignPaymentHandler))
 		r.Post("/payments/update", h.RequireAdmin(h.AdminUpdatePaymentHandler))
+		r.Post("/payments", h.RequireAdmin(h.AdminCreatePaymentHandler))
+		r.Put("/payments/{id}", h.RequireAdmin(h.AdminUpdateManualPaymentHandler))
+		r.Post("/payments/{id}/void", h.RequireAdmin(h.AdminVoidPaymentHandler))
 		r.Get("/projects", h.RequireAdmin(h.AdminProjectsAPIHandler))
 		r.Post("/projects", h.RequireAdmin(h.AdminCreateProjectHandler))
 		r.Delete("/projects", h.RequireAdmin(h.AdminDeleteProjectHandler))
 		r.Get("/projects/payments", h.RequireAdmin(h.AdminProjectPaymentsHandler))
+		r.Post("/levels", h.RequireAdmin(h.AdminCreateLevelHandler))
+		r.Put("/levels/{id}", h.RequireAdmin(h.AdminUpdateLevelHandler))
+		r.Post("/levels/{id}/price-change", h.RequireAdmin(h.AdminLevelPriceChangeHandler))
+		r.Post("/debt/exemptions", h.RequireAdmin(h.AdminCreateDebtExemptionHandler))
+		r.Delete("/debt/exemptions/{id}", h.RequireAdmin(h.AdminDeleteDebtExemptionHandler))
+		r.Post("/jobs/run", h.RequireAdmin(h.AdminRunJobHandler))
 	})
 
 	// Create server
@@ -149,5 +226,12 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Let running jobs finish (they are cancelled if the timeout expires)
+	sched.Stop(ctx)
+
+	// Stop the email worker, an email being sent is queued again on the next start
+	stopWorker()
+	<-workerDone
+
 	fmt.Println("Server stopped")
 }
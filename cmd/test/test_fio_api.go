@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"time"
@@ -10,39 +11,59 @@ import (
 
 	"github.com/base48/member-portal/internal/config"
 	"github.com/base48/member-portal/internal/fio"
+	"github.com/base48/member-portal/internal/fio/fiotest"
 )
 
 // Test script to verify FIO API connectivity and fetch recent transactions
 //
 // Usage:
-//   go run cmd/test/test_fio_api.go
+//   go run cmd/test/test_fio_api.go          # real API (BANK_FIO_TOKEN, BANK_FIO_API_URL)
+//   go run cmd/test/test_fio_api.go --fake   # offline, recorded fixture from internal/fio/fiotest
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
-	}
-
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
-	}
-
-	// Check FIO token
-	if cfg.BankFIOToken == "" {
-		log.Fatal("BANK_FIO_TOKEN is required in .env file")
-	}
+	fake := flag.Bool("fake", false, "Use the built-in fake FIO server instead of the real API")
+	flag.Parse()
 
-	log.Println("✓ FIO token loaded")
-
-	// Create FIO API client
-	fioClient := fio.NewClient(cfg.BankFIOToken)
-	ctx := context.Background()
+	var fioClient *fio.Client
 
 	// Fetch last 7 days of transactions as a test
 	dateFrom := time.Now().AddDate(0, 0, -7)
 	dateTo := time.Now()
 
+	if *fake {
+		srv := fiotest.NewServer("fake-token")
+		defer srv.Close()
+
+		log.Printf("✓ Fake FIO server running at %s", srv.URL)
+		fioClient = fio.NewClient("fake-token", fio.WithBaseURL(srv.URL), fio.WithRequestInterval(0))
+
+		// The recorded fixture covers January - April 2024
+		dateFrom = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		dateTo = time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC)
+	} else {
+		// Load environment variables
+		if err := godotenv.Load(); err != nil {
+			log.Println("No .env file found, using environment variables")
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+
+		// Check FIO token
+		if cfg.BankFIOToken == "" {
+			log.Fatal("BANK_FIO_TOKEN is required in .env file")
+		}
+
+		log.Println("✓ FIO token loaded")
+
+		// Create FIO API client
+		fioClient = fio.NewClient(cfg.BankFIOToken, fio.WithBaseURL(cfg.BankFIOAPIURL))
+	}
+
+	ctx := context.Background()
+
 	log.Printf("Fetching transactions from %s to %s...",
 		fio.FormatDate(dateFrom), fio.FormatDate(dateTo))
 
@@ -59,7 +80,7 @@ func main() {
 	log.Printf("\n✓ Successfully fetched %d transactions\n", len(transactions))
 
 	if len(transactions) == 0 {
-		log.Println("No transactions found in the last 7 days")
+		log.Println("No transactions found in the selected period")
 		return
 	}
 
@@ -87,9 +108,9 @@ func main() {
 			message = message[:25] + "..."
 		}
 
-		fmt.Printf("%-12s %10.2f CZK %-30s %-10s %-15s %s\n",
+		fmt.Printf("%-12s %14s %-30s %-10s %-15s %s\n",
 			tx.Date[:10], // Only date part
-			tx.Amount,
+			tx.Amount.Format(),
 			accountDisplay,
 			tx.VariableSymbol,
 			tx.BankName,
@@ -0,0 +1,386 @@
+// Package announcements sends an email written by an admin (a general
+// assembly invitation, a closure of the space, ...) to a segment of members.
+// The segment is built from the state, level, debt status, council and staff
+// flags and Keycloak roles of the members. The subject and the body are text
+// templates with merge fields of the recipient. The emails are queued in the
+// outbox spread by EMAIL_BULK_RATE and every recipient is logged to
+// system_logs.
+package announcements
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/debt"
+	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/membership"
+)
+
+// TemplateName is the email template the announcements are sent with
+const TemplateName = "announcement.html"
+
+// Debt statuses of a segment
+const (
+	DebtAny       = ""            // Members in debt and not in debt
+	DebtInDebt    = "in_debt"     // In debt under the debt policy
+	DebtNotInDebt = "not_in_debt" // Not in debt (including exempt members)
+)
+
+// Segment selects the recipients. Empty fields do not filter, a list matches
+// any of its values.
+type Segment struct {
+	States   []string `json:"states,omitempty"`
+	LevelIDs []int64  `json:"level_ids,omitempty"`
+	Debt     string   `json:"debt,omitempty"`
+	Council  *bool    `json:"council,omitempty"`
+	Staff    *bool    `json:"staff,omitempty"`
+	Roles    []string `json:"roles,omitempty"` // Keycloak realm roles
+}
+
+// Validate checks the states and the debt status
+func (s Segment) Validate() error {
+	for _, state := range s.States {
+		if !membership.IsValidState(state) {
+			return fmt.Errorf("neznámý stav '%s'", state)
+		}
+	}
+	switch s.Debt {
+	case DebtAny, DebtInDebt, DebtNotInDebt:
+	default:
+		return fmt.Errorf("neznámý stav dluhu '%s'", s.Debt)
+	}
+	return nil
+}
+
+// Describe returns the segment in Czech for the history of announcements
+func (s Segment) Describe(levels []db.Level) string {
+	var parts []string
+	if len(s.States) > 0 {
+		states := make([]string, len(s.States))
+		for i, state := range s.States {
+			states[i] = membership.StateLabel(state)
+		}
+		parts = append(parts, "stav: "+strings.Join(states, ", "))
+	}
+	if len(s.LevelIDs) > 0 {
+		names := make([]string, 0, len(s.LevelIDs))
+		for _, id := range s.LevelIDs {
+			name := fmt.Sprintf("#%d", id)
+			for _, l := range levels {
+				if l.ID == id {
+					name = l.Name
+				}
+			}
+			names = append(names, name)
+		}
+		parts = append(parts, "úroveň: "+strings.Join(names, ", "))
+	}
+	switch s.Debt {
+	case DebtInDebt:
+		parts = append(parts, "v dluhu")
+	case DebtNotInDebt:
+		parts = append(parts, "bez dluhu")
+	}
+	if s.Council != nil {
+		parts = append(parts, yesNo(*s.Council, "výbor", "mimo výbor"))
+	}
+	if s.Staff != nil {
+		parts = append(parts, yesNo(*s.Staff, "staff", "mimo staff"))
+	}
+	if len(s.Roles) > 0 {
+		parts = append(parts, "role: "+strings.Join(s.Roles, ", "))
+	}
+	if len(parts) == 0 {
+		return "všichni"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func yesNo(b bool, yes, no string) string {
+	if b {
+		return yes
+	}
+	return no
+}
+
+// RoleMembers returns the Keycloak IDs of the users with a realm role
+type RoleMembers func(ctx context.Context, role string) ([]string, error)
+
+// Recipient is a member the announcement is sent to, with the debt status
+// evaluated by the debt policy
+type Recipient struct {
+	debt.Status
+	LevelName string
+}
+
+// Recipients returns the members in the segment in the order of ListUsers.
+// roles is needed only when the segment filters by Keycloak roles.
+func Recipients(ctx context.Context, queries *db.Queries, policy debt.Policy, roles RoleMembers, seg Segment, now time.Time) ([]Recipient, error) {
+	if err := seg.Validate(); err != nil {
+		return nil, err
+	}
+
+	statuses, err := debt.Load(ctx, queries, policy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	levels, err := queries.ListAllLevels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list levels: %w", err)
+	}
+	levelNames := make(map[int64]string, len(levels))
+	for _, l := range levels {
+		levelNames[l.ID] = l.Name
+	}
+
+	var withRole map[string]bool
+	if len(seg.Roles) > 0 {
+		if roles == nil {
+			return nil, fmt.Errorf("role v Keycloaku nejsou dostupné (chybí service account)")
+		}
+		withRole = make(map[string]bool)
+		for _, role := range seg.Roles {
+			ids, err := roles(ctx, role)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list users of role %s: %w", role, err)
+			}
+			for _, id := range ids {
+				withRole[id] = true
+			}
+		}
+	}
+
+	var recipients []Recipient
+	for _, s := range statuses {
+		u := s.User
+		switch {
+		case u.Email == "":
+		case len(seg.States) > 0 && !contains(seg.States, u.State):
+		case len(seg.LevelIDs) > 0 && !contains(seg.LevelIDs, u.LevelID):
+		case seg.Debt == DebtInDebt && !s.InDebt:
+		case seg.Debt == DebtNotInDebt && s.InDebt:
+		case seg.Council != nil && u.IsCouncil != *seg.Council:
+		case seg.Staff != nil && u.IsStaff != *seg.Staff:
+		case withRole != nil && !withRole[u.KeycloakID.String]:
+		default:
+			recipients = append(recipients, Recipient{Status: s, LevelName: levelNames[u.LevelID]})
+		}
+	}
+	return recipients, nil
+}
+
+func contains[T comparable](list []T, v T) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Fields are the merge fields of a recipient, e.g. {{.Name}}
+var Fields = []string{"Name", "Username", "Email", "PaymentsID", "LevelName", "MonthlyFee", "Balance", "PortalURL"}
+
+// Data returns the merge fields of the recipient
+func Data(r Recipient, portalURL string) map[string]interface{} {
+	name := r.User.Realname.String
+	if name == "" {
+		name = r.User.Username.String
+	}
+	return map[string]interface{}{
+		"Name":       name,
+		"Username":   r.User.Username.String,
+		"Email":      r.User.Email,
+		"PaymentsID": r.User.PaymentsID.String,
+		"LevelName":  r.LevelName,
+		"MonthlyFee": r.MonthlyFee,
+		"Balance":    r.Balance,
+		"PortalURL":  portalURL,
+	}
+}
+
+// Message is an announcement: text templates of the subject and the body
+type Message struct {
+	Subject string
+	Body    string
+}
+
+// Template is a parsed Message
+type Template struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// Parse parses the subject and the body. A merge field that does not exist
+// fails when rendered.
+func (m Message) Parse() (*Template, error) {
+	if strings.TrimSpace(m.Subject) == "" {
+		return nil, fmt.Errorf("předmět: prázdný předmět")
+	}
+	if strings.TrimSpace(m.Body) == "" {
+		return nil, fmt.Errorf("text: prázdný text")
+	}
+	subject, err := template.New("subject").Option("missingkey=error").Parse(m.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("předmět: %w", err)
+	}
+	body, err := template.New("body").Option("missingkey=error").Parse(m.Body)
+	if err != nil {
+		return nil, fmt.Errorf("text: %w", err)
+	}
+	return &Template{subject: subject, body: body}, nil
+}
+
+// Render returns the subject and the body for the merge fields
+func (t *Template) Render(data map[string]interface{}) (subject, body string, err error) {
+	var buf bytes.Buffer
+	if err := t.subject.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("předmět: %w", err)
+	}
+	subject = strings.Join(strings.Fields(buf.String()), " ") // A header is one line
+
+	buf.Reset()
+	if err := t.body.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("text: %w", err)
+	}
+	return subject, strings.TrimSpace(buf.String()), nil
+}
+
+// Interval returns the delay between two emails of an announcement
+func Interval(cfg *config.Config) time.Duration {
+	return time.Minute / time.Duration(max(cfg.EmailBulkRate, 1))
+}
+
+// Sender queues announcements
+type Sender struct {
+	Config  *config.Config
+	Queries *db.Queries
+	Email   *email.Client
+}
+
+// Result of sending an announcement
+type Result struct {
+	Announcement db.Announcement
+	Queued       int
+	Failed       int
+	Errors       []string  // Recipients that failed, for the admin
+	LastAt       time.Time // When the last email is delivered at the earliest
+}
+
+// Send records the announcement and queues an email for every recipient, the
+// i-th one delivered Interval*i after now. The message must render for every
+// recipient, otherwise nothing is sent.
+func (s *Sender) Send(ctx context.Context, msg Message, seg Segment, recipients []Recipient, createdBy int64, now time.Time) (Result, error) {
+	var result Result
+	if !s.Email.Enabled() {
+		return result, fmt.Errorf("emaily jsou vypnuté (EMAIL_TRANSPORT)")
+	}
+	if len(recipients) == 0 {
+		return result, fmt.Errorf("segment nemá žádné příjemce")
+	}
+
+	tmpl, err := msg.Parse()
+	if err != nil {
+		return result, err
+	}
+	type rendered struct{ subject, body string }
+	emails := make([]rendered, len(recipients))
+	for i, r := range recipients {
+		subject, body, err := tmpl.Render(Data(r, s.Config.BaseURL))
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", r.User.Email, err)
+		}
+		emails[i] = rendered{subject, body}
+	}
+
+	segment, err := json.Marshal(seg)
+	if err != nil {
+		return result, err
+	}
+	result.Announcement, err = s.Queries.CreateAnnouncement(ctx, db.CreateAnnouncementParams{
+		Subject:    msg.Subject,
+		Body:       msg.Body,
+		Segment:    string(segment),
+		Recipients: int64(len(recipients)),
+		CreatedBy:  sql.NullInt64{Int64: createdBy, Valid: createdBy != 0},
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to save announcement: %w", err)
+	}
+
+	interval := Interval(s.Config)
+	for i, r := range recipients {
+		sendAt := now.Add(interval * time.Duration(i))
+		data := Data(r, s.Config.BaseURL)
+		data["Subject"] = emails[i].subject
+		data["Body"] = emails[i].body
+
+		err := s.Email.SendTemplated(ctx, email.SendParams{
+			UserID:          sql.NullInt64{Int64: r.User.ID, Valid: true},
+			Recipient:       r.User.Email,
+			Subject:         emails[i].subject,
+			TemplateName:    TemplateName,
+			Data:            data,
+			ListUnsubscribe: s.Config.BaseURL + "/profile",
+			NotBefore:       sendAt,
+		})
+		if err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", r.User.Email, err))
+		} else {
+			result.Queued++
+			result.LastAt = sendAt
+		}
+		s.logRecipient(ctx, result.Announcement, r, sendAt, err)
+	}
+
+	result.Announcement.Queued = int64(result.Queued)
+	result.Announcement.Failed = int64(result.Failed)
+	if err := s.Queries.UpdateAnnouncementResult(ctx, db.UpdateAnnouncementResultParams{
+		Queued: result.Announcement.Queued,
+		Failed: result.Announcement.Failed,
+		ID:     result.Announcement.ID,
+	}); err != nil {
+		return result, fmt.Errorf("failed to save announcement result: %w", err)
+	}
+	return result, nil
+}
+
+// logRecipient writes to system_logs that the email of the announcement to a
+// recipient was queued, or why it was not. Whether it was delivered is up to
+// the outbox, which logs failed attempts itself.
+func (s *Sender) logRecipient(ctx context.Context, a db.Announcement, r Recipient, sendAt time.Time, err error) {
+	level := "info"
+	message := fmt.Sprintf("Announcement #%d queued for %s", a.ID, r.User.Email)
+	errorJSON := []byte("null")
+	if err != nil {
+		level = "error"
+		message = fmt.Sprintf("Announcement #%d failed for %s: %v", a.ID, r.User.Email, err)
+		errorJSON, _ = json.Marshal(err.Error())
+	}
+	recipientJSON, _ := json.Marshal(r.User.Email)
+
+	if _, dbErr := s.Queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "announcement",
+		Level:     level,
+		UserID:    sql.NullInt64{Int64: r.User.ID, Valid: true},
+		Message:   message,
+		Metadata: sql.NullString{
+			String: fmt.Sprintf(`{"announcement_id":%d,"recipient":%s,"send_at":"%s","error":%s}`,
+				a.ID, recipientJSON, sendAt.UTC().Format(time.RFC3339), errorJSON),
+			Valid: true,
+		},
+	}); dbErr != nil {
+		log.Printf("[Announcement] Warning: failed to log to database: %v", dbErr)
+	}
+}
@@ -0,0 +1,268 @@
+package announcements
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/debt"
+	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/keycloak"
+	"github.com/base48/member-portal/internal/keycloak/keycloaktest"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// createMembers creates:
+//   - jan: accepted, level 3, in debt, council
+//   - eva: accepted, level 1, staff, active_member in Keycloak
+//   - petr: suspended, level 3
+//   - olga: exmember, level 1
+func createMembers(t *testing.T, queries *db.Queries) {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, p := range []db.CreateUserParams{
+		{Email: "jan@example.com", Realname: sql.NullString{String: "Jan Novák", Valid: true}, LevelID: 3, State: membership.StateAccepted, IsCouncil: true},
+		{Email: "eva@example.com", Username: sql.NullString{String: "eva", Valid: true}, LevelID: 1, State: membership.StateAccepted, IsStaff: true},
+		{Email: "petr@example.com", LevelID: 3, State: membership.StateSuspended},
+		{Email: "olga@example.com", LevelID: 1, State: membership.StateExmember},
+	} {
+		p.KeycloakID = sql.NullString{String: "kc-" + strings.TrimSuffix(p.Email, "@example.com"), Valid: true}
+		user, err := queries.CreateUser(ctx, p)
+		if err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		if p.Email == "jan@example.com" {
+			if _, err := queries.CreateFee(ctx, db.CreateFeeParams{
+				UserID:      user.ID,
+				LevelID:     3,
+				PeriodStart: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+				Amount:      money.FromKoruny(1000),
+			}); err != nil {
+				t.Fatalf("create fee: %v", err)
+			}
+		}
+	}
+}
+
+func emails(recipients []Recipient) string {
+	var list []string
+	for _, r := range recipients {
+		list = append(list, strings.TrimSuffix(r.User.Email, "@example.com"))
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+func TestRecipients(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+	createMembers(t, queries)
+
+	srv := keycloaktest.NewServer("base48", membership.ActiveMemberRole)
+	defer srv.Close()
+	srv.AddUser("kc-eva", "eva@example.com")
+	srv.Grant("kc-eva", membership.ActiveMemberRole)
+	kc := keycloak.NewClientWithTokenSource(&config.Config{KeycloakURL: srv.URL, KeycloakRealm: "base48"}, srv.Tokens())
+	roles := func(ctx context.Context, role string) ([]string, error) {
+		users, err := kc.GetRoleUsers(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, len(users))
+		for i, u := range users {
+			ids[i] = u.ID
+		}
+		return ids, nil
+	}
+
+	yes, no := true, false
+	tests := []struct {
+		name string
+		seg  Segment
+		want string
+	}{
+		{"everyone", Segment{}, "eva,jan,olga,petr"},
+		{"states", Segment{States: []string{membership.StateAccepted, membership.StateSuspended}}, "eva,jan,petr"},
+		{"level", Segment{LevelIDs: []int64{3}}, "jan,petr"},
+		{"in debt", Segment{Debt: DebtInDebt}, "jan"},
+		{"not in debt", Segment{States: []string{membership.StateAccepted}, Debt: DebtNotInDebt}, "eva"},
+		{"council", Segment{Council: &yes}, "jan"},
+		{"not staff", Segment{Staff: &no, LevelIDs: []int64{1}}, "olga"},
+		{"role", Segment{Roles: []string{membership.ActiveMemberRole}}, "eva"},
+		{"nobody", Segment{Council: &yes, Staff: &yes}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Recipients(ctx, queries, debt.Policy{}, roles, tt.seg, time.Now())
+			if err != nil {
+				t.Fatalf("Recipients: %v", err)
+			}
+			if emails(got) != tt.want {
+				t.Errorf("got %s, want %s", emails(got), tt.want)
+			}
+		})
+	}
+
+	for _, seg := range []Segment{
+		{States: []string{"member"}},
+		{Debt: "maybe"},
+	} {
+		if _, err := Recipients(ctx, queries, debt.Policy{}, roles, seg, time.Now()); err == nil {
+			t.Errorf("%+v: no error", seg)
+		}
+	}
+	if _, err := Recipients(ctx, queries, debt.Policy{}, nil, Segment{Roles: []string{"in_debt"}}, time.Now()); err == nil {
+		t.Error("roles without a service account: no error")
+	}
+}
+
+func TestMessage(t *testing.T) {
+	r := Recipient{LevelName: "Full"}
+	r.User = db.User{Email: "eva@example.com", Username: sql.NullString{String: "eva", Valid: true}}
+	r.Balance = money.FromKoruny(-500)
+	data := Data(r, "https://portal.example.com")
+
+	tmpl, err := Message{
+		Subject: "Ahoj {{.Name}},\nschůze",
+		Body:    "\nTvůj zůstatek je {{.Balance.Format}} ({{.LevelName}}).\n\n{{.PortalURL}}\n",
+	}.Parse()
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	subject, body, err := tmpl.Render(data)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if subject != "Ahoj eva, schůze" {
+		t.Errorf("subject %q", subject)
+	}
+	if want := "Tvůj zůstatek je " + money.FromKoruny(-500).Format() + " (Full).\n\nhttps://portal.example.com"; body != want {
+		t.Errorf("body %q, want %q", body, want)
+	}
+
+	for _, tt := range []struct {
+		msg  Message
+		part string
+	}{
+		{Message{Subject: " ", Body: "x"}, "předmět"},
+		{Message{Subject: "x", Body: ""}, "text"},
+		{Message{Subject: "{{.Name", Body: "x"}, "předmět"},
+		{Message{Subject: "x", Body: "{{if .Name}}"}, "text"},
+		{Message{Subject: "x", Body: "{{.Nmae}}"}, "text"},
+	} {
+		tmpl, err := tt.msg.Parse()
+		if err == nil {
+			_, _, err = tmpl.Render(data)
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), tt.part+":") {
+			t.Errorf("%+v: error %v, want a %s error", tt.msg, err, tt.part)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	t.Chdir("../..") // web/templates/email
+	queries := dbtest.New(t)
+	ctx := context.Background()
+	createMembers(t, queries)
+
+	cfg := &config.Config{
+		SMTPFrom:         "Base48 <noreply@example.com>",
+		BaseURL:          "https://portal.example.com",
+		EmailMaxAttempts: 3,
+		EmailBulkRate:    2, // One every 30 seconds
+	}
+	sent := &email.MemoryTransport{}
+	sender := &Sender{Config: cfg, Queries: queries, Email: email.New(cfg, queries, email.WithTransport(sent))}
+
+	recipients, err := Recipients(ctx, queries, debt.Policy{}, nil, Segment{States: []string{membership.StateAccepted}}, time.Now())
+	if err != nil || len(recipients) != 2 {
+		t.Fatalf("recipients %+v, %v", recipients, err)
+	}
+	seg := Segment{States: []string{membership.StateAccepted}}
+	now := time.Now().UTC().Add(time.Hour).Truncate(time.Second) // Not clamped to the current time
+
+	// A merge field that does not exist sends nothing
+	if _, err := sender.Send(ctx, Message{Subject: "Schůze", Body: "Ahoj {{.Nmae}}"}, seg, recipients, 0, now); err == nil {
+		t.Error("broken message: no error")
+	}
+	if list, _ := queries.ListAnnouncements(ctx, 10); len(list) != 0 {
+		t.Errorf("broken message saved: %+v", list)
+	}
+
+	result, err := sender.Send(ctx, Message{Subject: "Schůze pro {{.Name}}", Body: "Ahoj {{.Name}},\nschůze je ve čtvrtek."}, seg, recipients, 0, now)
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if result.Queued != 2 || result.Failed != 0 || !result.LastAt.Equal(now.Add(30*time.Second)) {
+		t.Errorf("result %+v", result)
+	}
+
+	list, err := queries.ListAnnouncements(ctx, 10)
+	if err != nil || len(list) != 1 || list[0].Recipients != 2 || list[0].Queued != 2 || list[0].Subject != "Schůze pro {{.Name}}" {
+		t.Fatalf("announcements %+v, %v", list, err)
+	}
+	var saved Segment
+	if err := json.Unmarshal([]byte(list[0].Segment), &saved); err != nil || len(saved.States) != 1 {
+		t.Errorf("segment %q, %v", list[0].Segment, err)
+	}
+
+	// The emails are spread by EMAIL_BULK_RATE
+	outbox, err := queries.ListEmails(ctx, db.ListEmailsParams{Limit: 10})
+	if err != nil || len(outbox) != 2 {
+		t.Fatalf("outbox %+v, %v", outbox, err)
+	}
+	sendAt := make(map[string]time.Time)
+	for _, e := range outbox {
+		sendAt[e.Recipient] = e.NextAttemptAt
+		if e.Template != TemplateName || !e.ListUnsubscribe.Valid {
+			t.Errorf("email %+v", e)
+		}
+	}
+	first, second := recipients[0].User.Email, recipients[1].User.Email
+	if !sendAt[first].Equal(now) || !sendAt[second].Equal(now.Add(30*time.Second)) {
+		t.Errorf("send at %v", sendAt)
+	}
+
+	if r, err := sender.Email.Deliver(ctx, now); err != nil || r.Sent != 1 {
+		t.Fatalf("deliver now: %+v, %v", r, err)
+	}
+	messages := sent.Messages()
+	if len(messages) != 1 || messages[0].To[0] != first {
+		t.Fatalf("sent %+v", messages)
+	}
+	name := Data(recipients[0], "")["Name"].(string)
+	if messages[0].Subject() != "Schůze pro "+name || !strings.Contains(messages[0].Text(), "Ahoj "+name+",") {
+		t.Errorf("subject %q, text %q", messages[0].Subject(), messages[0].Text())
+	}
+
+	logs, err := queries.ListLogsBySubsystem(ctx, db.ListLogsBySubsystemParams{Subsystem: "announcement", Limit: 10})
+	if err != nil || len(logs) != 2 {
+		t.Fatalf("logs %+v, %v", logs, err)
+	}
+	for _, l := range logs {
+		var metadata struct {
+			AnnouncementID int64 `json:"announcement_id"`
+			Recipient      string
+		}
+		json.Unmarshal([]byte(l.Metadata.String), &metadata)
+		if l.Level != "info" || metadata.AnnouncementID != list[0].ID || metadata.Recipient == "" {
+			t.Errorf("log %+v", l)
+		}
+	}
+
+	// Without a transport nothing is recorded
+	sender.Email = email.New(&config.Config{}, queries)
+	if _, err := sender.Send(ctx, Message{Subject: "x", Body: "x"}, seg, recipients, 0, now); err == nil {
+		t.Error("disabled emails: no error")
+	}
+}
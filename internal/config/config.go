@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 type Config struct {
@@ -24,7 +25,8 @@ type Config struct {
 	KeycloakServiceAccountClientSecret string
 
 	// FIO Bank
-	BankFIOToken string
+	BankFIOToken  string
+	BankFIOAPIURL string // Override the API endpoint (e.g. a fake server for testing)
 
 	// Session
 	SessionSecret string
@@ -35,13 +37,60 @@ type Config struct {
 	SMTPUsername string
 	SMTPPassword string
 	SMTPFrom     string
+	SMTPSecurity string // "auto", "starttls", "tls" or "none"
+	EmailReplyTo string // Reply-To of all emails, e.g. the board's address (optional)
+
+	// Email transport: "smtp", "maildir" (for development) or "none";
+	// empty means smtp when SMTP_HOST is set, none otherwise
+	EmailTransport string
+	EmailMaildir   string // Maildir of the maildir transport
+
+	// Email outbox
+	EmailMaxAttempts int // Delivery attempts before an email is given up (dead letter)
+	EmailBulkRate    int // Bulk emails (announcements) delivered per minute
+
+	// Scheduler (cron expressions, "off" disables a job's schedule). Off until
+	// SCHEDULER_ENABLED is set; jobs that change members' roles or email
+	// debtors are off until their schedule is set as well.
+	SchedulerEnabled        bool
+	ScheduleFIOSync         string
+	ScheduleMonthlyFees     string
+	ScheduleDebtStatus      string
+	ScheduleUnmatchedReport string
+	ScheduleDebtSuspension  string
+	ScheduleDunning         string
+
+	// First period the monthly fees catch-up bills (YYYY-MM), empty to bill
+	// the current period only
+	FeesCatchUpFrom string
+
+	// Who counts as a member in debt (see internal/debt)
+	DebtThreshold string // Debt in Kč ("500") or in months of the fee ("1.5m")
+	DebtGraceDays int    // Days after a fee is created before it counts
+
+	// Reminders to members in debt (see internal/dunning)
+	DunningWarning      string // Debt of the warning, like DebtThreshold
+	DunningFinal        string // Debt of the final notice, like DebtThreshold
+	DunningCooldownDays int    // Days between two reminders to a member
+	DunningSuspendDays  int    // Days after the final notice to suspend, 0 never
+
+	// Automatic suspension of members in debt who got the dunning final
+	// notice (see jobs.SuspendDebtors)
+	DebtSuspendThreshold int // Debt in Kč that counts, 0 disables the suspension
+	DebtSuspendDays      int // How long the debt has to last
+
+	// Variable symbols of new members (see internal/vs)
+	VSScheme     string // "sequential", "year" or "checkdigit"
+	VSRangeStart int64
+	VSRangeEnd   int64
+	VSYearDigits int
 }
 
 func Load() (*Config, error) {
 	cfg := &Config{
 		Port:                               getEnv("PORT", "8080"),
 		BaseURL:                            getEnv("BASE_URL", "http://localhost:8080"),
-		DatabaseURL:                        getEnv("DATABASE_URL", "file:./data/portal.db?_fk=1"),
+		DatabaseURL:                        LoadDatabaseURL(),
 		KeycloakURL:                        getEnv("KEYCLOAK_URL", ""),
 		KeycloakRealm:                      getEnv("KEYCLOAK_REALM", ""),
 		KeycloakClientID:                   getEnv("KEYCLOAK_CLIENT_ID", ""),
@@ -49,12 +98,39 @@ func Load() (*Config, error) {
 		KeycloakServiceAccountClientID:     getEnv("KEYCLOAK_SERVICE_ACCOUNT_CLIENT_ID", ""),
 		KeycloakServiceAccountClientSecret: getEnv("KEYCLOAK_SERVICE_ACCOUNT_CLIENT_SECRET", ""),
 		BankFIOToken:                       getEnv("BANK_FIO_TOKEN", ""),
+		BankFIOAPIURL:                      getEnv("BANK_FIO_API_URL", ""),
 		SessionSecret:                      getEnv("SESSION_SECRET", ""),
 		SMTPHost:                           getEnv("SMTP_HOST", ""),
 		SMTPPort:                           getEnvInt("SMTP_PORT", 587),
 		SMTPUsername:                       getEnv("SMTP_USERNAME", ""),
 		SMTPPassword:                       getEnv("SMTP_PASSWORD", ""),
 		SMTPFrom:                           getEnv("SMTP_FROM", ""),
+		SMTPSecurity:                       getEnv("SMTP_SECURITY", "auto"),
+		EmailReplyTo:                       getEnv("EMAIL_REPLY_TO", ""),
+		EmailTransport:                     getEnv("EMAIL_TRANSPORT", ""),
+		EmailMaildir:                       getEnv("EMAIL_MAILDIR", "./data/mail"),
+		EmailMaxAttempts:                   getEnvInt("EMAIL_MAX_ATTEMPTS", 8),
+		EmailBulkRate:                      getEnvInt("EMAIL_BULK_RATE", 30),
+		SchedulerEnabled:                   getEnvBool("SCHEDULER_ENABLED", false),
+		ScheduleFIOSync:                    getSchedule("SCHEDULE_FIO_SYNC", "0 3 * * *"),
+		ScheduleMonthlyFees:                getSchedule("SCHEDULE_MONTHLY_FEES", "0 0 1 * *"),
+		ScheduleDebtStatus:                 getSchedule("SCHEDULE_DEBT_STATUS", "off"),
+		ScheduleUnmatchedReport:            getSchedule("SCHEDULE_UNMATCHED_REPORT", "30 3 * * 1"),
+		ScheduleDebtSuspension:             getSchedule("SCHEDULE_DEBT_SUSPENSION", "0 4 * * *"),
+		ScheduleDunning:                    getSchedule("SCHEDULE_DUNNING", "off"),
+		FeesCatchUpFrom:                    getEnv("FEES_CATCHUP_FROM", ""),
+		DebtThreshold:                      getEnv("DEBT_THRESHOLD", "0"),
+		DebtGraceDays:                      getEnvInt("DEBT_GRACE_DAYS", 0),
+		DunningWarning:                     getEnv("DUNNING_WARNING", "2m"),
+		DunningFinal:                       getEnv("DUNNING_FINAL", "3m"),
+		DunningCooldownDays:                getEnvInt("DUNNING_COOLDOWN_DAYS", 14),
+		DunningSuspendDays:                 getEnvInt("DUNNING_SUSPEND_DAYS", 0),
+		DebtSuspendThreshold:               getEnvInt("DEBT_SUSPEND_THRESHOLD", 0),
+		DebtSuspendDays:                    getEnvInt("DEBT_SUSPEND_DAYS", 90),
+		VSScheme:                           getEnv("VS_SCHEME", "sequential"),
+		VSRangeStart:                       int64(getEnvInt("VS_RANGE_START", 1000)),
+		VSRangeEnd:                         int64(getEnvInt("VS_RANGE_END", 9999999999)),
+		VSYearDigits:                       getEnvInt("VS_YEAR_DIGITS", 3),
 	}
 
 	// Validate required fields
@@ -73,10 +149,32 @@ func Load() (*Config, error) {
 	if cfg.SessionSecret == "" {
 		return nil, fmt.Errorf("SESSION_SECRET is required")
 	}
+	switch cfg.EmailTransport {
+	case "", "smtp", "maildir", "none":
+	default:
+		return nil, fmt.Errorf("unknown EMAIL_TRANSPORT '%s' (use smtp, maildir or none)", cfg.EmailTransport)
+	}
+	if cfg.EmailTransport == "smtp" && cfg.SMTPHost == "" {
+		return nil, fmt.Errorf("SMTP_HOST is required with EMAIL_TRANSPORT=smtp")
+	}
+	switch cfg.SMTPSecurity {
+	case "auto", "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("unknown SMTP_SECURITY '%s' (use auto, starttls, tls or none)", cfg.SMTPSecurity)
+	}
+	if cfg.EmailBulkRate < 1 {
+		return nil, fmt.Errorf("EMAIL_BULK_RATE must be at least 1 email per minute")
+	}
 
 	return cfg, nil
 }
 
+// LoadDatabaseURL returns DATABASE_URL without validating the rest of the config
+// (for tools like cmd/migrate that only need the database)
+func LoadDatabaseURL() string {
+	return getEnv("DATABASE_URL", "file:./data/portal.db?_fk=1")
+}
+
 func (c *Config) KeycloakIssuerURL() string {
 	return fmt.Sprintf("%s/realms/%s", c.KeycloakURL, c.KeycloakRealm)
 }
@@ -101,3 +199,22 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return defaultValue
+}
+
+// getSchedule returns a cron expression, or "" if the job is turned off
+func getSchedule(key, defaultValue string) string {
+	value := getEnv(key, defaultValue)
+	if strings.EqualFold(value, "off") {
+		return ""
+	}
+	return value
+}
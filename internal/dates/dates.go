@@ -0,0 +1,12 @@
+// Package dates handles calendar days. A day is kept as UTC midnight: the
+// SQLite driver cannot read back times stored with another offset, and days
+// compare equal whatever zone they were entered in.
+package dates
+
+import "time"
+
+// Day truncates t to its calendar day (in t's location) as UTC midnight
+func Day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,25 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDay(t *testing.T) {
+	prague := time.FixedZone("CEST", 2*60*60)
+	tests := []struct {
+		in   time.Time
+		want string
+	}{
+		{time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC), "2024-03-05"},
+		// The day in the time's own zone, not in UTC
+		{time.Date(2024, 3, 5, 0, 30, 0, 0, prague), "2024-03-05"},
+		{time.Date(2024, 3, 5, 23, 59, 0, 0, time.FixedZone("", -5*60*60)), "2024-03-05"},
+	}
+	for _, tt := range tests {
+		got := Day(tt.in)
+		if got.Location() != time.UTC || got.Format(time.DateTime) != tt.want+" 00:00:00" {
+			t.Errorf("Day(%s) = %s", tt.in, got)
+		}
+	}
+}
@@ -7,30 +7,159 @@ package db
 import (
 	"database/sql"
 	"time"
+
+	"github.com/base48/member-portal/internal/money"
 )
 
+type Announcement struct {
+	ID         int64         `json:"id"`
+	Subject    string        `json:"subject"`
+	Body       string        `json:"body"`
+	Segment    string        `json:"segment"`
+	Recipients int64         `json:"recipients"`
+	Queued     int64         `json:"queued"`
+	Failed     int64         `json:"failed"`
+	CreatedBy  sql.NullInt64 `json:"created_by"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+type Application struct {
+	ID                int64          `json:"id"`
+	UserID            int64          `json:"user_id"`
+	Realname          string         `json:"realname"`
+	Phone             sql.NullString `json:"phone"`
+	AltContact        sql.NullString `json:"alt_contact"`
+	LevelID           int64          `json:"level_id"`
+	LevelActualAmount money.Amount   `json:"level_actual_amount"`
+	Motivation        sql.NullString `json:"motivation"`
+	Status            string         `json:"status"`
+	DecidedBy         sql.NullInt64  `json:"decided_by"`
+	DecidedAt         sql.NullTime   `json:"decided_at"`
+	DecisionComment   sql.NullString `json:"decision_comment"`
+	CreatedAt         time.Time      `json:"created_at"`
+}
+
+type DebtExemption struct {
+	ID         int64         `json:"id"`
+	UserID     int64         `json:"user_id"`
+	Reason     string        `json:"reason"`
+	ValidUntil sql.NullTime  `json:"valid_until"`
+	CreatedBy  sql.NullInt64 `json:"created_by"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+type DunningNotice struct {
+	ID         int64        `json:"id"`
+	UserID     int64        `json:"user_id"`
+	Stage      string       `json:"stage"`
+	Balance    money.Amount `json:"balance"`
+	SentAt     time.Time    `json:"sent_at"`
+	ResolvedAt sql.NullTime `json:"resolved_at"`
+}
+
+type EmailOutbox struct {
+	ID              int64          `json:"id"`
+	UserID          sql.NullInt64  `json:"user_id"`
+	Recipient       string         `json:"recipient"`
+	Subject         string         `json:"subject"`
+	Template        string         `json:"template"`
+	Body            string         `json:"body"`
+	Status          string         `json:"status"`
+	Attempts        int64          `json:"attempts"`
+	MaxAttempts     int64          `json:"max_attempts"`
+	NextAttemptAt   time.Time      `json:"next_attempt_at"`
+	LastError       sql.NullString `json:"last_error"`
+	CreatedAt       time.Time      `json:"created_at"`
+	SentAt          sql.NullTime   `json:"sent_at"`
+	TextBody        string         `json:"text_body"`
+	ReplyTo         sql.NullString `json:"reply_to"`
+	ListUnsubscribe sql.NullString `json:"list_unsubscribe"`
+	MessageID       string         `json:"message_id"`
+	Attachments     sql.NullString `json:"attachments"`
+}
+
+type EmailTemplateVersion struct {
+	ID        int64          `json:"id"`
+	Template  string         `json:"template"`
+	Version   int64          `json:"version"`
+	Subject   string         `json:"subject"`
+	HtmlBody  string         `json:"html_body"`
+	TextBody  string         `json:"text_body"`
+	Note      sql.NullString `json:"note"`
+	CreatedBy sql.NullInt64  `json:"created_by"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
 type Fee struct {
-	ID          int64     `json:"id"`
-	UserID      int64     `json:"user_id"`
-	LevelID     int64     `json:"level_id"`
-	PeriodStart time.Time `json:"period_start"`
-	Amount      string    `json:"amount"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int64        `json:"id"`
+	UserID      int64        `json:"user_id"`
+	LevelID     int64        `json:"level_id"`
+	PeriodStart time.Time    `json:"period_start"`
+	Amount      money.Amount `json:"amount"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+type JobRun struct {
+	ID          int64          `json:"id"`
+	JobName     string         `json:"job_name"`
+	Source      string         `json:"source"`
+	Status      string         `json:"status"`
+	TriggeredBy sql.NullInt64  `json:"triggered_by"`
+	StartedAt   time.Time      `json:"started_at"`
+	FinishedAt  sql.NullTime   `json:"finished_at"`
+	DurationMs  sql.NullInt64  `json:"duration_ms"`
+	Summary     sql.NullString `json:"summary"`
+	Error       sql.NullString `json:"error"`
+	Output      sql.NullString `json:"output"`
 }
 
 type Level struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	Amount    string    `json:"amount"`
-	Active    bool      `json:"active"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int64        `json:"id"`
+	Name      string       `json:"name"`
+	Amount    money.Amount `json:"amount"`
+	Active    bool         `json:"active"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type LevelPriceChange struct {
+	ID              int64         `json:"id"`
+	LevelID         int64         `json:"level_id"`
+	OldAmount       money.Amount  `json:"old_amount"`
+	NewAmount       money.Amount  `json:"new_amount"`
+	EffectiveFrom   time.Time     `json:"effective_from"`
+	MembersAffected int64         `json:"members_affected"`
+	MembersNotified int64         `json:"members_notified"`
+	CreatedBy       sql.NullInt64 `json:"created_by"`
+	CreatedAt       time.Time     `json:"created_at"`
+	AppliedAt       sql.NullTime  `json:"applied_at"`
+}
+
+type MembershipLevelHistory struct {
+	ID                int64          `json:"id"`
+	UserID            int64          `json:"user_id"`
+	LevelID           int64          `json:"level_id"`
+	LevelActualAmount money.Amount   `json:"level_actual_amount"`
+	EffectiveFrom     time.Time      `json:"effective_from"`
+	ChangedBy         sql.NullInt64  `json:"changed_by"`
+	Reason            sql.NullString `json:"reason"`
+	CreatedAt         time.Time      `json:"created_at"`
+}
+
+type MembershipStateHistory struct {
+	ID        int64          `json:"id"`
+	UserID    int64          `json:"user_id"`
+	FromState string         `json:"from_state"`
+	ToState   string         `json:"to_state"`
+	ChangedBy sql.NullInt64  `json:"changed_by"`
+	Reason    sql.NullString `json:"reason"`
+	ChangedAt time.Time      `json:"changed_at"`
 }
 
 type Payment struct {
 	ID             int64          `json:"id"`
 	UserID         sql.NullInt64  `json:"user_id"`
 	Date           time.Time      `json:"date"`
-	Amount         string         `json:"amount"`
+	Amount         money.Amount   `json:"amount"`
 	Kind           string         `json:"kind"`
 	KindID         string         `json:"kind_id"`
 	LocalAccount   string         `json:"local_account"`
@@ -40,6 +169,18 @@ type Payment struct {
 	StaffComment   sql.NullString `json:"staff_comment"`
 	CreatedAt      time.Time      `json:"created_at"`
 	ProjectID      sql.NullInt64  `json:"project_id"`
+	RecordedBy     sql.NullInt64  `json:"recorded_by"`
+	VoidedAt       sql.NullTime   `json:"voided_at"`
+}
+
+type PaymentsIDHistory struct {
+	ID         int64          `json:"id"`
+	UserID     int64          `json:"user_id"`
+	PaymentsID string         `json:"payments_id"`
+	ReplacedBy sql.NullString `json:"replaced_by"`
+	ChangedBy  sql.NullInt64  `json:"changed_by"`
+	Reason     sql.NullString `json:"reason"`
+	ChangedAt  time.Time      `json:"changed_at"`
 }
 
 type Project struct {
@@ -49,6 +190,12 @@ type Project struct {
 	Description sql.NullString `json:"description"`
 }
 
+type SyncCursor struct {
+	Name      string    `json:"name"`
+	LastID    int64     `json:"last_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 type SystemLog struct {
 	ID        int64          `json:"id"`
 	Subsystem string         `json:"subsystem"`
@@ -68,7 +215,7 @@ type User struct {
 	Phone             sql.NullString `json:"phone"`
 	AltContact        sql.NullString `json:"alt_contact"`
 	LevelID           int64          `json:"level_id"`
-	LevelActualAmount string         `json:"level_actual_amount"`
+	LevelActualAmount money.Amount   `json:"level_actual_amount"`
 	PaymentsID        sql.NullString `json:"payments_id"`
 	DateJoined        time.Time      `json:"date_joined"`
 	KeysGranted       sql.NullTime   `json:"keys_granted"`
@@ -32,22 +32,27 @@ INSERT INTO users (
 RETURNING *;
 
 -- name: UpdateUser :one
+-- Optimistic concurrency: the row is only updated when updated_at still equals
+-- the value the edit started from (compared by julianday, so a second-precision
+-- CURRENT_TIMESTAMP matches its .000 form). No row means a concurrent change.
+-- updated_at is written with milliseconds to tell apart edits within a second.
 UPDATE users SET
-    email = ?,
-    username = ?,
-    realname = ?,
-    phone = ?,
-    alt_contact = ?,
-    level_id = ?,
-    level_actual_amount = ?,
-    payments_id = ?,
-    state = ?,
-    is_council = ?,
-    is_staff = ?,
-    keys_granted = ?,
-    keys_returned = ?,
-    updated_at = CURRENT_TIMESTAMP
-WHERE id = ?
+    email = sqlc.arg('email'),
+    username = sqlc.arg('username'),
+    realname = sqlc.arg('realname'),
+    phone = sqlc.arg('phone'),
+    alt_contact = sqlc.arg('alt_contact'),
+    level_id = sqlc.arg('level_id'),
+    level_actual_amount = sqlc.arg('level_actual_amount'),
+    payments_id = sqlc.arg('payments_id'),
+    state = sqlc.arg('state'),
+    is_council = sqlc.arg('is_council'),
+    is_staff = sqlc.arg('is_staff'),
+    keys_granted = sqlc.arg('keys_granted'),
+    keys_returned = sqlc.arg('keys_returned'),
+    updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = sqlc.arg('id')
+  AND julianday(updated_at) = julianday(CAST(sqlc.arg('expected_updated_at') AS TEXT))
 RETURNING *;
 
 -- name: UpdateUserProfile :one
@@ -59,8 +64,10 @@ UPDATE users SET
 WHERE id = ?
 RETURNING *;
 
--- name: UpdateUserCustomFee :one
+-- name: UpdateUserLevel :one
+-- Applies a level change from the level history once it takes effect
 UPDATE users SET
+    level_id = ?,
     level_actual_amount = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
@@ -73,6 +80,13 @@ UPDATE users SET
 WHERE id = ?
 RETURNING *;
 
+-- name: UpdateUserDateJoined :one
+-- Membership starts when the application is approved, not at the first login
+UPDATE users SET
+    date_joined = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
 -- name: GetLevel :one
 SELECT * FROM levels WHERE id = ? LIMIT 1;
 
@@ -95,26 +109,35 @@ UPDATE levels SET
 WHERE id = ?
 RETURNING *;
 
+-- name: CountMembersByLevel :many
+-- Members (accepted or suspended) on each level
+SELECT level_id, COUNT(*) AS members FROM users
+WHERE state IN ('accepted', 'suspended')
+GROUP BY level_id;
+
 -- name: GetPayment :one
 SELECT * FROM payments WHERE id = ? LIMIT 1;
 
 -- name: ListPaymentsByUser :many
-SELECT * FROM payments WHERE user_id = ? ORDER BY date DESC;
+SELECT * FROM payments WHERE user_id = ? AND voided_at IS NULL ORDER BY date DESC;
 
 -- name: ListMembershipPaymentsByUser :many
--- Only payments that match the user's membership VS (payments_id)
+-- Only payments that match the user's membership VS (payments_id, current or previous)
+-- and manual payments
 SELECT p.*
 FROM payments p
 JOIN users u ON p.user_id = u.id
 WHERE p.user_id = ?
-AND p.identification = u.payments_id
+AND (p.identification = u.payments_id OR p.kind = 'manual'
+     OR p.identification IN (SELECT h.payments_id FROM payments_id_history h WHERE h.user_id = p.user_id))
+AND p.voided_at IS NULL
 ORDER BY p.date DESC;
 
 -- name: ListUnassignedPayments :many
-SELECT * FROM payments WHERE user_id IS NULL ORDER BY date DESC;
+SELECT * FROM payments WHERE user_id IS NULL AND voided_at IS NULL ORDER BY date DESC;
 
 -- name: ListRecentPayments :many
-SELECT * FROM payments ORDER BY date DESC LIMIT ?;
+SELECT * FROM payments WHERE voided_at IS NULL ORDER BY date DESC LIMIT ?;
 
 -- name: CreatePayment :one
 INSERT INTO payments (
@@ -140,6 +163,58 @@ ON CONFLICT(kind, kind_id) DO UPDATE SET
     staff_comment = excluded.staff_comment
 RETURNING *;
 
+-- name: ListPaymentsFiltered :many
+-- Payment ledger (admin). NULL filters are ignored, amounts are in haléře,
+-- dates YYYY-MM-DD (compared with the day prefix of the stored date, which
+-- date() cannot parse). search looks in the FIO message fields of raw_data
+-- (message, comment, identification) and in the staff comment. Voided
+-- payments are included (voided_at is set).
+SELECT p.* FROM payments p
+WHERE (sqlc.narg('date_from') IS NULL OR substr(p.date, 1, 10) >= sqlc.narg('date_from'))
+  AND (sqlc.narg('date_to') IS NULL OR substr(p.date, 1, 10) <= sqlc.narg('date_to'))
+  AND (sqlc.narg('kind') IS NULL OR p.kind = sqlc.narg('kind'))
+  AND (sqlc.narg('amount_min') IS NULL OR CAST(REPLACE(p.amount, '.', '') AS INTEGER) >= sqlc.narg('amount_min'))
+  AND (sqlc.narg('amount_max') IS NULL OR CAST(REPLACE(p.amount, '.', '') AS INTEGER) <= sqlc.narg('amount_max'))
+  AND (sqlc.narg('vs') IS NULL OR p.identification = sqlc.narg('vs'))
+  AND (sqlc.narg('remote_account') IS NULL OR p.remote_account LIKE '%' || sqlc.narg('remote_account') || '%')
+  AND (sqlc.narg('assigned') IS NULL OR (p.user_id IS NOT NULL OR p.project_id IS NOT NULL) = sqlc.narg('assigned'))
+  AND (sqlc.narg('user_id') IS NULL OR p.user_id = sqlc.narg('user_id'))
+  AND (sqlc.narg('project_id') IS NULL OR p.project_id = sqlc.narg('project_id'))
+  AND (sqlc.narg('search') IS NULL OR (
+        CASE WHEN json_valid(p.raw_data) THEN
+            COALESCE(json_extract(p.raw_data, '$.column16'), '') || ' ' ||
+            COALESCE(json_extract(p.raw_data, '$.column25'), '') || ' ' ||
+            COALESCE(json_extract(p.raw_data, '$.column7'), '')
+        ELSE '' END || ' ' || COALESCE(p.staff_comment, '')
+      ) LIKE '%' || sqlc.narg('search') || '%')
+ORDER BY p.date DESC, p.id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: SummarizePaymentsFiltered :one
+-- Number of payments matching the ListPaymentsFiltered filters and their
+-- total in haléře (without voided payments)
+SELECT
+    COUNT(*) AS count,
+    CAST(COALESCE(SUM(CASE WHEN p.voided_at IS NULL THEN CAST(REPLACE(p.amount, '.', '') AS INTEGER) END), 0) AS INTEGER) AS total
+FROM payments p
+WHERE (sqlc.narg('date_from') IS NULL OR substr(p.date, 1, 10) >= sqlc.narg('date_from'))
+  AND (sqlc.narg('date_to') IS NULL OR substr(p.date, 1, 10) <= sqlc.narg('date_to'))
+  AND (sqlc.narg('kind') IS NULL OR p.kind = sqlc.narg('kind'))
+  AND (sqlc.narg('amount_min') IS NULL OR CAST(REPLACE(p.amount, '.', '') AS INTEGER) >= sqlc.narg('amount_min'))
+  AND (sqlc.narg('amount_max') IS NULL OR CAST(REPLACE(p.amount, '.', '') AS INTEGER) <= sqlc.narg('amount_max'))
+  AND (sqlc.narg('vs') IS NULL OR p.identification = sqlc.narg('vs'))
+  AND (sqlc.narg('remote_account') IS NULL OR p.remote_account LIKE '%' || sqlc.narg('remote_account') || '%')
+  AND (sqlc.narg('assigned') IS NULL OR (p.user_id IS NOT NULL OR p.project_id IS NOT NULL) = sqlc.narg('assigned'))
+  AND (sqlc.narg('user_id') IS NULL OR p.user_id = sqlc.narg('user_id'))
+  AND (sqlc.narg('project_id') IS NULL OR p.project_id = sqlc.narg('project_id'))
+  AND (sqlc.narg('search') IS NULL OR (
+        CASE WHEN json_valid(p.raw_data) THEN
+            COALESCE(json_extract(p.raw_data, '$.column16'), '') || ' ' ||
+            COALESCE(json_extract(p.raw_data, '$.column25'), '') || ' ' ||
+            COALESCE(json_extract(p.raw_data, '$.column7'), '')
+        ELSE '' END || ' ' || COALESCE(p.staff_comment, '')
+      ) LIKE '%' || sqlc.narg('search') || '%');
+
 -- name: GetPaymentByKindAndID :one
 SELECT * FROM payments WHERE kind = ? AND kind_id = ? LIMIT 1;
 
@@ -150,6 +225,37 @@ UPDATE payments SET
 WHERE id = ?
 RETURNING *;
 
+-- name: CreateManualPayment :one
+-- kind_id is the next number of the 'manual' sequence (used as receipt number)
+INSERT INTO payments (
+    user_id, project_id, date, amount, kind, kind_id,
+    local_account, remote_account, identification, staff_comment, recorded_by
+) VALUES (
+    ?, ?, ?, ?, 'manual',
+    (SELECT CAST(COALESCE(MAX(CAST(kind_id AS INTEGER)), 0) + 1 AS TEXT) FROM payments WHERE kind = 'manual'),
+    ?, '', ?, ?, ?
+)
+RETURNING *;
+
+-- name: UpdateManualPayment :one
+UPDATE payments SET
+    user_id = ?,
+    project_id = ?,
+    date = ?,
+    amount = ?,
+    local_account = ?,
+    identification = ?,
+    staff_comment = ?
+WHERE id = ? AND kind = 'manual' AND voided_at IS NULL
+RETURNING *;
+
+-- name: VoidManualPayment :one
+UPDATE payments SET
+    voided_at = CURRENT_TIMESTAMP,
+    staff_comment = ?
+WHERE id = ? AND kind = 'manual' AND voided_at IS NULL
+RETURNING *;
+
 -- name: GetFee :one
 SELECT * FROM fees WHERE id = ? LIMIT 1;
 
@@ -159,6 +265,10 @@ SELECT * FROM fees WHERE user_id = ? ORDER BY period_start DESC;
 -- name: ListFeesByPeriod :many
 SELECT * FROM fees WHERE period_start = ? ORDER BY user_id;
 
+-- name: ListFeesCreatedSince :many
+-- Fees still in the grace period of the debt policy
+SELECT * FROM fees WHERE julianday(created_at) >= julianday(sqlc.arg('since')) ORDER BY user_id, period_start;
+
 -- name: CreateFee :one
 INSERT INTO fees (user_id, level_id, period_start, amount)
 VALUES (?, ?, ?, ?)
@@ -175,16 +285,39 @@ WHERE u.state = 'accepted'
 ORDER BY u.id;
 
 -- name: GetUserBalance :one
--- Calculate membership fee balance (only payments matching user's payments_id VS)
-SELECT
+-- Calculate membership fee balance in haléře (only payments matching user's payments_id VS,
+-- current or previous, and manual payments, which are entered for the user directly)
+-- Amounts are stored with two decimals ("1000.50"), so without the decimal point they are
+-- haléře and the sum is exact integer arithmetic (use money.FromHalere on the result)
+SELECT CAST(
     COALESCE((
-        SELECT SUM(CAST(p.amount AS REAL))
+        SELECT SUM(CAST(REPLACE(p.amount, '.', '') AS INTEGER))
         FROM payments p
         JOIN users u ON p.user_id = u.id
         WHERE p.user_id = ?
-        AND p.identification = u.payments_id
+        AND (p.identification = u.payments_id OR p.kind = 'manual'
+             OR p.identification IN (SELECT h.payments_id FROM payments_id_history h WHERE h.user_id = p.user_id))
+        AND p.voided_at IS NULL
+    ), 0) -
+    COALESCE((SELECT SUM(CAST(REPLACE(f.amount, '.', '') AS INTEGER)) FROM fees f WHERE f.user_id = ?), 0)
+AS INTEGER) as balance;
+
+-- name: ListUserBalances :many
+-- Balance of every user in haléře, computed like GetUserBalance in a single
+-- query (for jobs that go through all members)
+SELECT u.id AS user_id, CAST(
+    COALESCE((
+        SELECT SUM(CAST(REPLACE(p.amount, '.', '') AS INTEGER))
+        FROM payments p
+        WHERE p.user_id = u.id
+        AND (p.identification = u.payments_id OR p.kind = 'manual'
+             OR p.identification IN (SELECT h.payments_id FROM payments_id_history h WHERE h.user_id = p.user_id))
+        AND p.voided_at IS NULL
     ), 0) -
-    COALESCE((SELECT SUM(CAST(f.amount AS REAL)) FROM fees f WHERE f.user_id = ?), 0) as balance;
+    COALESCE((SELECT SUM(CAST(REPLACE(f.amount, '.', '') AS INTEGER)) FROM fees f WHERE f.user_id = u.id), 0)
+AS INTEGER) as balance
+FROM users u
+ORDER BY u.id;
 
 -- name: CountUsersByState :many
 SELECT state, COUNT(*) as count FROM users GROUP BY state;
@@ -251,14 +384,341 @@ SELECT p.* FROM payments p
 WHERE p.identification = (
     SELECT pr.payments_id FROM projects pr WHERE pr.id = ?
 )
+AND p.voided_at IS NULL
 ORDER BY p.date DESC;
 
 -- name: GetProjectBalance :one
--- Sum all payments that match the project's VS (identification)
+-- Sum all payments that match the project's VS (identification), in haléře
 -- This includes both explicitly assigned payments (project_id set)
 -- and payments that just have matching VS
-SELECT COALESCE(SUM(CAST(p.amount AS REAL)), 0) as total
+SELECT CAST(COALESCE(SUM(CAST(REPLACE(p.amount, '.', '') AS INTEGER)), 0) AS INTEGER) as total
 FROM payments p
 WHERE p.identification = (
     SELECT pr.payments_id FROM projects pr WHERE pr.id = ?
-);
+)
+AND p.voided_at IS NULL;
+
+-- ============================================================================
+-- JOB RUNS (Scheduler history)
+-- ============================================================================
+
+-- name: CreateJobRun :one
+-- Fails on idx_job_runs_running if the job is already running
+INSERT INTO job_runs (job_name, source, triggered_by)
+VALUES (?, ?, ?)
+RETURNING *;
+
+-- name: FinishJobRun :one
+UPDATE job_runs SET
+    status = ?,
+    finished_at = CURRENT_TIMESTAMP,
+    duration_ms = ?,
+    summary = ?,
+    error = ?,
+    output = ?
+WHERE id = ?
+RETURNING *;
+
+-- name: ListJobRuns :many
+SELECT * FROM job_runs
+WHERE (? = '' OR job_name = ?)
+ORDER BY id DESC LIMIT ?;
+
+-- name: ListLastJobRuns :many
+-- Most recent run of every job
+SELECT * FROM job_runs
+WHERE id IN (SELECT MAX(id) FROM job_runs GROUP BY job_name)
+ORDER BY job_name;
+
+-- name: InterruptStaleJobRuns :execrows
+-- Runs left in 'running' state by a crashed or restarted server, and CLI runs
+-- that have been running for too long
+UPDATE job_runs SET
+    status = 'interrupted',
+    finished_at = CURRENT_TIMESTAMP
+WHERE status = 'running'
+AND (source != 'cli' OR started_at < datetime('now', '-6 hours'));
+
+-- ============================================================================
+-- SYNC CURSORS (Incremental imports)
+-- ============================================================================
+
+-- name: GetSyncCursor :one
+SELECT * FROM sync_cursors WHERE name = ? LIMIT 1;
+
+-- name: SetSyncCursor :one
+INSERT INTO sync_cursors (name, last_id)
+VALUES (?, ?)
+ON CONFLICT(name) DO UPDATE SET
+    last_id = excluded.last_id,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- ============================================================================
+-- APPLICATIONS (Membership applications)
+-- ============================================================================
+
+-- name: CreateApplication :one
+-- Fails on idx_applications_pending if the user already has a pending application
+INSERT INTO applications (
+    user_id, realname, phone, alt_contact,
+    level_id, level_actual_amount, motivation
+) VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetApplication :one
+SELECT * FROM applications WHERE id = ? LIMIT 1;
+
+-- name: GetLatestApplicationByUser :one
+SELECT * FROM applications WHERE user_id = ? ORDER BY id DESC LIMIT 1;
+
+-- name: ListApplicationsByStatus :many
+SELECT * FROM applications WHERE status = ? ORDER BY created_at, id;
+
+-- name: ListRecentDecidedApplications :many
+SELECT * FROM applications WHERE status != 'pending' ORDER BY decided_at DESC, id DESC LIMIT ?;
+
+-- name: DecideApplication :one
+-- Only a pending application can be decided; no row means it was decided already
+UPDATE applications SET
+    status = ?,
+    decided_by = ?,
+    decided_at = CURRENT_TIMESTAMP,
+    decision_comment = ?
+WHERE id = ? AND status = 'pending'
+RETURNING *;
+
+-- ============================================================================
+-- PAYMENTS ID HISTORY (Previous variable symbols of members)
+-- ============================================================================
+
+-- name: CreatePaymentsIDHistory :one
+INSERT INTO payments_id_history (user_id, payments_id, replaced_by, changed_by, reason)
+VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: ListPaymentsIDHistoryByUser :many
+SELECT * FROM payments_id_history WHERE user_id = ? ORDER BY changed_at DESC, id DESC;
+
+-- name: GetUserIDByPreviousPaymentsID :one
+-- Member who used the VS before; a previous VS is never given to anyone else
+SELECT user_id FROM payments_id_history WHERE payments_id = ? ORDER BY id DESC LIMIT 1;
+
+-- name: ListMemberPaymentsIDs :many
+-- Every VS a member has or had, for the VS allocator
+SELECT payments_id FROM users WHERE payments_id IS NOT NULL AND payments_id != ''
+UNION
+SELECT payments_id FROM payments_id_history;
+
+-- ============================================================================
+-- MEMBERSHIP STATE HISTORY
+-- ============================================================================
+
+-- name: CreateStateHistory :one
+INSERT INTO membership_state_history (user_id, from_state, to_state, changed_by, reason)
+VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: ListStateHistoryByUser :many
+SELECT * FROM membership_state_history WHERE user_id = ? ORDER BY changed_at DESC, id DESC;
+
+-- name: GetLatestStateChangeTo :one
+-- When the member last entered the state
+SELECT * FROM membership_state_history
+WHERE user_id = ? AND to_state = ?
+ORDER BY changed_at DESC, id DESC
+LIMIT 1;
+
+-- ============================================================================
+-- MEMBERSHIP LEVEL HISTORY
+-- ============================================================================
+
+-- name: CreateLevelHistory :one
+INSERT INTO membership_level_history (user_id, level_id, level_actual_amount, effective_from, changed_by, reason)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: ListLevelHistoryByUser :many
+SELECT * FROM membership_level_history WHERE user_id = ? ORDER BY effective_from DESC, id DESC;
+
+-- name: DeleteLevelHistory :exec
+-- Withdraws a pending level change
+DELETE FROM membership_level_history WHERE id = ?;
+
+-- name: ListLevelHistoryByLevel :many
+SELECT * FROM membership_level_history WHERE level_id = ? ORDER BY effective_from, id;
+
+-- ============================================================================
+-- LEVEL PRICE CHANGES
+-- ============================================================================
+
+-- name: CreateLevelPriceChange :one
+INSERT INTO level_price_changes (level_id, old_amount, new_amount, effective_from, members_affected, created_by)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: ListLevelPriceChanges :many
+SELECT * FROM level_price_changes ORDER BY effective_from, id;
+
+-- name: UpdateLevelPriceChangeNotified :exec
+UPDATE level_price_changes SET members_notified = ? WHERE id = ?;
+
+-- name: MarkLevelPriceChangeApplied :exec
+UPDATE level_price_changes SET applied_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- ============================================================================
+-- DEBT EXEMPTIONS
+-- ============================================================================
+
+-- name: CreateDebtExemption :one
+INSERT INTO debt_exemptions (user_id, reason, valid_until, created_by)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetDebtExemption :one
+SELECT * FROM debt_exemptions WHERE id = ?;
+
+-- name: ListDebtExemptions :many
+SELECT * FROM debt_exemptions ORDER BY created_at, id;
+
+-- name: DeleteDebtExemption :exec
+DELETE FROM debt_exemptions WHERE id = ?;
+
+-- ============================================================================
+-- DUNNING NOTICES (Reminders to members in debt)
+-- ============================================================================
+
+-- name: CreateDunningNotice :one
+INSERT INTO dunning_notices (user_id, stage, balance, sent_at)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: ListOpenDunningNotices :many
+-- Notices of the open cases, oldest first
+SELECT * FROM dunning_notices WHERE resolved_at IS NULL ORDER BY user_id, sent_at, id;
+
+-- name: ListRecentDunningNotices :many
+SELECT * FROM dunning_notices ORDER BY sent_at DESC, id DESC LIMIT ?;
+
+-- name: ResolveDunningNotices :exec
+-- Closes the open case of a member
+UPDATE dunning_notices SET resolved_at = ? WHERE user_id = ? AND resolved_at IS NULL;
+
+-- ============================================================================
+-- EMAIL OUTBOX (Queued outgoing emails)
+-- ============================================================================
+
+-- name: EnqueueEmail :one
+INSERT INTO email_outbox (
+    user_id, recipient, subject, template, body, text_body,
+    reply_to, list_unsubscribe, message_id, attachments,
+    max_attempts, next_attempt_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetEmail :one
+SELECT * FROM email_outbox WHERE id = ?;
+
+-- name: ListDueEmails :many
+-- Queued emails whose next attempt is due. Times are written in UTC by the
+-- email client, so they compare as text.
+SELECT * FROM email_outbox
+WHERE status = 'queued' AND next_attempt_at <= ?
+ORDER BY next_attempt_at, id
+LIMIT ?;
+
+-- name: ListEmails :many
+-- Outbox (admin), newest first. A NULL status lists all.
+SELECT * FROM email_outbox
+WHERE (sqlc.narg('status') IS NULL OR status = sqlc.narg('status'))
+ORDER BY id DESC
+LIMIT ?;
+
+-- name: CountEmailsByStatus :many
+SELECT status, COUNT(*) as count FROM email_outbox GROUP BY status;
+
+-- name: ClaimEmail :execrows
+-- Takes a queued email for delivery, zero rows when another worker took it
+UPDATE email_outbox SET status = 'sending', attempts = attempts + 1
+WHERE id = ? AND status = 'queued';
+
+-- name: MarkEmailSent :exec
+UPDATE email_outbox SET status = 'sent', sent_at = ?, last_error = NULL WHERE id = ?;
+
+-- name: MarkEmailFailed :exec
+-- Records a failed attempt: queued again for next_attempt_at, or failed
+-- (dead letter) after the last attempt
+UPDATE email_outbox SET status = ?, next_attempt_at = ?, last_error = ? WHERE id = ?;
+
+-- name: RequeueStaleEmails :execrows
+-- Emails left in 'sending' by a crashed or restarted worker
+UPDATE email_outbox SET status = 'queued' WHERE status = 'sending';
+
+-- name: ResendEmail :exec
+-- Queues the email again with a fresh set of attempts
+UPDATE email_outbox SET
+    status = 'queued',
+    attempts = 0,
+    next_attempt_at = ?,
+    sent_at = NULL
+WHERE id = ?;
+
+-- name: CancelEmail :execrows
+-- Cancels a queued email, zero rows when it is no longer queued
+UPDATE email_outbox SET status = 'cancelled' WHERE id = ? AND status = 'queued';
+
+-- ============================================================================
+-- EMAIL TEMPLATE VERSIONS (Overrides of the email template files)
+-- ============================================================================
+
+-- name: CreateEmailTemplateVersion :one
+-- Saves a new version of the template, numbered after its latest version
+INSERT INTO email_template_versions (template, version, subject, html_body, text_body, note, created_by)
+VALUES (
+    sqlc.arg('template'),
+    (SELECT COALESCE(MAX(version), 0) + 1 FROM email_template_versions WHERE template = sqlc.arg('template')),
+    sqlc.arg('subject'),
+    sqlc.arg('html_body'),
+    sqlc.arg('text_body'),
+    sqlc.arg('note'),
+    sqlc.arg('created_by')
+)
+RETURNING *;
+
+-- name: GetCurrentEmailTemplate :one
+-- The version of the template in use (the latest one)
+SELECT * FROM email_template_versions
+WHERE template = ?
+ORDER BY version DESC
+LIMIT 1;
+
+-- name: GetEmailTemplateVersion :one
+SELECT * FROM email_template_versions WHERE template = ? AND version = ?;
+
+-- name: ListEmailTemplateVersions :many
+SELECT * FROM email_template_versions
+WHERE template = ?
+ORDER BY version DESC;
+
+-- name: ListCurrentEmailTemplates :many
+-- The latest version of every edited template
+SELECT * FROM email_template_versions v
+WHERE version = (SELECT MAX(version) FROM email_template_versions WHERE template = v.template)
+ORDER BY template;
+
+-- ============================================================================
+-- ANNOUNCEMENTS (Bulk emails to member segments)
+-- ============================================================================
+
+-- name: CreateAnnouncement :one
+INSERT INTO announcements (subject, body, segment, recipients, created_by)
+VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: UpdateAnnouncementResult :exec
+UPDATE announcements SET queued = ?, failed = ? WHERE id = ?;
+
+-- name: ListAnnouncements :many
+SELECT * FROM announcements
+ORDER BY created_at DESC, id DESC
+LIMIT ?;
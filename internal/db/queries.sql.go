@@ -9,6 +9,8 @@ import (
 	"context"
 	"database/sql"
 	"time"
+
+	"github.com/base48/member-portal/internal/money"
 )
 
 const assignPayment = `-- name: AssignPayment :one
@@ -16,7 +18,7 @@ UPDATE payments SET
     user_id = ?,
     staff_comment = ?
 WHERE id = ?
-RETURNING id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id
+RETURNING id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at
 `
 
 type AssignPaymentParams struct {
@@ -42,10 +44,106 @@ func (q *Queries) AssignPayment(ctx context.Context, arg AssignPaymentParams) (P
 		&i.StaffComment,
 		&i.CreatedAt,
 		&i.ProjectID,
+		&i.RecordedBy,
+		&i.VoidedAt,
 	)
 	return i, err
 }
 
+const cancelEmail = `-- name: CancelEmail :execrows
+UPDATE email_outbox SET status = 'cancelled' WHERE id = ? AND status = 'queued'
+`
+
+// Cancels a queued email, zero rows when it is no longer queued
+func (q *Queries) CancelEmail(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelEmail, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const claimEmail = `-- name: ClaimEmail :execrows
+UPDATE email_outbox SET status = 'sending', attempts = attempts + 1
+WHERE id = ? AND status = 'queued'
+`
+
+// Takes a queued email for delivery, zero rows when another worker took it
+func (q *Queries) ClaimEmail(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, claimEmail, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const countEmailsByStatus = `-- name: CountEmailsByStatus :many
+SELECT status, COUNT(*) as count FROM email_outbox GROUP BY status
+`
+
+type CountEmailsByStatusRow struct {
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+}
+
+func (q *Queries) CountEmailsByStatus(ctx context.Context) ([]CountEmailsByStatusRow, error) {
+	rows, err := q.db.QueryContext(ctx, countEmailsByStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountEmailsByStatusRow{}
+	for rows.Next() {
+		var i CountEmailsByStatusRow
+		if err := rows.Scan(&i.Status, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countMembersByLevel = `-- name: CountMembersByLevel :many
+SELECT level_id, COUNT(*) AS members FROM users
+WHERE state IN ('accepted', 'suspended')
+GROUP BY level_id
+`
+
+type CountMembersByLevelRow struct {
+	LevelID int64 `json:"level_id"`
+	Members int64 `json:"members"`
+}
+
+// Members (accepted or suspended) on each level
+func (q *Queries) CountMembersByLevel(ctx context.Context) ([]CountMembersByLevelRow, error) {
+	rows, err := q.db.QueryContext(ctx, countMembersByLevel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountMembersByLevelRow{}
+	for rows.Next() {
+		var i CountMembersByLevelRow
+		if err := rows.Scan(&i.LevelID, &i.Members); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const countUsersByState = `-- name: CountUsersByState :many
 SELECT state, COUNT(*) as count FROM users GROUP BY state
 `
@@ -78,6 +176,203 @@ func (q *Queries) CountUsersByState(ctx context.Context) ([]CountUsersByStateRow
 	return items, nil
 }
 
+const createAnnouncement = `-- name: CreateAnnouncement :one
+INSERT INTO announcements (subject, body, segment, recipients, created_by)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id, subject, body, segment, recipients, queued, failed, created_by, created_at
+`
+
+type CreateAnnouncementParams struct {
+	Subject    string        `json:"subject"`
+	Body       string        `json:"body"`
+	Segment    string        `json:"segment"`
+	Recipients int64         `json:"recipients"`
+	CreatedBy  sql.NullInt64 `json:"created_by"`
+}
+
+func (q *Queries) CreateAnnouncement(ctx context.Context, arg CreateAnnouncementParams) (Announcement, error) {
+	row := q.db.QueryRowContext(ctx, createAnnouncement,
+		arg.Subject,
+		arg.Body,
+		arg.Segment,
+		arg.Recipients,
+		arg.CreatedBy,
+	)
+	var i Announcement
+	err := row.Scan(
+		&i.ID,
+		&i.Subject,
+		&i.Body,
+		&i.Segment,
+		&i.Recipients,
+		&i.Queued,
+		&i.Failed,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createApplication = `-- name: CreateApplication :one
+INSERT INTO applications (
+    user_id, realname, phone, alt_contact,
+    level_id, level_actual_amount, motivation
+) VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING id, user_id, realname, phone, alt_contact, level_id, level_actual_amount, motivation, status, decided_by, decided_at, decision_comment, created_at
+`
+
+type CreateApplicationParams struct {
+	UserID            int64          `json:"user_id"`
+	Realname          string         `json:"realname"`
+	Phone             sql.NullString `json:"phone"`
+	AltContact        sql.NullString `json:"alt_contact"`
+	LevelID           int64          `json:"level_id"`
+	LevelActualAmount money.Amount   `json:"level_actual_amount"`
+	Motivation        sql.NullString `json:"motivation"`
+}
+
+// Fails on idx_applications_pending if the user already has a pending application
+func (q *Queries) CreateApplication(ctx context.Context, arg CreateApplicationParams) (Application, error) {
+	row := q.db.QueryRowContext(ctx, createApplication,
+		arg.UserID,
+		arg.Realname,
+		arg.Phone,
+		arg.AltContact,
+		arg.LevelID,
+		arg.LevelActualAmount,
+		arg.Motivation,
+	)
+	var i Application
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Realname,
+		&i.Phone,
+		&i.AltContact,
+		&i.LevelID,
+		&i.LevelActualAmount,
+		&i.Motivation,
+		&i.Status,
+		&i.DecidedBy,
+		&i.DecidedAt,
+		&i.DecisionComment,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createDebtExemption = `-- name: CreateDebtExemption :one
+INSERT INTO debt_exemptions (user_id, reason, valid_until, created_by)
+VALUES (?, ?, ?, ?)
+RETURNING id, user_id, reason, valid_until, created_by, created_at
+`
+
+type CreateDebtExemptionParams struct {
+	UserID     int64         `json:"user_id"`
+	Reason     string        `json:"reason"`
+	ValidUntil sql.NullTime  `json:"valid_until"`
+	CreatedBy  sql.NullInt64 `json:"created_by"`
+}
+
+func (q *Queries) CreateDebtExemption(ctx context.Context, arg CreateDebtExemptionParams) (DebtExemption, error) {
+	row := q.db.QueryRowContext(ctx, createDebtExemption,
+		arg.UserID,
+		arg.Reason,
+		arg.ValidUntil,
+		arg.CreatedBy,
+	)
+	var i DebtExemption
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Reason,
+		&i.ValidUntil,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createDunningNotice = `-- name: CreateDunningNotice :one
+INSERT INTO dunning_notices (user_id, stage, balance, sent_at)
+VALUES (?, ?, ?, ?)
+RETURNING id, user_id, stage, balance, sent_at, resolved_at
+`
+
+type CreateDunningNoticeParams struct {
+	UserID  int64        `json:"user_id"`
+	Stage   string       `json:"stage"`
+	Balance money.Amount `json:"balance"`
+	SentAt  time.Time    `json:"sent_at"`
+}
+
+func (q *Queries) CreateDunningNotice(ctx context.Context, arg CreateDunningNoticeParams) (DunningNotice, error) {
+	row := q.db.QueryRowContext(ctx, createDunningNotice,
+		arg.UserID,
+		arg.Stage,
+		arg.Balance,
+		arg.SentAt,
+	)
+	var i DunningNotice
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Stage,
+		&i.Balance,
+		&i.SentAt,
+		&i.ResolvedAt,
+	)
+	return i, err
+}
+
+const createEmailTemplateVersion = `-- name: CreateEmailTemplateVersion :one
+INSERT INTO email_template_versions (template, version, subject, html_body, text_body, note, created_by)
+VALUES (
+    ?1,
+    (SELECT COALESCE(MAX(version), 0) + 1 FROM email_template_versions WHERE template = ?1),
+    ?2,
+    ?3,
+    ?4,
+    ?5,
+    ?6
+)
+RETURNING id, template, version, subject, html_body, text_body, note, created_by, created_at
+`
+
+type CreateEmailTemplateVersionParams struct {
+	Template  string         `json:"template"`
+	Subject   string         `json:"subject"`
+	HtmlBody  string         `json:"html_body"`
+	TextBody  string         `json:"text_body"`
+	Note      sql.NullString `json:"note"`
+	CreatedBy sql.NullInt64  `json:"created_by"`
+}
+
+// Saves a new version of the template, numbered after its latest version
+func (q *Queries) CreateEmailTemplateVersion(ctx context.Context, arg CreateEmailTemplateVersionParams) (EmailTemplateVersion, error) {
+	row := q.db.QueryRowContext(ctx, createEmailTemplateVersion,
+		arg.Template,
+		arg.Subject,
+		arg.HtmlBody,
+		arg.TextBody,
+		arg.Note,
+		arg.CreatedBy,
+	)
+	var i EmailTemplateVersion
+	err := row.Scan(
+		&i.ID,
+		&i.Template,
+		&i.Version,
+		&i.Subject,
+		&i.HtmlBody,
+		&i.TextBody,
+		&i.Note,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const createFee = `-- name: CreateFee :one
 INSERT INTO fees (user_id, level_id, period_start, amount)
 VALUES (?, ?, ?, ?)
@@ -85,10 +380,10 @@ RETURNING id, user_id, level_id, period_start, amount, created_at
 `
 
 type CreateFeeParams struct {
-	UserID      int64     `json:"user_id"`
-	LevelID     int64     `json:"level_id"`
-	PeriodStart time.Time `json:"period_start"`
-	Amount      string    `json:"amount"`
+	UserID      int64        `json:"user_id"`
+	LevelID     int64        `json:"level_id"`
+	PeriodStart time.Time    `json:"period_start"`
+	Amount      money.Amount `json:"amount"`
 }
 
 func (q *Queries) CreateFee(ctx context.Context, arg CreateFeeParams) (Fee, error) {
@@ -110,6 +405,38 @@ func (q *Queries) CreateFee(ctx context.Context, arg CreateFeeParams) (Fee, erro
 	return i, err
 }
 
+const createJobRun = `-- name: CreateJobRun :one
+INSERT INTO job_runs (job_name, source, triggered_by)
+VALUES (?, ?, ?)
+RETURNING id, job_name, source, status, triggered_by, started_at, finished_at, duration_ms, summary, error, output
+`
+
+type CreateJobRunParams struct {
+	JobName     string        `json:"job_name"`
+	Source      string        `json:"source"`
+	TriggeredBy sql.NullInt64 `json:"triggered_by"`
+}
+
+// Fails on idx_job_runs_running if the job is already running
+func (q *Queries) CreateJobRun(ctx context.Context, arg CreateJobRunParams) (JobRun, error) {
+	row := q.db.QueryRowContext(ctx, createJobRun, arg.JobName, arg.Source, arg.TriggeredBy)
+	var i JobRun
+	err := row.Scan(
+		&i.ID,
+		&i.JobName,
+		&i.Source,
+		&i.Status,
+		&i.TriggeredBy,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.DurationMs,
+		&i.Summary,
+		&i.Error,
+		&i.Output,
+	)
+	return i, err
+}
+
 const createLevel = `-- name: CreateLevel :one
 INSERT INTO levels (name, amount, active)
 VALUES (?, ?, ?)
@@ -117,9 +444,9 @@ RETURNING id, name, amount, active, created_at
 `
 
 type CreateLevelParams struct {
-	Name   string `json:"name"`
-	Amount string `json:"amount"`
-	Active bool   `json:"active"`
+	Name   string       `json:"name"`
+	Amount money.Amount `json:"amount"`
+	Active bool         `json:"active"`
 }
 
 func (q *Queries) CreateLevel(ctx context.Context, arg CreateLevelParams) (Level, error) {
@@ -135,6 +462,84 @@ func (q *Queries) CreateLevel(ctx context.Context, arg CreateLevelParams) (Level
 	return i, err
 }
 
+const createLevelHistory = `-- name: CreateLevelHistory :one
+INSERT INTO membership_level_history (user_id, level_id, level_actual_amount, effective_from, changed_by, reason)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, user_id, level_id, level_actual_amount, effective_from, changed_by, reason, created_at
+`
+
+type CreateLevelHistoryParams struct {
+	UserID            int64          `json:"user_id"`
+	LevelID           int64          `json:"level_id"`
+	LevelActualAmount money.Amount   `json:"level_actual_amount"`
+	EffectiveFrom     time.Time      `json:"effective_from"`
+	ChangedBy         sql.NullInt64  `json:"changed_by"`
+	Reason            sql.NullString `json:"reason"`
+}
+
+func (q *Queries) CreateLevelHistory(ctx context.Context, arg CreateLevelHistoryParams) (MembershipLevelHistory, error) {
+	row := q.db.QueryRowContext(ctx, createLevelHistory,
+		arg.UserID,
+		arg.LevelID,
+		arg.LevelActualAmount,
+		arg.EffectiveFrom,
+		arg.ChangedBy,
+		arg.Reason,
+	)
+	var i MembershipLevelHistory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.LevelID,
+		&i.LevelActualAmount,
+		&i.EffectiveFrom,
+		&i.ChangedBy,
+		&i.Reason,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createLevelPriceChange = `-- name: CreateLevelPriceChange :one
+INSERT INTO level_price_changes (level_id, old_amount, new_amount, effective_from, members_affected, created_by)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, level_id, old_amount, new_amount, effective_from, members_affected, members_notified, created_by, created_at, applied_at
+`
+
+type CreateLevelPriceChangeParams struct {
+	LevelID         int64         `json:"level_id"`
+	OldAmount       money.Amount  `json:"old_amount"`
+	NewAmount       money.Amount  `json:"new_amount"`
+	EffectiveFrom   time.Time     `json:"effective_from"`
+	MembersAffected int64         `json:"members_affected"`
+	CreatedBy       sql.NullInt64 `json:"created_by"`
+}
+
+func (q *Queries) CreateLevelPriceChange(ctx context.Context, arg CreateLevelPriceChangeParams) (LevelPriceChange, error) {
+	row := q.db.QueryRowContext(ctx, createLevelPriceChange,
+		arg.LevelID,
+		arg.OldAmount,
+		arg.NewAmount,
+		arg.EffectiveFrom,
+		arg.MembersAffected,
+		arg.CreatedBy,
+	)
+	var i LevelPriceChange
+	err := row.Scan(
+		&i.ID,
+		&i.LevelID,
+		&i.OldAmount,
+		&i.NewAmount,
+		&i.EffectiveFrom,
+		&i.MembersAffected,
+		&i.MembersNotified,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.AppliedAt,
+	)
+	return i, err
+}
+
 const createLog = `-- name: CreateLog :one
 INSERT INTO system_logs (subsystem, level, user_id, message, metadata)
 VALUES (?, ?, ?, ?, ?)
@@ -170,18 +575,74 @@ func (q *Queries) CreateLog(ctx context.Context, arg CreateLogParams) (SystemLog
 	return i, err
 }
 
+const createManualPayment = `-- name: CreateManualPayment :one
+INSERT INTO payments (
+    user_id, project_id, date, amount, kind, kind_id,
+    local_account, remote_account, identification, staff_comment, recorded_by
+) VALUES (
+    ?, ?, ?, ?, 'manual',
+    (SELECT CAST(COALESCE(MAX(CAST(kind_id AS INTEGER)), 0) + 1 AS TEXT) FROM payments WHERE kind = 'manual'),
+    ?, '', ?, ?, ?
+)
+RETURNING id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at
+`
+
+type CreateManualPaymentParams struct {
+	UserID         sql.NullInt64  `json:"user_id"`
+	ProjectID      sql.NullInt64  `json:"project_id"`
+	Date           time.Time      `json:"date"`
+	Amount         money.Amount   `json:"amount"`
+	LocalAccount   string         `json:"local_account"`
+	Identification string         `json:"identification"`
+	StaffComment   sql.NullString `json:"staff_comment"`
+	RecordedBy     sql.NullInt64  `json:"recorded_by"`
+}
+
+// kind_id is the next number of the 'manual' sequence (used as receipt number)
+func (q *Queries) CreateManualPayment(ctx context.Context, arg CreateManualPaymentParams) (Payment, error) {
+	row := q.db.QueryRowContext(ctx, createManualPayment,
+		arg.UserID,
+		arg.ProjectID,
+		arg.Date,
+		arg.Amount,
+		arg.LocalAccount,
+		arg.Identification,
+		arg.StaffComment,
+		arg.RecordedBy,
+	)
+	var i Payment
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Date,
+		&i.Amount,
+		&i.Kind,
+		&i.KindID,
+		&i.LocalAccount,
+		&i.RemoteAccount,
+		&i.Identification,
+		&i.RawData,
+		&i.StaffComment,
+		&i.CreatedAt,
+		&i.ProjectID,
+		&i.RecordedBy,
+		&i.VoidedAt,
+	)
+	return i, err
+}
+
 const createPayment = `-- name: CreatePayment :one
 INSERT INTO payments (
     user_id, date, amount, kind, kind_id,
     local_account, remote_account, identification, raw_data, staff_comment
 ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-RETURNING id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id
+RETURNING id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at
 `
 
 type CreatePaymentParams struct {
 	UserID         sql.NullInt64  `json:"user_id"`
 	Date           time.Time      `json:"date"`
-	Amount         string         `json:"amount"`
+	Amount         money.Amount   `json:"amount"`
 	Kind           string         `json:"kind"`
 	KindID         string         `json:"kind_id"`
 	LocalAccount   string         `json:"local_account"`
@@ -219,6 +680,43 @@ func (q *Queries) CreatePayment(ctx context.Context, arg CreatePaymentParams) (P
 		&i.StaffComment,
 		&i.CreatedAt,
 		&i.ProjectID,
+		&i.RecordedBy,
+		&i.VoidedAt,
+	)
+	return i, err
+}
+
+const createPaymentsIDHistory = `-- name: CreatePaymentsIDHistory :one
+INSERT INTO payments_id_history (user_id, payments_id, replaced_by, changed_by, reason)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id, user_id, payments_id, replaced_by, changed_by, reason, changed_at
+`
+
+type CreatePaymentsIDHistoryParams struct {
+	UserID     int64          `json:"user_id"`
+	PaymentsID string         `json:"payments_id"`
+	ReplacedBy sql.NullString `json:"replaced_by"`
+	ChangedBy  sql.NullInt64  `json:"changed_by"`
+	Reason     sql.NullString `json:"reason"`
+}
+
+func (q *Queries) CreatePaymentsIDHistory(ctx context.Context, arg CreatePaymentsIDHistoryParams) (PaymentsIDHistory, error) {
+	row := q.db.QueryRowContext(ctx, createPaymentsIDHistory,
+		arg.UserID,
+		arg.PaymentsID,
+		arg.ReplacedBy,
+		arg.ChangedBy,
+		arg.Reason,
+	)
+	var i PaymentsIDHistory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.PaymentsID,
+		&i.ReplacedBy,
+		&i.ChangedBy,
+		&i.Reason,
+		&i.ChangedAt,
 	)
 	return i, err
 }
@@ -247,6 +745,41 @@ func (q *Queries) CreateProject(ctx context.Context, arg CreateProjectParams) (P
 	return i, err
 }
 
+const createStateHistory = `-- name: CreateStateHistory :one
+INSERT INTO membership_state_history (user_id, from_state, to_state, changed_by, reason)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id, user_id, from_state, to_state, changed_by, reason, changed_at
+`
+
+type CreateStateHistoryParams struct {
+	UserID    int64          `json:"user_id"`
+	FromState string         `json:"from_state"`
+	ToState   string         `json:"to_state"`
+	ChangedBy sql.NullInt64  `json:"changed_by"`
+	Reason    sql.NullString `json:"reason"`
+}
+
+func (q *Queries) CreateStateHistory(ctx context.Context, arg CreateStateHistoryParams) (MembershipStateHistory, error) {
+	row := q.db.QueryRowContext(ctx, createStateHistory,
+		arg.UserID,
+		arg.FromState,
+		arg.ToState,
+		arg.ChangedBy,
+		arg.Reason,
+	)
+	var i MembershipStateHistory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FromState,
+		&i.ToState,
+		&i.ChangedBy,
+		&i.Reason,
+		&i.ChangedAt,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
     keycloak_id, email, username, realname, phone, alt_contact,
@@ -264,7 +797,7 @@ type CreateUserParams struct {
 	Phone             sql.NullString `json:"phone"`
 	AltContact        sql.NullString `json:"alt_contact"`
 	LevelID           int64          `json:"level_id"`
-	LevelActualAmount string         `json:"level_actual_amount"`
+	LevelActualAmount money.Amount   `json:"level_actual_amount"`
 	PaymentsID        sql.NullString `json:"payments_id"`
 	State             string         `json:"state"`
 	IsCouncil         bool           `json:"is_council"`
@@ -310,15 +843,256 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 	return i, err
 }
 
-const deleteProject = `-- name: DeleteProject :exec
-DELETE FROM projects WHERE id = ?
+const decideApplication = `-- name: DecideApplication :one
+UPDATE applications SET
+    status = ?,
+    decided_by = ?,
+    decided_at = CURRENT_TIMESTAMP,
+    decision_comment = ?
+WHERE id = ? AND status = 'pending'
+RETURNING id, user_id, realname, phone, alt_contact, level_id, level_actual_amount, motivation, status, decided_by, decided_at, decision_comment, created_at
 `
 
-func (q *Queries) DeleteProject(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, deleteProject, id)
+type DecideApplicationParams struct {
+	Status          string         `json:"status"`
+	DecidedBy       sql.NullInt64  `json:"decided_by"`
+	DecisionComment sql.NullString `json:"decision_comment"`
+	ID              int64          `json:"id"`
+}
+
+// Only a pending application can be decided; no row means it was decided already
+func (q *Queries) DecideApplication(ctx context.Context, arg DecideApplicationParams) (Application, error) {
+	row := q.db.QueryRowContext(ctx, decideApplication,
+		arg.Status,
+		arg.DecidedBy,
+		arg.DecisionComment,
+		arg.ID,
+	)
+	var i Application
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Realname,
+		&i.Phone,
+		&i.AltContact,
+		&i.LevelID,
+		&i.LevelActualAmount,
+		&i.Motivation,
+		&i.Status,
+		&i.DecidedBy,
+		&i.DecidedAt,
+		&i.DecisionComment,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteDebtExemption = `-- name: DeleteDebtExemption :exec
+DELETE FROM debt_exemptions WHERE id = ?
+`
+
+func (q *Queries) DeleteDebtExemption(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteDebtExemption, id)
+	return err
+}
+
+const deleteLevelHistory = `-- name: DeleteLevelHistory :exec
+DELETE FROM membership_level_history WHERE id = ?
+`
+
+// Withdraws a pending level change
+func (q *Queries) DeleteLevelHistory(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteLevelHistory, id)
+	return err
+}
+
+const deleteProject = `-- name: DeleteProject :exec
+DELETE FROM projects WHERE id = ?
+`
+
+func (q *Queries) DeleteProject(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteProject, id)
 	return err
 }
 
+const enqueueEmail = `-- name: EnqueueEmail :one
+INSERT INTO email_outbox (
+    user_id, recipient, subject, template, body, text_body,
+    reply_to, list_unsubscribe, message_id, attachments,
+    max_attempts, next_attempt_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, user_id, recipient, subject, template, body, status, attempts, max_attempts, next_attempt_at, last_error, created_at, sent_at, text_body, reply_to, list_unsubscribe, message_id, attachments
+`
+
+type EnqueueEmailParams struct {
+	UserID          sql.NullInt64  `json:"user_id"`
+	Recipient       string         `json:"recipient"`
+	Subject         string         `json:"subject"`
+	Template        string         `json:"template"`
+	Body            string         `json:"body"`
+	TextBody        string         `json:"text_body"`
+	ReplyTo         sql.NullString `json:"reply_to"`
+	ListUnsubscribe sql.NullString `json:"list_unsubscribe"`
+	MessageID       string         `json:"message_id"`
+	Attachments     sql.NullString `json:"attachments"`
+	MaxAttempts     int64          `json:"max_attempts"`
+	NextAttemptAt   time.Time      `json:"next_attempt_at"`
+}
+
+func (q *Queries) EnqueueEmail(ctx context.Context, arg EnqueueEmailParams) (EmailOutbox, error) {
+	row := q.db.QueryRowContext(ctx, enqueueEmail,
+		arg.UserID,
+		arg.Recipient,
+		arg.Subject,
+		arg.Template,
+		arg.Body,
+		arg.TextBody,
+		arg.ReplyTo,
+		arg.ListUnsubscribe,
+		arg.MessageID,
+		arg.Attachments,
+		arg.MaxAttempts,
+		arg.NextAttemptAt,
+	)
+	var i EmailOutbox
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Recipient,
+		&i.Subject,
+		&i.Template,
+		&i.Body,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.NextAttemptAt,
+		&i.LastError,
+		&i.CreatedAt,
+		&i.SentAt,
+		&i.TextBody,
+		&i.ReplyTo,
+		&i.ListUnsubscribe,
+		&i.MessageID,
+		&i.Attachments,
+	)
+	return i, err
+}
+
+const finishJobRun = `-- name: FinishJobRun :one
+UPDATE job_runs SET
+    status = ?,
+    finished_at = CURRENT_TIMESTAMP,
+    duration_ms = ?,
+    summary = ?,
+    error = ?,
+    output = ?
+WHERE id = ?
+RETURNING id, job_name, source, status, triggered_by, started_at, finished_at, duration_ms, summary, error, output
+`
+
+type FinishJobRunParams struct {
+	Status     string         `json:"status"`
+	DurationMs sql.NullInt64  `json:"duration_ms"`
+	Summary    sql.NullString `json:"summary"`
+	Error      sql.NullString `json:"error"`
+	Output     sql.NullString `json:"output"`
+	ID         int64          `json:"id"`
+}
+
+func (q *Queries) FinishJobRun(ctx context.Context, arg FinishJobRunParams) (JobRun, error) {
+	row := q.db.QueryRowContext(ctx, finishJobRun,
+		arg.Status,
+		arg.DurationMs,
+		arg.Summary,
+		arg.Error,
+		arg.Output,
+		arg.ID,
+	)
+	var i JobRun
+	err := row.Scan(
+		&i.ID,
+		&i.JobName,
+		&i.Source,
+		&i.Status,
+		&i.TriggeredBy,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.DurationMs,
+		&i.Summary,
+		&i.Error,
+		&i.Output,
+	)
+	return i, err
+}
+
+const getApplication = `-- name: GetApplication :one
+SELECT id, user_id, realname, phone, alt_contact, level_id, level_actual_amount, motivation, status, decided_by, decided_at, decision_comment, created_at FROM applications WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetApplication(ctx context.Context, id int64) (Application, error) {
+	row := q.db.QueryRowContext(ctx, getApplication, id)
+	var i Application
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Realname,
+		&i.Phone,
+		&i.AltContact,
+		&i.LevelID,
+		&i.LevelActualAmount,
+		&i.Motivation,
+		&i.Status,
+		&i.DecidedBy,
+		&i.DecidedAt,
+		&i.DecisionComment,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getCurrentEmailTemplate = `-- name: GetCurrentEmailTemplate :one
+SELECT id, template, version, subject, html_body, text_body, note, created_by, created_at FROM email_template_versions
+WHERE template = ?
+ORDER BY version DESC
+LIMIT 1
+`
+
+// The version of the template in use (the latest one)
+func (q *Queries) GetCurrentEmailTemplate(ctx context.Context, template string) (EmailTemplateVersion, error) {
+	row := q.db.QueryRowContext(ctx, getCurrentEmailTemplate, template)
+	var i EmailTemplateVersion
+	err := row.Scan(
+		&i.ID,
+		&i.Template,
+		&i.Version,
+		&i.Subject,
+		&i.HtmlBody,
+		&i.TextBody,
+		&i.Note,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getDebtExemption = `-- name: GetDebtExemption :one
+SELECT id, user_id, reason, valid_until, created_by, created_at FROM debt_exemptions WHERE id = ?
+`
+
+func (q *Queries) GetDebtExemption(ctx context.Context, id int64) (DebtExemption, error) {
+	row := q.db.QueryRowContext(ctx, getDebtExemption, id)
+	var i DebtExemption
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Reason,
+		&i.ValidUntil,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const getDistinctLevels = `-- name: GetDistinctLevels :many
 SELECT DISTINCT level FROM system_logs ORDER BY level
 `
@@ -373,6 +1147,62 @@ func (q *Queries) GetDistinctSubsystems(ctx context.Context) ([]string, error) {
 	return items, nil
 }
 
+const getEmail = `-- name: GetEmail :one
+SELECT id, user_id, recipient, subject, template, body, status, attempts, max_attempts, next_attempt_at, last_error, created_at, sent_at, text_body, reply_to, list_unsubscribe, message_id, attachments FROM email_outbox WHERE id = ?
+`
+
+func (q *Queries) GetEmail(ctx context.Context, id int64) (EmailOutbox, error) {
+	row := q.db.QueryRowContext(ctx, getEmail, id)
+	var i EmailOutbox
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Recipient,
+		&i.Subject,
+		&i.Template,
+		&i.Body,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.NextAttemptAt,
+		&i.LastError,
+		&i.CreatedAt,
+		&i.SentAt,
+		&i.TextBody,
+		&i.ReplyTo,
+		&i.ListUnsubscribe,
+		&i.MessageID,
+		&i.Attachments,
+	)
+	return i, err
+}
+
+const getEmailTemplateVersion = `-- name: GetEmailTemplateVersion :one
+SELECT id, template, version, subject, html_body, text_body, note, created_by, created_at FROM email_template_versions WHERE template = ? AND version = ?
+`
+
+type GetEmailTemplateVersionParams struct {
+	Template string `json:"template"`
+	Version  int64  `json:"version"`
+}
+
+func (q *Queries) GetEmailTemplateVersion(ctx context.Context, arg GetEmailTemplateVersionParams) (EmailTemplateVersion, error) {
+	row := q.db.QueryRowContext(ctx, getEmailTemplateVersion, arg.Template, arg.Version)
+	var i EmailTemplateVersion
+	err := row.Scan(
+		&i.ID,
+		&i.Template,
+		&i.Version,
+		&i.Subject,
+		&i.HtmlBody,
+		&i.TextBody,
+		&i.Note,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const getFee = `-- name: GetFee :one
 SELECT id, user_id, level_id, period_start, amount, created_at FROM fees WHERE id = ? LIMIT 1
 `
@@ -414,6 +1244,59 @@ func (q *Queries) GetFeeByUserAndPeriod(ctx context.Context, arg GetFeeByUserAnd
 	return i, err
 }
 
+const getLatestApplicationByUser = `-- name: GetLatestApplicationByUser :one
+SELECT id, user_id, realname, phone, alt_contact, level_id, level_actual_amount, motivation, status, decided_by, decided_at, decision_comment, created_at FROM applications WHERE user_id = ? ORDER BY id DESC LIMIT 1
+`
+
+func (q *Queries) GetLatestApplicationByUser(ctx context.Context, userID int64) (Application, error) {
+	row := q.db.QueryRowContext(ctx, getLatestApplicationByUser, userID)
+	var i Application
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Realname,
+		&i.Phone,
+		&i.AltContact,
+		&i.LevelID,
+		&i.LevelActualAmount,
+		&i.Motivation,
+		&i.Status,
+		&i.DecidedBy,
+		&i.DecidedAt,
+		&i.DecisionComment,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getLatestStateChangeTo = `-- name: GetLatestStateChangeTo :one
+SELECT id, user_id, from_state, to_state, changed_by, reason, changed_at FROM membership_state_history
+WHERE user_id = ? AND to_state = ?
+ORDER BY changed_at DESC, id DESC
+LIMIT 1
+`
+
+type GetLatestStateChangeToParams struct {
+	UserID  int64  `json:"user_id"`
+	ToState string `json:"to_state"`
+}
+
+// When the member last entered the state
+func (q *Queries) GetLatestStateChangeTo(ctx context.Context, arg GetLatestStateChangeToParams) (MembershipStateHistory, error) {
+	row := q.db.QueryRowContext(ctx, getLatestStateChangeTo, arg.UserID, arg.ToState)
+	var i MembershipStateHistory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FromState,
+		&i.ToState,
+		&i.ChangedBy,
+		&i.Reason,
+		&i.ChangedAt,
+	)
+	return i, err
+}
+
 const getLevel = `-- name: GetLevel :one
 SELECT id, name, amount, active, created_at FROM levels WHERE id = ? LIMIT 1
 `
@@ -432,7 +1315,7 @@ func (q *Queries) GetLevel(ctx context.Context, id int64) (Level, error) {
 }
 
 const getPayment = `-- name: GetPayment :one
-SELECT id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id FROM payments WHERE id = ? LIMIT 1
+SELECT id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at FROM payments WHERE id = ? LIMIT 1
 `
 
 func (q *Queries) GetPayment(ctx context.Context, id int64) (Payment, error) {
@@ -452,12 +1335,14 @@ func (q *Queries) GetPayment(ctx context.Context, id int64) (Payment, error) {
 		&i.StaffComment,
 		&i.CreatedAt,
 		&i.ProjectID,
+		&i.RecordedBy,
+		&i.VoidedAt,
 	)
 	return i, err
 }
 
 const getPaymentByKindAndID = `-- name: GetPaymentByKindAndID :one
-SELECT id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id FROM payments WHERE kind = ? AND kind_id = ? LIMIT 1
+SELECT id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at FROM payments WHERE kind = ? AND kind_id = ? LIMIT 1
 `
 
 type GetPaymentByKindAndIDParams struct {
@@ -482,6 +1367,8 @@ func (q *Queries) GetPaymentByKindAndID(ctx context.Context, arg GetPaymentByKin
 		&i.StaffComment,
 		&i.CreatedAt,
 		&i.ProjectID,
+		&i.RecordedBy,
+		&i.VoidedAt,
 	)
 	return i, err
 }
@@ -503,19 +1390,20 @@ func (q *Queries) GetProject(ctx context.Context, id int64) (Project, error) {
 }
 
 const getProjectBalance = `-- name: GetProjectBalance :one
-SELECT COALESCE(SUM(CAST(p.amount AS REAL)), 0) as total
+SELECT CAST(COALESCE(SUM(CAST(REPLACE(p.amount, '.', '') AS INTEGER)), 0) AS INTEGER) as total
 FROM payments p
 WHERE p.identification = (
     SELECT pr.payments_id FROM projects pr WHERE pr.id = ?
 )
+AND p.voided_at IS NULL
 `
 
-// Sum all payments that match the project's VS (identification)
+// Sum all payments that match the project's VS (identification), in haléře
 // This includes both explicitly assigned payments (project_id set)
 // and payments that just have matching VS
-func (q *Queries) GetProjectBalance(ctx context.Context, id int64) (interface{}, error) {
+func (q *Queries) GetProjectBalance(ctx context.Context, id int64) (int64, error) {
 	row := q.db.QueryRowContext(ctx, getProjectBalance, id)
-	var total interface{}
+	var total int64
 	err := row.Scan(&total)
 	return total, err
 }
@@ -537,10 +1425,11 @@ func (q *Queries) GetProjectByPaymentsID(ctx context.Context, paymentsID sql.Nul
 }
 
 const getProjectPayments = `-- name: GetProjectPayments :many
-SELECT p.id, p.user_id, p.date, p.amount, p.kind, p.kind_id, p.local_account, p.remote_account, p.identification, p.raw_data, p.staff_comment, p.created_at, p.project_id FROM payments p
+SELECT p.id, p.user_id, p.date, p.amount, p.kind, p.kind_id, p.local_account, p.remote_account, p.identification, p.raw_data, p.staff_comment, p.created_at, p.project_id, p.recorded_by, p.voided_at FROM payments p
 WHERE p.identification = (
     SELECT pr.payments_id FROM projects pr WHERE pr.id = ?
 )
+AND p.voided_at IS NULL
 ORDER BY p.date DESC
 `
 
@@ -568,6 +1457,8 @@ func (q *Queries) GetProjectPayments(ctx context.Context, id int64) ([]Payment,
 			&i.StaffComment,
 			&i.CreatedAt,
 			&i.ProjectID,
+			&i.RecordedBy,
+			&i.VoidedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -582,16 +1473,30 @@ func (q *Queries) GetProjectPayments(ctx context.Context, id int64) ([]Payment,
 	return items, nil
 }
 
+const getSyncCursor = `-- name: GetSyncCursor :one
+SELECT name, last_id, updated_at FROM sync_cursors WHERE name = ? LIMIT 1
+`
+
+func (q *Queries) GetSyncCursor(ctx context.Context, name string) (SyncCursor, error) {
+	row := q.db.QueryRowContext(ctx, getSyncCursor, name)
+	var i SyncCursor
+	err := row.Scan(&i.Name, &i.LastID, &i.UpdatedAt)
+	return i, err
+}
+
 const getUserBalance = `-- name: GetUserBalance :one
-SELECT
+SELECT CAST(
     COALESCE((
-        SELECT SUM(CAST(p.amount AS REAL))
+        SELECT SUM(CAST(REPLACE(p.amount, '.', '') AS INTEGER))
         FROM payments p
         JOIN users u ON p.user_id = u.id
         WHERE p.user_id = ?
-        AND p.identification = u.payments_id
+        AND (p.identification = u.payments_id OR p.kind = 'manual'
+             OR p.identification IN (SELECT h.payments_id FROM payments_id_history h WHERE h.user_id = p.user_id))
+        AND p.voided_at IS NULL
     ), 0) -
-    COALESCE((SELECT SUM(CAST(f.amount AS REAL)) FROM fees f WHERE f.user_id = ?), 0) as balance
+    COALESCE((SELECT SUM(CAST(REPLACE(f.amount, '.', '') AS INTEGER)) FROM fees f WHERE f.user_id = ?), 0)
+AS INTEGER) as balance
 `
 
 type GetUserBalanceParams struct {
@@ -599,7 +1504,10 @@ type GetUserBalanceParams struct {
 	UserID_2 int64         `json:"user_id_2"`
 }
 
-// Calculate membership fee balance (only payments matching user's payments_id VS)
+// Calculate membership fee balance in haléře (only payments matching user's payments_id VS,
+// current or previous, and manual payments, which are entered for the user directly)
+// Amounts are stored with two decimals ("1000.50"), so without the decimal point they are
+// haléře and the sum is exact integer arithmetic (use money.FromHalere on the result)
 func (q *Queries) GetUserBalance(ctx context.Context, arg GetUserBalanceParams) (int64, error) {
 	row := q.db.QueryRowContext(ctx, getUserBalance, arg.UserID, arg.UserID_2)
 	var balance int64
@@ -727,6 +1635,36 @@ func (q *Queries) GetUserByPaymentsID(ctx context.Context, paymentsID sql.NullSt
 	return i, err
 }
 
+const getUserIDByPreviousPaymentsID = `-- name: GetUserIDByPreviousPaymentsID :one
+SELECT user_id FROM payments_id_history WHERE payments_id = ? ORDER BY id DESC LIMIT 1
+`
+
+// Member who used the VS before; a previous VS is never given to anyone else
+func (q *Queries) GetUserIDByPreviousPaymentsID(ctx context.Context, paymentsID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getUserIDByPreviousPaymentsID, paymentsID)
+	var user_id int64
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const interruptStaleJobRuns = `-- name: InterruptStaleJobRuns :execrows
+UPDATE job_runs SET
+    status = 'interrupted',
+    finished_at = CURRENT_TIMESTAMP
+WHERE status = 'running'
+AND (source != 'cli' OR started_at < datetime('now', '-6 hours'))
+`
+
+// Runs left in 'running' state by a crashed or restarted server, and CLI runs
+// that have been running for too long
+func (q *Queries) InterruptStaleJobRuns(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, interruptStaleJobRuns)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const linkKeycloakID = `-- name: LinkKeycloakID :one
 UPDATE users SET
     keycloak_id = ?,
@@ -766,65 +1704,594 @@ func (q *Queries) LinkKeycloakID(ctx context.Context, arg LinkKeycloakIDParams)
 	return i, err
 }
 
-const listAcceptedUsersForFees = `-- name: ListAcceptedUsersForFees :many
-SELECT u.id, u.keycloak_id, u.email, u.username, u.realname, u.phone, u.alt_contact, u.level_id, u.level_actual_amount, u.payments_id, u.date_joined, u.keys_granted, u.keys_returned, u.state, u.is_council, u.is_staff, u.created_at, u.updated_at, l.amount as level_amount
-FROM users u
-JOIN levels l ON u.level_id = l.id
-WHERE u.state = 'accepted'
-ORDER BY u.id
+const listAcceptedUsersForFees = `-- name: ListAcceptedUsersForFees :many
+SELECT u.id, u.keycloak_id, u.email, u.username, u.realname, u.phone, u.alt_contact, u.level_id, u.level_actual_amount, u.payments_id, u.date_joined, u.keys_granted, u.keys_returned, u.state, u.is_council, u.is_staff, u.created_at, u.updated_at, l.amount as level_amount
+FROM users u
+JOIN levels l ON u.level_id = l.id
+WHERE u.state = 'accepted'
+ORDER BY u.id
+`
+
+type ListAcceptedUsersForFeesRow struct {
+	ID                int64          `json:"id"`
+	KeycloakID        sql.NullString `json:"keycloak_id"`
+	Email             string         `json:"email"`
+	Username          sql.NullString `json:"username"`
+	Realname          sql.NullString `json:"realname"`
+	Phone             sql.NullString `json:"phone"`
+	AltContact        sql.NullString `json:"alt_contact"`
+	LevelID           int64          `json:"level_id"`
+	LevelActualAmount money.Amount   `json:"level_actual_amount"`
+	PaymentsID        sql.NullString `json:"payments_id"`
+	DateJoined        time.Time      `json:"date_joined"`
+	KeysGranted       sql.NullTime   `json:"keys_granted"`
+	KeysReturned      sql.NullTime   `json:"keys_returned"`
+	State             string         `json:"state"`
+	IsCouncil         bool           `json:"is_council"`
+	IsStaff           bool           `json:"is_staff"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	LevelAmount       money.Amount   `json:"level_amount"`
+}
+
+func (q *Queries) ListAcceptedUsersForFees(ctx context.Context) ([]ListAcceptedUsersForFeesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listAcceptedUsersForFees)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListAcceptedUsersForFeesRow{}
+	for rows.Next() {
+		var i ListAcceptedUsersForFeesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.KeycloakID,
+			&i.Email,
+			&i.Username,
+			&i.Realname,
+			&i.Phone,
+			&i.AltContact,
+			&i.LevelID,
+			&i.LevelActualAmount,
+			&i.PaymentsID,
+			&i.DateJoined,
+			&i.KeysGranted,
+			&i.KeysReturned,
+			&i.State,
+			&i.IsCouncil,
+			&i.IsStaff,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LevelAmount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAllLevels = `-- name: ListAllLevels :many
+SELECT id, name, amount, active, created_at FROM levels ORDER BY amount
+`
+
+func (q *Queries) ListAllLevels(ctx context.Context) ([]Level, error) {
+	rows, err := q.db.QueryContext(ctx, listAllLevels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Level{}
+	for rows.Next() {
+		var i Level
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Amount,
+			&i.Active,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAnnouncements = `-- name: ListAnnouncements :many
+SELECT id, subject, body, segment, recipients, queued, failed, created_by, created_at FROM announcements
+ORDER BY created_at DESC, id DESC
+LIMIT ?
+`
+
+func (q *Queries) ListAnnouncements(ctx context.Context, limit int64) ([]Announcement, error) {
+	rows, err := q.db.QueryContext(ctx, listAnnouncements, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Announcement{}
+	for rows.Next() {
+		var i Announcement
+		if err := rows.Scan(
+			&i.ID,
+			&i.Subject,
+			&i.Body,
+			&i.Segment,
+			&i.Recipients,
+			&i.Queued,
+			&i.Failed,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listApplicationsByStatus = `-- name: ListApplicationsByStatus :many
+SELECT id, user_id, realname, phone, alt_contact, level_id, level_actual_amount, motivation, status, decided_by, decided_at, decision_comment, created_at FROM applications WHERE status = ? ORDER BY created_at, id
+`
+
+func (q *Queries) ListApplicationsByStatus(ctx context.Context, status string) ([]Application, error) {
+	rows, err := q.db.QueryContext(ctx, listApplicationsByStatus, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Application{}
+	for rows.Next() {
+		var i Application
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Realname,
+			&i.Phone,
+			&i.AltContact,
+			&i.LevelID,
+			&i.LevelActualAmount,
+			&i.Motivation,
+			&i.Status,
+			&i.DecidedBy,
+			&i.DecidedAt,
+			&i.DecisionComment,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCurrentEmailTemplates = `-- name: ListCurrentEmailTemplates :many
+SELECT id, template, version, subject, html_body, text_body, note, created_by, created_at FROM email_template_versions v
+WHERE version = (SELECT MAX(version) FROM email_template_versions WHERE template = v.template)
+ORDER BY template
+`
+
+// The latest version of every edited template
+func (q *Queries) ListCurrentEmailTemplates(ctx context.Context) ([]EmailTemplateVersion, error) {
+	rows, err := q.db.QueryContext(ctx, listCurrentEmailTemplates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []EmailTemplateVersion{}
+	for rows.Next() {
+		var i EmailTemplateVersion
+		if err := rows.Scan(
+			&i.ID,
+			&i.Template,
+			&i.Version,
+			&i.Subject,
+			&i.HtmlBody,
+			&i.TextBody,
+			&i.Note,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDebtExemptions = `-- name: ListDebtExemptions :many
+SELECT id, user_id, reason, valid_until, created_by, created_at FROM debt_exemptions ORDER BY created_at, id
+`
+
+func (q *Queries) ListDebtExemptions(ctx context.Context) ([]DebtExemption, error) {
+	rows, err := q.db.QueryContext(ctx, listDebtExemptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DebtExemption{}
+	for rows.Next() {
+		var i DebtExemption
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Reason,
+			&i.ValidUntil,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDueEmails = `-- name: ListDueEmails :many
+SELECT id, user_id, recipient, subject, template, body, status, attempts, max_attempts, next_attempt_at, last_error, created_at, sent_at, text_body, reply_to, list_unsubscribe, message_id, attachments FROM email_outbox
+WHERE status = 'queued' AND next_attempt_at <= ?
+ORDER BY next_attempt_at, id
+LIMIT ?
+`
+
+type ListDueEmailsParams struct {
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	Limit         int64     `json:"limit"`
+}
+
+// Queued emails whose next attempt is due. Times are written in UTC by the
+// email client, so they compare as text.
+func (q *Queries) ListDueEmails(ctx context.Context, arg ListDueEmailsParams) ([]EmailOutbox, error) {
+	rows, err := q.db.QueryContext(ctx, listDueEmails, arg.NextAttemptAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []EmailOutbox{}
+	for rows.Next() {
+		var i EmailOutbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Recipient,
+			&i.Subject,
+			&i.Template,
+			&i.Body,
+			&i.Status,
+			&i.Attempts,
+			&i.MaxAttempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.SentAt,
+			&i.TextBody,
+			&i.ReplyTo,
+			&i.ListUnsubscribe,
+			&i.MessageID,
+			&i.Attachments,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEmailTemplateVersions = `-- name: ListEmailTemplateVersions :many
+SELECT id, template, version, subject, html_body, text_body, note, created_by, created_at FROM email_template_versions
+WHERE template = ?
+ORDER BY version DESC
+`
+
+func (q *Queries) ListEmailTemplateVersions(ctx context.Context, template string) ([]EmailTemplateVersion, error) {
+	rows, err := q.db.QueryContext(ctx, listEmailTemplateVersions, template)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []EmailTemplateVersion{}
+	for rows.Next() {
+		var i EmailTemplateVersion
+		if err := rows.Scan(
+			&i.ID,
+			&i.Template,
+			&i.Version,
+			&i.Subject,
+			&i.HtmlBody,
+			&i.TextBody,
+			&i.Note,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEmails = `-- name: ListEmails :many
+SELECT id, user_id, recipient, subject, template, body, status, attempts, max_attempts, next_attempt_at, last_error, created_at, sent_at, text_body, reply_to, list_unsubscribe, message_id, attachments FROM email_outbox
+WHERE (?1 IS NULL OR status = ?1)
+ORDER BY id DESC
+LIMIT ?2
+`
+
+type ListEmailsParams struct {
+	Status sql.NullString `json:"status"`
+	Limit  int64          `json:"limit"`
+}
+
+// Outbox (admin), newest first. A NULL status lists all.
+func (q *Queries) ListEmails(ctx context.Context, arg ListEmailsParams) ([]EmailOutbox, error) {
+	rows, err := q.db.QueryContext(ctx, listEmails, arg.Status, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []EmailOutbox{}
+	for rows.Next() {
+		var i EmailOutbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Recipient,
+			&i.Subject,
+			&i.Template,
+			&i.Body,
+			&i.Status,
+			&i.Attempts,
+			&i.MaxAttempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.SentAt,
+			&i.TextBody,
+			&i.ReplyTo,
+			&i.ListUnsubscribe,
+			&i.MessageID,
+			&i.Attachments,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFeesByPeriod = `-- name: ListFeesByPeriod :many
+SELECT id, user_id, level_id, period_start, amount, created_at FROM fees WHERE period_start = ? ORDER BY user_id
+`
+
+func (q *Queries) ListFeesByPeriod(ctx context.Context, periodStart time.Time) ([]Fee, error) {
+	rows, err := q.db.QueryContext(ctx, listFeesByPeriod, periodStart)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Fee{}
+	for rows.Next() {
+		var i Fee
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.LevelID,
+			&i.PeriodStart,
+			&i.Amount,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFeesByUser = `-- name: ListFeesByUser :many
+SELECT id, user_id, level_id, period_start, amount, created_at FROM fees WHERE user_id = ? ORDER BY period_start DESC
+`
+
+func (q *Queries) ListFeesByUser(ctx context.Context, userID int64) ([]Fee, error) {
+	rows, err := q.db.QueryContext(ctx, listFeesByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Fee{}
+	for rows.Next() {
+		var i Fee
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.LevelID,
+			&i.PeriodStart,
+			&i.Amount,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFeesCreatedSince = `-- name: ListFeesCreatedSince :many
+SELECT id, user_id, level_id, period_start, amount, created_at FROM fees WHERE julianday(created_at) >= julianday(?) ORDER BY user_id, period_start
+`
+
+// Fees still in the grace period of the debt policy
+func (q *Queries) ListFeesCreatedSince(ctx context.Context, since interface{}) ([]Fee, error) {
+	rows, err := q.db.QueryContext(ctx, listFeesCreatedSince, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Fee{}
+	for rows.Next() {
+		var i Fee
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.LevelID,
+			&i.PeriodStart,
+			&i.Amount,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listJobRuns = `-- name: ListJobRuns :many
+SELECT id, job_name, source, status, triggered_by, started_at, finished_at, duration_ms, summary, error, output FROM job_runs
+WHERE (? = '' OR job_name = ?)
+ORDER BY id DESC LIMIT ?
+`
+
+type ListJobRunsParams struct {
+	Column1 interface{} `json:"column_1"`
+	JobName string      `json:"job_name"`
+	Limit   int64       `json:"limit"`
+}
+
+func (q *Queries) ListJobRuns(ctx context.Context, arg ListJobRunsParams) ([]JobRun, error) {
+	rows, err := q.db.QueryContext(ctx, listJobRuns, arg.Column1, arg.JobName, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []JobRun{}
+	for rows.Next() {
+		var i JobRun
+		if err := rows.Scan(
+			&i.ID,
+			&i.JobName,
+			&i.Source,
+			&i.Status,
+			&i.TriggeredBy,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.DurationMs,
+			&i.Summary,
+			&i.Error,
+			&i.Output,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLastJobRuns = `-- name: ListLastJobRuns :many
+SELECT id, job_name, source, status, triggered_by, started_at, finished_at, duration_ms, summary, error, output FROM job_runs
+WHERE id IN (SELECT MAX(id) FROM job_runs GROUP BY job_name)
+ORDER BY job_name
 `
 
-type ListAcceptedUsersForFeesRow struct {
-	ID                int64          `json:"id"`
-	KeycloakID        sql.NullString `json:"keycloak_id"`
-	Email             string         `json:"email"`
-	Username          sql.NullString `json:"username"`
-	Realname          sql.NullString `json:"realname"`
-	Phone             sql.NullString `json:"phone"`
-	AltContact        sql.NullString `json:"alt_contact"`
-	LevelID           int64          `json:"level_id"`
-	LevelActualAmount string         `json:"level_actual_amount"`
-	PaymentsID        sql.NullString `json:"payments_id"`
-	DateJoined        time.Time      `json:"date_joined"`
-	KeysGranted       sql.NullTime   `json:"keys_granted"`
-	KeysReturned      sql.NullTime   `json:"keys_returned"`
-	State             string         `json:"state"`
-	IsCouncil         bool           `json:"is_council"`
-	IsStaff           bool           `json:"is_staff"`
-	CreatedAt         time.Time      `json:"created_at"`
-	UpdatedAt         time.Time      `json:"updated_at"`
-	LevelAmount       string         `json:"level_amount"`
-}
-
-func (q *Queries) ListAcceptedUsersForFees(ctx context.Context) ([]ListAcceptedUsersForFeesRow, error) {
-	rows, err := q.db.QueryContext(ctx, listAcceptedUsersForFees)
+// Most recent run of every job
+func (q *Queries) ListLastJobRuns(ctx context.Context) ([]JobRun, error) {
+	rows, err := q.db.QueryContext(ctx, listLastJobRuns)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []ListAcceptedUsersForFeesRow{}
+	items := []JobRun{}
 	for rows.Next() {
-		var i ListAcceptedUsersForFeesRow
+		var i JobRun
 		if err := rows.Scan(
 			&i.ID,
-			&i.KeycloakID,
-			&i.Email,
-			&i.Username,
-			&i.Realname,
-			&i.Phone,
-			&i.AltContact,
-			&i.LevelID,
-			&i.LevelActualAmount,
-			&i.PaymentsID,
-			&i.DateJoined,
-			&i.KeysGranted,
-			&i.KeysReturned,
-			&i.State,
-			&i.IsCouncil,
-			&i.IsStaff,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.LevelAmount,
+			&i.JobName,
+			&i.Source,
+			&i.Status,
+			&i.TriggeredBy,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.DurationMs,
+			&i.Summary,
+			&i.Error,
+			&i.Output,
 		); err != nil {
 			return nil, err
 		}
@@ -839,24 +2306,27 @@ func (q *Queries) ListAcceptedUsersForFees(ctx context.Context) ([]ListAcceptedU
 	return items, nil
 }
 
-const listAllLevels = `-- name: ListAllLevels :many
-SELECT id, name, amount, active, created_at FROM levels ORDER BY amount
+const listLevelHistoryByLevel = `-- name: ListLevelHistoryByLevel :many
+SELECT id, user_id, level_id, level_actual_amount, effective_from, changed_by, reason, created_at FROM membership_level_history WHERE level_id = ? ORDER BY effective_from, id
 `
 
-func (q *Queries) ListAllLevels(ctx context.Context) ([]Level, error) {
-	rows, err := q.db.QueryContext(ctx, listAllLevels)
+func (q *Queries) ListLevelHistoryByLevel(ctx context.Context, levelID int64) ([]MembershipLevelHistory, error) {
+	rows, err := q.db.QueryContext(ctx, listLevelHistoryByLevel, levelID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Level{}
+	items := []MembershipLevelHistory{}
 	for rows.Next() {
-		var i Level
+		var i MembershipLevelHistory
 		if err := rows.Scan(
 			&i.ID,
-			&i.Name,
-			&i.Amount,
-			&i.Active,
+			&i.UserID,
+			&i.LevelID,
+			&i.LevelActualAmount,
+			&i.EffectiveFrom,
+			&i.ChangedBy,
+			&i.Reason,
 			&i.CreatedAt,
 		); err != nil {
 			return nil, err
@@ -872,25 +2342,27 @@ func (q *Queries) ListAllLevels(ctx context.Context) ([]Level, error) {
 	return items, nil
 }
 
-const listFeesByPeriod = `-- name: ListFeesByPeriod :many
-SELECT id, user_id, level_id, period_start, amount, created_at FROM fees WHERE period_start = ? ORDER BY user_id
+const listLevelHistoryByUser = `-- name: ListLevelHistoryByUser :many
+SELECT id, user_id, level_id, level_actual_amount, effective_from, changed_by, reason, created_at FROM membership_level_history WHERE user_id = ? ORDER BY effective_from DESC, id DESC
 `
 
-func (q *Queries) ListFeesByPeriod(ctx context.Context, periodStart time.Time) ([]Fee, error) {
-	rows, err := q.db.QueryContext(ctx, listFeesByPeriod, periodStart)
+func (q *Queries) ListLevelHistoryByUser(ctx context.Context, userID int64) ([]MembershipLevelHistory, error) {
+	rows, err := q.db.QueryContext(ctx, listLevelHistoryByUser, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Fee{}
+	items := []MembershipLevelHistory{}
 	for rows.Next() {
-		var i Fee
+		var i MembershipLevelHistory
 		if err := rows.Scan(
 			&i.ID,
 			&i.UserID,
 			&i.LevelID,
-			&i.PeriodStart,
-			&i.Amount,
+			&i.LevelActualAmount,
+			&i.EffectiveFrom,
+			&i.ChangedBy,
+			&i.Reason,
 			&i.CreatedAt,
 		); err != nil {
 			return nil, err
@@ -906,26 +2378,30 @@ func (q *Queries) ListFeesByPeriod(ctx context.Context, periodStart time.Time) (
 	return items, nil
 }
 
-const listFeesByUser = `-- name: ListFeesByUser :many
-SELECT id, user_id, level_id, period_start, amount, created_at FROM fees WHERE user_id = ? ORDER BY period_start DESC
+const listLevelPriceChanges = `-- name: ListLevelPriceChanges :many
+SELECT id, level_id, old_amount, new_amount, effective_from, members_affected, members_notified, created_by, created_at, applied_at FROM level_price_changes ORDER BY effective_from, id
 `
 
-func (q *Queries) ListFeesByUser(ctx context.Context, userID int64) ([]Fee, error) {
-	rows, err := q.db.QueryContext(ctx, listFeesByUser, userID)
+func (q *Queries) ListLevelPriceChanges(ctx context.Context) ([]LevelPriceChange, error) {
+	rows, err := q.db.QueryContext(ctx, listLevelPriceChanges)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Fee{}
+	items := []LevelPriceChange{}
 	for rows.Next() {
-		var i Fee
+		var i LevelPriceChange
 		if err := rows.Scan(
 			&i.ID,
-			&i.UserID,
 			&i.LevelID,
-			&i.PeriodStart,
-			&i.Amount,
+			&i.OldAmount,
+			&i.NewAmount,
+			&i.EffectiveFrom,
+			&i.MembersAffected,
+			&i.MembersNotified,
+			&i.CreatedBy,
 			&i.CreatedAt,
+			&i.AppliedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1110,16 +2586,49 @@ func (q *Queries) ListLogsFiltered(ctx context.Context, arg ListLogsFilteredPara
 	return items, nil
 }
 
+const listMemberPaymentsIDs = `-- name: ListMemberPaymentsIDs :many
+SELECT payments_id FROM users WHERE payments_id IS NOT NULL AND payments_id != ''
+UNION
+SELECT payments_id FROM payments_id_history
+`
+
+// Every VS a member has or had, for the VS allocator
+func (q *Queries) ListMemberPaymentsIDs(ctx context.Context) ([]sql.NullString, error) {
+	rows, err := q.db.QueryContext(ctx, listMemberPaymentsIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []sql.NullString{}
+	for rows.Next() {
+		var payments_id sql.NullString
+		if err := rows.Scan(&payments_id); err != nil {
+			return nil, err
+		}
+		items = append(items, payments_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listMembershipPaymentsByUser = `-- name: ListMembershipPaymentsByUser :many
-SELECT p.id, p.user_id, p.date, p.amount, p.kind, p.kind_id, p.local_account, p.remote_account, p.identification, p.raw_data, p.staff_comment, p.created_at, p.project_id
+SELECT p.id, p.user_id, p.date, p.amount, p.kind, p.kind_id, p.local_account, p.remote_account, p.identification, p.raw_data, p.staff_comment, p.created_at, p.project_id, p.recorded_by, p.voided_at
 FROM payments p
 JOIN users u ON p.user_id = u.id
 WHERE p.user_id = ?
-AND p.identification = u.payments_id
+AND (p.identification = u.payments_id OR p.kind = 'manual'
+     OR p.identification IN (SELECT h.payments_id FROM payments_id_history h WHERE h.user_id = p.user_id))
+AND p.voided_at IS NULL
 ORDER BY p.date DESC
 `
 
-// Only payments that match the user's membership VS (payments_id)
+// Only payments that match the user's membership VS (payments_id, current or previous)
+// and manual payments
 func (q *Queries) ListMembershipPaymentsByUser(ctx context.Context, userID sql.NullInt64) ([]Payment, error) {
 	rows, err := q.db.QueryContext(ctx, listMembershipPaymentsByUser, userID)
 	if err != nil {
@@ -1143,6 +2652,43 @@ func (q *Queries) ListMembershipPaymentsByUser(ctx context.Context, userID sql.N
 			&i.StaffComment,
 			&i.CreatedAt,
 			&i.ProjectID,
+			&i.RecordedBy,
+			&i.VoidedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOpenDunningNotices = `-- name: ListOpenDunningNotices :many
+SELECT id, user_id, stage, balance, sent_at, resolved_at FROM dunning_notices WHERE resolved_at IS NULL ORDER BY user_id, sent_at, id
+`
+
+// Notices of the open cases, oldest first
+func (q *Queries) ListOpenDunningNotices(ctx context.Context) ([]DunningNotice, error) {
+	rows, err := q.db.QueryContext(ctx, listOpenDunningNotices)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DunningNotice{}
+	for rows.Next() {
+		var i DunningNotice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Stage,
+			&i.Balance,
+			&i.SentAt,
+			&i.ResolvedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1158,7 +2704,7 @@ func (q *Queries) ListMembershipPaymentsByUser(ctx context.Context, userID sql.N
 }
 
 const listPaymentsByUser = `-- name: ListPaymentsByUser :many
-SELECT id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id FROM payments WHERE user_id = ? ORDER BY date DESC
+SELECT id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at FROM payments WHERE user_id = ? AND voided_at IS NULL ORDER BY date DESC
 `
 
 func (q *Queries) ListPaymentsByUser(ctx context.Context, userID sql.NullInt64) ([]Payment, error) {
@@ -1183,7 +2729,217 @@ func (q *Queries) ListPaymentsByUser(ctx context.Context, userID sql.NullInt64)
 			&i.RawData,
 			&i.StaffComment,
 			&i.CreatedAt,
-			&i.ProjectID,
+			&i.ProjectID,
+			&i.RecordedBy,
+			&i.VoidedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPaymentsFiltered = `-- name: ListPaymentsFiltered :many
+SELECT p.id, p.user_id, p.date, p.amount, p.kind, p.kind_id, p.local_account, p.remote_account, p.identification, p.raw_data, p.staff_comment, p.created_at, p.project_id, p.recorded_by, p.voided_at FROM payments p
+WHERE (?1 IS NULL OR substr(p.date, 1, 10) >= ?1)
+  AND (?2 IS NULL OR substr(p.date, 1, 10) <= ?2)
+  AND (?3 IS NULL OR p.kind = ?3)
+  AND (?4 IS NULL OR CAST(REPLACE(p.amount, '.', '') AS INTEGER) >= ?4)
+  AND (?5 IS NULL OR CAST(REPLACE(p.amount, '.', '') AS INTEGER) <= ?5)
+  AND (?6 IS NULL OR p.identification = ?6)
+  AND (?7 IS NULL OR p.remote_account LIKE '%' || ?7 || '%')
+  AND (?8 IS NULL OR (p.user_id IS NOT NULL OR p.project_id IS NOT NULL) = ?8)
+  AND (?9 IS NULL OR p.user_id = ?9)
+  AND (?10 IS NULL OR p.project_id = ?10)
+  AND (?11 IS NULL OR (
+        CASE WHEN json_valid(p.raw_data) THEN
+            COALESCE(json_extract(p.raw_data, '$.column16'), '') || ' ' ||
+            COALESCE(json_extract(p.raw_data, '$.column25'), '') || ' ' ||
+            COALESCE(json_extract(p.raw_data, '$.column7'), '')
+        ELSE '' END || ' ' || COALESCE(p.staff_comment, '')
+      ) LIKE '%' || ?11 || '%')
+ORDER BY p.date DESC, p.id DESC
+LIMIT ?12 OFFSET ?13
+`
+
+type ListPaymentsFilteredParams struct {
+	DateFrom      sql.NullString `json:"date_from"`
+	DateTo        sql.NullString `json:"date_to"`
+	Kind          sql.NullString `json:"kind"`
+	AmountMin     sql.NullInt64  `json:"amount_min"`
+	AmountMax     sql.NullInt64  `json:"amount_max"`
+	Vs            sql.NullString `json:"vs"`
+	RemoteAccount sql.NullString `json:"remote_account"`
+	Assigned      sql.NullBool   `json:"assigned"`
+	UserID        sql.NullInt64  `json:"user_id"`
+	ProjectID     sql.NullInt64  `json:"project_id"`
+	Search        sql.NullString `json:"search"`
+	Limit         int64          `json:"limit"`
+	Offset        int64          `json:"offset"`
+}
+
+// Payment ledger (admin). NULL filters are ignored, amounts are in haléře,
+// dates YYYY-MM-DD. search looks in the FIO message fields of raw_data
+// (message, comment, identification) and in the staff comment. Voided
+// payments are included (voided_at is set).
+func (q *Queries) ListPaymentsFiltered(ctx context.Context, arg ListPaymentsFilteredParams) ([]Payment, error) {
+	rows, err := q.db.QueryContext(ctx, listPaymentsFiltered,
+		arg.DateFrom,
+		arg.DateTo,
+		arg.Kind,
+		arg.AmountMin,
+		arg.AmountMax,
+		arg.Vs,
+		arg.RemoteAccount,
+		arg.Assigned,
+		arg.UserID,
+		arg.ProjectID,
+		arg.Search,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Payment{}
+	for rows.Next() {
+		var i Payment
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Date,
+			&i.Amount,
+			&i.Kind,
+			&i.KindID,
+			&i.LocalAccount,
+			&i.RemoteAccount,
+			&i.Identification,
+			&i.RawData,
+			&i.StaffComment,
+			&i.CreatedAt,
+			&i.ProjectID,
+			&i.RecordedBy,
+			&i.VoidedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPaymentsIDHistoryByUser = `-- name: ListPaymentsIDHistoryByUser :many
+SELECT id, user_id, payments_id, replaced_by, changed_by, reason, changed_at FROM payments_id_history WHERE user_id = ? ORDER BY changed_at DESC, id DESC
+`
+
+func (q *Queries) ListPaymentsIDHistoryByUser(ctx context.Context, userID int64) ([]PaymentsIDHistory, error) {
+	rows, err := q.db.QueryContext(ctx, listPaymentsIDHistoryByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []PaymentsIDHistory{}
+	for rows.Next() {
+		var i PaymentsIDHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.PaymentsID,
+			&i.ReplacedBy,
+			&i.ChangedBy,
+			&i.Reason,
+			&i.ChangedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listProjects = `-- name: ListProjects :many
+
+SELECT id, name, payments_id, description FROM projects ORDER BY id DESC
+`
+
+// ============================================================================
+// PROJECTS (Fundraising / Special VS)
+// ============================================================================
+func (q *Queries) ListProjects(ctx context.Context) ([]Project, error) {
+	rows, err := q.db.QueryContext(ctx, listProjects)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Project{}
+	for rows.Next() {
+		var i Project
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.PaymentsID,
+			&i.Description,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRecentDecidedApplications = `-- name: ListRecentDecidedApplications :many
+SELECT id, user_id, realname, phone, alt_contact, level_id, level_actual_amount, motivation, status, decided_by, decided_at, decision_comment, created_at FROM applications WHERE status != 'pending' ORDER BY decided_at DESC, id DESC LIMIT ?
+`
+
+func (q *Queries) ListRecentDecidedApplications(ctx context.Context, limit int64) ([]Application, error) {
+	rows, err := q.db.QueryContext(ctx, listRecentDecidedApplications, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Application{}
+	for rows.Next() {
+		var i Application
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Realname,
+			&i.Phone,
+			&i.AltContact,
+			&i.LevelID,
+			&i.LevelActualAmount,
+			&i.Motivation,
+			&i.Status,
+			&i.DecidedBy,
+			&i.DecidedAt,
+			&i.DecisionComment,
+			&i.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1198,28 +2954,26 @@ func (q *Queries) ListPaymentsByUser(ctx context.Context, userID sql.NullInt64)
 	return items, nil
 }
 
-const listProjects = `-- name: ListProjects :many
-
-SELECT id, name, payments_id, description FROM projects ORDER BY id DESC
+const listRecentDunningNotices = `-- name: ListRecentDunningNotices :many
+SELECT id, user_id, stage, balance, sent_at, resolved_at FROM dunning_notices ORDER BY sent_at DESC, id DESC LIMIT ?
 `
 
-// ============================================================================
-// PROJECTS (Fundraising / Special VS)
-// ============================================================================
-func (q *Queries) ListProjects(ctx context.Context) ([]Project, error) {
-	rows, err := q.db.QueryContext(ctx, listProjects)
+func (q *Queries) ListRecentDunningNotices(ctx context.Context, limit int64) ([]DunningNotice, error) {
+	rows, err := q.db.QueryContext(ctx, listRecentDunningNotices, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Project{}
+	items := []DunningNotice{}
 	for rows.Next() {
-		var i Project
+		var i DunningNotice
 		if err := rows.Scan(
 			&i.ID,
-			&i.Name,
-			&i.PaymentsID,
-			&i.Description,
+			&i.UserID,
+			&i.Stage,
+			&i.Balance,
+			&i.SentAt,
+			&i.ResolvedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1270,7 +3024,7 @@ func (q *Queries) ListRecentLogs(ctx context.Context, limit int64) ([]SystemLog,
 }
 
 const listRecentPayments = `-- name: ListRecentPayments :many
-SELECT id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id FROM payments ORDER BY date DESC LIMIT ?
+SELECT id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at FROM payments WHERE voided_at IS NULL ORDER BY date DESC LIMIT ?
 `
 
 func (q *Queries) ListRecentPayments(ctx context.Context, limit int64) ([]Payment, error) {
@@ -1296,6 +3050,43 @@ func (q *Queries) ListRecentPayments(ctx context.Context, limit int64) ([]Paymen
 			&i.StaffComment,
 			&i.CreatedAt,
 			&i.ProjectID,
+			&i.RecordedBy,
+			&i.VoidedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStateHistoryByUser = `-- name: ListStateHistoryByUser :many
+SELECT id, user_id, from_state, to_state, changed_by, reason, changed_at FROM membership_state_history WHERE user_id = ? ORDER BY changed_at DESC, id DESC
+`
+
+func (q *Queries) ListStateHistoryByUser(ctx context.Context, userID int64) ([]MembershipStateHistory, error) {
+	rows, err := q.db.QueryContext(ctx, listStateHistoryByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []MembershipStateHistory{}
+	for rows.Next() {
+		var i MembershipStateHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.FromState,
+			&i.ToState,
+			&i.ChangedBy,
+			&i.Reason,
+			&i.ChangedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1311,7 +3102,7 @@ func (q *Queries) ListRecentPayments(ctx context.Context, limit int64) ([]Paymen
 }
 
 const listUnassignedPayments = `-- name: ListUnassignedPayments :many
-SELECT id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id FROM payments WHERE user_id IS NULL ORDER BY date DESC
+SELECT id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at FROM payments WHERE user_id IS NULL AND voided_at IS NULL ORDER BY date DESC
 `
 
 func (q *Queries) ListUnassignedPayments(ctx context.Context) ([]Payment, error) {
@@ -1337,6 +3128,8 @@ func (q *Queries) ListUnassignedPayments(ctx context.Context) ([]Payment, error)
 			&i.StaffComment,
 			&i.CreatedAt,
 			&i.ProjectID,
+			&i.RecordedBy,
+			&i.VoidedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1351,6 +3144,52 @@ func (q *Queries) ListUnassignedPayments(ctx context.Context) ([]Payment, error)
 	return items, nil
 }
 
+const listUserBalances = `-- name: ListUserBalances :many
+SELECT u.id AS user_id, CAST(
+    COALESCE((
+        SELECT SUM(CAST(REPLACE(p.amount, '.', '') AS INTEGER))
+        FROM payments p
+        WHERE p.user_id = u.id
+        AND (p.identification = u.payments_id OR p.kind = 'manual'
+             OR p.identification IN (SELECT h.payments_id FROM payments_id_history h WHERE h.user_id = p.user_id))
+        AND p.voided_at IS NULL
+    ), 0) -
+    COALESCE((SELECT SUM(CAST(REPLACE(f.amount, '.', '') AS INTEGER)) FROM fees f WHERE f.user_id = u.id), 0)
+AS INTEGER) as balance
+FROM users u
+ORDER BY u.id
+`
+
+type ListUserBalancesRow struct {
+	UserID  int64 `json:"user_id"`
+	Balance int64 `json:"balance"`
+}
+
+// Balance of every user in haléře, computed like GetUserBalance in a single
+// query (for jobs that go through all members)
+func (q *Queries) ListUserBalances(ctx context.Context) ([]ListUserBalancesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserBalances)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserBalancesRow{}
+	for rows.Next() {
+		var i ListUserBalancesRow
+		if err := rows.Scan(&i.UserID, &i.Balance); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUsers = `-- name: ListUsers :many
 SELECT id, keycloak_id, email, username, realname, phone, alt_contact, level_id, level_actual_amount, payments_id, date_joined, keys_granted, keys_returned, state, is_council, is_staff, created_at, updated_at FROM users ORDER BY realname, email
 `
@@ -1443,6 +3282,200 @@ func (q *Queries) ListUsersByState(ctx context.Context, state string) ([]User, e
 	return items, nil
 }
 
+const markEmailFailed = `-- name: MarkEmailFailed :exec
+UPDATE email_outbox SET status = ?, next_attempt_at = ?, last_error = ? WHERE id = ?
+`
+
+type MarkEmailFailedParams struct {
+	Status        string         `json:"status"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	LastError     sql.NullString `json:"last_error"`
+	ID            int64          `json:"id"`
+}
+
+// Records a failed attempt: queued again for next_attempt_at, or failed
+// (dead letter) after the last attempt
+func (q *Queries) MarkEmailFailed(ctx context.Context, arg MarkEmailFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markEmailFailed,
+		arg.Status,
+		arg.NextAttemptAt,
+		arg.LastError,
+		arg.ID,
+	)
+	return err
+}
+
+const markEmailSent = `-- name: MarkEmailSent :exec
+UPDATE email_outbox SET status = 'sent', sent_at = ?, last_error = NULL WHERE id = ?
+`
+
+type MarkEmailSentParams struct {
+	SentAt sql.NullTime `json:"sent_at"`
+	ID     int64        `json:"id"`
+}
+
+func (q *Queries) MarkEmailSent(ctx context.Context, arg MarkEmailSentParams) error {
+	_, err := q.db.ExecContext(ctx, markEmailSent, arg.SentAt, arg.ID)
+	return err
+}
+
+const markLevelPriceChangeApplied = `-- name: MarkLevelPriceChangeApplied :exec
+UPDATE level_price_changes SET applied_at = CURRENT_TIMESTAMP WHERE id = ?
+`
+
+func (q *Queries) MarkLevelPriceChangeApplied(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, markLevelPriceChangeApplied, id)
+	return err
+}
+
+const requeueStaleEmails = `-- name: RequeueStaleEmails :execrows
+UPDATE email_outbox SET status = 'queued' WHERE status = 'sending'
+`
+
+// Emails left in 'sending' by a crashed or restarted worker
+func (q *Queries) RequeueStaleEmails(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, requeueStaleEmails)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const resendEmail = `-- name: ResendEmail :exec
+UPDATE email_outbox SET
+    status = 'queued',
+    attempts = 0,
+    next_attempt_at = ?,
+    sent_at = NULL
+WHERE id = ?
+`
+
+type ResendEmailParams struct {
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	ID            int64     `json:"id"`
+}
+
+// Queues the email again with a fresh set of attempts
+func (q *Queries) ResendEmail(ctx context.Context, arg ResendEmailParams) error {
+	_, err := q.db.ExecContext(ctx, resendEmail, arg.NextAttemptAt, arg.ID)
+	return err
+}
+
+const resolveDunningNotices = `-- name: ResolveDunningNotices :exec
+UPDATE dunning_notices SET resolved_at = ? WHERE user_id = ? AND resolved_at IS NULL
+`
+
+type ResolveDunningNoticesParams struct {
+	ResolvedAt sql.NullTime `json:"resolved_at"`
+	UserID     int64        `json:"user_id"`
+}
+
+// Closes the open case of a member
+func (q *Queries) ResolveDunningNotices(ctx context.Context, arg ResolveDunningNoticesParams) error {
+	_, err := q.db.ExecContext(ctx, resolveDunningNotices, arg.ResolvedAt, arg.UserID)
+	return err
+}
+
+const setSyncCursor = `-- name: SetSyncCursor :one
+INSERT INTO sync_cursors (name, last_id)
+VALUES (?, ?)
+ON CONFLICT(name) DO UPDATE SET
+    last_id = excluded.last_id,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING name, last_id, updated_at
+`
+
+type SetSyncCursorParams struct {
+	Name   string `json:"name"`
+	LastID int64  `json:"last_id"`
+}
+
+func (q *Queries) SetSyncCursor(ctx context.Context, arg SetSyncCursorParams) (SyncCursor, error) {
+	row := q.db.QueryRowContext(ctx, setSyncCursor, arg.Name, arg.LastID)
+	var i SyncCursor
+	err := row.Scan(&i.Name, &i.LastID, &i.UpdatedAt)
+	return i, err
+}
+
+const summarizePaymentsFiltered = `-- name: SummarizePaymentsFiltered :one
+SELECT
+    COUNT(*) AS count,
+    CAST(COALESCE(SUM(CASE WHEN p.voided_at IS NULL THEN CAST(REPLACE(p.amount, '.', '') AS INTEGER) END), 0) AS INTEGER) AS total
+FROM payments p
+WHERE (?1 IS NULL OR substr(p.date, 1, 10) >= ?1)
+  AND (?2 IS NULL OR substr(p.date, 1, 10) <= ?2)
+  AND (?3 IS NULL OR p.kind = ?3)
+  AND (?4 IS NULL OR CAST(REPLACE(p.amount, '.', '') AS INTEGER) >= ?4)
+  AND (?5 IS NULL OR CAST(REPLACE(p.amount, '.', '') AS INTEGER) <= ?5)
+  AND (?6 IS NULL OR p.identification = ?6)
+  AND (?7 IS NULL OR p.remote_account LIKE '%' || ?7 || '%')
+  AND (?8 IS NULL OR (p.user_id IS NOT NULL OR p.project_id IS NOT NULL) = ?8)
+  AND (?9 IS NULL OR p.user_id = ?9)
+  AND (?10 IS NULL OR p.project_id = ?10)
+  AND (?11 IS NULL OR (
+        CASE WHEN json_valid(p.raw_data) THEN
+            COALESCE(json_extract(p.raw_data, '$.column16'), '') || ' ' ||
+            COALESCE(json_extract(p.raw_data, '$.column25'), '') || ' ' ||
+            COALESCE(json_extract(p.raw_data, '$.column7'), '')
+        ELSE '' END || ' ' || COALESCE(p.staff_comment, '')
+      ) LIKE '%' || ?11 || '%')
+`
+
+type SummarizePaymentsFilteredParams struct {
+	DateFrom      sql.NullString `json:"date_from"`
+	DateTo        sql.NullString `json:"date_to"`
+	Kind          sql.NullString `json:"kind"`
+	AmountMin     sql.NullInt64  `json:"amount_min"`
+	AmountMax     sql.NullInt64  `json:"amount_max"`
+	Vs            sql.NullString `json:"vs"`
+	RemoteAccount sql.NullString `json:"remote_account"`
+	Assigned      sql.NullBool   `json:"assigned"`
+	UserID        sql.NullInt64  `json:"user_id"`
+	ProjectID     sql.NullInt64  `json:"project_id"`
+	Search        sql.NullString `json:"search"`
+}
+
+type SummarizePaymentsFilteredRow struct {
+	Count int64 `json:"count"`
+	Total int64 `json:"total"`
+}
+
+// Number of payments matching the ListPaymentsFiltered filters and their
+// total in haléře (without voided payments)
+func (q *Queries) SummarizePaymentsFiltered(ctx context.Context, arg SummarizePaymentsFilteredParams) (SummarizePaymentsFilteredRow, error) {
+	row := q.db.QueryRowContext(ctx, summarizePaymentsFiltered,
+		arg.DateFrom,
+		arg.DateTo,
+		arg.Kind,
+		arg.AmountMin,
+		arg.AmountMax,
+		arg.Vs,
+		arg.RemoteAccount,
+		arg.Assigned,
+		arg.UserID,
+		arg.ProjectID,
+		arg.Search,
+	)
+	var i SummarizePaymentsFilteredRow
+	err := row.Scan(&i.Count, &i.Total)
+	return i, err
+}
+
+const updateAnnouncementResult = `-- name: UpdateAnnouncementResult :exec
+UPDATE announcements SET queued = ?, failed = ? WHERE id = ?
+`
+
+type UpdateAnnouncementResultParams struct {
+	Queued int64 `json:"queued"`
+	Failed int64 `json:"failed"`
+	ID     int64 `json:"id"`
+}
+
+func (q *Queries) UpdateAnnouncementResult(ctx context.Context, arg UpdateAnnouncementResultParams) error {
+	_, err := q.db.ExecContext(ctx, updateAnnouncementResult, arg.Queued, arg.Failed, arg.ID)
+	return err
+}
+
 const updateLevel = `-- name: UpdateLevel :one
 UPDATE levels SET
     name = ?,
@@ -1453,10 +3486,10 @@ RETURNING id, name, amount, active, created_at
 `
 
 type UpdateLevelParams struct {
-	Name   string `json:"name"`
-	Amount string `json:"amount"`
-	Active bool   `json:"active"`
-	ID     int64  `json:"id"`
+	Name   string       `json:"name"`
+	Amount money.Amount `json:"amount"`
+	Active bool         `json:"active"`
+	ID     int64        `json:"id"`
 }
 
 func (q *Queries) UpdateLevel(ctx context.Context, arg UpdateLevelParams) (Level, error) {
@@ -1477,6 +3510,76 @@ func (q *Queries) UpdateLevel(ctx context.Context, arg UpdateLevelParams) (Level
 	return i, err
 }
 
+const updateLevelPriceChangeNotified = `-- name: UpdateLevelPriceChangeNotified :exec
+UPDATE level_price_changes SET members_notified = ? WHERE id = ?
+`
+
+type UpdateLevelPriceChangeNotifiedParams struct {
+	MembersNotified int64 `json:"members_notified"`
+	ID              int64 `json:"id"`
+}
+
+func (q *Queries) UpdateLevelPriceChangeNotified(ctx context.Context, arg UpdateLevelPriceChangeNotifiedParams) error {
+	_, err := q.db.ExecContext(ctx, updateLevelPriceChangeNotified, arg.MembersNotified, arg.ID)
+	return err
+}
+
+const updateManualPayment = `-- name: UpdateManualPayment :one
+UPDATE payments SET
+    user_id = ?,
+    project_id = ?,
+    date = ?,
+    amount = ?,
+    local_account = ?,
+    identification = ?,
+    staff_comment = ?
+WHERE id = ? AND kind = 'manual' AND voided_at IS NULL
+RETURNING id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at
+`
+
+type UpdateManualPaymentParams struct {
+	UserID         sql.NullInt64  `json:"user_id"`
+	ProjectID      sql.NullInt64  `json:"project_id"`
+	Date           time.Time      `json:"date"`
+	Amount         money.Amount   `json:"amount"`
+	LocalAccount   string         `json:"local_account"`
+	Identification string         `json:"identification"`
+	StaffComment   sql.NullString `json:"staff_comment"`
+	ID             int64          `json:"id"`
+}
+
+func (q *Queries) UpdateManualPayment(ctx context.Context, arg UpdateManualPaymentParams) (Payment, error) {
+	row := q.db.QueryRowContext(ctx, updateManualPayment,
+		arg.UserID,
+		arg.ProjectID,
+		arg.Date,
+		arg.Amount,
+		arg.LocalAccount,
+		arg.Identification,
+		arg.StaffComment,
+		arg.ID,
+	)
+	var i Payment
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Date,
+		&i.Amount,
+		&i.Kind,
+		&i.KindID,
+		&i.LocalAccount,
+		&i.RemoteAccount,
+		&i.Identification,
+		&i.RawData,
+		&i.StaffComment,
+		&i.CreatedAt,
+		&i.ProjectID,
+		&i.RecordedBy,
+		&i.VoidedAt,
+	)
+	return i, err
+}
+
 const updateProject = `-- name: UpdateProject :one
 UPDATE projects SET
     name = ?,
@@ -1525,8 +3628,9 @@ UPDATE users SET
     is_staff = ?,
     keys_granted = ?,
     keys_returned = ?,
-    updated_at = CURRENT_TIMESTAMP
+    updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
 WHERE id = ?
+  AND julianday(updated_at) = julianday(CAST(? AS TEXT))
 RETURNING id, keycloak_id, email, username, realname, phone, alt_contact, level_id, level_actual_amount, payments_id, date_joined, keys_granted, keys_returned, state, is_council, is_staff, created_at, updated_at
 `
 
@@ -1537,7 +3641,7 @@ type UpdateUserParams struct {
 	Phone             sql.NullString `json:"phone"`
 	AltContact        sql.NullString `json:"alt_contact"`
 	LevelID           int64          `json:"level_id"`
-	LevelActualAmount string         `json:"level_actual_amount"`
+	LevelActualAmount money.Amount   `json:"level_actual_amount"`
 	PaymentsID        sql.NullString `json:"payments_id"`
 	State             string         `json:"state"`
 	IsCouncil         bool           `json:"is_council"`
@@ -1545,6 +3649,7 @@ type UpdateUserParams struct {
 	KeysGranted       sql.NullTime   `json:"keys_granted"`
 	KeysReturned      sql.NullTime   `json:"keys_returned"`
 	ID                int64          `json:"id"`
+	ExpectedUpdatedAt string         `json:"expected_updated_at"`
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
@@ -1563,6 +3668,7 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		arg.KeysGranted,
 		arg.KeysReturned,
 		arg.ID,
+		arg.ExpectedUpdatedAt,
 	)
 	var i User
 	err := row.Scan(
@@ -1588,21 +3694,16 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 	return i, err
 }
 
-const updateUserCustomFee = `-- name: UpdateUserCustomFee :one
+const updateUserDateJoined = `-- name: UpdateUserDateJoined :one
 UPDATE users SET
-    level_actual_amount = ?,
-    updated_at = CURRENT_TIMESTAMP
+    date_joined = CURRENT_TIMESTAMP
 WHERE id = ?
 RETURNING id, keycloak_id, email, username, realname, phone, alt_contact, level_id, level_actual_amount, payments_id, date_joined, keys_granted, keys_returned, state, is_council, is_staff, created_at, updated_at
 `
 
-type UpdateUserCustomFeeParams struct {
-	LevelActualAmount string `json:"level_actual_amount"`
-	ID                int64  `json:"id"`
-}
-
-func (q *Queries) UpdateUserCustomFee(ctx context.Context, arg UpdateUserCustomFeeParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUserCustomFee, arg.LevelActualAmount, arg.ID)
+// Membership starts when the application is approved, not at the first login
+func (q *Queries) UpdateUserDateJoined(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserDateJoined, id)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -1666,6 +3767,48 @@ func (q *Queries) UpdateUserKeycloakInfo(ctx context.Context, arg UpdateUserKeyc
 	return i, err
 }
 
+const updateUserLevel = `-- name: UpdateUserLevel :one
+UPDATE users SET
+    level_id = ?,
+    level_actual_amount = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, keycloak_id, email, username, realname, phone, alt_contact, level_id, level_actual_amount, payments_id, date_joined, keys_granted, keys_returned, state, is_council, is_staff, created_at, updated_at
+`
+
+type UpdateUserLevelParams struct {
+	LevelID           int64        `json:"level_id"`
+	LevelActualAmount money.Amount `json:"level_actual_amount"`
+	ID                int64        `json:"id"`
+}
+
+// Applies a level change from the level history once it takes effect
+func (q *Queries) UpdateUserLevel(ctx context.Context, arg UpdateUserLevelParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserLevel, arg.LevelID, arg.LevelActualAmount, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.KeycloakID,
+		&i.Email,
+		&i.Username,
+		&i.Realname,
+		&i.Phone,
+		&i.AltContact,
+		&i.LevelID,
+		&i.LevelActualAmount,
+		&i.PaymentsID,
+		&i.DateJoined,
+		&i.KeysGranted,
+		&i.KeysReturned,
+		&i.State,
+		&i.IsCouncil,
+		&i.IsStaff,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const updateUserProfile = `-- name: UpdateUserProfile :one
 UPDATE users SET
     realname = ?,
@@ -1729,14 +3872,14 @@ ON CONFLICT(kind, kind_id) DO UPDATE SET
     identification = excluded.identification,
     raw_data = excluded.raw_data,
     staff_comment = excluded.staff_comment
-RETURNING id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id
+RETURNING id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at
 `
 
 type UpsertPaymentParams struct {
 	UserID         sql.NullInt64  `json:"user_id"`
 	ProjectID      sql.NullInt64  `json:"project_id"`
 	Date           time.Time      `json:"date"`
-	Amount         string         `json:"amount"`
+	Amount         money.Amount   `json:"amount"`
 	Kind           string         `json:"kind"`
 	KindID         string         `json:"kind_id"`
 	LocalAccount   string         `json:"local_account"`
@@ -1775,6 +3918,44 @@ func (q *Queries) UpsertPayment(ctx context.Context, arg UpsertPaymentParams) (P
 		&i.StaffComment,
 		&i.CreatedAt,
 		&i.ProjectID,
+		&i.RecordedBy,
+		&i.VoidedAt,
+	)
+	return i, err
+}
+
+const voidManualPayment = `-- name: VoidManualPayment :one
+UPDATE payments SET
+    voided_at = CURRENT_TIMESTAMP,
+    staff_comment = ?
+WHERE id = ? AND kind = 'manual' AND voided_at IS NULL
+RETURNING id, user_id, date, amount, kind, kind_id, local_account, remote_account, identification, raw_data, staff_comment, created_at, project_id, recorded_by, voided_at
+`
+
+type VoidManualPaymentParams struct {
+	StaffComment sql.NullString `json:"staff_comment"`
+	ID           int64          `json:"id"`
+}
+
+func (q *Queries) VoidManualPayment(ctx context.Context, arg VoidManualPaymentParams) (Payment, error) {
+	row := q.db.QueryRowContext(ctx, voidManualPayment, arg.StaffComment, arg.ID)
+	var i Payment
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Date,
+		&i.Amount,
+		&i.Kind,
+		&i.KindID,
+		&i.LocalAccount,
+		&i.RemoteAccount,
+		&i.Identification,
+		&i.RawData,
+		&i.StaffComment,
+		&i.CreatedAt,
+		&i.ProjectID,
+		&i.RecordedBy,
+		&i.VoidedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// InTx runs fn with queries bound to a transaction, committed when fn returns
+// nil and rolled back otherwise. Queries that are already bound to a
+// transaction run fn in it, so functions that need a transaction can call
+// each other. fn must use only the queries it gets: SQLite allows one writer,
+// and a write through other queries waits for this transaction.
+func (q *Queries) InTx(ctx context.Context, fn func(*Queries) error) error {
+	database, ok := q.db.(*sql.DB)
+	if !ok {
+		return fn(q)
+	}
+
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(q.WithTx(tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
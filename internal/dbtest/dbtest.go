@@ -0,0 +1,46 @@
+// Package dbtest provides migrated SQLite databases for tests.
+//
+// Usage:
+//
+//	queries := dbtest.New(t)
+//
+// or, when the test needs transactions or the raw connection:
+//
+//	database := dbtest.Open(t)
+//	queries := db.New(database)
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/migrate"
+)
+
+// Open returns a database in a temporary directory with all migrations
+// applied. It is closed when the test ends.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+
+	database, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if _, err := migrate.Up(context.Background(), database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return database
+}
+
+// New returns queries on a database from Open
+func New(t testing.TB) *db.Queries {
+	t.Helper()
+	return db.New(Open(t))
+}
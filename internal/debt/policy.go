@@ -0,0 +1,229 @@
+// Package debt decides who counts as a member in debt. The policy sets a
+// threshold, in Kč or in months of the member's fee, and a grace period after
+// a fee is created during which the fee does not count yet. Exempted members
+// (e.g. honorary members) never count. The in_debt role job and the preview
+// in /admin/debt evaluate members the same way.
+package debt
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/dates"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// Threshold is the smallest debt that counts
+type Threshold struct {
+	Amount money.Amount // Debt in Kč, used when Months is zero
+	Months float64      // Debt in months of the member's fee
+}
+
+// ParseThreshold parses a threshold in Kč ("500", "500 Kč") or in months of
+// the fee ("1.5m", "1,5m"). "0" or empty means any debt counts.
+func ParseThreshold(s string) (Threshold, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Threshold{}, nil
+	}
+	if months, ok := strings.CutSuffix(s, "m"); ok {
+		n, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(months), ",", ".", 1), 64)
+		if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+			return Threshold{}, fmt.Errorf("invalid threshold %q: expected months like 1.5m", s)
+		}
+		return Threshold{Months: n}, nil
+	}
+	amount, err := money.Parse(s)
+	if err != nil {
+		return Threshold{}, fmt.Errorf("invalid threshold %q: %w", s, err)
+	}
+	if amount.IsNegative() {
+		return Threshold{}, fmt.Errorf("invalid threshold %q: cannot be negative", s)
+	}
+	return Threshold{Amount: amount}, nil
+}
+
+// For returns the threshold of a member with the monthly fee. A threshold in
+// months of a zero fee (e.g. a member awaiting a level) is any debt.
+func (t Threshold) For(fee money.Amount) money.Amount {
+	if t.Months > 0 {
+		return fee.MulRatio(int64(math.Round(t.Months*100)), 100)
+	}
+	return t.Amount
+}
+
+// String returns the threshold as ParseThreshold accepts it, e.g. "1.5m"
+func (t Threshold) String() string {
+	if t.Months > 0 {
+		return strconv.FormatFloat(t.Months, 'f', -1, 64) + "m"
+	}
+	return t.Amount.String()
+}
+
+// Label describes the threshold in Czech, e.g. "1,5 měsíčního příspěvku"
+func (t Threshold) Label() string {
+	switch {
+	case t.Months > 0:
+		return strings.Replace(strconv.FormatFloat(t.Months, 'f', -1, 64), ".", ",", 1) + " měsíčního příspěvku"
+	case t.Amount.IsZero():
+		return "jakýkoli dluh"
+	default:
+		return t.Amount.Format()
+	}
+}
+
+// Policy decides who counts as a member in debt
+type Policy struct {
+	Threshold Threshold
+	GraceDays int // Days after a fee is created before it counts
+}
+
+// PolicyFromConfig returns the policy of DEBT_THRESHOLD and DEBT_GRACE_DAYS
+func PolicyFromConfig(cfg *config.Config) (Policy, error) {
+	threshold, err := ParseThreshold(cfg.DebtThreshold)
+	if err != nil {
+		return Policy{}, fmt.Errorf("DEBT_THRESHOLD: %w", err)
+	}
+	if cfg.DebtGraceDays < 0 {
+		return Policy{}, fmt.Errorf("DEBT_GRACE_DAYS cannot be negative")
+	}
+	return Policy{Threshold: threshold, GraceDays: cfg.DebtGraceDays}, nil
+}
+
+// Member is what the policy needs to know about a member
+type Member struct {
+	User       db.User
+	Balance    money.Amount      // Payments minus fees
+	InGrace    money.Amount      // Fees created within the grace period
+	MonthlyFee money.Amount      // Fee the member pays now
+	Exemption  *db.DebtExemption // Exemption in effect, if any
+}
+
+// Status is a member evaluated by the policy
+type Status struct {
+	Member
+	Due       money.Amount // Balance without the fees in the grace period
+	Threshold money.Amount // Smallest debt that counts for the member
+	InDebt    bool
+	Reason    string // Why the member is or is not in debt, for the logs
+}
+
+// Evaluate decides whether the member is in debt: not exempt and owing at
+// least the threshold, not counting the fees in the grace period
+func (p Policy) Evaluate(m Member) Status {
+	s := Status{
+		Member:    m,
+		Due:       m.Balance + m.InGrace,
+		Threshold: p.Threshold.For(m.MonthlyFee),
+	}
+
+	s.Reason = "balance " + m.Balance.Format()
+	if s.Due != m.Balance {
+		s.Reason += ", due " + s.Due.Format()
+	}
+
+	switch {
+	case m.Exemption != nil:
+		s.Reason = "exempt: " + m.Exemption.Reason
+	case !s.Due.IsNegative():
+	case s.Due.Abs() < s.Threshold:
+		s.Reason += ", below " + s.Threshold.Format()
+	default:
+		s.InDebt = true
+	}
+	return s
+}
+
+// Active reports whether the exemption is in effect on the day
+func Active(e db.DebtExemption, now time.Time) bool {
+	if !e.ValidUntil.Valid {
+		return true
+	}
+	return !e.ValidUntil.Time.Before(dates.Day(now))
+}
+
+// Exemptions returns the exemptions in effect on the day by user ID
+func Exemptions(ctx context.Context, queries *db.Queries, now time.Time) (map[int64]db.DebtExemption, error) {
+	all, err := queries.ListDebtExemptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list debt exemptions: %w", err)
+	}
+	active := make(map[int64]db.DebtExemption)
+	for _, e := range all {
+		if _, ok := active[e.UserID]; !ok && Active(e, now) {
+			active[e.UserID] = e
+		}
+	}
+	return active, nil
+}
+
+// Load evaluates all users by the policy, in the order of ListUsers
+func Load(ctx context.Context, queries *db.Queries, p Policy, now time.Time) ([]Status, error) {
+	users, err := queries.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	balanceRows, err := queries.ListUserBalances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute balances: %w", err)
+	}
+	balances := make(map[int64]money.Amount, len(balanceRows))
+	for _, b := range balanceRows {
+		balances[b.UserID] = money.FromHalere(b.Balance)
+	}
+
+	inGrace := make(map[int64]money.Amount)
+	if p.GraceDays > 0 {
+		since := now.UTC().AddDate(0, 0, -p.GraceDays)
+		fees, err := queries.ListFeesCreatedSince(ctx, since.Format("2006-01-02 15:04:05"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list recent fees: %w", err)
+		}
+		for _, f := range fees {
+			inGrace[f.UserID] += f.Amount
+		}
+	}
+
+	exemptions, err := Exemptions(ctx, queries, now)
+	if err != nil {
+		return nil, err
+	}
+
+	levels, err := queries.ListLevels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list levels: %w", err)
+	}
+	changes, err := queries.ListLevelPriceChanges(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list price changes: %w", err)
+	}
+	prices := make(map[int64]money.Amount, len(levels))
+	for _, l := range levels {
+		prices[l.ID] = membership.PriceOn(l, changes, now)
+	}
+
+	statuses := make([]Status, 0, len(users))
+	for _, user := range users {
+		m := Member{
+			User:       user,
+			Balance:    balances[user.ID],
+			InGrace:    inGrace[user.ID],
+			MonthlyFee: user.LevelActualAmount,
+		}
+		if m.MonthlyFee.IsZero() {
+			m.MonthlyFee = prices[user.LevelID]
+		}
+		if e, ok := exemptions[user.ID]; ok {
+			m.Exemption = &e
+		}
+		statuses = append(statuses, p.Evaluate(m))
+	}
+	return statuses, nil
+}
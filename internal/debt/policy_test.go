@@ -0,0 +1,176 @@
+package debt
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  Threshold
+		label string
+	}{
+		{"", Threshold{}, "jakýkoli dluh"},
+		{"0", Threshold{}, "jakýkoli dluh"},
+		{"500", Threshold{Amount: money.FromKoruny(500)}, money.FromKoruny(500).Format()},
+		{"1 500 Kč", Threshold{Amount: money.FromKoruny(1500)}, money.FromKoruny(1500).Format()},
+		{"1.5m", Threshold{Months: 1.5}, "1,5 měsíčního příspěvku"},
+		{"2m", Threshold{Months: 2}, "2 měsíčního příspěvku"},
+		{"0,5m", Threshold{Months: 0.5}, "0,5 měsíčního příspěvku"},
+	}
+	for _, tt := range tests {
+		got, err := ParseThreshold(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseThreshold(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+			continue
+		}
+		if got.Label() != tt.label {
+			t.Errorf("%q label %q, want %q", tt.in, got.Label(), tt.label)
+		}
+		if again, _ := ParseThreshold(got.String()); again != got {
+			t.Errorf("%q does not round-trip: %q", tt.in, got.String())
+		}
+	}
+
+	for _, in := range []string{"-100", "abc", "-1m", "m", "1.5x"} {
+		if _, err := ParseThreshold(in); err == nil {
+			t.Errorf("ParseThreshold(%q) accepted", in)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	fee := money.FromKoruny(1000)
+	honorary := &db.DebtExemption{Reason: "Čestný člen"}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		member Member
+		want   bool
+		reason string
+	}{
+		{"any debt", Policy{}, Member{Balance: money.FromKoruny(-1)}, true,
+			"balance " + money.FromKoruny(-1).Format()},
+		{"paid up", Policy{}, Member{Balance: money.Zero}, false,
+			"balance " + money.Zero.Format()},
+		{"below amount", Policy{Threshold: Threshold{Amount: money.FromKoruny(500)}}, Member{Balance: money.FromKoruny(-499)}, false,
+			"balance " + money.FromKoruny(-499).Format() + ", below " + money.FromKoruny(500).Format()},
+		{"at amount", Policy{Threshold: Threshold{Amount: money.FromKoruny(500)}}, Member{Balance: money.FromKoruny(-500)}, true,
+			"balance " + money.FromKoruny(-500).Format()},
+		{"below months", Policy{Threshold: Threshold{Months: 1.5}}, Member{Balance: money.FromKoruny(-1499), MonthlyFee: fee}, false,
+			"balance " + money.FromKoruny(-1499).Format() + ", below " + money.FromKoruny(1500).Format()},
+		{"months of own fee", Policy{Threshold: Threshold{Months: 1.5}}, Member{Balance: money.FromKoruny(-1500), MonthlyFee: fee}, true,
+			"balance " + money.FromKoruny(-1500).Format()},
+		{"fee in grace", Policy{GraceDays: 14}, Member{Balance: money.FromKoruny(-1000), InGrace: fee}, false,
+			"balance " + money.FromKoruny(-1000).Format() + ", due " + money.Zero.Format()},
+		{"older debt", Policy{GraceDays: 14}, Member{Balance: money.FromKoruny(-2000), InGrace: fee}, true,
+			"balance " + money.FromKoruny(-2000).Format() + ", due " + money.FromKoruny(-1000).Format()},
+		{"exempt", Policy{}, Member{Balance: money.FromKoruny(-5000), Exemption: honorary}, false,
+			"exempt: Čestný člen"},
+	}
+	for _, tt := range tests {
+		s := tt.policy.Evaluate(tt.member)
+		if s.InDebt != tt.want || s.Reason != tt.reason {
+			t.Errorf("%s: in debt %v (%q), want %v (%q)", tt.name, s.InDebt, s.Reason, tt.want, tt.reason)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	member := func(email string, fee money.Amount, debt ...money.Amount) db.User {
+		t.Helper()
+		user, err := queries.CreateUser(ctx, db.CreateUserParams{
+			Email:             email,
+			LevelID:           3, // 1000
+			LevelActualAmount: fee,
+			State:             membership.StateAccepted,
+		})
+		if err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		for i, amount := range debt {
+			if _, err := queries.CreateFee(ctx, db.CreateFeeParams{
+				UserID:      user.ID,
+				LevelID:     3,
+				PeriodStart: time.Date(2026, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC),
+				Amount:      amount,
+			}); err != nil {
+				t.Fatalf("create fee: %v", err)
+			}
+		}
+		return user
+	}
+
+	levelPrice := member("a@example.com", money.Zero, money.FromKoruny(1000), money.FromKoruny(1000))
+	generous := member("b@example.com", money.FromKoruny(2000), money.FromKoruny(1000), money.FromKoruny(1000))
+	honorary := member("c@example.com", money.Zero, money.FromKoruny(1000), money.FromKoruny(1000))
+	expired := member("d@example.com", money.Zero, money.FromKoruny(1000), money.FromKoruny(1000))
+
+	yesterday := sql.NullTime{Time: now.AddDate(0, 0, -1), Valid: true}
+	for _, e := range []db.CreateDebtExemptionParams{
+		{UserID: honorary.ID, Reason: "Čestný člen"},
+		{UserID: expired.ID, Reason: "Splátkový kalendář", ValidUntil: yesterday},
+	} {
+		if _, err := queries.CreateDebtExemption(ctx, e); err != nil {
+			t.Fatalf("create exemption: %v", err)
+		}
+	}
+
+	byID := func(statuses []Status) map[int64]Status {
+		m := make(map[int64]Status)
+		for _, s := range statuses {
+			m[s.User.ID] = s
+		}
+		return m
+	}
+
+	// Two months of the fee: 2000 Kč of debt counts on the level price, not on
+	// a 2000 Kč fee
+	statuses, err := Load(ctx, queries, Policy{Threshold: Threshold{Months: 2}}, now)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	got := byID(statuses)
+	if s := got[levelPrice.ID]; !s.InDebt || s.MonthlyFee != money.FromKoruny(1000) {
+		t.Errorf("level price member: %+v", s)
+	}
+	if s := got[generous.ID]; s.InDebt || s.Threshold != money.FromKoruny(4000) {
+		t.Errorf("generous member: %+v", s)
+	}
+	if s := got[honorary.ID]; s.InDebt || s.Exemption == nil {
+		t.Errorf("exempted member: %+v", s)
+	}
+	if s := got[expired.ID]; !s.InDebt || s.Exemption != nil {
+		t.Errorf("member with an expired exemption: %+v", s)
+	}
+
+	// All the fees were just created, within the grace period
+	statuses, err = Load(ctx, queries, Policy{GraceDays: 7}, now)
+	if err != nil {
+		t.Fatalf("Load with grace: %v", err)
+	}
+	for _, s := range statuses {
+		if s.InDebt || !s.Due.IsZero() {
+			t.Errorf("%s in grace: %+v", s.User.Email, s)
+		}
+	}
+
+	// Once the grace period is over, they count
+	statuses, _ = Load(ctx, queries, Policy{GraceDays: 7}, now.AddDate(0, 0, 8))
+	if s := byID(statuses)[levelPrice.ID]; !s.InDebt || s.Due != money.FromKoruny(-2000) {
+		t.Errorf("after the grace period: %+v", s)
+	}
+}
@@ -0,0 +1,149 @@
+// Package dunning escalates the reminders to members in debt: a friendly
+// reminder once they are in debt under the debt policy, a warning and a final
+// notice as the debt grows, and the suspension of the membership some days
+// after the final notice. Every notice is recorded in dunning_notices, each
+// stage is sent once per case, notices to a member are at least a cooldown
+// apart and the case is closed once the member is no longer in debt.
+package dunning
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/dates"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/debt"
+	"github.com/base48/member-portal/internal/membership"
+)
+
+// Stages of a case
+const (
+	StageReminder    = "reminder"     // Friendly reminder (negative_balance.html)
+	StageWarning     = "warning"      // Debt warning (debt_warning.html)
+	StageFinalNotice = "final_notice" // Last notice before the suspension (debt_final_notice.html)
+	StageSuspension  = "suspension"   // Membership suspended (membership_suspended.html)
+)
+
+// Stages in the order of escalation
+var Stages = []string{StageReminder, StageWarning, StageFinalNotice, StageSuspension}
+
+var stageLabels = map[string]string{
+	StageReminder:    "Připomínka",
+	StageWarning:     "Varování",
+	StageFinalNotice: "Poslední výzva",
+	StageSuspension:  "Pozastavení",
+}
+
+// StageLabel returns the Czech name of the stage
+func StageLabel(stage string) string {
+	if label, ok := stageLabels[stage]; ok {
+		return label
+	}
+	return stage
+}
+
+// stageIndex returns the position of the stage in Stages, -1 if unknown
+func stageIndex(stage string) int {
+	for i, s := range Stages {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+// Settings are the escalation rules
+type Settings struct {
+	Warning      debt.Threshold // Debt of the warning
+	Final        debt.Threshold // Debt of the final notice
+	CooldownDays int            // Days between two notices to a member
+	SuspendDays  int            // Days after the final notice to suspend, 0 never
+}
+
+// SettingsFromConfig returns the rules of DUNNING_WARNING, DUNNING_FINAL,
+// DUNNING_COOLDOWN_DAYS and DUNNING_SUSPEND_DAYS
+func SettingsFromConfig(cfg *config.Config) (Settings, error) {
+	warning, err := debt.ParseThreshold(cfg.DunningWarning)
+	if err != nil {
+		return Settings{}, fmt.Errorf("DUNNING_WARNING: %w", err)
+	}
+	final, err := debt.ParseThreshold(cfg.DunningFinal)
+	if err != nil {
+		return Settings{}, fmt.Errorf("DUNNING_FINAL: %w", err)
+	}
+	if cfg.DunningCooldownDays < 0 || cfg.DunningSuspendDays < 0 {
+		return Settings{}, fmt.Errorf("DUNNING_COOLDOWN_DAYS and DUNNING_SUSPEND_DAYS cannot be negative")
+	}
+	return Settings{
+		Warning:      warning,
+		Final:        final,
+		CooldownDays: cfg.DunningCooldownDays,
+		SuspendDays:  cfg.DunningSuspendDays,
+	}, nil
+}
+
+// SuspendOn returns the day a member given the final notice on the day is
+// suspended, zero when the suspension stage is off
+func (s Settings) SuspendOn(finalNotice time.Time) time.Time {
+	if s.SuspendDays <= 0 {
+		return time.Time{}
+	}
+	return dates.Day(finalNotice).AddDate(0, 0, s.SuspendDays)
+}
+
+// Action is the next step of a member's case
+type Action struct {
+	Stage   string // Notice to send, empty when closing the case
+	Resolve bool   // Close the open case, the member is no longer in debt
+}
+
+// Next decides the next step of the member's case; open are the notices of
+// the open case, oldest first. A member no longer in debt (paid, exempted)
+// gets the case closed. An accepted member in debt escalates one stage at a
+// time: the reminder right away, the warning and the final notice once the
+// debt reaches their threshold and the cooldown since the last notice has
+// passed, the suspension SuspendDays after the final notice if the debt is
+// still at the final notice threshold.
+func (s Settings) Next(status debt.Status, open []db.DunningNotice, now time.Time) (Action, bool) {
+	if !status.InDebt {
+		return Action{Resolve: true}, len(open) > 0
+	}
+	if status.User.State != membership.StateAccepted {
+		return Action{}, false
+	}
+
+	next := 0
+	var last db.DunningNotice
+	if len(open) > 0 {
+		last = open[len(open)-1]
+		next = stageIndex(last.Stage) + 1
+		if next <= 0 || next >= len(Stages) {
+			return Action{}, false
+		}
+	}
+
+	owed := status.Due.Neg()
+	stage := Stages[next]
+	switch stage {
+	case StageWarning:
+		if owed < s.Warning.For(status.MonthlyFee) {
+			return Action{}, false
+		}
+	case StageFinalNotice:
+		if owed < s.Final.For(status.MonthlyFee) {
+			return Action{}, false
+		}
+	case StageSuspension:
+		suspendOn := s.SuspendOn(last.SentAt)
+		if suspendOn.IsZero() || dates.Day(now).Before(suspendOn) || owed < s.Final.For(status.MonthlyFee) {
+			return Action{}, false
+		}
+		return Action{Stage: stage}, true
+	}
+
+	if len(open) > 0 && dates.Day(now).Before(dates.Day(last.SentAt).AddDate(0, 0, s.CooldownDays)) {
+		return Action{}, false
+	}
+	return Action{Stage: stage}, true
+}
@@ -0,0 +1,91 @@
+package dunning
+
+import (
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/debt"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestNext(t *testing.T) {
+	settings := Settings{
+		Warning:      debt.Threshold{Months: 2},
+		Final:        debt.Threshold{Months: 3},
+		CooldownDays: 14,
+		SuspendDays:  30,
+	}
+	now := time.Date(2026, 3, 20, 10, 0, 0, 0, time.UTC)
+	fee := money.FromKoruny(1000)
+
+	status := func(state string, owed int64) debt.Status {
+		balance := money.FromKoruny(-owed)
+		return debt.Status{
+			Member: debt.Member{
+				User:       db.User{State: state},
+				Balance:    balance,
+				MonthlyFee: fee,
+			},
+			Due:    balance,
+			InDebt: owed > 0,
+		}
+	}
+	accepted := func(owed int64) debt.Status { return status(membership.StateAccepted, owed) }
+	notice := func(stage string, daysAgo int) db.DunningNotice {
+		return db.DunningNotice{Stage: stage, SentAt: now.AddDate(0, 0, -daysAgo)}
+	}
+	reminded := []db.DunningNotice{notice(StageReminder, 20)}
+	warned := []db.DunningNotice{notice(StageReminder, 60), notice(StageWarning, 20)}
+	finalNotice := func(daysAgo int) []db.DunningNotice {
+		return []db.DunningNotice{notice(StageReminder, 90), notice(StageWarning, 60), notice(StageFinalNotice, daysAgo)}
+	}
+
+	tests := []struct {
+		name     string
+		settings Settings
+		status   debt.Status
+		open     []db.DunningNotice
+		want     Action
+		ok       bool
+	}{
+		{"paid up", settings, accepted(0), nil, Action{}, false},
+		{"new debt", settings, accepted(100), nil, Action{Stage: StageReminder}, true},
+		{"not accepted", settings, status(membership.StateAwaiting, 3000), nil, Action{}, false},
+		{"already suspended", settings, status(membership.StateSuspended, 5000), finalNotice(40), Action{}, false},
+		{"below warning", settings, accepted(1999), reminded, Action{}, false},
+		{"warning", settings, accepted(2000), reminded, Action{Stage: StageWarning}, true},
+		{"warning in cooldown", settings, accepted(2000), []db.DunningNotice{notice(StageReminder, 13)}, Action{}, false},
+		{"warning after cooldown", settings, accepted(2000), []db.DunningNotice{notice(StageReminder, 14)}, Action{Stage: StageWarning}, true},
+		{"below final", settings, accepted(2999), warned, Action{}, false},
+		{"final notice", settings, accepted(3000), warned, Action{Stage: StageFinalNotice}, true},
+		{"one stage at a time", settings, accepted(5000), reminded, Action{Stage: StageWarning}, true},
+		{"before suspension", settings, accepted(3000), finalNotice(29), Action{}, false},
+		{"suspension", settings, accepted(3000), finalNotice(30), Action{Stage: StageSuspension}, true},
+		{"partly paid", settings, accepted(2500), finalNotice(30), Action{}, false},
+		{"suspension off", Settings{Warning: settings.Warning, Final: settings.Final, CooldownDays: 14}, accepted(5000), finalNotice(90), Action{}, false},
+		{"paid after reminder", settings, accepted(0), reminded, Action{Resolve: true}, true},
+		{"exempted", settings, debt.Status{Member: debt.Member{User: db.User{State: membership.StateAccepted}, Balance: money.FromKoruny(-5000)}}, warned, Action{Resolve: true}, true},
+	}
+	for _, tt := range tests {
+		got, ok := tt.settings.Next(tt.status, tt.open, now)
+		if ok != tt.ok {
+			t.Errorf("%s: ok %v, want %v (%+v)", tt.name, ok, tt.ok, got)
+			continue
+		}
+		if tt.want != (Action{}) && got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSuspendOn(t *testing.T) {
+	sent := time.Date(2026, 1, 20, 18, 30, 0, 0, time.UTC)
+	if got := (Settings{SuspendDays: 14}).SuspendOn(sent); !got.Equal(time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("SuspendOn = %v", got)
+	}
+	if got := (Settings{}).SuspendOn(sent); !got.IsZero() {
+		t.Errorf("SuspendOn with the stage off = %v, want zero", got)
+	}
+}
@@ -4,107 +4,197 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
+	"io/fs"
 	"log"
-	"net/smtp"
+	"os"
 	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
 
 	"github.com/base48/member-portal/internal/config"
 	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
 )
 
-// Client handles email sending with templates and logging
+// Client handles email sending with templates and logging. Emails are
+// queued in email_outbox and delivered through the transport by the outbox
+// worker (see outbox.go).
 type Client struct {
-	config  *config.Config
-	queries *db.Queries
+	config    *config.Config
+	queries   *db.Queries
+	transport Transport // nil when emails are disabled
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithTransport delivers the emails through t instead of the transport from
+// the config (e.g. a MemoryTransport in tests)
+func WithTransport(t Transport) Option {
+	return func(c *Client) {
+		c.transport = t
+	}
 }
 
 // SendParams contains parameters for sending a templated email
 type SendParams struct {
-	UserID       sql.NullInt64
-	Recipient    string
-	Subject      string
-	TemplateName string
-	Data         interface{}
+	UserID          sql.NullInt64
+	Recipient       string
+	Subject         string // Overrides the subject of the template
+	TemplateName    string
+	Data            interface{}
+	ReplyTo         string       // Overrides EMAIL_REPLY_TO
+	ListUnsubscribe string       // Unsubscribe URL, set for bulk mail only
+	Attachments     []Attachment // E.g. a statement or a receipt
+	NotBefore       time.Time    // Delivered from this time, e.g. to spread bulk mail (zero: now)
+}
+
+// New creates a new email client with the transport selected by
+// EMAIL_TRANSPORT (see NewTransport)
+func New(cfg *config.Config, queries *db.Queries, opts ...Option) *Client {
+	c := &Client{
+		config:    cfg,
+		queries:   queries,
+		transport: NewTransport(cfg),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Enabled reports whether emails are sent, i.e. there is a transport
+func (c *Client) Enabled() bool {
+	return c.transport != nil
 }
 
-// New creates a new email client
-func New(cfg *config.Config, queries *db.Queries) *Client {
-	return &Client{
-		config:  cfg,
-		queries: queries,
+// TransportName returns the name of the transport for the admin pages
+func (c *Client) TransportName() string {
+	switch c.transport.(type) {
+	case nil:
+		return TransportNone
+	case *SMTPTransport:
+		return TransportSMTP
+	case *MaildirTransport:
+		return TransportMaildir
+	case *MemoryTransport:
+		return "memory"
+	default:
+		return fmt.Sprintf("%T", c.transport)
 	}
 }
 
-// SendTemplated sends an email using an HTML template
+// SendTemplated renders an email from a template (see Render) and queues it
+// in the outbox. It fails only when the email cannot be rendered or queued,
+// the delivery (with retries) is up to the outbox worker.
 // This is the main DRY method - all other methods use this internally
 func (c *Client) SendTemplated(ctx context.Context, params SendParams) error {
-	// Skip if SMTP not configured
-	if c.config.SMTPHost == "" {
-		log.Printf("[Email] SMTP not configured, skipping email to %s (template: %s)", params.Recipient, params.TemplateName)
+	// Skip if there is no transport (SMTP not configured)
+	if !c.Enabled() {
+		log.Printf("[Email] Emails disabled, skipping email to %s (template: %s)", params.Recipient, params.TemplateName)
 		return nil
 	}
 
-	// Load and parse template
-	templatePath := filepath.Join("web/templates/email", params.TemplateName)
-	tmpl, err := template.ParseFiles(templatePath)
+	tmpl, ok := LookupTemplate(params.TemplateName)
+	if !ok {
+		return c.logEmail(ctx, params, fmt.Errorf("unknown template %s", params.TemplateName))
+	}
+	if params.Subject != "" {
+		tmpl.Subject = params.Subject
+	}
+	rendered, err := c.Render(ctx, tmpl, params.Data)
 	if err != nil {
-		return c.logEmail(ctx, params, fmt.Errorf("template parse error: %w", err))
+		return c.logEmail(ctx, params, fmt.Errorf("template error: %w", err))
+	}
+	if params.Subject == "" { // The sender's subject wins over an edited one
+		params.Subject = rendered.Subject
 	}
 
-	// Execute template
-	var body bytes.Buffer
-	if err := tmpl.Execute(&body, params.Data); err != nil {
-		return c.logEmail(ctx, params, fmt.Errorf("template execution error: %w", err))
+	notBefore := time.Now()
+	if params.NotBefore.After(notBefore) {
+		notBefore = params.NotBefore
 	}
 
-	// Prepare email message
-	message := c.formatMessage(params.Recipient, params.Subject, body.String())
+	replyTo := params.ReplyTo
+	if replyTo == "" {
+		replyTo = c.config.EmailReplyTo
+	}
 
-	// Send email
-	auth := smtp.PlainAuth("", c.config.SMTPUsername, c.config.SMTPPassword, c.config.SMTPHost)
-	addr := fmt.Sprintf("%s:%d", c.config.SMTPHost, c.config.SMTPPort)
+	var attachments sql.NullString
+	if len(params.Attachments) > 0 {
+		encoded, err := json.Marshal(params.Attachments)
+		if err != nil {
+			return c.logEmail(ctx, params, fmt.Errorf("attachment encoding error: %w", err))
+		}
+		attachments = sql.NullString{String: string(encoded), Valid: true}
+	}
 
-	err = smtp.SendMail(
-		addr,
-		auth,
-		c.config.SMTPFrom,
-		[]string{params.Recipient},
-		[]byte(message),
-	)
+	// Queue for the worker
+	queued, err := c.queries.EnqueueEmail(ctx, db.EnqueueEmailParams{
+		UserID:          params.UserID,
+		Recipient:       params.Recipient,
+		Subject:         params.Subject,
+		Template:        params.TemplateName,
+		Body:            rendered.HTML,
+		TextBody:        rendered.Text,
+		ReplyTo:         sql.NullString{String: replyTo, Valid: replyTo != ""},
+		ListUnsubscribe: sql.NullString{String: params.ListUnsubscribe, Valid: params.ListUnsubscribe != ""},
+		MessageID:       NewMessageID(c.config.SMTPFrom),
+		Attachments:     attachments,
+		MaxAttempts:     int64(max(c.config.EmailMaxAttempts, 1)),
+		NextAttemptAt:   outboxTime(notBefore),
+	})
+	if err != nil {
+		return c.logEmail(ctx, params, fmt.Errorf("failed to queue email: %w", err))
+	}
 
-	// Log result (success or failure)
-	return c.logEmail(ctx, params, err)
+	log.Printf("[Email] Queued email to %s: %s (outbox_id: %d)", params.Recipient, params.Subject, queued.ID)
+	return nil
 }
 
-// formatMessage creates RFC 2822 compliant email message
-func (c *Client) formatMessage(to, subject, body string) string {
-	return fmt.Sprintf(
-		"From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s",
-		c.config.SMTPFrom,
-		to,
-		subject,
-		body,
-	)
+// renderText renders the plain-text template next to an HTML one, e.g.
+// welcome.txt for welcome.html. It returns "" when there is none.
+func renderText(htmlPath string, data interface{}) (string, error) {
+	textPath := strings.TrimSuffix(htmlPath, filepath.Ext(htmlPath)) + ".txt"
+	if _, err := os.Stat(textPath); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+
+	tmpl, err := texttemplate.ParseFiles(textPath)
+	if err != nil {
+		return "", fmt.Errorf("text template parse error: %w", err)
+	}
+	var text bytes.Buffer
+	if err := tmpl.Execute(&text, data); err != nil {
+		return "", fmt.Errorf("text template execution error: %w", err)
+	}
+	return text.String(), nil
 }
 
 // logEmail logs the email attempt to database
 func (c *Client) logEmail(ctx context.Context, params SendParams, err error) error {
 	level := "success"
 	message := fmt.Sprintf("Email sent to %s: %s", params.Recipient, params.Subject)
-	metadata := fmt.Sprintf(`{"recipient":"%s","subject":"%s","template":"%s"}`,
-		params.Recipient, params.Subject, params.TemplateName)
+	fields := struct {
+		Recipient string `json:"recipient"`
+		Subject   string `json:"subject"`
+		Template  string `json:"template"`
+		Error     string `json:"error,omitempty"`
+	}{Recipient: params.Recipient, Subject: params.Subject, Template: params.TemplateName}
 
 	if err != nil {
 		level = "error"
 		message = fmt.Sprintf("Failed to send email to %s: %v", params.Recipient, err)
-		metadata = fmt.Sprintf(`{"recipient":"%s","subject":"%s","template":"%s","error":"%s"}`,
-			params.Recipient, params.Subject, params.TemplateName, err.Error())
+		fields.Error = err.Error()
 		log.Printf("[Email] %s", message)
 	} else {
 		log.Printf("[Email] %s", message)
 	}
+	metadata, _ := json.Marshal(fields)
 
 	// Log to database (don't fail if this errors)
 	if c.queries != nil {
@@ -113,7 +203,7 @@ func (c *Client) logEmail(ctx context.Context, params SendParams, err error) err
 			Level:     level,
 			UserID:    params.UserID,
 			Message:   message,
-			Metadata:  sql.NullString{String: metadata, Valid: true},
+			Metadata:  sql.NullString{String: string(metadata), Valid: true},
 		}); dbErr != nil {
 			log.Printf("[Email] Warning: failed to log to database: %v", dbErr)
 		}
@@ -124,71 +214,86 @@ func (c *Client) logEmail(ctx context.Context, params SendParams, err error) err
 
 // SendWelcome sends welcome email to newly accepted member
 func (c *Client) SendWelcome(ctx context.Context, user *db.User) error {
-	data := map[string]interface{}{
-		"Name":      user.Realname.String,
-		"Username":  user.Username.String,
-		"PortalURL": c.config.BaseURL,
-	}
-
 	return c.SendTemplated(ctx, SendParams{
 		UserID:       sql.NullInt64{Int64: user.ID, Valid: true},
 		Recipient:    user.Email,
-		Subject:      "Vítej v Base48!",
 		TemplateName: "welcome.html",
-		Data:         data,
+		Data:         c.memberData(user),
 	})
 }
 
 // SendNegativeBalance sends notification about negative membership balance
-func (c *Client) SendNegativeBalance(ctx context.Context, user *db.User, balance float64) error {
-	data := map[string]interface{}{
-		"Name":       user.Realname.String,
-		"Balance":    balance,
-		"PaymentsID": user.PaymentsID.String,
-		"PortalURL":  c.config.BaseURL,
-	}
+func (c *Client) SendNegativeBalance(ctx context.Context, user *db.User, balance money.Amount) error {
+	data := c.memberData(user)
+	data["Balance"] = balance
 
 	return c.SendTemplated(ctx, SendParams{
 		UserID:       sql.NullInt64{Int64: user.ID, Valid: true},
 		Recipient:    user.Email,
-		Subject:      "Záporná bilance členského příspěvku",
 		TemplateName: "negative_balance.html",
 		Data:         data,
 	})
 }
 
-// SendDebtWarning sends warning about significant debt (>2x monthly fee)
-func (c *Client) SendDebtWarning(ctx context.Context, user *db.User, balance float64, monthlyFee float64) error {
-	data := map[string]interface{}{
-		"Name":       user.Realname.String,
-		"Balance":    balance,
-		"MonthlyFee": monthlyFee,
-		"PaymentsID": user.PaymentsID.String,
-		"PortalURL":  c.config.BaseURL,
-	}
+// SendDebtWarning sends warning about significant debt (DUNNING_WARNING)
+func (c *Client) SendDebtWarning(ctx context.Context, user *db.User, balance money.Amount, monthlyFee money.Amount) error {
+	data := c.memberData(user)
+	data["Balance"] = balance
+	data["MonthlyFee"] = monthlyFee
 
 	return c.SendTemplated(ctx, SendParams{
 		UserID:       sql.NullInt64{Int64: user.ID, Valid: true},
 		Recipient:    user.Email,
-		Subject:      "⚠️ Upozornění na dluh za členství",
 		TemplateName: "debt_warning.html",
 		Data:         data,
 	})
 }
 
+// SendDebtFinalNotice sends the last notice before the membership is
+// suspended for debt. suspendOn is zero when no suspension is scheduled.
+func (c *Client) SendDebtFinalNotice(ctx context.Context, user *db.User, balance money.Amount, monthlyFee money.Amount, suspendOn time.Time) error {
+	data := c.memberData(user)
+	data["Balance"] = balance
+	data["MonthlyFee"] = monthlyFee
+	data["SuspendOn"] = ""
+	if !suspendOn.IsZero() {
+		data["SuspendOn"] = suspendOn.Format("2. 1. 2006")
+	}
+
+	return c.SendTemplated(ctx, SendParams{
+		UserID:       sql.NullInt64{Int64: user.ID, Valid: true},
+		Recipient:    user.Email,
+		TemplateName: "debt_final_notice.html",
+		Data:         data,
+	})
+}
+
 // SendMembershipSuspended sends notification about membership suspension
 func (c *Client) SendMembershipSuspended(ctx context.Context, user *db.User, reason string) error {
-	data := map[string]interface{}{
-		"Name":      user.Realname.String,
-		"Reason":    reason,
-		"PortalURL": c.config.BaseURL,
-	}
+	data := c.memberData(user)
+	data["Reason"] = reason
 
 	return c.SendTemplated(ctx, SendParams{
 		UserID:       sql.NullInt64{Int64: user.ID, Valid: true},
 		Recipient:    user.Email,
-		Subject:      "Pozastavení členství v Base48",
 		TemplateName: "membership_suspended.html",
 		Data:         data,
 	})
 }
+
+// SendLevelPriceChange notifies a member that their fee changes with a new
+// price of their membership level
+func (c *Client) SendLevelPriceChange(ctx context.Context, user *db.User, levelName string, oldFee, newFee money.Amount, from time.Time) error {
+	data := c.memberData(user)
+	data["LevelName"] = levelName
+	data["OldFee"] = oldFee
+	data["NewFee"] = newFee
+	data["From"] = from.Format("1. 1. 2006")
+
+	return c.SendTemplated(ctx, SendParams{
+		UserID:       sql.NullInt64{Int64: user.ID, Valid: true},
+		Recipient:    user.Email,
+		TemplateName: "level_price_change.html",
+		Data:         data,
+	})
+}
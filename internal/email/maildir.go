@@ -0,0 +1,48 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var maildirSeq atomic.Int64
+
+// MaildirTransport stores the emails in a maildir instead of sending them, so
+// developers can read them in a mail client (e.g. mutt -f data/mail) or open
+// the files in new/ directly
+type MaildirTransport struct {
+	Dir string
+}
+
+// Send writes the message to tmp/ and moves it to new/ as the maildir
+// delivery does, so a reader never sees a partial file
+func (t *MaildirTransport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(t.Dir, sub), 0o755); err != nil {
+			return fmt.Errorf("failed to create maildir: %w", err)
+		}
+	}
+
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "localhost"
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), maildirSeq.Add(1), host)
+
+	tmp := filepath.Join(t.Dir, "tmp", name)
+	envelope := fmt.Sprintf("Return-Path: <%s>\r\nDelivered-To: %s\r\n", from, strings.Join(to, ", "))
+	if err := os.WriteFile(tmp, append([]byte(envelope), msg...), 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(t.Dir, "new", name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to deliver email to maildir: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package email
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"sync"
+)
+
+// MemoryTransport records the sent emails in memory. Tests use it to check
+// what would be sent.
+type MemoryTransport struct {
+	Err error // When set, Send fails with it and records nothing
+
+	mu       sync.Mutex
+	messages []SentMessage
+}
+
+// SentMessage is an email recorded by MemoryTransport
+type SentMessage struct {
+	From string // Envelope sender
+	To   []string
+	Raw  []byte
+}
+
+// Send records the message
+func (t *MemoryTransport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.Err != nil {
+		return t.Err
+	}
+	t.messages = append(t.messages, SentMessage{
+		From: from,
+		To:   append([]string(nil), to...),
+		Raw:  append([]byte(nil), msg...),
+	})
+	return nil
+}
+
+// Messages returns the recorded emails in the order they were sent
+func (t *MemoryTransport) Messages() []SentMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]SentMessage(nil), t.messages...)
+}
+
+// Reset forgets the recorded emails
+func (t *MemoryTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = nil
+}
+
+// Header returns the decoded value of a header, "" when it is missing or
+// the message cannot be parsed
+func (m SentMessage) Header(name string) string {
+	parsed, err := mail.ReadMessage(strings.NewReader(string(m.Raw)))
+	if err != nil {
+		return ""
+	}
+	value, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get(name))
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// Subject returns the decoded subject
+func (m SentMessage) Subject() string {
+	return m.Header("Subject")
+}
+
+// Text returns the plain-text part, "" when there is none
+func (m SentMessage) Text() string {
+	parsed, err := mail.ReadMessage(strings.NewReader(string(m.Raw)))
+	if err != nil {
+		return ""
+	}
+	return findText(parsed.Header.Get("Content-Type"), parsed.Body)
+}
+
+// findText walks the (nested) multipart body and returns the decoded
+// text/plain part
+func findText(contentType string, body io.Reader) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if mediaType == "text/plain" {
+		text, _ := io.ReadAll(body)
+		return string(text)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return ""
+	}
+
+	parts := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			return ""
+		}
+		if part.FileName() != "" {
+			continue
+		}
+		if text := findText(part.Header.Get("Content-Type"), part); text != "" {
+			return text
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Attachment is a file attached to an email, e.g. a statement or a receipt
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"` // Detected from the filename when empty
+	Data        []byte `json:"data"`
+}
+
+// Message is an email to compose. It is sent as multipart/alternative with a
+// plain-text and an HTML part, wrapped in multipart/mixed when there are
+// attachments. Non-ASCII headers are encoded as RFC 2047 encoded-words.
+type Message struct {
+	From            string // "Name <address>" or a bare address
+	To              string
+	ReplyTo         string // Optional
+	Subject         string
+	HTML            string
+	Text            string // Generated from HTML when empty
+	ListUnsubscribe string // Unsubscribe URL or mailto: of bulk mail, empty otherwise
+	MessageID       string // Generated when empty, keep it for retries
+	Date            time.Time
+	Attachments     []Attachment
+}
+
+// Bytes composes the message in the Internet Message Format with CRLF line
+// endings, ready for SMTP
+func (m Message) Bytes() ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid From address %q: %w", m.From, err)
+	}
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid To address %q: %w", m.To, err)
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+
+	header("From", from.String())
+	header("To", to.String())
+	if m.ReplyTo != "" {
+		replyTo, err := mail.ParseAddress(m.ReplyTo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Reply-To address %q: %w", m.ReplyTo, err)
+		}
+		header("Reply-To", replyTo.String())
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	header("Date", date.Format(time.RFC1123Z))
+
+	messageID := m.MessageID
+	if messageID == "" {
+		messageID = NewMessageID(from.Address)
+	}
+	header("Message-ID", messageID)
+
+	if m.ListUnsubscribe != "" {
+		header("List-Unsubscribe", "<"+m.ListUnsubscribe+">")
+		header("Precedence", "bulk")
+	}
+	header("MIME-Version", "1.0")
+
+	text := m.Text
+	if text == "" {
+		text = HTMLToText(m.HTML)
+	}
+
+	if len(m.Attachments) == 0 {
+		alternative := multipart.NewWriter(&buf)
+		header("Content-Type", "multipart/alternative; boundary="+alternative.Boundary())
+		buf.WriteString("\r\n")
+		if err := writeAlternative(alternative, text, m.HTML); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	buf.WriteString("\r\n")
+
+	// The alternative parts nested in the first part of multipart/mixed
+	var nested bytes.Buffer
+	alternative := multipart.NewWriter(&nested)
+	if err := writeAlternative(alternative, text, m.HTML); err != nil {
+		return nil, err
+	}
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + alternative.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(nested.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Attachments {
+		if err := writeAttachment(mixed, a); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeAlternative writes the plain-text and the HTML part and closes the
+// writer
+func writeAlternative(w *multipart.Writer, text, html string) error {
+	for _, p := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", html},
+	} {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		qp := quotedprintable.NewWriter(part)
+		if _, err := io.WriteString(qp, toCRLF(p.body)); err != nil {
+			return err
+		}
+		if err := qp.Close(); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// writeAttachment writes a base64 encoded attachment part
+func writeAttachment(w *multipart.Writer, a Attachment) error {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(a.Filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type of %s: %w", a.Filename, err)
+	}
+	params["name"] = a.Filename
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(mediaType, params)},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Base64 in lines of 76 characters (RFC 2045)
+	encoded := base64.StdEncoding.EncodeToString(a.Data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(part, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(part, encoded+"\r\n")
+	return err
+}
+
+// toCRLF normalizes line endings to CRLF
+func toCRLF(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+// NewMessageID returns a unique Message-ID in the domain of the sender
+// address, e.g. "<3f2a...@base48.cz>"
+func NewMessageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().Unix(), hex.EncodeToString(b), domain)
+}
@@ -0,0 +1,293 @@
+package email
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+)
+
+// parseMessage parses composed message bytes and the media type of the body
+func parseMessage(t *testing.T, m Message) (*mail.Message, string, map[string]string) {
+	t.Helper()
+
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v\n%s", err, raw)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Content-Type: %v", err)
+	}
+	return parsed, mediaType, params
+}
+
+// readAlternative returns the plain-text and the HTML part of a
+// multipart/alternative body
+func readAlternative(t *testing.T, r io.Reader, boundary string) (text, html string) {
+	t.Helper()
+
+	parts := multipart.NewReader(r, boundary)
+	for _, want := range []string{"text/plain", "text/html"} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("%s part: %v", want, err)
+		}
+		if mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); mediaType != want {
+			t.Fatalf("part %s, want %s", mediaType, want)
+		}
+		body, _ := io.ReadAll(part) // Quoted-printable is decoded by the reader
+		if want == "text/plain" {
+			text = string(body)
+		} else {
+			html = string(body)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("unexpected part after text/html: %v", err)
+	}
+	return text, html
+}
+
+func TestMessageBytes(t *testing.T) {
+	date := time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC)
+	parsed, mediaType, params := parseMessage(t, Message{
+		From:            "Base48 Členský portál <noreply@base48.cz>",
+		To:              "Jan Novák <novak@example.com>",
+		ReplyTo:         "Výbor <board@base48.cz>",
+		Subject:         "⚠️ Upozornění na dluh za členství",
+		HTML:            "<p>Ahoj Jane,</p><p>dlužíš <strong>1 000 Kč</strong>.</p>",
+		ListUnsubscribe: "https://portal.example.com/profile",
+		MessageID:       "<1.abc@base48.cz>",
+		Date:            date,
+	})
+
+	dec := new(mime.WordDecoder)
+	if subject, err := dec.DecodeHeader(parsed.Header.Get("Subject")); err != nil || subject != "⚠️ Upozornění na dluh za členství" {
+		t.Errorf("Subject %q, %v", subject, err)
+	}
+	for name, want := range map[string]string{
+		"From":     "Base48 Členský portál <noreply@base48.cz>",
+		"To":       "Jan Novák <novak@example.com>",
+		"Reply-To": "Výbor <board@base48.cz>",
+	} {
+		addr, err := mail.ParseAddress(parsed.Header.Get(name)) // Decodes the encoded name
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got := addr.Name + " <" + addr.Address + ">"; got != want {
+			t.Errorf("%s %q, want %q", name, got, want)
+		}
+	}
+	if got, err := parsed.Header.Date(); err != nil || !got.Equal(date) {
+		t.Errorf("Date %v, %v", got, err)
+	}
+	if got := parsed.Header.Get("Message-ID"); got != "<1.abc@base48.cz>" {
+		t.Errorf("Message-ID %q", got)
+	}
+	if got := parsed.Header.Get("List-Unsubscribe"); got != "<https://portal.example.com/profile>" {
+		t.Errorf("List-Unsubscribe %q", got)
+	}
+	if got := parsed.Header.Get("MIME-Version"); got != "1.0" {
+		t.Errorf("MIME-Version %q", got)
+	}
+
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type %q", mediaType)
+	}
+	text, html := readAlternative(t, parsed.Body, params["boundary"])
+	if text != "Ahoj Jane,\r\n\r\ndlužíš 1 000 Kč.\r\n" {
+		t.Errorf("text part %q", text)
+	}
+	if html != "<p>Ahoj Jane,</p><p>dlužíš <strong>1 000 Kč</strong>.</p>" {
+		t.Errorf("html part %q", html)
+	}
+}
+
+func TestMessageDefaults(t *testing.T) {
+	parsed, _, _ := parseMessage(t, Message{
+		From:    "noreply@base48.cz",
+		To:      "novak@example.com",
+		Subject: "Test",
+		HTML:    "<p>Test</p>",
+	})
+
+	if id := parsed.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@base48.cz>") {
+		t.Errorf("generated Message-ID %q", id)
+	}
+	if date, err := parsed.Header.Date(); err != nil || time.Since(date) > time.Minute {
+		t.Errorf("generated Date %v, %v", date, err)
+	}
+	for _, name := range []string{"Reply-To", "List-Unsubscribe", "Precedence"} {
+		if got := parsed.Header.Get(name); got != "" {
+			t.Errorf("%s %q set without being asked for", name, got)
+		}
+	}
+
+	if _, err := (Message{From: "not an address", To: "novak@example.com"}).Bytes(); err == nil {
+		t.Errorf("invalid From accepted")
+	}
+}
+
+func TestMessageAttachments(t *testing.T) {
+	pdf := []byte(strings.Repeat("%PDF-1.4 výpis ", 20))
+	parsed, mediaType, params := parseMessage(t, Message{
+		From:    "noreply@base48.cz",
+		To:      "novak@example.com",
+		Subject: "Výpis plateb",
+		HTML:    "<p>Výpis v příloze.</p>",
+		Text:    "Výpis v příloze.\n",
+		Attachments: []Attachment{
+			{Filename: "výpis-2026.pdf", Data: pdf},
+		},
+	})
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type %q", mediaType)
+	}
+
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	part, err := parts.NextPart()
+	if err != nil {
+		t.Fatalf("first part: %v", err)
+	}
+	altType, altParams, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if altType != "multipart/alternative" {
+		t.Fatalf("first part %q", altType)
+	}
+	if text, _ := readAlternative(t, part, altParams["boundary"]); text != "Výpis v příloze.\r\n" {
+		t.Errorf("template text %q", text)
+	}
+
+	part, err = parts.NextPart()
+	if err != nil {
+		t.Fatalf("attachment: %v", err)
+	}
+	if got := part.FileName(); got != "výpis-2026.pdf" {
+		t.Errorf("filename %q", got)
+	}
+	if got, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); got != "application/pdf" {
+		t.Errorf("attachment type %q", got)
+	}
+	encoded, _ := io.ReadAll(part)
+	for _, line := range strings.Split(strings.TrimSpace(string(encoded)), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("base64 line of %d characters", len(line))
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil || string(data) != string(pdf) {
+		t.Errorf("attachment data %q, %v", data, err)
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "paragraphs and line breaks",
+			html: "<html><head><style>p { color: red; }</style></head><body>\n  <h1>Vítej!</h1>\n  <p>Ahoj,\n     vítáme tě.</p>\n<div>Jméno: <strong>jan</strong><br>Email: jan@example.com</div></body></html>",
+			want: "Vítej!\n\nAhoj, vítáme tě.\n\nJméno: jan\nEmail: jan@example.com\n",
+		},
+		{
+			name: "links",
+			html: `<p><a href="https://portal.example.com">Otevřít portál</a>, <a href="mailto:board@base48.cz">board@base48.cz</a></p>`,
+			want: "Otevřít portál (https://portal.example.com), board@base48.cz\n",
+		},
+		{
+			name: "lists",
+			html: "<ul>\n<li>První</li>\n<li>Druhý</li>\n</ul><p>Konec</p>",
+			want: "- První\n- Druhý\n\nKonec\n",
+		},
+		{
+			name: "entities and tables",
+			html: "<table><tr><td>Dluh:</td><td>1&nbsp;500 Kč &amp; víc</td></tr></table>",
+			want: "Dluh: 1 500 Kč & víc\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToText(tt.html); got != tt.want {
+				t.Errorf("HTMLToText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendTemplatedText(t *testing.T) {
+	c, _ := newTestClient(t)
+	c.config.EmailReplyTo = "Výbor <board@example.com>"
+	ctx := context.Background()
+
+	t.Chdir(t.TempDir())
+	dir := filepath.Join("web", "templates", "email")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"with_text.html":    "<p>Ahoj {{.Name}}</p>",
+		"with_text.txt":     "Ahoj {{.Name}} & spol.\n",
+		"without_text.html": "<p>Ahoj {{.Name}} &amp; spol.</p>",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send := func(params SendParams) {
+		t.Helper()
+		params.Recipient = "novak@example.com"
+		params.Subject = "Test"
+		params.Data = map[string]string{"Name": "Jan"}
+		if err := c.SendTemplated(ctx, params); err != nil {
+			t.Fatalf("SendTemplated %s: %v", params.TemplateName, err)
+		}
+	}
+
+	// The .txt template is rendered as text, not HTML-escaped
+	send(SendParams{TemplateName: "with_text.html"})
+	send(SendParams{
+		TemplateName:    "without_text.html",
+		ReplyTo:         "pokladnik@example.com",
+		ListUnsubscribe: "https://portal.example.com/profile",
+		Attachments:     []Attachment{{Filename: "potvrzeni.txt", Data: []byte("Zaplaceno")}},
+	})
+
+	emails, err := c.queries.ListEmails(ctx, db.ListEmailsParams{Limit: 10})
+	if err != nil || len(emails) != 2 {
+		t.Fatalf("queued %d, %v", len(emails), err)
+	}
+	byTemplate := map[string]int{}
+	for i, e := range emails {
+		byTemplate[e.Template] = i
+	}
+
+	withText := emails[byTemplate["with_text.html"]]
+	if withText.TextBody != "Ahoj Jan & spol.\n" || withText.ReplyTo.String != "Výbor <board@example.com>" ||
+		withText.ListUnsubscribe.Valid || withText.Attachments.Valid || withText.MessageID == "" {
+		t.Errorf("with text template: %+v", withText)
+	}
+
+	withoutText := emails[byTemplate["without_text.html"]]
+	if withoutText.TextBody != "Ahoj Jan & spol.\n" || withoutText.ReplyTo.String != "pokladnik@example.com" ||
+		withoutText.ListUnsubscribe.String != "https://portal.example.com/profile" ||
+		!strings.Contains(withoutText.Attachments.String, `"filename":"potvrzeni.txt"`) {
+		t.Errorf("generated text: %+v", withoutText)
+	}
+}
@@ -0,0 +1,247 @@
+package email
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/mail"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+)
+
+// Outbox statuses (email_outbox.status)
+const (
+	StatusQueued    = "queued"
+	StatusSending   = "sending"
+	StatusSent      = "sent"
+	StatusFailed    = "failed" // Dead letter, all attempts failed
+	StatusCancelled = "cancelled"
+)
+
+// Statuses in the order shown on /admin/emails
+var Statuses = []string{StatusQueued, StatusSending, StatusSent, StatusFailed, StatusCancelled}
+
+var statusLabels = map[string]string{
+	StatusQueued:    "Ve frontě",
+	StatusSending:   "Odesílá se",
+	StatusSent:      "Odesláno",
+	StatusFailed:    "Selhalo",
+	StatusCancelled: "Zrušeno",
+}
+
+// StatusLabel returns the Czech name of the outbox status
+func StatusLabel(status string) string {
+	if label, ok := statusLabels[status]; ok {
+		return label
+	}
+	return status
+}
+
+const (
+	retryBase      = time.Minute
+	retryMax       = 6 * time.Hour
+	deliverBatch   = 50               // Emails delivered in one pass
+	workerInterval = 15 * time.Second // How often the worker checks the outbox
+)
+
+// Backoff returns the delay before the next attempt after the given number of
+// failed attempts: 1 min, 2 min, 4 min, ... up to 6 hours
+func Backoff(attempts int64) time.Duration {
+	delay := retryBase
+	for i := int64(1); i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMax)
+}
+
+// outboxTime returns the time as stored in email_outbox: UTC in whole
+// seconds, so ListDueEmails can compare the stored times as text
+func outboxTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// DeliveryResult summarizes one pass over the outbox
+type DeliveryResult struct {
+	Sent    int
+	Retried int // Failed, queued for another attempt
+	Failed  int // Failed for the last time (dead letter)
+}
+
+// Deliver sends the queued emails that are due. A failed attempt is retried
+// after Backoff, after max_attempts the email is left failed. An email taken
+// by another worker (e.g. a CLI run next to the server) is skipped.
+func (c *Client) Deliver(ctx context.Context, now time.Time) (DeliveryResult, error) {
+	var result DeliveryResult
+	if !c.Enabled() {
+		return result, fmt.Errorf("emails are disabled (no EMAIL_TRANSPORT or SMTP_HOST)")
+	}
+
+	due, err := c.queries.ListDueEmails(ctx, db.ListDueEmailsParams{
+		NextAttemptAt: outboxTime(now),
+		Limit:         deliverBatch,
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to list queued emails: %w", err)
+	}
+
+	for _, m := range due {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		claimed, err := c.queries.ClaimEmail(ctx, m.ID)
+		if err != nil {
+			return result, fmt.Errorf("failed to claim email %d: %w", m.ID, err)
+		}
+		if claimed == 0 {
+			continue
+		}
+		m.Attempts++
+
+		params := SendParams{
+			UserID:       m.UserID,
+			Recipient:    m.Recipient,
+			Subject:      m.Subject,
+			TemplateName: m.Template,
+		}
+
+		sendErr := c.deliver(ctx, m)
+		switch {
+		case sendErr == nil:
+			err = c.queries.MarkEmailSent(ctx, db.MarkEmailSentParams{
+				SentAt: sql.NullTime{Time: outboxTime(time.Now()), Valid: true},
+				ID:     m.ID,
+			})
+			result.Sent++
+			c.logEmail(ctx, params, nil)
+		case m.Attempts >= m.MaxAttempts:
+			err = c.queries.MarkEmailFailed(ctx, db.MarkEmailFailedParams{
+				Status:        StatusFailed,
+				NextAttemptAt: m.NextAttemptAt,
+				LastError:     sql.NullString{String: sendErr.Error(), Valid: true},
+				ID:            m.ID,
+			})
+			result.Failed++
+			c.logEmail(ctx, params, fmt.Errorf("giving up after %d attempts: %w", m.Attempts, sendErr))
+		default:
+			retryAt := outboxTime(now.Add(Backoff(m.Attempts)))
+			err = c.queries.MarkEmailFailed(ctx, db.MarkEmailFailedParams{
+				Status:        StatusQueued,
+				NextAttemptAt: retryAt,
+				LastError:     sql.NullString{String: sendErr.Error(), Valid: true},
+				ID:            m.ID,
+			})
+			result.Retried++
+			c.logRetry(ctx, m, sendErr, retryAt)
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to update email %d: %w", m.ID, err)
+		}
+	}
+
+	return result, nil
+}
+
+// deliver composes a queued email and sends it through the transport
+func (c *Client) deliver(ctx context.Context, m db.EmailOutbox) error {
+	message := Message{
+		From:            c.config.SMTPFrom,
+		To:              m.Recipient,
+		ReplyTo:         m.ReplyTo.String,
+		Subject:         m.Subject,
+		HTML:            m.Body,
+		Text:            m.TextBody,
+		ListUnsubscribe: m.ListUnsubscribe.String,
+		MessageID:       m.MessageID,
+		Date:            m.CreatedAt,
+	}
+	if m.Attachments.Valid {
+		if err := json.Unmarshal([]byte(m.Attachments.String), &message.Attachments); err != nil {
+			return fmt.Errorf("invalid attachments: %w", err)
+		}
+	}
+	raw, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// The envelope sender is the bare address of SMTP_FROM
+	from, err := mail.ParseAddress(c.config.SMTPFrom)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+
+	to, err := mail.ParseAddress(m.Recipient)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+	return c.transport.Send(ctx, from.Address, []string{to.Address}, raw)
+}
+
+// logRetry logs a failed attempt that will be retried
+func (c *Client) logRetry(ctx context.Context, m db.EmailOutbox, err error, retryAt time.Time) {
+	message := fmt.Sprintf("Failed to send email to %s (attempt %d/%d, retry at %s): %v",
+		m.Recipient, m.Attempts, m.MaxAttempts, retryAt.Local().Format("2006-01-02 15:04"), err)
+	log.Printf("[Email] %s", message)
+
+	metadata, _ := json.Marshal(struct {
+		OutboxID  int64  `json:"outbox_id"`
+		Recipient string `json:"recipient"`
+		Subject   string `json:"subject"`
+		Template  string `json:"template"`
+		Attempt   int64  `json:"attempt"`
+	}{m.ID, m.Recipient, m.Subject, m.Template, m.Attempts})
+
+	if _, dbErr := c.queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "email",
+		Level:     "warning",
+		UserID:    m.UserID,
+		Message:   message,
+		Metadata:  sql.NullString{String: string(metadata), Valid: true},
+	}); dbErr != nil {
+		log.Printf("[Email] Warning: failed to log to database: %v", dbErr)
+	}
+}
+
+// Resend queues an email again with a fresh set of attempts, whatever its
+// status (a sent email is sent once more)
+func (c *Client) Resend(ctx context.Context, id int64) error {
+	return c.queries.ResendEmail(ctx, db.ResendEmailParams{
+		NextAttemptAt: outboxTime(time.Now()),
+		ID:            id,
+	})
+}
+
+// RunWorker delivers the queued emails until ctx is cancelled, checking the
+// outbox every 15 seconds. Emails left sending by a previous run (e.g. the
+// server was killed during delivery) are queued again first.
+func (c *Client) RunWorker(ctx context.Context) {
+	if n, err := c.queries.RequeueStaleEmails(ctx); err != nil {
+		log.Printf("[Email] Warning: failed to requeue stale emails: %v", err)
+	} else if n > 0 {
+		log.Printf("[Email] ⚠ Requeued %d email(s) left sending by a previous run", n)
+	}
+
+	ticker := time.NewTicker(workerInterval)
+	defer ticker.Stop()
+
+	for {
+		if c.Enabled() {
+			result, err := c.Deliver(ctx, time.Now())
+			if err != nil && ctx.Err() == nil {
+				log.Printf("[Email] ✗ Outbox delivery failed: %v", err)
+			}
+			if result.Sent+result.Retried+result.Failed > 0 {
+				log.Printf("[Email] Outbox: %d sent, %d to retry, %d failed", result.Sent, result.Retried, result.Failed)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package email
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+)
+
+func newTestClient(t *testing.T) (*Client, *MemoryTransport) {
+	t.Helper()
+
+	database := dbtest.Open(t)
+
+	cfg := &config.Config{
+		SMTPHost:         "smtp.example.com",
+		SMTPPort:         587,
+		SMTPFrom:         "Base48 <noreply@example.com>",
+		BaseURL:          "https://portal.example.com",
+		EmailMaxAttempts: 3,
+	}
+	sent := &MemoryTransport{}
+	return New(cfg, db.New(database), WithTransport(sent)), sent
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int64
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxDelivery(t *testing.T) {
+	c, sent := newTestClient(t)
+	ctx := context.Background()
+	t.Chdir("../..") // Templates are loaded from web/templates/email
+
+	user := &db.User{ID: 1, Email: "novak@example.com", Realname: sql.NullString{String: "Jan Novák", Valid: true}}
+	if err := c.SendWelcome(ctx, user); err != nil {
+		t.Fatalf("SendWelcome: %v", err)
+	}
+
+	// Only queued, nothing sent yet
+	queued, _ := c.queries.ListEmails(ctx, db.ListEmailsParams{Limit: 10})
+	if len(queued) != 1 || queued[0].Status != StatusQueued || !strings.Contains(queued[0].Body, "Jan Novák") || len(sent.Messages()) != 0 {
+		t.Fatalf("queued %+v, sent %d", queued, len(sent.Messages()))
+	}
+	id := queued[0].ID
+	status := func() db.EmailOutbox {
+		t.Helper()
+		m, err := c.queries.GetEmail(ctx, id)
+		if err != nil {
+			t.Fatalf("get email: %v", err)
+		}
+		return m
+	}
+
+	// Failed attempts are retried after a growing delay
+	sent.Err = errors.New("421 service not available")
+	now := time.Now()
+	if result, err := c.Deliver(ctx, now); err != nil || result.Retried != 1 {
+		t.Fatalf("first attempt: %+v, %v", result, err)
+	}
+	if m := status(); m.Status != StatusQueued || m.Attempts != 1 || !m.LastError.Valid ||
+		!m.NextAttemptAt.Equal(outboxTime(now.Add(time.Minute))) {
+		t.Errorf("after the first attempt: %+v", m)
+	}
+	if result, _ := c.Deliver(ctx, now.Add(30*time.Second)); result != (DeliveryResult{}) {
+		t.Errorf("retried before the backoff: %+v", result)
+	}
+	if result, _ := c.Deliver(ctx, now.Add(time.Minute)); result.Retried != 1 {
+		t.Errorf("second attempt: %+v", result)
+	}
+
+	// The last attempt leaves it in the dead letter state
+	if result, _ := c.Deliver(ctx, now.Add(3*time.Minute)); result.Failed != 1 {
+		t.Errorf("third attempt: %+v", result)
+	}
+	if m := status(); m.Status != StatusFailed || m.Attempts != 3 {
+		t.Errorf("after the last attempt: %+v", m)
+	}
+	if result, _ := c.Deliver(ctx, now.Add(24*time.Hour)); result != (DeliveryResult{}) {
+		t.Errorf("dead letter retried: %+v", result)
+	}
+
+	// Resent by an admin with a fresh set of attempts
+	sent.Err = nil
+	if err := c.Resend(ctx, id); err != nil {
+		t.Fatalf("Resend: %v", err)
+	}
+	if result, err := c.Deliver(ctx, time.Now()); err != nil || result.Sent != 1 {
+		t.Fatalf("resent: %+v, %v", result, err)
+	}
+	if m := status(); m.Status != StatusSent || m.Attempts != 1 || !m.SentAt.Valid || m.LastError.Valid {
+		t.Errorf("after delivery: %+v", m)
+	}
+	messages := sent.Messages()
+	if len(messages) != 1 || messages[0].Header("To") != "<novak@example.com>" || messages[0].Subject() != "Vítej v Base48!" {
+		t.Fatalf("delivered %q", messages)
+	}
+	if messages[0].From != "noreply@example.com" || len(messages[0].To) != 1 || messages[0].To[0] != "novak@example.com" {
+		t.Errorf("envelope %s -> %v", messages[0].From, messages[0].To)
+	}
+	if !strings.Contains(messages[0].Text(), "Ahoj Jan Novák,") {
+		t.Errorf("text part %q", messages[0].Text())
+	}
+
+	// A cancelled email is never sent
+	if err := c.SendMembershipSuspended(ctx, user, "Dluh"); err != nil {
+		t.Fatalf("SendMembershipSuspended: %v", err)
+	}
+	queued, _ = c.queries.ListEmails(ctx, db.ListEmailsParams{Status: sql.NullString{String: StatusQueued, Valid: true}, Limit: 10})
+	if len(queued) != 1 {
+		t.Fatalf("queued %+v", queued)
+	}
+	if n, err := c.queries.CancelEmail(ctx, queued[0].ID); err != nil || n != 1 {
+		t.Fatalf("CancelEmail: %d, %v", n, err)
+	}
+	if result, _ := c.Deliver(ctx, time.Now()); result != (DeliveryResult{}) || len(sent.Messages()) != 1 {
+		t.Errorf("cancelled email delivered: %+v", result)
+	}
+	if n, _ := c.queries.CancelEmail(ctx, id); n != 0 {
+		t.Errorf("cancelled a sent email")
+	}
+}
+
+func TestDeliveryLogs(t *testing.T) {
+	c, sent := newTestClient(t)
+	ctx := context.Background()
+
+	subject := `Výzva "poslední" \ březen`
+	queued, err := c.queries.EnqueueEmail(ctx, db.EnqueueEmailParams{
+		Recipient:     "novak@example.com",
+		Subject:       subject,
+		Template:      "custom",
+		Body:          "<p>Text</p>",
+		MessageID:     "<retry@example.com>",
+		MaxAttempts:   2,
+		NextAttemptAt: outboxTime(time.Now()),
+	})
+	if err != nil {
+		t.Fatalf("EnqueueEmail: %v", err)
+	}
+
+	// A retry, giving up and a delivery after a resend
+	now := time.Now()
+	sent.Err = errors.New(`550 "novak" \ mailbox unavailable`)
+	if result, err := c.Deliver(ctx, now); err != nil || result.Retried != 1 {
+		t.Fatalf("first attempt: %+v, %v", result, err)
+	}
+	if result, err := c.Deliver(ctx, now.Add(time.Minute)); err != nil || result.Failed != 1 {
+		t.Fatalf("last attempt: %+v, %v", result, err)
+	}
+	sent.Err = nil
+	if err := c.Resend(ctx, queued.ID); err != nil {
+		t.Fatalf("Resend: %v", err)
+	}
+	if result, err := c.Deliver(ctx, time.Now()); err != nil || result.Sent != 1 {
+		t.Fatalf("resent: %+v, %v", result, err)
+	}
+
+	// Quotes and backslashes of the subject and the error are escaped
+	logs, err := c.queries.ListLogsBySubsystem(ctx, db.ListLogsBySubsystemParams{Subsystem: "email", Limit: 10})
+	if err != nil || len(logs) != 3 {
+		t.Fatalf("logs %+v, %v", logs, err)
+	}
+	levels := map[string]bool{}
+	for _, l := range logs {
+		var metadata struct {
+			Subject string `json:"subject"`
+			Error   string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(l.Metadata.String), &metadata); err != nil {
+			t.Fatalf("%s metadata %s: %v", l.Level, l.Metadata.String, err)
+		}
+		if metadata.Subject != subject || (l.Level == "error") != strings.Contains(metadata.Error, `"novak" \`) {
+			t.Errorf("%s metadata %+v", l.Level, metadata)
+		}
+		levels[l.Level] = true
+	}
+	if !levels["warning"] || !levels["error"] || !levels["success"] {
+		t.Errorf("log levels %v", levels)
+	}
+}
+
+func TestRequeueStaleEmails(t *testing.T) {
+	c, sent := newTestClient(t)
+	ctx := context.Background()
+
+	m, err := c.queries.EnqueueEmail(ctx, db.EnqueueEmailParams{
+		Recipient:     "novak@example.com",
+		Subject:       "Test",
+		Template:      "welcome.html",
+		Body:          "<p>Test</p>",
+		MaxAttempts:   3,
+		NextAttemptAt: outboxTime(time.Now()),
+	})
+	if err != nil {
+		t.Fatalf("EnqueueEmail: %v", err)
+	}
+
+	// Taken by a worker that never finished
+	if n, _ := c.queries.ClaimEmail(ctx, m.ID); n != 1 {
+		t.Fatalf("claim failed")
+	}
+	if n, _ := c.queries.ClaimEmail(ctx, m.ID); n != 0 {
+		t.Errorf("claimed twice")
+	}
+	if result, _ := c.Deliver(ctx, time.Now()); result != (DeliveryResult{}) {
+		t.Errorf("delivered an email being sent: %+v", result)
+	}
+
+	if n, err := c.queries.RequeueStaleEmails(ctx); err != nil || n != 1 {
+		t.Fatalf("RequeueStaleEmails: %d, %v", n, err)
+	}
+	if result, _ := c.Deliver(ctx, time.Now()); result.Sent != 1 || len(sent.Messages()) != 1 {
+		t.Errorf("after requeue: %+v", result)
+	}
+}
@@ -0,0 +1,241 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// TemplateDir holds the default email templates: an HTML file per email and
+// an optional .txt file of the same name with the plain-text part
+const TemplateDir = "web/templates/email"
+
+// Template is an email template with its default subject
+type Template struct {
+	Name    string // File name in TemplateDir, e.g. "welcome.html"
+	Title   string // Czech description for the admin pages
+	Subject string // Subject used when there is no override
+}
+
+// Templates are the emails sent by the portal
+var Templates = []Template{
+	{Name: "welcome.html", Title: "Uvítání nového člena", Subject: "Vítej v Base48!"},
+	{Name: "negative_balance.html", Title: "Připomínka záporné bilance", Subject: "Záporná bilance členského příspěvku"},
+	{Name: "debt_warning.html", Title: "Upozornění na dluh", Subject: "⚠️ Upozornění na dluh za členství"},
+	{Name: "debt_final_notice.html", Title: "Poslední výzva před pozastavením", Subject: "⛔ Poslední výzva k úhradě dluhu za členství"},
+	{Name: "membership_suspended.html", Title: "Pozastavení členství", Subject: "Pozastavení členství v Base48"},
+	{Name: "level_price_change.html", Title: "Změna výše příspěvku", Subject: "Změna výše členského příspěvku v Base48"},
+	{Name: "announcement.html", Title: "Oznámení členům (obálka)", Subject: "Oznámení z Base48"},
+}
+
+// LookupTemplate returns the template of the file name. Files in TemplateDir
+// not listed in Templates are found too, without a default subject.
+func LookupTemplate(name string) (Template, bool) {
+	for _, t := range Templates {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	if name != filepath.Base(name) || filepath.Ext(name) != ".html" {
+		return Template{}, false
+	}
+	if _, err := os.Stat(filepath.Join(TemplateDir, name)); err != nil {
+		return Template{}, false
+	}
+	return Template{Name: name}, true
+}
+
+// ListTemplates returns Templates followed by the other HTML files in
+// TemplateDir
+func ListTemplates() ([]Template, error) {
+	files, err := filepath.Glob(filepath.Join(TemplateDir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	list := append([]Template(nil), Templates...)
+	for _, f := range files {
+		name := filepath.Base(f)
+		if t, _ := LookupTemplate(name); t.Title == "" {
+			list = append(list, t)
+		}
+	}
+	return list, nil
+}
+
+// Source is the source of a template. An empty field falls back to the
+// default: the file in TemplateDir, the subject given by the sender. Without
+// HTML the text falls back to the .txt file, with HTML it is generated from
+// the HTML (the file would not match).
+type Source struct {
+	Subject string // text/template
+	HTML    string // html/template
+	Text    string // text/template
+}
+
+// IsDefault reports whether nothing is overridden
+func (s Source) IsDefault() bool {
+	return s.Subject == "" && s.HTML == "" && s.Text == ""
+}
+
+// SourceOf returns the source saved in a template version
+func SourceOf(v db.EmailTemplateVersion) Source {
+	return Source{Subject: v.Subject, HTML: v.HtmlBody, Text: v.TextBody}
+}
+
+// DefaultSource returns the file contents of the template with the subject,
+// as a starting point for editing
+func DefaultSource(t Template) (Source, error) {
+	path := filepath.Join(TemplateDir, t.Name)
+	html, err := os.ReadFile(path)
+	if err != nil {
+		return Source{}, err
+	}
+	text, err := os.ReadFile(strings.TrimSuffix(path, ".html") + ".txt")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Source{}, err
+	}
+	return Source{Subject: t.Subject, HTML: string(html), Text: string(text)}, nil
+}
+
+// Rendered is an email rendered from a template
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// RenderSource renders the template from the source with the data. The
+// errors name the part that fails, so it also validates an edited source.
+// Unlike the files, an edited part fails on a key missing in the data, so a
+// typo or a value the email does not have is not sent as an empty string.
+func RenderSource(t Template, src Source, data interface{}) (Rendered, error) {
+	var r Rendered
+	path := filepath.Join(TemplateDir, t.Name)
+
+	r.Subject = t.Subject
+	if src.Subject != "" {
+		tmpl, err := texttemplate.New("subject").Option("missingkey=error").Parse(src.Subject)
+		if err != nil {
+			return r, fmt.Errorf("předmět: %w", err)
+		}
+		var subject bytes.Buffer
+		if err := tmpl.Execute(&subject, data); err != nil {
+			return r, fmt.Errorf("předmět: %w", err)
+		}
+		r.Subject = strings.Join(strings.Fields(subject.String()), " ") // A header is one line
+	}
+	if r.Subject == "" {
+		return r, fmt.Errorf("předmět: prázdný předmět")
+	}
+
+	var tmpl *template.Template
+	var err error
+	if src.HTML != "" {
+		tmpl, err = template.New(t.Name).Option("missingkey=error").Parse(src.HTML)
+	} else {
+		tmpl, err = template.ParseFiles(path)
+	}
+	if err != nil {
+		return r, fmt.Errorf("HTML: %w", err)
+	}
+	var html bytes.Buffer
+	if err := tmpl.Execute(&html, data); err != nil {
+		return r, fmt.Errorf("HTML: %w", err)
+	}
+	r.HTML = html.String()
+
+	switch {
+	case src.Text != "":
+		tmpl, err := texttemplate.New(strings.TrimSuffix(t.Name, ".html") + ".txt").Option("missingkey=error").Parse(src.Text)
+		if err != nil {
+			return r, fmt.Errorf("text: %w", err)
+		}
+		var text bytes.Buffer
+		if err := tmpl.Execute(&text, data); err != nil {
+			return r, fmt.Errorf("text: %w", err)
+		}
+		r.Text = text.String()
+	case src.HTML == "":
+		if r.Text, err = renderText(path, data); err != nil {
+			return r, fmt.Errorf("text: %w", err)
+		}
+	}
+	if r.Text == "" {
+		r.Text = HTMLToText(r.HTML)
+	}
+	return r, nil
+}
+
+// Render renders the template in use: the current version edited by an
+// admin, or the defaults. A version that fails to render (e.g. it uses data
+// the email does not have) is logged and the defaults are used instead.
+func (c *Client) Render(ctx context.Context, t Template, data interface{}) (Rendered, error) {
+	if c.queries != nil {
+		current, err := c.queries.GetCurrentEmailTemplate(ctx, t.Name)
+		switch {
+		case err == nil && !SourceOf(current).IsDefault():
+			rendered, renderErr := RenderSource(t, SourceOf(current), data)
+			if renderErr == nil {
+				return rendered, nil
+			}
+			log.Printf("[Email] Warning: version %d of %s failed, using the default template: %v", current.Version, t.Name, renderErr)
+		case err != nil && !errors.Is(err, sql.ErrNoRows):
+			log.Printf("[Email] Warning: failed to load the edited %s, using the default template: %v", t.Name, err)
+		}
+	}
+	return RenderSource(t, Source{}, data)
+}
+
+// memberData returns the template data of a member shared by all templates
+func (c *Client) memberData(user *db.User) map[string]interface{} {
+	return map[string]interface{}{
+		"Name":       user.Realname.String,
+		"Username":   user.Username.String,
+		"Email":      user.Email,
+		"PaymentsID": user.PaymentsID.String,
+		"PortalURL":  c.config.BaseURL,
+	}
+}
+
+// PreviewValues are the values of a member used by the templates that are
+// not stored with the member
+type PreviewValues struct {
+	Balance    money.Amount
+	MonthlyFee money.Amount
+	LevelName  string
+}
+
+// PreviewData returns the data of every template for a member: the member's
+// own values and sample values of the rest (a suspension reason, a price
+// change of the level by 200 Kč, an announcement, ...)
+func (c *Client) PreviewData(user *db.User, values PreviewValues) map[string]interface{} {
+	now := time.Now()
+	data := c.memberData(user)
+	data["Balance"] = values.Balance
+	data["MonthlyFee"] = values.MonthlyFee
+	data["SuspendOn"] = now.AddDate(0, 0, 14).Format("2. 1. 2006")
+	data["Reason"] = "Dluh na členském příspěvku přesahuje povolený limit."
+	data["LevelName"] = values.LevelName
+	data["OldFee"] = values.MonthlyFee
+	data["NewFee"] = values.MonthlyFee + money.FromKoruny(200)
+	data["From"] = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC).Format("1. 1. 2006")
+	data["Subject"] = "Pozvánka na členskou schůzi"
+	data["Body"] = "Ahoj " + user.Realname.String + ",\n\nzveme tě na členskou schůzi v sobotu od 18:00 v prostoru Base48.\n\nVýbor Base48"
+	return data
+}
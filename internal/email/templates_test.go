@@ -0,0 +1,180 @@
+package email
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/base48/member-portal/internal/db"
+)
+
+// writeTemplates creates TemplateDir with the files in a temporary working
+// directory
+func writeTemplates(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(TemplateDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(TemplateDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRenderSource(t *testing.T) {
+	writeTemplates(t, map[string]string{
+		"welcome.html": "<p>Ahoj {{.Name}}</p>",
+		"welcome.txt":  "Ahoj {{.Name}}\n",
+	})
+	tmpl := Template{Name: "welcome.html", Subject: "Vítej!"}
+	data := map[string]string{"Name": "Jan & Eva"}
+
+	tests := []struct {
+		name string
+		src  Source
+		want Rendered
+	}{
+		{"defaults", Source{}, Rendered{
+			Subject: "Vítej!",
+			HTML:    "<p>Ahoj Jan &amp; Eva</p>",
+			Text:    "Ahoj Jan & Eva\n",
+		}},
+		{"subject", Source{Subject: "Vítej,\n{{.Name}}!"}, Rendered{
+			Subject: "Vítej, Jan & Eva!",
+			HTML:    "<p>Ahoj Jan &amp; Eva</p>",
+			Text:    "Ahoj Jan & Eva\n",
+		}},
+		// The text file would not match the edited HTML
+		{"HTML", Source{HTML: "<h1>Nazdar {{.Name}}</h1>"}, Rendered{
+			Subject: "Vítej!",
+			HTML:    "<h1>Nazdar Jan &amp; Eva</h1>",
+			Text:    "Nazdar Jan & Eva\n",
+		}},
+		{"text", Source{Text: "Nazdar {{.Name}}"}, Rendered{
+			Subject: "Vítej!",
+			HTML:    "<p>Ahoj Jan &amp; Eva</p>",
+			Text:    "Nazdar Jan & Eva",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderSource(tmpl, tt.src, data)
+			if err != nil {
+				t.Fatalf("RenderSource: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		src  Source
+		part string
+	}{
+		{Source{Subject: "{{.Name"}, "předmět"},
+		{Source{HTML: "<p>{{if .Name}}</p>"}, "HTML"},
+		{Source{Text: "{{.Name.Missing}}"}, "text"},
+	} {
+		if _, err := RenderSource(tmpl, tt.src, data); err == nil || !strings.HasPrefix(err.Error(), tt.part+":") {
+			t.Errorf("%+v: error %v, want a %s error", tt.src, err, tt.part)
+		}
+	}
+}
+
+func TestRenderOverride(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+	writeTemplates(t, map[string]string{"welcome.html": "<p>Ahoj {{.Name}}</p>"})
+	tmpl, _ := LookupTemplate("welcome.html")
+	data := map[string]string{"Name": "Jan"}
+
+	save := func(src Source) db.EmailTemplateVersion {
+		t.Helper()
+		v, err := c.queries.CreateEmailTemplateVersion(ctx, db.CreateEmailTemplateVersionParams{
+			Template: tmpl.Name,
+			Subject:  src.Subject,
+			HtmlBody: src.HTML,
+			TextBody: src.Text,
+			Note:     sql.NullString{String: "test", Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("save: %v", err)
+		}
+		return v
+	}
+	render := func() Rendered {
+		t.Helper()
+		r, err := c.Render(ctx, tmpl, data)
+		if err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+		return r
+	}
+
+	if r := render(); r.Subject != "Vítej v Base48!" || r.HTML != "<p>Ahoj Jan</p>" {
+		t.Errorf("no version: %+v", r)
+	}
+
+	if v := save(Source{Subject: "Ahoj {{.Name}}", HTML: "<b>{{.Name}}</b>"}); v.Version != 1 {
+		t.Errorf("first version %d", v.Version)
+	}
+	if r := render(); r.Subject != "Ahoj Jan" || r.HTML != "<b>Jan</b>" || r.Text != "Jan\n" {
+		t.Errorf("edited: %+v", r)
+	}
+
+	// A version using data the email does not have falls back to the defaults
+	if v := save(Source{HTML: "{{.Name.Missing}}"}); v.Version != 2 {
+		t.Errorf("second version %d", v.Version)
+	}
+	if r := render(); r.Subject != "Vítej v Base48!" || r.HTML != "<p>Ahoj Jan</p>" {
+		t.Errorf("broken version: %+v", r)
+	}
+
+	// Reset is an empty version
+	save(Source{})
+	if r := render(); r.HTML != "<p>Ahoj Jan</p>" {
+		t.Errorf("reset: %+v", r)
+	}
+	versions, err := c.queries.ListEmailTemplateVersions(ctx, tmpl.Name)
+	if err != nil || len(versions) != 3 || versions[0].Version != 3 {
+		t.Errorf("versions %+v, %v", versions, err)
+	}
+
+	// The subject given by the sender is a default too
+	tmpl.Subject = "Jiný předmět"
+	if r := render(); r.Subject != "Jiný předmět" {
+		t.Errorf("sender's subject: %+v", r)
+	}
+}
+
+func TestLookupTemplate(t *testing.T) {
+	writeTemplates(t, map[string]string{
+		"welcome.html": "<p>Ahoj</p>",
+		"custom.html":  "<p>Ahoj</p>",
+		"custom.txt":   "Ahoj",
+	})
+
+	if tmpl, ok := LookupTemplate("welcome.html"); !ok || tmpl.Subject != "Vítej v Base48!" {
+		t.Errorf("welcome.html: %+v, %v", tmpl, ok)
+	}
+	if tmpl, ok := LookupTemplate("custom.html"); !ok || tmpl.Subject != "" {
+		t.Errorf("custom.html: %+v, %v", tmpl, ok)
+	}
+	for _, name := range []string{"missing.html", "custom.txt", "../email/custom.html", ""} {
+		if _, ok := LookupTemplate(name); ok {
+			t.Errorf("%q found", name)
+		}
+	}
+
+	list, err := ListTemplates()
+	if err != nil || len(list) != len(Templates)+1 || list[len(list)-1].Name != "custom.html" {
+		t.Errorf("ListTemplates %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,61 @@
+package email
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	reInvisible = regexp.MustCompile(`(?is)<(head|style|script)\b.*?</(head|style|script)>`)
+	reLink      = regexp.MustCompile(`(?is)<a\b[^>]*?\bhref\s*=\s*["']([^"']*)["'][^>]*>(.*?)</a>`)
+	reListItem  = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	reParagraph = regexp.MustCompile(`(?i)</?(p|h[1-6]|ul|ol|table|blockquote)\b[^>]*>`)
+	reBreak     = regexp.MustCompile(`(?i)<br\s*/?>|</?(div|tr)\b[^>]*>`)
+	reCell      = regexp.MustCompile(`(?i)</t[dh]>`)
+	reTag       = regexp.MustCompile(`(?s)<[^>]*>`)
+	reSpaces    = regexp.MustCompile(`\s+`)
+)
+
+// HTMLToText converts an email rendered from an HTML template to the plain
+// text alternative: block elements become lines, list items "- ", links
+// "text (URL)" and the styles are dropped
+func HTMLToText(s string) string {
+	s = reInvisible.ReplaceAllString(s, "")
+	s = reSpaces.ReplaceAllString(s, " ") // Line breaks come from the markup only
+	s = reLink.ReplaceAllStringFunc(s, func(a string) string {
+		m := reLink.FindStringSubmatch(a)
+		href := strings.TrimPrefix(html.UnescapeString(m[1]), "mailto:")
+		text := strings.TrimSpace(reTag.ReplaceAllString(m[2], ""))
+		switch {
+		case text == "":
+			return href
+		case html.UnescapeString(text) == href:
+			return text
+		default:
+			return text + " (" + href + ")"
+		}
+	})
+	s = reListItem.ReplaceAllString(s, "\n- ")
+	s = reParagraph.ReplaceAllString(s, "\n\n")
+	s = reBreak.ReplaceAllString(s, "\n")
+	s = reCell.ReplaceAllString(s, " ")
+	s = reTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	var lines []string
+	blank := true // Drops leading blank lines
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(strings.ReplaceAll(line, "\u00a0", " "))
+		if line == "" {
+			if !blank {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		lines = append(lines, line)
+		blank = false
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+}
@@ -0,0 +1,152 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/base48/member-portal/internal/config"
+)
+
+// Transport delivers a composed message (see Message.Bytes) to the
+// recipients. from and to are bare addresses of the SMTP envelope.
+type Transport interface {
+	Send(ctx context.Context, from string, to []string, msg []byte) error
+}
+
+// Transport names (EMAIL_TRANSPORT)
+const (
+	TransportSMTP    = "smtp"
+	TransportMaildir = "maildir"
+	TransportNone    = "none"
+)
+
+// SMTP connection security (SMTP_SECURITY)
+const (
+	SecurityAuto     = "auto"     // Implicit TLS on port 465, STARTTLS when the server offers it
+	SecuritySTARTTLS = "starttls" // STARTTLS required
+	SecurityTLS      = "tls"      // Implicit TLS (SMTPS)
+	SecurityNone     = "none"     // Plain connection, e.g. a local relay
+)
+
+const smtpTimeout = 30 * time.Second
+
+// NewTransport creates the transport selected by EMAIL_TRANSPORT. Without
+// EMAIL_TRANSPORT it is SMTP when SMTP_HOST is set. It returns nil when
+// emails are disabled.
+func NewTransport(cfg *config.Config) Transport {
+	name := cfg.EmailTransport
+	if name == "" {
+		name = TransportNone
+		if cfg.SMTPHost != "" {
+			name = TransportSMTP
+		}
+	}
+
+	switch name {
+	case TransportSMTP:
+		return &SMTPTransport{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			Security: cfg.SMTPSecurity,
+		}
+	case TransportMaildir:
+		return &MaildirTransport{Dir: cfg.EmailMaildir}
+	case TransportNone:
+		return nil
+	default:
+		log.Printf("[Email] Warning: unknown EMAIL_TRANSPORT '%s', emails are disabled", name)
+		return nil
+	}
+}
+
+// SMTPTransport sends emails through an SMTP server. The connection is
+// secured according to Security, it authenticates only when Username is set
+// (an unauthenticated local relay otherwise).
+type SMTPTransport struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Security string // SecurityAuto when empty
+}
+
+// Send delivers the message in one SMTP session
+func (t *SMTPTransport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	security := t.Security
+	if security == "" {
+		security = SecurityAuto
+	}
+	implicitTLS := security == SecurityTLS || (security == SecurityAuto && t.Port == 465)
+	tlsConfig := &tls.Config{ServerName: t.Host}
+
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	var err error
+	if implicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	// Bound the whole session, the SMTP client has no timeouts of its own
+	deadline := time.Now().Add(smtpTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake with %s failed: %w", addr, err)
+	}
+	defer c.Close()
+
+	if !implicitTLS && security != SecurityNone {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS failed: %w", err)
+			}
+		} else if security == SecuritySTARTTLS {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+	}
+
+	if t.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", t.Username, t.Password, t.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,209 @@
+package email
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/base48/member-portal/internal/config"
+)
+
+// smtpServer is a minimal SMTP server without TLS recording the sessions
+type smtpServer struct {
+	port int
+	auth bool // Offers AUTH PLAIN
+
+	mu       sync.Mutex
+	sessions []smtpSession
+}
+
+type smtpSession struct {
+	auth string // Decoded AUTH PLAIN response
+	from string
+	to   []string
+	data string
+}
+
+func startSMTPServer(t *testing.T, auth bool) *smtpServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &smtpServer{port: ln.Addr().(*net.TCPAddr).Port, auth: auth}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP test")
+
+	var session smtpSession
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			if s.auth {
+				tp.PrintfLine("250-localhost")
+				tp.PrintfLine("250 AUTH PLAIN")
+			} else {
+				tp.PrintfLine("250 localhost")
+			}
+		case "AUTH":
+			_, response, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(response)
+			session.auth = string(decoded)
+			tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			session.from = arg
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			session.to = append(session.to, arg)
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			session.data = string(data)
+			tp.PrintfLine("250 OK queued")
+		case "QUIT":
+			s.mu.Lock()
+			s.sessions = append(s.sessions, session)
+			s.mu.Unlock()
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) Sessions() []smtpSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpSession(nil), s.sessions...)
+}
+
+func TestSMTPTransport(t *testing.T) {
+	ctx := context.Background()
+	msg := []byte("Subject: Test\r\n\r\nAhoj\r\n")
+
+	t.Run("local relay", func(t *testing.T) {
+		srv := startSMTPServer(t, false)
+		transport := &SMTPTransport{Host: "127.0.0.1", Port: srv.port}
+		if err := transport.Send(ctx, "noreply@example.com", []string{"novak@example.com"}, msg); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+
+		sessions := srv.Sessions()
+		if len(sessions) != 1 {
+			t.Fatalf("sessions %+v", sessions)
+		}
+		s := sessions[0]
+		if s.auth != "" || s.from != "FROM:<noreply@example.com>" || len(s.to) != 1 || s.to[0] != "TO:<novak@example.com>" {
+			t.Errorf("session %+v", s)
+		}
+		if s.data != "Subject: Test\n\nAhoj\n" { // ReadDotBytes turns CRLF to LF
+			t.Errorf("data %q", s.data)
+		}
+	})
+
+	t.Run("authenticated", func(t *testing.T) {
+		srv := startSMTPServer(t, true)
+		transport := &SMTPTransport{Host: "127.0.0.1", Port: srv.port, Username: "portal", Password: "secret", Security: SecurityNone}
+		if err := transport.Send(ctx, "noreply@example.com", []string{"novak@example.com"}, msg); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if sessions := srv.Sessions(); len(sessions) != 1 || sessions[0].auth != "\x00portal\x00secret" {
+			t.Errorf("sessions %+v", sessions)
+		}
+	})
+
+	t.Run("STARTTLS required", func(t *testing.T) {
+		srv := startSMTPServer(t, false)
+		transport := &SMTPTransport{Host: "127.0.0.1", Port: srv.port, Security: SecuritySTARTTLS}
+		err := transport.Send(ctx, "noreply@example.com", []string{"novak@example.com"}, msg)
+		if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+			t.Errorf("sent without STARTTLS: %v", err)
+		}
+		if sessions := srv.Sessions(); len(sessions) != 0 {
+			t.Errorf("sessions %+v", sessions)
+		}
+	})
+}
+
+func TestMaildirTransport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	transport := &MaildirTransport{Dir: dir}
+
+	for _, subject := range []string{"První", "Druhý"} {
+		msg := []byte("Subject: " + subject + "\r\n\r\nAhoj\r\n")
+		if err := transport.Send(context.Background(), "noreply@example.com", []string{"novak@example.com"}, msg); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("new/ %v, %v", files, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "new", files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "Return-Path: <noreply@example.com>\r\nDelivered-To: novak@example.com\r\nSubject: ") {
+		t.Errorf("message %q", data)
+	}
+	if tmp, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(tmp) != 0 {
+		t.Errorf("left in tmp/: %v", tmp)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{"not configured", config.Config{}, TransportNone},
+		{"SMTP host", config.Config{SMTPHost: "smtp.example.com"}, TransportSMTP},
+		{"maildir", config.Config{EmailTransport: "maildir", SMTPHost: "smtp.example.com"}, TransportMaildir},
+		{"disabled", config.Config{EmailTransport: "none", SMTPHost: "smtp.example.com"}, TransportNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(&tt.cfg, nil)
+			if got := c.TransportName(); got != tt.want {
+				t.Errorf("transport %s, want %s", got, tt.want)
+			}
+			if c.Enabled() != (tt.want != TransportNone) {
+				t.Errorf("Enabled() = %v", c.Enabled())
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Package fees decides which monthly membership fees a member owes: the
+// billing periods (calendar months), the days of each period the member was
+// accepted (from date_joined and the membership state history), the level
+// the period is billed at (from the level history) and the fee prorated to
+// those days.
+package fees
+
+import (
+	"sort"
+	"time"
+
+	"github.com/base48/member-portal/internal/dates"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// PeriodOf returns the period containing t: the first day of its month, as
+// UTC midnight like fees.period_start
+func PeriodOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Periods returns the periods from the one containing from to the one
+// containing to, both included
+func Periods(from, to time.Time) []time.Time {
+	var periods []time.Time
+	for p := PeriodOf(from); !p.After(PeriodOf(to)); p = p.AddDate(0, 1, 0) {
+		periods = append(periods, p)
+	}
+	return periods
+}
+
+// DaysIn returns the number of days of the period
+func DaysIn(period time.Time) int {
+	return PeriodOf(period).AddDate(0, 1, -1).Day()
+}
+
+// Prorate returns the fee for days of the period's days, rounded to whole
+// crowns. The full amount is returned for the whole period.
+func Prorate(amount money.Amount, days int, period time.Time) money.Amount {
+	total := DaysIn(period)
+	switch {
+	case days <= 0:
+		return money.Zero
+	case days >= total:
+		return amount
+	}
+	return amount.MulRatio(int64(days), int64(total)).RoundKoruny()
+}
+
+// change is a state the member entered on a day
+type change struct {
+	day   time.Time
+	state string
+}
+
+// Timeline is a member's membership state day by day
+type Timeline struct {
+	joined  time.Time // Nothing is billed before the member joined
+	initial string    // State before the first recorded change
+	changes []change  // Oldest first
+}
+
+// NewTimeline builds the timeline from the member and their state history
+// (as returned by ListStateHistoryByUser, in any order). Before the first
+// recorded change the member is taken to be in its from_state, without
+// history in their current state.
+func NewTimeline(member db.User, history []db.MembershipStateHistory) Timeline {
+	sorted := append([]db.MembershipStateHistory(nil), history...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].ChangedAt.Equal(sorted[j].ChangedAt) {
+			return sorted[i].ChangedAt.Before(sorted[j].ChangedAt)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	tl := Timeline{joined: dates.Day(member.DateJoined), initial: member.State}
+	if len(sorted) > 0 {
+		tl.initial = sorted[0].FromState
+	}
+	for _, h := range sorted {
+		tl.changes = append(tl.changes, change{day: dates.Day(h.ChangedAt), state: h.ToState})
+	}
+	return tl
+}
+
+// StateOn returns the member's state on the day (the last change of a day
+// counts for the whole day)
+func (tl Timeline) StateOn(d time.Time) string {
+	d = dates.Day(d)
+	state := tl.initial
+	for _, c := range tl.changes {
+		if c.day.After(d) {
+			break
+		}
+		state = c.state
+	}
+	return state
+}
+
+// AcceptedDays returns how many days of the period the member was a member
+// in the accepted state. Days of suspension do not count.
+func (tl Timeline) AcceptedDays(period time.Time) int {
+	return len(tl.acceptedDays(period))
+}
+
+// FirstAcceptedDay returns the first day of the period the member was
+// accepted, false when there is none
+func (tl Timeline) FirstAcceptedDay(period time.Time) (time.Time, bool) {
+	days := tl.acceptedDays(period)
+	if len(days) == 0 {
+		return time.Time{}, false
+	}
+	return days[0], true
+}
+
+// acceptedDays lists the days of the period the member was accepted
+func (tl Timeline) acceptedDays(period time.Time) []time.Time {
+	var days []time.Time
+	for d := PeriodOf(period); d.Month() == PeriodOf(period).Month(); d = d.AddDate(0, 0, 1) {
+		if !d.Before(tl.joined) && tl.StateOn(d) == membership.StateAccepted {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// LevelOf returns the level and fee a period is billed at: the level in
+// effect on the first day of the period the member was accepted (see
+// membership.LevelOn). A zero fee means the level amount.
+func (tl Timeline) LevelOf(member db.User, history []db.MembershipLevelHistory, period time.Time) (int64, money.Amount) {
+	d, ok := tl.FirstAcceptedDay(period)
+	if !ok {
+		d = PeriodOf(period)
+	}
+	return membership.LevelOn(member, history, d)
+}
@@ -0,0 +1,151 @@
+package fees
+
+import (
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestPeriods(t *testing.T) {
+	got := Periods(date("2023-11-15 10:00"), date("2024-02-01 00:00"))
+	want := []string{"2023-11", "2023-12", "2024-01", "2024-02"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d periods, want %d", len(got), len(want))
+	}
+	for i, p := range got {
+		if p.Format("2006-01") != want[i] || p.Day() != 1 || p.Hour() != 0 {
+			t.Errorf("period %d = %s, want %s-01", i, p, want[i])
+		}
+	}
+	if got := Periods(date("2024-03-01 00:00"), date("2024-02-01 00:00")); len(got) != 0 {
+		t.Errorf("reversed range gave %d periods", len(got))
+	}
+	if DaysIn(date("2024-02-10 00:00")) != 29 || DaysIn(date("2023-02-01 00:00")) != 28 {
+		t.Error("wrong number of days in February")
+	}
+}
+
+func TestProrate(t *testing.T) {
+	march := date("2024-03-01 00:00")
+	tests := []struct {
+		days int
+		want money.Amount
+	}{
+		{31, money.FromKoruny(1000)},
+		{40, money.FromKoruny(1000)},
+		{16, money.FromKoruny(516)}, // 516.13
+		{1, money.FromKoruny(32)},   // 32.26
+		{0, money.Zero},
+	}
+	for _, tt := range tests {
+		if got := Prorate(money.FromKoruny(1000), tt.days, march); got != tt.want {
+			t.Errorf("Prorate(1000, %d) = %s, want %s", tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	history := func(from, to, at string) db.MembershipStateHistory {
+		return db.MembershipStateHistory{FromState: from, ToState: to, ChangedAt: date(at)}
+	}
+
+	tests := []struct {
+		name    string
+		member  db.User
+		history []db.MembershipStateHistory
+		period  string
+		want    int
+	}{
+		{
+			name:   "legacy member without history",
+			member: db.User{State: membership.StateAccepted, DateJoined: date("2020-01-01 00:00")},
+			period: "2024-02-01 00:00",
+			want:   29,
+		},
+		{
+			name:   "joined mid-month",
+			member: db.User{State: membership.StateAccepted, DateJoined: date("2024-03-17 14:30")},
+			history: []db.MembershipStateHistory{
+				history(membership.StateAwaiting, membership.StateAccepted, "2024-03-17 14:30"),
+			},
+			period: "2024-03-01 00:00",
+			want:   15,
+		},
+		{
+			name:   "not yet a member",
+			member: db.User{State: membership.StateAccepted, DateJoined: date("2024-03-17 14:30")},
+			period: "2024-02-01 00:00",
+			want:   0,
+		},
+		{
+			name:   "suspended on the 11th and reinstated on the 21st",
+			member: db.User{State: membership.StateAccepted, DateJoined: date("2020-01-01 00:00")},
+			history: []db.MembershipStateHistory{
+				// In any order
+				history(membership.StateSuspended, membership.StateAccepted, "2024-04-21 08:00"),
+				history(membership.StateAccepted, membership.StateSuspended, "2024-04-11 23:59"),
+			},
+			period: "2024-04-01 00:00",
+			want:   20,
+		},
+		{
+			name:   "suspended before the history was recorded",
+			member: db.User{State: membership.StateSuspended, DateJoined: date("2020-01-01 00:00")},
+			period: "2024-04-01 00:00",
+			want:   0,
+		},
+		{
+			name:   "left",
+			member: db.User{State: membership.StateExmember, DateJoined: date("2020-01-01 00:00")},
+			history: []db.MembershipStateHistory{
+				history(membership.StateAccepted, membership.StateExmember, "2024-04-03 12:00"),
+			},
+			period: "2024-04-01 00:00",
+			want:   2,
+		},
+	}
+	for _, tt := range tests {
+		tl := NewTimeline(tt.member, tt.history)
+		if got := tl.AcceptedDays(date(tt.period)); got != tt.want {
+			t.Errorf("%s: AcceptedDays = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLevelOf(t *testing.T) {
+	member := db.User{State: membership.StateAccepted, DateJoined: date("2024-03-17 14:30"), LevelID: 4}
+	tl := NewTimeline(member, []db.MembershipStateHistory{
+		{FromState: membership.StateAwaiting, ToState: membership.StateAccepted, ChangedAt: date("2024-03-17 14:30")},
+	})
+	history := []db.MembershipLevelHistory{
+		// Registered as awaiting, accepted as Student, asked for Supporter from May
+		{ID: 1, LevelID: 1, EffectiveFrom: date("2024-02-20 00:00")},
+		{ID: 2, LevelID: 2, LevelActualAmount: money.FromKoruny(600), EffectiveFrom: date("2024-03-17 00:00")},
+		{ID: 3, LevelID: 4, LevelActualAmount: money.FromKoruny(2000), EffectiveFrom: date("2024-05-01 00:00")},
+	}
+
+	tests := []struct {
+		period string
+		level  int64
+	}{
+		{"2024-03-01 00:00", 2}, // First accepted on the 17th
+		{"2024-04-01 00:00", 2},
+		{"2024-05-01 00:00", 4},
+	}
+	for _, tt := range tests {
+		if level, _ := tl.LevelOf(member, history, date(tt.period)); level != tt.level {
+			t.Errorf("LevelOf(%s) = %d, want %d", tt.period[:7], level, tt.level)
+		}
+	}
+}
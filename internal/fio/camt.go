@@ -0,0 +1,180 @@
+package fio
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/money"
+)
+
+// camtDocument is the subset of ISO 20022 CAMT.053 (BkToCstmrStmt) we need
+type camtDocument struct {
+	Statements []struct {
+		Entries []camtEntry `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtEntry struct {
+	Amount struct {
+		Value    string `xml:",chardata"`
+		Currency string `xml:"Ccy,attr"`
+	} `xml:"Amt"`
+	CreditDebit string `xml:"CdtDbtInd"`
+	BookingDate string `xml:"BookgDt>Dt"`
+	BookingTime string `xml:"BookgDt>DtTm"`
+	ValueDate   string `xml:"ValDt>Dt"`
+	Reference   string `xml:"AcctSvcrRef"`
+	Details     []struct {
+		Refs struct {
+			Reference  string `xml:"AcctSvcrRef"`
+			EndToEndID string `xml:"EndToEndId"`
+		} `xml:"Refs"`
+		DebtorName       string   `xml:"RltdPties>Dbtr>Nm"`
+		DebtorIBAN       string   `xml:"RltdPties>DbtrAcct>Id>IBAN"`
+		DebtorAccount    string   `xml:"RltdPties>DbtrAcct>Id>Othr>Id"`
+		CreditorName     string   `xml:"RltdPties>Cdtr>Nm"`
+		CreditorIBAN     string   `xml:"RltdPties>CdtrAcct>Id>IBAN"`
+		CreditorAccount  string   `xml:"RltdPties>CdtrAcct>Id>Othr>Id"`
+		DebtorBankCode   string   `xml:"RltdAgts>DbtrAgt>FinInstnId>Othr>Id"`
+		CreditorBankCode string   `xml:"RltdAgts>CdtrAgt>FinInstnId>Othr>Id"`
+		DebtorBankName   string   `xml:"RltdAgts>DbtrAgt>FinInstnId>Nm"`
+		CreditorBankName string   `xml:"RltdAgts>CdtrAgt>FinInstnId>Nm"`
+		Unstructured     []string `xml:"RmtInf>Ustrd"`
+		CreditorRef      string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	} `xml:"NtryDtls>TxDtls"`
+	AdditionalInfo string `xml:"AddtlNtryInf"`
+}
+
+// Czech banks put symbols into EndToEndId as "/VS1001/SS2024/KS0308"
+var camtSymbol = regexp.MustCompile(`(VS|SS|KS):?(\d+)`)
+
+// parseCAMT parses an ISO 20022 CAMT.053 statement. The transaction ID is
+// taken from AcctSvcrRef, which FIO fills with the same movement ID as the API.
+func parseCAMT(data []byte) ([]Transaction, error) {
+	var doc camtDocument
+	decoder := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse XML: %w", err)
+	}
+
+	var transactions []Transaction
+	for _, stmt := range doc.Statements {
+		for i, entry := range stmt.Entries {
+			tx, err := parseCAMTEntry(entry)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %w", i+1, err)
+			}
+			transactions = append(transactions, tx)
+		}
+	}
+
+	if len(doc.Statements) == 0 {
+		return nil, fmt.Errorf("no BkToCstmrStmt/Stmt element found, is this a CAMT.053 file?")
+	}
+
+	return transactions, nil
+}
+
+func parseCAMTEntry(entry camtEntry) (Transaction, error) {
+	ref := strings.TrimSpace(entry.Reference)
+	if ref == "" && len(entry.Details) > 0 {
+		ref = strings.TrimSpace(entry.Details[0].Refs.Reference)
+	}
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("invalid transaction ID (AcctSvcrRef) %q", ref)
+	}
+
+	amount, err := money.Parse(entry.Amount.Value)
+	if err != nil {
+		return Transaction{}, err
+	}
+	switch entry.CreditDebit {
+	case "CRDT":
+	case "DBIT":
+		amount = amount.Neg()
+	default:
+		return Transaction{}, fmt.Errorf("invalid CdtDbtInd %q", entry.CreditDebit)
+	}
+
+	dateStr := entry.BookingDate
+	if dateStr == "" && len(entry.BookingTime) >= 10 {
+		dateStr = entry.BookingTime[:10]
+	}
+	if dateStr == "" {
+		dateStr = entry.ValueDate
+	}
+	date, err := time.Parse("2006-01-02", strings.TrimSpace(dateStr))
+	if err != nil {
+		return Transaction{}, fmt.Errorf("invalid booking date %q", dateStr)
+	}
+
+	tx := Transaction{
+		ID:       id,
+		Date:     FormatDate(date),
+		Amount:   amount,
+		Currency: entry.Amount.Currency,
+		Comment:  strings.TrimSpace(entry.AdditionalInfo),
+	}
+
+	if len(entry.Details) == 0 {
+		return tx, nil
+	}
+	d := entry.Details[0]
+
+	// The counterparty is the debtor of incoming and the creditor of outgoing payments
+	if amount.IsNegative() {
+		tx.AccountName = d.CreditorName
+		tx.AccountNumber = firstNonEmpty(d.CreditorAccount, d.CreditorIBAN)
+		tx.BankCode = d.CreditorBankCode
+		tx.BankName = d.CreditorBankName
+	} else {
+		tx.AccountName = d.DebtorName
+		tx.AccountNumber = firstNonEmpty(d.DebtorAccount, d.DebtorIBAN)
+		tx.BankCode = d.DebtorBankCode
+		tx.BankName = d.DebtorBankName
+	}
+	tx.AccountName = strings.TrimSpace(tx.AccountName)
+	tx.Message = strings.TrimSpace(strings.Join(d.Unstructured, " "))
+
+	for _, m := range camtSymbol.FindAllStringSubmatch(d.Refs.EndToEndID, -1) {
+		switch m[1] {
+		case "VS":
+			tx.VariableSymbol = normalizeSymbol(m[2])
+		case "SS":
+			tx.SpecificSymbol = normalizeSymbol(m[2])
+		}
+	}
+	if tx.VariableSymbol == "" && isDigits(d.CreditorRef) {
+		tx.VariableSymbol = normalizeSymbol(d.CreditorRef)
+	}
+
+	return tx, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -3,140 +3,289 @@ package fio
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/base48/member-portal/internal/money"
 )
 
+// DefaultRequestInterval is the FIO API rate limit: one request per token
+// every 30 seconds, otherwise the API answers 409 Conflict
+const DefaultRequestInterval = 30 * time.Second
+
+// defaultMaxRetries is how many times a request rejected by the rate limit is retried
+const defaultMaxRetries = 3
+
 // Client represents a FIO Bank API client
 type Client struct {
 	token      string
 	httpClient *http.Client
 	baseURL    string
+
+	// Rate limiting
+	interval    time.Duration
+	maxRetries  int
+	mu          sync.Mutex
+	lastRequest time.Time
+}
+
+// DefaultBaseURL is the production FIO API endpoint
+const DefaultBaseURL = "https://fioapi.fio.cz/v1/rest"
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithBaseURL points the client to a different API endpoint (e.g. a fake
+// server from package fiotest). An empty URL keeps the default.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		if baseURL != "" {
+			c.baseURL = strings.TrimRight(baseURL, "/")
+		}
+	}
+}
+
+// WithHTTPClient replaces the default HTTP client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRequestInterval overrides the minimum time between two requests.
+// Only useful against a fake server, the real API enforces 30 seconds.
+func WithRequestInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.interval = interval
+	}
 }
 
 // NewClient creates a new FIO API client
-func NewClient(token string) *Client {
-	return &Client{
+func NewClient(token string, opts ...Option) *Client {
+	c := &Client{
 		token: token,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		baseURL: "https://fioapi.fio.cz/v1/rest",
+		baseURL:    DefaultBaseURL,
+		interval:   DefaultRequestInterval,
+		maxRetries: defaultMaxRetries,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // Transaction represents a single FIO bank transaction
 type Transaction struct {
-	ID                int64       `json:"column22"` // ID transakce
-	Date              string      `json:"column0"`  // Datum (YYYY-MM-DD format)
-	Amount            float64     `json:"column1"`  // Částka
-	Currency          string      `json:"column14"` // Měna
-	AccountNumber     string      `json:"column2"`  // Protiúčet
-	AccountName       string      `json:"column10"` // Název protiúčtu
-	BankCode          string      `json:"column3"`  // Kód banky
-	BankName          string      `json:"column12"` // Název banky
-	VariableSymbol    string      `json:"column5"`  // Variabilní symbol
-	SpecificSymbol    string      `json:"column6"`  // Specifický symbol
-	Message           string      `json:"column16"` // Zpráva pro příjemce
-	Comment           string      `json:"column25"` // Komentář
-	TransactionType   string      `json:"column8"`  // Typ transakce
-	Identification    string      `json:"column7"`  // Identifikace transakce
+	ID              int64        `json:"column22"` // ID transakce
+	Date            string       `json:"column0"`  // Datum (YYYY-MM-DD format)
+	Amount          money.Amount `json:"column1"`  // Částka
+	Currency        string       `json:"column14"` // Měna
+	AccountNumber   string       `json:"column2"`  // Protiúčet
+	AccountName     string       `json:"column10"` // Název protiúčtu
+	BankCode        string       `json:"column3"`  // Kód banky
+	BankName        string       `json:"column12"` // Název banky
+	VariableSymbol  string       `json:"column5"`  // Variabilní symbol
+	SpecificSymbol  string       `json:"column6"`  // Specifický symbol
+	Message         string       `json:"column16"` // Zpráva pro příjemce
+	Comment         string       `json:"column25"` // Komentář
+	TransactionType string       `json:"column8"`  // Typ transakce
+	Identification  string       `json:"column7"`  // Identifikace transakce
+}
+
+// StatementInfo is the account statement header returned with every list of
+// transactions. IDTo is the ID of the last transaction in the response (0 if
+// there are none) and is used as the incremental sync cursor.
+type StatementInfo struct {
+	AccountID      string  `json:"accountId"`
+	BankID         string  `json:"bankId"`
+	Currency       string  `json:"currency"`
+	IBAN           string  `json:"iban"`
+	BIC            string  `json:"bic"`
+	OpeningBalance float64 `json:"openingBalance"`
+	ClosingBalance float64 `json:"closingBalance"`
+	DateStart      string  `json:"dateStart"`
+	DateEnd        string  `json:"dateEnd"`
+	YearList       int     `json:"yearList"`
+	IDList         int     `json:"idList"`
+	IDFrom         int64   `json:"idFrom"`
+	IDTo           int64   `json:"idTo"`
+	IDLastDownload int64   `json:"idLastDownload"`
 }
 
 // TransactionList represents the response from FIO API
 type TransactionList struct {
 	AccountStatement struct {
-		Info struct {
-			AccountID   string `json:"accountId"`
-			BankID      string `json:"bankId"`
-			Currency    string `json:"currency"`
-			IBAN        string `json:"iban"`
-			BIC         string `json:"bic"`
-			OpeningBalance float64 `json:"openingBalance"`
-			ClosingBalance float64 `json:"closingBalance"`
-			DateStart   string `json:"dateStart"`
-			DateEnd     string `json:"dateEnd"`
-			YearList    int    `json:"yearList"`
-			IDList      int    `json:"idList"`
-			IDFrom      int64  `json:"idFrom"`
-			IDTo        int64  `json:"idTo"`
-			IDLastDownload int64 `json:"idLastDownload"`
-		} `json:"info"`
+		Info            StatementInfo `json:"info"`
 		TransactionList struct {
 			Transactions []map[string]interface{} `json:"transaction"`
 		} `json:"transactionList"`
 	} `json:"accountStatement"`
 }
 
+// Statement is a parsed API response: statement header and transactions
+type Statement struct {
+	Info         StatementInfo
+	Transactions []Transaction
+}
+
+// LastID returns the highest transaction ID in the statement, or 0 if it is empty
+func (s *Statement) LastID() int64 {
+	last := s.Info.IDTo
+	for _, tx := range s.Transactions {
+		if tx.ID > last {
+			last = tx.ID
+		}
+	}
+	return last
+}
+
 // FetchTransactionsByPeriod fetches transactions for a specific date range
 // dateFrom and dateTo should be in format "YYYY-MM-DD"
 func (c *Client) FetchTransactionsByPeriod(ctx context.Context, dateFrom, dateTo string) ([]Transaction, error) {
+	st, err := c.FetchPeriod(ctx, dateFrom, dateTo)
+	if err != nil {
+		return nil, err
+	}
+	return st.Transactions, nil
+}
+
+// FetchPeriod is like FetchTransactionsByPeriod but also returns the statement info
+func (c *Client) FetchPeriod(ctx context.Context, dateFrom, dateTo string) (*Statement, error) {
 	url := fmt.Sprintf("%s/periods/%s/%s/%s/transactions.json",
 		c.baseURL, c.token, dateFrom, dateTo)
-
-	return c.fetchTransactions(ctx, url)
+	return c.fetchStatement(ctx, url)
 }
 
 // FetchTransactionsSinceLastDownload fetches all new transactions since last download
 func (c *Client) FetchTransactionsSinceLastDownload(ctx context.Context) ([]Transaction, error) {
+	st, err := c.FetchSinceLastDownload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return st.Transactions, nil
+}
+
+// FetchSinceLastDownload is like FetchTransactionsSinceLastDownload but also
+// returns the statement info. FIO moves its download pointer to the last
+// returned transaction.
+func (c *Client) FetchSinceLastDownload(ctx context.Context) (*Statement, error) {
 	url := fmt.Sprintf("%s/last/%s/transactions.json", c.baseURL, c.token)
-	return c.fetchTransactions(ctx, url)
+	return c.fetchStatement(ctx, url)
 }
 
 // FetchTransactionsByID fetches transactions from a specific year and ID
 func (c *Client) FetchTransactionsByID(ctx context.Context, year int, idFrom int64) ([]Transaction, error) {
 	url := fmt.Sprintf("%s/by-id/%s/%d/%d/transactions.json",
 		c.baseURL, c.token, year, idFrom)
-	return c.fetchTransactions(ctx, url)
+	st, err := c.fetchStatement(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return st.Transactions, nil
 }
 
 // SetLastDownloadDate sets a checkpoint for future "since last download" calls
 // date should be in format "YYYY-MM-DD"
 func (c *Client) SetLastDownloadDate(ctx context.Context, date string) error {
 	url := fmt.Sprintf("%s/set-last-date/%s/%s/", c.baseURL, c.token, date)
+	_, err := c.get(ctx, url)
+	return err
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
+// SetLastID moves the "since last download" pointer so that the next
+// FetchSinceLastDownload returns transactions after the given ID
+func (c *Client) SetLastID(ctx context.Context, id int64) error {
+	url := fmt.Sprintf("%s/set-last-id/%s/%d/", c.baseURL, c.token, id)
+	_, err := c.get(ctx, url)
+	return err
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
+// get performs a rate-limited GET request and returns the response body.
+// Requests rejected by the rate limit (409 Conflict) are retried.
+func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.waitForRateLimit(ctx); err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-	}
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", c.redact(err))
+		}
+
+		resp, err := c.httpClient.Do(req)
+		c.markRequest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute request: %w", c.redact(err))
+		}
 
-	return nil
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusConflict && attempt < c.maxRetries {
+			// Rate limit hit (e.g. another process used the token) - wait and retry
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		}
+
+		return body, nil
+	}
 }
 
-// fetchTransactions is a helper that performs the actual HTTP request and parsing
-func (c *Client) fetchTransactions(ctx context.Context, url string) ([]Transaction, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// waitForRateLimit blocks until the next request is allowed
+func (c *Client) waitForRateLimit(ctx context.Context) error {
+	c.mu.Lock()
+	wait := time.Until(c.lastRequest.Add(c.interval))
+	c.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+func (c *Client) markRequest() {
+	c.mu.Lock()
+	c.lastRequest = time.Now()
+	c.mu.Unlock()
+}
+
+// redact removes the API token (part of every URL) from error messages
+func (c *Client) redact(err error) error {
+	if c.token == "" {
+		return err
 	}
+	return errors.New(strings.ReplaceAll(err.Error(), c.token, "***"))
+}
 
-	body, err := io.ReadAll(resp.Body)
+// fetchStatement is a helper that performs the actual HTTP request and parsing
+func (c *Client) fetchStatement(ctx context.Context, url string) (*Statement, error) {
+	body, err := c.get(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
 	}
 
 	var result TransactionList
@@ -163,7 +312,7 @@ func (c *Client) fetchTransactions(ctx context.Context, url string) ([]Transacti
 		}
 		if v, ok := rawTx["column1"].(map[string]interface{}); ok {
 			if amount, ok := v["value"].(float64); ok {
-				tx.Amount = amount
+				tx.Amount = money.FromFloat(amount)
 			}
 		}
 		if v, ok := rawTx["column14"].(map[string]interface{}); ok {
@@ -227,7 +376,10 @@ func (c *Client) fetchTransactions(ctx context.Context, url string) ([]Transacti
 		transactions = append(transactions, tx)
 	}
 
-	return transactions, nil
+	return &Statement{
+		Info:         result.AccountStatement.Info,
+		Transactions: transactions,
+	}, nil
 }
 
 // FormatDate converts time.Time to FIO API date format (YYYY-MM-DD)
@@ -0,0 +1,249 @@
+package fio_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/fio"
+	"github.com/base48/member-portal/internal/fio/fiotest"
+	"github.com/base48/member-portal/internal/money"
+)
+
+const testToken = "test-token-0123456789"
+
+func newTestClient(t *testing.T) (*fio.Client, *fiotest.Server) {
+	t.Helper()
+	srv := fiotest.NewServer(testToken)
+	t.Cleanup(srv.Close)
+	client := fio.NewClient(testToken, fio.WithBaseURL(srv.URL), fio.WithRequestInterval(0))
+	return client, srv
+}
+
+func TestFetchTransactionsByPeriodParsing(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	transactions, err := client.FetchTransactionsByPeriod(context.Background(), "2024-01-01", "2024-04-30")
+	if err != nil {
+		t.Fatalf("FetchTransactionsByPeriod: %v", err)
+	}
+	if len(transactions) != 8 {
+		t.Fatalf("got %d transactions, want 8", len(transactions))
+	}
+
+	byID := make(map[int64]fio.Transaction)
+	for _, tx := range transactions {
+		byID[tx.ID] = tx
+	}
+
+	tests := []struct {
+		name    string
+		id      int64
+		date    string
+		amount  string
+		vs      string
+		account string
+		bank    string
+		message string
+	}{
+		{"string VS", 26000000001, "2024-01-05+0100", "1000.00", "1001", "NOVAK JAN", "2010", "clensky prispevek leden"},
+		{"numeric VS", 26000000002, "2024-01-10+0100", "500.50", "1002", "Svobodova Petra", "0800", ""},
+		{"outgoing payment", 26000000003, "2024-01-20+0100", "-250.00", "0", "Pronajimatel s.r.o.", "0100", "najem"},
+		{"null VS, VS in message", 26000000004, "2024-02-03+0100", "1000.00", "", "NOVAK JAN", "2010", "1001"},
+		{"null account name", 26000000006, "2024-03-01+0100", "150.00", "", "", "5500", "dar na 3D tiskarnu"},
+		{"decimal amount", 26000000007, "2024-03-05+0100", "333.33", "1002", "Svobodova Petra", "0800", "doplatek"},
+		{"card payment with null columns", 26000000008, "2024-04-02+0200", "-1200.00", "", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, ok := byID[tt.id]
+			if !ok {
+				t.Fatalf("transaction %d not found", tt.id)
+			}
+			if tx.Date != tt.date {
+				t.Errorf("Date = %q, want %q", tx.Date, tt.date)
+			}
+			if want := money.MustParse(tt.amount); tx.Amount != want {
+				t.Errorf("Amount = %s, want %s", tx.Amount, want)
+			}
+			if tx.VariableSymbol != tt.vs {
+				t.Errorf("VariableSymbol = %q, want %q", tx.VariableSymbol, tt.vs)
+			}
+			if tx.AccountName != tt.account {
+				t.Errorf("AccountName = %q, want %q", tx.AccountName, tt.account)
+			}
+			if tx.BankCode != tt.bank {
+				t.Errorf("BankCode = %q, want %q", tx.BankCode, tt.bank)
+			}
+			if tx.Message != tt.message {
+				t.Errorf("Message = %q, want %q", tx.Message, tt.message)
+			}
+			if tx.Currency != "CZK" {
+				t.Errorf("Currency = %q, want CZK", tx.Currency)
+			}
+		})
+	}
+}
+
+func TestFetchPeriodFiltersByDate(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	tests := []struct {
+		from, to string
+		want     int
+		lastID   int64
+	}{
+		{"2024-01-01", "2024-01-31", 3, 26000000003},
+		{"2024-02-03", "2024-02-03", 1, 26000000004},
+		{"2024-03-01", "2024-12-31", 3, 26000000008},
+		{"2023-01-01", "2023-12-31", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"_"+tt.to, func(t *testing.T) {
+			st, err := client.FetchPeriod(context.Background(), tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("FetchPeriod: %v", err)
+			}
+			if len(st.Transactions) != tt.want {
+				t.Errorf("got %d transactions, want %d", len(st.Transactions), tt.want)
+			}
+			if st.LastID() != tt.lastID {
+				t.Errorf("LastID() = %d, want %d", st.LastID(), tt.lastID)
+			}
+			if st.Info.AccountID != "2800000001" {
+				t.Errorf("Info.AccountID = %q", st.Info.AccountID)
+			}
+		})
+	}
+}
+
+func TestFetchSinceLastDownload(t *testing.T) {
+	client, srv := newTestClient(t)
+	ctx := context.Background()
+
+	if err := client.SetLastID(ctx, 26000000005); err != nil {
+		t.Fatalf("SetLastID: %v", err)
+	}
+
+	st, err := client.FetchSinceLastDownload(ctx)
+	if err != nil {
+		t.Fatalf("FetchSinceLastDownload: %v", err)
+	}
+	if len(st.Transactions) != 3 || st.Transactions[0].ID != 26000000006 {
+		t.Fatalf("got %d transactions starting at %v, want 3 starting at 26000000006", len(st.Transactions), st.Transactions)
+	}
+	if srv.LastID() != 26000000008 {
+		t.Errorf("server pointer = %d, want 26000000008", srv.LastID())
+	}
+
+	// Nothing new - idTo is null and LastID falls back to 0
+	st, err = client.FetchSinceLastDownload(ctx)
+	if err != nil {
+		t.Fatalf("FetchSinceLastDownload: %v", err)
+	}
+	if len(st.Transactions) != 0 || st.LastID() != 0 {
+		t.Errorf("got %d transactions, LastID %d; want none", len(st.Transactions), st.LastID())
+	}
+
+	srv.AddTransaction(fiotest.Transaction{
+		ID:             26000000009,
+		Date:           time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+		Amount:         750,
+		VariableSymbol: "1003",
+	})
+
+	st, err = client.FetchSinceLastDownload(ctx)
+	if err != nil {
+		t.Fatalf("FetchSinceLastDownload: %v", err)
+	}
+	if len(st.Transactions) != 1 || st.LastID() != 26000000009 {
+		t.Fatalf("got %d transactions, LastID %d; want the new one", len(st.Transactions), st.LastID())
+	}
+	if st.Transactions[0].Amount != money.FromKoruny(750) || st.Transactions[0].VariableSymbol != "1003" {
+		t.Errorf("unexpected transaction %+v", st.Transactions[0])
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		conflicts int
+		wantErr   bool
+		requests  int
+	}{
+		{"no conflict", 0, false, 1},
+		{"retried once", 1, false, 2},
+		{"retried up to the limit", 3, false, 4},
+		{"gives up", 4, true, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, srv := newTestClient(t)
+			srv.RateLimitNext(tt.conflicts)
+
+			_, err := client.FetchTransactionsByPeriod(context.Background(), "2024-01-01", "2024-01-31")
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "409") {
+					t.Errorf("err = %v, want a 409 error", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if got := len(srv.Requests()); got != tt.requests {
+				t.Errorf("server saw %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestRequestInterval(t *testing.T) {
+	srv := fiotest.NewServer(testToken)
+	defer srv.Close()
+
+	interval := 50 * time.Millisecond
+	client := fio.NewClient(testToken, fio.WithBaseURL(srv.URL), fio.WithRequestInterval(interval))
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := client.FetchPeriod(ctx, "2024-01-01", "2024-01-31"); err != nil {
+			t.Fatalf("FetchPeriod: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 2*interval {
+		t.Errorf("3 requests took %v, want at least %v", elapsed, 2*interval)
+	}
+
+	// A cancelled context stops the wait
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := client.FetchPeriod(ctx, "2024-01-01", "2024-01-31"); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
+
+func TestInvalidTokenErrorIsRedacted(t *testing.T) {
+	srv := fiotest.NewServer(testToken)
+	defer srv.Close()
+
+	client := fio.NewClient("wrong-token", fio.WithBaseURL(srv.URL), fio.WithRequestInterval(0))
+	_, err := client.FetchSinceLastDownload(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("err = %v, want a 500 error", err)
+	}
+
+	// Transport errors include the URL - the token must not leak into logs
+	client = fio.NewClient(testToken, fio.WithBaseURL("http://127.0.0.1:1"), fio.WithRequestInterval(0))
+	_, err = client.FetchSinceLastDownload(context.Background())
+	if err == nil {
+		t.Fatal("expected a connection error")
+	}
+	if strings.Contains(err.Error(), testToken) {
+		t.Errorf("error contains the token: %v", err)
+	}
+}
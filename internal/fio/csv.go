@@ -0,0 +1,160 @@
+package fio
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/money"
+)
+
+// csvColumns maps CSV header names (Czech and English exports) to Transaction fields
+var csvColumns = map[string]string{
+	"id operace":               "id",
+	"id pohybu":                "id",
+	"id":                       "id",
+	"datum":                    "date",
+	"date":                     "date",
+	"objem":                    "amount",
+	"amount":                   "amount",
+	"měna":                     "currency",
+	"currency":                 "currency",
+	"protiúčet":                "account",
+	"counter account":          "account",
+	"název protiúčtu":          "account_name",
+	"counter account name":     "account_name",
+	"kód banky":                "bank_code",
+	"bank code":                "bank_code",
+	"název banky":              "bank_name",
+	"bank name":                "bank_name",
+	"vs":                       "vs",
+	"ss":                       "ss",
+	"zpráva pro příjemce":      "message",
+	"message for recipient":    "message",
+	"komentář":                 "comment",
+	"poznámka":                 "comment",
+	"note":                     "comment",
+	"typ":                      "type",
+	"type":                     "type",
+	"uživatelská identifikace": "identification",
+	"user identification":      "identification",
+}
+
+// parseCSV parses the CSV export. The file starts with a few lines of account
+// information, the transactions follow the header row containing "ID operace".
+func parseCSV(data []byte) ([]Transaction, error) {
+	r := csv.NewReader(strings.NewReader(decodeText(data)))
+	r.Comma = ';'
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var columns map[string]int
+	var transactions []Transaction
+
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if columns == nil {
+			columns = csvHeader(record)
+			continue
+		}
+
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		tx, err := parseCSVRecord(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		transactions = append(transactions, tx)
+	}
+
+	if columns == nil {
+		return nil, fmt.Errorf("CSV header with transaction ID, date and amount not found")
+	}
+
+	return transactions, nil
+}
+
+// csvHeader returns the column indexes if the record is the header row
+func csvHeader(record []string) map[string]int {
+	columns := make(map[string]int)
+	for i, name := range record {
+		key, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			continue
+		}
+		// Some exports contain "Poznámka" twice - keep the first one
+		if _, seen := columns[key]; !seen {
+			columns[key] = i
+		}
+	}
+
+	for _, required := range []string{"id", "date", "amount"} {
+		if _, ok := columns[required]; !ok {
+			return nil
+		}
+	}
+	return columns
+}
+
+func parseCSVRecord(record []string, columns map[string]int) (Transaction, error) {
+	get := func(key string) string {
+		i, ok := columns[key]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	id, err := strconv.ParseInt(get("id"), 10, 64)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("invalid transaction ID %q", get("id"))
+	}
+
+	date, err := parseCSVDate(get("date"))
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	amount, err := money.Parse(get("amount"))
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	return Transaction{
+		ID:              id,
+		Date:            FormatDate(date),
+		Amount:          amount,
+		Currency:        get("currency"),
+		AccountNumber:   get("account"),
+		AccountName:     get("account_name"),
+		BankCode:        get("bank_code"),
+		BankName:        get("bank_name"),
+		VariableSymbol:  normalizeSymbol(get("vs")),
+		SpecificSymbol:  normalizeSymbol(get("ss")),
+		Message:         get("message"),
+		Comment:         get("comment"),
+		TransactionType: get("type"),
+		Identification:  get("identification"),
+	}, nil
+}
+
+func parseCSVDate(s string) (time.Time, error) {
+	for _, layout := range []string{"02.01.2006", "2.1.2006", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
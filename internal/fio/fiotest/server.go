@@ -0,0 +1,305 @@
+// Package fiotest provides a fake FIO Bank API server for tests and offline
+// runs. It serves recorded accountStatement JSON in the same shape as the real
+// API (columnN: {value, name, id} objects, null columns, numeric VS values),
+// keeps the "last download" pointer and can simulate 409 rate-limit responses.
+//
+// Usage:
+//
+//	srv := fiotest.NewServer("test-token")
+//	defer srv.Close()
+//	client := fio.NewClient("test-token", fio.WithBaseURL(srv.URL), fio.WithRequestInterval(0))
+package fiotest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed fixtures/transactions.json
+var defaultFixture []byte
+
+// Server is a fake FIO API. Transactions are kept in the raw API shape.
+type Server struct {
+	*httptest.Server
+
+	Token string
+
+	mu           sync.Mutex
+	info         map[string]interface{}
+	transactions []map[string]interface{}
+	lastID       int64
+	rateLimited  int
+	requests     []string
+}
+
+// statement is the top-level API response
+type statement struct {
+	AccountStatement struct {
+		Info            map[string]interface{} `json:"info"`
+		TransactionList struct {
+			Transactions []map[string]interface{} `json:"transaction"`
+		} `json:"transactionList"`
+	} `json:"accountStatement"`
+}
+
+// NewServer starts a fake server with the recorded default fixture
+// (8 transactions from January to April 2024)
+func NewServer(token string) *Server {
+	s, err := NewServerWithFixture(token, defaultFixture)
+	if err != nil {
+		panic(fmt.Sprintf("fiotest: invalid default fixture: %v", err))
+	}
+	return s
+}
+
+// NewServerWithFixture starts a fake server serving the transactions from an
+// accountStatement JSON document
+func NewServerWithFixture(token string, fixture []byte) (*Server, error) {
+	var st statement
+	if err := json.Unmarshal(fixture, &st); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture: %w", err)
+	}
+
+	s := &Server{
+		Token:        token,
+		info:         st.AccountStatement.Info,
+		transactions: st.AccountStatement.TransactionList.Transactions,
+	}
+	if s.info == nil {
+		s.info = map[string]interface{}{}
+	}
+	s.sortTransactions()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s, nil
+}
+
+// Transaction describes a transaction to add with AddTransaction. Empty
+// string fields are served as null columns.
+type Transaction struct {
+	ID             int64
+	Date           time.Time
+	Amount         float64
+	Currency       string // Default CZK
+	AccountNumber  string
+	AccountName    string
+	BankCode       string
+	VariableSymbol string
+	Message        string
+}
+
+// AddTransaction appends a transaction to the served account history
+func (s *Server) AddTransaction(tx Transaction) {
+	if tx.Currency == "" {
+		tx.Currency = "CZK"
+	}
+
+	raw := map[string]interface{}{
+		"column22": column(22, "ID pohybu", tx.ID),
+		"column0":  column(0, "Datum", tx.Date.Format("2006-01-02-0700")),
+		"column1":  column(1, "Objem", tx.Amount),
+		"column14": column(14, "Měna", tx.Currency),
+		"column2":  optionalColumn(2, "Protiúčet", tx.AccountNumber),
+		"column10": optionalColumn(10, "Název protiúčtu", tx.AccountName),
+		"column3":  optionalColumn(3, "Kód banky", tx.BankCode),
+		"column5":  optionalColumn(5, "VS", tx.VariableSymbol),
+		"column16": optionalColumn(16, "Zpráva pro příjemce", tx.Message),
+		"column8":  column(8, "Typ", "Bezhotovostní příjem"),
+		"column25": nil,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions = append(s.transactions, raw)
+	s.sortTransactions()
+}
+
+func column(id int, name string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"value": value, "name": name, "id": id}
+}
+
+func optionalColumn(id int, name, value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return column(id, name, value)
+}
+
+// RateLimitNext makes the next n requests fail with 409 Conflict, like the
+// real API does when a token is used more often than every 30 seconds
+func (s *Server) RateLimitNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimited = n
+}
+
+// LastID returns the current "last download" pointer
+func (s *Server) LastID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastID
+}
+
+// Requests returns the paths of all requests received so far, with the token
+// replaced by "TOKEN"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// /{endpoint}/{token}/{args...}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) >= 2 && parts[1] == s.Token {
+		parts[1] = "TOKEN"
+	} else if len(parts) >= 2 {
+		s.requests = append(s.requests, r.URL.Path)
+		// The real API answers an unknown token with 500
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	s.requests = append(s.requests, "/"+strings.Join(parts, "/"))
+
+	if s.rateLimited > 0 {
+		s.rateLimited--
+		http.Error(w, "Conflict", http.StatusConflict)
+		return
+	}
+
+	switch {
+	case len(parts) == 5 && parts[0] == "periods" && parts[4] == "transactions.json":
+		from, err1 := time.Parse("2006-01-02", parts[2])
+		to, err2 := time.Parse("2006-01-02", parts[3])
+		if err1 != nil || err2 != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		s.writeStatement(w, s.filter(func(tx map[string]interface{}) bool {
+			d := txDate(tx)
+			return !d.Before(from) && !d.After(to)
+		}))
+
+	case len(parts) == 5 && parts[0] == "by-id" && parts[4] == "transactions.json":
+		// Statements are not modelled, return the whole year
+		year, err := strconv.Atoi(parts[2])
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		s.writeStatement(w, s.filter(func(tx map[string]interface{}) bool {
+			return txDate(tx).Year() == year
+		}))
+
+	case len(parts) == 3 && parts[0] == "last" && parts[2] == "transactions.json":
+		last := s.lastID
+		list := s.filter(func(tx map[string]interface{}) bool {
+			return txID(tx) > last
+		})
+		if len(list) > 0 {
+			s.lastID = txID(list[len(list)-1])
+		}
+		s.writeStatement(w, list)
+
+	case len(parts) == 3 && parts[0] == "set-last-id":
+		id, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		s.lastID = id
+
+	case len(parts) == 3 && parts[0] == "set-last-date":
+		date, err := time.Parse("2006-01-02", parts[2])
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		// Next download starts with the day after the given date
+		s.lastID = 0
+		for _, tx := range s.transactions {
+			if !txDate(tx).After(date) {
+				s.lastID = txID(tx)
+			}
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) filter(keep func(map[string]interface{}) bool) []map[string]interface{} {
+	list := []map[string]interface{}{}
+	for _, tx := range s.transactions {
+		if keep(tx) {
+			list = append(list, tx)
+		}
+	}
+	return list
+}
+
+func (s *Server) writeStatement(w http.ResponseWriter, list []map[string]interface{}) {
+	var st statement
+	st.AccountStatement.Info = map[string]interface{}{}
+	for k, v := range s.info {
+		st.AccountStatement.Info[k] = v
+	}
+
+	// idFrom/idTo are null for an empty list, as in the real API
+	st.AccountStatement.Info["idFrom"] = nil
+	st.AccountStatement.Info["idTo"] = nil
+	if len(list) > 0 {
+		st.AccountStatement.Info["idFrom"] = txID(list[0])
+		st.AccountStatement.Info["idTo"] = txID(list[len(list)-1])
+	}
+	st.AccountStatement.Info["idLastDownload"] = nil
+	if s.lastID > 0 {
+		st.AccountStatement.Info["idLastDownload"] = s.lastID
+	}
+	st.AccountStatement.TransactionList.Transactions = list
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	json.NewEncoder(w).Encode(st)
+}
+
+func (s *Server) sortTransactions() {
+	sort.SliceStable(s.transactions, func(i, j int) bool {
+		return txID(s.transactions[i]) < txID(s.transactions[j])
+	})
+}
+
+func columnValue(tx map[string]interface{}, key string) interface{} {
+	if c, ok := tx[key].(map[string]interface{}); ok {
+		return c["value"]
+	}
+	return nil
+}
+
+func txID(tx map[string]interface{}) int64 {
+	switch v := columnValue(tx, "column22").(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
+
+func txDate(tx map[string]interface{}) time.Time {
+	s, _ := columnValue(tx, "column0").(string)
+	if len(s) < 10 {
+		return time.Time{}
+	}
+	t, _ := time.Parse("2006-01-02", s[:10])
+	return t
+}
@@ -0,0 +1,149 @@
+package fio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/money"
+)
+
+// GPC (ABO) is a fixed-width format. Each line starts with a record type:
+//
+//	074  statement header (account, balances) - ignored
+//	075  transaction
+//	078, 079  message lines belonging to the preceding transaction
+//
+// Field positions of the 075 record (0-based, end exclusive):
+//
+//	3:19     own account
+//	19:35    counter account (6 digit prefix + 10 digit number)
+//	35:48    transaction ID (the same ID as column22 in the API)
+//	48:60    amount in haléře
+//	60       accounting code: 1 debit, 2 credit, 4 storno of debit, 5 storno of credit
+//	61:71    variable symbol
+//	71:81    "00" + counter account bank code (4) + constant symbol (4)
+//	81:91    specific symbol
+//	91:97    value date (DDMMYY)
+//	97:117   counter account name
+//	118:122  currency (ISO 4217 numeric)
+//	122:128  accounting date (DDMMYY)
+func parseGPC(data []byte) ([]Transaction, error) {
+	var transactions []Transaction
+
+	lines := strings.Split(decodeText(data), "\n")
+	for n, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		record := []rune(line)
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: record too short", n+1)
+		}
+
+		switch string(record[:3]) {
+		case "075":
+			tx, err := parseGPCTransaction(record)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			transactions = append(transactions, tx)
+
+		case "078", "079":
+			if len(transactions) == 0 {
+				continue
+			}
+			msg := strings.TrimSpace(string(record[3:]))
+			last := &transactions[len(transactions)-1]
+			if last.Message == "" {
+				last.Message = msg
+			} else if msg != "" {
+				last.Message += " " + msg
+			}
+		}
+	}
+
+	return transactions, nil
+}
+
+func parseGPCTransaction(record []rune) (Transaction, error) {
+	if len(record) < 122 {
+		return Transaction{}, fmt.Errorf("transaction record has %d characters, want at least 122", len(record))
+	}
+	field := func(from, to int) string {
+		if to > len(record) {
+			to = len(record)
+		}
+		return strings.TrimSpace(string(record[from:to]))
+	}
+
+	id, err := strconv.ParseInt(field(35, 48), 10, 64)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("invalid transaction ID %q", field(35, 48))
+	}
+
+	halere, err := strconv.ParseInt(field(48, 60), 10, 64)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("invalid amount %q", field(48, 60))
+	}
+	amount := money.FromHalere(halere)
+	switch field(60, 61) {
+	case "1", "5":
+		amount = amount.Neg()
+	case "2", "4":
+	default:
+		return Transaction{}, fmt.Errorf("invalid accounting code %q", field(60, 61))
+	}
+
+	dateStr := field(91, 97)
+	if len(record) >= 128 && field(122, 128) != "" {
+		dateStr = field(122, 128)
+	}
+	date, err := time.Parse("020106", dateStr)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("invalid date %q", dateStr)
+	}
+
+	return Transaction{
+		ID:             id,
+		Date:           FormatDate(date),
+		Amount:         amount,
+		Currency:       gpcCurrency(field(118, 122)),
+		AccountNumber:  formatGPCAccount(field(19, 35)),
+		AccountName:    field(97, 117),
+		BankCode:       field(73, 77),
+		VariableSymbol: normalizeSymbol(field(61, 71)),
+		SpecificSymbol: normalizeSymbol(field(81, 91)),
+	}, nil
+}
+
+// formatGPCAccount converts "0000192000145399" to "19-2000145399"
+func formatGPCAccount(s string) string {
+	if len(s) != 16 {
+		return strings.TrimLeft(s, "0")
+	}
+	prefix := strings.TrimLeft(s[:6], "0")
+	number := strings.TrimLeft(s[6:], "0")
+	if number == "" {
+		return ""
+	}
+	if prefix != "" {
+		return prefix + "-" + number
+	}
+	return number
+}
+
+func gpcCurrency(code string) string {
+	switch strings.TrimLeft(code, "0") {
+	case "203", "":
+		return "CZK"
+	case "978":
+		return "EUR"
+	case "840":
+		return "USD"
+	}
+	return code
+}
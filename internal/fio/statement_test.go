@@ -0,0 +1,158 @@
+package fio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/base48/member-portal/internal/money"
+)
+
+// The three fixtures contain the same 8 transactions as the fiotest server
+func TestParseStatementFile(t *testing.T) {
+	want := []struct {
+		id      int64
+		date    string
+		amount  string
+		vs      string
+		message string
+	}{
+		{26000000001, "2024-01-05", "1000.00", "1001", "clensky prispevek leden"},
+		{26000000002, "2024-01-10", "500.50", "1002", ""},
+		{26000000003, "2024-01-20", "-250.00", "", "najem"},
+		{26000000004, "2024-02-03", "1000.00", "", "1001"},
+		{26000000005, "2024-02-15", "300.00", "9999", ""},
+		{26000000006, "2024-03-01", "150.00", "", "dar na 3D tiskarnu"},
+		{26000000007, "2024-03-05", "333.33", "1002", "doplatek"},
+		{26000000008, "2024-04-02", "-1200.00", "", ""},
+	}
+
+	tests := []struct {
+		file   string
+		format FileFormat
+	}{
+		{"statement.gpc", FormatGPC},
+		{"statement.csv", FormatCSV},
+		{"statement.xml", FormatCAMT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			format, err := DetectFormat(tt.file, data)
+			if err != nil || format != tt.format {
+				t.Fatalf("DetectFormat = %q, %v; want %q", format, err, tt.format)
+			}
+
+			transactions, err := ParseStatementFile(format, data)
+			if err != nil {
+				t.Fatalf("ParseStatementFile: %v", err)
+			}
+			if len(transactions) != len(want) {
+				t.Fatalf("got %d transactions, want %d", len(transactions), len(want))
+			}
+
+			for i, w := range want {
+				tx := transactions[i]
+				if tx.ID != w.id {
+					t.Errorf("#%d: ID = %d, want %d", i, tx.ID, w.id)
+				}
+				if tx.Date != w.date {
+					t.Errorf("#%d: Date = %q, want %q", i, tx.Date, w.date)
+				}
+				if amount := money.MustParse(w.amount); tx.Amount != amount {
+					t.Errorf("#%d: Amount = %s, want %s", i, tx.Amount, amount)
+				}
+				if tx.VariableSymbol != w.vs {
+					t.Errorf("#%d: VariableSymbol = %q, want %q", i, tx.VariableSymbol, w.vs)
+				}
+				if w.message != "" && tx.Message != w.message {
+					t.Errorf("#%d: Message = %q, want %q", i, tx.Message, w.message)
+				}
+			}
+
+			// Counterparty of an incoming payment
+			if tx := transactions[4]; tx.BankCode != "6210" || tx.AccountNumber != "670100-2201234567" {
+				t.Errorf("counterparty = %s/%s, want 670100-2201234567/6210", tx.AccountNumber, tx.BankCode)
+			}
+		})
+	}
+}
+
+func TestParseGPCWindows1250(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "statement.gpc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transactions, err := parseGPC(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := transactions[1].AccountName; got != "Svobodová Petra" {
+		t.Errorf("AccountName = %q, want %q", got, "Svobodová Petra")
+	}
+	if got := transactions[6].SpecificSymbol; got != "2024" {
+		t.Errorf("SpecificSymbol = %q, want 2024", got)
+	}
+	if got := transactions[1].AccountNumber; got != "19-2000145399" {
+		t.Errorf("AccountNumber = %q, want 19-2000145399", got)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    FileFormat
+		wantErr bool
+	}{
+		{"vypis.GPC", "", FormatGPC, false},
+		{"vypis.abo", "", FormatGPC, false},
+		{"Pohyby_na_uctu.csv", "", FormatCSV, false},
+		{"camt053.xml", "", FormatCAMT, false},
+		{"download", "074000000280000", FormatGPC, false},
+		{"download", "\xEF\xBB\xBF<?xml version=\"1.0\"?>", FormatCAMT, false},
+		{"download", "\"ID operace\";\"Datum\"", FormatCSV, false},
+		{"download.pdf", "%PDF-1.4", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectFormat(tt.name, []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStatementFileErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format FileFormat
+		data   string
+	}{
+		{"short GPC record", FormatGPC, "075000000280000"},
+		{"GPC bad accounting code", FormatGPC, "075" + "0000002800000001" + "0000002100123456" + "0026000000001" + "000000100000" + "9" + "0000001001" + "0020100000" + "0000000000" + "050124" + "NOVAK JAN           " + "0" + "0203" + "050124"},
+		{"CSV without header", FormatCSV, "\"a\";\"b\"\n\"1\";\"2\"\n"},
+		{"CSV bad amount", FormatCSV, "\"ID operace\";\"Datum\";\"Objem\"\n\"1\";\"05.01.2024\";\"abc\"\n"},
+		{"CAMT not a statement", FormatCAMT, "<Document></Document>"},
+		{"CAMT missing reference", FormatCAMT, "<Document><BkToCstmrStmt><Stmt><Ntry><Amt Ccy=\"CZK\">1.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><BookgDt><Dt>2024-01-01</Dt></BookgDt></Ntry></Stmt></BkToCstmrStmt></Document>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseStatementFile(tt.format, []byte(tt.data)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/base48/member-portal/internal/announcements"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/debt"
+	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/keycloak"
+	"github.com/base48/member-portal/internal/membership"
+)
+
+// AnnouncementView is a sent announcement prepared for the
+// admin_announcements.html template
+type AnnouncementView struct {
+	db.Announcement
+	Segment string // Described in Czech
+}
+
+// AdminAnnouncementsHandler shows the announcement composer and the sent
+// announcements
+// GET /admin/announcements
+func (h *Handler) AdminAnnouncementsHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+
+	dbUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	levels, err := h.queries.ListAllLevels(ctx)
+	if err != nil {
+		http.Error(w, "Failed to load levels", http.StatusInternalServerError)
+		return
+	}
+
+	sent, err := h.queries.ListAnnouncements(ctx, 50)
+	if err != nil {
+		http.Error(w, "Failed to load announcements", http.StatusInternalServerError)
+		return
+	}
+	views := make([]AnnouncementView, len(sent))
+	for i, a := range sent {
+		var seg announcements.Segment
+		json.Unmarshal([]byte(a.Segment), &seg)
+		views[i] = AnnouncementView{Announcement: a, Segment: seg.Describe(levels)}
+	}
+
+	type option struct {
+		Value string
+		Label string
+	}
+	states := make([]option, len(membership.States))
+	for i, s := range membership.States {
+		states[i] = option{s, membership.StateLabel(s)}
+	}
+
+	data := map[string]interface{}{
+		"Title":         "Oznámení členům",
+		"User":          user,
+		"DBUser":        dbUser,
+		"States":        states,
+		"Levels":        levels,
+		"Roles":         []string{membership.ActiveMemberRole, "in_debt", "memberportal_admin"},
+		"RolesEnabled":  h.serviceAccount != nil,
+		"Fields":        announcements.Fields,
+		"EmailsEnabled": h.emailClient.Enabled(),
+		"BulkRate":      h.config.EmailBulkRate,
+		"Announcements": views,
+	}
+
+	h.render(w, "admin_announcements.html", data)
+}
+
+// AnnouncementRequest is the JSON body of POST /api/admin/announcements and
+// POST /api/admin/announcements/preview
+type AnnouncementRequest struct {
+	Segment  announcements.Segment `json:"segment"`
+	Subject  string                `json:"subject"`
+	Body     string                `json:"body"`
+	Expected int                   `json:"expected"` // Recipients shown in the preview
+}
+
+// AnnouncementRecipientResponse is a recipient in the preview
+type AnnouncementRecipientResponse struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	State  string `json:"state"`
+	Level  string `json:"level"`
+	InDebt bool   `json:"in_debt"`
+}
+
+// announcementRecipients returns the members in the segment
+func (h *Handler) announcementRecipients(ctx context.Context, seg announcements.Segment) ([]announcements.Recipient, error) {
+	policy, err := debt.PolicyFromConfig(h.config)
+	if err != nil {
+		return nil, err
+	}
+	return announcements.Recipients(ctx, h.queries, policy, h.roleMembers(), seg, time.Now())
+}
+
+// roleMembers lists the users of a Keycloak role through the service
+// account, nil without one
+func (h *Handler) roleMembers() announcements.RoleMembers {
+	if h.serviceAccount == nil {
+		return nil
+	}
+	return func(ctx context.Context, role string) ([]string, error) {
+		token, err := h.getServiceAccountToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		users, err := keycloak.NewClient(h.config, token).GetRoleUsers(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, len(users))
+		for i, u := range users {
+			ids[i] = u.ID
+		}
+		return ids, nil
+	}
+}
+
+// AdminPreviewAnnouncementHandler counts and lists the recipients of a
+// segment and renders the announcement for the first of them
+// POST /api/admin/announcements/preview
+func (h *Handler) AdminPreviewAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	recipients, err := h.announcementRecipients(ctx, req.Segment)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list := make([]AnnouncementRecipientResponse, len(recipients))
+	for i, rcpt := range recipients {
+		list[i] = AnnouncementRecipientResponse{
+			ID:     rcpt.User.ID,
+			Name:   rcpt.User.Realname.String,
+			Email:  rcpt.User.Email,
+			State:  membership.StateLabel(rcpt.User.State),
+			Level:  rcpt.LevelName,
+			InDebt: rcpt.InDebt,
+		}
+	}
+
+	resp := map[string]interface{}{
+		"success":    true,
+		"count":      len(recipients),
+		"recipients": list,
+	}
+
+	// The message is previewed once written, for the first recipient
+	if req.Subject != "" && req.Body != "" && len(recipients) > 0 {
+		rendered, err := h.renderAnnouncement(ctx, req, recipients[0])
+		if err != nil {
+			resp["preview_error"] = err.Error()
+		} else {
+			resp["preview"] = map[string]string{
+				"recipient": recipients[0].User.Email,
+				"subject":   rendered.Subject,
+				"html":      rendered.HTML,
+				"text":      rendered.Text,
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// renderAnnouncement renders the email of the announcement for a recipient
+// as it will be sent
+func (h *Handler) renderAnnouncement(ctx context.Context, req AnnouncementRequest, rcpt announcements.Recipient) (email.Rendered, error) {
+	tmpl, err := announcements.Message{Subject: req.Subject, Body: req.Body}.Parse()
+	if err != nil {
+		return email.Rendered{}, err
+	}
+	data := announcements.Data(rcpt, h.config.BaseURL)
+	subject, body, err := tmpl.Render(data)
+	if err != nil {
+		return email.Rendered{}, err
+	}
+	data["Subject"] = subject
+	data["Body"] = body
+
+	envelope, ok := email.LookupTemplate(announcements.TemplateName)
+	if !ok {
+		return email.Rendered{}, fmt.Errorf("chybí šablona %s", announcements.TemplateName)
+	}
+	rendered, err := h.emailClient.Render(ctx, envelope, data)
+	rendered.Subject = subject
+	return rendered, err
+}
+
+// AdminSendAnnouncementHandler queues the announcement for the members in
+// the segment. The recipients are resolved again and must match the count of
+// the preview.
+// POST /api/admin/announcements
+func (h *Handler) AdminSendAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	recipients, err := h.announcementRecipients(ctx, req.Segment)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(recipients) != req.Expected {
+		h.jsonError(w, fmt.Sprintf("Počet příjemců se od náhledu změnil (%d místo %d), zkontrolujte je znovu.", len(recipients), req.Expected), http.StatusConflict)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	sender := &announcements.Sender{Config: h.config, Queries: h.queries, Email: h.emailClient}
+	result, err := sender.Send(ctx, announcements.Message{Subject: req.Subject, Body: req.Body}, req.Segment, recipients, adminDBUser.ID, time.Now())
+	if err != nil {
+		if result.Announcement.ID == 0 { // Nothing was sent
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	h.logAnnouncement(ctx, adminDBUser, result)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Announcement #%d queued for %d member(s), %d failed", result.Announcement.ID, result.Queued, result.Failed),
+		"queued":  result.Queued,
+		"failed":  result.Failed,
+		"errors":  result.Errors,
+		"last_at": result.LastAt.Format("2. 1. 2006 15:04"),
+	})
+}
+
+// logAnnouncement writes a sent announcement to system_logs
+func (h *Handler) logAnnouncement(ctx context.Context, admin db.User, result announcements.Result) {
+	adminUsername := "unknown"
+	if admin.Username.Valid {
+		adminUsername = admin.Username.String
+	}
+
+	subjectJSON, _ := json.Marshal(result.Announcement.Subject)
+
+	h.queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "admin",
+		Level:     "info",
+		UserID:    sql.NullInt64{Int64: admin.ID, Valid: admin.ID != 0},
+		Message: fmt.Sprintf("Admin %s (%s) sent announcement #%d to %d member(s), %d failed",
+			adminUsername, admin.Email, result.Announcement.ID, result.Queued, result.Failed),
+		Metadata: sql.NullString{
+			String: fmt.Sprintf(`{"admin_user_id":%d,"action":"send_announcement","announcement_id":%d,"subject":%s,"segment":%s,"queued":%d,"failed":%d}`,
+				admin.ID, result.Announcement.ID, subjectJSON, result.Announcement.Segment, result.Queued, result.Failed),
+			Valid: true,
+		},
+	})
+}
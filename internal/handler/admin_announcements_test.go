@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/base48/member-portal/internal/auth"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/membership"
+)
+
+func TestAdminAnnouncements(t *testing.T) {
+	h, _ := newTestHandler(t)
+	ctx := context.Background()
+
+	admin, err := h.queries.CreateUser(ctx, db.CreateUserParams{
+		KeycloakID: sql.NullString{String: "kc-admin", Valid: true},
+		Email:      "admin@example.com",
+		Realname:   sql.NullString{String: "Admin", Valid: true},
+		LevelID:    1,
+		State:      membership.StateAccepted,
+		IsCouncil:  true,
+	})
+	if err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	for _, email := range []string{"novak@example.com", "svoboda@example.com"} {
+		if _, err := h.queries.CreateUser(ctx, db.CreateUserParams{
+			Email:    email,
+			Realname: sql.NullString{String: strings.TrimSuffix(email, "@example.com"), Valid: true},
+			LevelID:  1,
+			State:    membership.StateAccepted,
+		}); err != nil {
+			t.Fatalf("create member: %v", err)
+		}
+	}
+	adminUser := &auth.User{ID: admin.KeycloakID.String, Email: admin.Email, Roles: []string{"memberportal_admin"}}
+
+	call := func(handler http.HandlerFunc, body interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		encoded, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/announcements", strings.NewReader(string(encoded)))
+		withSession(t, h, req, adminUser)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	notCouncil := map[string]interface{}{"council": false}
+	announcement := map[string]interface{}{
+		"segment": notCouncil,
+		"subject": "Schůze",
+		"body":    "Ahoj {{.Name}}, přijď na schůzi.",
+	}
+
+	code, resp := call(h.AdminPreviewAnnouncementHandler, announcement)
+	if code != http.StatusOK || resp["count"] != float64(2) {
+		t.Fatalf("preview: %d %v", code, resp)
+	}
+	preview, _ := resp["preview"].(map[string]interface{})
+	if preview == nil || !strings.Contains(preview["text"].(string), "Ahoj novak, přijď na schůzi.") || preview["subject"] != "Schůze" {
+		t.Errorf("preview %v", resp)
+	}
+
+	if code, resp := call(h.AdminPreviewAnnouncementHandler, map[string]interface{}{
+		"segment": notCouncil, "subject": "Schůze", "body": "Ahoj {{.Nmae}}",
+	}); code != http.StatusOK || resp["preview_error"] == nil {
+		t.Errorf("broken preview: %d %v", code, resp)
+	}
+	if code, _ := call(h.AdminPreviewAnnouncementHandler, map[string]interface{}{
+		"segment": map[string]interface{}{"roles": []string{"in_debt"}},
+	}); code != http.StatusBadRequest {
+		t.Errorf("roles without a service account: %d", code)
+	}
+
+	// The recipients changed since the preview
+	announcement["expected"] = 3
+	if code, _ := call(h.AdminSendAnnouncementHandler, announcement); code != http.StatusConflict {
+		t.Errorf("stale count: %d", code)
+	}
+	if list, _ := h.queries.ListAnnouncements(ctx, 10); len(list) != 0 {
+		t.Errorf("sent with a stale count: %+v", list)
+	}
+
+	announcement["expected"] = 2
+	code, resp = call(h.AdminSendAnnouncementHandler, announcement)
+	if code != http.StatusOK || resp["queued"] != float64(2) || resp["failed"] != float64(0) {
+		t.Fatalf("send: %d %v", code, resp)
+	}
+
+	list, err := h.queries.ListAnnouncements(ctx, 10)
+	if err != nil || len(list) != 1 || list[0].CreatedBy.Int64 != admin.ID {
+		t.Errorf("announcements %+v, %v", list, err)
+	}
+	logs, err := h.queries.ListLogsBySubsystem(ctx, db.ListLogsBySubsystemParams{Subsystem: "admin", Limit: 10})
+	if err != nil || len(logs) != 1 || !strings.Contains(logs[0].Metadata.String, `"action":"send_announcement"`) {
+		t.Errorf("admin logs %+v, %v", logs, err)
+	}
+}
@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/debt"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/go-chi/chi/v5"
+)
+
+// DebtorView is a member with a negative balance prepared for the
+// admin_debt.html template
+type DebtorView struct {
+	debt.Status
+	Name       string
+	State      string // Czech label of the membership state
+	Configured bool   // In debt under the configured policy
+}
+
+// DebtExemptionView is an exemption prepared for the admin_debt.html template
+type DebtExemptionView struct {
+	db.DebtExemption
+	Email  string
+	Name   string
+	Active bool // In effect today
+}
+
+// AdminDebtHandler previews who is in debt under the debt policy. The
+// threshold and grace query parameters try a different policy against the
+// configured one without changing anything.
+// GET /admin/debt
+func (h *Handler) AdminDebtHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	now := time.Now()
+
+	dbUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	configured, err := debt.PolicyFromConfig(h.config)
+	if err != nil {
+		http.Error(w, "Invalid debt policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Policy to preview, the configured one unless overridden
+	policy := configured
+	var policyError string
+	if s := r.URL.Query().Get("threshold"); s != "" {
+		if policy.Threshold, err = debt.ParseThreshold(s); err != nil {
+			policyError = fmt.Sprintf("Neplatný limit '%s', zadejte částku v Kč (500) nebo počet měsíčních příspěvků (1.5m).", s)
+			policy = configured
+		}
+	}
+	if s := r.URL.Query().Get("grace"); s != "" && policyError == "" {
+		if days, err := strconv.Atoi(s); err != nil || days < 0 {
+			policyError = fmt.Sprintf("Neplatný počet dní '%s'.", s)
+			policy = configured
+		} else {
+			policy.GraceDays = days
+		}
+	}
+	custom := policy != configured
+
+	statuses, err := debt.Load(ctx, h.queries, policy, now)
+	if err != nil {
+		http.Error(w, "Failed to evaluate debt policy", http.StatusInternalServerError)
+		return
+	}
+	inDebt := make(map[int64]bool)
+	if custom {
+		current, err := debt.Load(ctx, h.queries, configured, now)
+		if err != nil {
+			http.Error(w, "Failed to evaluate debt policy", http.StatusInternalServerError)
+			return
+		}
+		for _, s := range current {
+			inDebt[s.User.ID] = s.InDebt
+		}
+	}
+
+	var debtors []DebtorView
+	flagged := 0
+	users := make(map[int64]db.User, len(statuses))
+	for _, s := range statuses {
+		users[s.User.ID] = s.User
+		if !s.Balance.IsNegative() {
+			continue
+		}
+		view := DebtorView{
+			Status:     s,
+			Name:       s.User.Realname.String,
+			State:      membership.StateLabel(s.User.State),
+			Configured: s.InDebt,
+		}
+		if custom {
+			view.Configured = inDebt[s.User.ID]
+		}
+		if s.InDebt {
+			flagged++
+		}
+		debtors = append(debtors, view)
+	}
+
+	exemptions, err := h.queries.ListDebtExemptions(ctx)
+	if err != nil {
+		http.Error(w, "Failed to load exemptions", http.StatusInternalServerError)
+		return
+	}
+	exemptionViews := make([]DebtExemptionView, 0, len(exemptions))
+	for _, e := range exemptions {
+		member := users[e.UserID]
+		exemptionViews = append(exemptionViews, DebtExemptionView{
+			DebtExemption: e,
+			Email:         member.Email,
+			Name:          member.Realname.String,
+			Active:        debt.Active(e, now),
+		})
+	}
+
+	data := map[string]interface{}{
+		"Title":       "Dlužníci",
+		"User":        user,
+		"DBUser":      dbUser,
+		"Policy":      policy,
+		"Configured":  configured,
+		"Custom":      custom,
+		"PolicyError": policyError,
+		"Debtors":     debtors,
+		"Flagged":     flagged,
+		"Exemptions":  exemptionViews,
+		"Members":     statuses,
+	}
+
+	h.render(w, "admin_debt.html", data)
+}
+
+// DebtExemptionRequest is the JSON body of POST /api/admin/debt/exemptions
+type DebtExemptionRequest struct {
+	UserID     int64  `json:"user_id"`
+	Reason     string `json:"reason"`
+	ValidUntil string `json:"valid_until"` // YYYY-MM-DD, empty for no end
+}
+
+// AdminCreateDebtExemptionHandler exempts a member from the debt policy
+// POST /api/admin/debt/exemptions
+func (h *Handler) AdminCreateDebtExemptionHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DebtExemptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		h.jsonError(w, "Důvod výjimky je povinný", http.StatusBadRequest)
+		return
+	}
+	var validUntil sql.NullTime
+	if req.ValidUntil != "" {
+		t, err := time.Parse("2006-01-02", req.ValidUntil)
+		if err != nil {
+			h.jsonError(w, fmt.Sprintf("neplatné datum '%s', očekává se RRRR-MM-DD", req.ValidUntil), http.StatusBadRequest)
+			return
+		}
+		validUntil = sql.NullTime{Time: t, Valid: true}
+	}
+
+	ctx := r.Context()
+
+	member, err := h.queries.GetUserByID(ctx, req.UserID)
+	if err != nil {
+		h.jsonError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	exemption, err := h.queries.CreateDebtExemption(ctx, db.CreateDebtExemptionParams{
+		UserID:     member.ID,
+		Reason:     req.Reason,
+		ValidUntil: validUntil,
+		CreatedBy:  sql.NullInt64{Int64: adminDBUser.ID, Valid: adminDBUser.ID != 0},
+	})
+	if err != nil {
+		h.jsonError(w, "Failed to create exemption: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	until := "no end"
+	if validUntil.Valid {
+		until = "until " + req.ValidUntil
+	}
+	h.logDebtExemption(ctx, adminDBUser, "create_debt_exemption", exemption,
+		fmt.Sprintf("exempted %s from the debt policy (%s): %s", member.Email, until, exemption.Reason))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"exemption": exemption,
+		"message":   "Exemption created successfully",
+	})
+}
+
+// AdminDeleteDebtExemptionHandler removes an exemption from the debt policy
+// DELETE /api/admin/debt/exemptions/{id}
+func (h *Handler) AdminDeleteDebtExemptionHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid exemption ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	exemption, err := h.queries.GetDebtExemption(ctx, id)
+	if err != nil {
+		h.jsonError(w, "Exemption not found", http.StatusNotFound)
+		return
+	}
+	if err := h.queries.DeleteDebtExemption(ctx, id); err != nil {
+		h.jsonError(w, "Failed to delete exemption: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	member, _ := h.queries.GetUserByID(ctx, exemption.UserID)
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	h.logDebtExemption(ctx, adminDBUser, "delete_debt_exemption", exemption,
+		fmt.Sprintf("removed the debt exemption of %s: %s", member.Email, exemption.Reason))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Exemption deleted successfully",
+	})
+}
+
+// logDebtExemption writes an admin change of a debt exemption to system_logs
+func (h *Handler) logDebtExemption(ctx context.Context, admin db.User, action string, e db.DebtExemption, summary string) {
+	adminUsername := "unknown"
+	if admin.Username.Valid {
+		adminUsername = admin.Username.String
+	}
+
+	reasonJSON, _ := json.Marshal(e.Reason)
+	validUntil := "null"
+	if e.ValidUntil.Valid {
+		validUntil = `"` + e.ValidUntil.Time.Format("2006-01-02") + `"`
+	}
+
+	h.queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "admin",
+		Level:     "info",
+		UserID:    sql.NullInt64{Int64: admin.ID, Valid: admin.ID != 0},
+		Message:   fmt.Sprintf("Admin %s (%s) %s", adminUsername, admin.Email, summary),
+		Metadata: sql.NullString{
+			String: fmt.Sprintf(`{"admin_user_id":%d,"action":"%s","exemption_id":%d,"target_user_id":%d,"reason":%s,"valid_until":%s}`,
+				admin.ID, action, e.ID, e.UserID, reasonJSON, validUntil),
+			Valid: true,
+		},
+	})
+}
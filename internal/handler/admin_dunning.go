@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/debt"
+	"github.com/base48/member-portal/internal/dunning"
+	"github.com/base48/member-portal/internal/jobs"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// DunningCaseView is an open dunning case prepared for the admin_dunning.html
+// template
+type DunningCaseView struct {
+	User     db.User
+	Name     string
+	Balance  money.Amount // Balance now
+	Notices  []db.DunningNotice
+	Last     db.DunningNotice
+	InDebt   bool   // Still in debt under the debt policy
+	Next     string // Czech label of the stage the next run takes, empty if none
+	Resolves bool   // The next run closes the case
+}
+
+// DunningStageView is the open cases at one stage
+type DunningStageView struct {
+	Stage string
+	Label string
+	Cases []DunningCaseView
+}
+
+// DunningNoticeView is a sent notice prepared for the admin_dunning.html
+// template
+type DunningNoticeView struct {
+	db.DunningNotice
+	Email string
+	Label string
+}
+
+// AdminDunningHandler lists the members at each stage of the dunning, what
+// the next run of the dunning job would do and the recent notices
+// GET /admin/dunning
+func (h *Handler) AdminDunningHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	now := time.Now()
+
+	dbUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	settings, err := dunning.SettingsFromConfig(h.config)
+	if err != nil {
+		http.Error(w, "Invalid dunning settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	policy, err := debt.PolicyFromConfig(h.config)
+	if err != nil {
+		http.Error(w, "Invalid debt policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	statuses, err := debt.Load(ctx, h.queries, policy, now)
+	if err != nil {
+		http.Error(w, "Failed to evaluate debt policy", http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[int64]debt.Status, len(statuses))
+	for _, s := range statuses {
+		byID[s.User.ID] = s
+	}
+
+	open, err := h.queries.ListOpenDunningNotices(ctx)
+	if err != nil {
+		http.Error(w, "Failed to load dunning notices", http.StatusInternalServerError)
+		return
+	}
+	notices := make(map[int64][]db.DunningNotice)
+	var order []int64
+	for _, n := range open {
+		if _, ok := notices[n.UserID]; !ok {
+			order = append(order, n.UserID)
+		}
+		notices[n.UserID] = append(notices[n.UserID], n)
+	}
+
+	stages := make([]DunningStageView, len(dunning.Stages))
+	index := make(map[string]int, len(dunning.Stages))
+	for i, stage := range dunning.Stages {
+		stages[i] = DunningStageView{Stage: stage, Label: dunning.StageLabel(stage)}
+		index[stage] = i
+	}
+	for _, id := range order {
+		status := byID[id]
+		caseNotices := notices[id]
+		view := DunningCaseView{
+			User:    status.User,
+			Name:    status.User.Realname.String,
+			Balance: status.Balance,
+			Notices: caseNotices,
+			Last:    caseNotices[len(caseNotices)-1],
+			InDebt:  status.InDebt,
+		}
+		if next, ok := settings.Next(status, caseNotices, now); ok {
+			view.Resolves = next.Resolve
+			view.Next = dunning.StageLabel(next.Stage)
+		}
+		if i, ok := index[view.Last.Stage]; ok {
+			stages[i].Cases = append(stages[i].Cases, view)
+		}
+	}
+
+	// What the next run would do, a dry run only reads the database
+	planned, err := jobs.RunDunning(ctx, &jobs.Deps{Config: h.config, Queries: h.queries},
+		log.New(io.Discard, "", 0), jobs.DunningOptions{DryRun: true}, now)
+	if err != nil {
+		http.Error(w, "Failed to plan the dunning run: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var newCases []jobs.DunningAction
+	for _, a := range planned.Actions {
+		if a.Stage == dunning.StageReminder {
+			newCases = append(newCases, a)
+		}
+	}
+
+	recent, err := h.queries.ListRecentDunningNotices(ctx, 50)
+	if err != nil {
+		http.Error(w, "Failed to load dunning notices", http.StatusInternalServerError)
+		return
+	}
+	recentViews := make([]DunningNoticeView, 0, len(recent))
+	for _, n := range recent {
+		recentViews = append(recentViews, DunningNoticeView{
+			DunningNotice: n,
+			Email:         byID[n.UserID].User.Email,
+			Label:         dunning.StageLabel(n.Stage),
+		})
+	}
+
+	data := map[string]interface{}{
+		"Title":    "Upomínky",
+		"User":     user,
+		"DBUser":   dbUser,
+		"Settings": settings,
+		"Stages":   stages,
+		"Open":     len(order),
+		"Planned":  planned,
+		"NewCases": newCases,
+		"Recent":   recentViews,
+	}
+
+	h.render(w, "admin_dunning.html", data)
+}
@@ -0,0 +1,451 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/go-chi/chi/v5"
+)
+
+// EmailTemplateView is an email template prepared for the
+// admin_email_templates.html template
+type EmailTemplateView struct {
+	email.Template
+	Current    db.EmailTemplateVersion // Zero when never edited
+	Overridden bool                    // The current version overrides the defaults
+}
+
+// AdminEmailTemplatesHandler lists the email templates with their current
+// versions
+// GET /admin/email-templates
+func (h *Handler) AdminEmailTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+
+	dbUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	templates, err := email.ListTemplates()
+	if err != nil {
+		http.Error(w, "Failed to list email templates", http.StatusInternalServerError)
+		return
+	}
+
+	current, err := h.queries.ListCurrentEmailTemplates(ctx)
+	if err != nil {
+		http.Error(w, "Failed to load email templates", http.StatusInternalServerError)
+		return
+	}
+	versions := make(map[string]db.EmailTemplateVersion, len(current))
+	for _, v := range current {
+		versions[v.Template] = v
+	}
+
+	views := make([]EmailTemplateView, len(templates))
+	for i, t := range templates {
+		v := versions[t.Name]
+		views[i] = EmailTemplateView{
+			Template:   t,
+			Current:    v,
+			Overridden: v.ID != 0 && !email.SourceOf(v).IsDefault(),
+		}
+	}
+
+	data := map[string]interface{}{
+		"Title":     "Šablony emailů",
+		"User":      user,
+		"DBUser":    dbUser,
+		"Templates": views,
+	}
+
+	h.render(w, "admin_email_templates.html", data)
+}
+
+// AdminEmailTemplateHandler shows the editor of an email template with a
+// preview for a chosen member and the version history
+// GET /admin/email-templates/{name}?user_id=
+func (h *Handler) AdminEmailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	tmpl, ok := email.LookupTemplate(chi.URLParam(r, "name"))
+	if !ok {
+		http.Error(w, "Email template not found", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+
+	dbUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	defaults, err := email.DefaultSource(tmpl)
+	if err != nil {
+		http.Error(w, "Failed to read email template", http.StatusInternalServerError)
+		return
+	}
+
+	versions, err := h.queries.ListEmailTemplateVersions(ctx, tmpl.Name)
+	if err != nil {
+		http.Error(w, "Failed to load template versions", http.StatusInternalServerError)
+		return
+	}
+
+	// The editor starts with the source in use, the defaults filled in
+	source := defaults
+	if len(versions) > 0 {
+		current := email.SourceOf(versions[0])
+		if current.Subject != "" {
+			source.Subject = current.Subject
+		}
+		if current.HTML != "" {
+			source.HTML = current.HTML
+			source.Text = "" // Generated from the HTML unless overridden
+		}
+		if current.Text != "" {
+			source.Text = current.Text
+		}
+	}
+
+	members, err := h.queries.ListUsers(ctx)
+	if err != nil {
+		http.Error(w, "Failed to load members", http.StatusInternalServerError)
+		return
+	}
+
+	previewUserID := dbUser.ID
+	if id, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64); err == nil {
+		previewUserID = id
+	}
+
+	data := map[string]interface{}{
+		"Title":         "Šablona emailu " + tmpl.Name,
+		"User":          user,
+		"DBUser":        dbUser,
+		"Template":      tmpl,
+		"Source":        source,
+		"Versions":      versions,
+		"Members":       members,
+		"PreviewUserID": previewUserID,
+	}
+
+	h.render(w, "admin_email_template.html", data)
+}
+
+// EmailTemplateRequest is the JSON body of the email template API. The
+// fields equal to the defaults are not saved, so the template follows later
+// changes of the files.
+type EmailTemplateRequest struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+	Note    string `json:"note"`
+	UserID  int64  `json:"user_id"` // Member whose data the preview uses
+}
+
+// source returns the overridden parts of the request
+func (req EmailTemplateRequest) source(tmpl email.Template) (email.Source, error) {
+	defaults, err := email.DefaultSource(tmpl)
+	if err != nil {
+		return email.Source{}, err
+	}
+
+	src := email.Source{Subject: req.Subject, HTML: req.HTML, Text: req.Text}
+	if src.Subject == defaults.Subject {
+		src.Subject = ""
+	}
+	if src.HTML == defaults.HTML {
+		src.HTML = ""
+		if src.Text == defaults.Text {
+			src.Text = ""
+		}
+	}
+	return src, nil
+}
+
+// AdminPreviewEmailTemplateHandler renders an edited template with the data
+// of a member without saving it
+// POST /api/admin/email-templates/{name}/preview
+func (h *Handler) AdminPreviewEmailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tmpl, ok := email.LookupTemplate(chi.URLParam(r, "name"))
+	if !ok {
+		h.jsonError(w, "Email template not found", http.StatusNotFound)
+		return
+	}
+
+	var req EmailTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	src, err := req.source(tmpl)
+	if err != nil {
+		h.jsonError(w, "Failed to read email template", http.StatusInternalServerError)
+		return
+	}
+
+	member, err := h.previewMember(ctx, user.ID, req.UserID)
+	if err != nil {
+		h.jsonError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	rendered, err := email.RenderSource(tmpl, src, h.emailPreviewData(ctx, member))
+	if err != nil {
+		h.jsonError(w, "Šablonu nelze vykreslit: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"subject":   rendered.Subject,
+		"html":      rendered.HTML,
+		"text":      rendered.Text,
+		"recipient": member.Email,
+	})
+}
+
+// AdminSaveEmailTemplateHandler saves an edited template as its new version.
+// It must render with the data of the admin.
+// PUT /api/admin/email-templates/{name}
+func (h *Handler) AdminSaveEmailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tmpl, ok := email.LookupTemplate(chi.URLParam(r, "name"))
+	if !ok {
+		h.jsonError(w, "Email template not found", http.StatusNotFound)
+		return
+	}
+
+	var req EmailTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	src, err := req.source(tmpl)
+	if err != nil {
+		h.jsonError(w, "Failed to read email template", http.StatusInternalServerError)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	h.saveEmailTemplate(w, r, tmpl, src, req.Note, adminDBUser, "update_email_template")
+}
+
+// AdminResetEmailTemplateHandler returns a template to the defaults with a new
+// empty version
+// POST /api/admin/email-templates/{name}/reset
+func (h *Handler) AdminResetEmailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tmpl, ok := email.LookupTemplate(chi.URLParam(r, "name"))
+	if !ok {
+		h.jsonError(w, "Email template not found", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	h.saveEmailTemplate(w, r, tmpl, email.Source{}, "Obnovení výchozí šablony", adminDBUser, "reset_email_template")
+}
+
+// AdminRestoreEmailTemplateHandler makes an older version of a template
+// current again, as a new version
+// POST /api/admin/email-templates/{name}/versions/{version}/restore
+func (h *Handler) AdminRestoreEmailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tmpl, ok := email.LookupTemplate(chi.URLParam(r, "name"))
+	if !ok {
+		h.jsonError(w, "Email template not found", http.StatusNotFound)
+		return
+	}
+
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	old, err := h.queries.GetEmailTemplateVersion(ctx, db.GetEmailTemplateVersionParams{
+		Template: tmpl.Name,
+		Version:  version,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		h.jsonError(w, "Version not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		h.jsonError(w, "Failed to load version", http.StatusInternalServerError)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	h.saveEmailTemplate(w, r, tmpl, email.SourceOf(old), fmt.Sprintf("Obnovení verze %d", version), adminDBUser, "restore_email_template")
+}
+
+// saveEmailTemplate validates the source by rendering it with the data of
+// the admin, saves it as a new version and writes the JSON response
+func (h *Handler) saveEmailTemplate(w http.ResponseWriter, r *http.Request, tmpl email.Template, src email.Source, note string, admin db.User, action string) {
+	ctx := r.Context()
+
+	if current, err := h.queries.GetCurrentEmailTemplate(ctx, tmpl.Name); err == nil {
+		if email.SourceOf(current) == src {
+			h.jsonError(w, "Šablona se nezměnila", http.StatusBadRequest)
+			return
+		}
+	} else if src.IsDefault() {
+		h.jsonError(w, "Šablona se nezměnila", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := email.RenderSource(tmpl, src, h.emailPreviewData(ctx, admin)); err != nil {
+		h.jsonError(w, "Šablonu nelze vykreslit: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.queries.CreateEmailTemplateVersion(ctx, db.CreateEmailTemplateVersionParams{
+		Template:  tmpl.Name,
+		Subject:   src.Subject,
+		HtmlBody:  src.HTML,
+		TextBody:  src.Text,
+		Note:      sql.NullString{String: note, Valid: note != ""},
+		CreatedBy: sql.NullInt64{Int64: admin.ID, Valid: admin.ID != 0},
+	})
+	if err != nil {
+		h.jsonError(w, "Failed to save email template", http.StatusInternalServerError)
+		return
+	}
+
+	h.logEmailTemplateChange(ctx, admin, action, saved)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"version": saved.Version,
+		"message": fmt.Sprintf("Saved version %d of %s", saved.Version, tmpl.Name),
+	})
+}
+
+// previewMember returns the member whose data a preview uses, the admin when
+// userID is 0
+func (h *Handler) previewMember(ctx context.Context, keycloakID string, userID int64) (db.User, error) {
+	if userID != 0 {
+		return h.queries.GetUserByID(ctx, userID)
+	}
+	return h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: keycloakID,
+		Valid:  true,
+	})
+}
+
+// emailPreviewData returns the data of every email template for a member,
+// with the member's balance, fee and level
+func (h *Handler) emailPreviewData(ctx context.Context, member db.User) map[string]interface{} {
+	values := email.PreviewValues{MonthlyFee: member.LevelActualAmount}
+	if balance, err := h.queries.GetUserBalance(ctx, db.GetUserBalanceParams{
+		UserID:   sql.NullInt64{Int64: member.ID, Valid: true},
+		UserID_2: member.ID,
+	}); err == nil {
+		values.Balance = money.FromHalere(balance)
+	}
+	if level, err := h.queries.GetLevel(ctx, member.LevelID); err == nil {
+		values.LevelName = level.Name
+		if values.MonthlyFee.IsZero() {
+			values.MonthlyFee = level.Amount
+		}
+	}
+	return h.emailClient.PreviewData(&member, values)
+}
+
+// logEmailTemplateChange writes an admin change of an email template to
+// system_logs
+func (h *Handler) logEmailTemplateChange(ctx context.Context, admin db.User, action string, version db.EmailTemplateVersion) {
+	adminUsername := "unknown"
+	if admin.Username.Valid {
+		adminUsername = admin.Username.String
+	}
+
+	metadata, _ := json.Marshal(struct {
+		AdminUserID int64  `json:"admin_user_id"`
+		Action      string `json:"action"`
+		Template    string `json:"template"`
+		Version     int64  `json:"version"`
+		Overridden  bool   `json:"overridden"`
+		Note        string `json:"note"`
+	}{admin.ID, action, version.Template, version.Version, !email.SourceOf(version).IsDefault(), version.Note.String})
+
+	h.queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "admin",
+		Level:     "info",
+		UserID:    sql.NullInt64{Int64: admin.ID, Valid: admin.ID != 0},
+		Message:   fmt.Sprintf("Admin %s (%s) saved version %d of email template %s", adminUsername, admin.Email, version.Version, version.Template),
+		Metadata:  sql.NullString{String: string(metadata), Valid: true},
+	})
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/base48/member-portal/internal/auth"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestAdminEmailTemplates(t *testing.T) {
+	h, sent := newTestHandler(t)
+	ctx := context.Background()
+
+	admin, err := h.queries.CreateUser(ctx, db.CreateUserParams{
+		KeycloakID: sql.NullString{String: "kc-admin", Valid: true},
+		Email:      "admin@example.com",
+		Realname:   sql.NullString{String: "Admin", Valid: true},
+		LevelID:    1,
+		State:      "accepted",
+	})
+	if err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	member, err := h.queries.CreateUser(ctx, db.CreateUserParams{
+		KeycloakID:        sql.NullString{String: "kc-member", Valid: true},
+		Email:             "novak@example.com",
+		Realname:          sql.NullString{String: "Jan Novák", Valid: true},
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "4242", Valid: true},
+		State:             "accepted",
+	})
+	if err != nil {
+		t.Fatalf("create member: %v", err)
+	}
+	adminUser := &auth.User{ID: admin.KeycloakID.String, Email: admin.Email, Roles: []string{"memberportal_admin"}}
+
+	r := chi.NewRouter()
+	r.Put("/api/admin/email-templates/{name}", h.AdminSaveEmailTemplateHandler)
+	r.Post("/api/admin/email-templates/{name}/preview", h.AdminPreviewEmailTemplateHandler)
+	r.Post("/api/admin/email-templates/{name}/reset", h.AdminResetEmailTemplateHandler)
+	r.Post("/api/admin/email-templates/{name}/versions/{version}/restore", h.AdminRestoreEmailTemplateHandler)
+
+	call := func(method, path string, body interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		encoded, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, strings.NewReader(string(encoded)))
+		withSession(t, h, req, adminUser)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	// Preview of the default template with the member's data
+	code, resp := call(http.MethodPost, "/api/admin/email-templates/debt_warning.html/preview", map[string]interface{}{"user_id": member.ID})
+	if code != http.StatusOK || resp["subject"] != "⚠️ Upozornění na dluh za členství" ||
+		!strings.Contains(resp["html"].(string), "Jan Novák") || !strings.Contains(resp["html"].(string), "4242") {
+		t.Fatalf("preview: %d %v", code, resp)
+	}
+
+	if code, _ := call(http.MethodPost, "/api/admin/email-templates/missing.html/preview", nil); code != http.StatusNotFound {
+		t.Errorf("missing template: %d", code)
+	}
+	if code, resp := call(http.MethodPost, "/api/admin/email-templates/welcome.html/preview", map[string]string{"html": "{{.Name"}); code != http.StatusBadRequest {
+		t.Errorf("broken preview: %d %v", code, resp)
+	}
+
+	// A broken template is not saved
+	if code, resp := call(http.MethodPut, "/api/admin/email-templates/welcome.html", map[string]string{"subject": "Vítej, {{.Nmae}}!"}); code != http.StatusBadRequest {
+		t.Errorf("broken save: %d %v", code, resp)
+	}
+
+	code, resp = call(http.MethodPut, "/api/admin/email-templates/welcome.html", map[string]string{
+		"subject": "Vítej, {{.Name}}!",
+		"html":    "<p>Nazdar {{.Name}}</p>",
+		"note":    "kratší uvítání",
+	})
+	if code != http.StatusOK || resp["version"] != float64(1) {
+		t.Fatalf("save: %d %v", code, resp)
+	}
+	if code, _ := call(http.MethodPut, "/api/admin/email-templates/welcome.html", map[string]string{
+		"subject": "Vítej, {{.Name}}!",
+		"html":    "<p>Nazdar {{.Name}}</p>",
+	}); code != http.StatusBadRequest {
+		t.Errorf("unchanged save: %d", code)
+	}
+
+	rendered, err := h.emailClient.Render(ctx, mustLookup(t, "welcome.html"), h.emailPreviewData(ctx, member))
+	if err != nil || rendered.Subject != "Vítej, Jan Novák!" || rendered.HTML != "<p>Nazdar Jan Novák</p>" {
+		t.Errorf("edited: %+v, %v", rendered, err)
+	}
+
+	// Reset and restore add versions
+	if code, resp := call(http.MethodPost, "/api/admin/email-templates/welcome.html/reset", nil); code != http.StatusOK || resp["version"] != float64(2) {
+		t.Errorf("reset: %d %v", code, resp)
+	}
+	if code, _ := call(http.MethodPost, "/api/admin/email-templates/welcome.html/reset", nil); code != http.StatusBadRequest {
+		t.Errorf("second reset: %d", code)
+	}
+	if code, resp := call(http.MethodPost, "/api/admin/email-templates/welcome.html/versions/1/restore", nil); code != http.StatusOK || resp["version"] != float64(3) {
+		t.Errorf("restore: %d %v", code, resp)
+	}
+	if code, _ := call(http.MethodPost, "/api/admin/email-templates/welcome.html/versions/9/restore", nil); code != http.StatusNotFound {
+		t.Errorf("restore missing: %d", code)
+	}
+
+	current, err := h.queries.GetCurrentEmailTemplate(ctx, "welcome.html")
+	if err != nil || current.Version != 3 || current.HtmlBody != "<p>Nazdar {{.Name}}</p>" || current.Note.String != "Obnovení verze 1" {
+		t.Errorf("current %+v, %v", current, err)
+	}
+
+	logs, err := h.queries.ListLogsBySubsystem(ctx, db.ListLogsBySubsystemParams{Subsystem: "admin", Limit: 10})
+	if err != nil || len(logs) != 3 {
+		t.Fatalf("logs %+v, %v", logs, err)
+	}
+	var actions []string
+	for _, l := range logs {
+		var metadata struct{ Action string }
+		json.Unmarshal([]byte(l.Metadata.String), &metadata)
+		actions = append(actions, metadata.Action)
+	}
+	sort.Strings(actions)
+	if strings.Join(actions, ",") != "reset_email_template,restore_email_template,update_email_template" {
+		t.Errorf("logged %v", actions)
+	}
+
+	// The test email uses the current version with the chosen member's data
+	form := url.Values{"type": {"welcome"}, "email": {"test@example.com"}, "user_id": {strconv.FormatInt(member.ID, 10)}}
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/test-email", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	withSession(t, h, req, adminUser)
+	rec := httptest.NewRecorder()
+	h.AdminTestEmailHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("test email: %d %s", rec.Code, rec.Body)
+	}
+	if result, err := h.emailClient.Deliver(ctx, time.Now()); err != nil || result.Sent != 1 {
+		t.Fatalf("deliver: %+v, %v", result, err)
+	}
+	if messages := sent.Messages(); len(messages) != 1 || messages[0].To[0] != "test@example.com" ||
+		messages[0].Subject() != "Vítej, Jan Novák!" || !strings.Contains(messages[0].Text(), "Nazdar Jan Novák") {
+		t.Errorf("sent %+v", messages)
+	}
+}
+
+func mustLookup(t *testing.T, name string) email.Template {
+	t.Helper()
+	tmpl, ok := email.LookupTemplate(name)
+	if !ok {
+		t.Fatalf("template %s not found", name)
+	}
+	return tmpl
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/email"
+	"github.com/go-chi/chi/v5"
+)
+
+// EmailView is an outbox email prepared for the admin_emails.html template
+type EmailView struct {
+	db.EmailOutbox
+	Label string // Czech label of the status
+}
+
+// EmailStatusView is the number of outbox emails in a status
+type EmailStatusView struct {
+	Status string
+	Label  string
+	Count  int64
+}
+
+// AdminEmailsHandler shows the email outbox with a status filter
+// GET /admin/emails
+func (h *Handler) AdminEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+
+	status := r.URL.Query().Get("status")
+	limit := int64(100)
+	if parsed, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64); err == nil && parsed > 0 {
+		limit = parsed
+	}
+
+	emails, err := h.queries.ListEmails(ctx, db.ListEmailsParams{
+		Status: sql.NullString{String: status, Valid: status != ""},
+		Limit:  limit,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	views := make([]EmailView, 0, len(emails))
+	for _, e := range emails {
+		views = append(views, EmailView{EmailOutbox: e, Label: email.StatusLabel(e.Status)})
+	}
+
+	counts, err := h.queries.CountEmailsByStatus(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	byStatus := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		byStatus[c.Status] = c.Count
+	}
+	statuses := make([]EmailStatusView, 0, len(email.Statuses))
+	for _, s := range email.Statuses {
+		statuses = append(statuses, EmailStatusView{Status: s, Label: email.StatusLabel(s), Count: byStatus[s]})
+	}
+
+	dbUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	data := map[string]interface{}{
+		"Title":         "Emaily",
+		"User":          user,
+		"DBUser":        dbUser,
+		"Emails":        views,
+		"Statuses":      statuses,
+		"Status":        status,
+		"Limit":         limit,
+		"EmailsEnabled": h.emailClient.Enabled(),
+	}
+
+	h.render(w, "admin_emails.html", data)
+}
+
+// AdminResendEmailHandler queues an email again with a fresh set of attempts
+// POST /api/admin/emails/{id}/resend
+func (h *Handler) AdminResendEmailHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	message, err := h.queries.GetEmail(ctx, id)
+	if err != nil {
+		h.jsonError(w, "Email not found", http.StatusNotFound)
+		return
+	}
+	if message.Status == email.StatusSending {
+		h.jsonError(w, "Email se právě odesílá", http.StatusConflict)
+		return
+	}
+	if err := h.emailClient.Resend(ctx, id); err != nil {
+		h.jsonError(w, "Failed to resend email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	h.logEmailAction(ctx, adminDBUser, "resend_email", message)
+
+	h.jsonSuccess(w, "Email queued again")
+}
+
+// AdminCancelEmailHandler cancels a queued email
+// POST /api/admin/emails/{id}/cancel
+func (h *Handler) AdminCancelEmailHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	message, err := h.queries.GetEmail(ctx, id)
+	if err != nil {
+		h.jsonError(w, "Email not found", http.StatusNotFound)
+		return
+	}
+	cancelled, err := h.queries.CancelEmail(ctx, id)
+	if err != nil {
+		h.jsonError(w, "Failed to cancel email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if cancelled == 0 {
+		h.jsonError(w, "Zrušit jde jen email ve frontě", http.StatusConflict)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	h.logEmailAction(ctx, adminDBUser, "cancel_email", message)
+
+	h.jsonSuccess(w, "Email cancelled")
+}
+
+// logEmailAction writes an admin action on an outbox email to system_logs
+func (h *Handler) logEmailAction(ctx context.Context, admin db.User, action string, e db.EmailOutbox) {
+	adminUsername := "unknown"
+	if admin.Username.Valid {
+		adminUsername = admin.Username.String
+	}
+
+	verb := "resent"
+	if action == "cancel_email" {
+		verb = "cancelled"
+	}
+
+	metadata, _ := json.Marshal(struct {
+		AdminUserID    int64  `json:"admin_user_id"`
+		Action         string `json:"action"`
+		OutboxID       int64  `json:"outbox_id"`
+		PreviousStatus string `json:"previous_status"`
+		Attempts       int64  `json:"attempts"`
+	}{admin.ID, action, e.ID, e.Status, e.Attempts})
+
+	h.queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "admin",
+		Level:     "info",
+		UserID:    sql.NullInt64{Int64: admin.ID, Valid: admin.ID != 0},
+		Message:   fmt.Sprintf("Admin %s (%s) %s email %d to %s: %s", adminUsername, admin.Email, verb, e.ID, e.Recipient, e.Subject),
+		Metadata:  sql.NullString{String: string(metadata), Valid: true},
+	})
+}
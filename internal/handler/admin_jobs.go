@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/scheduler"
+)
+
+// JobView is a registered job prepared for the admin_jobs.html template
+type JobView struct {
+	Name        string
+	Description string
+	Schedule    string
+	NextRun     string
+	Running     bool
+	LastRun     *JobRunView
+}
+
+// JobRunView is a job_runs row prepared for the admin_jobs.html template
+type JobRunView struct {
+	ID        int64
+	JobName   string
+	Source    string
+	Status    string
+	StartedAt string
+	Duration  string
+	Summary   string
+	Error     string
+	Output    string
+}
+
+func newJobRunView(run db.JobRun) *JobRunView {
+	view := &JobRunView{
+		ID:        run.ID,
+		JobName:   run.JobName,
+		Source:    run.Source,
+		Status:    run.Status,
+		StartedAt: run.StartedAt.Local().Format("2006-01-02 15:04:05"),
+		Duration:  "-",
+		Summary:   run.Summary.String,
+		Error:     run.Error.String,
+		Output:    run.Output.String,
+	}
+	if run.DurationMs.Valid {
+		view.Duration = formatDuration(time.Duration(run.DurationMs.Int64) * time.Millisecond)
+	}
+	return view
+}
+
+// formatDuration formats a job duration as "850 ms", "12.3 s" or "4m 05s"
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%d ms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.1f s", d.Seconds())
+	default:
+		return fmt.Sprintf("%dm %02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+}
+
+// AdminJobsHandler shows registered background jobs and their run history
+// GET /admin/jobs
+func (h *Handler) AdminJobsHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	if h.scheduler == nil {
+		http.Error(w, "Scheduler not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := r.Context()
+	jobFilter := r.URL.Query().Get("job")
+
+	statuses, err := h.scheduler.Status(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	jobs := make([]JobView, 0, len(statuses))
+	for _, st := range statuses {
+		view := JobView{
+			Name:        st.Name,
+			Description: st.Description,
+			Schedule:    st.Schedule,
+			NextRun:     "-",
+			Running:     st.Running,
+		}
+		if !st.NextRun.IsZero() {
+			view.NextRun = st.NextRun.Format("2006-01-02 15:04")
+		}
+		if st.LastRun != nil {
+			view.LastRun = newJobRunView(*st.LastRun)
+		}
+		jobs = append(jobs, view)
+	}
+
+	runs, err := h.queries.ListJobRuns(ctx, db.ListJobRunsParams{
+		Column1: jobFilter,
+		JobName: jobFilter,
+		Limit:   50,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	runViews := make([]*JobRunView, 0, len(runs))
+	for _, run := range runs {
+		runViews = append(runViews, newJobRunView(run))
+	}
+
+	// Get DBUser for layout
+	dbUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	data := map[string]interface{}{
+		"Title":            "Plánované úlohy",
+		"User":             user,
+		"DBUser":           dbUser,
+		"Jobs":             jobs,
+		"Runs":             runViews,
+		"JobFilter":        jobFilter,
+		"SchedulerRunning": h.scheduler.Started(),
+	}
+
+	h.render(w, "admin_jobs.html", data)
+}
+
+// RunJobRequest is the request body for starting a job manually
+type RunJobRequest struct {
+	Job string `json:"job"`
+}
+
+// AdminRunJobHandler starts a job immediately ("run now")
+// POST /api/admin/jobs/run
+// Body: {"job": "fio_sync"}
+func (h *Handler) AdminRunJobHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !user.IsAdmin() {
+		h.jsonError(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	if h.scheduler == nil {
+		h.jsonError(w, "Scheduler not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req RunJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	adminID := sql.NullInt64{Int64: adminDBUser.ID, Valid: adminDBUser.ID > 0}
+
+	run, err := h.scheduler.Trigger(req.Job, adminID)
+	if errors.Is(err, scheduler.ErrUnknownJob) {
+		h.jsonError(w, fmt.Sprintf("Unknown job: %s", req.Job), http.StatusNotFound)
+		return
+	} else if errors.Is(err, scheduler.ErrAlreadyRunning) {
+		h.jsonError(w, fmt.Sprintf("Job %s is already running", req.Job), http.StatusConflict)
+		return
+	} else if err != nil {
+		h.jsonError(w, "Failed to start job: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	metadata, _ := json.Marshal(struct {
+		Job   string `json:"job"`
+		RunID int64  `json:"run_id"`
+	}{req.Job, run.ID})
+	h.queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "scheduler",
+		Level:     "info",
+		UserID:    adminID,
+		Message:   fmt.Sprintf("Admin %s manually started job %s", adminDBUser.Email, req.Job),
+		Metadata:  sql.NullString{String: string(metadata), Valid: true},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Job %s started", req.Job),
+		"run_id":  run.ID,
+	})
+}
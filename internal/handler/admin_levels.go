@@ -0,0 +1,390 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/levels"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/go-chi/chi/v5"
+)
+
+// LevelView is a membership level prepared for the admin_levels.html template
+type LevelView struct {
+	db.Level
+	Price        money.Amount // Price today, a due price change may not be applied yet
+	Members      int64        // Accepted or suspended members on the level
+	Awaiting     bool         // The placeholder level of applicants, cannot be edited
+	PriceChanges []PriceChangeView
+}
+
+// PriceChangeView is a scheduled or applied price change of a level
+type PriceChangeView struct {
+	db.LevelPriceChange
+	From    string // MM/YYYY
+	Pending bool   // Takes effect later
+}
+
+// AdminLevelsHandler shows the membership levels with their members and
+// scheduled price changes
+// GET /admin/levels
+func (h *Handler) AdminLevelsHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	now := time.Now()
+
+	dbUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	allLevels, err := h.queries.ListAllLevels(ctx)
+	if err != nil {
+		http.Error(w, "Failed to load levels", http.StatusInternalServerError)
+		return
+	}
+
+	counts, err := h.queries.CountMembersByLevel(ctx)
+	if err != nil {
+		http.Error(w, "Failed to count members", http.StatusInternalServerError)
+		return
+	}
+	members := make(map[int64]int64, len(counts))
+	for _, c := range counts {
+		members[c.LevelID] = c.Members
+	}
+
+	priceChanges, err := h.queries.ListLevelPriceChanges(ctx)
+	if err != nil {
+		http.Error(w, "Failed to load price changes", http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]LevelView, 0, len(allLevels))
+	for _, l := range allLevels {
+		view := LevelView{
+			Level:    l,
+			Price:    membership.PriceOn(l, priceChanges, now),
+			Members:  members[l.ID],
+			Awaiting: l.ID == membership.AwaitingLevelID,
+		}
+		for _, c := range priceChanges {
+			if c.LevelID != l.ID {
+				continue
+			}
+			view.PriceChanges = append(view.PriceChanges, PriceChangeView{
+				LevelPriceChange: c,
+				From:             c.EffectiveFrom.Format("01/2006"),
+				Pending:          c.EffectiveFrom.After(now),
+			})
+		}
+		views = append(views, view)
+	}
+
+	data := map[string]interface{}{
+		"Title":      "Úrovně členství",
+		"User":       user,
+		"DBUser":     dbUser,
+		"Levels":     views,
+		"NextPeriod": membership.NextPeriod(now).Format("2006-01"),
+	}
+
+	h.render(w, "admin_levels.html", data)
+}
+
+// LevelRequest is the JSON body of POST /api/admin/levels and
+// PUT /api/admin/levels/{id}
+type LevelRequest struct {
+	Name   string `json:"name"`
+	Amount string `json:"amount"`
+	Active bool   `json:"active"`
+}
+
+// form converts the request to a level form
+func (req LevelRequest) form() (levels.Form, error) {
+	amount, err := money.Parse(req.Amount)
+	if err != nil {
+		return levels.Form{}, fmt.Errorf("neplatná částka '%s'", req.Amount)
+	}
+	return levels.Form{Name: req.Name, Amount: amount, Active: req.Active}, nil
+}
+
+// AdminCreateLevelHandler creates a membership level
+// POST /api/admin/levels
+func (h *Handler) AdminCreateLevelHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req LevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	form, err := req.form()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	level, err := levels.Create(ctx, h.queries, form)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	h.logLevelChange(ctx, adminDBUser, "create_level", level,
+		fmt.Sprintf("created level %s (%s, active: %t)", level.Name, level.Amount.Format(), level.Active))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"level":   level,
+		"message": "Level created successfully",
+	})
+}
+
+// AdminUpdateLevelHandler renames, reprices, activates or deactivates a level.
+// A level still in use cannot be deactivated.
+// PUT /api/admin/levels/{id}
+func (h *Handler) AdminUpdateLevelHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	levelID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid level ID", http.StatusBadRequest)
+		return
+	}
+
+	var req LevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	form, err := req.form()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	now := time.Now()
+
+	current, err := h.queries.GetLevel(ctx, levelID)
+	if err != nil {
+		h.jsonError(w, "Level not found", http.StatusNotFound)
+		return
+	}
+
+	level, err := levels.Update(ctx, h.queries, current, form, now)
+	if errors.Is(err, levels.ErrInUse) {
+		usage, _ := levels.UsageOf(ctx, h.queries, current.ID, now)
+		h.jsonError(w, fmt.Sprintf("Úroveň %s se stále používá (%s), nelze ji deaktivovat. Nejdříve členy převeďte na jinou úroveň.", current.Name, usage), http.StatusConflict)
+		return
+	} else if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	h.logLevelChange(ctx, adminDBUser, "update_level", level,
+		fmt.Sprintf("updated level %s: name '%s' -> '%s', amount %s -> %s, active %t -> %t",
+			current.Name, current.Name, level.Name, current.Amount.Format(), level.Amount.Format(), current.Active, level.Active))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"level":   level,
+		"message": "Level updated successfully",
+	})
+}
+
+// PriceChangeRequest is the JSON body of POST /api/admin/levels/{id}/price-change
+type PriceChangeRequest struct {
+	Amount string `json:"amount"`
+	From   string `json:"from"`    // YYYY-MM, the first month of the new price
+	DryRun bool   `json:"dry_run"` // Only list the affected members
+}
+
+// AffectedMemberResponse is a member a price change moves to the new fee
+type AffectedMemberResponse struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	OldFee string `json:"old_fee"`
+	NewFee string `json:"new_fee"`
+}
+
+// AdminLevelPriceChangeHandler previews or schedules a change of the level's
+// price from a given month. Scheduling moves the affected members to the new
+// fee from that month and emails them.
+// POST /api/admin/levels/{id}/price-change
+func (h *Handler) AdminLevelPriceChangeHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	levelID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid level ID", http.StatusBadRequest)
+		return
+	}
+
+	var req PriceChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	amount, err := money.Parse(req.Amount)
+	if err != nil {
+		h.jsonError(w, fmt.Sprintf("neplatná částka '%s'", req.Amount), http.StatusBadRequest)
+		return
+	}
+	from, err := time.Parse("2006-01", req.From)
+	if err != nil {
+		h.jsonError(w, fmt.Sprintf("neplatný měsíc '%s', očekává se RRRR-MM", req.From), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	level, err := h.queries.GetLevel(ctx, levelID)
+	if err != nil {
+		h.jsonError(w, "Level not found", http.StatusNotFound)
+		return
+	}
+
+	// Planned again on confirmation, members may have changed since the preview
+	plan, err := levels.PlanPriceChange(ctx, h.queries, level, amount, from, time.Now())
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	affected := make([]AffectedMemberResponse, len(plan.Affected))
+	for i, a := range plan.Affected {
+		affected[i] = AffectedMemberResponse{
+			ID:     a.Member.ID,
+			Name:   a.Member.Realname.String,
+			Email:  a.Member.Email,
+			OldFee: a.OldFee.Format(),
+			NewFee: a.NewFee.Format(),
+		}
+	}
+
+	if req.DryRun {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":    true,
+			"dry_run":    true,
+			"old_amount": plan.OldAmount.Format(),
+			"new_amount": plan.NewAmount.Format(),
+			"from":       plan.From.Format("01/2006"),
+			"affected":   affected,
+		})
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	change, err := levels.SchedulePriceChange(ctx, h.queries, plan, adminDBUser.ID)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Emails are logged by the client, failures are reported to the admin
+	var warnings []string
+	for _, a := range plan.Affected {
+		member := a.Member
+		if err := h.emailClient.SendLevelPriceChange(ctx, &member, level.Name, a.OldFee, a.NewFee, plan.From); err != nil {
+			warnings = append(warnings, fmt.Sprintf("E-mail pro %s se nepodařilo odeslat: %v", member.Email, err))
+		}
+	}
+	notified := int64(len(plan.Affected) - len(warnings))
+	if err := h.queries.UpdateLevelPriceChangeNotified(ctx, db.UpdateLevelPriceChangeNotifiedParams{
+		MembersNotified: notified,
+		ID:              change.ID,
+	}); err != nil {
+		warnings = append(warnings, fmt.Sprintf("Počet odeslaných e-mailů se nepodařilo uložit: %v", err))
+	}
+
+	h.logLevelChange(ctx, adminDBUser, "schedule_price_change", level,
+		fmt.Sprintf("scheduled price of level %s from %s: %s -> %s, %d member(s) affected, %d notified",
+			level.Name, plan.From.Format("2006-01"), plan.OldAmount.Format(), plan.NewAmount.Format(), len(plan.Affected), notified))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"message":  fmt.Sprintf("Price change scheduled from %s, %d member(s) affected, %d notified", plan.From.Format("2006-01"), len(plan.Affected), notified),
+		"affected": affected,
+		"notified": notified,
+		"warnings": warnings,
+	})
+}
+
+// logLevelChange writes an admin change of a membership level to system_logs
+func (h *Handler) logLevelChange(ctx context.Context, admin db.User, action string, level db.Level, summary string) {
+	adminUsername := "unknown"
+	if admin.Username.Valid {
+		adminUsername = admin.Username.String
+	}
+
+	metadata, _ := json.Marshal(struct {
+		AdminUserID int64        `json:"admin_user_id"`
+		Action      string       `json:"action"`
+		LevelID     int64        `json:"level_id"`
+		LevelName   string       `json:"level_name"`
+		Amount      money.Amount `json:"amount"`
+		Active      bool         `json:"active"`
+	}{admin.ID, action, level.ID, level.Name, level.Amount, level.Active})
+
+	h.queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "admin",
+		Level:     "info",
+		UserID:    sql.NullInt64{Int64: admin.ID, Valid: admin.ID != 0},
+		Message:   fmt.Sprintf("Admin %s (%s) %s", adminUsername, admin.Email, summary),
+		Metadata:  sql.NullString{String: string(metadata), Valid: true},
+	})
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/base48/member-portal/internal/jobs"
+)
+
+// maxStatementSize limits the uploaded statement file
+const maxStatementSize = 10 << 20
+
+// ImportRowView is one transaction of an imported statement prepared for the
+// admin_payments_import.html template
+type ImportRowView struct {
+	Action       string
+	ID           string
+	Date         string
+	Amount       string
+	IsIncoming   bool
+	VS           string
+	UserID       int64
+	UserName     string
+	Counterparty string
+	Message      string
+	Note         string
+}
+
+// AdminImportStatementHandler imports payments from a statement file
+// downloaded from FIO internet banking (GPC, CSV or CAMT.053 XML).
+// The first POST is always a dry run, the preview page carries the file
+// content in a hidden field so the admin can confirm without uploading again.
+// GET  /admin/payments/import
+// POST /admin/payments/import (multipart: statement file, action=preview|import)
+func (h *Handler) AdminImportStatementHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	if h.jobDeps == nil {
+		http.Error(w, "Jobs not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Get DBUser for layout
+	dbUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	data := map[string]interface{}{
+		"Title":  "Import výpisu",
+		"User":   user,
+		"DBUser": dbUser,
+	}
+
+	if r.Method != http.MethodPost {
+		h.render(w, "admin_payments_import.html", data)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 2*maxStatementSize)
+	if err := r.ParseMultipartForm(maxStatementSize); err != nil {
+		data["Error"] = fmt.Sprintf("Soubor se nepodařilo nahrát: %v", err)
+		h.render(w, "admin_payments_import.html", data)
+		return
+	}
+
+	filename, content, err := readStatementUpload(r)
+	if err != nil {
+		data["Error"] = err.Error()
+		h.render(w, "admin_payments_import.html", data)
+		return
+	}
+
+	dryRun := r.FormValue("action") != "import"
+	adminID := sql.NullInt64{Int64: dbUser.ID, Valid: dbUser.ID > 0}
+	logger := log.New(log.Writer(), "[fio_import] ", log.LstdFlags)
+
+	result, err := jobs.ImportFIOStatement(ctx, h.jobDeps, logger, filename, content, dryRun, adminID)
+	if result == nil {
+		data["Error"] = fmt.Sprintf("Výpis se nepodařilo načíst: %v", err)
+		h.render(w, "admin_payments_import.html", data)
+		return
+	}
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+
+	// Resolve matched users for the preview table
+	names := make(map[int64]string)
+	rows := make([]ImportRowView, 0, len(result.Outcomes))
+	for _, o := range result.Outcomes {
+		row := ImportRowView{
+			Action:       o.Action,
+			ID:           o.Transaction.KindID,
+			Date:         o.Transaction.Date.Format("2006-01-02"),
+			Amount:       o.Transaction.Amount.Format(),
+			IsIncoming:   o.Transaction.Amount.IsPositive(),
+			VS:           o.VariableSymbol,
+			Counterparty: o.Transaction.RemoteName,
+			Message:      o.Transaction.Message,
+			Note:         o.Note,
+		}
+		if row.Counterparty == "" {
+			row.Counterparty = o.Transaction.RemoteAccount
+		}
+		if o.UserID.Valid {
+			row.UserID = o.UserID.Int64
+			name, ok := names[row.UserID]
+			if !ok {
+				if u, err := h.queries.GetUserByID(ctx, row.UserID); err == nil {
+					name = u.Email
+					if u.Realname.Valid && u.Realname.String != "" {
+						name = u.Realname.String
+					}
+				}
+				names[row.UserID] = name
+			}
+			row.UserName = name
+		}
+		rows = append(rows, row)
+	}
+
+	data["Result"] = result
+	data["Rows"] = rows
+	data["Filename"] = filename
+	if dryRun {
+		data["StatementData"] = base64.StdEncoding.EncodeToString(content)
+	}
+
+	h.render(w, "admin_payments_import.html", data)
+}
+
+// readStatementUpload returns the uploaded file, or the file carried over from
+// the preview in the statement_data field
+func readStatementUpload(r *http.Request) (string, []byte, error) {
+	if encoded := r.FormValue("statement_data"); encoded != "" {
+		content, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", nil, fmt.Errorf("Neplatná data výpisu")
+		}
+		return r.FormValue("filename"), content, nil
+	}
+
+	file, header, err := r.FormFile("statement")
+	if err != nil {
+		return "", nil, fmt.Errorf("Vyberte soubor s výpisem")
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, maxStatementSize+1))
+	if err != nil {
+		return "", nil, fmt.Errorf("Soubor se nepodařilo přečíst: %v", err)
+	}
+	if len(content) > maxStatementSize {
+		return "", nil, fmt.Errorf("Soubor je příliš velký (max %d MB)", maxStatementSize>>20)
+	}
+
+	return header.Filename, content, nil
+}
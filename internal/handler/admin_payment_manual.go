@@ -0,0 +1,407 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/payments"
+	"github.com/go-chi/chi/v5"
+)
+
+// ManualPaymentForm is the manual payment form (empty for a new payment)
+type ManualPaymentForm struct {
+	ID           int64
+	KindID       string
+	UserID       int64
+	ProjectID    int64
+	Date         string // YYYY-MM-DD
+	Amount       string
+	Method       string
+	StaffComment string
+}
+
+// AdminNewPaymentHandler shows the form for entering a cash or in-kind payment
+// GET /admin/payments/new?user_id=
+func (h *Handler) AdminNewPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	form := ManualPaymentForm{
+		Date:   time.Now().Format("2006-01-02"),
+		Method: payments.MethodCash,
+	}
+	form.UserID, _ = strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+
+	h.renderManualPaymentForm(w, r, form)
+}
+
+// AdminEditPaymentHandler shows the form for editing a manual payment
+// GET /admin/payments/{id}/edit
+func (h *Handler) AdminEditPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	paymentID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	payment, err := h.queries.GetPayment(r.Context(), paymentID)
+	if err != nil {
+		http.Error(w, "Payment not found", http.StatusNotFound)
+		return
+	}
+	if payment.Kind != payments.KindManual || payment.VoidedAt.Valid {
+		http.Error(w, "Only manual payments that are not voided can be edited", http.StatusConflict)
+		return
+	}
+
+	h.renderManualPaymentForm(w, r, ManualPaymentForm{
+		ID:           payment.ID,
+		KindID:       payment.KindID,
+		UserID:       payment.UserID.Int64,
+		ProjectID:    payment.ProjectID.Int64,
+		Date:         payment.Date.Format("2006-01-02"),
+		Amount:       payment.Amount.String(),
+		Method:       payment.LocalAccount,
+		StaffComment: payment.StaffComment.String,
+	})
+}
+
+func (h *Handler) renderManualPaymentForm(w http.ResponseWriter, r *http.Request, form ManualPaymentForm) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+
+	dbUser, err := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	users, err := h.queries.ListUsers(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
+	}
+
+	projects, err := h.queries.ListProjects(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch projects", http.StatusInternalServerError)
+		return
+	}
+
+	title := "Nová platba"
+	if form.ID != 0 {
+		title = "Úprava platby"
+	}
+
+	h.render(w, "admin_payment_form.html", map[string]interface{}{
+		"Title":    title,
+		"User":     user,
+		"DBUser":   dbUser,
+		"Form":     form,
+		"Users":    users,
+		"Projects": projects,
+	})
+}
+
+// ManualPaymentRequest is the request body for creating or editing a manual payment
+type ManualPaymentRequest struct {
+	UserID       *int64 `json:"user_id"`
+	ProjectID    *int64 `json:"project_id"`
+	Date         string `json:"date"`   // YYYY-MM-DD
+	Amount       string `json:"amount"` // e.g. "1000" or "1 000,50"
+	Method       string `json:"method"` // "cash" or "in_kind"
+	StaffComment string `json:"staff_comment"`
+}
+
+// manualPayment converts the request to a payments.ManualPayment
+func (req ManualPaymentRequest) manualPayment() (payments.ManualPayment, error) {
+	m := payments.ManualPayment{
+		Method:       req.Method,
+		StaffComment: req.StaffComment,
+	}
+	if req.UserID != nil {
+		m.UserID = sql.NullInt64{Int64: *req.UserID, Valid: true}
+	}
+	if req.ProjectID != nil {
+		m.ProjectID = sql.NullInt64{Int64: *req.ProjectID, Valid: true}
+	}
+
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		return m, fmt.Errorf("invalid date '%s'", req.Date)
+	}
+	m.Date = date
+
+	amount, err := money.Parse(req.Amount)
+	if err != nil {
+		return m, fmt.Errorf("invalid amount '%s'", req.Amount)
+	}
+	m.Amount = amount
+
+	return m, nil
+}
+
+// AdminCreatePaymentHandler records a manual (cash or in-kind) payment
+// POST /api/admin/payments
+func (h *Handler) AdminCreatePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ManualPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m, err := req.manualPayment()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	adminDBUser, err := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	if err != nil {
+		h.jsonError(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	m.RecordedBy = sql.NullInt64{Int64: adminDBUser.ID, Valid: true}
+
+	payment, err := payments.CreateManual(ctx, h.queries, m)
+	if err != nil {
+		h.jsonError(w, "Failed to record payment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.logManualPayment(ctx, adminDBUser, "create_manual", payment,
+		fmt.Sprintf("recorded manual payment #%d (%s, %s) for %s",
+			payment.ID, payment.Amount.Format(), payment.LocalAccount, h.paymentPayee(ctx, payment)),
+		nil, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Payment recorded",
+		"payment": payment,
+	})
+}
+
+// AdminUpdateManualPaymentHandler edits a manual payment
+// PUT /api/admin/payments/{id}
+func (h *Handler) AdminUpdateManualPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	paymentID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ManualPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m, err := req.manualPayment()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	before, err := h.queries.GetPayment(ctx, paymentID)
+	if err != nil {
+		h.jsonError(w, "Payment not found", http.StatusNotFound)
+		return
+	}
+
+	payment, err := payments.UpdateManual(ctx, h.queries, paymentID, m)
+	if err == payments.ErrNotEditable {
+		h.jsonError(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		h.jsonError(w, "Failed to update payment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	h.logManualPayment(ctx, adminDBUser, "update_manual", payment,
+		fmt.Sprintf("edited manual payment #%d: %s on %s for %s -> %s on %s for %s",
+			payment.ID,
+			before.Amount.Format(), before.Date.Format("2006-01-02"), h.paymentPayee(ctx, before),
+			payment.Amount.Format(), payment.Date.Format("2006-01-02"), h.paymentPayee(ctx, payment)),
+		&before, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Payment updated",
+		"payment": payment,
+	})
+}
+
+// VoidPaymentRequest is the request body for voiding a manual payment
+type VoidPaymentRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AdminVoidPaymentHandler voids a manual payment. It stays in the ledger but
+// no longer counts towards the balance.
+// POST /api/admin/payments/{id}/void
+func (h *Handler) AdminVoidPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	paymentID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	var req VoidPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	payment, err := payments.VoidManual(ctx, h.queries, paymentID, req.Reason)
+	if err == payments.ErrNotEditable {
+		h.jsonError(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		h.jsonError(w, "Failed to void payment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	h.logManualPayment(ctx, adminDBUser, "void_manual", payment,
+		fmt.Sprintf("voided manual payment #%d (%s on %s for %s): %s",
+			payment.ID, payment.Amount.Format(), payment.Date.Format("2006-01-02"), h.paymentPayee(ctx, payment), req.Reason),
+		nil, req.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Payment voided",
+	})
+}
+
+// paymentPayee describes who a payment is assigned to, for log messages
+func (h *Handler) paymentPayee(ctx context.Context, payment db.Payment) string {
+	if payment.UserID.Valid {
+		if u, err := h.queries.GetUserByID(ctx, payment.UserID.Int64); err == nil {
+			return "user " + u.Email
+		}
+		return fmt.Sprintf("user #%d", payment.UserID.Int64)
+	}
+	if payment.ProjectID.Valid {
+		if p, err := h.queries.GetProject(ctx, payment.ProjectID.Int64); err == nil {
+			return fmt.Sprintf("project '%s'", p.Name)
+		}
+		return fmt.Sprintf("project #%d", payment.ProjectID.Int64)
+	}
+	return "nobody"
+}
+
+// manualPaymentFields are the fields of a manual payment an admin can change
+type manualPaymentFields struct {
+	Amount    money.Amount `json:"amount"`
+	Date      string       `json:"date"`
+	UserID    int64        `json:"user_id"`
+	ProjectID int64        `json:"project_id"`
+	Method    string       `json:"method"`
+}
+
+// logManualPayment writes the audit log entry for a change of a manual
+// payment. before is the payment before an edit and reason why it was voided,
+// both are left out of the metadata when unset.
+func (h *Handler) logManualPayment(ctx context.Context, admin db.User, action string, payment db.Payment, message string, before *db.Payment, reason string) {
+	adminUsername := "unknown"
+	if admin.Username.Valid {
+		adminUsername = admin.Username.String
+	}
+
+	fields := func(p db.Payment) manualPaymentFields {
+		return manualPaymentFields{
+			Amount:    p.Amount,
+			Date:      p.Date.Format("2006-01-02"),
+			UserID:    p.UserID.Int64,
+			ProjectID: p.ProjectID.Int64,
+			Method:    p.LocalAccount,
+		}
+	}
+	metadata := struct {
+		AdminUserID int64  `json:"admin_user_id"`
+		Action      string `json:"action"`
+		PaymentID   int64  `json:"payment_id"`
+		Receipt     string `json:"receipt"`
+		manualPaymentFields
+		StaffComment string               `json:"staff_comment"`
+		Before       *manualPaymentFields `json:"before,omitempty"`
+		Reason       string               `json:"reason,omitempty"`
+	}{
+		AdminUserID:         admin.ID,
+		Action:              action,
+		PaymentID:           payment.ID,
+		Receipt:             payment.KindID,
+		manualPaymentFields: fields(payment),
+		StaffComment:        payment.StaffComment.String,
+		Reason:              reason,
+	}
+	if before != nil {
+		b := fields(*before)
+		metadata.Before = &b
+	}
+	metadataJSON, _ := json.Marshal(metadata)
+
+	h.queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "admin",
+		Level:     "info",
+		UserID:    sql.NullInt64{Int64: admin.ID, Valid: true},
+		Message:   fmt.Sprintf("Admin %s (%s) %s", adminUsername, admin.Email, message),
+		Metadata:  sql.NullString{String: string(metadataJSON), Valid: true},
+	})
+}
@@ -5,19 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
 )
 
 // UnmatchedPaymentInfo contains payment with analysis
 type UnmatchedPaymentInfo struct {
-	Payment     db.Payment
-	UserExists  bool
-	Category    string // "empty_vs", "user_not_found", "sync_bug"
-	Reason      string
-	IsIncoming  bool
-	AmountFloat float64
+	Payment    db.Payment
+	UserExists bool
+	Category   string // "empty_vs", "user_not_found", "sync_bug"
+	Reason     string
+	IsIncoming bool
 }
 
 // AdminUnmatchedPaymentsHandler shows all payments that couldn't be automatically matched to users
@@ -55,7 +54,7 @@ func (h *Handler) AdminUnmatchedPaymentsHandler(w http.ResponseWriter, r *http.R
 
 	// Analyze each payment - ONLY INCOMING PAYMENTS
 	var unmatchedList []UnmatchedPaymentInfo
-	totalAmount := 0.0
+	totalAmount := money.Zero
 	countPayments := 0
 
 	// Count by category
@@ -64,25 +63,18 @@ func (h *Handler) AdminUnmatchedPaymentsHandler(w http.ResponseWriter, r *http.R
 	countSyncBug := 0
 
 	for _, payment := range unassignedPayments {
-		// Parse amount for totals and direction
-		amountFloat := 0.0
-		if amount, err := strconv.ParseFloat(payment.Amount, 64); err == nil {
-			amountFloat = amount
-		}
-
 		// SKIP ALL OUTGOING PAYMENTS (negative or zero amounts)
-		if amountFloat <= 0 {
+		if !payment.Amount.IsPositive() {
 			continue
 		}
 
 		// Only process incoming payments from here
-		totalAmount += amountFloat
+		totalAmount += payment.Amount
 		countPayments++
 
 		info := UnmatchedPaymentInfo{
-			Payment:     payment,
-			AmountFloat: amountFloat,
-			IsIncoming:  true, // Always true now
+			Payment:    payment,
+			IsIncoming: true, // Always true now
 		}
 
 		// Skip if no identification (VS)
@@ -234,9 +226,9 @@ func (h *Handler) AdminAssignPaymentHandler(w http.ResponseWriter, r *http.Reque
 		Subsystem: "admin",
 		Level:     "info",
 		UserID:    sql.NullInt64{Int64: adminDBUser.ID, Valid: true},
-		Message: fmt.Sprintf("Admin %s (%s) manually assigned payment #%d (%.2f Kč) to user %s (%s), VS set to '%s'",
+		Message: fmt.Sprintf("Admin %s (%s) manually assigned payment #%d (%s) to user %s (%s), VS set to '%s'",
 			adminUsername, adminDBUser.Email,
-			payment.ID, parseFloat(payment.Amount),
+			payment.ID, payment.Amount.Format(),
 			targetUsername, targetUser.Email,
 			targetUser.PaymentsID.String),
 		Metadata: sql.NullString{
@@ -253,23 +245,16 @@ func (h *Handler) AdminAssignPaymentHandler(w http.ResponseWriter, r *http.Reque
 	})
 }
 
-// Helper function to parse float from string
-func parseFloat(s string) float64 {
-	var f float64
-	fmt.Sscanf(s, "%f", &f)
-	return f
-}
-
 // UpdatePaymentRequest is the request body for updating a payment
 type UpdatePaymentRequest struct {
-	PaymentID    int64   `json:"payment_id"`
-	VS           string  `json:"vs"`
-	Message      string  `json:"message"`
-	Comment      string  `json:"comment"`
-	StaffComment string  `json:"staff_comment"`
-	AssignType   string  `json:"assign_type"` // "user", "project", "unmatched"
-	UserID       *int64  `json:"user_id"`
-	ProjectID    *int64  `json:"project_id"`
+	PaymentID    int64  `json:"payment_id"`
+	VS           string `json:"vs"`
+	Message      string `json:"message"`
+	Comment      string `json:"comment"`
+	StaffComment string `json:"staff_comment"`
+	AssignType   string `json:"assign_type"` // "user", "project", "unmatched"
+	UserID       *int64 `json:"user_id"`
+	ProjectID    *int64 `json:"project_id"`
 }
 
 // AdminUpdatePaymentHandler updates payment data and optionally assigns it
@@ -383,27 +368,27 @@ func (h *Handler) AdminUpdatePaymentHandler(w http.ResponseWriter, r *http.Reque
 		if targetUser.Username.Valid {
 			targetUsername = targetUser.Username.String
 		}
-		logMessage = fmt.Sprintf("Admin %s (%s) updated payment #%d (%.2f Kč) and assigned to user %s (%s), VS set to '%s'",
+		logMessage = fmt.Sprintf("Admin %s (%s) updated payment #%d (%s) and assigned to user %s (%s), VS set to '%s'",
 			adminUsername, adminDBUser.Email,
-			payment.ID, parseFloat(payment.Amount),
+			payment.ID, payment.Amount.Format(),
 			targetUsername, targetUser.Email,
 			identification)
 		metadata = fmt.Sprintf(`{"admin_user_id":%d,"action":"assign_user","payment_id":%d,"target_user_id":%d,"amount":"%s","vs":"%s","staff_comment":"%s"}`,
 			adminDBUser.ID, payment.ID, targetUser.ID, payment.Amount, identification, req.StaffComment)
 
 	case "project":
-		logMessage = fmt.Sprintf("Admin %s (%s) updated payment #%d (%.2f Kč) and assigned to project '%s', VS set to '%s'",
+		logMessage = fmt.Sprintf("Admin %s (%s) updated payment #%d (%s) and assigned to project '%s', VS set to '%s'",
 			adminUsername, adminDBUser.Email,
-			payment.ID, parseFloat(payment.Amount),
+			payment.ID, payment.Amount.Format(),
 			targetProject.Name,
 			identification)
 		metadata = fmt.Sprintf(`{"admin_user_id":%d,"action":"assign_project","payment_id":%d,"target_project_id":%d,"project_name":"%s","amount":"%s","vs":"%s","staff_comment":"%s"}`,
 			adminDBUser.ID, payment.ID, targetProject.ID, targetProject.Name, payment.Amount, identification, req.StaffComment)
 
 	default: // "unmatched" or no assignment
-		logMessage = fmt.Sprintf("Admin %s (%s) updated payment #%d (%.2f Kč) data without assignment, VS set to '%s'",
+		logMessage = fmt.Sprintf("Admin %s (%s) updated payment #%d (%s) data without assignment, VS set to '%s'",
 			adminUsername, adminDBUser.Email,
-			payment.ID, parseFloat(payment.Amount),
+			payment.ID, payment.Amount.Format(),
 			identification)
 		metadata = fmt.Sprintf(`{"admin_user_id":%d,"action":"update_unmatched","payment_id":%d,"amount":"%s","vs":"%s","message":"%s","staff_comment":"%s"}`,
 			adminDBUser.ID, payment.ID, payment.Amount, identification, req.Message, req.StaffComment)
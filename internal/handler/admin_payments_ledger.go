@@ -0,0 +1,402 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/payments"
+)
+
+// ledgerPageSize is the number of payments per page of the ledger
+const ledgerPageSize = 50
+
+// LedgerFilter holds the ledger filters as entered in the form (query string)
+type LedgerFilter struct {
+	DateFrom      string // YYYY-MM-DD
+	DateTo        string // YYYY-MM-DD
+	Kind          string
+	AmountMin     string
+	AmountMax     string
+	VS            string
+	RemoteAccount string
+	Assigned      string // "", "yes" or "no"
+	UserID        int64
+	ProjectID     int64
+	Search        string
+}
+
+// parseLedgerFilter reads the filters from the query string
+func parseLedgerFilter(q url.Values) LedgerFilter {
+	f := LedgerFilter{
+		DateFrom:      strings.TrimSpace(q.Get("from")),
+		DateTo:        strings.TrimSpace(q.Get("to")),
+		Kind:          strings.TrimSpace(q.Get("kind")),
+		AmountMin:     strings.TrimSpace(q.Get("amount_min")),
+		AmountMax:     strings.TrimSpace(q.Get("amount_max")),
+		VS:            strings.TrimSpace(q.Get("vs")),
+		RemoteAccount: strings.TrimSpace(q.Get("account")),
+		Assigned:      q.Get("assigned"),
+		Search:        strings.TrimSpace(q.Get("q")),
+	}
+	f.UserID, _ = strconv.ParseInt(q.Get("user_id"), 10, 64)
+	f.ProjectID, _ = strconv.ParseInt(q.Get("project_id"), 10, 64)
+	return f
+}
+
+// Values returns the filters as a query string (inverse of parseLedgerFilter)
+func (f LedgerFilter) Values() url.Values {
+	v := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("from", f.DateFrom)
+	set("to", f.DateTo)
+	set("kind", f.Kind)
+	set("amount_min", f.AmountMin)
+	set("amount_max", f.AmountMax)
+	set("vs", f.VS)
+	set("account", f.RemoteAccount)
+	set("assigned", f.Assigned)
+	if f.UserID != 0 {
+		v.Set("user_id", strconv.FormatInt(f.UserID, 10))
+	}
+	if f.ProjectID != 0 {
+		v.Set("project_id", strconv.FormatInt(f.ProjectID, 10))
+	}
+	set("q", f.Search)
+	return v
+}
+
+// params converts the filters to query parameters (without paging)
+func (f LedgerFilter) params() (db.ListPaymentsFilteredParams, error) {
+	var p db.ListPaymentsFilteredParams
+
+	for _, d := range []struct {
+		value string
+		dest  *sql.NullString
+	}{{f.DateFrom, &p.DateFrom}, {f.DateTo, &p.DateTo}} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d.value); err != nil {
+			return p, fmt.Errorf("neplatné datum '%s'", d.value)
+		}
+		*d.dest = sql.NullString{String: d.value, Valid: true}
+	}
+
+	for _, a := range []struct {
+		value string
+		dest  *sql.NullInt64
+	}{{f.AmountMin, &p.AmountMin}, {f.AmountMax, &p.AmountMax}} {
+		if a.value == "" {
+			continue
+		}
+		amount, err := money.Parse(a.value)
+		if err != nil {
+			return p, fmt.Errorf("neplatná částka '%s'", a.value)
+		}
+		*a.dest = sql.NullInt64{Int64: amount.Halere(), Valid: true}
+	}
+
+	p.Kind = sql.NullString{String: f.Kind, Valid: f.Kind != ""}
+	p.Vs = sql.NullString{String: f.VS, Valid: f.VS != ""}
+	p.RemoteAccount = sql.NullString{String: f.RemoteAccount, Valid: f.RemoteAccount != ""}
+	p.Search = sql.NullString{String: f.Search, Valid: f.Search != ""}
+	p.UserID = sql.NullInt64{Int64: f.UserID, Valid: f.UserID != 0}
+	p.ProjectID = sql.NullInt64{Int64: f.ProjectID, Valid: f.ProjectID != 0}
+
+	switch f.Assigned {
+	case "yes":
+		p.Assigned = sql.NullBool{Bool: true, Valid: true}
+	case "no":
+		p.Assigned = sql.NullBool{Bool: false, Valid: true}
+	}
+
+	return p, nil
+}
+
+// LedgerRow is a payment in the ledger table and exports
+type LedgerRow struct {
+	ID            int64  `json:"id"`
+	Date          string `json:"date"`
+	Amount        string `json:"amount"`
+	Kind          string `json:"kind"`
+	KindID        string `json:"kind_id"`
+	VS            string `json:"vs"`
+	LocalAccount  string `json:"local_account"`
+	RemoteAccount string `json:"remote_account"`
+	UserID        int64  `json:"user_id,omitempty"`
+	UserName      string `json:"user_name,omitempty"`
+	ProjectID     int64  `json:"project_id,omitempty"`
+	ProjectName   string `json:"project_name,omitempty"`
+	Message       string `json:"message"`
+	StaffComment  string `json:"staff_comment"`
+	Voided        bool   `json:"voided"`
+
+	AmountFormatted string `json:"-"`
+	IsIncoming      bool   `json:"-"`
+}
+
+// loadLedger returns the payments matching the filter. limit -1 means all.
+func (h *Handler) loadLedger(r *http.Request, f LedgerFilter, limit, offset int64) ([]LedgerRow, error) {
+	ctx := r.Context()
+
+	params, err := f.params()
+	if err != nil {
+		return nil, err
+	}
+	params.Limit = limit
+	params.Offset = offset
+
+	list, err := h.queries.ListPaymentsFiltered(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payments: %w", err)
+	}
+
+	userNames := make(map[int64]string)
+	projectNames := make(map[int64]string)
+
+	rows := make([]LedgerRow, 0, len(list))
+	for _, p := range list {
+		row := LedgerRow{
+			ID:              p.ID,
+			Date:            p.Date.Format("2006-01-02"),
+			Amount:          p.Amount.String(),
+			Kind:            p.Kind,
+			KindID:          p.KindID,
+			VS:              p.Identification,
+			LocalAccount:    p.LocalAccount,
+			RemoteAccount:   p.RemoteAccount,
+			Message:         payments.RawMessage(p.RawData),
+			StaffComment:    p.StaffComment.String,
+			Voided:          p.VoidedAt.Valid,
+			AmountFormatted: p.Amount.Format(),
+			IsIncoming:      p.Amount.IsPositive(),
+		}
+
+		if p.UserID.Valid {
+			row.UserID = p.UserID.Int64
+			name, ok := userNames[row.UserID]
+			if !ok {
+				if u, err := h.queries.GetUserByID(ctx, row.UserID); err == nil {
+					name = u.Email
+					if u.Realname.Valid && u.Realname.String != "" {
+						name = u.Realname.String
+					}
+				}
+				userNames[row.UserID] = name
+			}
+			row.UserName = name
+		}
+
+		if p.ProjectID.Valid {
+			row.ProjectID = p.ProjectID.Int64
+			name, ok := projectNames[row.ProjectID]
+			if !ok {
+				if pr, err := h.queries.GetProject(ctx, row.ProjectID); err == nil {
+					name = pr.Name
+				}
+				projectNames[row.ProjectID] = name
+			}
+			row.ProjectName = name
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// AdminPaymentsHandler shows all payments with filters and paging
+// GET /admin/payments
+func (h *Handler) AdminPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+
+	dbUser, err := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	users, err := h.queries.ListUsers(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
+	}
+
+	projects, err := h.queries.ListProjects(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch projects", http.StatusInternalServerError)
+		return
+	}
+
+	filter := parseLedgerFilter(r.URL.Query())
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	data := map[string]interface{}{
+		"Title":    "Platby",
+		"User":     user,
+		"DBUser":   dbUser,
+		"Filter":   filter,
+		"Users":    users,
+		"Projects": projects,
+		"Kinds":    []string{payments.KindFIO, payments.KindManual},
+		"Page":     page,
+	}
+
+	params, err := filter.params()
+	if err != nil {
+		data["Error"] = err.Error()
+		h.render(w, "admin_payments.html", data)
+		return
+	}
+
+	summary, err := h.queries.SummarizePaymentsFiltered(ctx, db.SummarizePaymentsFilteredParams{
+		DateFrom:      params.DateFrom,
+		DateTo:        params.DateTo,
+		Kind:          params.Kind,
+		AmountMin:     params.AmountMin,
+		AmountMax:     params.AmountMax,
+		Vs:            params.Vs,
+		RemoteAccount: params.RemoteAccount,
+		Assigned:      params.Assigned,
+		UserID:        params.UserID,
+		ProjectID:     params.ProjectID,
+		Search:        params.Search,
+	})
+	if err != nil {
+		http.Error(w, "Failed to summarize payments", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.loadLedger(r, filter, ledgerPageSize, int64(page-1)*ledgerPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pages := int((summary.Count + ledgerPageSize - 1) / ledgerPageSize)
+	pageURL := func(p int) string {
+		v := filter.Values()
+		if p > 1 {
+			v.Set("page", strconv.Itoa(p))
+		}
+		return "/admin/payments?" + v.Encode()
+	}
+	exportURL := func(format string) string {
+		v := filter.Values()
+		v.Set("format", format)
+		return "/admin/payments/export?" + v.Encode()
+	}
+
+	data["Rows"] = rows
+	data["Count"] = summary.Count
+	data["Total"] = money.FromHalere(summary.Total)
+	data["Pages"] = pages
+	if page > 1 {
+		data["PrevURL"] = pageURL(page - 1)
+	}
+	if page < pages {
+		data["NextURL"] = pageURL(page + 1)
+	}
+	data["ExportCSVURL"] = exportURL("csv")
+	data["ExportJSONURL"] = exportURL("json")
+
+	h.render(w, "admin_payments.html", data)
+}
+
+// AdminExportPaymentsHandler exports all payments matching the ledger filters
+// GET /admin/payments/export?format=csv|json (+ filters of /admin/payments)
+func (h *Handler) AdminExportPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "csv" && format != "json" {
+		http.Error(w, "Unsupported format, use csv or json", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.loadLedger(r, parseLedgerFilter(r.URL.Query()), -1, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := fmt.Sprintf("platby-%s.%s", time.Now().Format("2006-01-02"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rows)
+		return
+	}
+
+	// Semicolon separated with a BOM, so Excel with Czech locale opens it directly
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Write([]byte("\uFEFF"))
+
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	cw.Write([]string{"id", "date", "amount", "kind", "kind_id", "vs", "local_account", "remote_account",
+		"user_id", "user_name", "project_id", "project_name", "message", "staff_comment", "voided"})
+	for _, row := range rows {
+		cw.Write([]string{
+			strconv.FormatInt(row.ID, 10),
+			row.Date,
+			row.Amount,
+			row.Kind,
+			row.KindID,
+			row.VS,
+			row.LocalAccount,
+			row.RemoteAccount,
+			optionalID(row.UserID),
+			row.UserName,
+			optionalID(row.ProjectID),
+			row.ProjectName,
+			row.Message,
+			row.StaffComment,
+			strconv.FormatBool(row.Voided),
+		})
+	}
+	cw.Flush()
+}
+
+// optionalID formats an ID for the CSV export, 0 (none) as empty
+func optionalID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
 )
 
 // AdminProjectsHandler shows the projects management page
@@ -42,11 +43,12 @@ func (h *Handler) AdminProjectsHandler(w http.ResponseWriter, r *http.Request) {
 
 // ProjectResponse is the JSON response for a project
 type ProjectResponse struct {
-	ID          int64   `json:"id"`
-	Name        string  `json:"name"`
-	PaymentsID  string  `json:"payments_id"`
-	Description string  `json:"description"`
-	TotalAmount float64 `json:"total_amount"`
+	ID             int64        `json:"id"`
+	Name           string       `json:"name"`
+	PaymentsID     string       `json:"payments_id"`
+	Description    string       `json:"description"`
+	TotalAmount    money.Amount `json:"total_amount"`
+	TotalFormatted string       `json:"total_formatted"`
 }
 
 // AdminProjectsAPIHandler returns list of projects (JSON)
@@ -76,21 +78,18 @@ func (h *Handler) AdminProjectsAPIHandler(w http.ResponseWriter, r *http.Request
 	projectResponses := make([]ProjectResponse, len(projects))
 	for i, p := range projects {
 		// Get total amount for this project (by matching VS/identification)
-		balanceInterface, err := h.queries.GetProjectBalance(ctx, p.ID)
-		totalAmount := 0.0
-		if err == nil {
-			// The query returns interface{}, need to convert to float64
-			if f, ok := balanceInterface.(float64); ok {
-				totalAmount = f
-			}
+		totalAmount := money.Zero
+		if total, err := h.queries.GetProjectBalance(ctx, p.ID); err == nil {
+			totalAmount = money.FromHalere(total)
 		}
 
 		projectResponses[i] = ProjectResponse{
-			ID:          p.ID,
-			Name:        p.Name,
-			PaymentsID:  p.PaymentsID.String,
-			Description: p.Description.String,
-			TotalAmount: totalAmount,
+			ID:             p.ID,
+			Name:           p.Name,
+			PaymentsID:     p.PaymentsID.String,
+			Description:    p.Description.String,
+			TotalAmount:    totalAmount,
+			TotalFormatted: totalAmount.Format(),
 		}
 	}
 
@@ -196,13 +195,14 @@ func (h *Handler) AdminDeleteProjectHandler(w http.ResponseWriter, r *http.Reque
 
 // PaymentResponse is the JSON response for a payment
 type PaymentResponse struct {
-	ID            int64  `json:"id"`
-	Date          string `json:"date"`
-	Amount        string `json:"amount"`
-	RemoteAccount string `json:"remote_account"`
-	Identification string `json:"identification"`
-	Message       string `json:"message"`
-	Comment       string `json:"comment"`
+	ID              int64        `json:"id"`
+	Date            string       `json:"date"`
+	Amount          money.Amount `json:"amount"`
+	AmountFormatted string       `json:"amount_formatted"`
+	RemoteAccount   string       `json:"remote_account"`
+	Identification  string       `json:"identification"`
+	Message         string       `json:"message"`
+	Comment         string       `json:"comment"`
 }
 
 // AdminProjectPaymentsHandler returns payments for a project
@@ -245,13 +245,14 @@ func (h *Handler) AdminProjectPaymentsHandler(w http.ResponseWriter, r *http.Req
 	paymentResponses := make([]PaymentResponse, len(payments))
 	for i, p := range payments {
 		paymentResponses[i] = PaymentResponse{
-			ID:             p.ID,
-			Date:           p.Date.Format("02.01.2006"),
-			Amount:         p.Amount,
-			RemoteAccount:  p.RemoteAccount,
-			Identification: p.Identification,
-			Message:        "",  // Not in Payment model
-			Comment:        p.StaffComment.String,
+			ID:              p.ID,
+			Date:            p.Date.Format("02.01.2006"),
+			Amount:          p.Amount,
+			AmountFormatted: p.Amount.Format(),
+			RemoteAccount:   p.RemoteAccount,
+			Identification:  p.Identification,
+			Message:         "", // Not in Payment model
+			Comment:         p.StaffComment.String,
 		}
 	}
 
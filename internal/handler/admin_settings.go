@@ -3,8 +3,10 @@ package handler
 import (
 	"database/sql"
 	"net/http"
+	"strconv"
 
 	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/email"
 )
 
 // AdminSettingsHandler shows admin settings page
@@ -28,20 +30,21 @@ func (h *Handler) AdminSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		Valid:  true,
 	})
 
-	// Get SMTP configuration status
-	smtpConfigured := h.config.SMTPHost != "" && h.config.SMTPPort != 0
-
 	data := map[string]interface{}{
 		"Title":          "Nastavení",
 		"User":           user,
 		"DBUser":         dbUser,
-		"SMTPConfigured": smtpConfigured,
+		"EmailsEnabled":  h.emailClient.Enabled(),
+		"EmailTransport": h.emailClient.TransportName(),
+		"EmailMaildir":   h.config.EmailMaildir,
 	}
 
 	h.render(w, "admin_settings.html", data)
 }
 
-// AdminTestEmailHandler sends test email
+// AdminTestEmailHandler queues a test email of a template (type, the file
+// name without .html) rendered with the data of a member (user_id, optional)
+// to the given address
 func (h *Handler) AdminTestEmailHandler(w http.ResponseWriter, r *http.Request) {
 	user := h.auth.GetUser(r)
 	if user == nil {
@@ -67,7 +70,7 @@ func (h *Handler) AdminTestEmailHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	emailType := r.FormValue("type")
+	emailType := r.FormValue("type") // Template name without .html
 	recipient := r.FormValue("email")
 
 	if recipient == "" {
@@ -75,9 +78,28 @@ func (h *Handler) AdminTestEmailHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get user by email for template data (use admin user if recipient not found)
-	testUser, err := h.queries.GetUserByEmail(ctx, recipient)
-	if err != nil {
+	tmpl, ok := email.LookupTemplate(emailType + ".html")
+	if !ok {
+		http.Error(w, "Invalid email type", http.StatusBadRequest)
+		return
+	}
+
+	// Template data of the chosen member, of the recipient, or of the admin
+	// when the recipient is not a member
+	var testUser db.User
+	var err error
+	if userID := r.FormValue("user_id"); userID != "" {
+		id, parseErr := strconv.ParseInt(userID, 10, 64)
+		if parseErr != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if testUser, err = h.queries.GetUserByID(ctx, id); err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		testUser.Email = recipient // Member's data, but to the given address
+	} else if testUser, err = h.queries.GetUserByEmail(ctx, recipient); err != nil {
 		// Use admin user as fallback
 		dbUser, err := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
 			String: user.ID,
@@ -88,25 +110,15 @@ func (h *Handler) AdminTestEmailHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		testUser = dbUser
+		testUser.Email = recipient // Admin's data, but to the given address
 	}
 
-	// Send appropriate test email
-	emailClient := h.emailClient
-	var sendErr error
-
-	switch emailType {
-	case "welcome":
-		sendErr = emailClient.SendWelcome(ctx, &testUser)
-	case "negative_balance":
-		sendErr = emailClient.SendNegativeBalance(ctx, &testUser, -500.0)
-	case "debt_warning":
-		sendErr = emailClient.SendDebtWarning(ctx, &testUser, -2400.0, 1000.0)
-	case "membership_suspended":
-		sendErr = emailClient.SendMembershipSuspended(ctx, &testUser, "Dluh na členském příspěvku přesahuje povolený limit.")
-	default:
-		http.Error(w, "Invalid email type", http.StatusBadRequest)
-		return
-	}
+	sendErr := h.emailClient.SendTemplated(ctx, email.SendParams{
+		UserID:       sql.NullInt64{Int64: testUser.ID, Valid: true},
+		Recipient:    recipient,
+		TemplateName: tmpl.Name,
+		Data:         h.emailPreviewData(ctx, testUser),
+	})
 
 	if sendErr != nil {
 		// Log error
@@ -125,10 +137,10 @@ func (h *Handler) AdminTestEmailHandler(w http.ResponseWriter, r *http.Request)
 		Subsystem: "email",
 		Level:     "success",
 		UserID:    sql.NullInt64{Int64: testUser.ID, Valid: true},
-		Message:   "Test email sent: " + emailType + " to " + recipient,
+		Message:   "Test email queued: " + emailType + " to " + recipient,
 	})
 
 	// Return success
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"success": true, "message": "Email odeslán na ` + recipient + `"}`))
+	w.Write([]byte(`{"success": true, "message": "Email pro ` + recipient + ` je ve frontě k odeslání (stav na /admin/emails)"}`))
 }
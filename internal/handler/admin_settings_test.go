@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/base48/member-portal/internal/auth"
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/email"
+)
+
+// newTestHandler creates a handler on a migrated temporary database with the
+// emails sent through an in-memory transport. Keycloak is unreachable, so
+// the authenticator runs in the limited mode with sessions only. The test
+// runs from the repository root to load the templates.
+func newTestHandler(t *testing.T) (*Handler, *email.MemoryTransport) {
+	t.Helper()
+
+	database := dbtest.Open(t)
+	t.Chdir("../..")
+
+	cfg := &config.Config{
+		BaseURL:          "https://portal.example.com",
+		KeycloakURL:      "http://127.0.0.1:1",
+		KeycloakRealm:    "test",
+		SessionSecret:    "test-session-secret",
+		SMTPFrom:         "Base48 <noreply@example.com>",
+		EmailMaxAttempts: 1,
+		VSScheme:         "sequential",
+		VSRangeStart:     1000,
+		VSRangeEnd:       9999,
+	}
+	queries := db.New(database)
+	authenticator, err := auth.New(context.Background(), cfg, queries)
+	if err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	h, err := New(authenticator, database, cfg, "web/templates")
+	if err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+
+	sent := &email.MemoryTransport{}
+	h.emailClient = email.New(cfg, queries, email.WithTransport(sent))
+	return h, sent
+}
+
+// withSession adds a session cookie of the user to the request, as the
+// authenticator stores it after the login
+func withSession(t *testing.T, h *Handler, r *http.Request, user *auth.User) {
+	t.Helper()
+
+	store := sessions.NewCookieStore([]byte(h.config.SessionSecret))
+	session, _ := store.New(r, "base48-session")
+	session.Values["user"] = user
+	rec := httptest.NewRecorder()
+	if err := store.Save(r, rec, session); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+}
+
+func TestAdminTestEmailHandler(t *testing.T) {
+	h, sent := newTestHandler(t)
+	ctx := context.Background()
+
+	admin, err := h.queries.CreateUser(ctx, db.CreateUserParams{
+		KeycloakID: sql.NullString{String: "kc-admin", Valid: true},
+		Email:      "admin@example.com",
+		Realname:   sql.NullString{String: "Admin", Valid: true},
+		LevelID:    1,
+		State:      "accepted",
+	})
+	if err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+
+	post := func(user *auth.User, form url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/admin/settings/test-email", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if user != nil {
+			withSession(t, h, r, user)
+		}
+		rec := httptest.NewRecorder()
+		h.AdminTestEmailHandler(rec, r)
+		return rec
+	}
+	adminUser := &auth.User{ID: admin.KeycloakID.String, Email: admin.Email, Roles: []string{"memberportal_admin"}}
+
+	if rec := post(nil, url.Values{"type": {"welcome"}, "email": {"novak@example.com"}}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: %d", rec.Code)
+	}
+	member := &auth.User{ID: "kc-member", Roles: []string{"active_member"}}
+	if rec := post(member, url.Values{"type": {"welcome"}, "email": {"novak@example.com"}}); rec.Code != http.StatusForbidden {
+		t.Errorf("member: %d", rec.Code)
+	}
+	if rec := post(adminUser, url.Values{"type": {"unknown"}, "email": {"novak@example.com"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown type: %d", rec.Code)
+	}
+
+	// Queued and delivered by the outbox with the admin's data (the recipient
+	// is not a member)
+	rec := post(adminUser, url.Values{"type": {"welcome"}, "email": {"novak@example.com"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"success": true`) {
+		t.Fatalf("test email: %d %s", rec.Code, rec.Body)
+	}
+	if len(sent.Messages()) != 0 {
+		t.Errorf("sent before the outbox delivery")
+	}
+	if result, err := h.emailClient.Deliver(ctx, time.Now()); err != nil || result.Sent != 1 {
+		t.Fatalf("deliver: %+v, %v", result, err)
+	}
+
+	messages := sent.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sent %d emails", len(messages))
+	}
+	m := messages[0]
+	if m.From != "noreply@example.com" || len(m.To) != 1 || m.To[0] != "novak@example.com" {
+		t.Errorf("envelope %s -> %v", m.From, m.To)
+	}
+	if m.Subject() != "Vítej v Base48!" || !strings.Contains(m.Text(), "Ahoj Admin,") {
+		t.Errorf("email %q: %q", m.Subject(), m.Text())
+	}
+}
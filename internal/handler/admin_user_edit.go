@@ -0,0 +1,386 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/go-chi/chi/v5"
+)
+
+// StateOption is a state offered in the member edit form
+type StateOption struct {
+	Value   string
+	Label   string
+	Effects string // What moving to the state does, empty for the current state
+}
+
+// AdminEditUserHandler shows the form for editing a member's membership fields
+// GET /admin/users/{id}/edit
+func (h *Handler) AdminEditUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	levels, err := h.queries.ListAllLevels(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch levels", http.StatusInternalServerError)
+		return
+	}
+
+	// Only the current state and the states reachable from it
+	states := []StateOption{{member.State, membership.StateLabel(member.State), ""}}
+	for _, s := range membership.NextStates(member.State) {
+		var effects []string
+		for _, e := range membership.Effects(member.State, s) {
+			effects = append(effects, membership.EffectLabel(e))
+		}
+		states = append(states, StateOption{s, membership.StateLabel(s), strings.Join(effects, ", ")})
+	}
+
+	history, err := h.queries.ListPaymentsIDHistoryByUser(ctx, member.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch variable symbol history", http.StatusInternalServerError)
+		return
+	}
+	historyViews := make([]PaymentsIDHistoryView, 0, len(history))
+	for _, entry := range history {
+		historyViews = append(historyViews, PaymentsIDHistoryView{
+			PaymentsIDHistory: entry,
+			ChangedByEmail:    h.changedByEmail(ctx, entry.ChangedBy),
+		})
+	}
+
+	stateHistory, err := h.queries.ListStateHistoryByUser(ctx, member.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch state history", http.StatusInternalServerError)
+		return
+	}
+	stateViews := make([]StateHistoryView, 0, len(stateHistory))
+	for _, entry := range stateHistory {
+		stateViews = append(stateViews, StateHistoryView{
+			MembershipStateHistory: entry,
+			FromLabel:              membership.StateLabel(entry.FromState),
+			ToLabel:                membership.StateLabel(entry.ToState),
+			ChangedByEmail:         h.changedByEmail(ctx, entry.ChangedBy),
+		})
+	}
+
+	formatDay := func(t sql.NullTime) string {
+		if !t.Valid {
+			return ""
+		}
+		return t.Time.Format("2006-01-02")
+	}
+
+	data := map[string]interface{}{
+		"Title":        fmt.Sprintf("Úprava člena: %s", member.Email),
+		"User":         user,
+		"DBUser":       adminDBUser,
+		"Member":       member,
+		"Levels":       levels,
+		"States":       states,
+		"Amount":       member.LevelActualAmount.String(),
+		"KeysGranted":  formatDay(member.KeysGranted),
+		"KeysReturned": formatDay(member.KeysReturned),
+		"Version":      membership.Version(member),
+		"VSHistory":    historyViews,
+		"VSScheme":     h.vsAllocator.Scheme(),
+		"StateHistory": stateViews,
+	}
+
+	h.render(w, "admin_user_form.html", data)
+}
+
+// PaymentsIDHistoryView is a previous VS of a member with the admin who changed it
+type PaymentsIDHistoryView struct {
+	db.PaymentsIDHistory
+	ChangedByEmail string
+}
+
+// StateHistoryView is a state change of a member with the admin who made it
+type StateHistoryView struct {
+	db.MembershipStateHistory
+	FromLabel      string
+	ToLabel        string
+	ChangedByEmail string // Empty for automatic changes
+}
+
+// changedByEmail returns the email of the admin who made a recorded change
+func (h *Handler) changedByEmail(ctx context.Context, changedBy sql.NullInt64) string {
+	if !changedBy.Valid {
+		return ""
+	}
+	admin, err := h.queries.GetUserByID(ctx, changedBy.Int64)
+	if err != nil {
+		return ""
+	}
+	return admin.Email
+}
+
+// UpdateUserRequest is the JSON body of PUT /api/admin/users/{id}
+type UpdateUserRequest struct {
+	State             string `json:"state"`
+	LevelID           int64  `json:"level_id"`
+	LevelActualAmount string `json:"level_actual_amount"`
+	PaymentsID        string `json:"payments_id"`
+	KeysGranted       string `json:"keys_granted"`  // YYYY-MM-DD, empty for none
+	KeysReturned      string `json:"keys_returned"` // YYYY-MM-DD, empty for none
+	IsCouncil         bool   `json:"is_council"`
+	IsStaff           bool   `json:"is_staff"`
+	Version           string `json:"version"` // updated_at the form was loaded with
+	Reason            string `json:"reason"`  // Why the state changes, for the state history
+}
+
+// edit converts the request to a membership edit
+func (req UpdateUserRequest) edit() (membership.Edit, error) {
+	amount, err := money.Parse(req.LevelActualAmount)
+	if err != nil {
+		return membership.Edit{}, fmt.Errorf("neplatná částka '%s'", req.LevelActualAmount)
+	}
+
+	e := membership.Edit{
+		State:             req.State,
+		LevelID:           req.LevelID,
+		LevelActualAmount: amount,
+		PaymentsID:        strings.TrimSpace(req.PaymentsID),
+		IsCouncil:         req.IsCouncil,
+		IsStaff:           req.IsStaff,
+		Version:           req.Version,
+		Reason:            req.Reason,
+	}
+
+	for _, d := range []struct {
+		value string
+		dest  *sql.NullTime
+	}{{req.KeysGranted, &e.KeysGranted}, {req.KeysReturned, &e.KeysReturned}} {
+		if d.value == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", d.value)
+		if err != nil {
+			return membership.Edit{}, fmt.Errorf("neplatné datum '%s'", d.value)
+		}
+		*d.dest = sql.NullTime{Time: t, Valid: true}
+	}
+
+	return e, nil
+}
+
+// AdminUpdateUserHandler changes a member's membership fields
+// PUT /api/admin/users/{id}
+func (h *Handler) AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	edit, err := req.edit()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	member, err := h.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		h.jsonError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+	edit.ChangedBy = adminDBUser.ID
+
+	// An accepted member needs a VS to pay fees, generate one if none is given
+	if edit.State == membership.StateAccepted {
+		edit.Allocator = h.vsAllocator
+	}
+
+	updated, changes, err := membership.Apply(ctx, h.queries, member, edit)
+	if err == membership.ErrConflict {
+		h.jsonError(w, "Záznam mezitím upravil někdo jiný. Načtěte stránku znovu a změny zopakujte.", http.StatusConflict)
+		return
+	} else if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(changes) > 0 {
+		h.logUserEdit(ctx, adminDBUser, updated, changes)
+	}
+
+	// Keycloak role and emails of the state transition, if any
+	warnings := h.runStateEffects(ctx, member.State, updated, edit.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"message":  fmt.Sprintf("User updated, %d field(s) changed", len(changes)),
+		"changes":  changes,
+		"version":  membership.Version(updated),
+		"warnings": warnings,
+	})
+}
+
+// ReassignPaymentsIDRequest is the JSON body of POST /api/admin/users/{id}/payments-id
+type ReassignPaymentsIDRequest struct {
+	PaymentsID string `json:"payments_id"` // Empty generates one according to VS_SCHEME
+	Reason     string `json:"reason"`
+}
+
+// AdminReassignPaymentsIDHandler gives a member a new variable symbol. The
+// previous one is kept in the history, payments sent with it still count.
+// POST /api/admin/users/{id}/payments-id
+func (h *Handler) AdminReassignPaymentsIDHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil || !user.IsAdmin() {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ReassignPaymentsIDRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		h.jsonError(w, "Uveďte důvod změny variabilního symbolu", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	member, err := h.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		h.jsonError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	updated, err := membership.ReassignPaymentsID(ctx, h.queries, h.vsAllocator, member, req.PaymentsID, adminDBUser.ID, req.Reason)
+	if err == membership.ErrConflict {
+		h.jsonError(w, "Záznam mezitím upravil někdo jiný. Načtěte stránku znovu.", http.StatusConflict)
+		return
+	} else if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.logUserEdit(ctx, adminDBUser, updated, membership.Diff(member, updated))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"message":     fmt.Sprintf("Variable symbol changed from '%s' to '%s'", member.PaymentsID.String, updated.PaymentsID.String),
+		"payments_id": updated.PaymentsID.String,
+		"version":     membership.Version(updated),
+	})
+}
+
+// runStateEffects carries out the effects of the member's move from state from
+// outside the database. The state change is stored already, so failures are
+// logged and returned as warnings for the admin to resolve by hand.
+func (h *Handler) runStateEffects(ctx context.Context, from string, member db.User, reason string) []string {
+	var warnings []string
+	for _, failed := range membership.RunEffects(ctx, h.effects, from, member, reason) {
+		warnings = append(warnings, failed.Warning())
+		h.queries.CreateLog(ctx, db.CreateLogParams{
+			Subsystem: "membership",
+			Level:     "error",
+			UserID:    sql.NullInt64{Int64: member.ID, Valid: true},
+			Message:   fmt.Sprintf("State change %s -> %s of %s: %v", from, member.State, member.Email, failed),
+		})
+	}
+	return warnings
+}
+
+// logUserEdit writes the field-level diff of a member edit to system_logs
+func (h *Handler) logUserEdit(ctx context.Context, admin db.User, member db.User, changes []membership.FieldChange) {
+	adminUsername := "unknown"
+	if admin.Username.Valid {
+		adminUsername = admin.Username.String
+	}
+
+	summary := make([]string, 0, len(changes))
+	for _, c := range changes {
+		summary = append(summary, fmt.Sprintf("%s: '%s' -> '%s'", c.Field, c.Old, c.New))
+	}
+
+	metadata, _ := json.Marshal(struct {
+		AdminUserID  int64                    `json:"admin_user_id"`
+		Action       string                   `json:"action"`
+		TargetUserID int64                    `json:"target_user_id"`
+		TargetEmail  string                   `json:"target_email"`
+		Changes      []membership.FieldChange `json:"changes"`
+	}{admin.ID, "update_user", member.ID, member.Email, changes})
+
+	h.queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "admin",
+		Level:     "info",
+		UserID:    sql.NullInt64{Int64: admin.ID, Valid: true},
+		Message: fmt.Sprintf("Admin %s (%s) updated user %s: %s",
+			adminUsername, admin.Email, member.Email, strings.Join(summary, ", ")),
+		Metadata: sql.NullString{String: string(metadata), Valid: true},
+	})
+}
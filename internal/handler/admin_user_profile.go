@@ -7,9 +7,12 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/base48/member-portal/internal/auth"
 	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -145,11 +148,26 @@ func (h *Handler) buildProfileData(ctx context.Context, targetDBUser *db.User, t
 	}
 
 	// Calculate total paid (sum of all payments)
-	var totalPaid float64
+	totalPaid := money.Zero
 	for _, payment := range payments {
-		var amount float64
-		fmt.Sscanf(payment.Amount, "%f", &amount)
-		totalPaid += amount
+		totalPaid += payment.Amount
+	}
+
+	levelHistory, pendingLevel, err := h.buildLevelHistory(ctx, targetDBUser, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Levels a member can switch to
+	activeLevels, err := h.queries.ListLevels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch levels: %w", err)
+	}
+	var levels []db.Level
+	for _, l := range activeLevels {
+		if l.ID != membership.AwaitingLevelID {
+			levels = append(levels, l)
+		}
 	}
 
 	// Build Keycloak account URL
@@ -161,13 +179,76 @@ func (h *Handler) buildProfileData(ctx context.Context, targetDBUser *db.User, t
 		"Level":              level,
 		"Payments":           payments,
 		"Fees":               fees,
-		"Balance":            float64(balance),
-		"TotalPaid":          int64(totalPaid),
+		"Balance":            money.FromHalere(balance),
+		"TotalPaid":          totalPaid,
 		"KeycloakAccountURL": keycloakAccountURL,
+		"LevelHistory":       levelHistory,
+		"PendingLevel":       pendingLevel,
+		"Levels":             levels,
+		"NextPeriod":         membership.NextPeriod(time.Now()),
 		"IsAdminView":        false, // Default, will be overridden if admin view
 	}, nil
 }
 
+// LevelHistoryView is an entry of a member's level history for the profile pages
+type LevelHistoryView struct {
+	db.MembershipLevelHistory
+	LevelName string
+	Amount    money.Amount // The fee, the level amount when no own fee is set
+	Current   bool         // In effect today
+	Pending   bool         // Takes effect in the future
+}
+
+// buildLevelHistory returns the member's level history, newest first, and the
+// pending level change (nil without one)
+func (h *Handler) buildLevelHistory(ctx context.Context, member *db.User, now time.Time) ([]LevelHistoryView, *LevelHistoryView, error) {
+	history, err := h.queries.ListLevelHistoryByUser(ctx, member.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch level history: %w", err)
+	}
+	levels, err := h.queries.ListAllLevels(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch levels: %w", err)
+	}
+	levelByID := make(map[int64]db.Level, len(levels))
+	for _, l := range levels {
+		levelByID[l.ID] = l
+	}
+
+	pendingIDs := make(map[int64]bool)
+	for _, p := range membership.PendingLevelChanges(history, now) {
+		pendingIDs[p.ID] = true
+	}
+
+	views := make([]LevelHistoryView, 0, len(history))
+	var pending *LevelHistoryView
+	currentFound := false
+	for _, entry := range history {
+		level := levelByID[entry.LevelID]
+		view := LevelHistoryView{
+			MembershipLevelHistory: entry,
+			LevelName:              level.Name,
+			Amount:                 entry.LevelActualAmount,
+			Pending:                pendingIDs[entry.ID],
+		}
+		if view.Amount.IsZero() {
+			view.Amount = level.Amount
+		}
+		if !view.Pending && !currentFound {
+			view.Current = true
+			currentFound = true
+		}
+		if view.Pending && pending == nil {
+			// Newest first, so the pending change that applies last
+			p := view
+			pending = &p
+		}
+		views = append(views, view)
+	}
+
+	return views, pending, nil
+}
+
 // fetchKeycloakUserByID fetches a user from Keycloak by their ID
 func (h *Handler) fetchKeycloakUserByID(ctx context.Context, accessToken, keycloakID string) (*auth.User, error) {
 	url := fmt.Sprintf("%s/admin/realms/%s/users/%s", h.config.KeycloakURL, h.config.KeycloakRealm, keycloakID)
@@ -12,6 +12,7 @@ import (
 
 	"github.com/base48/member-portal/internal/db"
 	"github.com/base48/member-portal/internal/keycloak"
+	"github.com/base48/member-portal/internal/money"
 )
 
 // KeycloakUserInfo contains info from Keycloak API
@@ -28,7 +29,7 @@ type AdminUserListItem struct {
 	KeycloakEnabled  *bool  // nil if not found in Keycloak
 	KeycloakUsername string
 	Roles            []string
-	Balance          int64
+	Balance          money.Amount
 }
 
 // AdminUsersHandler shows admin overview of all users with Keycloak status and roles
@@ -91,7 +92,7 @@ func (h *Handler) AdminUsersHandler(w http.ResponseWriter, r *http.Request) {
 			UserID:   sql.NullInt64{Int64: dbUser.ID, Valid: true},
 			UserID_2: dbUser.ID,
 		}); err == nil {
-			item.Balance = balance
+			item.Balance = money.FromHalere(balance)
 		}
 
 		// Match with Keycloak user
@@ -175,11 +176,11 @@ func matchesFilters(item AdminUserListItem, state, keycloak, balance, search str
 	if balance != "" {
 		switch balance {
 		case "positive":
-			if item.Balance < 0 {
+			if item.Balance.IsNegative() {
 				return false
 			}
 		case "negative":
-			if item.Balance >= 0 {
+			if !item.Balance.IsNegative() {
 				return false
 			}
 		}
@@ -260,15 +261,15 @@ func (h *Handler) AdminUsersAPIHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Build response
 	type UserResponse struct {
-		ID               int64    `json:"id"`
-		Email            string   `json:"email"`
-		Realname         string   `json:"realname"`
-		State            string   `json:"state"`
-		Balance          int64    `json:"balance"`
-		KeycloakID       string   `json:"keycloak_id"`
-		KeycloakEnabled  *bool    `json:"keycloak_enabled"`
-		KeycloakUsername string   `json:"keycloak_username"`
-		Roles            []string `json:"roles"`
+		ID               int64        `json:"id"`
+		Email            string       `json:"email"`
+		Realname         string       `json:"realname"`
+		State            string       `json:"state"`
+		Balance          money.Amount `json:"balance"`
+		KeycloakID       string       `json:"keycloak_id"`
+		KeycloakEnabled  *bool        `json:"keycloak_enabled"`
+		KeycloakUsername string       `json:"keycloak_username"`
+		Roles            []string     `json:"roles"`
 	}
 
 	response := make([]UserResponse, 0, len(dbUsers))
@@ -286,7 +287,7 @@ func (h *Handler) AdminUsersAPIHandler(w http.ResponseWriter, r *http.Request) {
 			UserID:   sql.NullInt64{Int64: dbUser.ID, Valid: true},
 			UserID_2: dbUser.ID,
 		}); err == nil {
-			userResp.Balance = balance
+			userResp.Balance = money.FromHalere(balance)
 		}
 
 		// Keycloak info
@@ -0,0 +1,340 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/go-chi/chi/v5"
+)
+
+// ApplicationView is an application with the applicant and level resolved
+// for display
+type ApplicationView struct {
+	db.Application
+	Member      db.User
+	LevelName   string
+	StatusLabel string
+	DecidedBy   string // Email of the council member / admin who decided
+}
+
+// ApplicationHandler shows and submits the membership application of the
+// logged-in user
+// GET/POST /application
+func (h *Handler) ApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	dbUser, err := h.getOrCreateUser(r, user)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+
+	form := membership.ApplicationForm{
+		Realname:   dbUser.Realname.String,
+		Phone:      dbUser.Phone.String,
+		AltContact: dbUser.AltContact.String,
+	}
+	amountStr := ""
+	var formErr string
+
+	if r.Method == http.MethodPost {
+		form = membership.ApplicationForm{
+			Realname:   r.FormValue("realname"),
+			Phone:      r.FormValue("phone"),
+			AltContact: r.FormValue("alt_contact"),
+			Motivation: r.FormValue("motivation"),
+		}
+		form.LevelID, _ = strconv.ParseInt(r.FormValue("level_id"), 10, 64)
+		amountStr = r.FormValue("level_actual_amount")
+
+		amount, err := money.Parse(amountStr)
+		if amountStr != "" && (err != nil || amount != amount.RoundKoruny()) {
+			formErr = "Neplatná částka"
+		} else {
+			form.LevelActualAmount = amount
+			app, err := membership.Submit(ctx, h.queries, *dbUser, form)
+			if err == nil {
+				metadata, _ := json.Marshal(struct {
+					Action            string       `json:"action"`
+					ApplicationID     int64        `json:"application_id"`
+					LevelID           int64        `json:"level_id"`
+					LevelActualAmount money.Amount `json:"level_actual_amount"`
+				}{"submit_application", app.ID, app.LevelID, app.LevelActualAmount})
+				h.queries.CreateLog(ctx, db.CreateLogParams{
+					Subsystem: "membership",
+					Level:     "info",
+					UserID:    sql.NullInt64{Int64: dbUser.ID, Valid: true},
+					Message:   fmt.Sprintf("Membership application #%d submitted by %s", app.ID, dbUser.Email),
+					Metadata:  sql.NullString{String: string(metadata), Valid: true},
+				})
+				http.Redirect(w, r, "/application?submitted=1", http.StatusSeeOther)
+				return
+			}
+			if err == membership.ErrApplicationPending {
+				formErr = "Přihláška už čeká na rozhodnutí rady."
+			} else {
+				formErr = err.Error()
+			}
+		}
+	}
+
+	levels, err := h.queries.ListLevels(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch levels", http.StatusInternalServerError)
+		return
+	}
+	var offered []db.Level
+	for _, l := range levels {
+		if l.ID != membership.AwaitingLevelID {
+			offered = append(offered, l)
+		}
+	}
+
+	var latest *ApplicationView
+	if app, err := h.queries.GetLatestApplicationByUser(ctx, dbUser.ID); err == nil {
+		view := h.applicationView(ctx, app, nil)
+		latest = &view
+	} else if err != sql.ErrNoRows {
+		http.Error(w, "Failed to fetch application", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":     "Přihláška za člena",
+		"User":      user,
+		"DBUser":    dbUser,
+		"Levels":    offered,
+		"Form":      form,
+		"Amount":    amountStr,
+		"Latest":    latest,
+		"CanApply":  dbUser.State == membership.StateAwaiting && (latest == nil || latest.Status != membership.ApplicationPending),
+		"Error":     formErr,
+		"Submitted": r.URL.Query().Get("submitted") == "1",
+	}
+
+	h.render(w, "application.html", data)
+}
+
+// AdminApplicationsHandler shows the queue of pending applications and the
+// recently decided ones
+// GET /admin/applications
+func (h *Handler) AdminApplicationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	ctx := r.Context()
+
+	dbUser, err := h.getOrCreateUser(r, user)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !user.IsAdmin() && !dbUser.IsCouncil {
+		http.Error(w, "Forbidden - council or admin access required", http.StatusForbidden)
+		return
+	}
+
+	levels, err := h.queries.ListAllLevels(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch levels", http.StatusInternalServerError)
+		return
+	}
+	levelNames := make(map[int64]string, len(levels))
+	for _, l := range levels {
+		levelNames[l.ID] = fmt.Sprintf("%s (%s)", l.Name, l.Amount.Format())
+	}
+
+	pending, err := h.queries.ListApplicationsByStatus(ctx, membership.ApplicationPending)
+	if err != nil {
+		http.Error(w, "Failed to fetch applications", http.StatusInternalServerError)
+		return
+	}
+	decided, err := h.queries.ListRecentDecidedApplications(ctx, 20)
+	if err != nil {
+		http.Error(w, "Failed to fetch applications", http.StatusInternalServerError)
+		return
+	}
+
+	toViews := func(apps []db.Application) []ApplicationView {
+		views := make([]ApplicationView, 0, len(apps))
+		for _, app := range apps {
+			views = append(views, h.applicationView(ctx, app, levelNames))
+		}
+		return views
+	}
+
+	data := map[string]interface{}{
+		"Title":   "Přihlášky za člena",
+		"User":    user,
+		"DBUser":  dbUser,
+		"Pending": toViews(pending),
+		"Decided": toViews(decided),
+	}
+
+	h.render(w, "admin_applications.html", data)
+}
+
+// applicationView resolves the applicant, level and decider of an application.
+// levelNames may be nil, the level is then loaded.
+func (h *Handler) applicationView(ctx context.Context, app db.Application, levelNames map[int64]string) ApplicationView {
+	view := ApplicationView{
+		Application: app,
+		StatusLabel: membership.ApplicationLabel(app.Status),
+	}
+
+	view.Member, _ = h.queries.GetUserByID(ctx, app.UserID)
+
+	if name, ok := levelNames[app.LevelID]; ok {
+		view.LevelName = name
+	} else if level, err := h.queries.GetLevel(ctx, app.LevelID); err == nil {
+		view.LevelName = fmt.Sprintf("%s (%s)", level.Name, level.Amount.Format())
+	}
+
+	if app.DecidedBy.Valid {
+		if decider, err := h.queries.GetUserByID(ctx, app.DecidedBy.Int64); err == nil {
+			view.DecidedBy = decider.Email
+		}
+	}
+
+	return view
+}
+
+// DecideApplicationRequest is the JSON body of the approve/reject endpoints
+type DecideApplicationRequest struct {
+	Comment string `json:"comment"`
+}
+
+// AdminApproveApplicationHandler approves an application: the member is
+// accepted, gets a VS, the active_member role in Keycloak and a welcome email
+// POST /api/admin/applications/{id}/approve
+func (h *Handler) AdminApproveApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	h.decideApplication(w, r, membership.ApplicationApproved)
+}
+
+// AdminRejectApplicationHandler rejects an application with a comment
+// POST /api/admin/applications/{id}/reject
+func (h *Handler) AdminRejectApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	h.decideApplication(w, r, membership.ApplicationRejected)
+}
+
+// decideApplication is the shared implementation of approve and reject
+func (h *Handler) decideApplication(w http.ResponseWriter, r *http.Request, status string) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+
+	decider, err := h.getOrCreateUser(r, user)
+	if err != nil {
+		h.jsonError(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !user.IsAdmin() && !decider.IsCouncil {
+		h.jsonError(w, "Forbidden - council or admin access required", http.StatusForbidden)
+		return
+	}
+
+	applicationID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid application ID", http.StatusBadRequest)
+		return
+	}
+
+	var req DecideApplicationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		app      db.Application
+		member   db.User
+		warnings []string
+	)
+	if status == membership.ApplicationApproved {
+		app, member, err = membership.Approve(ctx, h.queries, h.vsAllocator, applicationID, decider.ID, req.Comment)
+	} else {
+		app, err = membership.Reject(ctx, h.queries, applicationID, decider.ID, req.Comment)
+	}
+	if err == membership.ErrNotPending {
+		h.jsonError(w, "O přihlášce už mezitím rozhodl někdo jiný. Načtěte stránku znovu.", http.StatusConflict)
+		return
+	} else if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if status == membership.ApplicationApproved {
+		// Keycloak role and welcome email
+		warnings = h.runStateEffects(ctx, membership.StateAwaiting, member, req.Comment)
+	} else {
+		member, _ = h.queries.GetUserByID(ctx, app.UserID)
+	}
+
+	h.logApplicationDecision(ctx, *decider, member, app, warnings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"message":     fmt.Sprintf("Application %s", app.Status),
+		"payments_id": member.PaymentsID.String,
+		"warnings":    warnings,
+	})
+}
+
+// logApplicationDecision writes an approval or rejection to system_logs
+func (h *Handler) logApplicationDecision(ctx context.Context, decider db.User, member db.User, app db.Application, warnings []string) {
+	deciderUsername := "unknown"
+	if decider.Username.Valid {
+		deciderUsername = decider.Username.String
+	}
+
+	level := "info"
+	if len(warnings) > 0 {
+		level = "warning"
+	}
+
+	action := "approve_application"
+	if app.Status == membership.ApplicationRejected {
+		action = "reject_application"
+	}
+
+	metadata, _ := json.Marshal(struct {
+		DecidedBy     int64    `json:"decided_by"`
+		Action        string   `json:"action"`
+		ApplicationID int64    `json:"application_id"`
+		TargetUserID  int64    `json:"target_user_id"`
+		TargetEmail   string   `json:"target_email"`
+		PaymentsID    string   `json:"payments_id"`
+		Comment       string   `json:"comment"`
+		Warnings      []string `json:"warnings"`
+	}{decider.ID, action, app.ID, member.ID, member.Email, member.PaymentsID.String, app.DecisionComment.String, warnings})
+
+	h.queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "membership",
+		Level:     level,
+		UserID:    sql.NullInt64{Int64: decider.ID, Valid: true},
+		Message: fmt.Sprintf("%s (%s) %s application #%d of %s",
+			deciderUsername, decider.Email, app.Status, app.ID, member.Email),
+		Metadata: sql.NullString{String: string(metadata), Valid: true},
+	})
+}
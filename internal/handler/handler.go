@@ -3,14 +3,22 @@ package handler
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/base48/member-portal/internal/auth"
 	"github.com/base48/member-portal/internal/config"
 	"github.com/base48/member-portal/internal/db"
 	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/jobs"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/scheduler"
+	"github.com/base48/member-portal/internal/vs"
 )
 
 // Handler holds dependencies for HTTP handlers
@@ -21,6 +29,10 @@ type Handler struct {
 	config         *config.Config
 	serviceAccount *auth.ServiceAccountClient
 	emailClient    *email.Client
+	scheduler      *scheduler.Scheduler
+	jobDeps        *jobs.Deps
+	vsAllocator    *vs.Allocator
+	effects        membership.Effector
 }
 
 // New creates a new Handler instance
@@ -47,16 +59,44 @@ func New(authenticator *auth.Authenticator, database *sql.DB, cfg *config.Config
 	// Initialize email client
 	emailClient := email.New(cfg, queries)
 
+	// Variable symbols for new members
+	vsAllocator, err := vs.New(queries, vs.Config{
+		Scheme:     cfg.VSScheme,
+		RangeStart: cfg.VSRangeStart,
+		RangeEnd:   cfg.VSRangeEnd,
+		YearDigits: cfg.VSYearDigits,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	// Note: templates is set to nil, we'll parse on each request
 	// This is simpler than managing template name conflicts
-	return &Handler{
+	h := &Handler{
 		auth:           authenticator,
 		queries:        queries,
 		templates:      nil, // Will be loaded per-request
 		config:         cfg,
 		serviceAccount: serviceAccount,
 		emailClient:    emailClient,
-	}, nil
+		vsAllocator:    vsAllocator,
+	}
+
+	// Keycloak roles and emails on membership state changes
+	h.effects = &membership.ServiceEffector{
+		Config: cfg,
+		Email:  emailClient,
+		Token:  h.getServiceAccountToken,
+	}
+
+	return h, nil
+}
+
+// SetJobs makes the job scheduler and the job dependencies available to the
+// /admin/jobs and /admin/payments/import pages
+func (h *Handler) SetJobs(s *scheduler.Scheduler, d *jobs.Deps) {
+	h.scheduler = s
+	h.jobDeps = d
 }
 
 // getServiceAccountToken is a helper to get service account token with error handling
@@ -149,7 +189,7 @@ func (h *Handler) getOrCreateUser(r *http.Request, kcUser *auth.User) (*db.User,
 		Phone:             sql.NullString{},
 		AltContact:        sql.NullString{},
 		LevelID:           1, // Awaiting level
-		LevelActualAmount: "0",
+		LevelActualAmount: money.Zero,
 		PaymentsID:        sql.NullString{},
 		State:             "awaiting",
 		IsCouncil:         false,
@@ -187,9 +227,10 @@ func (h *Handler) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == http.MethodPost {
 		// Check which form was submitted
-		if r.FormValue("action") == "update_custom_fee" {
-			// Handle custom fee update
-			h.handleCustomFeeUpdate(w, r, dbUser)
+		switch r.FormValue("action") {
+		case "request_level_change", "cancel_level_change":
+			// Level changes take effect next month
+			h.handleLevelChange(w, r, dbUser)
 			return
 		}
 
@@ -224,55 +265,76 @@ func (h *Handler) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	h.render(w, "profile.html", data)
 }
 
-// handleCustomFeeUpdate handles updating user's custom membership fee amount
-func (h *Handler) handleCustomFeeUpdate(w http.ResponseWriter, r *http.Request, dbUser *db.User) {
-	customFeeStr := r.FormValue("custom_fee_amount")
+// handleLevelChange handles a member's request to change their level and fee
+// from next month, or to withdraw such a request
+func (h *Handler) handleLevelChange(w http.ResponseWriter, r *http.Request, dbUser *db.User) {
+	ctx := r.Context()
+	now := time.Now()
 
-	// Parse the custom fee amount
-	var customFee float64
-	if _, err := fmt.Sscanf(customFeeStr, "%f", &customFee); err != nil {
-		http.Error(w, "Neplatná částka", http.StatusBadRequest)
+	if r.FormValue("action") == "cancel_level_change" {
+		cancelled, err := membership.CancelLevelChange(ctx, h.queries, *dbUser, now)
+		if err != nil {
+			http.Error(w, "Chyba při rušení změny úrovně členství", http.StatusInternalServerError)
+			return
+		}
+		if cancelled {
+			h.queries.CreateLog(ctx, db.CreateLogParams{
+				Subsystem: "membership",
+				Level:     "info",
+				UserID:    sql.NullInt64{Int64: dbUser.ID, Valid: true},
+				Message:   fmt.Sprintf("Pending level change withdrawn by %s", dbUser.Email),
+				Metadata:  sql.NullString{String: `{"action":"cancel_level_change"}`, Valid: true},
+			})
+		}
+		http.Redirect(w, r, "/profile?success=1", http.StatusSeeOther)
 		return
 	}
 
-	// Get user's current level to validate minimum
-	level, err := h.queries.GetLevel(r.Context(), dbUser.LevelID)
+	levelID, err := strconv.ParseInt(r.FormValue("level_id"), 10, 64)
 	if err != nil {
-		http.Error(w, "Chyba při načítání úrovně členství", http.StatusInternalServerError)
-		return
+		levelID = dbUser.LevelID
 	}
 
-	// Parse level minimum amount
-	var levelMinimum float64
-	if _, err := fmt.Sscanf(level.Amount, "%f", &levelMinimum); err != nil {
-		http.Error(w, "Chyba konfigurace úrovně členství", http.StatusInternalServerError)
-		return
+	// Whole crowns only, empty means the level amount
+	var amount money.Amount
+	if amountStr := r.FormValue("custom_fee_amount"); amountStr != "" {
+		amount, err = money.Parse(amountStr)
+		if err != nil || amount != amount.RoundKoruny() {
+			http.Error(w, "Neplatná částka", http.StatusBadRequest)
+			return
+		}
 	}
 
-	// Validate: custom fee must be >= level minimum
-	if customFee < levelMinimum {
-		http.Error(w, fmt.Sprintf("Částka musí být minimálně %s Kč (minimum pro %s)", level.Amount, level.Name), http.StatusBadRequest)
+	entry, err := membership.RequestLevelChange(ctx, h.queries, *dbUser, membership.LevelChange{
+		LevelID:           levelID,
+		LevelActualAmount: amount,
+	}, now)
+	if err == membership.ErrNoLevelChange {
+		http.Error(w, "Tuto úroveň a výši příspěvku už máte", http.StatusBadRequest)
 		return
-	}
-
-	// Update the custom fee amount
-	_, err = h.queries.UpdateUserCustomFee(r.Context(), db.UpdateUserCustomFeeParams{
-		LevelActualAmount: fmt.Sprintf("%.0f", customFee),
-		ID:                dbUser.ID,
-	})
-	if err != nil {
-		http.Error(w, "Chyba při aktualizaci členského příspěvku", http.StatusInternalServerError)
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Změnu nelze provést: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	// Log the change
-	h.queries.CreateLog(r.Context(), db.CreateLogParams{
-		Subsystem: "membership",
-		Level:     "info",
-		UserID:    sql.NullInt64{Int64: dbUser.ID, Valid: true},
-		Message:   fmt.Sprintf("Custom fee amount updated: %.0f Kč (minimum: %s Kč)", customFee, level.Amount),
-		Metadata:  sql.NullString{String: fmt.Sprintf(`{"old_amount":"%s","new_amount":"%.0f","level_minimum":"%s"}`, dbUser.LevelActualAmount, customFee, level.Amount), Valid: true},
-	})
+	if entry.ID != 0 {
+		metadata, _ := json.Marshal(struct {
+			Action        string       `json:"action"`
+			OldLevelID    int64        `json:"old_level_id"`
+			OldAmount     money.Amount `json:"old_amount"`
+			LevelID       int64        `json:"level_id"`
+			Amount        money.Amount `json:"amount"`
+			EffectiveFrom string       `json:"effective_from"`
+		}{"request_level_change", dbUser.LevelID, dbUser.LevelActualAmount, entry.LevelID, entry.LevelActualAmount, entry.EffectiveFrom.Format("2006-01-02")})
+		h.queries.CreateLog(ctx, db.CreateLogParams{
+			Subsystem: "membership",
+			Level:     "info",
+			UserID:    sql.NullInt64{Int64: dbUser.ID, Valid: true},
+			Message: fmt.Sprintf("Level change requested by %s: level %d, %s from %s",
+				dbUser.Email, entry.LevelID, entry.LevelActualAmount.Format(), entry.EffectiveFrom.Format("2006-01-02")),
+			Metadata: sql.NullString{String: string(metadata), Valid: true},
+		})
+	}
 
 	http.Redirect(w, r, "/profile?success=1", http.StatusSeeOther)
 }
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/statement"
+	"github.com/go-chi/chi/v5"
+)
+
+// ProfileStatementHandler shows the logged-in member's account statement
+// GET /profile/statement?from=&to=&format=html|csv|pdf
+func (h *Handler) ProfileStatementHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	dbUser, err := h.getOrCreateUser(r, user)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveStatement(w, r, dbUser, "/profile/statement", map[string]interface{}{
+		"Title":   "Výpis účtu",
+		"User":    user,
+		"DBUser":  dbUser,
+		"BackURL": "/profile",
+	})
+}
+
+// AdminUserStatementHandler shows a member's account statement (admin view)
+// GET /admin/users/{id}/statement?from=&to=&format=html|csv|pdf
+func (h *Handler) AdminUserStatementHandler(w http.ResponseWriter, r *http.Request) {
+	user := h.auth.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !user.IsAdmin() {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	targetDBUser, err := h.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	adminDBUser, _ := h.queries.GetUserByKeycloakID(ctx, sql.NullString{
+		String: user.ID,
+		Valid:  true,
+	})
+
+	h.serveStatement(w, r, &targetDBUser, fmt.Sprintf("/admin/users/%d/statement", userID), map[string]interface{}{
+		"Title":       fmt.Sprintf("Výpis účtu: %s", targetDBUser.Email),
+		"User":        user,
+		"DBUser":      adminDBUser,
+		"BackURL":     fmt.Sprintf("/admin/users/%d", userID),
+		"IsAdminView": true,
+	})
+}
+
+// serveStatement builds the statement for the period in the query string and
+// renders it as a page, or downloads it with format=csv or format=pdf
+func (h *Handler) serveStatement(w http.ResponseWriter, r *http.Request, member *db.User, baseURL string, data map[string]interface{}) {
+	q := r.URL.Query()
+	fromStr, toStr := q.Get("from"), q.Get("to")
+
+	from, to, err := parseStatementPeriod(fromStr, toStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	st, err := h.buildStatement(r.Context(), member, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	format := q.Get("format")
+	switch format {
+	case "csv", "pdf":
+		var buf bytes.Buffer
+		if format == "csv" {
+			err = statement.WriteCSV(&buf, st)
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			err = statement.WritePDF(&buf, st)
+			w.Header().Set("Content-Type", "application/pdf")
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write statement: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		filename := fmt.Sprintf("vypis-%d-%s.%s", member.ID, st.Generated.Format("2006-01-02"), format)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.Write(buf.Bytes())
+		return
+	case "", "html":
+	default:
+		http.Error(w, "Unsupported format, use html, csv or pdf", http.StatusBadRequest)
+		return
+	}
+
+	periodURL := func(from, to string, format string) string {
+		v := url.Values{}
+		if from != "" {
+			v.Set("from", from)
+		}
+		if to != "" {
+			v.Set("to", to)
+		}
+		if format != "" {
+			v.Set("format", format)
+		}
+		if len(v) == 0 {
+			return baseURL
+		}
+		return baseURL + "?" + v.Encode()
+	}
+
+	year := time.Now().Year()
+	data["Statement"] = st
+	data["Member"] = member
+	data["From"] = fromStr
+	data["To"] = toStr
+	data["BaseURL"] = baseURL
+	data["CSVURL"] = periodURL(fromStr, toStr, "csv")
+	data["PDFURL"] = periodURL(fromStr, toStr, "pdf")
+	data["Presets"] = []struct {
+		Label string
+		URL   string
+	}{
+		{"Celá historie", periodURL("", "", "")},
+		{"Letos", periodURL(fmt.Sprintf("%d-01-01", year), "", "")},
+		{"Loni", periodURL(fmt.Sprintf("%d-01-01", year-1), fmt.Sprintf("%d-12-31", year-1), "")},
+		{"Posledních 12 měsíců", periodURL(time.Now().AddDate(-1, 0, 0).Format("2006-01-02"), "", "")},
+	}
+
+	h.render(w, "statement.html", data)
+}
+
+// buildStatement loads a member's fees and membership payments into a statement
+func (h *Handler) buildStatement(ctx context.Context, member *db.User, from, to time.Time) (*statement.Statement, error) {
+	fees, err := h.queries.ListFeesByUser(ctx, member.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch fees: %w", err)
+	}
+
+	pays, err := h.queries.ListMembershipPaymentsByUser(ctx, sql.NullInt64{Int64: member.ID, Valid: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payments: %w", err)
+	}
+
+	levels, err := h.queries.ListAllLevels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch levels: %w", err)
+	}
+	levelNames := make(map[int64]string, len(levels))
+	for _, l := range levels {
+		levelNames[l.ID] = l.Name
+	}
+
+	st := statement.Build(fees, pays, levelNames, from, to)
+	st.Member = member.Email
+	if member.Realname.Valid && member.Realname.String != "" {
+		st.Member = fmt.Sprintf("%s <%s>", member.Realname.String, member.Email)
+	}
+	st.VariableSymbol = member.PaymentsID.String
+	st.Generated = time.Now()
+
+	return st, nil
+}
+
+// parseStatementPeriod parses the from/to query parameters (YYYY-MM-DD, both optional)
+func parseStatementPeriod(fromStr, toStr string) (from, to time.Time, err error) {
+	if fromStr != "" {
+		if from, err = time.Parse("2006-01-02", fromStr); err != nil {
+			return from, to, fmt.Errorf("neplatné datum '%s'", fromStr)
+		}
+	}
+	if toStr != "" {
+		if to, err = time.Parse("2006-01-02", toStr); err != nil {
+			return from, to, fmt.Errorf("neplatné datum '%s'", toStr)
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return from, to, fmt.Errorf("konec období je před začátkem")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,245 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/debt"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/scheduler"
+)
+
+// RoleInDebt is the Keycloak role of members in debt under the debt policy
+const RoleInDebt = "in_debt"
+
+// DebtStatusOptions configures a debt status run
+type DebtStatusOptions struct {
+	DryRun bool // Only report the role changes
+}
+
+// RoleChange is a Keycloak role to assign to or remove from a member
+type RoleChange struct {
+	Role       string `json:"role"`
+	Assign     bool   `json:"assign"` // Removed otherwise
+	UserID     int64  `json:"user_id"`
+	Email      string `json:"email"`
+	KeycloakID string `json:"keycloak_id"`
+	Reason     string `json:"reason"`          // Why the member should or should not have the role
+	Error      string `json:"error,omitempty"` // Applying the change failed
+}
+
+// String describes the change, e.g. "+in_debt novak@example.com (balance -1 200 Kč)"
+func (c RoleChange) String() string {
+	sign := "-"
+	if c.Assign {
+		sign = "+"
+	}
+	return fmt.Sprintf("%s%s %s (%s)", sign, c.Role, c.Email, c.Reason)
+}
+
+// DebtStatusResult summarizes a debt status run
+type DebtStatusResult struct {
+	DryRun    bool
+	Users     int // Users with a linked Keycloak account
+	Assigned  int
+	Removed   int
+	Errors    int
+	Unmanaged int // Role members in Keycloak without a portal account, left alone
+	Changes   []RoleChange
+}
+
+// Summary returns a one-line description of the result
+func (r *DebtStatusResult) Summary() string {
+	if r.DryRun {
+		assign := 0
+		for _, c := range r.Changes {
+			if c.Assign {
+				assign++
+			}
+		}
+		return fmt.Sprintf("dry run: %d users, %d to assign, %d to remove",
+			r.Users, assign, len(r.Changes)-assign)
+	}
+	return fmt.Sprintf("%d users, %d assigned, %d removed, %d errors",
+		r.Users, r.Assigned, r.Removed, r.Errors)
+}
+
+// DebtStatusJob returns the debt_status job with the given options
+func DebtStatusJob(d *Deps, opts DebtStatusOptions) scheduler.Job {
+	return scheduler.Job{
+		Name:        JobDebtStatus,
+		Description: "Synchronizace rolí in_debt a active_member v Keycloaku podle databáze",
+		Schedule:    d.Config.ScheduleDebtStatus,
+		Run: func(ctx context.Context, logger *log.Logger) (string, error) {
+			result, err := UpdateDebtStatus(ctx, d, logger, opts)
+			if result == nil {
+				return "", err
+			}
+			return result.Summary(), err
+		},
+	}
+}
+
+// desiredRole decides whether a member should have a managed role and why
+type desiredRole func(status debt.Status) (bool, string)
+
+// managedRoles are the Keycloak roles the job keeps in sync with the database:
+// in_debt for members in debt under the debt policy, active_member for
+// accepted members
+var managedRoles = []struct {
+	name string
+	want desiredRole
+}{
+	{RoleInDebt, func(status debt.Status) (bool, string) {
+		return status.InDebt, status.Reason
+	}},
+	{membership.ActiveMemberRole, func(status debt.Status) (bool, string) {
+		return status.User.State == membership.StateAccepted, "state " + status.User.State
+	}},
+}
+
+// UpdateDebtStatus reconciles the in_debt and active_member Keycloak roles
+// with the database. The members of each role are fetched in bulk and only
+// the difference is applied: in_debt for members in debt under the debt
+// policy (DEBT_THRESHOLD, DEBT_GRACE_DAYS, exemptions), active_member for
+// accepted members. Role members without a portal account are left alone.
+// Applied changes are written to system_logs.
+func UpdateDebtStatus(ctx context.Context, d *Deps, logger *log.Logger, opts DebtStatusOptions) (*DebtStatusResult, error) {
+	policy, err := debt.PolicyFromConfig(d.Config)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := debt.Load(ctx, d.Queries, policy, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("Debt policy: threshold %s, grace period %d days", policy.Threshold, policy.GraceDays)
+
+	// Portal users by Keycloak ID, in the order of ListUsers
+	var linked []debt.Status
+	byKeycloakID := make(map[string]db.User)
+	for _, status := range statuses {
+		user := status.User
+		if !user.KeycloakID.Valid || user.KeycloakID.String == "" {
+			continue
+		}
+		linked = append(linked, status)
+		byKeycloakID[user.KeycloakID.String] = user
+	}
+
+	result := &DebtStatusResult{DryRun: opts.DryRun, Users: len(linked)}
+
+	kcClient, err := d.Keycloak(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logger.Println("✓ Service account authenticated")
+
+	for _, role := range managedRoles {
+		members, err := kcClient.GetRoleUsers(ctx, role.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get members of role %s: %w", role.name, err)
+		}
+
+		has := make(map[string]bool, len(members))
+		for _, m := range members {
+			if _, ok := byKeycloakID[m.ID]; !ok {
+				result.Unmanaged++
+				continue
+			}
+			has[m.ID] = true
+		}
+		logger.Printf("Role %s: %d members in Keycloak", role.name, len(members))
+
+		for _, status := range linked {
+			user := status.User
+			want, reason := role.want(status)
+			if want == has[user.KeycloakID.String] {
+				continue
+			}
+			result.Changes = append(result.Changes, RoleChange{
+				Role:       role.name,
+				Assign:     want,
+				UserID:     user.ID,
+				Email:      user.Email,
+				KeycloakID: user.KeycloakID.String,
+				Reason:     reason,
+			})
+		}
+	}
+
+	if opts.DryRun {
+		for _, c := range result.Changes {
+			logger.Printf("  → would apply %s", c)
+		}
+		logger.Printf("Dry run, %d change(s) not applied", len(result.Changes))
+		return result, nil
+	}
+
+	for i := range result.Changes {
+		c := &result.Changes[i]
+
+		var err error
+		if c.Assign {
+			err = kcClient.AssignRoleToUser(ctx, c.KeycloakID, c.Role)
+		} else {
+			err = kcClient.RemoveRoleFromUser(ctx, c.KeycloakID, c.Role)
+		}
+
+		switch {
+		case err != nil:
+			c.Error = err.Error()
+			result.Errors++
+			logger.Printf("✗ Failed to apply %s: %v", c, err)
+		case c.Assign:
+			result.Assigned++
+			logger.Printf("✓ Applied %s", c)
+		default:
+			result.Removed++
+			logger.Printf("✓ Applied %s", c)
+		}
+
+		logRoleChange(ctx, d.Queries, *c)
+	}
+
+	logger.Printf("Summary:")
+	logger.Printf("  Linked users: %d", result.Users)
+	logger.Printf("  Assigned: %d", result.Assigned)
+	logger.Printf("  Removed: %d", result.Removed)
+	logger.Printf("  Not managed (no portal account): %d", result.Unmanaged)
+	logger.Printf("  Errors: %d", result.Errors)
+
+	if result.Errors > 0 {
+		return result, fmt.Errorf("job completed with %d errors", result.Errors)
+	}
+
+	return result, nil
+}
+
+// logRoleChange writes an applied (or failed) role change to system_logs
+func logRoleChange(ctx context.Context, queries *db.Queries, c RoleChange) {
+	level, verb := "info", "Removed"
+	if c.Assign {
+		verb = "Assigned"
+	}
+	message := fmt.Sprintf("%s %s role of %s (%s)", verb, c.Role, c.Email, c.Reason)
+	if c.Error != "" {
+		level = "error"
+		message = fmt.Sprintf("Failed to change %s role of %s (%s): %s", c.Role, c.Email, c.Reason, c.Error)
+	}
+
+	metadata, _ := json.Marshal(c)
+
+	queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "debt_status",
+		Level:     level,
+		UserID:    sql.NullInt64{Int64: c.UserID, Valid: true},
+		Message:   message,
+		Metadata:  sql.NullString{String: string(metadata), Valid: true},
+	})
+}
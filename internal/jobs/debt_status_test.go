@@ -0,0 +1,150 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/keycloak"
+	"github.com/base48/member-portal/internal/keycloak/keycloaktest"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestUpdateDebtStatus(t *testing.T) {
+	d, _ := newTestDeps(t)
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+
+	srv := keycloaktest.NewServer("base48", RoleInDebt, membership.ActiveMemberRole)
+	t.Cleanup(srv.Close)
+	srv.ExpireTokensAfter(3)
+	d.Config.KeycloakURL = srv.URL
+	d.Config.KeycloakRealm = "base48"
+	d.Keycloak = func(ctx context.Context) (*keycloak.Client, error) {
+		return keycloak.NewClientWithTokenSource(d.Config, srv.Tokens()), nil
+	}
+
+	member := func(email, keycloakID, state string) db.User {
+		t.Helper()
+		user, err := d.Queries.CreateUser(ctx, db.CreateUserParams{
+			KeycloakID: sql.NullString{String: keycloakID, Valid: keycloakID != ""},
+			Email:      email,
+			LevelID:    1,
+			State:      state,
+		})
+		if err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		if keycloakID != "" {
+			srv.AddUser(keycloakID, email)
+		}
+		return user
+	}
+
+	debtor := member("dluznik@example.com", "kc-debtor", membership.StateAccepted)
+	if _, err := d.Queries.CreateFee(ctx, db.CreateFeeParams{
+		UserID:      debtor.ID,
+		LevelID:     1,
+		PeriodStart: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Amount:      money.FromKoruny(1000),
+	}); err != nil {
+		t.Fatalf("create fee: %v", err)
+	}
+	paid := member("platic@example.com", "kc-paid", membership.StateAccepted)
+	srv.Grant("kc-paid", RoleInDebt) // Paid off the debt
+	srv.Grant("kc-paid", membership.ActiveMemberRole)
+	member("pozastaven@example.com", "kc-suspended", membership.StateSuspended)
+	srv.Grant("kc-suspended", membership.ActiveMemberRole)
+	member("bez-uctu@example.com", "", membership.StateAccepted)
+
+	// Not in the portal, left alone
+	srv.AddUser("kc-admin", "admin@example.com")
+	srv.Grant("kc-admin", RoleInDebt)
+
+	want := []string{
+		"+in_debt dluznik@example.com (balance " + money.FromKoruny(-1000).Format() + ")",
+		"-in_debt platic@example.com (balance " + money.Zero.Format() + ")",
+		"+active_member dluznik@example.com (state accepted)",
+		"-active_member pozastaven@example.com (state suspended)",
+	}
+
+	result, err := UpdateDebtStatus(ctx, d, logger, DebtStatusOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(result.Changes) != len(want) {
+		t.Fatalf("dry run changes: %v", result.Changes)
+	}
+	for i, c := range result.Changes {
+		if c.String() != want[i] {
+			t.Errorf("change %d = %q, want %q", i, c, want[i])
+		}
+	}
+	if srv.HasRole("kc-debtor", RoleInDebt) || !srv.HasRole("kc-paid", RoleInDebt) {
+		t.Error("dry run changed roles")
+	}
+	if result.Summary() != "dry run: 3 users, 2 to assign, 2 to remove" {
+		t.Errorf("summary %q", result.Summary())
+	}
+
+	result, err = UpdateDebtStatus(ctx, d, logger, DebtStatusOptions{})
+	if err != nil {
+		t.Fatalf("UpdateDebtStatus: %v", err)
+	}
+	if result.Assigned != 2 || result.Removed != 2 || result.Errors != 0 || result.Unmanaged != 1 {
+		t.Errorf("result: %+v", result)
+	}
+	roles := []struct {
+		user, role string
+		want       bool
+	}{
+		{"kc-debtor", RoleInDebt, true},
+		{"kc-debtor", membership.ActiveMemberRole, true},
+		{"kc-paid", RoleInDebt, false},
+		{"kc-paid", membership.ActiveMemberRole, true},
+		{"kc-suspended", membership.ActiveMemberRole, false},
+		{"kc-admin", RoleInDebt, true},
+	}
+	for _, r := range roles {
+		if srv.HasRole(r.user, r.role) != r.want {
+			t.Errorf("%s has %s: %v, want %v", r.user, r.role, !r.want, r.want)
+		}
+	}
+	if srv.IssuedTokens() < 2 {
+		t.Errorf("%d tokens issued, expired tokens were not refreshed", srv.IssuedTokens())
+	}
+
+	logs, _ := d.Queries.ListLogsBySubsystem(ctx, db.ListLogsBySubsystemParams{Subsystem: "debt_status", Limit: 10})
+	if len(logs) != 4 {
+		t.Errorf("%d changes logged, want 4", len(logs))
+	}
+	if paidLogs, _ := d.Queries.ListLogsByUser(ctx, db.ListLogsByUserParams{UserID: sql.NullInt64{Int64: paid.ID, Valid: true}, Limit: 10}); len(paidLogs) != 1 {
+		t.Errorf("logs of the member who paid: %+v", paidLogs)
+	}
+
+	// Everything in sync: no role requests besides fetching the members
+	before := len(srv.Requests())
+	result, err = UpdateDebtStatus(ctx, d, logger, DebtStatusOptions{})
+	if err != nil || len(result.Changes) != 0 {
+		t.Errorf("second run: %+v, %v", result, err)
+	}
+	if requests := srv.Requests()[before:]; len(requests) != 2 {
+		t.Errorf("second run made %d requests: %v", len(requests), requests)
+	}
+
+	// A debt below the threshold of the debt policy does not count
+	d.Config.DebtThreshold = "1500"
+	result, err = UpdateDebtStatus(ctx, d, logger, DebtStatusOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run with threshold: %v", err)
+	}
+	below := "-in_debt dluznik@example.com (balance " + money.FromKoruny(-1000).Format() + ", below " + money.FromKoruny(1500).Format() + ")"
+	if len(result.Changes) != 1 || result.Changes[0].String() != below {
+		t.Errorf("changes with threshold: %v", result.Changes)
+	}
+}
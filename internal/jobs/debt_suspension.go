@@ -0,0 +1,188 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/base48/member-portal/internal/dates"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/debt"
+	"github.com/base48/member-portal/internal/dunning"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/statement"
+)
+
+// DebtSuspensionResult summarizes a debt suspension run
+type DebtSuspensionResult struct {
+	Disabled  bool
+	Members   int
+	Suspended int
+	NoNotice  int // In debt long enough, but not given the final notice
+	Warnings  int // Suspended, but an effect (role, email) failed
+	Errors    int
+}
+
+// Summary returns a one-line description of the result
+func (r *DebtSuspensionResult) Summary() string {
+	if r.Disabled {
+		return "disabled (DEBT_SUSPEND_THRESHOLD=0)"
+	}
+	return fmt.Sprintf("%d members, %d suspended, %d without final notice, %d warnings, %d errors",
+		r.Members, r.Suspended, r.NoNotice, r.Warnings, r.Errors)
+}
+
+// SuspendDebtors suspends accepted members whose debt has been at least
+// DEBT_SUSPEND_THRESHOLD for DEBT_SUSPEND_DAYS days. The debt is computed
+// from the ledger (fees and membership payments, as on the account
+// statement) and counts only since the member was last accepted, so a member
+// reinstated by an admin gets the full period again. Members exempted by the
+// debt policy are never suspended, and neither are members the dunning job
+// has not given the final notice in their open case: a member is never
+// suspended without a warning. With the dunning suspension stage on too
+// (DUNNING_SUSPEND_DAYS), whichever rule is met first suspends the member.
+func SuspendDebtors(ctx context.Context, d *Deps, logger *log.Logger, now time.Time) (*DebtSuspensionResult, error) {
+	cfg := d.Config
+	if cfg.DebtSuspendThreshold <= 0 {
+		logger.Println("Automatic suspension disabled (DEBT_SUSPEND_THRESHOLD=0)")
+		return &DebtSuspensionResult{Disabled: true}, nil
+	}
+
+	threshold := money.FromKoruny(int64(cfg.DebtSuspendThreshold))
+	today := dates.Day(now)
+	deadline := today.AddDate(0, 0, -cfg.DebtSuspendDays)
+
+	members, err := d.Queries.ListUsersByState(ctx, membership.StateAccepted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+
+	exemptions, err := debt.Exemptions(ctx, d.Queries, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Members given the final notice in their open dunning case
+	notices, err := d.Queries.ListOpenDunningNotices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dunning notices: %w", err)
+	}
+	noticed := make(map[int64]bool)
+	for _, n := range notices {
+		if n.Stage == dunning.StageFinalNotice {
+			noticed[n.UserID] = true
+		}
+	}
+
+	logger.Printf("Checking %d accepted members (debt %s for %d days)...", len(members), threshold.Format(), cfg.DebtSuspendDays)
+
+	result := &DebtSuspensionResult{Members: len(members)}
+
+	for _, member := range members {
+		if e, ok := exemptions[member.ID]; ok {
+			logger.Printf("  - Skipping %s (exempt: %s)", member.Email, e.Reason)
+			continue
+		}
+
+		since, balance, err := debtSince(ctx, d.Queries, member, threshold)
+		if err != nil {
+			logger.Printf("  ✗ Failed to compute debt of %s: %v", member.Email, err)
+			result.Errors++
+			continue
+		}
+		if since.IsZero() || since.After(deadline) {
+			continue
+		}
+		if !noticed[member.ID] {
+			logger.Printf("  - Skipping %s (debt since %s, no final notice yet)", member.Email, since.Format("2006-01-02"))
+			result.NoNotice++
+			continue
+		}
+
+		reason := fmt.Sprintf("Dluh na členských příspěvcích %s trvá od %s (limit %s déle než %d dní).",
+			balance.Abs().Format(), since.Format("02.01.2006"), threshold.Format(), cfg.DebtSuspendDays)
+
+		suspended, _, failed, err := membership.Transit(ctx, d.Queries, d.Effects, member, membership.StateSuspended, 0, reason)
+		if err != nil {
+			logger.Printf("  ✗ Failed to suspend %s: %v", member.Email, err)
+			result.Errors++
+			continue
+		}
+
+		logger.Printf("  ✓ Suspended %s (balance %s since %s)", member.Email, balance.Format(), since.Format("2006-01-02"))
+		result.Suspended++
+
+		level := "info"
+		for _, f := range failed {
+			logger.Printf("    ⚠ %v", f)
+		}
+		if len(failed) > 0 {
+			level = "warning"
+			result.Warnings++
+		}
+
+		metadata, _ := json.Marshal(struct {
+			Action        string       `json:"action"`
+			TargetUserID  int64        `json:"target_user_id"`
+			Balance       money.Amount `json:"balance"`
+			DebtSince     string       `json:"debt_since"`
+			FailedEffects int          `json:"failed_effects"`
+		}{"suspend_debtor", suspended.ID, balance, since.Format("2006-01-02"), len(failed)})
+		d.Queries.CreateLog(ctx, db.CreateLogParams{
+			Subsystem: "membership",
+			Level:     level,
+			UserID:    sql.NullInt64{Int64: suspended.ID, Valid: true},
+			Message:   fmt.Sprintf("Membership of %s suspended for debt %s since %s", suspended.Email, balance.Format(), since.Format("2006-01-02")),
+			Metadata:  sql.NullString{String: string(metadata), Valid: true},
+		})
+	}
+
+	logger.Printf("Summary:")
+	logger.Printf("  Accepted members: %d", result.Members)
+	logger.Printf("  Suspended: %d", result.Suspended)
+	logger.Printf("  Without final notice: %d", result.NoNotice)
+	logger.Printf("  With warnings: %d", result.Warnings)
+	logger.Printf("  Errors: %d", result.Errors)
+
+	if result.Errors > 0 {
+		return result, fmt.Errorf("job completed with %d errors", result.Errors)
+	}
+
+	return result, nil
+}
+
+// debtSince returns the day since which the member has been at least
+// threshold in debt (zero if they are not) and their current balance
+func debtSince(ctx context.Context, queries *db.Queries, member db.User, threshold money.Amount) (time.Time, money.Amount, error) {
+	fees, err := queries.ListFeesByUser(ctx, member.ID)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to list fees: %w", err)
+	}
+	pays, err := queries.ListMembershipPaymentsByUser(ctx, sql.NullInt64{Int64: member.ID, Valid: true})
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to list payments: %w", err)
+	}
+
+	st := statement.Build(fees, pays, nil, time.Time{}, time.Time{})
+	since, ok := st.DebtSince(threshold)
+	if !ok {
+		return time.Time{}, st.Closing, nil
+	}
+
+	// Debt from before the member was last accepted does not count
+	accepted, err := queries.GetLatestStateChangeTo(ctx, db.GetLatestStateChangeToParams{
+		UserID:  member.ID,
+		ToState: membership.StateAccepted,
+	})
+	if err == nil && accepted.ChangedAt.After(since) {
+		since = dates.Day(accepted.ChangedAt)
+	} else if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, 0, fmt.Errorf("failed to load state history: %w", err)
+	}
+
+	return since, st.Closing, nil
+}
@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dunning"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// fakeEffector counts the effects of state changes instead of calling
+// Keycloak and sending emails
+type fakeEffector struct {
+	revoked   int
+	suspended []string // Reasons of suspension emails
+}
+
+func (f *fakeEffector) SetActiveMember(ctx context.Context, member db.User, active bool) error {
+	if !active {
+		f.revoked++
+	}
+	return nil
+}
+
+func (f *fakeEffector) SendWelcome(ctx context.Context, member db.User) error {
+	return nil
+}
+
+func (f *fakeEffector) SendSuspended(ctx context.Context, member db.User, reason string) error {
+	f.suspended = append(f.suspended, reason)
+	return nil
+}
+
+func TestSuspendDebtors(t *testing.T) {
+	d, _ := newTestDeps(t)
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+	fx := &fakeEffector{}
+	d.Effects = fx
+
+	fees := func(user db.User, months ...string) {
+		t.Helper()
+		for _, m := range months {
+			period, _ := time.Parse("2006-01", m)
+			if _, err := d.Queries.CreateFee(ctx, db.CreateFeeParams{
+				UserID:      user.ID,
+				LevelID:     user.LevelID,
+				PeriodStart: period,
+				Amount:      money.FromKoruny(1000),
+			}); err != nil {
+				t.Fatalf("create fee: %v", err)
+			}
+		}
+	}
+
+	debtor := createTestUser(t, d, "dluznik@example.com", "1001")
+	fees(debtor, "2026-01", "2026-02", "2026-03")
+	recent := createTestUser(t, d, "novy@example.com", "1002")
+	fees(recent, "2026-05", "2026-06")
+	createTestUser(t, d, "platic@example.com", "1003")
+	honorary := createTestUser(t, d, "cestny@example.com", "1004")
+	fees(honorary, "2026-01", "2026-02", "2026-03")
+	if _, err := d.Queries.CreateDebtExemption(ctx, db.CreateDebtExemptionParams{UserID: honorary.ID, Reason: "Čestný člen"}); err != nil {
+		t.Fatalf("create exemption: %v", err)
+	}
+
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	// Turned off by default
+	result, err := SuspendDebtors(ctx, d, logger, now)
+	if err != nil || !result.Disabled {
+		t.Fatalf("disabled run: %+v, %v", result, err)
+	}
+
+	// Not without the final notice of the dunning job
+	d.Config.DebtSuspendThreshold = 2000
+	d.Config.DebtSuspendDays = 60
+	result, err = SuspendDebtors(ctx, d, logger, now)
+	if err != nil || result.Suspended != 0 || result.NoNotice != 1 {
+		t.Fatalf("without final notice: %+v, %v", result, err)
+	}
+
+	for _, stage := range []string{dunning.StageReminder, dunning.StageWarning, dunning.StageFinalNotice} {
+		if _, err := d.Queries.CreateDunningNotice(ctx, db.CreateDunningNoticeParams{
+			UserID:  debtor.ID,
+			Stage:   stage,
+			Balance: money.FromKoruny(-3000),
+			SentAt:  now.AddDate(0, 0, -7),
+		}); err != nil {
+			t.Fatalf("create dunning notice: %v", err)
+		}
+	}
+	result, err = SuspendDebtors(ctx, d, logger, now)
+	if err != nil {
+		t.Fatalf("SuspendDebtors: %v", err)
+	}
+	if result.Members != 4 || result.Suspended != 1 || result.NoNotice != 0 || result.Warnings != 0 {
+		t.Errorf("result %+v", result)
+	}
+
+	// 2000 Kč in debt since February, the recent debtor only since June
+	got, _ := d.Queries.GetUserByID(ctx, debtor.ID)
+	if got.State != membership.StateSuspended {
+		t.Errorf("debtor state %s, want suspended", got.State)
+	}
+	if got, _ := d.Queries.GetUserByID(ctx, recent.ID); got.State != membership.StateAccepted {
+		t.Errorf("recent debtor state %s, want accepted", got.State)
+	}
+	if got, _ := d.Queries.GetUserByID(ctx, honorary.ID); got.State != membership.StateAccepted {
+		t.Errorf("exempted member state %s, want accepted", got.State)
+	}
+	if fx.revoked != 1 || len(fx.suspended) != 1 {
+		t.Errorf("effects: %d revoked, suspension emails %v", fx.revoked, fx.suspended)
+	}
+	history, _ := d.Queries.ListStateHistoryByUser(ctx, debtor.ID)
+	if len(history) != 1 || history[0].ChangedBy.Valid || !history[0].Reason.Valid {
+		t.Errorf("state history %+v", history)
+	}
+
+	// Reinstated by an admin, the debt counts again from the reinstatement
+	if _, _, _, err := membership.Transit(ctx, d.Queries, fx, got, membership.StateAccepted, 0, "Splátkový kalendář"); err != nil {
+		t.Fatalf("reinstate: %v", err)
+	}
+	if result, err = SuspendDebtors(ctx, d, logger, now); err != nil || result.Suspended != 0 {
+		t.Errorf("after reinstatement: %+v, %v", result, err)
+	}
+}
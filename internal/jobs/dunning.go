@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/debt"
+	"github.com/base48/member-portal/internal/dunning"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/scheduler"
+)
+
+// DunningOptions configures a dunning run
+type DunningOptions struct {
+	DryRun bool // Only report the notices
+}
+
+// DunningAction is a notice sent (or in a dry run, to be sent) or a case
+// closed by a dunning run
+type DunningAction struct {
+	UserID  int64        `json:"user_id"`
+	Email   string       `json:"email"`
+	Stage   string       `json:"stage,omitempty"` // Empty when the case is closed
+	Balance money.Amount `json:"balance"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// Resolve reports whether the action closes the member's case
+func (a DunningAction) Resolve() bool {
+	return a.Stage == ""
+}
+
+// String describes the action, e.g. "warning novak@example.com (balance -2 000 Kč)"
+func (a DunningAction) String() string {
+	stage := a.Stage
+	if a.Resolve() {
+		stage = "resolved"
+	}
+	return fmt.Sprintf("%s %s (balance %s)", stage, a.Email, a.Balance.Format())
+}
+
+// DunningResult summarizes a dunning run
+type DunningResult struct {
+	DryRun    bool
+	InDebt    int // Members in debt under the debt policy
+	Notices   int // Reminders, warnings and final notices
+	Suspended int
+	Resolved  int
+	Errors    int
+	Actions   []DunningAction
+}
+
+// Summary returns a one-line description of the result
+func (r *DunningResult) Summary() string {
+	if r.DryRun {
+		return fmt.Sprintf("dry run: %d in debt, %d notices, %d suspensions, %d resolved",
+			r.InDebt, r.Notices, r.Suspended, r.Resolved)
+	}
+	return fmt.Sprintf("%d in debt, %d notices sent, %d suspended, %d resolved, %d errors",
+		r.InDebt, r.Notices, r.Suspended, r.Resolved, r.Errors)
+}
+
+// DunningJob returns the dunning job with the given options
+func DunningJob(d *Deps, opts DunningOptions) scheduler.Job {
+	return scheduler.Job{
+		Name:        JobDunning,
+		Description: "Upomínky dlužníkům (připomínka, varování, poslední výzva, pozastavení)",
+		Schedule:    d.Config.ScheduleDunning,
+		Run: func(ctx context.Context, logger *log.Logger) (string, error) {
+			result, err := RunDunning(ctx, d, logger, opts, time.Now())
+			if result == nil {
+				return "", err
+			}
+			return result.Summary(), err
+		},
+	}
+}
+
+// RunDunning takes the next step of every member's dunning case (see
+// dunning.Settings.Next): sends the reminder, warning or final notice,
+// suspends the membership after the final notice, or closes the case of a
+// member no longer in debt. Sent notices are recorded in dunning_notices and
+// system_logs. A notice whose email could not be queued is not recorded, so
+// the next run tries again; the delivery itself is retried by the outbox.
+func RunDunning(ctx context.Context, d *Deps, logger *log.Logger, opts DunningOptions, now time.Time) (*DunningResult, error) {
+	settings, err := dunning.SettingsFromConfig(d.Config)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := debt.PolicyFromConfig(d.Config)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := debt.Load(ctx, d.Queries, policy, now)
+	if err != nil {
+		return nil, err
+	}
+	notices, err := d.Queries.ListOpenDunningNotices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dunning notices: %w", err)
+	}
+	open := make(map[int64][]db.DunningNotice)
+	for _, n := range notices {
+		open[n.UserID] = append(open[n.UserID], n)
+	}
+
+	result := &DunningResult{DryRun: opts.DryRun}
+
+	for _, status := range statuses {
+		if status.InDebt {
+			result.InDebt++
+		}
+		next, ok := settings.Next(status, open[status.User.ID], now)
+		if !ok {
+			continue
+		}
+
+		action := DunningAction{
+			UserID:  status.User.ID,
+			Email:   status.User.Email,
+			Stage:   next.Stage,
+			Balance: status.Balance,
+		}
+
+		if !opts.DryRun {
+			if err := d.takeDunningAction(ctx, logger, settings, status, action, now); err != nil {
+				action.Error = err.Error()
+				result.Errors++
+				logger.Printf("  ✗ Failed: %s: %v", action, err)
+			} else {
+				logger.Printf("  ✓ %s", action)
+			}
+		} else {
+			logger.Printf("  → would apply %s", action)
+		}
+
+		if action.Error == "" {
+			switch {
+			case action.Resolve():
+				result.Resolved++
+			case action.Stage == dunning.StageSuspension:
+				result.Suspended++
+			default:
+				result.Notices++
+			}
+		}
+		result.Actions = append(result.Actions, action)
+	}
+
+	logger.Printf("Summary:")
+	logger.Printf("  In debt: %d", result.InDebt)
+	logger.Printf("  Notices: %d", result.Notices)
+	logger.Printf("  Suspended: %d", result.Suspended)
+	logger.Printf("  Resolved: %d", result.Resolved)
+	logger.Printf("  Errors: %d", result.Errors)
+
+	if result.Errors > 0 {
+		return result, fmt.Errorf("job completed with %d errors", result.Errors)
+	}
+
+	return result, nil
+}
+
+// takeDunningAction sends the notice (or suspends the member, or closes the
+// case) and records it
+func (d *Deps) takeDunningAction(ctx context.Context, logger *log.Logger, settings dunning.Settings, status debt.Status, action DunningAction, now time.Time) error {
+	member := status.User
+
+	var err error
+	switch action.Stage {
+	case "":
+		err = d.Queries.ResolveDunningNotices(ctx, db.ResolveDunningNoticesParams{
+			ResolvedAt: sql.NullTime{Time: now, Valid: true},
+			UserID:     member.ID,
+		})
+	case dunning.StageReminder:
+		err = d.Email.SendNegativeBalance(ctx, &member, status.Balance)
+	case dunning.StageWarning:
+		err = d.Email.SendDebtWarning(ctx, &member, status.Balance, status.MonthlyFee)
+	case dunning.StageFinalNotice:
+		err = d.Email.SendDebtFinalNotice(ctx, &member, status.Balance, status.MonthlyFee, settings.SuspendOn(now))
+	case dunning.StageSuspension:
+		reason := fmt.Sprintf("Dluh na členských příspěvcích %s nebyl uhrazen ani po poslední výzvě.", status.Balance.Abs().Format())
+		var failed []*membership.EffectError
+		if _, _, failed, err = membership.Transit(ctx, d.Queries, d.Effects, member, membership.StateSuspended, 0, reason); err == nil {
+			for _, f := range failed {
+				logger.Printf("    ⚠ %v", f)
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown stage %q", action.Stage)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !action.Resolve() {
+		if _, err := d.Queries.CreateDunningNotice(ctx, db.CreateDunningNoticeParams{
+			UserID:  member.ID,
+			Stage:   action.Stage,
+			Balance: status.Balance,
+			SentAt:  now,
+		}); err != nil {
+			return fmt.Errorf("failed to record the notice: %w", err)
+		}
+	}
+
+	message := fmt.Sprintf("Dunning %s sent to %s (balance %s)", action.Stage, member.Email, status.Balance.Format())
+	if action.Resolve() {
+		message = fmt.Sprintf("Dunning case of %s resolved (balance %s)", member.Email, status.Balance.Format())
+	}
+	metadata, _ := json.Marshal(action)
+
+	d.Queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "dunning",
+		Level:     "info",
+		UserID:    sql.NullInt64{Int64: member.ID, Valid: true},
+		Message:   message,
+		Metadata:  sql.NullString{String: string(metadata), Valid: true},
+	})
+	return nil
+}
@@ -0,0 +1,171 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dunning"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestRunDunning(t *testing.T) {
+	d, _ := newTestDeps(t)
+	ctx := context.Background()
+	fx := &fakeEffector{}
+	d.Effects = fx
+	sent := withEmail(t, d)
+	d.Config.DunningWarning = "2m"
+	d.Config.DunningFinal = "3m"
+	d.Config.DunningCooldownDays = 14
+	d.Config.DunningSuspendDays = 30
+
+	fee := func(user db.User, month string) {
+		t.Helper()
+		period, _ := time.Parse("2006-01", month)
+		if _, err := d.Queries.CreateFee(ctx, db.CreateFeeParams{
+			UserID:      user.ID,
+			LevelID:     user.LevelID,
+			PeriodStart: period,
+			Amount:      money.FromKoruny(1000),
+		}); err != nil {
+			t.Fatalf("create fee: %v", err)
+		}
+	}
+	pay := func(user db.User, amount int64) {
+		t.Helper()
+		if _, err := d.Queries.CreatePayment(ctx, db.CreatePaymentParams{
+			UserID:         sql.NullInt64{Int64: user.ID, Valid: true},
+			Date:           time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+			Amount:         money.FromKoruny(amount),
+			Kind:           "manual",
+			KindID:         user.Email,
+			Identification: user.PaymentsID.String,
+		}); err != nil {
+			t.Fatalf("create payment: %v", err)
+		}
+	}
+
+	debtor := createTestUser(t, d, "dluznik@example.com", "1001")
+	fee(debtor, "2026-01")
+	fee(debtor, "2026-02")
+	payer := createTestUser(t, d, "platic@example.com", "1002")
+	fee(payer, "2026-02")
+	createTestUser(t, d, "cisty@example.com", "1003")
+	honorary := createTestUser(t, d, "cestny@example.com", "1004")
+	fee(honorary, "2026-01")
+	if _, err := d.Queries.CreateDebtExemption(ctx, db.CreateDebtExemptionParams{UserID: honorary.ID, Reason: "Čestný člen"}); err != nil {
+		t.Fatalf("create exemption: %v", err)
+	}
+
+	// run runs the dunning on the day and returns the stages of the actions
+	// by email, "resolved" for a closed case
+	run := func(day string, opts DunningOptions) map[string]string {
+		t.Helper()
+		now, _ := time.Parse("2006-01-02", day)
+		result, err := RunDunning(ctx, d, testLogger(), opts, now.Add(10*time.Hour))
+		if err != nil {
+			t.Fatalf("RunDunning on %s: %v", day, err)
+		}
+		stages := make(map[string]string)
+		for _, a := range result.Actions {
+			stages[a.Email] = a.Stage
+			if a.Resolve() {
+				stages[a.Email] = "resolved"
+			}
+		}
+		return stages
+	}
+	expect := func(day string, got map[string]string, want map[string]string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s: actions %v, want %v", day, got, want)
+			return
+		}
+		for email, stage := range want {
+			if got[email] != stage {
+				t.Errorf("%s: actions %v, want %v", day, got, want)
+				return
+			}
+		}
+	}
+
+	// A dry run records nothing
+	expect("dry run", run("2026-03-01", DunningOptions{DryRun: true}), map[string]string{
+		debtor.Email: dunning.StageReminder,
+		payer.Email:  dunning.StageReminder,
+	})
+	if open, _ := d.Queries.ListOpenDunningNotices(ctx); len(open) != 0 {
+		t.Fatalf("dry run recorded %d notices", len(open))
+	}
+
+	if got := deliverEmails(t, d, sent); len(got) != 0 {
+		t.Errorf("dry run sent %v", got)
+	}
+
+	expect("2026-03-01", run("2026-03-01", DunningOptions{}), map[string]string{
+		debtor.Email: dunning.StageReminder,
+		payer.Email:  dunning.StageReminder,
+	})
+	sentEmails := func(day string, want ...string) {
+		t.Helper()
+		got := deliverEmails(t, d, sent)
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: sent %q, want %q", day, got, want)
+		}
+	}
+	sentEmails("2026-03-01",
+		"dluznik@example.com: Záporná bilance členského příspěvku",
+		"platic@example.com: Záporná bilance členského příspěvku",
+	)
+	// Sent once, the warning waits for the cooldown
+	expect("2026-03-02", run("2026-03-02", DunningOptions{}), map[string]string{})
+	expect("2026-03-15", run("2026-03-15", DunningOptions{}), map[string]string{
+		debtor.Email: dunning.StageWarning,
+	})
+	sentEmails("2026-03-15", "dluznik@example.com: ⚠️ Upozornění na dluh za členství")
+
+	// The payer pays up and the case is closed
+	pay(payer, 1000)
+	fee(debtor, "2026-03")
+	expect("2026-03-20", run("2026-03-20", DunningOptions{}), map[string]string{
+		payer.Email: "resolved",
+	})
+	expect("2026-03-29", run("2026-03-29", DunningOptions{}), map[string]string{
+		debtor.Email: dunning.StageFinalNotice,
+	})
+	sentEmails("2026-03-29", "dluznik@example.com: ⛔ Poslední výzva k úhradě dluhu za členství")
+	expect("2026-04-27", run("2026-04-27", DunningOptions{}), map[string]string{})
+	expect("2026-04-28", run("2026-04-28", DunningOptions{}), map[string]string{
+		debtor.Email: dunning.StageSuspension,
+	})
+
+	got, _ := d.Queries.GetUserByID(ctx, debtor.ID)
+	if got.State != membership.StateSuspended || len(fx.suspended) != 1 {
+		t.Errorf("debtor %s, suspension emails %v", got.State, fx.suspended)
+	}
+	open, _ := d.Queries.ListOpenDunningNotices(ctx)
+	if len(open) != 4 || open[0].Stage != dunning.StageReminder || open[3].Stage != dunning.StageSuspension {
+		t.Errorf("open notices %+v", open)
+	}
+	if open[1].Balance != money.FromKoruny(-2000) || open[2].Balance != money.FromKoruny(-3000) {
+		t.Errorf("balances %s, %s", open[1].Balance, open[2].Balance)
+	}
+
+	// Nothing more to send to a suspended member until the debt is paid
+	expect("2026-06-01", run("2026-06-01", DunningOptions{}), map[string]string{})
+	pay(debtor, 3000)
+	expect("2026-06-02", run("2026-06-02", DunningOptions{}), map[string]string{
+		debtor.Email: "resolved",
+	})
+	if open, _ := d.Queries.ListOpenDunningNotices(ctx); len(open) != 0 {
+		t.Errorf("open notices after payment %+v", open)
+	}
+	if recent, _ := d.Queries.ListRecentDunningNotices(ctx, 50); len(recent) != 5 {
+		t.Errorf("%d notices in history, want 5", len(recent))
+	}
+}
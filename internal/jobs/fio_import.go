@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/fio"
+	"github.com/base48/member-portal/internal/payments"
+)
+
+// FIOImportResult is the result of importing a downloaded statement file
+type FIOImportResult struct {
+	FIOSyncResult
+	Filename string
+	Format   fio.FileFormat
+	DryRun   bool
+}
+
+// ImportFIOStatement imports payments from a statement exported from FIO
+// internet banking (GPC/ABO, CSV or CAMT.053 XML). Transactions go through the
+// same matching as the API sync and are stored with kind 'fio' and the bank's
+// transaction ID, so importing a period that was already synced (or importing
+// the same file twice) creates no duplicates.
+//
+// With dryRun nothing is written, the outcomes show what the import would do.
+func ImportFIOStatement(ctx context.Context, d *Deps, logger *log.Logger, filename string, data []byte, dryRun bool, importedBy sql.NullInt64) (*FIOImportResult, error) {
+	src, err := payments.NewFIOStatementSource(filename, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		logger.Printf("[DRY RUN] Checking %s (%s)...", filename, src.Format)
+	} else {
+		logger.Printf("Importing %s (%s)...", filename, src.Format)
+	}
+
+	res, err := payments.Ingest(ctx, d.Queries, logger, src, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FIOImportResult{
+		FIOSyncResult: FIOSyncResult{Result: *res, Mode: "import"},
+		Filename:      filename,
+		Format:        src.Format,
+		DryRun:        dryRun,
+	}
+	if dryRun {
+		result.Mode = "dry-run"
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	level := "success"
+	if result.Errors > 0 {
+		level = "warning"
+	} else if result.Unmatched() > 0 {
+		level = "info"
+	}
+	metadata, _ := json.Marshal(struct {
+		Filename     string `json:"filename"`
+		Format       string `json:"format"`
+		Transactions int    `json:"transactions"`
+		Inserted     int    `json:"inserted"`
+		Updated      int    `json:"updated"`
+		Skipped      int    `json:"skipped"`
+		Unmatched    int    `json:"unmatched"`
+		Errors       int    `json:"errors"`
+	}{filename, string(result.Format), result.Fetched, result.Inserted, result.Updated, result.Skipped, result.Unmatched(), result.Errors})
+	d.Queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "fio_import",
+		Level:     level,
+		UserID:    importedBy,
+		Message:   fmt.Sprintf("FIO statement %s imported: %d new, %d updated, %d unmatched", filename, result.Inserted, result.Updated, result.Unmatched()),
+		Metadata:  sql.NullString{String: string(metadata), Valid: true},
+	})
+
+	if result.Errors > 0 {
+		return result, fmt.Errorf("import completed with %d errors", result.Errors)
+	}
+
+	return result, nil
+}
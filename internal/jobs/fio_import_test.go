@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/payments"
+)
+
+func TestImportFIOStatement(t *testing.T) {
+	for _, file := range []string{"statement.gpc", "statement.csv", "statement.xml"} {
+		t.Run(file, func(t *testing.T) {
+			d, _ := newTestDeps(t)
+			ctx := context.Background()
+
+			createTestUser(t, d, "novak@example.com", "1001")
+			createTestUser(t, d, "svobodova@example.com", "1002")
+
+			data, err := os.ReadFile(filepath.Join("..", "fio", "testdata", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Dry run writes nothing
+			result, err := ImportFIOStatement(ctx, d, testLogger(), file, data, true, sql.NullInt64{})
+			if err != nil {
+				t.Fatalf("dry run: %v", err)
+			}
+			if result.Inserted != 6 || result.Skipped != 2 || len(result.Outcomes) != 8 {
+				t.Errorf("dry run: got %s (skipped %d, %d outcomes)", result.Summary(), result.Skipped, len(result.Outcomes))
+			}
+			if result.Outcomes[0].Action != payments.ActionInsert || !result.Outcomes[0].UserID.Valid {
+				t.Errorf("dry run: first outcome = %+v, want a matched insert", result.Outcomes[0])
+			}
+			if unassigned, _ := d.Queries.ListUnassignedPayments(ctx); len(unassigned) != 0 {
+				t.Errorf("dry run stored %d payments", len(unassigned))
+			}
+
+			result, err = ImportFIOStatement(ctx, d, testLogger(), file, data, false, sql.NullInt64{})
+			if err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			if result.Inserted != 6 || result.Unmatched() != 2 {
+				t.Errorf("import: got %s", result.Summary())
+			}
+
+			// The same transactions synced from the API are already there
+			synced, err := SyncFIOPayments(ctx, d, testLogger(), FIOSyncOptions{
+				From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+			})
+			if err != nil {
+				t.Fatalf("sync: %v", err)
+			}
+			if synced.Inserted != 0 || synced.Updated != 0 {
+				t.Errorf("sync after import: got %s, want no changes", synced.Summary())
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/payments"
+	"github.com/base48/member-portal/internal/scheduler"
+)
+
+// DefaultBackfillWindowDays is the date range fetched by one API request in
+// backfill mode
+const DefaultBackfillWindowDays = payments.DefaultBackfillWindowDays
+
+// FIOSyncOptions selects what the FIO sync fetches. With zero options only new
+// transactions since the stored cursor are fetched (incremental mode).
+type FIOSyncOptions struct {
+	// Backfill mode: fetch [From, To] by date, split into windows of
+	// WindowDays. The cursor is not changed.
+	From       time.Time
+	To         time.Time
+	WindowDays int
+}
+
+// Backfill reports whether the options select a date range
+func (o FIOSyncOptions) Backfill() bool {
+	return !o.From.IsZero()
+}
+
+// FIOSyncResult summarizes a FIO sync run
+type FIOSyncResult struct {
+	payments.Result
+	Mode       string // "incremental", "initial" or "backfill"
+	CursorFrom int64  // Cursor before the run (incremental mode)
+	CursorTo   int64  // Cursor after the run (incremental mode)
+}
+
+// Summary returns a one-line description of the result
+func (r *FIOSyncResult) Summary() string {
+	return fmt.Sprintf("%s: %d fetched, %d new, %d updated, %d unmatched, %d errors",
+		r.Mode, r.Fetched, r.Inserted, r.Updated, r.Unmatched(), r.Errors)
+}
+
+// FIOSyncJob returns the fio_sync job with the given options
+func FIOSyncJob(d *Deps, opts FIOSyncOptions) scheduler.Job {
+	return scheduler.Job{
+		Name:        JobFIOSync,
+		Description: "Stažení nových plateb z FIO banky a párování podle VS",
+		Schedule:    d.Config.ScheduleFIOSync,
+		Run: func(ctx context.Context, logger *log.Logger) (string, error) {
+			result, err := SyncFIOPayments(ctx, d, logger, opts)
+			if result == nil {
+				return "", err
+			}
+			return result.Summary(), err
+		},
+	}
+}
+
+// SyncFIOPayments fetches transactions from the FIO Bank API and stores
+// incoming payments, matching them to users by variable symbol (payments_id).
+//
+// By default it continues from the ID stored in sync_cursors (see
+// payments.FIOSource). The cursor only moves forward if all transactions were
+// stored, so a failed run is retried by the next one.
+func SyncFIOPayments(ctx context.Context, d *Deps, logger *log.Logger, opts FIOSyncOptions) (*FIOSyncResult, error) {
+	if d.Config.BankFIOToken == "" {
+		return nil, fmt.Errorf("BANK_FIO_TOKEN is required")
+	}
+
+	src := &payments.FIOSource{
+		Client:     d.FIO,
+		Queries:    d.Queries,
+		From:       opts.From,
+		To:         opts.To,
+		WindowDays: opts.WindowDays,
+	}
+
+	res, err := payments.Ingest(ctx, d.Queries, logger, src, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FIOSyncResult{
+		Result:     *res,
+		Mode:       src.Mode,
+		CursorFrom: src.CursorFrom,
+		CursorTo:   src.CursorTo,
+	}
+
+	// Log FIO sync completion
+	level := "success"
+	if result.Errors > 0 {
+		level = "warning"
+	} else if result.Unmatched() > 0 {
+		level = "info"
+	}
+	d.Queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "fio_sync",
+		Level:     level,
+		UserID:    sql.NullInt64{},
+		Message:   fmt.Sprintf("FIO sync (%s) completed: %d new, %d updated, %d unmatched", result.Mode, result.Inserted, result.Updated, result.Unmatched()),
+		Metadata:  sql.NullString{String: fmt.Sprintf(`{"mode":"%s","cursor_from":%d,"cursor_to":%d,"fetched":%d,"inserted":%d,"updated":%d,"skipped":%d,"unmatched":%d,"errors":%d}`, result.Mode, result.CursorFrom, result.CursorTo, result.Fetched, result.Inserted, result.Updated, result.Skipped, result.Unmatched(), result.Errors), Valid: true},
+	})
+
+	if result.Errors > 0 {
+		return result, fmt.Errorf("job completed with %d errors", result.Errors)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,280 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/fio"
+	"github.com/base48/member-portal/internal/fio/fiotest"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/payments"
+)
+
+const testFIOToken = "test-token"
+
+// newTestDeps creates a migrated temporary database and a FIO client talking
+// to a fake server with the default fixture
+func newTestDeps(t *testing.T) (*Deps, *fiotest.Server) {
+	t.Helper()
+
+	database := dbtest.Open(t)
+
+	srv := fiotest.NewServer(testFIOToken)
+	t.Cleanup(srv.Close)
+
+	d := &Deps{
+		Config:  &config.Config{BankFIOToken: testFIOToken},
+		Queries: db.New(database),
+		FIO:     fio.NewClient(testFIOToken, fio.WithBaseURL(srv.URL), fio.WithRequestInterval(0)),
+	}
+	return d, srv
+}
+
+// withEmail sends the emails of the jobs through an in-memory transport. The
+// test runs from the repository root to load the email templates.
+func withEmail(t *testing.T, d *Deps) *email.MemoryTransport {
+	t.Helper()
+	t.Chdir("../..")
+
+	d.Config.SMTPFrom = "Base48 <noreply@example.com>"
+	d.Config.EmailMaxAttempts = 1
+	sent := &email.MemoryTransport{}
+	d.Email = email.New(d.Config, d.Queries, email.WithTransport(sent))
+	return sent
+}
+
+// deliverEmails delivers the queued emails and returns them as "recipient:
+// subject", forgetting them in the transport
+func deliverEmails(t *testing.T, d *Deps, sent *email.MemoryTransport) []string {
+	t.Helper()
+	if result, err := d.Email.Deliver(context.Background(), time.Now()); err != nil || result.Retried+result.Failed > 0 {
+		t.Fatalf("deliver emails: %+v, %v", result, err)
+	}
+	var delivered []string
+	for _, m := range sent.Messages() {
+		delivered = append(delivered, strings.Join(m.To, ",")+": "+m.Subject())
+	}
+	sent.Reset()
+	sort.Strings(delivered)
+	return delivered
+}
+
+func createTestUser(t *testing.T, d *Deps, email, paymentsID string) db.User {
+	t.Helper()
+	user, err := d.Queries.CreateUser(context.Background(), db.CreateUserParams{
+		Email:             email,
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: paymentsID, Valid: true},
+		State:             "accepted",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func userBalance(t *testing.T, d *Deps, user db.User) money.Amount {
+	t.Helper()
+	balance, err := d.Queries.GetUserBalance(context.Background(), db.GetUserBalanceParams{
+		UserID:   sql.NullInt64{Int64: user.ID, Valid: true},
+		UserID_2: user.ID,
+	})
+	if err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	return money.FromHalere(balance)
+}
+
+func testLogger() *log.Logger {
+	return log.New(io.Discard, "", 0)
+}
+
+func TestSyncFIOPaymentsIncremental(t *testing.T) {
+	d, srv := newTestDeps(t)
+	ctx := context.Background()
+
+	novak := createTestUser(t, d, "novak@example.com", "1001")
+	svobodova := createTestUser(t, d, "svobodova@example.com", "1002")
+
+	// Start from the beginning of the account history
+	if _, err := d.Queries.SetSyncCursor(ctx, db.SetSyncCursorParams{Name: payments.FIOCursorName, LastID: 0}); err != nil {
+		t.Fatalf("set cursor: %v", err)
+	}
+
+	steps := []struct {
+		name       string
+		before     func()
+		wantMode   string
+		wantResult payments.Result
+		wantCursor int64
+	}{
+		{
+			name:     "full history",
+			wantMode: "incremental",
+			wantResult: payments.Result{
+				Fetched:  8,
+				Inserted: 6,
+				Skipped:  2,
+			},
+			wantCursor: 26000000008,
+		},
+		{
+			name:       "nothing new",
+			wantMode:   "incremental",
+			wantResult: payments.Result{},
+			wantCursor: 26000000008,
+		},
+		{
+			name: "new payment after rate limit",
+			before: func() {
+				srv.AddTransaction(fiotest.Transaction{
+					ID:             26000000009,
+					Date:           time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+					Amount:         1000,
+					AccountNumber:  "2100123456",
+					AccountName:    "NOVAK JAN",
+					BankCode:       "2010",
+					VariableSymbol: "1001",
+				})
+				srv.RateLimitNext(1)
+			},
+			wantMode: "incremental",
+			wantResult: payments.Result{
+				Fetched:  1,
+				Inserted: 1,
+			},
+			wantCursor: 26000000009,
+		},
+	}
+
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+
+		result, err := SyncFIOPayments(ctx, d, testLogger(), FIOSyncOptions{})
+		if err != nil {
+			t.Fatalf("%s: SyncFIOPayments: %v", step.name, err)
+		}
+
+		if result.Mode != step.wantMode {
+			t.Errorf("%s: Mode = %q, want %q", step.name, result.Mode, step.wantMode)
+		}
+		if result.Fetched != step.wantResult.Fetched || result.Inserted != step.wantResult.Inserted ||
+			result.Updated != step.wantResult.Updated || result.Skipped != step.wantResult.Skipped ||
+			result.Errors != 0 {
+			t.Errorf("%s: got %s (skipped %d), want %d fetched, %d new, %d updated, %d skipped",
+				step.name, result.Summary(), result.Skipped,
+				step.wantResult.Fetched, step.wantResult.Inserted, step.wantResult.Updated, step.wantResult.Skipped)
+		}
+
+		cursor, err := d.Queries.GetSyncCursor(ctx, payments.FIOCursorName)
+		if err != nil {
+			t.Fatalf("%s: get cursor: %v", step.name, err)
+		}
+		if cursor.LastID != step.wantCursor {
+			t.Errorf("%s: cursor = %d, want %d", step.name, cursor.LastID, step.wantCursor)
+		}
+	}
+
+	// 1000 (VS) + 1000 (VS in message) + 1000 (new payment)
+	if got, want := userBalance(t, d, novak), money.FromKoruny(3000); got != want {
+		t.Errorf("novak balance = %s, want %s", got, want)
+	}
+	// 500.50 (numeric VS) + 333.33
+	if got, want := userBalance(t, d, svobodova), money.MustParse("833.83"); got != want {
+		t.Errorf("svobodova balance = %s, want %s", got, want)
+	}
+
+	unassigned, err := d.Queries.ListUnassignedPayments(ctx)
+	if err != nil {
+		t.Fatalf("list unassigned: %v", err)
+	}
+	if len(unassigned) != 2 {
+		t.Errorf("got %d unassigned payments, want 2 (unknown VS, empty VS)", len(unassigned))
+	}
+}
+
+func TestSyncFIOPaymentsInitialRun(t *testing.T) {
+	d, srv := newTestDeps(t)
+	ctx := context.Background()
+
+	// Only transactions from the last 90 days are fetched on the first run
+	srv.AddTransaction(fiotest.Transaction{
+		ID:             27000000001,
+		Date:           time.Now().AddDate(0, 0, -3),
+		Amount:         200,
+		VariableSymbol: "1001",
+	})
+
+	result, err := SyncFIOPayments(ctx, d, testLogger(), FIOSyncOptions{})
+	if err != nil {
+		t.Fatalf("SyncFIOPayments: %v", err)
+	}
+	if result.Mode != "initial" || result.Fetched != 1 || result.Inserted != 1 {
+		t.Errorf("got %s, want initial run with 1 new payment", result.Summary())
+	}
+
+	cursor, err := d.Queries.GetSyncCursor(ctx, payments.FIOCursorName)
+	if err != nil {
+		t.Fatalf("get cursor: %v", err)
+	}
+	if cursor.LastID != 27000000001 {
+		t.Errorf("cursor = %d, want 27000000001", cursor.LastID)
+	}
+}
+
+func TestSyncFIOPaymentsBackfill(t *testing.T) {
+	d, srv := newTestDeps(t)
+	ctx := context.Background()
+
+	createTestUser(t, d, "novak@example.com", "1001")
+	createTestUser(t, d, "svobodova@example.com", "1002")
+
+	opts := FIOSyncOptions{
+		From:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:         time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+		WindowDays: 30,
+	}
+
+	result, err := SyncFIOPayments(ctx, d, testLogger(), opts)
+	if err != nil {
+		t.Fatalf("SyncFIOPayments: %v", err)
+	}
+	if result.Mode != "backfill" || result.Fetched != 8 || result.Inserted != 6 || result.Skipped != 2 {
+		t.Errorf("got %s (skipped %d), want 8 fetched, 6 new, 2 skipped", result.Summary(), result.Skipped)
+	}
+	if len(result.UnmatchedVS) != 1 || len(result.EmptyVS) != 1 {
+		t.Errorf("got %d unmatched and %d empty VS, want 1 and 1", len(result.UnmatchedVS), len(result.EmptyVS))
+	}
+
+	// 121 days in windows of 30
+	if got := len(srv.Requests()); got != 5 {
+		t.Errorf("server saw %d requests, want 5: %v", got, srv.Requests())
+	}
+
+	// Backfill does not touch the cursor
+	if _, err := d.Queries.GetSyncCursor(ctx, payments.FIOCursorName); err != sql.ErrNoRows {
+		t.Errorf("GetSyncCursor err = %v, want sql.ErrNoRows", err)
+	}
+
+	// Running it again does not duplicate payments
+	result, err = SyncFIOPayments(ctx, d, testLogger(), opts)
+	if err != nil {
+		t.Fatalf("SyncFIOPayments (second run): %v", err)
+	}
+	if result.Inserted != 0 || result.Updated != 0 || result.Skipped != 8 {
+		t.Errorf("second run: got %s (skipped %d), want everything skipped", result.Summary(), result.Skipped)
+	}
+}
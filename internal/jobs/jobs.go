@@ -0,0 +1,139 @@
+// Package jobs contains the periodic tasks of the portal (FIO sync, monthly
+// fees, debt status, debt suspension, dunning, unmatched payments report).
+// They are run by the in-process scheduler and by the thin CLI wrappers in
+// cmd/cron.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/base48/member-portal/internal/auth"
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/fio"
+	"github.com/base48/member-portal/internal/keycloak"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/scheduler"
+)
+
+// Job names used in job_runs and on /admin/jobs
+const (
+	JobFIOSync         = "fio_sync"
+	JobMonthlyFees     = "monthly_fees"
+	JobDebtStatus      = "debt_status"
+	JobUnmatchedReport = "unmatched_report"
+	JobDebtSuspension  = "debt_suspension"
+	JobDunning         = "dunning"
+)
+
+// Deps holds the dependencies shared by all jobs
+type Deps struct {
+	Config  *config.Config
+	Queries *db.Queries
+	Email   *email.Client
+	FIO     *fio.Client
+	Effects membership.Effector // Effects of membership state changes
+
+	// Keycloak returns an admin API client of the service account
+	Keycloak func(ctx context.Context) (*keycloak.Client, error)
+}
+
+// NewDeps creates job dependencies from the config and queries
+func NewDeps(cfg *config.Config, queries *db.Queries) *Deps {
+	emailClient := email.New(cfg, queries)
+	return &Deps{
+		Config:  cfg,
+		Queries: queries,
+		Email:   emailClient,
+		FIO:     fio.NewClient(cfg.BankFIOToken, fio.WithBaseURL(cfg.BankFIOAPIURL)),
+		Effects: &membership.ServiceEffector{
+			Config: cfg,
+			Email:  emailClient,
+			Token:  serviceAccountToken(cfg),
+		},
+		Keycloak: serviceAccountKeycloak(cfg),
+	}
+}
+
+// newServiceAccount authenticates the service account, which fails when the
+// account is not configured
+func newServiceAccount(ctx context.Context, cfg *config.Config) (*auth.ServiceAccountClient, error) {
+	if cfg.KeycloakServiceAccountClientID == "" || cfg.KeycloakServiceAccountClientSecret == "" {
+		return nil, fmt.Errorf("KEYCLOAK_SERVICE_ACCOUNT_CLIENT_ID and KEYCLOAK_SERVICE_ACCOUNT_CLIENT_SECRET are required")
+	}
+	client, err := auth.NewServiceAccountClient(ctx, cfg, cfg.KeycloakServiceAccountClientID, cfg.KeycloakServiceAccountClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service account: %w", err)
+	}
+	return client, nil
+}
+
+// serviceAccountToken returns a function getting a Keycloak access token of
+// the service account
+func serviceAccountToken(cfg *config.Config) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		client, err := newServiceAccount(ctx, cfg)
+		if err != nil {
+			return "", err
+		}
+		return client.GetAccessToken(ctx)
+	}
+}
+
+// serviceAccountKeycloak returns a function creating a Keycloak admin client
+// of the service account. The client refreshes the token when it expires.
+func serviceAccountKeycloak(cfg *config.Config) func(ctx context.Context) (*keycloak.Client, error) {
+	return func(ctx context.Context) (*keycloak.Client, error) {
+		client, err := newServiceAccount(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return keycloak.NewClientWithTokenSource(cfg, client), nil
+	}
+}
+
+// Register adds all jobs to the scheduler using the schedules from the config
+func Register(s *scheduler.Scheduler, d *Deps) error {
+	jobs := []scheduler.Job{
+		FIOSyncJob(d, FIOSyncOptions{}),
+		MonthlyFeesJob(d, MonthlyFeesOptions{}),
+		DebtStatusJob(d, DebtStatusOptions{}),
+		DunningJob(d, DunningOptions{}),
+		{
+			Name:        JobDebtSuspension,
+			Description: "Pozastavení členství při dlouhodobém dluhu",
+			Schedule:    d.Config.ScheduleDebtSuspension,
+			Run: func(ctx context.Context, logger *log.Logger) (string, error) {
+				result, err := SuspendDebtors(ctx, d, logger, time.Now())
+				if result == nil {
+					return "", err
+				}
+				return result.Summary(), err
+			},
+		},
+		{
+			Name:        JobUnmatchedReport,
+			Description: "Report nespárovaných plateb",
+			Schedule:    d.Config.ScheduleUnmatchedReport,
+			Run: func(ctx context.Context, logger *log.Logger) (string, error) {
+				report, err := FindUnmatchedPayments(ctx, d)
+				if err != nil {
+					return "", err
+				}
+				report.Print(logger.Writer())
+				return report.Summary(), nil
+			},
+		},
+	}
+
+	for _, job := range jobs {
+		if err := s.Register(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/fees"
+	"github.com/base48/member-portal/internal/levels"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/scheduler"
+)
+
+// MonthlyFeesOptions selects the periods to bill. With zero options the
+// current period is billed, and with FEES_CATCHUP_FROM set also every period
+// a member missed since then (catch-up).
+type MonthlyFeesOptions struct {
+	From   time.Time // First period; zero for the current one or the catch-up
+	To     time.Time // Last period; zero for the current one
+	DryRun bool      // Only report what would be created
+}
+
+// CatchUp reports whether the first period is left to the catch-up config
+func (o MonthlyFeesOptions) CatchUp() bool {
+	return o.From.IsZero()
+}
+
+// FeeLine is a fee created (or in a dry run, to be created) by the run
+type FeeLine struct {
+	UserID     int64
+	Email      string
+	Period     time.Time
+	LevelID    int64 // Level in effect in the period
+	Amount     money.Amount
+	Days       int   // Days of the period the member was accepted
+	PeriodDays int   // Days of the period
+	FeeID      int64 // Zero in a dry run
+}
+
+// Prorated reports whether the fee is for a part of the period only
+func (l FeeLine) Prorated() bool {
+	return l.Days < l.PeriodDays
+}
+
+// MonthlyFeesResult summarizes a monthly fees run
+type MonthlyFeesResult struct {
+	From     time.Time // First period billed (the earliest catch-up period)
+	To       time.Time
+	DryRun   bool
+	Users    int
+	Created  int
+	Prorated int
+	Skipped  int // Fee for the period already exists
+	Errors   int
+	Fees     []FeeLine
+}
+
+// Periods describes the billed periods, e.g. "2024-03" or "2024-01..2024-03"
+func (r *MonthlyFeesResult) Periods() string {
+	if r.From.Equal(r.To) {
+		return r.To.Format("2006-01")
+	}
+	return r.From.Format("2006-01") + ".." + r.To.Format("2006-01")
+}
+
+// Summary returns a one-line description of the result
+func (r *MonthlyFeesResult) Summary() string {
+	if r.DryRun {
+		return fmt.Sprintf("dry run %s: %d would be created (%d prorated), %d skipped",
+			r.Periods(), r.Created, r.Prorated, r.Skipped)
+	}
+	return fmt.Sprintf("%s: %d created (%d prorated), %d skipped, %d errors",
+		r.Periods(), r.Created, r.Prorated, r.Skipped, r.Errors)
+}
+
+// CurrentPeriod returns the first day of the current month
+func CurrentPeriod() time.Time {
+	return fees.PeriodOf(time.Now())
+}
+
+// MonthlyFeesJob returns the monthly_fees job with the given options
+func MonthlyFeesJob(d *Deps, opts MonthlyFeesOptions) scheduler.Job {
+	return scheduler.Job{
+		Name:        JobMonthlyFees,
+		Description: "Vytvoření měsíčních poplatků pro všechny aktivní členy (a zmeškaných měsíců od FEES_CATCHUP_FROM)",
+		Schedule:    d.Config.ScheduleMonthlyFees,
+		Run: func(ctx context.Context, logger *log.Logger) (string, error) {
+			result, err := CreateMonthlyFees(ctx, d, logger, opts)
+			if result == nil {
+				return "", err
+			}
+			return result.Summary(), err
+		},
+	}
+}
+
+// CreateMonthlyFees creates the fees of the selected periods. Members in debt
+// are reminded by the dunning job, not here.
+//
+// A member owes the fee of a period for the days they were accepted in it
+// (see fees.Timeline): nothing before date_joined or while suspended, and a
+// prorated fee for the month they were accepted or suspended in. The fee is
+// that of the level in effect in the period (membership_level_history), so a
+// level change does not reprice past periods. Periods that already have a
+// fee are skipped, so the job can be run again for any range.
+//
+// Level changes members asked for and scheduled level price changes are
+// written to the member record and the level once they take effect (not in a
+// dry run).
+//
+// The catch-up goes back to the member's date_joined, but not before
+// FEES_CATCHUP_FROM. It is off unless configured: members imported from the
+// old system have gaps in their fee history that are not debts.
+func CreateMonthlyFees(ctx context.Context, d *Deps, logger *log.Logger, opts MonthlyFeesOptions) (*MonthlyFeesResult, error) {
+	to := opts.To
+	if to.IsZero() {
+		to = CurrentPeriod()
+	}
+	to = fees.PeriodOf(to)
+
+	from := fees.PeriodOf(opts.From)
+	if opts.CatchUp() {
+		var err error
+		if from, err = billingStart(d, to); err != nil {
+			return nil, err
+		}
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("first period %s is after the last period %s", from.Format("2006-01"), to.Format("2006-01"))
+	}
+
+	result := &MonthlyFeesResult{From: from, To: to, DryRun: opts.DryRun}
+
+	if opts.DryRun {
+		logger.Printf("[DRY RUN] Checking fees for periods: %s", result.Periods())
+	} else {
+		logger.Printf("Creating fees for periods: %s", result.Periods())
+	}
+
+	users, err := d.Queries.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	// Level prices that changed by now
+	if !opts.DryRun {
+		applied, err := levels.ApplyDuePriceChanges(ctx, d.Queries, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range applied {
+			logger.Printf("  ✓ Price of level %d changed from %s to %s", c.LevelID, c.OldAmount.Format(), c.NewAmount.Format())
+		}
+	}
+
+	allLevels, err := d.Queries.ListAllLevels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list levels: %w", err)
+	}
+	levelByID := make(map[int64]db.Level, len(allLevels))
+	for _, l := range allLevels {
+		levelByID[l.ID] = l
+	}
+	priceChanges, err := d.Queries.ListLevelPriceChanges(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list level price changes: %w", err)
+	}
+
+	logger.Printf("Processing %d members...", len(users))
+
+	result.Users = len(users)
+
+	for _, user := range users {
+		history, err := d.Queries.ListStateHistoryByUser(ctx, user.ID)
+		if err != nil {
+			logger.Printf("  ✗ Failed to load state history of %s: %v", user.Email, err)
+			result.Errors++
+			continue
+		}
+		timeline := fees.NewTimeline(user, history)
+
+		levelHistory, err := d.Queries.ListLevelHistoryByUser(ctx, user.ID)
+		if err != nil {
+			logger.Printf("  ✗ Failed to load level history of %s: %v", user.Email, err)
+			result.Errors++
+			continue
+		}
+		if !opts.DryRun {
+			updated, applied, err := membership.ApplyDueLevelChange(ctx, d.Queries, user, levelHistory, time.Now())
+			if err != nil {
+				logger.Printf("  ✗ Failed to apply level change of %s: %v", user.Email, err)
+				result.Errors++
+			} else if applied {
+				logger.Printf("  ✓ Level of %s changed to %d (%s)", user.Email, updated.LevelID, updated.LevelActualAmount.Format())
+				user = updated
+			}
+		}
+
+		existing, err := d.Queries.ListFeesByUser(ctx, user.ID)
+		if err != nil {
+			logger.Printf("  ✗ Failed to load fees of %s: %v", user.Email, err)
+			result.Errors++
+			continue
+		}
+		billed := make(map[string]bool, len(existing))
+		for _, f := range existing {
+			billed[f.PeriodStart.Format("2006-01")] = true
+		}
+
+		periods := fees.Periods(from, to)
+		if opts.CatchUp() {
+			if joined := fees.PeriodOf(user.DateJoined); joined.After(from) {
+				periods = fees.Periods(joined, to)
+			}
+		}
+
+		for _, period := range periods {
+			days := timeline.AcceptedDays(period)
+			if days == 0 {
+				continue
+			}
+			if billed[period.Format("2006-01")] {
+				result.Skipped++
+				continue
+			}
+
+			// Určíme částku - level_actual_amount platný v období, fallback na cenu úrovně v období
+			levelID, feeAmount := timeline.LevelOf(user, levelHistory, period)
+			if feeAmount.IsZero() {
+				feeAmount = membership.PriceOn(levelByID[levelID], priceChanges, period)
+			}
+
+			line := FeeLine{
+				UserID:     user.ID,
+				Email:      user.Email,
+				Period:     period,
+				LevelID:    levelID,
+				Amount:     fees.Prorate(feeAmount, days, period),
+				Days:       days,
+				PeriodDays: fees.DaysIn(period),
+			}
+			if line.Amount.IsZero() {
+				continue
+			}
+
+			if !opts.DryRun {
+				fee, err := d.Queries.CreateFee(ctx, db.CreateFeeParams{
+					UserID:      user.ID,
+					LevelID:     levelID,
+					PeriodStart: period,
+					Amount:      line.Amount,
+				})
+				if err != nil {
+					logger.Printf("  ✗ Failed to create fee %s for %s: %v", period.Format("2006-01"), user.Email, err)
+					result.Errors++
+					continue
+				}
+				line.FeeID = fee.ID
+				logger.Printf("  ✓ Created fee %s for %s: %s (%d/%d days, fee_id: %d)",
+					period.Format("2006-01"), user.Email, line.Amount.Format(), line.Days, line.PeriodDays, fee.ID)
+			}
+
+			result.Fees = append(result.Fees, line)
+			result.Created++
+			if line.Prorated() {
+				result.Prorated++
+			}
+		}
+	}
+
+	logger.Printf("Summary:")
+	logger.Printf("  Periods: %s", result.Periods())
+	logger.Printf("  Members: %d", result.Users)
+	logger.Printf("  Created: %d (prorated: %d)", result.Created, result.Prorated)
+	logger.Printf("  Skipped (already exists): %d", result.Skipped)
+	logger.Printf("  Errors: %d", result.Errors)
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// Log cron job completion
+	level := "success"
+	if result.Errors > 0 {
+		level = "warning"
+	}
+	d.Queries.CreateLog(ctx, db.CreateLogParams{
+		Subsystem: "cron",
+		Level:     level,
+		UserID:    sql.NullInt64{},
+		Message:   fmt.Sprintf("Monthly fees created for %s: %d fees (%d prorated)", result.Periods(), result.Created, result.Prorated),
+		Metadata:  sql.NullString{String: fmt.Sprintf(`{"from":"%s","to":"%s","created":%d,"prorated":%d,"skipped":%d,"errors":%d}`, from.Format("2006-01"), to.Format("2006-01"), result.Created, result.Prorated, result.Skipped, result.Errors), Valid: true},
+	})
+
+	if result.Errors > 0 {
+		return result, fmt.Errorf("job completed with %d errors", result.Errors)
+	}
+
+	return result, nil
+}
+
+// billingStart returns the first period billed without an explicit range:
+// FEES_CATCHUP_FROM, or only to when the catch-up is not configured
+func billingStart(d *Deps, to time.Time) (time.Time, error) {
+	if d.Config.FeesCatchUpFrom == "" {
+		return to, nil
+	}
+	start, err := time.Parse("2006-01", d.Config.FeesCatchUpFrom)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid FEES_CATCHUP_FROM '%s' (use YYYY-MM)", d.Config.FeesCatchUpFrom)
+	}
+	if start.After(to) {
+		return to, nil
+	}
+	return start, nil
+}
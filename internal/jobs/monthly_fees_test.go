@@ -0,0 +1,220 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/fees"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestCreateMonthlyFees(t *testing.T) {
+	d, _ := newTestDeps(t)
+	sent := withEmail(t, d)
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+
+	// Members join today (date_joined is set by the database)
+	now := time.Now().UTC()
+	thisMonth := fees.PeriodOf(now)
+	nextMonth := thisMonth.AddDate(0, 1, 0)
+	lastMonth := thisMonth.AddDate(0, 2, 0)
+
+	member := createTestUser(t, d, "clen@example.com", "1001")
+	suspended := createTestUser(t, d, "pozastaveny@example.com", "1002")
+	if _, _, _, err := membership.Transit(ctx, d.Queries, &fakeEffector{}, suspended, membership.StateSuspended, 0, ""); err != nil {
+		t.Fatalf("suspend: %v", err)
+	}
+
+	memberFees := func() []string {
+		t.Helper()
+		list, err := d.Queries.ListFeesByUser(ctx, member.ID)
+		if err != nil {
+			t.Fatalf("list fees: %v", err)
+		}
+		var periods []string
+		for _, f := range list {
+			periods = append(periods, f.PeriodStart.Format("2006-01")+"="+f.Amount.String())
+		}
+		return periods
+	}
+
+	// Only the current month, prorated from today
+	result, err := CreateMonthlyFees(ctx, d, logger, MonthlyFeesOptions{To: thisMonth})
+	if err != nil {
+		t.Fatalf("CreateMonthlyFees: %v", err)
+	}
+	firstFee := fees.Prorate(money.FromKoruny(1000), fees.DaysIn(now)-now.Day()+1, thisMonth)
+	if result.Created != 1 || len(result.Fees) != 1 || result.Fees[0].Amount != firstFee || result.Fees[0].UserID != member.ID {
+		t.Fatalf("first run: %+v", result)
+	}
+	if want := now.Day() > 1; result.Fees[0].Prorated() != want || (result.Prorated == 1) != want {
+		t.Errorf("first fee prorated = %v, want %v", result.Fees[0].Prorated(), want)
+	}
+
+	// The next two months were missed and the catch-up is on; a dry run
+	// reports them without writing
+	d.Config.FeesCatchUpFrom = thisMonth.Format("2006-01")
+	result, err = CreateMonthlyFees(ctx, d, logger, MonthlyFeesOptions{To: lastMonth, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if result.Created != 2 || result.Skipped != 1 || result.Fees[0].FeeID != 0 || !result.From.Equal(thisMonth) {
+		t.Errorf("dry run: %+v", result)
+	}
+	if got := memberFees(); len(got) != 1 {
+		t.Errorf("dry run wrote fees: %v", got)
+	}
+
+	result, err = CreateMonthlyFees(ctx, d, logger, MonthlyFeesOptions{To: lastMonth})
+	if err != nil {
+		t.Fatalf("catch-up: %v", err)
+	}
+	if result.Created != 2 || result.Skipped != 1 || result.Prorated != 0 {
+		t.Errorf("catch-up: %+v", result)
+	}
+	want := []string{
+		lastMonth.Format("2006-01") + "=1000",
+		nextMonth.Format("2006-01") + "=1000",
+		thisMonth.Format("2006-01") + "=" + firstFee.String(),
+	}
+	if got := memberFees(); len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("fees %v, want %v", got, want)
+	}
+
+	// An explicit period that is billed already creates nothing
+	result, err = CreateMonthlyFees(ctx, d, logger, MonthlyFeesOptions{From: nextMonth, To: nextMonth})
+	if err != nil || result.Created != 0 || result.Skipped != 1 || result.Periods() != nextMonth.Format("2006-01") {
+		t.Errorf("rerun: %+v, %v", result, err)
+	}
+
+	// No fees while suspended
+	if list, _ := d.Queries.ListFeesByUser(ctx, suspended.ID); len(list) != 0 {
+		t.Errorf("suspended member has %d fees", len(list))
+	}
+
+	// Fees are not announced, members in debt are reminded by the dunning job
+	if got := deliverEmails(t, d, sent); len(got) != 0 {
+		t.Errorf("monthly fees sent %q", got)
+	}
+
+	d.Config.FeesCatchUpFrom = "2024-13"
+	if _, err := CreateMonthlyFees(ctx, d, logger, MonthlyFeesOptions{}); err == nil {
+		t.Error("invalid FEES_CATCHUP_FROM accepted")
+	}
+}
+
+func TestCreateMonthlyFeesImportedMember(t *testing.T) {
+	database := dbtest.Open(t)
+	d := &Deps{Config: &config.Config{}, Queries: db.New(database)}
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+
+	thisMonth := fees.PeriodOf(time.Now().UTC())
+	month := func(offset int) time.Time { return thisMonth.AddDate(0, offset, 0) }
+
+	// Imported from the old system: joined two years ago, with fees of some
+	// months only
+	member := createTestUser(t, d, "clen@example.com", "1001")
+	if _, err := database.Exec(`UPDATE users SET date_joined = ? WHERE id = ?`, month(-24).Format("2006-01-02 15:04:05"), member.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range []int{-24, -12, -2} {
+		if _, err := d.Queries.CreateFee(ctx, db.CreateFeeParams{UserID: member.ID, LevelID: 1, PeriodStart: month(offset), Amount: money.FromKoruny(1000)}); err != nil {
+			t.Fatalf("create fee: %v", err)
+		}
+	}
+	periods := func(result *MonthlyFeesResult) []string {
+		var list []string
+		for _, f := range result.Fees {
+			list = append(list, f.Period.Format("2006-01"))
+		}
+		return list
+	}
+
+	// Without FEES_CATCHUP_FROM the gaps are not billed
+	result, err := CreateMonthlyFees(ctx, d, logger, MonthlyFeesOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("CreateMonthlyFees: %v", err)
+	}
+	if got := periods(result); len(got) != 1 || got[0] != thisMonth.Format("2006-01") || !result.From.Equal(thisMonth) {
+		t.Errorf("default run bills %v from %s", got, result.From.Format("2006-01"))
+	}
+
+	// With it, only the gaps since then
+	d.Config.FeesCatchUpFrom = month(-3).Format("2006-01")
+	result, err = CreateMonthlyFees(ctx, d, logger, MonthlyFeesOptions{})
+	if err != nil {
+		t.Fatalf("CreateMonthlyFees: %v", err)
+	}
+	want := []string{month(-3).Format("2006-01"), month(-1).Format("2006-01"), thisMonth.Format("2006-01")}
+	if got := periods(result); len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || result.Skipped != 1 {
+		t.Errorf("catch-up bills %v (%d skipped), want %v", got, result.Skipped, want)
+	}
+	if list, _ := d.Queries.ListFeesByUser(ctx, member.ID); len(list) != 6 {
+		t.Errorf("member has %d fees, want 6", len(list))
+	}
+}
+
+func TestCreateMonthlyFeesLevelHistory(t *testing.T) {
+	d, _ := newTestDeps(t)
+	withEmail(t, d)
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+
+	now := time.Now().UTC()
+	thisMonth := fees.PeriodOf(now)
+	nextMonth := thisMonth.AddDate(0, 1, 0)
+
+	// Joins today as a Student
+	member := createTestUser(t, d, "clen@example.com", "1001")
+	if _, err := d.Queries.UpdateUserLevel(ctx, db.UpdateUserLevelParams{LevelID: 2, LevelActualAmount: money.Zero, ID: member.ID}); err != nil {
+		t.Fatalf("set level: %v", err)
+	}
+	member, _ = d.Queries.GetUserByID(ctx, member.ID)
+	if _, err := d.Queries.CreateLevelHistory(ctx, db.CreateLevelHistoryParams{
+		UserID:        member.ID,
+		LevelID:       2,
+		EffectiveFrom: thisMonth.AddDate(-1, 0, 0),
+	}); err != nil {
+		t.Fatalf("create level history: %v", err)
+	}
+
+	// Supporter with an own fee from next month
+	if _, err := membership.RequestLevelChange(ctx, d.Queries, member, membership.LevelChange{LevelID: 4, LevelActualAmount: money.FromKoruny(2500)}, now); err != nil {
+		t.Fatalf("RequestLevelChange: %v", err)
+	}
+
+	result, err := CreateMonthlyFees(ctx, d, logger, MonthlyFeesOptions{From: thisMonth, To: nextMonth, DryRun: true})
+	if err != nil {
+		t.Fatalf("CreateMonthlyFees: %v", err)
+	}
+	var got []string
+	for _, f := range result.Fees {
+		got = append(got, fmt.Sprintf("%s=%d:%s", f.Period.Format("2006-01"), f.LevelID, f.Amount))
+	}
+	first := fees.Prorate(money.FromKoruny(600), fees.DaysIn(now)-now.Day()+1, thisMonth)
+	want := []string{
+		fmt.Sprintf("%s=2:%s", thisMonth.Format("2006-01"), first),
+		nextMonth.Format("2006-01") + "=4:2500",
+	}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("fees %v, want %v", got, want)
+	}
+
+	// The pending change is not applied to the member record before it takes effect
+	if _, err := CreateMonthlyFees(ctx, d, logger, MonthlyFeesOptions{From: thisMonth, To: thisMonth}); err != nil {
+		t.Fatalf("CreateMonthlyFees: %v", err)
+	}
+	if current, _ := d.Queries.GetUserByID(ctx, member.ID); current.LevelID != 2 {
+		t.Errorf("level changed to %d before next month", current.LevelID)
+	}
+}
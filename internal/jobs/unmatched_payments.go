@@ -0,0 +1,195 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// Categories of unmatched payments
+const (
+	UnmatchedEmptyVS      = "empty_vs"
+	UnmatchedInvalidVS    = "invalid_vs"
+	UnmatchedUserNotFound = "user_not_found"
+	UnmatchedSyncBug      = "sync_bug"
+)
+
+// UnmatchedPayment is an unassigned payment together with the reason why it
+// was not matched to a user
+type UnmatchedPayment struct {
+	Payment    db.Payment
+	VSAsUserID int64
+	UserExists bool
+	Category   string
+	Reason     string
+}
+
+// UnmatchedReport lists payments that are not assigned to any user
+type UnmatchedReport struct {
+	Unassigned  int
+	Problematic []UnmatchedPayment
+	TotalAmount money.Amount
+}
+
+// Summary returns a one-line description of the report
+func (r *UnmatchedReport) Summary() string {
+	return fmt.Sprintf("%d unassigned, %d problematic (%s)",
+		r.Unassigned, len(r.Problematic), r.TotalAmount.Format())
+}
+
+// FindUnmatchedPayments analyzes all unassigned payments
+func FindUnmatchedPayments(ctx context.Context, d *Deps) (*UnmatchedReport, error) {
+	unassignedPayments, err := d.Queries.ListUnassignedPayments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unassigned payments: %w", err)
+	}
+
+	report := &UnmatchedReport{Unassigned: len(unassignedPayments)}
+
+	for _, payment := range unassignedPayments {
+		// Skip if no identification (VS)
+		if payment.Identification == "" {
+			report.add(UnmatchedPayment{
+				Payment:  payment,
+				Category: UnmatchedEmptyVS,
+				Reason:   "Empty variable symbol",
+			})
+			continue
+		}
+
+		// Try to parse VS as user ID
+		vsAsID, err := strconv.ParseInt(payment.Identification, 10, 64)
+		if err != nil {
+			report.add(UnmatchedPayment{
+				Payment:  payment,
+				Category: UnmatchedInvalidVS,
+				Reason:   fmt.Sprintf("VS '%s' is not a valid user ID", payment.Identification),
+			})
+			continue
+		}
+
+		// Check if user with this ID exists
+		_, err = d.Queries.GetUserByID(ctx, vsAsID)
+		if err == sql.ErrNoRows {
+			report.add(UnmatchedPayment{
+				Payment:    payment,
+				VSAsUserID: vsAsID,
+				UserExists: false,
+				Category:   UnmatchedUserNotFound,
+				Reason:     fmt.Sprintf("User ID %d does not exist", vsAsID),
+			})
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("error checking user %d: %w", vsAsID, err)
+		}
+
+		// If we get here, user exists but payment is not assigned - this is suspicious
+		report.add(UnmatchedPayment{
+			Payment:    payment,
+			VSAsUserID: vsAsID,
+			UserExists: true,
+			Category:   UnmatchedSyncBug,
+			Reason:     fmt.Sprintf("User ID %d EXISTS but payment not assigned (sync bug?)", vsAsID),
+		})
+	}
+
+	return report, nil
+}
+
+func (r *UnmatchedReport) add(p UnmatchedPayment) {
+	r.Problematic = append(r.Problematic, p)
+	r.TotalAmount += p.Payment.Amount
+}
+
+// ByCategory returns the problematic payments of one category
+func (r *UnmatchedReport) ByCategory(category string) []UnmatchedPayment {
+	var list []UnmatchedPayment
+	for _, p := range r.Problematic {
+		if p.Category == category {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// Print writes the report as plain text tables
+func (r *UnmatchedReport) Print(w io.Writer) {
+	fmt.Fprintln(w, "\n"+strings.Repeat("=", 120))
+	fmt.Fprintln(w, "UNMATCHED PAYMENTS REPORT")
+	fmt.Fprintln(w, strings.Repeat("=", 120))
+	fmt.Fprintf(w, "\nTotal unassigned payments: %d\n", r.Unassigned)
+	fmt.Fprintf(w, "Problematic payments: %d\n", len(r.Problematic))
+	fmt.Fprintf(w, "Total unmatched amount: %s\n\n", r.TotalAmount.Format())
+
+	if len(r.Problematic) == 0 {
+		fmt.Fprintln(w, "✓ No problematic payments found!")
+		return
+	}
+
+	sections := []struct {
+		category string
+		title    string
+	}{
+		{UnmatchedEmptyVS, "📝 PAYMENTS WITH EMPTY VARIABLE SYMBOL:"},
+		{UnmatchedInvalidVS, "⚠ PAYMENTS WITH INVALID VARIABLE SYMBOL (not a number):"},
+		{UnmatchedUserNotFound, "❌ PAYMENTS WITH VS POINTING TO NON-EXISTENT USER:"},
+		{UnmatchedSyncBug, "🐛 PAYMENTS WITH VALID USER BUT NOT ASSIGNED (POTENTIAL SYNC BUG):"},
+	}
+
+	for _, section := range sections {
+		payments := r.ByCategory(section.category)
+		if len(payments) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(w, "\n"+section.title)
+		fmt.Fprintln(w, strings.Repeat("-", 120))
+		printPaymentTable(w, payments)
+
+		if section.category == UnmatchedSyncBug {
+			fmt.Fprintln(w, "\n⚠️  These payments should be automatically assigned! Run sync again or investigate.")
+		}
+	}
+
+	fmt.Fprintln(w, "\n"+strings.Repeat("=", 120))
+	fmt.Fprintln(w, "\n💡 Next steps:")
+	fmt.Fprintln(w, "  1. For payments with valid VS but non-existent users: Check if user should be imported")
+	fmt.Fprintln(w, "  2. For payments with empty/invalid VS: Manually assign via admin interface")
+	fmt.Fprintln(w, "  3. For sync bugs: Re-run FIO sync or investigate the matching logic")
+	fmt.Fprintln(w)
+}
+
+func printPaymentTable(w io.Writer, payments []UnmatchedPayment) {
+	fmt.Fprintf(w, "%-8s %-12s %-12s %-12s %-30s %-10s %s\n",
+		"ID", "Date", "Amount", "Kind", "Remote Account", "VS", "Reason")
+	fmt.Fprintln(w, strings.Repeat("-", 120))
+
+	for _, p := range payments {
+		dateStr := p.Payment.Date.Format("2006-01-02")
+		remoteAcc := p.Payment.RemoteAccount
+		if len(remoteAcc) > 28 {
+			remoteAcc = remoteAcc[:28] + ".."
+		}
+
+		reason := p.Reason
+		if len(reason) > 40 {
+			reason = reason[:40] + "..."
+		}
+
+		fmt.Fprintf(w, "%-8d %-12s %10s CZK %-12s %-30s %-10s %s\n",
+			p.Payment.ID,
+			dateStr,
+			p.Payment.Amount,
+			p.Payment.Kind,
+			remoteAcc,
+			p.Payment.Identification,
+			reason,
+		)
+	}
+}
@@ -6,16 +6,35 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/base48/member-portal/internal/config"
 )
 
 // Client wraps Keycloak Admin API calls
 type Client struct {
-	config      *config.Config
-	adminToken  string
-	httpClient  *http.Client
+	config     *config.Config
+	tokens     TokenSource
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	roles map[string]*Role // Realm roles by name, looked up once per client
+}
+
+// TokenSource provides the admin access token for each request. The service
+// account client (auth.ServiceAccountClient) refreshes an expired token, so a
+// long run does not fail halfway.
+type TokenSource interface {
+	GetAccessToken(ctx context.Context) (string, error)
+}
+
+// staticToken is a TokenSource of a single token
+type staticToken string
+
+func (t staticToken) GetAccessToken(ctx context.Context) (string, error) {
+	return string(t), nil
 }
 
 // Role represents a Keycloak role
@@ -28,15 +47,46 @@ type Role struct {
 	ContainerID string `json:"containerId"`
 }
 
-// NewClient creates a new Keycloak admin client
+// User represents a Keycloak user
+type User struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Enabled   bool   `json:"enabled"`
+}
+
+// roleUsersPageSize is the number of users fetched per request of GetRoleUsers
+const roleUsersPageSize = 100
+
+// NewClient creates a new Keycloak admin client using a single access token
 func NewClient(cfg *config.Config, adminToken string) *Client {
+	return NewClientWithTokenSource(cfg, staticToken(adminToken))
+}
+
+// NewClientWithTokenSource creates a new Keycloak admin client that gets the
+// access token from tokens before every request
+func NewClientWithTokenSource(cfg *config.Config, tokens TokenSource) *Client {
 	return &Client{
 		config:     cfg,
-		adminToken: adminToken,
+		tokens:     tokens,
 		httpClient: &http.Client{},
+		roles:      make(map[string]*Role),
 	}
 }
 
+// authorize sets the headers of an admin API request
+func (c *Client) authorize(ctx context.Context, req *http.Request) error {
+	token, err := c.tokens.GetAccessToken(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	return nil
+}
+
 // GetRealmRoles returns all realm roles
 func (c *Client) GetRealmRoles(ctx context.Context) ([]Role, error) {
 	url := fmt.Sprintf("%s/admin/realms/%s/roles", c.config.KeycloakURL, c.config.KeycloakRealm)
@@ -46,8 +96,9 @@ func (c *Client) GetRealmRoles(ctx context.Context) ([]Role, error) {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.adminToken)
-	req.Header.Set("Content-Type", "application/json")
+	if err := c.authorize(ctx, req); err != nil {
+		return nil, err
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -68,8 +119,16 @@ func (c *Client) GetRealmRoles(ctx context.Context) ([]Role, error) {
 	return roles, nil
 }
 
-// GetRoleByName gets a specific realm role by name
+// GetRoleByName gets a specific realm role by name. Roles are cached by the
+// client, assigning a role to many users looks it up once.
 func (c *Client) GetRoleByName(ctx context.Context, roleName string) (*Role, error) {
+	c.mu.Lock()
+	cached, ok := c.roles[roleName]
+	c.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
 	url := fmt.Sprintf("%s/admin/realms/%s/roles/%s", c.config.KeycloakURL, c.config.KeycloakRealm, roleName)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -77,8 +136,9 @@ func (c *Client) GetRoleByName(ctx context.Context, roleName string) (*Role, err
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.adminToken)
-	req.Header.Set("Content-Type", "application/json")
+	if err := c.authorize(ctx, req); err != nil {
+		return nil, err
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -96,6 +156,10 @@ func (c *Client) GetRoleByName(ctx context.Context, roleName string) (*Role, err
 		return nil, err
 	}
 
+	c.mu.Lock()
+	c.roles[roleName] = &role
+	c.mu.Unlock()
+
 	return &role, nil
 }
 
@@ -109,8 +173,9 @@ func (c *Client) GetUserRoles(ctx context.Context, userID string) ([]Role, error
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.adminToken)
-	req.Header.Set("Content-Type", "application/json")
+	if err := c.authorize(ctx, req); err != nil {
+		return nil, err
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -154,8 +219,9 @@ func (c *Client) AssignRoleToUser(ctx context.Context, userID, roleName string)
 		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.adminToken)
-	req.Header.Set("Content-Type", "application/json")
+	if err := c.authorize(ctx, req); err != nil {
+		return err
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -194,8 +260,9 @@ func (c *Client) RemoveRoleFromUser(ctx context.Context, userID, roleName string
 		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.adminToken)
-	req.Header.Set("Content-Type", "application/json")
+	if err := c.authorize(ctx, req); err != nil {
+		return err
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -226,3 +293,45 @@ func (c *Client) UserHasRole(ctx context.Context, userID, roleName string) (bool
 
 	return false, nil
 }
+
+// GetRoleUsers returns all users with a realm role, fetched in pages, so the
+// role members of the whole realm take a few requests instead of one per user
+func (c *Client) GetRoleUsers(ctx context.Context, roleName string) ([]User, error) {
+	var users []User
+	for first := 0; ; first += roleUsersPageSize {
+		endpoint := fmt.Sprintf("%s/admin/realms/%s/roles/%s/users?first=%d&max=%d",
+			c.config.KeycloakURL, c.config.KeycloakRealm, url.PathEscape(roleName), first, roleUsersPageSize)
+
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.authorize(ctx, req); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to get users of role %s: %s - %s", roleName, resp.Status, string(body))
+		}
+
+		var page []User
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, page...)
+		if len(page) < roleUsersPageSize {
+			return users, nil
+		}
+	}
+}
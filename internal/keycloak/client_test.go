@@ -0,0 +1,85 @@
+package keycloak_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/keycloak"
+	"github.com/base48/member-portal/internal/keycloak/keycloaktest"
+)
+
+func TestGetRoleUsersPages(t *testing.T) {
+	srv := keycloaktest.NewServer("base48", "in_debt")
+	defer srv.Close()
+	for i := 0; i < 250; i++ {
+		id := fmt.Sprintf("user-%03d", i)
+		srv.AddUser(id, id+"@example.com")
+		srv.Grant(id, "in_debt")
+	}
+
+	client := keycloak.NewClientWithTokenSource(&config.Config{KeycloakURL: srv.URL, KeycloakRealm: "base48"}, srv.Tokens())
+	users, err := client.GetRoleUsers(context.Background(), "in_debt")
+	if err != nil {
+		t.Fatalf("GetRoleUsers: %v", err)
+	}
+	if len(users) != 250 || users[0].ID != "user-000" || users[249].Email != "user-249@example.com" {
+		t.Errorf("got %d users", len(users))
+	}
+	if requests := srv.Requests(); len(requests) != 3 {
+		t.Errorf("%d requests, want 3 pages: %v", len(requests), requests)
+	}
+
+	if _, err := client.GetRoleUsers(context.Background(), "missing"); err == nil {
+		t.Error("members of a missing role")
+	}
+}
+
+func TestAssignRoleCachesRoleAndRefreshesToken(t *testing.T) {
+	srv := keycloaktest.NewServer("base48", "active_member")
+	defer srv.Close()
+	for _, id := range []string{"a", "b", "c"} {
+		srv.AddUser(id, id+"@example.com")
+	}
+	srv.ExpireTokensAfter(2)
+
+	ctx := context.Background()
+	cfg := &config.Config{KeycloakURL: srv.URL, KeycloakRealm: "base48"}
+
+	client := keycloak.NewClientWithTokenSource(cfg, srv.Tokens())
+	for _, id := range []string{"a", "b", "c"} {
+		if err := client.AssignRoleToUser(ctx, id, "active_member"); err != nil {
+			t.Fatalf("assign %s: %v", id, err)
+		}
+		if !srv.HasRole(id, "active_member") {
+			t.Errorf("%s has no role", id)
+		}
+	}
+
+	lookups := 0
+	for _, r := range srv.Requests() {
+		if strings.HasSuffix(r, "/roles/active_member") {
+			lookups++
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("role looked up %d times, want once", lookups)
+	}
+	if srv.IssuedTokens() < 2 {
+		t.Errorf("%d tokens issued, the expired one was not refreshed", srv.IssuedTokens())
+	}
+
+	// A single token stops working once it expires
+	static := keycloak.NewClient(cfg, srv.Token())
+	var err error
+	for _, id := range []string{"a", "b", "c"} {
+		if err = static.RemoveRoleFromUser(ctx, id, "active_member"); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Error("expired token accepted")
+	}
+}
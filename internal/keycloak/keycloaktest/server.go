@@ -0,0 +1,241 @@
+// Package keycloaktest provides a fake Keycloak Admin API server for tests.
+// It serves the realm role endpoints the portal uses (role lookup, paged role
+// members, realm role mappings of a user) and issues access tokens that
+// expire after a number of requests, like real tokens expire during a long
+// run.
+//
+// Usage:
+//
+//	srv := keycloaktest.NewServer("base48", "in_debt", "active_member")
+//	defer srv.Close()
+//	cfg := &config.Config{KeycloakURL: srv.URL, KeycloakRealm: "base48"}
+//	client := keycloak.NewClientWithTokenSource(cfg, srv.Tokens())
+package keycloaktest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/base48/member-portal/internal/keycloak"
+)
+
+// Server is a fake Keycloak Admin API of a single realm
+type Server struct {
+	*httptest.Server
+
+	Realm string
+
+	mu        sync.Mutex
+	roles     map[string]keycloak.Role
+	users     map[string]keycloak.User
+	mappings  map[string]map[string]bool // Role name -> user IDs
+	tokens    map[string]int             // Token -> requests left, -1 for unlimited
+	issued    int
+	tokenUses int
+	requests  []string
+}
+
+// NewServer starts a fake server of the realm with the given realm roles
+func NewServer(realm string, roles ...string) *Server {
+	s := &Server{
+		Realm:    realm,
+		roles:    make(map[string]keycloak.Role),
+		users:    make(map[string]keycloak.User),
+		mappings: make(map[string]map[string]bool),
+		tokens:   make(map[string]int),
+	}
+	for _, name := range roles {
+		s.roles[name] = keycloak.Role{ID: "role-" + name, Name: name, ContainerID: realm}
+		s.mappings[name] = make(map[string]bool)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// AddUser adds a user to the realm
+func (s *Server) AddUser(id, email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[id] = keycloak.User{ID: id, Username: email, Email: email, Enabled: true}
+}
+
+// Grant assigns a realm role to a user directly, without an API request
+func (s *Server) Grant(userID, role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mappings[role][userID] = true
+}
+
+// HasRole reports whether the user has the realm role
+func (s *Server) HasRole(userID, role string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mappings[role][userID]
+}
+
+// ExpireTokensAfter makes tokens issued from now on valid for n requests
+// only; zero means tokens never expire
+func (s *Server) ExpireTokensAfter(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenUses = n
+}
+
+// IssuedTokens returns the number of access tokens issued so far
+func (s *Server) IssuedTokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued
+}
+
+// Requests returns the method and path of all requests received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Tokens returns a token source that refreshes expired tokens, like the
+// service account client does
+func (s *Server) Tokens() keycloak.TokenSource {
+	return &tokenSource{server: s}
+}
+
+// Token issues a new access token
+func (s *Server) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.issued++
+	token := fmt.Sprintf("token-%d", s.issued)
+	s.tokens[token] = -1
+	if s.tokenUses > 0 {
+		s.tokens[token] = s.tokenUses
+	}
+	return token
+}
+
+// tokenSource keeps a token until the server stops accepting it
+type tokenSource struct {
+	server *Server
+	token  string
+}
+
+func (t *tokenSource) GetAccessToken(ctx context.Context) (string, error) {
+	t.server.mu.Lock()
+	left := t.server.tokens[t.token]
+	t.server.mu.Unlock()
+	if left == 0 {
+		t.token = t.server.Token()
+	}
+	return t.token, nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	left := s.tokens[token]
+	if left == 0 {
+		http.Error(w, `{"error":"HTTP 401 Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	if left > 0 {
+		s.tokens[token] = left - 1
+	}
+
+	// /admin/realms/{realm}/...
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 || parts[0] != "admin" || parts[1] != "realms" || parts[2] != s.Realm {
+		http.NotFound(w, r)
+		return
+	}
+	parts = parts[3:]
+
+	switch {
+	case len(parts) == 2 && parts[0] == "roles" && r.Method == http.MethodGet:
+		role, ok := s.roles[parts[1]]
+		if !ok {
+			http.Error(w, `{"error":"Could not find role"}`, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, role)
+
+	case len(parts) == 3 && parts[0] == "roles" && parts[2] == "users" && r.Method == http.MethodGet:
+		members, ok := s.mappings[parts[1]]
+		if !ok {
+			http.Error(w, `{"error":"Could not find role"}`, http.StatusNotFound)
+			return
+		}
+		var ids []string
+		for id := range members {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		first, _ := strconv.Atoi(r.URL.Query().Get("first"))
+		max, err := strconv.Atoi(r.URL.Query().Get("max"))
+		if err != nil {
+			max = 100
+		}
+		page := []keycloak.User{}
+		for i := first; i < len(ids) && i < first+max; i++ {
+			page = append(page, s.users[ids[i]])
+		}
+		writeJSON(w, page)
+
+	case len(parts) == 4 && parts[0] == "users" && parts[2] == "role-mappings" && parts[3] == "realm":
+		userID := parts[1]
+		if _, ok := s.users[userID]; !ok {
+			http.Error(w, `{"error":"User not found"}`, http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			roles := []keycloak.Role{}
+			for name, members := range s.mappings {
+				if members[userID] {
+					roles = append(roles, s.roles[name])
+				}
+			}
+			writeJSON(w, roles)
+		case http.MethodPost, http.MethodDelete:
+			var roles []keycloak.Role
+			if err := json.NewDecoder(r.Body).Decode(&roles); err != nil {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			for _, role := range roles {
+				if _, ok := s.roles[role.Name]; !ok {
+					http.Error(w, `{"error":"Role not found"}`, http.StatusNotFound)
+					return
+				}
+				if r.Method == http.MethodPost {
+					s.mappings[role.Name][userID] = true
+				} else {
+					delete(s.mappings[role.Name], userID)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,311 @@
+// Package levels manages the membership levels: creating and editing them,
+// refusing to deactivate a level that is still in use, and price changes
+// scheduled from a given month that move the members paying less than the
+// new price to it.
+package levels
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// ErrInUse is returned when deactivating a level members still use
+var ErrInUse = errors.New("level is still in use")
+
+// Form is a new level or an edit of one
+type Form struct {
+	Name   string
+	Amount money.Amount
+	Active bool
+}
+
+// Validate checks and normalizes the form
+func (f *Form) Validate() error {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if f.Amount.IsNegative() {
+		return fmt.Errorf("amount cannot be negative")
+	}
+	if f.Amount != f.Amount.RoundKoruny() {
+		return fmt.Errorf("amount must be in whole crowns")
+	}
+	return nil
+}
+
+// Create stores a new level
+func Create(ctx context.Context, queries *db.Queries, f Form) (db.Level, error) {
+	if err := f.Validate(); err != nil {
+		return db.Level{}, err
+	}
+	level, err := queries.CreateLevel(ctx, db.CreateLevelParams{
+		Name:   f.Name,
+		Amount: f.Amount,
+		Active: f.Active,
+	})
+	if err != nil {
+		return db.Level{}, fmt.Errorf("failed to create level: %w", err)
+	}
+	return level, nil
+}
+
+// Usage is what keeps a level from being deactivated
+type Usage struct {
+	Members             int // Accepted or suspended members on the level
+	PendingChanges      int // Level changes to the level that take effect later
+	PendingApplications int // Applications for the level waiting for a decision
+}
+
+// InUse reports whether anything still uses the level
+func (u Usage) InUse() bool {
+	return u.Members > 0 || u.PendingChanges > 0 || u.PendingApplications > 0
+}
+
+// String describes the usage in Czech, e.g. for an error shown to the admin
+func (u Usage) String() string {
+	var parts []string
+	if u.Members > 0 {
+		parts = append(parts, fmt.Sprintf("členů: %d", u.Members))
+	}
+	if u.PendingChanges > 0 {
+		parts = append(parts, fmt.Sprintf("čekajících změn úrovně: %d", u.PendingChanges))
+	}
+	if u.PendingApplications > 0 {
+		parts = append(parts, fmt.Sprintf("čekajících přihlášek: %d", u.PendingApplications))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// UsageOf returns what uses the level now
+func UsageOf(ctx context.Context, queries *db.Queries, levelID int64, now time.Time) (Usage, error) {
+	var usage Usage
+
+	counts, err := queries.CountMembersByLevel(ctx)
+	if err != nil {
+		return usage, fmt.Errorf("failed to count members: %w", err)
+	}
+	for _, c := range counts {
+		if c.LevelID == levelID {
+			usage.Members = int(c.Members)
+		}
+	}
+
+	history, err := queries.ListLevelHistoryByLevel(ctx, levelID)
+	if err != nil {
+		return usage, fmt.Errorf("failed to load level history: %w", err)
+	}
+	usage.PendingChanges = len(membership.PendingLevelChanges(history, now))
+
+	applications, err := queries.ListApplicationsByStatus(ctx, membership.ApplicationPending)
+	if err != nil {
+		return usage, fmt.Errorf("failed to load applications: %w", err)
+	}
+	for _, a := range applications {
+		if a.LevelID == levelID {
+			usage.PendingApplications++
+		}
+	}
+
+	return usage, nil
+}
+
+// Update stores an edit of the level. The amount can only be changed this way
+// while nobody is on the level, otherwise a price change has to be scheduled.
+// A level in use cannot be deactivated (ErrInUse).
+func Update(ctx context.Context, queries *db.Queries, current db.Level, f Form, now time.Time) (db.Level, error) {
+	if err := f.Validate(); err != nil {
+		return db.Level{}, err
+	}
+
+	if current.ID == membership.AwaitingLevelID && (!f.Active || f.Amount != current.Amount) {
+		return db.Level{}, fmt.Errorf("the awaiting level cannot be deactivated or priced")
+	}
+
+	if (!f.Active && current.Active) || f.Amount != current.Amount {
+		usage, err := UsageOf(ctx, queries, current.ID, now)
+		if err != nil {
+			return db.Level{}, err
+		}
+		if !f.Active && current.Active && usage.InUse() {
+			return db.Level{}, fmt.Errorf("%w (%s)", ErrInUse, usage)
+		}
+		if f.Amount != current.Amount && usage.Members > 0 {
+			return db.Level{}, fmt.Errorf("level has %d members, schedule a price change instead", usage.Members)
+		}
+	}
+
+	level, err := queries.UpdateLevel(ctx, db.UpdateLevelParams{
+		Name:   f.Name,
+		Amount: f.Amount,
+		Active: f.Active,
+		ID:     current.ID,
+	})
+	if err != nil {
+		return db.Level{}, fmt.Errorf("failed to update level: %w", err)
+	}
+	return level, nil
+}
+
+// Affected is a member whose fee a price change raises or lowers
+type Affected struct {
+	Member db.User
+	OldFee money.Amount
+	NewFee money.Amount
+}
+
+// PricePlan is a price change ready to be scheduled, with the members it
+// affects
+type PricePlan struct {
+	Level     db.Level
+	OldAmount money.Amount // Price before the change
+	NewAmount money.Amount
+	From      time.Time // First day of the month the price applies
+	Affected  []Affected
+}
+
+// PlanPriceChange works out a change of the level's price from the month
+// containing from, which has to be a future month (billed fees never change).
+//
+// Members on the level from that month who pay its old price, or less than
+// the new one, move to the new price. Members who voluntarily pay more than
+// the new price keep their fee.
+func PlanPriceChange(ctx context.Context, queries *db.Queries, level db.Level, newAmount money.Amount, from, now time.Time) (*PricePlan, error) {
+	from = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	if level.ID == membership.AwaitingLevelID {
+		return nil, fmt.Errorf("the awaiting level has no price")
+	}
+	if newAmount.IsNegative() || newAmount != newAmount.RoundKoruny() {
+		return nil, fmt.Errorf("price must be whole crowns, not negative")
+	}
+	if from.Before(membership.NextPeriod(now)) {
+		return nil, fmt.Errorf("price can change from next month at the earliest")
+	}
+
+	changes, err := queries.ListLevelPriceChanges(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load price changes: %w", err)
+	}
+	for _, c := range changes {
+		if c.LevelID == level.ID && !c.EffectiveFrom.Before(from) {
+			return nil, fmt.Errorf("a price change from %s is already scheduled", c.EffectiveFrom.Format("2006-01"))
+		}
+	}
+
+	plan := &PricePlan{
+		Level:     level,
+		OldAmount: membership.PriceOn(level, changes, from.AddDate(0, 0, -1)),
+		NewAmount: newAmount,
+		From:      from,
+	}
+	if plan.OldAmount == newAmount {
+		return nil, fmt.Errorf("the price is %s already", newAmount.Format())
+	}
+
+	users, err := queries.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	for _, u := range users {
+		if u.State != membership.StateAccepted && u.State != membership.StateSuspended {
+			continue
+		}
+		history, err := queries.ListLevelHistoryByUser(ctx, u.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load level history of %s: %w", u.Email, err)
+		}
+		levelID, fee := membership.LevelOn(u, history, from)
+		if levelID != level.ID {
+			continue
+		}
+		if fee.IsZero() {
+			fee = plan.OldAmount
+		}
+		if fee != plan.OldAmount && fee >= newAmount {
+			continue // Pays voluntarily more than the new price
+		}
+		plan.Affected = append(plan.Affected, Affected{Member: u, OldFee: fee, NewFee: newAmount})
+	}
+	sort.Slice(plan.Affected, func(i, j int) bool {
+		return plan.Affected[i].Member.Email < plan.Affected[j].Member.Email
+	})
+
+	return plan, nil
+}
+
+// SchedulePriceChange stores the plan: the price change and, for every
+// affected member, the new fee in their level history from the plan's month.
+// The level's amount itself changes once the month comes (ApplyDuePriceChanges).
+func SchedulePriceChange(ctx context.Context, queries *db.Queries, plan *PricePlan, createdBy int64) (db.LevelPriceChange, error) {
+	change, err := queries.CreateLevelPriceChange(ctx, db.CreateLevelPriceChangeParams{
+		LevelID:         plan.Level.ID,
+		OldAmount:       plan.OldAmount,
+		NewAmount:       plan.NewAmount,
+		EffectiveFrom:   plan.From,
+		MembersAffected: int64(len(plan.Affected)),
+		CreatedBy:       sql.NullInt64{Int64: createdBy, Valid: createdBy != 0},
+	})
+	if err != nil {
+		return db.LevelPriceChange{}, fmt.Errorf("failed to schedule price change: %w", err)
+	}
+
+	reason := fmt.Sprintf("Změna ceny úrovně %s od %s: %s → %s",
+		plan.Level.Name, plan.From.Format("01/2006"), plan.OldAmount.Format(), plan.NewAmount.Format())
+	for _, a := range plan.Affected {
+		if _, err := queries.CreateLevelHistory(ctx, db.CreateLevelHistoryParams{
+			UserID:            a.Member.ID,
+			LevelID:           plan.Level.ID,
+			LevelActualAmount: a.NewFee,
+			EffectiveFrom:     plan.From,
+			ChangedBy:         sql.NullInt64{Int64: createdBy, Valid: createdBy != 0},
+			Reason:            sql.NullString{String: reason, Valid: true},
+		}); err != nil {
+			return change, fmt.Errorf("price change scheduled, but failed to record the new fee of %s: %w", a.Member.Email, err)
+		}
+	}
+
+	return change, nil
+}
+
+// ApplyDuePriceChanges writes the price changes that took effect by now to
+// the levels and returns them
+func ApplyDuePriceChanges(ctx context.Context, queries *db.Queries, now time.Time) ([]db.LevelPriceChange, error) {
+	changes, err := queries.ListLevelPriceChanges(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load price changes: %w", err)
+	}
+
+	var applied []db.LevelPriceChange
+	for _, c := range changes {
+		if c.AppliedAt.Valid || c.EffectiveFrom.After(now) {
+			continue
+		}
+		level, err := queries.GetLevel(ctx, c.LevelID)
+		if err != nil {
+			return applied, fmt.Errorf("failed to load level %d: %w", c.LevelID, err)
+		}
+		if _, err := queries.UpdateLevel(ctx, db.UpdateLevelParams{
+			Name:   level.Name,
+			Amount: c.NewAmount,
+			Active: level.Active,
+			ID:     level.ID,
+		}); err != nil {
+			return applied, fmt.Errorf("failed to update price of %s: %w", level.Name, err)
+		}
+		if err := queries.MarkLevelPriceChangeApplied(ctx, c.ID); err != nil {
+			return applied, fmt.Errorf("failed to mark price change %d applied: %w", c.ID, err)
+		}
+		applied = append(applied, c)
+	}
+	return applied, nil
+}
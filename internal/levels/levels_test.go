@@ -0,0 +1,177 @@
+package levels
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/membership"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func createMember(t *testing.T, queries *db.Queries, email string, levelID int64, fee money.Amount) db.User {
+	t.Helper()
+	member, err := queries.CreateUser(context.Background(), db.CreateUserParams{
+		Email:             email,
+		LevelID:           levelID,
+		LevelActualAmount: fee,
+		State:             membership.StateAccepted,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return member
+}
+
+func TestUpdate(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+	now := time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)
+
+	if _, err := Create(ctx, queries, Form{Name: "  ", Amount: money.FromKoruny(800)}); err == nil {
+		t.Error("level without a name created")
+	}
+	if _, err := Create(ctx, queries, Form{Name: "Senior", Amount: money.MustParse("800.50")}); err == nil {
+		t.Error("level with halere created")
+	}
+	level, err := Create(ctx, queries, Form{Name: " Senior ", Amount: money.FromKoruny(800), Active: true})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if level.Name != "Senior" {
+		t.Errorf("name %q not trimmed", level.Name)
+	}
+
+	member := createMember(t, queries, "novak@example.com", level.ID, money.Zero)
+
+	// In use: cannot be deactivated or repriced directly, renamed it can be
+	if _, err := Update(ctx, queries, level, Form{Name: "Senior", Amount: level.Amount}, now); !errors.Is(err, ErrInUse) {
+		t.Errorf("deactivated with a member: %v", err)
+	}
+	if _, err := Update(ctx, queries, level, Form{Name: "Senior", Amount: money.FromKoruny(900), Active: true}, now); err == nil {
+		t.Error("repriced with a member")
+	}
+	level, err = Update(ctx, queries, level, Form{Name: "Senior 65+", Amount: level.Amount, Active: true}, now)
+	if err != nil || level.Name != "Senior 65+" {
+		t.Fatalf("rename: %v, %+v", err, level)
+	}
+
+	// A member's change to the level next month still uses it
+	if _, err := queries.UpdateUserLevel(ctx, db.UpdateUserLevelParams{LevelID: 3, ID: member.ID}); err != nil {
+		t.Fatalf("move member: %v", err)
+	}
+	member, _ = queries.GetUserByID(ctx, member.ID)
+	if _, err := membership.RequestLevelChange(ctx, queries, member, membership.LevelChange{LevelID: level.ID}, now); err != nil {
+		t.Fatalf("RequestLevelChange: %v", err)
+	}
+	usage, err := UsageOf(ctx, queries, level.ID, now)
+	if err != nil || usage.Members != 0 || usage.PendingChanges != 1 {
+		t.Errorf("usage: %+v, %v", usage, err)
+	}
+	if _, err := Update(ctx, queries, level, Form{Name: level.Name, Amount: level.Amount}, now); !errors.Is(err, ErrInUse) {
+		t.Errorf("deactivated with a pending change: %v", err)
+	}
+
+	if _, err := membership.CancelLevelChange(ctx, queries, member, now); err != nil {
+		t.Fatalf("CancelLevelChange: %v", err)
+	}
+	level, err = Update(ctx, queries, level, Form{Name: level.Name, Amount: money.FromKoruny(900)}, now)
+	if err != nil || level.Active || level.Amount != money.FromKoruny(900) {
+		t.Errorf("deactivate unused level: %v, %+v", err, level)
+	}
+
+	awaiting, _ := queries.GetLevel(ctx, membership.AwaitingLevelID)
+	if _, err := Update(ctx, queries, awaiting, Form{Name: awaiting.Name, Amount: awaiting.Amount}, now); err == nil {
+		t.Error("awaiting level deactivated")
+	}
+}
+
+func TestPriceChange(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+	now := time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)
+	april := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	regular, _ := queries.GetLevel(ctx, 3) // 1000
+	levelPrice := createMember(t, queries, "a@example.com", 3, money.Zero)
+	generous := createMember(t, queries, "b@example.com", 3, money.FromKoruny(1500))
+	bitMore := createMember(t, queries, "c@example.com", 3, money.FromKoruny(1100))
+	createMember(t, queries, "student@example.com", 2, money.Zero)
+
+	if _, err := PlanPriceChange(ctx, queries, regular, money.FromKoruny(1200), now, now); err == nil {
+		t.Error("price changed in the current month")
+	}
+	if _, err := PlanPriceChange(ctx, queries, regular, money.FromKoruny(1000), april, now); err == nil {
+		t.Error("price changed to the same amount")
+	}
+
+	plan, err := PlanPriceChange(ctx, queries, regular, money.FromKoruny(1200), april.AddDate(0, 0, 14), now)
+	if err != nil {
+		t.Fatalf("PlanPriceChange: %v", err)
+	}
+	if !plan.From.Equal(april) || plan.OldAmount != money.FromKoruny(1000) {
+		t.Errorf("plan: %+v", plan)
+	}
+	if len(plan.Affected) != 2 || plan.Affected[0].Member.ID != levelPrice.ID || plan.Affected[1].Member.ID != bitMore.ID {
+		t.Fatalf("affected: %+v", plan.Affected)
+	}
+	if plan.Affected[0].OldFee != money.FromKoruny(1000) || plan.Affected[1].OldFee != money.FromKoruny(1100) {
+		t.Errorf("old fees: %+v", plan.Affected)
+	}
+
+	change, err := SchedulePriceChange(ctx, queries, plan, 0)
+	if err != nil {
+		t.Fatalf("SchedulePriceChange: %v", err)
+	}
+	if change.MembersAffected != 2 || change.AppliedAt.Valid {
+		t.Errorf("change: %+v", change)
+	}
+
+	// The new fee applies from April, the generous member keeps theirs
+	for _, m := range []db.User{levelPrice, bitMore, generous} {
+		history, _ := queries.ListLevelHistoryByUser(ctx, m.ID)
+		_, march := membership.LevelOn(m, history, now)
+		_, fee := membership.LevelOn(m, history, april)
+		want := money.FromKoruny(1200)
+		if m.ID == generous.ID {
+			want = money.FromKoruny(1500)
+		}
+		if fee != want || march != m.LevelActualAmount {
+			t.Errorf("%s: March %s, April %s, want %s", m.Email, march, fee, want)
+		}
+	}
+
+	if _, err := PlanPriceChange(ctx, queries, regular, money.FromKoruny(1300), april, now); err == nil {
+		t.Error("second change from the same month planned")
+	}
+
+	// Minimum of a member's level change follows the scheduled price
+	student, _ := queries.GetUserByEmail(ctx, "student@example.com")
+	if _, err := membership.RequestLevelChange(ctx, queries, student, membership.LevelChange{LevelID: 3, LevelActualAmount: money.FromKoruny(1000)}, now); err == nil {
+		t.Error("level change below the new price accepted")
+	}
+
+	changes, _ := queries.ListLevelPriceChanges(ctx)
+	if p := membership.PriceOn(regular, changes, now); p != money.FromKoruny(1000) {
+		t.Errorf("price in March %s", p)
+	}
+	if p := membership.PriceOn(regular, changes, april); p != money.FromKoruny(1200) {
+		t.Errorf("price in April %s", p)
+	}
+
+	if applied, err := ApplyDuePriceChanges(ctx, queries, now); err != nil || len(applied) != 0 {
+		t.Errorf("applied in March: %+v, %v", applied, err)
+	}
+	if applied, err := ApplyDuePriceChanges(ctx, queries, april); err != nil || len(applied) != 1 {
+		t.Errorf("applied in April: %+v, %v", applied, err)
+	}
+	if level, _ := queries.GetLevel(ctx, 3); level.Amount != money.FromKoruny(1200) {
+		t.Errorf("level amount %s after the change", level.Amount)
+	}
+	if applied, _ := ApplyDuePriceChanges(ctx, queries, april); len(applied) != 0 {
+		t.Error("price change applied twice")
+	}
+}
@@ -0,0 +1,212 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/vs"
+)
+
+// Application statuses (applications.status CHECK constraint)
+const (
+	ApplicationPending  = "pending"
+	ApplicationApproved = "approved"
+	ApplicationRejected = "rejected"
+)
+
+// AwaitingLevelID is the placeholder level new logins get before they apply
+// (seeded by 001_initial_schema.sql). It cannot be applied for.
+const AwaitingLevelID = 1
+
+var (
+	// ErrApplicationPending is returned when the member already has an
+	// application waiting for a decision
+	ErrApplicationPending = errors.New("an application is already waiting for a decision")
+
+	// ErrNotPending is returned when the application was decided in the meantime
+	ErrNotPending = errors.New("application is no longer pending")
+)
+
+// applicationLabels are the Czech names of the application statuses
+var applicationLabels = map[string]string{
+	ApplicationPending:  "Čeká na rozhodnutí",
+	ApplicationApproved: "Schválena",
+	ApplicationRejected: "Zamítnuta",
+}
+
+// ApplicationLabel returns the Czech name of an application status
+func ApplicationLabel(status string) string {
+	if label, ok := applicationLabels[status]; ok {
+		return label
+	}
+	return status
+}
+
+// ApplicationForm is what a registered user fills in to become a member
+type ApplicationForm struct {
+	Realname          string
+	Phone             string
+	AltContact        string
+	LevelID           int64
+	LevelActualAmount money.Amount // Zero means the level amount
+	Motivation        string
+}
+
+// Validate checks the form and returns the chosen level
+func (f *ApplicationForm) Validate(ctx context.Context, queries *db.Queries) (db.Level, error) {
+	f.Realname = strings.TrimSpace(f.Realname)
+	f.Phone = strings.TrimSpace(f.Phone)
+	f.AltContact = strings.TrimSpace(f.AltContact)
+	f.Motivation = strings.TrimSpace(f.Motivation)
+
+	if f.Realname == "" {
+		return db.Level{}, fmt.Errorf("real name is required")
+	}
+	if f.Phone == "" && f.AltContact == "" {
+		return db.Level{}, fmt.Errorf("phone or another contact is required")
+	}
+
+	level, err := queries.GetLevel(ctx, f.LevelID)
+	if err == sql.ErrNoRows || (err == nil && (!level.Active || level.ID == AwaitingLevelID)) {
+		return db.Level{}, fmt.Errorf("level %d cannot be applied for", f.LevelID)
+	} else if err != nil {
+		return db.Level{}, fmt.Errorf("failed to load level: %w", err)
+	}
+
+	if f.LevelActualAmount.IsZero() {
+		f.LevelActualAmount = level.Amount
+	}
+	if f.LevelActualAmount < level.Amount {
+		return db.Level{}, fmt.Errorf("fee cannot be lower than %s for level %s", level.Amount.Format(), level.Name)
+	}
+
+	return level, nil
+}
+
+// Submit stores the member's application and copies the contact details to
+// the member's profile. Only awaiting members can apply, one application at
+// a time.
+func Submit(ctx context.Context, queries *db.Queries, member db.User, f ApplicationForm) (db.Application, error) {
+	if member.State != StateAwaiting {
+		return db.Application{}, fmt.Errorf("only awaiting members can apply, state is %s", member.State)
+	}
+
+	if latest, err := queries.GetLatestApplicationByUser(ctx, member.ID); err == nil && latest.Status == ApplicationPending {
+		return db.Application{}, ErrApplicationPending
+	} else if err != nil && err != sql.ErrNoRows {
+		return db.Application{}, fmt.Errorf("failed to load applications: %w", err)
+	}
+
+	if _, err := f.Validate(ctx, queries); err != nil {
+		return db.Application{}, err
+	}
+
+	if _, err := queries.UpdateUserProfile(ctx, db.UpdateUserProfileParams{
+		Realname:   sql.NullString{String: f.Realname, Valid: true},
+		Phone:      sql.NullString{String: f.Phone, Valid: f.Phone != ""},
+		AltContact: sql.NullString{String: f.AltContact, Valid: f.AltContact != ""},
+		ID:         member.ID,
+	}); err != nil {
+		return db.Application{}, fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	app, err := queries.CreateApplication(ctx, db.CreateApplicationParams{
+		UserID:            member.ID,
+		Realname:          f.Realname,
+		Phone:             sql.NullString{String: f.Phone, Valid: f.Phone != ""},
+		AltContact:        sql.NullString{String: f.AltContact, Valid: f.AltContact != ""},
+		LevelID:           f.LevelID,
+		LevelActualAmount: f.LevelActualAmount,
+		Motivation:        sql.NullString{String: f.Motivation, Valid: f.Motivation != ""},
+	})
+	if err != nil {
+		return db.Application{}, fmt.Errorf("failed to create application: %w", err)
+	}
+	return app, nil
+}
+
+// Approve accepts the member: the application's level and fee are set, the
+// member gets a variable symbol from the allocator (unless they already have
+// one) and the membership starts today. The application and the member are
+// stored in one transaction, when any step fails neither changes. Side effects
+// outside the database (Keycloak role, welcome email) are left to the caller.
+func Approve(ctx context.Context, queries *db.Queries, alloc *vs.Allocator, applicationID, decidedBy int64, comment string) (db.Application, db.User, error) {
+	var app db.Application
+	var member db.User
+	err := queries.InTx(ctx, func(queries *db.Queries) error {
+		var err error
+		if app, err = decide(ctx, queries, applicationID, decidedBy, ApplicationApproved, comment); err != nil {
+			return err
+		}
+		member, err = approveMember(ctx, queries, alloc, app)
+		return err
+	})
+	if err != nil {
+		return db.Application{}, db.User{}, err
+	}
+	return app, member, nil
+}
+
+// approveMember applies an approved application to the member record
+func approveMember(ctx context.Context, queries *db.Queries, alloc *vs.Allocator, app db.Application) (db.User, error) {
+	member, err := queries.GetUserByID(ctx, app.UserID)
+	if err != nil {
+		return db.User{}, fmt.Errorf("failed to load member: %w", err)
+	}
+
+	e := editOf(member)
+	e.State = StateAccepted
+	e.LevelID = app.LevelID
+	e.LevelActualAmount = app.LevelActualAmount
+	e.ChangedBy = app.DecidedBy.Int64
+	e.Reason = fmt.Sprintf("Schválená přihláška #%d", app.ID)
+	if e.PaymentsID == "" {
+		if e.PaymentsID, err = alloc.WithQueries(queries).Next(ctx); err != nil {
+			return db.User{}, fmt.Errorf("failed to allocate variable symbol: %w", err)
+		}
+	}
+
+	if _, _, err := Apply(ctx, queries, member, e); err != nil {
+		return db.User{}, err
+	}
+
+	member, err = queries.UpdateUserDateJoined(ctx, member.ID)
+	if err != nil {
+		return db.User{}, fmt.Errorf("failed to set date joined: %w", err)
+	}
+	return member, nil
+}
+
+// Reject rejects the application. The member stays awaiting and can apply
+// again, so the comment should tell them why.
+func Reject(ctx context.Context, queries *db.Queries, applicationID, decidedBy int64, comment string) (db.Application, error) {
+	if strings.TrimSpace(comment) == "" {
+		return db.Application{}, fmt.Errorf("a comment is required when rejecting")
+	}
+	return decide(ctx, queries, applicationID, decidedBy, ApplicationRejected, comment)
+}
+
+// decide marks a pending application as approved or rejected
+func decide(ctx context.Context, queries *db.Queries, applicationID, decidedBy int64, status, comment string) (db.Application, error) {
+	comment = strings.TrimSpace(comment)
+	app, err := queries.DecideApplication(ctx, db.DecideApplicationParams{
+		Status:          status,
+		DecidedBy:       sql.NullInt64{Int64: decidedBy, Valid: decidedBy != 0},
+		DecisionComment: sql.NullString{String: comment, Valid: comment != ""},
+		ID:              applicationID,
+	})
+	if err == sql.ErrNoRows {
+		if _, getErr := queries.GetApplication(ctx, applicationID); getErr == sql.ErrNoRows {
+			return db.Application{}, fmt.Errorf("application %d does not exist", applicationID)
+		}
+		return db.Application{}, ErrNotPending
+	} else if err != nil {
+		return db.Application{}, fmt.Errorf("failed to decide application: %w", err)
+	}
+	return app, nil
+}
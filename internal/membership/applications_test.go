@@ -0,0 +1,227 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/vs"
+)
+
+func TestApplicationWorkflow(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+
+	newUser := func(email, state, paymentsID string) db.User {
+		t.Helper()
+		u, err := queries.CreateUser(ctx, db.CreateUserParams{
+			Email:             email,
+			LevelID:           AwaitingLevelID,
+			LevelActualAmount: money.Zero,
+			PaymentsID:        sql.NullString{String: paymentsID, Valid: paymentsID != ""},
+			State:             state,
+		})
+		if err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		return u
+	}
+
+	council := newUser("rada@example.com", StateAccepted, "1041")
+	applicant := newUser("novak@example.com", StateAwaiting, "")
+	if _, err := queries.CreateProject(ctx, db.CreateProjectParams{
+		Name:       "3D tiskárna",
+		PaymentsID: sql.NullString{String: "1042", Valid: true},
+	}); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	alloc := newTestAllocator(t, queries)
+	regular := levelByName(t, queries, "Regular")
+	form := ApplicationForm{
+		Realname:   " Jan Novák ",
+		Phone:      "+420 777 123 456",
+		LevelID:    regular.ID,
+		Motivation: "Elektronika a 3D tisk",
+	}
+
+	invalid := []struct {
+		name   string
+		modify func(f *ApplicationForm)
+		want   string
+	}{
+		{"no name", func(f *ApplicationForm) { f.Realname = " " }, "name is required"},
+		{"no contact", func(f *ApplicationForm) { f.Phone = "" }, "contact is required"},
+		{"awaiting level", func(f *ApplicationForm) { f.LevelID = AwaitingLevelID }, "cannot be applied for"},
+		{"low fee", func(f *ApplicationForm) { f.LevelActualAmount = money.FromKoruny(500) }, "cannot be lower"},
+	}
+	for _, tt := range invalid {
+		f := form
+		tt.modify(&f)
+		if _, err := Submit(ctx, queries, applicant, f); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want error containing %q", tt.name, err, tt.want)
+		}
+	}
+
+	app, err := Submit(ctx, queries, applicant, form)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if app.Status != ApplicationPending || app.Realname != "Jan Novák" || app.LevelActualAmount != regular.Amount {
+		t.Errorf("application: status %s, name %q, amount %s", app.Status, app.Realname, app.LevelActualAmount)
+	}
+	if _, err := Submit(ctx, queries, applicant, form); err != ErrApplicationPending {
+		t.Errorf("second application: got %v, want ErrApplicationPending", err)
+	}
+
+	// Rejection needs a reason and leaves the member awaiting
+	if _, err := Reject(ctx, queries, app.ID, council.ID, ""); err == nil {
+		t.Error("Reject without comment succeeded")
+	}
+	rejected, err := Reject(ctx, queries, app.ID, council.ID, "Doplňte prosím kontakt")
+	if err != nil {
+		t.Fatalf("Reject: %v", err)
+	}
+	if rejected.Status != ApplicationRejected || rejected.DecidedBy.Int64 != council.ID || !rejected.DecidedAt.Valid {
+		t.Errorf("rejected application: %+v", rejected)
+	}
+	if _, _, err := Approve(ctx, queries, alloc, app.ID, council.ID, ""); err != ErrNotPending {
+		t.Errorf("approving a rejected application: got %v, want ErrNotPending", err)
+	}
+
+	// The applicant applies again and is approved
+	form.LevelActualAmount = money.FromKoruny(1500)
+	app, err = Submit(ctx, queries, applicant, form)
+	if err != nil {
+		t.Fatalf("Submit again: %v", err)
+	}
+	approved, member, err := Approve(ctx, queries, alloc, app.ID, council.ID, "Vítej")
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if approved.Status != ApplicationApproved {
+		t.Errorf("application status %s", approved.Status)
+	}
+	if member.State != StateAccepted || member.LevelID != regular.ID || member.LevelActualAmount != money.FromKoruny(1500) {
+		t.Errorf("member: state %s, level %d, amount %s", member.State, member.LevelID, member.LevelActualAmount)
+	}
+	// 1042 belongs to the project
+	if member.PaymentsID.String != "1043" {
+		t.Errorf("PaymentsID = %q, want 1043", member.PaymentsID.String)
+	}
+	if member.Realname.String != "Jan Novák" || member.Phone.String != "+420 777 123 456" {
+		t.Errorf("profile not updated: %q %q", member.Realname.String, member.Phone.String)
+	}
+
+	if _, err := Submit(ctx, queries, member, form); err == nil {
+		t.Error("accepted member could apply")
+	}
+}
+
+func TestApproveRollsBack(t *testing.T) {
+	database := dbtest.Open(t)
+	queries := db.New(database)
+	ctx := context.Background()
+
+	applicant, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "novak@example.com",
+		LevelID:           AwaitingLevelID,
+		LevelActualAmount: money.Zero,
+		State:             StateAwaiting,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	app, err := Submit(ctx, queries, applicant, ApplicationForm{
+		Realname: "Jan Novák",
+		Phone:    "777123456",
+		LevelID:  levelByName(t, queries, "Student").ID,
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	// The level history fails after the member got the VS and was accepted
+	if _, err := database.Exec(`CREATE TRIGGER fail_level_history BEFORE INSERT ON membership_level_history
+		BEGIN SELECT RAISE(ABORT, 'history unavailable'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Approve(ctx, queries, newTestAllocator(t, queries), app.ID, 0, ""); err == nil || !strings.Contains(err.Error(), "history unavailable") {
+		t.Fatalf("Approve: got %v, want the history error", err)
+	}
+
+	pending, _ := queries.GetApplication(ctx, app.ID)
+	if pending.Status != ApplicationPending || pending.DecidedAt.Valid {
+		t.Errorf("application decided: %+v", pending)
+	}
+	member, _ := queries.GetUserByID(ctx, applicant.ID)
+	if member.State != StateAwaiting || member.PaymentsID.Valid || member.LevelID != AwaitingLevelID {
+		t.Errorf("member changed: %+v", member)
+	}
+
+	// Once the history works again, the application can be approved
+	if _, err := database.Exec(`DROP TRIGGER fail_level_history`); err != nil {
+		t.Fatal(err)
+	}
+	if _, member, err := Approve(ctx, queries, newTestAllocator(t, queries), app.ID, 0, ""); err != nil || member.State != StateAccepted || member.PaymentsID.String != "1000" {
+		t.Errorf("Approve after the failure: %+v, %v", member, err)
+	}
+
+	// A member rejected by an admin edit meanwhile cannot be accepted
+	other, _ := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "svoboda@example.com",
+		LevelID:           AwaitingLevelID,
+		LevelActualAmount: money.Zero,
+		State:             StateAwaiting,
+	})
+	otherApp, err := Submit(ctx, queries, other, ApplicationForm{
+		Realname: "Petr Svoboda",
+		Phone:    "777654321",
+		LevelID:  levelByName(t, queries, "Student").ID,
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if _, _, err := Apply(ctx, queries, other, Edit{
+		State:   StateRejected,
+		LevelID: other.LevelID,
+		Version: Version(other),
+	}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if _, _, err := Approve(ctx, queries, newTestAllocator(t, queries), otherApp.ID, 0, ""); err == nil || !strings.Contains(err.Error(), "cannot change state") {
+		t.Fatalf("Approve: got %v, want state transition error", err)
+	}
+	if pending, _ := queries.GetApplication(ctx, otherApp.ID); pending.Status != ApplicationPending {
+		t.Errorf("application decided: %+v", pending)
+	}
+}
+
+func levelByName(t *testing.T, queries *db.Queries, name string) db.Level {
+	t.Helper()
+	levels, err := queries.ListLevels(context.Background())
+	if err != nil {
+		t.Fatalf("list levels: %v", err)
+	}
+	for _, l := range levels {
+		if l.Name == name {
+			return l
+		}
+	}
+	t.Fatalf("level %s not found", name)
+	return db.Level{}
+}
+
+func newTestAllocator(t *testing.T, queries *db.Queries) *vs.Allocator {
+	t.Helper()
+	alloc, err := vs.New(queries, vs.Config{Scheme: vs.SchemeSequential, RangeStart: 1000, RangeEnd: 9999})
+	if err != nil {
+		t.Fatalf("vs.New: %v", err)
+	}
+	return alloc
+}
@@ -0,0 +1,256 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/dates"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/vs"
+)
+
+// ErrConflict is returned when the member was changed by someone else since
+// the edit form was loaded
+var ErrConflict = errors.New("member was changed by someone else in the meantime, reload and try again")
+
+// versionLayout formats updated_at as the concurrency token. Milliseconds
+// match the precision UpdateUser writes.
+const versionLayout = "2006-01-02 15:04:05.000"
+
+// vsPattern is a Czech variable symbol: up to 10 digits
+var vsPattern = regexp.MustCompile(`^[0-9]{1,10}$`)
+
+// Version returns the concurrency token of a member record. An edit must
+// carry the version it started from.
+func Version(u db.User) string {
+	return u.UpdatedAt.UTC().Format(versionLayout)
+}
+
+// Edit is an admin change of a member's membership fields. Contact details
+// are not part of it and are kept as they are.
+type Edit struct {
+	State             string
+	LevelID           int64
+	LevelActualAmount money.Amount
+	PaymentsID        string // Empty removes the VS, unless Allocator is set
+	KeysGranted       sql.NullTime
+	KeysReturned      sql.NullTime
+	IsCouncil         bool
+	IsStaff           bool
+	Version           string // Version of the record the edit is based on
+	ChangedBy         int64  // Who makes the edit (0 for automatic changes), recorded in the history
+	Reason            string // Why the state, level or VS changes, recorded in the history
+
+	// Allocator, when set and PaymentsID is empty, gives the member the next
+	// VS in Apply's transaction, so concurrent edits cannot get the same one
+	Allocator *vs.Allocator
+}
+
+// editOf returns an edit that keeps the member's membership fields as they are
+func editOf(u db.User) Edit {
+	return Edit{
+		State:             u.State,
+		LevelID:           u.LevelID,
+		LevelActualAmount: u.LevelActualAmount,
+		PaymentsID:        u.PaymentsID.String,
+		KeysGranted:       u.KeysGranted,
+		KeysReturned:      u.KeysReturned,
+		IsCouncil:         u.IsCouncil,
+		IsStaff:           u.IsStaff,
+		Version:           Version(u),
+	}
+}
+
+// FieldChange is one changed field, with values formatted for people
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Validate checks the edit against the current record and the database
+// (level exists, VS unique among members, their previous VS and projects)
+func (e Edit) Validate(ctx context.Context, queries *db.Queries, current db.User) error {
+	if !IsValidState(e.State) {
+		return fmt.Errorf("unknown state '%s'", e.State)
+	}
+	if !CanTransition(current.State, e.State) {
+		return fmt.Errorf("cannot change state from %s to %s", current.State, e.State)
+	}
+
+	if _, err := queries.GetLevel(ctx, e.LevelID); err == sql.ErrNoRows {
+		return fmt.Errorf("level %d does not exist", e.LevelID)
+	} else if err != nil {
+		return fmt.Errorf("failed to load level: %w", err)
+	}
+	if e.LevelActualAmount.IsNegative() {
+		return fmt.Errorf("fee amount cannot be negative")
+	}
+
+	if e.PaymentsID != "" {
+		if !vsPattern.MatchString(e.PaymentsID) {
+			return fmt.Errorf("variable symbol must be 1-10 digits")
+		}
+		if other, err := queries.GetUserByPaymentsID(ctx, sql.NullString{String: e.PaymentsID, Valid: true}); err == nil && other.ID != current.ID {
+			return fmt.Errorf("variable symbol %s is already used by %s", e.PaymentsID, other.Email)
+		} else if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to check variable symbol: %w", err)
+		}
+		if ownerID, err := queries.GetUserIDByPreviousPaymentsID(ctx, e.PaymentsID); err == nil && ownerID != current.ID {
+			return fmt.Errorf("variable symbol %s was used by member %d before", e.PaymentsID, ownerID)
+		} else if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to check variable symbol: %w", err)
+		}
+		if project, err := queries.GetProjectByPaymentsID(ctx, sql.NullString{String: e.PaymentsID, Valid: true}); err == nil {
+			return fmt.Errorf("variable symbol %s is already used by project %s", e.PaymentsID, project.Name)
+		} else if err != sql.ErrNoRows {
+			return fmt.Errorf("failed to check variable symbol: %w", err)
+		}
+	}
+
+	if e.KeysReturned.Valid && !e.KeysGranted.Valid {
+		return fmt.Errorf("keys cannot be returned without being granted")
+	}
+	if e.KeysReturned.Valid && e.KeysReturned.Time.Before(e.KeysGranted.Time) {
+		return fmt.Errorf("keys cannot be returned before they were granted")
+	}
+
+	return nil
+}
+
+// Apply validates and stores the edit. It returns the updated record and the
+// changed fields, or ErrConflict when the record no longer has e.Version.
+// A state change is recorded in the state history together with the database
+// effects of the transition (keys returned); the other effects are left to
+// RunEffects. A level or fee change is recorded in the level history,
+// effective today, and replaces a change the member asked for. A replaced VS
+// is kept in the VS history, so payments sent with it still count toward the
+// member's balance. The VS from e.Allocator, the member and the history rows
+// are stored in one transaction: when a history row fails, the member is not
+// changed.
+func Apply(ctx context.Context, queries *db.Queries, current db.User, e Edit) (db.User, []FieldChange, error) {
+	if hasEffect(current.State, e.State, EffectReturnKeys) && e.KeysGranted.Valid && !e.KeysReturned.Valid {
+		e.KeysReturned = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	var updated db.User
+	err := queries.InTx(ctx, func(queries *db.Queries) error {
+		if e.PaymentsID == "" && e.Allocator != nil {
+			var err error
+			if e.PaymentsID, err = e.Allocator.WithQueries(queries).Next(ctx); err != nil {
+				return fmt.Errorf("failed to allocate variable symbol: %w", err)
+			}
+		}
+		if err := e.Validate(ctx, queries, current); err != nil {
+			return err
+		}
+		if e.Version == "" {
+			return fmt.Errorf("version is required")
+		}
+
+		var err error
+		updated, err = queries.UpdateUser(ctx, db.UpdateUserParams{
+			Email:             current.Email,
+			Username:          current.Username,
+			Realname:          current.Realname,
+			Phone:             current.Phone,
+			AltContact:        current.AltContact,
+			LevelID:           e.LevelID,
+			LevelActualAmount: e.LevelActualAmount,
+			PaymentsID:        sql.NullString{String: e.PaymentsID, Valid: e.PaymentsID != ""},
+			State:             e.State,
+			IsCouncil:         e.IsCouncil,
+			IsStaff:           e.IsStaff,
+			KeysGranted:       day(e.KeysGranted),
+			KeysReturned:      day(e.KeysReturned),
+			ID:                current.ID,
+			ExpectedUpdatedAt: e.Version,
+		})
+		if err == sql.ErrNoRows {
+			return ErrConflict
+		} else if err != nil {
+			return fmt.Errorf("failed to update member: %w", err)
+		}
+
+		reason := strings.TrimSpace(e.Reason)
+		if current.State != updated.State {
+			if _, err := queries.CreateStateHistory(ctx, db.CreateStateHistoryParams{
+				UserID:    current.ID,
+				FromState: current.State,
+				ToState:   updated.State,
+				ChangedBy: sql.NullInt64{Int64: e.ChangedBy, Valid: e.ChangedBy != 0},
+				Reason:    sql.NullString{String: reason, Valid: reason != ""},
+			}); err != nil {
+				return fmt.Errorf("failed to record state change: %w", err)
+			}
+		}
+
+		if current.LevelID != updated.LevelID || current.LevelActualAmount != updated.LevelActualAmount {
+			if err := recordLevelChange(ctx, queries, updated, e.ChangedBy, reason, time.Now()); err != nil {
+				return err
+			}
+		}
+
+		if current.PaymentsID.String != "" && current.PaymentsID.String != updated.PaymentsID.String {
+			if _, err := queries.CreatePaymentsIDHistory(ctx, db.CreatePaymentsIDHistoryParams{
+				UserID:     current.ID,
+				PaymentsID: current.PaymentsID.String,
+				ReplacedBy: updated.PaymentsID,
+				ChangedBy:  sql.NullInt64{Int64: e.ChangedBy, Valid: e.ChangedBy != 0},
+				Reason:     sql.NullString{String: reason, Valid: reason != ""},
+			}); err != nil {
+				return fmt.Errorf("failed to record previous variable symbol %s: %w", current.PaymentsID.String, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return db.User{}, nil, err
+	}
+
+	return updated, Diff(current, updated), nil
+}
+
+// Diff lists the membership fields that differ between two versions of a member
+func Diff(before, after db.User) []FieldChange {
+	var changes []FieldChange
+	add := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+
+	add("state", before.State, after.State)
+	add("level_id", fmt.Sprint(before.LevelID), fmt.Sprint(after.LevelID))
+	add("level_actual_amount", before.LevelActualAmount.String(), after.LevelActualAmount.String())
+	add("payments_id", before.PaymentsID.String, after.PaymentsID.String)
+	add("keys_granted", formatDay(before.KeysGranted), formatDay(after.KeysGranted))
+	add("keys_returned", formatDay(before.KeysReturned), formatDay(after.KeysReturned))
+	add("is_council", fmt.Sprint(before.IsCouncil), fmt.Sprint(after.IsCouncil))
+	add("is_staff", fmt.Sprint(before.IsStaff), fmt.Sprint(after.IsStaff))
+
+	return changes
+}
+
+// formatDay formats an optional date as YYYY-MM-DD, empty when unset
+func formatDay(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format("2006-01-02")
+}
+
+// day keeps only the calendar day of an optional date, as UTC midnight (the
+// SQLite driver cannot read back other offsets)
+func day(t sql.NullTime) sql.NullTime {
+	if !t.Valid {
+		return t
+	}
+	return sql.NullTime{Time: dates.Day(t.Time), Valid: true}
+}
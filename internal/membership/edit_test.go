@@ -0,0 +1,234 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StateAwaiting, StateAccepted, true},
+		{StateAwaiting, StateSuspended, false},
+		{StateAccepted, StateSuspended, true},
+		{StateAccepted, StateAwaiting, false},
+		{StateSuspended, StateAccepted, true},
+		{StateExmember, StateAccepted, true},
+		{StateRejected, StateAccepted, false},
+		{StateAccepted, StateAccepted, true},
+		{"bogus", "bogus", false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+
+	member, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "novak@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "1001", Valid: true},
+		State:             StateAccepted,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "other@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "1002", Valid: true},
+		State:             StateAccepted,
+	}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := queries.CreateProject(ctx, db.CreateProjectParams{
+		Name:       "3D tiskárna",
+		PaymentsID: sql.NullString{String: "7001", Valid: true},
+	}); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	edit := Edit{
+		State:             StateSuspended,
+		LevelID:           member.LevelID,
+		LevelActualAmount: money.FromKoruny(1500),
+		PaymentsID:        "1001",
+		KeysGranted:       sql.NullTime{Time: time.Date(2024, 1, 10, 15, 0, 0, 0, time.Local), Valid: true},
+		IsCouncil:         true,
+		Version:           Version(member),
+	}
+
+	updated, changes, err := Apply(ctx, queries, member, edit)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if updated.State != StateSuspended || updated.LevelActualAmount != money.FromKoruny(1500) || !updated.IsCouncil {
+		t.Errorf("got state %s, amount %s, council %v", updated.State, updated.LevelActualAmount, updated.IsCouncil)
+	}
+	if !updated.KeysGranted.Time.Equal(time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("KeysGranted = %v, want the day only", updated.KeysGranted.Time)
+	}
+
+	var fields []string
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+	if got := strings.Join(fields, ","); got != "state,level_actual_amount,keys_granted,is_council" {
+		t.Errorf("changed fields: %s", got)
+	}
+	if changes[0].Old != StateAccepted || changes[0].New != StateSuspended {
+		t.Errorf("state change: %+v", changes[0])
+	}
+
+	// A second edit based on the old version is rejected
+	if _, _, err := Apply(ctx, queries, member, edit); err != ErrConflict {
+		t.Errorf("stale version: got %v, want ErrConflict", err)
+	}
+
+	// Based on the current version it goes through, even within the same second
+	edit.State = StateAccepted
+	edit.Version = Version(updated)
+	if _, _, err := Apply(ctx, queries, updated, edit); err != nil {
+		t.Errorf("current version: %v", err)
+	}
+	current, _ := queries.GetUserByID(ctx, member.ID)
+
+	invalid := []struct {
+		name   string
+		modify func(e *Edit)
+		want   string
+	}{
+		{"state transition", func(e *Edit) { e.State = StateAwaiting }, "cannot change state"},
+		{"unknown level", func(e *Edit) { e.LevelID = 999 }, "does not exist"},
+		{"negative amount", func(e *Edit) { e.LevelActualAmount = money.FromKoruny(-1) }, "negative"},
+		{"VS format", func(e *Edit) { e.PaymentsID = "12a" }, "digits"},
+		{"VS of a member", func(e *Edit) { e.PaymentsID = "1002" }, "other@example.com"},
+		{"VS of a project", func(e *Edit) { e.PaymentsID = "7001" }, "3D tiskárna"},
+		{"keys returned only", func(e *Edit) {
+			e.KeysGranted = sql.NullTime{}
+			e.KeysReturned = sql.NullTime{Time: time.Now(), Valid: true}
+		}, "without being granted"},
+		{"keys returned early", func(e *Edit) {
+			e.KeysReturned = sql.NullTime{Time: e.KeysGranted.Time.AddDate(0, 0, -1), Valid: true}
+		}, "before they were granted"},
+	}
+	for _, tt := range invalid {
+		e := edit
+		e.Version = Version(current)
+		tt.modify(&e)
+		_, _, err := Apply(ctx, queries, current, e)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestApplyRollsBack(t *testing.T) {
+	database := dbtest.Open(t)
+	queries := db.New(database)
+	ctx := context.Background()
+
+	member, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "novak@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "1001", Valid: true},
+		State:             StateAccepted,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// The last history row fails, after the member and the state and level
+	// history rows were written
+	if _, err := database.Exec(`CREATE TRIGGER fail_vs_history BEFORE INSERT ON payments_id_history
+		BEGIN SELECT RAISE(ABORT, 'history unavailable'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = Apply(ctx, queries, member, Edit{
+		State:             StateSuspended,
+		LevelID:           member.LevelID,
+		LevelActualAmount: money.FromKoruny(1500),
+		PaymentsID:        "1009",
+		Version:           Version(member),
+	})
+	if err == nil || !strings.Contains(err.Error(), "history unavailable") {
+		t.Fatalf("Apply: got %v, want the history error", err)
+	}
+
+	current, err := queries.GetUserByID(ctx, member.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if current.State != StateAccepted || current.LevelActualAmount != money.FromKoruny(1000) || current.PaymentsID.String != "1001" || Version(current) != Version(member) {
+		t.Errorf("member changed: %+v", current)
+	}
+	if states, _ := queries.ListStateHistoryByUser(ctx, member.ID); len(states) != 0 {
+		t.Errorf("state history %+v", states)
+	}
+	if levels, _ := queries.ListLevelHistoryByUser(ctx, member.ID); len(levels) != 0 {
+		t.Errorf("level history %+v", levels)
+	}
+}
+
+func TestApplyAllocatesVSInTransaction(t *testing.T) {
+	database := dbtest.Open(t)
+	queries := db.New(database)
+	ctx := context.Background()
+
+	member, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:   "novak@example.com",
+		LevelID: 1,
+		State:   StateAwaiting,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// Another admin's edit has taken 1000 and is not committed yet
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	txQueries := queries.WithTx(tx)
+	if _, err := txQueries.CreateUser(ctx, db.CreateUserParams{
+		Email:      "other@example.com",
+		LevelID:    1,
+		PaymentsID: sql.NullString{String: "1000", Valid: true},
+		State:      StateAccepted,
+	}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	updated, _, err := Apply(ctx, txQueries, member, Edit{
+		State:             StateAccepted,
+		LevelID:           member.LevelID,
+		LevelActualAmount: money.FromKoruny(1000),
+		Version:           Version(member),
+		Allocator:         newTestAllocator(t, queries),
+	})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if updated.PaymentsID.String != "1001" {
+		t.Errorf("VS = %q, want 1001", updated.PaymentsID.String)
+	}
+}
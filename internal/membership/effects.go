@@ -0,0 +1,134 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/base48/member-portal/internal/config"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/email"
+	"github.com/base48/member-portal/internal/keycloak"
+)
+
+// ActiveMemberRole is the Keycloak realm role of accepted members
+const ActiveMemberRole = "active_member"
+
+// Effector carries out the effects of a transition outside the database
+type Effector interface {
+	SetActiveMember(ctx context.Context, member db.User, active bool) error
+	SendWelcome(ctx context.Context, member db.User) error
+	SendSuspended(ctx context.Context, member db.User, reason string) error
+}
+
+// EffectError is an effect that could not be carried out. The state change
+// itself is stored by then, so it has to be resolved by hand.
+type EffectError struct {
+	Effect Effect
+	Err    error
+}
+
+func (e *EffectError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Effect, e.Err)
+}
+
+func (e *EffectError) Unwrap() error {
+	return e.Err
+}
+
+// effectActions are the Czech descriptions of the effects RunEffects carries
+// out, for warnings shown to admins ("Nepodařilo se ...")
+var effectActions = map[Effect]string{
+	EffectGrantRole:      "přidělit roli " + ActiveMemberRole,
+	EffectRevokeRole:     "odebrat roli " + ActiveMemberRole,
+	EffectEmailWelcome:   "odeslat uvítací email",
+	EffectEmailSuspended: "odeslat email o pozastavení členství",
+}
+
+// Warning describes the failed effect in Czech
+func (e *EffectError) Warning() string {
+	action, ok := effectActions[e.Effect]
+	if !ok {
+		action = string(e.Effect)
+	}
+	return fmt.Sprintf("Nepodařilo se %s: %v", action, e.Err)
+}
+
+// RunEffects carries out the effects of the member's move from state from
+// to their current state that are outside the database. Every effect is
+// tried; the ones that failed are returned.
+func RunEffects(ctx context.Context, fx Effector, from string, member db.User, reason string) []*EffectError {
+	var failed []*EffectError
+	for _, effect := range Effects(from, member.State) {
+		var err error
+		switch effect {
+		case EffectGrantRole:
+			err = fx.SetActiveMember(ctx, member, true)
+		case EffectRevokeRole:
+			err = fx.SetActiveMember(ctx, member, false)
+		case EffectEmailWelcome:
+			err = fx.SendWelcome(ctx, member)
+		case EffectEmailSuspended:
+			err = fx.SendSuspended(ctx, member, reason)
+		}
+		if err != nil {
+			failed = append(failed, &EffectError{Effect: effect, Err: err})
+		}
+	}
+	return failed
+}
+
+// Transit moves the member to state to, keeping the other fields as they
+// are, and runs the effects of the transition. changedBy is 0 for automatic
+// changes. Failed effects are returned apart from the error: the state change
+// is stored even when some of them fail.
+func Transit(ctx context.Context, queries *db.Queries, fx Effector, current db.User, to string, changedBy int64, reason string) (db.User, []FieldChange, []*EffectError, error) {
+	e := editOf(current)
+	e.State = to
+	e.ChangedBy = changedBy
+	e.Reason = reason
+
+	updated, changes, err := Apply(ctx, queries, current, e)
+	if err != nil {
+		return db.User{}, nil, nil, err
+	}
+	return updated, changes, RunEffects(ctx, fx, current.State, updated, reason), nil
+}
+
+// ServiceEffector is the Effector of the portal: Keycloak roles through the
+// service account and emails through the email client
+type ServiceEffector struct {
+	Config *config.Config
+	Email  *email.Client
+	Token  func(ctx context.Context) (string, error) // Service account access token
+}
+
+// SetActiveMember assigns or removes the active_member role
+func (s *ServiceEffector) SetActiveMember(ctx context.Context, member db.User, active bool) error {
+	if !member.KeycloakID.Valid || member.KeycloakID.String == "" {
+		return fmt.Errorf("member %s has no linked Keycloak account", member.Email)
+	}
+
+	token, err := s.Token(ctx)
+	if err != nil {
+		return err
+	}
+	kcClient := keycloak.NewClient(s.Config, token)
+
+	if active {
+		return kcClient.AssignRoleToUser(ctx, member.KeycloakID.String, ActiveMemberRole)
+	}
+	return kcClient.RemoveRoleFromUser(ctx, member.KeycloakID.String, ActiveMemberRole)
+}
+
+// SendWelcome sends the welcome email (the email client logs it)
+func (s *ServiceEffector) SendWelcome(ctx context.Context, member db.User) error {
+	return s.Email.SendWelcome(ctx, &member)
+}
+
+// SendSuspended sends the suspension email with the reason
+func (s *ServiceEffector) SendSuspended(ctx context.Context, member db.User, reason string) error {
+	if reason == "" {
+		reason = "Rozhodnutí rady"
+	}
+	return s.Email.SendMembershipSuspended(ctx, &member, reason)
+}
@@ -0,0 +1,131 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// fakeEffector records the effects it is asked to carry out
+type fakeEffector struct {
+	calls []string
+	fail  error // Returned by SetActiveMember
+}
+
+func (f *fakeEffector) SetActiveMember(ctx context.Context, member db.User, active bool) error {
+	f.calls = append(f.calls, fmt.Sprintf("active=%v", active))
+	return f.fail
+}
+
+func (f *fakeEffector) SendWelcome(ctx context.Context, member db.User) error {
+	f.calls = append(f.calls, "welcome")
+	return nil
+}
+
+func (f *fakeEffector) SendSuspended(ctx context.Context, member db.User, reason string) error {
+	f.calls = append(f.calls, "suspended: "+reason)
+	return nil
+}
+
+func TestEffects(t *testing.T) {
+	// Every state has somewhere to go and every transition ends in a known state
+	for _, s := range States {
+		if len(NextStates(s)) == 0 {
+			t.Errorf("no transition from %s", s)
+		}
+	}
+	for _, tr := range transitions {
+		if !IsValidState(tr.From) || !IsValidState(tr.To) {
+			t.Errorf("transition %s -> %s uses an unknown state", tr.From, tr.To)
+		}
+	}
+
+	if got := Effects(StateAccepted, StateAccepted); got != nil {
+		t.Errorf("staying accepted has effects %v", got)
+	}
+	if !hasEffect(StateAccepted, StateSuspended, EffectStopFees) || hasEffect(StateSuspended, StateExmember, EffectStopFees) {
+		t.Error("fees are stopped when leaving the accepted state only")
+	}
+	for _, to := range []string{StateSuspended, StateExmember} {
+		if !hasEffect(StateAccepted, to, EffectRevokeRole) {
+			t.Errorf("accepted -> %s keeps the active_member role", to)
+		}
+	}
+}
+
+func TestTransit(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+
+	granted := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	member, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "novak@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "1001", Valid: true},
+		State:             StateAccepted,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	e := editOf(member)
+	e.KeysGranted = sql.NullTime{Time: granted, Valid: true}
+	member, _, err = Apply(ctx, queries, member, e)
+	if err != nil {
+		t.Fatalf("grant keys: %v", err)
+	}
+
+	fx := &fakeEffector{}
+	suspended, changes, failed, err := Transit(ctx, queries, fx, member, StateSuspended, 0, "Dluh")
+	if err != nil {
+		t.Fatalf("Transit: %v", err)
+	}
+	if suspended.State != StateSuspended || len(changes) != 1 || len(failed) != 0 {
+		t.Errorf("suspend: state %s, changes %v, failed %v", suspended.State, changes, failed)
+	}
+	if want := []string{"active=false", "suspended: Dluh"}; !reflect.DeepEqual(fx.calls, want) {
+		t.Errorf("effects %v, want %v", fx.calls, want)
+	}
+	if suspended.KeysReturned.Valid {
+		t.Error("suspension marked the keys returned")
+	}
+
+	if _, _, _, err := Transit(ctx, queries, fx, suspended, StateAwaiting, 0, ""); err == nil {
+		t.Error("suspended -> awaiting succeeded")
+	}
+
+	// Leaving marks the keys returned; a failed role change does not undo it
+	fx = &fakeEffector{fail: errors.New("keycloak down")}
+	ex, _, failed, err := Transit(ctx, queries, fx, suspended, StateExmember, member.ID, "Odchod")
+	if err != nil {
+		t.Fatalf("Transit: %v", err)
+	}
+	if ex.State != StateExmember || !ex.KeysReturned.Valid {
+		t.Errorf("exmember: state %s, keys returned %v", ex.State, ex.KeysReturned)
+	}
+	if len(failed) != 1 || failed[0].Effect != EffectRevokeRole || !errors.Is(failed[0], fx.fail) {
+		t.Errorf("failed effects %v", failed)
+	}
+
+	history, err := queries.ListStateHistoryByUser(ctx, member.ID)
+	if err != nil {
+		t.Fatalf("ListStateHistoryByUser: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("got %d history entries, want 2", len(history))
+	}
+	if h := history[0]; h.FromState != StateSuspended || h.ToState != StateExmember || h.ChangedBy.Int64 != member.ID || h.Reason.String != "Odchod" {
+		t.Errorf("latest history entry %+v", h)
+	}
+	if h := history[1]; h.ToState != StateSuspended || h.ChangedBy.Valid {
+		t.Errorf("automatic suspension entry %+v", h)
+	}
+}
@@ -0,0 +1,250 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/base48/member-portal/internal/dates"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// ErrNoLevelChange is returned when a member asks for the level and fee they
+// will have next month anyway
+var ErrNoLevelChange = errors.New("this level and fee are already in effect")
+
+// memberRequestReason is recorded in the level history for changes members
+// ask for themselves
+const memberRequestReason = "Změna na žádost člena"
+
+// LevelChange is a member's request to change their own level and fee
+type LevelChange struct {
+	LevelID           int64
+	LevelActualAmount money.Amount // Zero means the level amount
+}
+
+// NextPeriod returns the first day of the month after t, as UTC midnight.
+// Level changes members ask for take effect then.
+func NextPeriod(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// LevelOn returns the level and fee in effect on the day: the history entry
+// with the latest effective_from up to the day, the member's current level
+// before the first entry. The history starts when the member joined (the
+// accepted level is recorded on approval), so days before it are not billed.
+// The history may be in any order.
+func LevelOn(member db.User, history []db.MembershipLevelHistory, d time.Time) (int64, money.Amount) {
+	levelID, amount := member.LevelID, member.LevelActualAmount
+	for _, h := range sortedLevelHistory(history) {
+		if dates.Day(h.EffectiveFrom).After(dates.Day(d)) {
+			break
+		}
+		levelID, amount = h.LevelID, h.LevelActualAmount
+	}
+	return levelID, amount
+}
+
+// PriceOn returns the level's price, the minimum fee, on the day. Scheduled
+// price changes (of any level, in any order) apply from their effective_from;
+// before the first one the level had its old amount.
+func PriceOn(level db.Level, changes []db.LevelPriceChange, d time.Time) money.Amount {
+	var own []db.LevelPriceChange
+	for _, c := range changes {
+		if c.LevelID == level.ID {
+			own = append(own, c)
+		}
+	}
+	if len(own) == 0 {
+		return level.Amount
+	}
+	sort.SliceStable(own, func(i, j int) bool {
+		a, b := dates.Day(own[i].EffectiveFrom), dates.Day(own[j].EffectiveFrom)
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return own[i].ID < own[j].ID
+	})
+
+	price := own[0].OldAmount
+	for _, c := range own {
+		if dates.Day(c.EffectiveFrom).After(dates.Day(d)) {
+			break
+		}
+		price = c.NewAmount
+	}
+	return price
+}
+
+// PendingLevelChanges returns the entries of the history that take effect
+// after the day, oldest first
+func PendingLevelChanges(history []db.MembershipLevelHistory, d time.Time) []db.MembershipLevelHistory {
+	var pending []db.MembershipLevelHistory
+	for _, h := range sortedLevelHistory(history) {
+		if dates.Day(h.EffectiveFrom).After(dates.Day(d)) {
+			pending = append(pending, h)
+		}
+	}
+	return pending
+}
+
+// RequestLevelChange records a member's change of their own level and fee,
+// effective from the next month so the current month is billed as it was.
+// A change the member asked for before and that is still pending is replaced.
+func RequestLevelChange(ctx context.Context, queries *db.Queries, member db.User, c LevelChange, now time.Time) (db.MembershipLevelHistory, error) {
+	if member.State != StateAccepted && member.State != StateSuspended {
+		return db.MembershipLevelHistory{}, fmt.Errorf("only members can change their level, state is %s", member.State)
+	}
+
+	level, err := queries.GetLevel(ctx, c.LevelID)
+	if err == sql.ErrNoRows || (err == nil && (!level.Active || level.ID == AwaitingLevelID)) {
+		return db.MembershipLevelHistory{}, fmt.Errorf("level %d cannot be chosen", c.LevelID)
+	} else if err != nil {
+		return db.MembershipLevelHistory{}, fmt.Errorf("failed to load level: %w", err)
+	}
+
+	// The minimum is the price from next month, a price change may be scheduled
+	effective := NextPeriod(now)
+	priceChanges, err := queries.ListLevelPriceChanges(ctx)
+	if err != nil {
+		return db.MembershipLevelHistory{}, fmt.Errorf("failed to load level price changes: %w", err)
+	}
+	minimum := PriceOn(level, priceChanges, effective)
+
+	if c.LevelActualAmount.IsZero() {
+		c.LevelActualAmount = minimum
+	}
+	if c.LevelActualAmount != c.LevelActualAmount.RoundKoruny() {
+		return db.MembershipLevelHistory{}, fmt.Errorf("fee must be in whole crowns")
+	}
+	if c.LevelActualAmount < minimum {
+		return db.MembershipLevelHistory{}, fmt.Errorf("fee cannot be lower than %s for level %s", minimum.Format(), level.Name)
+	}
+
+	history, err := queries.ListLevelHistoryByUser(ctx, member.ID)
+	if err != nil {
+		return db.MembershipLevelHistory{}, fmt.Errorf("failed to load level history: %w", err)
+	}
+	pending := PendingLevelChanges(history, now)
+
+	// Compared with what applies next month once the pending change is gone
+	var kept []db.MembershipLevelHistory
+	for _, h := range history {
+		if !dates.Day(h.EffectiveFrom).After(dates.Day(now)) {
+			kept = append(kept, h)
+		}
+	}
+	levelID, amount := LevelOn(member, kept, effective)
+	if amount.IsZero() && levelID == level.ID {
+		amount = minimum
+	}
+	if levelID == level.ID && amount == c.LevelActualAmount && len(pending) == 0 {
+		return db.MembershipLevelHistory{}, ErrNoLevelChange
+	}
+
+	if err := withdrawLevelChanges(ctx, queries, pending); err != nil {
+		return db.MembershipLevelHistory{}, err
+	}
+	if levelID == level.ID && amount == c.LevelActualAmount {
+		// Asking for the current level again just withdraws the pending change
+		return db.MembershipLevelHistory{}, nil
+	}
+
+	entry, err := queries.CreateLevelHistory(ctx, db.CreateLevelHistoryParams{
+		UserID:            member.ID,
+		LevelID:           level.ID,
+		LevelActualAmount: c.LevelActualAmount,
+		EffectiveFrom:     effective,
+		Reason:            sql.NullString{String: memberRequestReason, Valid: true},
+	})
+	if err != nil {
+		return db.MembershipLevelHistory{}, fmt.Errorf("failed to record level change: %w", err)
+	}
+	return entry, nil
+}
+
+// CancelLevelChange withdraws the member's pending level change and reports
+// whether there was one
+func CancelLevelChange(ctx context.Context, queries *db.Queries, member db.User, now time.Time) (bool, error) {
+	history, err := queries.ListLevelHistoryByUser(ctx, member.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load level history: %w", err)
+	}
+	pending := PendingLevelChanges(history, now)
+	if err := withdrawLevelChanges(ctx, queries, pending); err != nil {
+		return false, err
+	}
+	return len(pending) > 0, nil
+}
+
+// ApplyDueLevelChange writes the level and fee in effect on the day to the
+// member record, once a pending change took effect. It reports whether the
+// record was changed.
+func ApplyDueLevelChange(ctx context.Context, queries *db.Queries, member db.User, history []db.MembershipLevelHistory, now time.Time) (db.User, bool, error) {
+	levelID, amount := LevelOn(member, history, now)
+	if levelID == member.LevelID && amount == member.LevelActualAmount {
+		return member, false, nil
+	}
+
+	updated, err := queries.UpdateUserLevel(ctx, db.UpdateUserLevelParams{
+		LevelID:           levelID,
+		LevelActualAmount: amount,
+		ID:                member.ID,
+	})
+	if err != nil {
+		return member, false, fmt.Errorf("failed to apply level change: %w", err)
+	}
+	return updated, true, nil
+}
+
+// recordLevelChange records an admin change of the level or fee, effective
+// today. Pending changes the member asked for are withdrawn, the admin's
+// decision overrides them.
+func recordLevelChange(ctx context.Context, queries *db.Queries, updated db.User, changedBy int64, reason string, now time.Time) error {
+	history, err := queries.ListLevelHistoryByUser(ctx, updated.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load level history: %w", err)
+	}
+	if err := withdrawLevelChanges(ctx, queries, PendingLevelChanges(history, now)); err != nil {
+		return err
+	}
+
+	if _, err := queries.CreateLevelHistory(ctx, db.CreateLevelHistoryParams{
+		UserID:            updated.ID,
+		LevelID:           updated.LevelID,
+		LevelActualAmount: updated.LevelActualAmount,
+		EffectiveFrom:     dates.Day(now),
+		ChangedBy:         sql.NullInt64{Int64: changedBy, Valid: changedBy != 0},
+		Reason:            sql.NullString{String: reason, Valid: reason != ""},
+	}); err != nil {
+		return fmt.Errorf("failed to record level change: %w", err)
+	}
+	return nil
+}
+
+// withdrawLevelChanges deletes pending entries of the level history
+func withdrawLevelChanges(ctx context.Context, queries *db.Queries, pending []db.MembershipLevelHistory) error {
+	for _, h := range pending {
+		if err := queries.DeleteLevelHistory(ctx, h.ID); err != nil {
+			return fmt.Errorf("failed to withdraw pending level change: %w", err)
+		}
+	}
+	return nil
+}
+
+// sortedLevelHistory returns a copy of the history, oldest first
+func sortedLevelHistory(history []db.MembershipLevelHistory) []db.MembershipLevelHistory {
+	sorted := append([]db.MembershipLevelHistory(nil), history...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := dates.Day(sorted[i].EffectiveFrom), dates.Day(sorted[j].EffectiveFrom)
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
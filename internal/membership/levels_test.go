@@ -0,0 +1,186 @@
+package membership
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/dates"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestLevelOn(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			panic(err)
+		}
+		return d
+	}
+	member := db.User{LevelID: 4, LevelActualAmount: money.FromKoruny(2000)}
+	history := []db.MembershipLevelHistory{
+		// In any order
+		{ID: 3, LevelID: 4, LevelActualAmount: money.FromKoruny(2000), EffectiveFrom: day("2024-06-01")},
+		{ID: 1, LevelID: 2, LevelActualAmount: money.FromKoruny(600), EffectiveFrom: day("2023-03-17")},
+		{ID: 2, LevelID: 3, LevelActualAmount: money.FromKoruny(1000), EffectiveFrom: day("2024-01-01")},
+	}
+
+	tests := []struct {
+		day   string
+		level int64
+	}{
+		{"2023-03-01", 4}, // Before the first entry
+		{"2023-03-17", 2},
+		{"2023-12-31", 2},
+		{"2024-01-01", 3},
+		{"2024-05-31", 3},
+		{"2024-06-01", 4},
+	}
+	for _, tt := range tests {
+		if level, _ := LevelOn(member, history, day(tt.day)); level != tt.level {
+			t.Errorf("LevelOn(%s) = %d, want %d", tt.day, level, tt.level)
+		}
+	}
+
+	if level, amount := LevelOn(member, nil, day("2024-01-01")); level != 4 || amount != money.FromKoruny(2000) {
+		t.Errorf("without history: %d %s, want the current level", level, amount)
+	}
+
+	if pending := PendingLevelChanges(history, day("2024-05-15")); len(pending) != 1 || pending[0].ID != 3 {
+		t.Errorf("pending: %+v", pending)
+	}
+	if next := NextPeriod(time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC)); !next.Equal(day("2025-01-01")) {
+		t.Errorf("NextPeriod = %v", next)
+	}
+}
+
+func TestRequestLevelChange(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+	now := time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)
+	april := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	member, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:   "novak@example.com",
+		LevelID: 3, // Regular, 1000
+		State:   StateAccepted,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// Same level for the level amount: nothing to change
+	if _, err := RequestLevelChange(ctx, queries, member, LevelChange{LevelID: 3}, now); err != ErrNoLevelChange {
+		t.Errorf("unchanged: got %v, want ErrNoLevelChange", err)
+	}
+
+	invalid := []struct {
+		name   string
+		change LevelChange
+	}{
+		{"awaiting level", LevelChange{LevelID: AwaitingLevelID}},
+		{"unknown level", LevelChange{LevelID: 999}},
+		{"below the minimum", LevelChange{LevelID: 4, LevelActualAmount: money.FromKoruny(1500)}},
+		{"not whole crowns", LevelChange{LevelID: 3, LevelActualAmount: money.MustParse("1200.50")}},
+	}
+	for _, tt := range invalid {
+		if _, err := RequestLevelChange(ctx, queries, member, tt.change, now); err == nil || err == ErrNoLevelChange {
+			t.Errorf("%s: got %v, want a validation error", tt.name, err)
+		}
+	}
+
+	entry, err := RequestLevelChange(ctx, queries, member, LevelChange{LevelID: 2}, now)
+	if err != nil {
+		t.Fatalf("RequestLevelChange: %v", err)
+	}
+	if entry.LevelID != 2 || entry.LevelActualAmount != money.FromKoruny(600) || !entry.EffectiveFrom.Equal(april) || entry.ChangedBy.Valid {
+		t.Errorf("entry: %+v", entry)
+	}
+
+	// The member record keeps the current level until April
+	if current, _ := queries.GetUserByID(ctx, member.ID); current.LevelID != 3 {
+		t.Errorf("level changed immediately to %d", current.LevelID)
+	}
+
+	// A second request replaces the pending one
+	if _, err := RequestLevelChange(ctx, queries, member, LevelChange{LevelID: 3, LevelActualAmount: money.FromKoruny(1200)}, now); err != nil {
+		t.Fatalf("second request: %v", err)
+	}
+	history, _ := queries.ListLevelHistoryByUser(ctx, member.ID)
+	if len(history) != 1 || history[0].LevelActualAmount != money.FromKoruny(1200) {
+		t.Fatalf("history after the second request: %+v", history)
+	}
+
+	// Nothing changes before April, the change is written to the record then
+	if _, applied, err := ApplyDueLevelChange(ctx, queries, member, history, now); err != nil || applied {
+		t.Errorf("applied in March: %v, %v", applied, err)
+	}
+	updated, applied, err := ApplyDueLevelChange(ctx, queries, member, history, april)
+	if err != nil || !applied || updated.LevelID != 3 || updated.LevelActualAmount != money.FromKoruny(1200) {
+		t.Errorf("applied in April: %v, %v, %+v", applied, err, updated)
+	}
+
+	// Withdrawn
+	if _, err := RequestLevelChange(ctx, queries, updated, LevelChange{LevelID: 4}, april); err != nil {
+		t.Fatalf("third request: %v", err)
+	}
+	if cancelled, err := CancelLevelChange(ctx, queries, updated, april); err != nil || !cancelled {
+		t.Errorf("CancelLevelChange = %v, %v", cancelled, err)
+	}
+	if cancelled, _ := CancelLevelChange(ctx, queries, updated, april); cancelled {
+		t.Error("nothing left to cancel")
+	}
+
+	// Only members can change their level
+	awaiting, _ := queries.CreateUser(ctx, db.CreateUserParams{Email: "new@example.com", LevelID: 1, State: StateAwaiting})
+	if _, err := RequestLevelChange(ctx, queries, awaiting, LevelChange{LevelID: 2}, now); err == nil {
+		t.Error("awaiting member changed their level")
+	}
+}
+
+func TestApplyRecordsLevelHistory(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+
+	member, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:   "novak@example.com",
+		LevelID: 3,
+		State:   StateAccepted,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// A pending change the member asked for
+	if _, err := RequestLevelChange(ctx, queries, member, LevelChange{LevelID: 2}, time.Now()); err != nil {
+		t.Fatalf("RequestLevelChange: %v", err)
+	}
+
+	edit := editOf(member)
+	edit.IsStaff = true
+	updated, _, err := Apply(ctx, queries, member, edit)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if history, _ := queries.ListLevelHistoryByUser(ctx, member.ID); len(history) != 1 {
+		t.Errorf("edit without a level change touched the level history: %+v", history)
+	}
+
+	edit = editOf(updated)
+	edit.LevelID = 4
+	edit.ChangedBy = member.ID
+	edit.Reason = "Sponzorský dar"
+	if _, _, err := Apply(ctx, queries, updated, edit); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	history, _ := queries.ListLevelHistoryByUser(ctx, member.ID)
+	if len(history) != 1 {
+		t.Fatalf("history: %+v, want the admin's change only", history)
+	}
+	h := history[0]
+	if h.LevelID != 4 || !h.EffectiveFrom.Equal(dates.Day(time.Now())) || h.ChangedBy.Int64 != member.ID || h.Reason.String != "Sponzorský dar" {
+		t.Errorf("entry: %+v", h)
+	}
+}
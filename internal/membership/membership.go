@@ -0,0 +1,146 @@
+// Package membership holds the rules for changing a member's record: the
+// membership states with the transitions allowed between them and their side
+// effects, admin edits with validation, a field-level diff and optimistic
+// concurrency, the application workflow that turns a registered user into a
+// member, and the level history with level changes members ask for.
+package membership
+
+// Membership states (users.state CHECK constraint)
+const (
+	StateAwaiting  = "awaiting"  // Registered, waiting for approval
+	StateAccepted  = "accepted"  // Active member, pays fees
+	StateRejected  = "rejected"  // Application rejected
+	StateExmember  = "exmember"  // Membership ended
+	StateSuspended = "suspended" // Membership on hold (e.g. unpaid fees)
+)
+
+// States lists all states in the order they are offered in the UI
+var States = []string{StateAwaiting, StateAccepted, StateSuspended, StateExmember, StateRejected}
+
+// stateLabels are the Czech names of the states
+var stateLabels = map[string]string{
+	StateAwaiting:  "Čeká na schválení",
+	StateAccepted:  "Aktivní",
+	StateRejected:  "Zamítnutý",
+	StateExmember:  "Bývalý člen",
+	StateSuspended: "Pozastavený",
+}
+
+// Effect is a side effect of moving a member to another state
+type Effect string
+
+// Effects of state transitions. Fees are billed for the days a member is
+// accepted (see internal/fees), so starting and stopping them needs no
+// action; keys are marked returned by Apply and the rest is run by RunEffects.
+const (
+	EffectStartFees      Effect = "start_fees"           // Monthly fees are generated again
+	EffectStopFees       Effect = "stop_fees"            // No more monthly fees
+	EffectGrantRole      Effect = "grant_active_member"  // Keycloak role active_member assigned
+	EffectRevokeRole     Effect = "revoke_active_member" // Keycloak role active_member removed
+	EffectReturnKeys     Effect = "return_keys"          // keys_returned set to today if the keys are out
+	EffectEmailWelcome   Effect = "email_welcome"        // Welcome email
+	EffectEmailSuspended Effect = "email_suspended"      // Suspension email with the reason
+)
+
+// effectLabels are the Czech descriptions of the effects
+var effectLabels = map[Effect]string{
+	EffectStartFees:      "obnoví předpis příspěvků",
+	EffectStopFees:       "zastaví předpis příspěvků",
+	EffectGrantRole:      "přidělí roli active_member",
+	EffectRevokeRole:     "odebere roli active_member",
+	EffectReturnKeys:     "zapíše vrácení klíčů",
+	EffectEmailWelcome:   "pošle uvítací email",
+	EffectEmailSuspended: "pošle email o pozastavení",
+}
+
+// EffectLabel returns the Czech description of an effect
+func EffectLabel(effect Effect) string {
+	if label, ok := effectLabels[effect]; ok {
+		return label
+	}
+	return string(effect)
+}
+
+// Transition is an allowed state change and its side effects
+type Transition struct {
+	From    string
+	To      string
+	Effects []Effect
+}
+
+// transitions lists every allowed state change
+var transitions = []Transition{
+	{StateAwaiting, StateAccepted, []Effect{EffectStartFees, EffectGrantRole, EffectEmailWelcome}},
+	{StateAwaiting, StateRejected, nil},
+	{StateAccepted, StateSuspended, []Effect{EffectStopFees, EffectRevokeRole, EffectEmailSuspended}},
+	{StateAccepted, StateExmember, []Effect{EffectStopFees, EffectRevokeRole, EffectReturnKeys}},
+	{StateSuspended, StateAccepted, []Effect{EffectStartFees, EffectGrantRole}},
+	{StateSuspended, StateExmember, []Effect{EffectRevokeRole, EffectReturnKeys}},
+	{StateExmember, StateAccepted, []Effect{EffectStartFees, EffectGrantRole, EffectEmailWelcome}},
+	{StateRejected, StateAwaiting, nil},
+}
+
+// StateLabel returns the Czech name of a state
+func StateLabel(state string) string {
+	if label, ok := stateLabels[state]; ok {
+		return label
+	}
+	return state
+}
+
+// IsValidState reports whether state is one of the known states
+func IsValidState(state string) bool {
+	_, ok := stateLabels[state]
+	return ok
+}
+
+// findTransition returns the transition between two different states
+func findTransition(from, to string) (Transition, bool) {
+	for _, t := range transitions {
+		if t.From == from && t.To == to {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
+
+// CanTransition reports whether a member can move from one state to another.
+// Staying in the same state is always allowed.
+func CanTransition(from, to string) bool {
+	if from == to {
+		return IsValidState(to)
+	}
+	_, ok := findTransition(from, to)
+	return ok
+}
+
+// NextStates returns the states a member in state can be moved to
+func NextStates(state string) []string {
+	var states []string
+	for _, t := range transitions {
+		if t.From == state {
+			states = append(states, t.To)
+		}
+	}
+	return states
+}
+
+// Effects returns the side effects of moving from one state to another, none
+// when the state stays the same or the transition is not allowed
+func Effects(from, to string) []Effect {
+	if from == to {
+		return nil
+	}
+	t, _ := findTransition(from, to)
+	return t.Effects
+}
+
+// hasEffect reports whether the transition has the effect
+func hasEffect(from, to string, effect Effect) bool {
+	for _, e := range Effects(from, to) {
+		if e == effect {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/vs"
+)
+
+// ReassignPaymentsID gives the member a new variable symbol: newVS, or the
+// next one from the allocator when newVS is empty. The previous VS is kept in
+// the VS history and payments sent with it still count toward the balance.
+func ReassignPaymentsID(ctx context.Context, queries *db.Queries, alloc *vs.Allocator, current db.User, newVS string, changedBy int64, reason string) (db.User, error) {
+	newVS = strings.TrimSpace(newVS)
+	if newVS != "" && newVS == current.PaymentsID.String {
+		return db.User{}, fmt.Errorf("member already has variable symbol %s", newVS)
+	}
+
+	e := editOf(current)
+	e.PaymentsID = newVS
+	if newVS == "" {
+		e.Allocator = alloc
+	}
+	e.ChangedBy = changedBy
+	e.Reason = reason
+
+	updated, _, err := Apply(ctx, queries, current, e)
+	return updated, err
+}
@@ -0,0 +1,111 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestReassignPaymentsID(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+
+	member, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "novak@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "1001", Valid: true},
+		State:             StateAccepted,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	other, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "other@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "1005", Valid: true},
+		State:             StateAccepted,
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// A payment sent with the VS the member has now
+	if _, err := queries.CreatePayment(ctx, db.CreatePaymentParams{
+		UserID:         sql.NullInt64{Int64: member.ID, Valid: true},
+		Date:           time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+		Amount:         money.FromKoruny(1000),
+		Kind:           "fio",
+		KindID:         "1",
+		Identification: "1001",
+	}); err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	balance := func() money.Amount {
+		t.Helper()
+		b, err := queries.GetUserBalance(ctx, db.GetUserBalanceParams{
+			UserID:   sql.NullInt64{Int64: member.ID, Valid: true},
+			UserID_2: member.ID,
+		})
+		if err != nil {
+			t.Fatalf("balance: %v", err)
+		}
+		return money.FromHalere(b)
+	}
+	before := balance()
+
+	alloc := newTestAllocator(t, queries)
+	updated, err := ReassignPaymentsID(ctx, queries, alloc, member, "", other.ID, "Kolize s trvalým příkazem")
+	if err != nil {
+		t.Fatalf("ReassignPaymentsID: %v", err)
+	}
+	if updated.PaymentsID.String != "1006" {
+		t.Errorf("new VS = %s, want 1006", updated.PaymentsID.String)
+	}
+
+	history, err := queries.ListPaymentsIDHistoryByUser(ctx, member.ID)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("history: %v, %d rows", err, len(history))
+	}
+	h := history[0]
+	if h.PaymentsID != "1001" || h.ReplacedBy.String != "1006" || h.ChangedBy.Int64 != other.ID || h.Reason.String != "Kolize s trvalým příkazem" {
+		t.Errorf("history row: %+v", h)
+	}
+
+	// The payment under the previous VS still counts
+	if after := balance(); after != before {
+		t.Errorf("balance changed from %s to %s", before, after)
+	}
+	if pays, _ := queries.ListMembershipPaymentsByUser(ctx, sql.NullInt64{Int64: member.ID, Valid: true}); len(pays) != 1 {
+		t.Errorf("membership payments: %d, want 1", len(pays))
+	}
+
+	// The previous VS is never given to anyone else
+	e := editOf(other)
+	e.PaymentsID = "1001"
+	if _, _, err := Apply(ctx, queries, other, e); err == nil || !strings.Contains(err.Error(), "used by member") {
+		t.Errorf("previous VS to another member: got %v", err)
+	}
+	if next, _ := alloc.Next(ctx); next != "1007" {
+		t.Errorf("next VS = %s, want 1007", next)
+	}
+
+	// An explicit VS, and the member may get their previous one back
+	updated, err = ReassignPaymentsID(ctx, queries, alloc, updated, "1001", 0, "")
+	if err != nil {
+		t.Fatalf("back to the previous VS: %v", err)
+	}
+	if _, err := ReassignPaymentsID(ctx, queries, alloc, updated, "1001", 0, ""); err == nil {
+		t.Error("reassigning the same VS succeeded")
+	}
+	if history, _ := queries.ListPaymentsIDHistoryByUser(ctx, member.ID); len(history) != 2 {
+		t.Errorf("history rows: %d, want 2", len(history))
+	}
+}
@@ -0,0 +1,369 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/base48/member-portal/migrations"
+)
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version  int
+	Name     string
+	UpSQL    string
+	DownSQL  string // Empty if the migration cannot be reverted
+	Checksum string // SHA-256 of UpSQL
+}
+
+// Status describes whether a migration has been applied to the database
+type Status struct {
+	Migration
+	Applied          bool
+	AppliedAt        time.Time
+	ChecksumMismatch bool
+}
+
+// Migrator applies embedded migrations and tracks them in schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// migrationFileRe matches "005_projects_and_payment_updates.sql" and
+// "005_projects_and_payment_updates.down.sql"
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+?)(\.down)?\.sql$`)
+
+// legacyProbes detect migrations that were applied by hand with the sqlite3 CLI
+// before schema_migrations existed. Each query returns a non-zero count if the
+// migration's changes are already present.
+var legacyProbes = map[int]string{
+	1: `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'`,
+	3: `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'system_logs'`,
+	5: `SELECT COUNT(*) FROM pragma_table_info('payments') WHERE name = 'project_id'`,
+}
+
+// New creates a Migrator using the migrations embedded in the migrations package
+func New(db *sql.DB) (*Migrator, error) {
+	list, err := Load(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: list}, nil
+}
+
+// Load reads and orders all migrations from the given filesystem
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := migrationFileRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+		if m.Name != "" && m.Name != match[2] {
+			return nil, fmt.Errorf("conflicting names for migration %03d: %s and %s", version, m.Name, match[2])
+		}
+		m.Name = match[2]
+
+		if match[3] == ".down" {
+			m.DownSQL = string(content)
+		} else {
+			m.UpSQL = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.UpSQL == "" {
+			return nil, fmt.Errorf("migration %03d_%s has a down file but no up file", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+
+	return list, nil
+}
+
+// Migrations returns all known migrations in order
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Status returns the state of every known migration
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.init(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := Status{Migration: mig}
+		if row, ok := applied[mig.Version]; ok {
+			st.Applied = true
+			st.AppliedAt = row.appliedAt
+			st.ChecksumMismatch = row.checksum != mig.Checksum
+		}
+		statuses = append(statuses, st)
+	}
+
+	return statuses, nil
+}
+
+// Up applies all pending migrations in order and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkChecksums(statuses); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, st := range statuses {
+		if st.Applied {
+			continue
+		}
+		if err := m.apply(ctx, st.Migration); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Down reverts the given number of most recently applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(statuses) - 1; i >= 0 && count < steps; i-- {
+		st := statuses[i]
+		if !st.Applied {
+			continue
+		}
+		if st.DownSQL == "" {
+			return count, fmt.Errorf("migration %03d_%s has no down migration", st.Version, st.Name)
+		}
+		if err := m.revert(ctx, st.Migration); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Verify returns an error if any migration is pending or was modified after
+// being applied. Used by jobs that must not change the schema themselves.
+func (m *Migrator) Verify(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkChecksums(statuses); err != nil {
+		return err
+	}
+
+	for _, st := range statuses {
+		if !st.Applied {
+			return fmt.Errorf("migration %03d_%s is not applied (run: go run ./cmd/migrate up)", st.Version, st.Name)
+		}
+	}
+
+	return nil
+}
+
+// Up is a shortcut for New(db) followed by Migrator.Up
+func Up(ctx context.Context, db *sql.DB) (int, error) {
+	m, err := New(db)
+	if err != nil {
+		return 0, err
+	}
+	return m.Up(ctx)
+}
+
+// Verify is a shortcut for New(db) followed by Migrator.Verify
+func Verify(ctx context.Context, db *sql.DB) error {
+	m, err := New(db)
+	if err != nil {
+		return err
+	}
+	return m.Verify(ctx)
+}
+
+// checkChecksums fails if an applied migration file was edited afterwards
+func checkChecksums(statuses []Status) error {
+	for _, st := range statuses {
+		if st.Applied && st.ChecksumMismatch {
+			return fmt.Errorf("checksum mismatch for applied migration %03d_%s - migration files must not be edited after they are applied", st.Version, st.Name)
+		}
+	}
+	return nil
+}
+
+// init creates the schema_migrations table and baselines databases that were
+// set up by hand before the table existed
+func (m *Migrator) init(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var tracked int
+	if err := m.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&tracked); err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	if tracked > 0 {
+		return nil
+	}
+
+	return m.baseline(ctx)
+}
+
+// baseline records hand-applied migrations as applied so they are not re-run
+func (m *Migrator) baseline(ctx context.Context) error {
+	for _, mig := range m.migrations {
+		probe, ok := legacyProbes[mig.Version]
+		if !ok {
+			continue
+		}
+
+		var found int
+		if err := m.db.QueryRowContext(ctx, probe).Scan(&found); err != nil {
+			return fmt.Errorf("failed to detect migration %03d_%s: %w", mig.Version, mig.Name, err)
+		}
+		if found == 0 {
+			continue
+		}
+
+		if _, err := m.db.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)`,
+			mig.Version, mig.Name, mig.Checksum,
+		); err != nil {
+			return fmt.Errorf("failed to baseline migration %03d_%s: %w", mig.Version, mig.Name, err)
+		}
+	}
+
+	return nil
+}
+
+type appliedRow struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// applied returns schema_migrations rows keyed by version
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedRow, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[int]appliedRow)
+	for rows.Next() {
+		var version int
+		var row appliedRow
+		if err := rows.Scan(&version, &row.checksum, &row.appliedAt); err != nil {
+			return nil, err
+		}
+		result[version] = row
+	}
+
+	return result, rows.Err()
+}
+
+// apply runs a single up migration in a transaction
+func (m *Migrator) apply(ctx context.Context, mig Migration) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mig.UpSQL); err != nil {
+		return fmt.Errorf("migration %03d_%s failed: %w", mig.Version, mig.Name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)`,
+		mig.Version, mig.Name, mig.Checksum,
+	); err != nil {
+		return fmt.Errorf("failed to record migration %03d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// revert runs a single down migration in a transaction
+func (m *Migrator) revert(ctx context.Context, mig Migration) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mig.DownSQL); err != nil {
+		return fmt.Errorf("down migration %03d_%s failed: %w", mig.Version, mig.Name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, mig.Version); err != nil {
+		return fmt.Errorf("failed to unrecord migration %03d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,258 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/base48/member-portal/migrations"
+)
+
+// openDB returns an empty database in a temporary directory. It cannot use
+// dbtest, which imports this package.
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	database, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func newMigrator(t *testing.T, database *sql.DB, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+
+	list, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return &Migrator{db: database, migrations: list}
+}
+
+func tableExists(t *testing.T, database *sql.DB, name string) bool {
+	t.Helper()
+
+	var n int
+	if err := database.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n); err != nil {
+		t.Fatalf("sqlite_master: %v", err)
+	}
+	return n > 0
+}
+
+func TestLoad(t *testing.T) {
+	list, err := Load(fstest.MapFS{
+		"010_ten.sql":      {Data: []byte("CREATE TABLE ten (id INTEGER);")},
+		"002_two.sql":      {Data: []byte("CREATE TABLE two (id INTEGER);")},
+		"002_two.down.sql": {Data: []byte("DROP TABLE two;")},
+		"001_one.sql":      {Data: []byte("CREATE TABLE one (id INTEGER);")},
+		"README.md":        {Data: []byte("not a migration")},
+		"sub/003_x.sql":    {Data: []byte("ignored")},
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	var got []string
+	for _, m := range list {
+		got = append(got, m.Name)
+	}
+	if strings.Join(got, ",") != "one,two,ten" {
+		t.Fatalf("order %v", got)
+	}
+	if list[1].Version != 2 || list[1].DownSQL != "DROP TABLE two;" || list[0].DownSQL != "" {
+		t.Errorf("migrations %+v", list)
+	}
+	// SHA-256 of the up file in hex
+	if len(list[0].Checksum) != 64 || list[0].Checksum == list[1].Checksum {
+		t.Errorf("checksums %q, %q", list[0].Checksum, list[1].Checksum)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"conflicting names": {
+			"001_one.sql":      {Data: []byte("SELECT 1;")},
+			"001_uno.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"down without up": {
+			"001_one.sql":      {Data: []byte("SELECT 1;")},
+			"002_two.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	list, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for i, m := range list {
+		if m.Version == 2 {
+			t.Errorf("the one-off import 002_%s is embedded", m.Name)
+		}
+		if m.DownSQL == "" {
+			t.Errorf("%03d_%s has no down migration", m.Version, m.Name)
+		}
+		if i > 0 && list[i-1].Version >= m.Version {
+			t.Errorf("%03d after %03d", m.Version, list[i-1].Version)
+		}
+	}
+}
+
+func TestUpFreshAndDown(t *testing.T) {
+	ctx := context.Background()
+	database := openDB(t)
+
+	m, err := New(database)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	all := len(m.Migrations())
+
+	if err := m.Verify(ctx); err == nil || !strings.Contains(err.Error(), "is not applied") {
+		t.Errorf("Verify before Up: %v", err)
+	}
+	if n, err := m.Up(ctx); err != nil || n != all {
+		t.Fatalf("Up: %d, %v (want %d)", n, err, all)
+	}
+	if n, err := m.Up(ctx); err != nil || n != 0 {
+		t.Errorf("second Up: %d, %v", n, err)
+	}
+	if err := m.Verify(ctx); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	// The last migration is reverted and applied again
+	last := m.Migrations()[all-1]
+	if n, err := m.Down(ctx, 1); err != nil || n != 1 {
+		t.Fatalf("Down 1: %d, %v", n, err)
+	}
+	statuses, _ := m.Status(ctx)
+	if st := statuses[all-1]; st.Applied || st.Version != last.Version {
+		t.Errorf("status after Down: %+v", st)
+	}
+	if !statuses[all-2].Applied {
+		t.Errorf("Down reverted more than one migration")
+	}
+	if n, err := m.Up(ctx); err != nil || n != 1 {
+		t.Errorf("Up after Down: %d, %v", n, err)
+	}
+
+	// Every down migration works on the full schema
+	if n, err := m.Down(ctx, all); err != nil || n != all {
+		t.Fatalf("Down all: %d, %v", n, err)
+	}
+	if tableExists(t, database, "users") {
+		t.Error("users exists after reverting everything")
+	}
+	if n, err := m.Up(ctx); err != nil || n != all {
+		t.Errorf("Up after reverting everything: %d, %v", n, err)
+	}
+}
+
+func TestLegacyBaseline(t *testing.T) {
+	ctx := context.Background()
+	database := openDB(t)
+
+	m, err := New(database)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// The schema was created by hand with the sqlite3 CLI: 001 and 003, but
+	// not 005
+	for _, mig := range m.Migrations() {
+		if mig.Version == 1 || mig.Version == 3 {
+			if _, err := database.Exec(mig.UpSQL); err != nil {
+				t.Fatalf("apply %03d by hand: %v", mig.Version, err)
+			}
+		}
+	}
+	if _, err := database.Exec(`INSERT INTO users (email, level_id, state) VALUES ('old@example.com', 1, 'accepted')`); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	// Amounts written before they had two decimals
+	if _, err := database.Exec(`
+		INSERT INTO payments (user_id, date, amount, kind, kind_id, local_account, remote_account, identification)
+		VALUES (1, '2024-01-05', '1000.5', 'fio', '1', '', '', ''), (1, '2024-02-05', '-5', 'fio', '2', '', '', '');
+		INSERT INTO fees (user_id, level_id, period_start, amount) VALUES (1, 1, '2024-01-01', '250')`); err != nil {
+		t.Fatalf("insert payments: %v", err)
+	}
+
+	n, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if want := len(m.Migrations()) - 2; n != want {
+		t.Errorf("applied %d, want %d", n, want)
+	}
+	if err := m.Verify(ctx); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	// The data of the hand-made database is kept
+	var email string
+	if err := database.QueryRow(`SELECT email FROM users`).Scan(&email); err != nil || email != "old@example.com" {
+		t.Errorf("user %q, %v", email, err)
+	}
+
+	// and its amounts get two decimals
+	var amounts string
+	if err := database.QueryRow(`
+		SELECT (SELECT group_concat(amount, ' ') FROM (SELECT amount FROM payments ORDER BY id))
+			|| ' ' || (SELECT amount FROM fees) || ' ' || (SELECT level_actual_amount FROM users)`).Scan(&amounts); err != nil {
+		t.Fatalf("amounts: %v", err)
+	}
+	if want := "1000.50 -5.00 250.00 0.00"; amounts != want {
+		t.Errorf("amounts %q, want %q", amounts, want)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	database := openDB(t)
+
+	original := fstest.MapFS{
+		"001_one.sql":      {Data: []byte("CREATE TABLE one (id INTEGER);")},
+		"001_one.down.sql": {Data: []byte("DROP TABLE one;")},
+	}
+	if n, err := newMigrator(t, database, original).Up(ctx); err != nil || n != 1 {
+		t.Fatalf("Up: %d, %v", n, err)
+	}
+
+	// The applied file is edited and a new migration added
+	tampered := fstest.MapFS{
+		"001_one.sql":      {Data: []byte("CREATE TABLE one (id INTEGER, name TEXT);")},
+		"001_one.down.sql": {Data: []byte("DROP TABLE one;")},
+		"002_two.sql":      {Data: []byte("CREATE TABLE two (id INTEGER);")},
+	}
+	m := newMigrator(t, database, tampered)
+
+	statuses, err := m.Status(ctx)
+	if err != nil || !statuses[0].ChecksumMismatch || statuses[1].Applied {
+		t.Fatalf("Status %+v, %v", statuses, err)
+	}
+	if _, err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Up: %v", err)
+	}
+	if tableExists(t, database, "two") {
+		t.Error("Up applied a migration despite the mismatch")
+	}
+	if err := m.Verify(ctx); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Verify: %v", err)
+	}
+
+	// A migration without a down file cannot be reverted
+	if _, err := newMigrator(t, database, fstest.MapFS{"001_one.sql": original["001_one.sql"]}).Down(ctx, 1); err == nil {
+		t.Error("Down without a down file: no error")
+	}
+}
@@ -0,0 +1,327 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is an exact amount of money in haléře (1 Kč = 100 haléřů).
+//
+// Amounts are stored in the database as decimal TEXT ("1000.00", "1000.50") and
+// converted to integer haléře on read, so sums never go through float64.
+type Amount int64
+
+// Koruna is one Czech crown
+const Koruna Amount = 100
+
+// Zero is the zero amount
+const Zero Amount = 0
+
+// FromKoruny creates an amount from whole crowns
+func FromKoruny(koruny int64) Amount {
+	return Amount(koruny) * Koruna
+}
+
+// FromHalere creates an amount from haléře (e.g. a SUM computed in SQL)
+func FromHalere(halere int64) Amount {
+	return Amount(halere)
+}
+
+// FromFloat converts a float (e.g. a JSON number from the FIO API) to an amount,
+// rounding to the nearest halíř
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * 100))
+}
+
+// Parse parses a decimal amount. Accepts both "1000.50" and the Czech
+// "1 000,50" notation, an optional sign and an optional "Kč" suffix.
+// More than two decimal places are rejected rather than rounded.
+func Parse(s string) (Amount, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, "Kč")
+	s = strings.TrimSuffix(s, "CZK")
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', ' ', ' ', '\t':
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.Replace(s, ",", ".", 1)
+
+	if s == "" {
+		return 0, fmt.Errorf("invalid amount %q: empty", orig)
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" && (!hasFrac || frac == "") {
+		return 0, fmt.Errorf("invalid amount %q", orig)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if len(frac) > 2 {
+		// Allow trailing zeros ("1000.000") but never silently round
+		if strings.TrimRight(frac[2:], "0") != "" {
+			return 0, fmt.Errorf("invalid amount %q: more than two decimal places", orig)
+		}
+		frac = frac[:2]
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	// ParseInt would accept another sign ("1.+5", "-+5")
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", orig)
+	}
+
+	koruny, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", orig)
+	}
+	halere, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", orig)
+	}
+	if koruny > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("invalid amount %q: out of range", orig)
+	}
+
+	a := Amount(koruny*100 + halere)
+	if negative {
+		a = -a
+	}
+	return a, nil
+}
+
+// MustParse is like Parse but panics on error (for constants and tests)
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Halere returns the amount in haléře
+func (a Amount) Halere() int64 {
+	return int64(a)
+}
+
+// Koruny returns the whole crowns, truncated towards zero
+func (a Amount) Koruny() int64 {
+	return int64(a / Koruna)
+}
+
+// IsZero reports whether the amount is zero
+func (a Amount) IsZero() bool {
+	return a == 0
+}
+
+// IsNegative reports whether the amount is below zero
+func (a Amount) IsNegative() bool {
+	return a < 0
+}
+
+// IsPositive reports whether the amount is above zero
+func (a Amount) IsPositive() bool {
+	return a > 0
+}
+
+// Neg returns the amount with the opposite sign
+func (a Amount) Neg() Amount {
+	return -a
+}
+
+// Abs returns the absolute value of the amount
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Mul multiplies the amount by an integer factor
+func (a Amount) Mul(n int64) Amount {
+	return a * Amount(n)
+}
+
+// MulRatio returns a * num / den rounded half away from zero to whole haléře
+func (a Amount) MulRatio(num, den int64) Amount {
+	if den == 0 {
+		return 0
+	}
+	product := int64(a) * num
+	q, r := product/den, product%den
+	if r != 0 && 2*abs64(r) >= abs64(den) {
+		if (product < 0) != (den < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Amount(q)
+}
+
+// RoundKoruny rounds the amount to whole crowns (half away from zero)
+func (a Amount) RoundKoruny() Amount {
+	return a.MulRatio(1, 100) * Koruna
+}
+
+// String returns the canonical decimal form used for storage and JSON:
+// "1000" for whole crowns, "1000.50" otherwise
+func (a Amount) String() string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	if v%100 == 0 {
+		return fmt.Sprintf("%s%d", sign, v/100)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// Format returns the amount for display in Czech notation, e.g. "1 000 Kč"
+// or "-1 000,50 Kč"
+func (a Amount) Format() string {
+	return a.FormatNumber() + " Kč"
+}
+
+// FormatNumber returns the amount in Czech notation without the currency
+func (a Amount) FormatNumber() string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	digits := strconv.FormatInt(v/100, 10)
+	var grouped strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteRune(' ')
+		}
+		grouped.WriteRune(d)
+	}
+
+	if v%100 == 0 {
+		return sign + grouped.String()
+	}
+	return fmt.Sprintf("%s%s,%02d", sign, grouped.String(), v%100)
+}
+
+// Scan implements sql.Scanner for decimal TEXT columns
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	case []byte:
+		parsed, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	case int64:
+		// Integer stored without TEXT affinity means whole crowns
+		*a = FromKoruny(v)
+		return nil
+	case float64:
+		*a = FromFloat(v)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+}
+
+// Value implements driver.Valuer, storing decimal TEXT with two decimals
+// ("1000.00"), so that SQL gets haléře by dropping the decimal point
+func (a Amount) Value() (driver.Value, error) {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100), nil
+}
+
+// MarshalJSON encodes the amount as a decimal string ("1000.50")
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON accepts both a decimal string and a JSON number
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := Parse(s)
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid amount %s", string(data))
+	}
+	parsed, err := Parse(n.String())
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Sum adds up amounts
+func Sum(amounts ...Amount) Amount {
+	var total Amount
+	for _, a := range amounts {
+		total += a
+	}
+	return total
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
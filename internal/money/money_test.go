@@ -0,0 +1,178 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{"1000", 100000},
+		{"1000.50", 100050},
+		{"1000.5", 100050},
+		{"1 000,50", 100050},
+		{"1 000,50 Kč", 100050},
+		{"  250 CZK ", 25000},
+		{"-5", -500},
+		{"+5", 500},
+		{"-0.01", -1},
+		{".5", 50},
+		{"5.", 500},
+		{"1000.000", 100000},
+		{"0", 0},
+		{"007", 700},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{
+		"", " ", "Kč", "-", "+", ".", "-.",
+		"1.+5", "1.-5", "-+5", "+-5", "--5", "+ 5x",
+		"1.234", "1.001", "1.5.5", "1,5,5",
+		"abc", "1e3", "0x10", "1_000", "١٢",
+		"99999999999999999999",
+	} {
+		if got, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		a      Amount
+		str    string
+		format string
+	}{
+		{0, "0", "0 Kč"},
+		{1, "0.01", "0,01 Kč"},
+		{-1, "-0.01", "-0,01 Kč"},
+		{100000, "1000", "1\u00a0000 Kč"},
+		{100050, "1000.50", "1\u00a0000,50 Kč"},
+		{-123456789, "-1234567.89", "-1\u00a0234\u00a0567,89 Kč"},
+		{FromKoruny(100), "100", "100 Kč"},
+	}
+	for _, tt := range tests {
+		if got := tt.a.String(); got != tt.str {
+			t.Errorf("%d.String() = %q, want %q", tt.a, got, tt.str)
+		}
+		if got := tt.a.Format(); got != tt.format {
+			t.Errorf("%d.Format() = %q, want %q", tt.a, got, tt.format)
+		}
+		// Both forms parse back
+		for _, s := range []string{tt.str, tt.format} {
+			if back, err := Parse(s); err != nil || back != tt.a {
+				t.Errorf("Parse(%q) = %d, %v", s, back, err)
+			}
+		}
+	}
+}
+
+func TestScanValue(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{nil, 0},
+		{"1000.50", 100050},
+		{[]byte("-250"), -25000},
+		{int64(300), 30000},
+		{float64(12.345), 1235},
+		{float64(-0.005), -1},
+	}
+	for _, tt := range tests {
+		var a Amount = 42
+		if err := a.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%#v): %v", tt.src, err)
+			continue
+		}
+		if a != tt.want {
+			t.Errorf("Scan(%#v) = %d, want %d", tt.src, a, tt.want)
+		}
+	}
+
+	for _, src := range []interface{}{"1.+5", []byte("x"), true} {
+		var a Amount
+		if err := a.Scan(src); err == nil {
+			t.Errorf("Scan(%#v): no error", src)
+		}
+	}
+
+	for a, want := range map[Amount]string{0: "0.00", 1: "0.01", -1: "-0.01", 100050: "1000.50", -500: "-5.00"} {
+		v, err := a.Value()
+		if err != nil || v != want {
+			t.Errorf("%d.Value() = %#v, %v, want %q", a, v, err, want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(struct{ A Amount }{100050})
+	if err != nil || string(data) != `{"A":"1000.50"}` {
+		t.Errorf("Marshal: %s, %v", data, err)
+	}
+
+	for in, want := range map[string]Amount{`"1000.50"`: 100050, `1000.5`: 100050, `-3`: -300} {
+		var a Amount
+		if err := json.Unmarshal([]byte(in), &a); err != nil || a != want {
+			t.Errorf("Unmarshal(%s) = %d, %v, want %d", in, a, err, want)
+		}
+	}
+	for _, in := range []string{`"1.+5"`, `true`, `"1.234"`} {
+		var a Amount
+		if err := json.Unmarshal([]byte(in), &a); err == nil {
+			t.Errorf("Unmarshal(%s): no error", in)
+		}
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	tests := []struct {
+		a        Amount
+		num, den int64
+		want     Amount
+	}{
+		{100, 1, 3, 33},
+		{200, 1, 3, 67},
+		{150, 1, 100, 2}, // 1.5 rounds away from zero
+		{149, 1, 100, 1},
+		{-150, 1, 100, -2},
+		{-149, 1, 100, -1},
+		{150, -1, 100, -2},
+		{-150, -1, 100, 2},
+		{150, 1, -100, -2},
+		{100000, 15, 31, 48387}, // 1000 Kč for 15 of 31 days
+		{100, 0, 7, 0},
+		{100, 1, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.a.MulRatio(tt.num, tt.den); got != tt.want {
+			t.Errorf("%d.MulRatio(%d, %d) = %d, want %d", tt.a, tt.num, tt.den, got, tt.want)
+		}
+	}
+
+	for a, want := range map[Amount]Amount{149: 100, 150: 200, -150: -200, 100049: 100000} {
+		if got := a.RoundKoruny(); got != want {
+			t.Errorf("%d.RoundKoruny() = %d, want %d", a, got, want)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	for f, want := range map[float64]Amount{0.1 + 0.2: 30, 1000.5: 100050, -12.345: -1235, 0: 0} {
+		if got := FromFloat(f); got != want {
+			t.Errorf("FromFloat(%v) = %d, want %d", f, got, want)
+		}
+	}
+}
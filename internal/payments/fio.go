@@ -0,0 +1,240 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/base48/member-portal/internal/dates"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/fio"
+)
+
+// KindFIO is the payments.kind of transactions on the FIO account
+const KindFIO = "fio"
+
+// FIOCursorName identifies the FIO sync cursor in sync_cursors
+const FIOCursorName = "fio"
+
+// DefaultBackfillWindowDays is the date range fetched by one API request in
+// backfill mode
+const DefaultBackfillWindowDays = 90
+
+// FIOSource fetches transactions from the FIO Bank API.
+//
+// By default it continues from the ID stored in sync_cursors: the FIO
+// download pointer is reset to that ID and only newer transactions are
+// fetched. Without a stored cursor (first run) the last 90 days are fetched.
+// With From set it fetches [From, To] by date in windows of WindowDays
+// (backfill) and leaves the cursor alone.
+type FIOSource struct {
+	Client     *fio.Client
+	Queries    *db.Queries
+	From       time.Time
+	To         time.Time
+	WindowDays int
+
+	// Set by Fetch and Commit
+	Mode       string // "incremental", "initial" or "backfill"
+	CursorFrom int64  // Cursor before the run (incremental mode)
+	CursorTo   int64  // Cursor after the run (incremental mode)
+
+	lastID int64
+}
+
+// Kind implements Source
+func (s *FIOSource) Kind() string {
+	return KindFIO
+}
+
+// Fetch implements Source
+func (s *FIOSource) Fetch(ctx context.Context, logger *log.Logger) ([]Transaction, error) {
+	if !s.From.IsZero() {
+		s.Mode = "backfill"
+		return s.backfill(ctx, logger)
+	}
+
+	cursor, err := s.Queries.GetSyncCursor(ctx, FIOCursorName)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to load sync cursor: %w", err)
+	}
+
+	var st *fio.Statement
+	if err == sql.ErrNoRows {
+		// First run - no cursor yet, start with the last 90 days
+		s.Mode = "initial"
+		now := time.Now()
+		from := now.AddDate(0, 0, -DefaultBackfillWindowDays)
+
+		logger.Printf("No sync cursor yet, fetching FIO transactions from %s to %s...",
+			fio.FormatDate(from), fio.FormatDate(now))
+
+		st, err = s.Client.FetchPeriod(ctx, fio.FormatDate(from), fio.FormatDate(now))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch transactions: %w", err)
+		}
+	} else {
+		s.Mode = "incremental"
+		s.CursorFrom = cursor.LastID
+
+		// Align FIO's download pointer with our cursor, in case it was moved
+		// by another client or a previous run failed after downloading
+		logger.Printf("Fetching FIO transactions after ID %d...", cursor.LastID)
+		if err := s.Client.SetLastID(ctx, cursor.LastID); err != nil {
+			return nil, fmt.Errorf("failed to set FIO download pointer: %w", err)
+		}
+
+		st, err = s.Client.FetchSinceLastDownload(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch transactions: %w", err)
+		}
+	}
+
+	s.CursorTo = s.CursorFrom
+	s.lastID = st.LastID()
+	return FromFIO(st.Transactions), nil
+}
+
+// Commit moves the sync cursor to the last fetched transaction
+func (s *FIOSource) Commit(ctx context.Context, logger *log.Logger) error {
+	if s.Mode == "backfill" {
+		return nil
+	}
+
+	if s.lastID <= s.CursorFrom {
+		logger.Println("✓ No new transactions to sync")
+		return nil
+	}
+
+	if _, err := s.Queries.SetSyncCursor(ctx, db.SetSyncCursorParams{
+		Name:   FIOCursorName,
+		LastID: s.lastID,
+	}); err != nil {
+		return fmt.Errorf("failed to save sync cursor: %w", err)
+	}
+	s.CursorTo = s.lastID
+	logger.Printf("✓ Sync cursor moved from %d to %d", s.CursorFrom, s.lastID)
+
+	return nil
+}
+
+// backfill fetches a date range in API-sized windows. The FIO client waits
+// between requests to respect the rate limit.
+func (s *FIOSource) backfill(ctx context.Context, logger *log.Logger) ([]Transaction, error) {
+	to := s.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if to.Before(s.From) {
+		return nil, fmt.Errorf("invalid backfill range: %s is after %s", fio.FormatDate(s.From), fio.FormatDate(to))
+	}
+
+	windowDays := s.WindowDays
+	if windowDays <= 0 {
+		windowDays = DefaultBackfillWindowDays
+	}
+
+	windows := backfillWindows(s.From, to, windowDays)
+	logger.Printf("Backfilling FIO transactions from %s to %s in %d request(s)...",
+		fio.FormatDate(s.From), fio.FormatDate(to), len(windows))
+
+	var transactions []Transaction
+	for i, w := range windows {
+		logger.Printf("[%d/%d] Fetching %s to %s...", i+1, len(windows), fio.FormatDate(w.From), fio.FormatDate(w.To))
+
+		txs, err := s.Client.FetchTransactionsByPeriod(ctx, fio.FormatDate(w.From), fio.FormatDate(w.To))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch transactions for %s to %s: %w", fio.FormatDate(w.From), fio.FormatDate(w.To), err)
+		}
+
+		logger.Printf("Fetched %d transactions", len(txs))
+		transactions = append(transactions, FromFIO(txs)...)
+	}
+
+	return transactions, nil
+}
+
+// dateWindow is an inclusive range of days
+type dateWindow struct {
+	From time.Time
+	To   time.Time
+}
+
+// backfillWindows splits [from, to] into consecutive windows of at most days days
+func backfillWindows(from, to time.Time, days int) []dateWindow {
+	var windows []dateWindow
+	for start := from; !start.After(to); start = start.AddDate(0, 0, days) {
+		end := start.AddDate(0, 0, days-1)
+		if end.After(to) {
+			end = to
+		}
+		windows = append(windows, dateWindow{From: start, To: end})
+	}
+	return windows
+}
+
+// FIOStatementSource reads transactions from a statement exported from FIO
+// internet banking (GPC/ABO, CSV or CAMT.053 XML). They are stored with kind
+// 'fio' and the bank's transaction ID, like the API sync.
+type FIOStatementSource struct {
+	Format fio.FileFormat
+	Data   []byte
+}
+
+// NewFIOStatementSource detects the format of a statement file
+func NewFIOStatementSource(filename string, data []byte) (*FIOStatementSource, error) {
+	format, err := fio.DetectFormat(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	return &FIOStatementSource{Format: format, Data: data}, nil
+}
+
+// Kind implements Source
+func (s *FIOStatementSource) Kind() string {
+	return KindFIO
+}
+
+// Fetch implements Source
+func (s *FIOStatementSource) Fetch(ctx context.Context, logger *log.Logger) ([]Transaction, error) {
+	transactions, err := fio.ParseStatementFile(s.Format, s.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s statement: %w", s.Format, err)
+	}
+	return FromFIO(transactions), nil
+}
+
+// FromFIO normalizes FIO transactions
+func FromFIO(transactions []fio.Transaction) []Transaction {
+	result := make([]Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		// FIO dates carry a +0100/+0200 offset which the SQLite driver stores
+		// in a format it cannot read back - keep just the day
+		date, err := fio.ParseDate(tx.Date)
+		if err != nil {
+			date = time.Now() // fallback
+		}
+		date = dates.Day(date)
+
+		// Build remote account string (account + bank code)
+		remoteAccount := tx.AccountNumber
+		if tx.BankCode != "" {
+			remoteAccount = fmt.Sprintf("%s/%s", tx.AccountNumber, tx.BankCode)
+		}
+
+		result = append(result, Transaction{
+			KindID:         fmt.Sprintf("%d", tx.ID),
+			Date:           date,
+			Amount:         tx.Amount,
+			LocalAccount:   "FIO", // Could be parsed from API info
+			RemoteAccount:  remoteAccount,
+			RemoteName:     tx.AccountName,
+			VariableSymbol: tx.VariableSymbol,
+			Message:        tx.Message,
+			Raw:            tx,
+		})
+	}
+	return result
+}
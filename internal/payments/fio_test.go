@@ -0,0 +1,44 @@
+package payments
+
+import (
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/fio"
+)
+
+func TestBackfillWindows(t *testing.T) {
+	day := func(s string) time.Time {
+		t, _ := time.Parse("2006-01-02", s)
+		return t
+	}
+
+	tests := []struct {
+		from, to string
+		days     int
+		want     []string
+	}{
+		{"2024-01-01", "2024-01-01", 90, []string{"2024-01-01/2024-01-01"}},
+		{"2024-01-01", "2024-03-30", 90, []string{"2024-01-01/2024-03-30"}},
+		{"2024-01-01", "2024-03-31", 90, []string{"2024-01-01/2024-03-30", "2024-03-31/2024-03-31"}},
+		{"2024-01-01", "2024-01-10", 4, []string{"2024-01-01/2024-01-04", "2024-01-05/2024-01-08", "2024-01-09/2024-01-10"}},
+		{"2024-02-01", "2024-01-01", 30, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"_"+tt.to, func(t *testing.T) {
+			var got []string
+			for _, w := range backfillWindows(day(tt.from), day(tt.to), tt.days) {
+				got = append(got, fio.FormatDate(w.From)+"/"+fio.FormatDate(w.To))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("window %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
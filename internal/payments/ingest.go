@@ -0,0 +1,241 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/base48/member-portal/internal/db"
+)
+
+// Ingest fetches transactions from the source and stores them. With dryRun
+// the database is only read and the source is not committed.
+func Ingest(ctx context.Context, queries *db.Queries, logger *log.Logger, src Source, dryRun bool) (*Result, error) {
+	transactions, err := src.Fetch(ctx, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Printf("Fetched %d transactions from %s", len(transactions), src.Kind())
+	result := &Result{Fetched: len(transactions)}
+
+	for _, tx := range transactions {
+		result.Outcomes = append(result.Outcomes, Store(ctx, queries, logger, src.Kind(), tx, result, dryRun))
+	}
+
+	if result.Fetched > 0 {
+		result.LogSummary(logger)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	if c, ok := src.(Committer); ok {
+		if result.Errors > 0 {
+			logger.Printf("⚠ Not committing %s because of errors, the next run will retry", src.Kind())
+		} else if err := c.Commit(ctx, logger); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// Match is the result of matching a transaction by variable symbol
+type Match struct {
+	VariableSymbol string // VS used for matching (may come from the message)
+	UserID         sql.NullInt64
+	ProjectID      sql.NullInt64
+}
+
+// MatchTransaction finds the user (by current or previous payments_id) or the
+// project the transaction belongs to. A zero Match with a nil error means unmatched.
+func MatchTransaction(ctx context.Context, queries *db.Queries, tx Transaction) (Match, error) {
+	// IMPORTANT: VS is NOT the user.id, it's the user.payments_id!
+	// Edge case: Some users put VS in Message field instead of VS field
+	m := Match{VariableSymbol: tx.VariableSymbol}
+	if m.VariableSymbol == "" && isNumeric(tx.Message) {
+		m.VariableSymbol = tx.Message
+	}
+	if m.VariableSymbol == "" {
+		return m, nil
+	}
+
+	vs := sql.NullString{String: m.VariableSymbol, Valid: true}
+
+	user, err := queries.GetUserByPaymentsID(ctx, vs)
+	if err == nil {
+		m.UserID = sql.NullInt64{Int64: user.ID, Valid: true}
+		return m, nil
+	} else if err != sql.ErrNoRows {
+		return m, fmt.Errorf("failed to look up user by payments_id '%s': %w", m.VariableSymbol, err)
+	}
+
+	// A previous VS of a member (e.g. a standing order not updated after the
+	// VS was reassigned) still belongs to them
+	userID, err := queries.GetUserIDByPreviousPaymentsID(ctx, m.VariableSymbol)
+	if err == nil {
+		m.UserID = sql.NullInt64{Int64: userID, Valid: true}
+		return m, nil
+	} else if err != sql.ErrNoRows {
+		return m, fmt.Errorf("failed to look up previous payments_id '%s': %w", m.VariableSymbol, err)
+	}
+
+	project, err := queries.GetProjectByPaymentsID(ctx, vs)
+	if err == nil {
+		m.ProjectID = sql.NullInt64{Int64: project.ID, Valid: true}
+		return m, nil
+	} else if err != sql.ErrNoRows {
+		return m, fmt.Errorf("failed to look up project by payments_id '%s': %w", m.VariableSymbol, err)
+	}
+
+	return m, nil
+}
+
+// Store saves a single transaction as a payment of the given kind and
+// updates the counters. With dryRun the database is only read.
+func Store(ctx context.Context, queries *db.Queries, logger *log.Logger, kind string, tx Transaction, result *Result, dryRun bool) Outcome {
+	outcome := Outcome{Transaction: tx}
+
+	// Skip transactions with zero or negative amounts (outgoing payments, fees, etc.)
+	// Only process incoming payments (positive amounts)
+	if !tx.Amount.IsPositive() {
+		result.Skipped++
+		outcome.Action = ActionSkip
+		outcome.Note = "Outgoing payment"
+		return outcome
+	}
+
+	match, err := MatchTransaction(ctx, queries, tx)
+	outcome.VariableSymbol = match.VariableSymbol
+	outcome.UserID = match.UserID
+	outcome.ProjectID = match.ProjectID
+
+	// A payment stored unmatched would not be matched again by the next run,
+	// so it is not stored: the error keeps the source uncommitted to retry it
+	if err != nil {
+		logger.Printf("⚠ Database error: %v", err)
+		result.Errors++
+		outcome.Action = ActionError
+		outcome.Note = err.Error()
+		return outcome
+	}
+
+	switch {
+	case match.VariableSymbol == "":
+		logger.Printf("⚠ Empty VS - %s from %s", tx.Amount.Format(), tx.RemoteName)
+		result.EmptyVS = append(result.EmptyVS, tx)
+		outcome.Note = "Empty VS"
+	case !match.UserID.Valid && !match.ProjectID.Valid:
+		logger.Printf("⚠ User with payments_id (VS) '%s' not found in database (%s from %s)",
+			match.VariableSymbol, tx.Amount.Format(), tx.RemoteName)
+		result.UnmatchedVS = append(result.UnmatchedVS, tx)
+		outcome.Note = "Unknown VS"
+	case match.VariableSymbol != tx.VariableSymbol:
+		logger.Printf("ℹ Using Message field as VS: '%s' (%s from %s)", match.VariableSymbol, tx.Amount.Format(), tx.RemoteName)
+	}
+	if match.ProjectID.Valid {
+		outcome.Note = "Project payment"
+	}
+
+	// Prepare raw data JSON
+	rawDataJSON, err := json.Marshal(tx.Raw)
+	if err != nil || tx.Raw == nil {
+		rawDataJSON = []byte("{}")
+	}
+
+	params := db.UpsertPaymentParams{
+		UserID:         match.UserID,
+		ProjectID:      match.ProjectID,
+		Date:           tx.Date,
+		Amount:         tx.Amount,
+		Kind:           kind,
+		KindID:         tx.KindID,
+		LocalAccount:   tx.LocalAccount,
+		RemoteAccount:  tx.RemoteAccount,
+		Identification: match.VariableSymbol,
+		RawData:        sql.NullString{String: string(rawDataJSON), Valid: true},
+		StaffComment:   sql.NullString{},
+	}
+
+	// Check if payment already exists
+	existingPayment, err := queries.GetPaymentByKindAndID(ctx, db.GetPaymentByKindAndIDParams{
+		Kind:   kind,
+		KindID: tx.KindID,
+	})
+
+	if err == sql.ErrNoRows {
+		outcome.Action = ActionInsert
+		if dryRun {
+			result.Inserted++
+			return outcome
+		}
+
+		if _, err := queries.UpsertPayment(ctx, params); err != nil {
+			logger.Printf("✗ Failed to insert payment (%s %s): %v", kind, tx.KindID, err)
+			result.Errors++
+			outcome.Action = ActionError
+			outcome.Note = err.Error()
+		} else {
+			logger.Printf("✓ Inserted payment: %s from %s (VS: %s, %s ID: %s)",
+				tx.Amount.Format(), tx.RemoteName, tx.VariableSymbol, kind, tx.KindID)
+			result.Inserted++
+		}
+		return outcome
+	} else if err != nil {
+		logger.Printf("⚠ Error checking existing payment: %v", err)
+		result.Errors++
+		outcome.Action = ActionError
+		outcome.Note = err.Error()
+		return outcome
+	}
+
+	// Payment exists - update only if it is newly matched. Never unassign a
+	// payment that was assigned manually.
+	newUser := match.UserID.Valid && (!existingPayment.UserID.Valid || existingPayment.UserID.Int64 != match.UserID.Int64)
+	newProject := match.ProjectID.Valid && !existingPayment.ProjectID.Valid && !existingPayment.UserID.Valid
+	if !newUser && !newProject {
+		result.Skipped++
+		outcome.Action = ActionSkip
+		outcome.Note = "Already imported"
+		return outcome
+	}
+
+	outcome.Action = ActionUpdate
+	if dryRun {
+		result.Updated++
+		return outcome
+	}
+
+	if !match.ProjectID.Valid {
+		params.ProjectID = existingPayment.ProjectID // Preserve project assignment
+	}
+	params.StaffComment = existingPayment.StaffComment // Preserve staff comment
+
+	if _, err := queries.UpsertPayment(ctx, params); err != nil {
+		logger.Printf("✗ Failed to update payment (%s %s): %v", kind, tx.KindID, err)
+		result.Errors++
+		outcome.Action = ActionError
+		outcome.Note = err.Error()
+	} else {
+		logger.Printf("↻ Updated payment: %s (%s ID: %s)", tx.Amount.Format(), kind, tx.KindID)
+		result.Updated++
+	}
+	return outcome
+}
+
+// isNumeric reports whether s is a non-empty string of digits (likely a VS)
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
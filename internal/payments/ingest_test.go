@@ -0,0 +1,216 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// sliceSource is a source with fixed transactions, e.g. a cash box
+type sliceSource struct {
+	transactions []Transaction
+	committed    int
+}
+
+func (s *sliceSource) Kind() string { return "cash" }
+
+func (s *sliceSource) Fetch(ctx context.Context, logger *log.Logger) ([]Transaction, error) {
+	return s.transactions, nil
+}
+
+func (s *sliceSource) Commit(ctx context.Context, logger *log.Logger) error {
+	s.committed++
+	return nil
+}
+
+func TestIngest(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+
+	user, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "novak@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "1001", Valid: true},
+		State:             "accepted",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	project, err := queries.CreateProject(ctx, db.CreateProjectParams{
+		Name:       "3D tiskárna",
+		PaymentsID: sql.NullString{String: "7001", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	day := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	src := &sliceSource{transactions: []Transaction{
+		{KindID: "1", Date: day, Amount: money.FromKoruny(1000), VariableSymbol: "1001"},
+		{KindID: "2", Date: day, Amount: money.FromKoruny(500), Message: "1001"},
+		{KindID: "3", Date: day, Amount: money.FromKoruny(200), VariableSymbol: "7001"},
+		{KindID: "4", Date: day, Amount: money.FromKoruny(300), VariableSymbol: "9999"},
+		{KindID: "5", Date: day, Amount: money.FromKoruny(-100)},
+	}}
+
+	// Dry run writes nothing and does not commit
+	result, err := Ingest(ctx, queries, logger, src, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if result.Inserted != 4 || src.committed != 0 {
+		t.Errorf("dry run: %d inserted, %d commits; want 4 and 0", result.Inserted, src.committed)
+	}
+
+	result, err = Ingest(ctx, queries, logger, src, false)
+	if err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if result.Inserted != 4 || result.Skipped != 1 || result.Unmatched() != 1 || src.committed != 1 {
+		t.Errorf("got %d inserted, %d skipped, %d unmatched, %d commits; want 4, 1, 1, 1",
+			result.Inserted, result.Skipped, result.Unmatched(), src.committed)
+	}
+
+	want := []struct {
+		action  string
+		user    bool
+		project bool
+	}{
+		{ActionInsert, true, false},
+		{ActionInsert, true, false},
+		{ActionInsert, false, true},
+		{ActionInsert, false, false},
+		{ActionSkip, false, false},
+	}
+	for i, w := range want {
+		o := result.Outcomes[i]
+		if o.Action != w.action || o.UserID.Valid != w.user || o.ProjectID.Valid != w.project {
+			t.Errorf("#%d: got %s user=%v project=%v, want %s user=%v project=%v",
+				i, o.Action, o.UserID.Valid, o.ProjectID.Valid, w.action, w.user, w.project)
+		}
+	}
+
+	payment, err := queries.GetPaymentByKindAndID(ctx, db.GetPaymentByKindAndIDParams{Kind: "cash", KindID: "3"})
+	if err != nil {
+		t.Fatalf("get payment: %v", err)
+	}
+	if payment.ProjectID.Int64 != project.ID {
+		t.Errorf("project payment has project_id %v, want %d", payment.ProjectID, project.ID)
+	}
+
+	payment, err = queries.GetPaymentByKindAndID(ctx, db.GetPaymentByKindAndIDParams{Kind: "cash", KindID: "2"})
+	if err != nil {
+		t.Fatalf("get payment: %v", err)
+	}
+	if payment.UserID.Int64 != user.ID || payment.Identification != "1001" {
+		t.Errorf("VS in message: got user %v, identification %q", payment.UserID, payment.Identification)
+	}
+
+	// Second run finds everything already stored
+	result, err = Ingest(ctx, queries, logger, src, false)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if result.Inserted != 0 || result.Updated != 0 || result.Skipped != 5 {
+		t.Errorf("second run: %d inserted, %d updated, %d skipped; want 0, 0, 5", result.Inserted, result.Updated, result.Skipped)
+	}
+}
+
+func TestMatchPreviousPaymentsID(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+
+	user, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "novak@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "1002", Valid: true},
+		State:             "accepted",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := queries.CreatePaymentsIDHistory(ctx, db.CreatePaymentsIDHistoryParams{
+		UserID:     user.ID,
+		PaymentsID: "1001",
+		ReplacedBy: sql.NullString{String: "1002", Valid: true},
+	}); err != nil {
+		t.Fatalf("create history: %v", err)
+	}
+
+	// A standing order still sending the previous VS
+	m, err := MatchTransaction(ctx, queries, Transaction{Amount: money.FromKoruny(1000), VariableSymbol: "1001"})
+	if err != nil {
+		t.Fatalf("MatchTransaction: %v", err)
+	}
+	if m.UserID.Int64 != user.ID {
+		t.Errorf("previous VS matched user %v, want %d", m.UserID, user.ID)
+	}
+}
+
+func TestIngestMatchError(t *testing.T) {
+	database := dbtest.Open(t)
+	queries := db.New(database)
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+
+	user, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "novak@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "1002", Valid: true},
+		State:             "accepted",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := queries.CreatePaymentsIDHistory(ctx, db.CreatePaymentsIDHistoryParams{
+		UserID:     user.ID,
+		PaymentsID: "1001",
+		ReplacedBy: sql.NullString{String: "1002", Valid: true},
+	}); err != nil {
+		t.Fatalf("create history: %v", err)
+	}
+
+	// The lookup of the previous VS fails
+	if _, err := database.Exec(`ALTER TABLE payments_id_history RENAME TO payments_id_history_off`); err != nil {
+		t.Fatal(err)
+	}
+	src := &sliceSource{transactions: []Transaction{
+		{KindID: "1", Date: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), Amount: money.FromKoruny(1000), VariableSymbol: "1001"},
+	}}
+
+	result, err := Ingest(ctx, queries, logger, src, false)
+	if err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if result.Errors != 1 || result.Inserted != 0 || src.committed != 0 || result.Outcomes[0].Action != ActionError {
+		t.Errorf("got %d errors, %d inserted, %d commits, %s; want 1, 0, 0, %s",
+			result.Errors, result.Inserted, src.committed, result.Outcomes[0].Action, ActionError)
+	}
+	if _, err := queries.GetPaymentByKindAndID(ctx, db.GetPaymentByKindAndIDParams{Kind: "cash", KindID: "1"}); err != sql.ErrNoRows {
+		t.Errorf("payment stored despite the error: %v", err)
+	}
+
+	// The next run matches it
+	if _, err := database.Exec(`ALTER TABLE payments_id_history_off RENAME TO payments_id_history`); err != nil {
+		t.Fatal(err)
+	}
+	result, err = Ingest(ctx, queries, logger, src, false)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if result.Inserted != 1 || src.committed != 1 || result.Outcomes[0].UserID.Int64 != user.ID {
+		t.Errorf("second run: %d inserted, %d commits, user %v; want 1, 1, %d",
+			result.Inserted, src.committed, result.Outcomes[0].UserID, user.ID)
+	}
+}
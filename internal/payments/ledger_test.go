@@ -0,0 +1,126 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/fio"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestListPaymentsFiltered(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+
+	user, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "novak@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		PaymentsID:        sql.NullString{String: "1001", Valid: true},
+		State:             "accepted",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	src := &sliceSource{transactions: FromFIO([]fio.Transaction{
+		{ID: 1, Date: "2024-01-05+0100", Amount: money.FromKoruny(1000), VariableSymbol: "1001", AccountNumber: "123", BankCode: "0800", Message: "Členský příspěvek leden"},
+		{ID: 2, Date: "2024-02-05+0100", Amount: money.FromKoruny(1000), VariableSymbol: "1001", AccountNumber: "123", BankCode: "0800", Message: "Členský příspěvek únor"},
+		{ID: 3, Date: "2024-02-10+0100", Amount: money.FromKoruny(250), AccountNumber: "456", BankCode: "2010", Message: "Dar na pivo"},
+	})}
+	if _, err := Ingest(ctx, queries, logger, src, false); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	manual, err := CreateManual(ctx, queries, ManualPayment{
+		UserID:       sql.NullInt64{Int64: user.ID, Valid: true},
+		Date:         time.Date(2024, 2, 20, 0, 0, 0, 0, time.UTC),
+		Amount:       money.FromKoruny(400),
+		Method:       MethodCash,
+		StaffComment: "Převzal Pepa",
+	})
+	if err != nil {
+		t.Fatalf("CreateManual: %v", err)
+	}
+	if _, err := VoidManual(ctx, queries, manual.ID, "omylem"); err != nil {
+		t.Fatalf("VoidManual: %v", err)
+	}
+
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	halere := func(koruny int64) sql.NullInt64 {
+		return sql.NullInt64{Int64: money.FromKoruny(koruny).Halere(), Valid: true}
+	}
+
+	tests := []struct {
+		name      string
+		params    db.ListPaymentsFilteredParams
+		wantCount int
+		wantTotal money.Amount
+	}{
+		{"all", db.ListPaymentsFilteredParams{}, 4, money.FromKoruny(2250)},
+		{"date range", db.ListPaymentsFilteredParams{DateFrom: str("2024-02-01"), DateTo: str("2024-02-10")}, 2, money.FromKoruny(1250)},
+		{"kind", db.ListPaymentsFilteredParams{Kind: str(KindManual)}, 1, 0},
+		{"amount range", db.ListPaymentsFilteredParams{AmountMin: halere(300), AmountMax: halere(999)}, 1, 0},
+		{"vs", db.ListPaymentsFilteredParams{Vs: str("1001")}, 3, money.FromKoruny(2000)}, // manual payments carry the member VS too
+		{"remote account", db.ListPaymentsFilteredParams{RemoteAccount: str("456")}, 1, money.FromKoruny(250)},
+		{"unassigned", db.ListPaymentsFilteredParams{Assigned: sql.NullBool{Bool: false, Valid: true}}, 1, money.FromKoruny(250)},
+		{"user", db.ListPaymentsFilteredParams{UserID: sql.NullInt64{Int64: user.ID, Valid: true}}, 3, money.FromKoruny(2000)},
+		{"message", db.ListPaymentsFilteredParams{Search: str("příspěvek")}, 2, money.FromKoruny(2000)},
+		{"staff comment", db.ListPaymentsFilteredParams{Search: str("pepa")}, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := tt.params
+			params.Limit = -1
+
+			list, err := queries.ListPaymentsFiltered(ctx, params)
+			if err != nil {
+				t.Fatalf("ListPaymentsFiltered: %v", err)
+			}
+			if len(list) != tt.wantCount {
+				t.Errorf("got %d payments, want %d", len(list), tt.wantCount)
+			}
+
+			summary, err := queries.SummarizePaymentsFiltered(ctx, db.SummarizePaymentsFilteredParams{
+				DateFrom:      params.DateFrom,
+				DateTo:        params.DateTo,
+				Kind:          params.Kind,
+				AmountMin:     params.AmountMin,
+				AmountMax:     params.AmountMax,
+				Vs:            params.Vs,
+				RemoteAccount: params.RemoteAccount,
+				Assigned:      params.Assigned,
+				UserID:        params.UserID,
+				ProjectID:     params.ProjectID,
+				Search:        params.Search,
+			})
+			if err != nil {
+				t.Fatalf("SummarizePaymentsFiltered: %v", err)
+			}
+			if summary.Count != int64(tt.wantCount) || money.FromHalere(summary.Total) != tt.wantTotal {
+				t.Errorf("summary: got %d payments, %s; want %d, %s",
+					summary.Count, money.FromHalere(summary.Total), tt.wantCount, tt.wantTotal)
+			}
+		})
+	}
+
+	// Newest first, paged
+	page, err := queries.ListPaymentsFiltered(ctx, db.ListPaymentsFilteredParams{Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatalf("ListPaymentsFiltered: %v", err)
+	}
+	if len(page) != 2 || page[0].KindID != "3" || page[1].KindID != "2" {
+		t.Errorf("second page: got %d payments starting with %v", len(page), page)
+	}
+	if got := RawMessage(page[0].RawData); got != "Dar na pivo" {
+		t.Errorf("RawMessage = %q, want %q", got, "Dar na pivo")
+	}
+}
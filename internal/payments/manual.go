@@ -0,0 +1,166 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/dates"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
+)
+
+// KindManual is the payments.kind of payments entered in the admin UI. They
+// count towards the user's balance regardless of the VS.
+const KindManual = "manual"
+
+// Methods of manual payments, stored in payments.local_account
+const (
+	MethodCash   = "cash"    // Paid in cash at the space
+	MethodInKind = "in_kind" // Material or work instead of money
+)
+
+// ErrNotEditable is returned when changing a payment that is not manual or
+// was already voided
+var ErrNotEditable = errors.New("only manual payments that are not voided can be changed")
+
+// ManualPayment is a payment entered by an admin for a user or a project
+type ManualPayment struct {
+	UserID       sql.NullInt64
+	ProjectID    sql.NullInt64
+	Date         time.Time
+	Amount       money.Amount
+	Method       string
+	StaffComment string
+	RecordedBy   sql.NullInt64 // Admin who entered the payment
+}
+
+// Validate checks the payment before it is stored
+func (m ManualPayment) Validate() error {
+	if m.UserID.Valid == m.ProjectID.Valid {
+		return fmt.Errorf("payment must be assigned to either a user or a project")
+	}
+	if !m.Amount.IsPositive() {
+		return fmt.Errorf("amount must be positive")
+	}
+	if m.Date.IsZero() {
+		return fmt.Errorf("date is required")
+	}
+	if m.Date.After(time.Now()) {
+		return fmt.Errorf("date cannot be in the future")
+	}
+	if m.Method != MethodCash && m.Method != MethodInKind {
+		return fmt.Errorf("unknown payment method '%s'", m.Method)
+	}
+	return nil
+}
+
+// CreateManual stores a new manual payment
+func CreateManual(ctx context.Context, queries *db.Queries, m ManualPayment) (db.Payment, error) {
+	if err := m.Validate(); err != nil {
+		return db.Payment{}, err
+	}
+
+	identification, err := manualIdentification(ctx, queries, m)
+	if err != nil {
+		return db.Payment{}, err
+	}
+
+	return queries.CreateManualPayment(ctx, db.CreateManualPaymentParams{
+		UserID:         m.UserID,
+		ProjectID:      m.ProjectID,
+		Date:           dates.Day(m.Date),
+		Amount:         m.Amount,
+		LocalAccount:   m.Method,
+		Identification: identification,
+		StaffComment:   nullString(m.StaffComment),
+		RecordedBy:     m.RecordedBy,
+	})
+}
+
+// UpdateManual changes a manual payment. RecordedBy is kept from the original.
+func UpdateManual(ctx context.Context, queries *db.Queries, id int64, m ManualPayment) (db.Payment, error) {
+	if err := m.Validate(); err != nil {
+		return db.Payment{}, err
+	}
+
+	identification, err := manualIdentification(ctx, queries, m)
+	if err != nil {
+		return db.Payment{}, err
+	}
+
+	payment, err := queries.UpdateManualPayment(ctx, db.UpdateManualPaymentParams{
+		UserID:         m.UserID,
+		ProjectID:      m.ProjectID,
+		Date:           dates.Day(m.Date),
+		Amount:         m.Amount,
+		LocalAccount:   m.Method,
+		Identification: identification,
+		StaffComment:   nullString(m.StaffComment),
+		ID:             id,
+	})
+	if err == sql.ErrNoRows {
+		return payment, ErrNotEditable
+	}
+	return payment, err
+}
+
+// VoidManual marks a manual payment as voided. The payment stays in the
+// ledger but no longer counts towards any balance; the reason is appended to
+// the staff comment.
+func VoidManual(ctx context.Context, queries *db.Queries, id int64, reason string) (db.Payment, error) {
+	payment, err := queries.GetPayment(ctx, id)
+	if err == sql.ErrNoRows {
+		return payment, ErrNotEditable
+	} else if err != nil {
+		return payment, err
+	}
+
+	comment := "Storno"
+	if reason = strings.TrimSpace(reason); reason != "" {
+		comment += ": " + reason
+	}
+	if payment.StaffComment.Valid && payment.StaffComment.String != "" {
+		comment = payment.StaffComment.String + "\n" + comment
+	}
+
+	payment, err = queries.VoidManualPayment(ctx, db.VoidManualPaymentParams{
+		StaffComment: nullString(comment),
+		ID:           id,
+	})
+	if err == sql.ErrNoRows {
+		return payment, ErrNotEditable
+	}
+	return payment, err
+}
+
+// manualIdentification returns the VS stored with a manual payment: the
+// user's payments_id or the project's VS, so the payment shows up wherever
+// payments are listed by VS
+func manualIdentification(ctx context.Context, queries *db.Queries, m ManualPayment) (string, error) {
+	if m.UserID.Valid {
+		user, err := queries.GetUserByID(ctx, m.UserID.Int64)
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("user %d not found", m.UserID.Int64)
+		} else if err != nil {
+			return "", err
+		}
+		return user.PaymentsID.String, nil
+	}
+
+	project, err := queries.GetProject(ctx, m.ProjectID.Int64)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("project %d not found", m.ProjectID.Int64)
+	} else if err != nil {
+		return "", err
+	}
+	return project.PaymentsID.String, nil
+}
+
+func nullString(s string) sql.NullString {
+	s = strings.TrimSpace(s)
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,146 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestManualPayments(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+
+	// A member without a VS can still pay in cash
+	user, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:             "hotovost@example.com",
+		LevelID:           1,
+		LevelActualAmount: money.FromKoruny(1000),
+		State:             "accepted",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	userID := sql.NullInt64{Int64: user.ID, Valid: true}
+
+	balance := func() money.Amount {
+		t.Helper()
+		b, err := queries.GetUserBalance(ctx, db.GetUserBalanceParams{UserID: userID, UserID_2: user.ID})
+		if err != nil {
+			t.Fatalf("get balance: %v", err)
+		}
+		return money.FromHalere(b)
+	}
+
+	m := ManualPayment{
+		UserID:     userID,
+		Date:       time.Date(2024, 3, 1, 18, 30, 0, 0, time.Local),
+		Amount:     money.FromKoruny(600),
+		Method:     MethodCash,
+		RecordedBy: userID,
+	}
+
+	first, err := CreateManual(ctx, queries, m)
+	if err != nil {
+		t.Fatalf("CreateManual: %v", err)
+	}
+	second, err := CreateManual(ctx, queries, m)
+	if err != nil {
+		t.Fatalf("CreateManual: %v", err)
+	}
+	if first.Kind != KindManual || first.KindID != "1" || second.KindID != "2" {
+		t.Errorf("got %s/%s and %s/%s, want manual/1 and manual/2", first.Kind, first.KindID, second.Kind, second.KindID)
+	}
+	if !first.Date.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Date = %v, want the day only", first.Date)
+	}
+	if got, want := balance(), money.FromKoruny(1200); got != want {
+		t.Errorf("balance = %s, want %s", got, want)
+	}
+
+	m.Amount = money.FromKoruny(400)
+	m.Method = MethodInKind
+	m.StaffComment = "filament"
+	updated, err := UpdateManual(ctx, queries, second.ID, m)
+	if err != nil {
+		t.Fatalf("UpdateManual: %v", err)
+	}
+	if updated.LocalAccount != MethodInKind || updated.StaffComment.String != "filament" || updated.RecordedBy != userID {
+		t.Errorf("updated payment = %+v", updated)
+	}
+	if got, want := balance(), money.FromKoruny(1000); got != want {
+		t.Errorf("balance after edit = %s, want %s", got, want)
+	}
+
+	voided, err := VoidManual(ctx, queries, second.ID, "zadáno omylem")
+	if err != nil {
+		t.Fatalf("VoidManual: %v", err)
+	}
+	if !voided.VoidedAt.Valid || voided.StaffComment.String != "filament\nStorno: zadáno omylem" {
+		t.Errorf("voided payment = %+v", voided)
+	}
+	if got, want := balance(), money.FromKoruny(600); got != want {
+		t.Errorf("balance after void = %s, want %s", got, want)
+	}
+
+	// Voided payments cannot be changed again
+	if _, err := UpdateManual(ctx, queries, second.ID, m); err != ErrNotEditable {
+		t.Errorf("UpdateManual on voided payment: err = %v, want ErrNotEditable", err)
+	}
+	if _, err := VoidManual(ctx, queries, second.ID, ""); err != ErrNotEditable {
+		t.Errorf("VoidManual on voided payment: err = %v, want ErrNotEditable", err)
+	}
+
+	// Bank payments are not editable as manual payments
+	bank, err := queries.UpsertPayment(ctx, db.UpsertPaymentParams{
+		Date:   time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+		Amount: money.FromKoruny(100),
+		Kind:   KindFIO,
+		KindID: "26000000001",
+	})
+	if err != nil {
+		t.Fatalf("insert bank payment: %v", err)
+	}
+	if _, err := VoidManual(ctx, queries, bank.ID, ""); err != ErrNotEditable {
+		t.Errorf("VoidManual on bank payment: err = %v, want ErrNotEditable", err)
+	}
+}
+
+func TestManualPaymentValidate(t *testing.T) {
+	valid := ManualPayment{
+		UserID: sql.NullInt64{Int64: 1, Valid: true},
+		Date:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Amount: money.FromKoruny(100),
+		Method: MethodCash,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid payment: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(m *ManualPayment)
+	}{
+		{"no payee", func(m *ManualPayment) { m.UserID = sql.NullInt64{} }},
+		{"user and project", func(m *ManualPayment) { m.ProjectID = sql.NullInt64{Int64: 1, Valid: true} }},
+		{"zero amount", func(m *ManualPayment) { m.Amount = money.Zero }},
+		{"negative amount", func(m *ManualPayment) { m.Amount = money.FromKoruny(-100) }},
+		{"no date", func(m *ManualPayment) { m.Date = time.Time{} }},
+		{"future date", func(m *ManualPayment) { m.Date = time.Now().AddDate(0, 0, 2) }},
+		{"unknown method", func(m *ManualPayment) { m.Method = "card" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := valid
+			tt.modify(&m)
+			if err := m.Validate(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Package payments stores incoming bank transactions as payments. Each
+// ingester (FIO API, FIO statement files, later other accounts or a cash box)
+// implements Source and only normalizes its data to Transaction; matching to
+// users and projects by variable symbol, deduplication and reporting of
+// unmatched payments are shared.
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/base48/member-portal/internal/money"
+)
+
+// Transaction is a normalized incoming or outgoing bank transaction
+type Transaction struct {
+	KindID         string       // Stable ID within the source kind (payments.kind_id)
+	Date           time.Time    // Booking day
+	Amount         money.Amount // Negative for outgoing payments
+	LocalAccount   string       // Our account ("FIO")
+	RemoteAccount  string       // Counter account incl. bank code ("2100123456/2010")
+	RemoteName     string       // Counter account name
+	VariableSymbol string
+	Message        string      // Message for the recipient
+	Raw            interface{} // Original record, stored as JSON in payments.raw_data
+}
+
+// Source is a source of payments
+type Source interface {
+	// Kind is stored in payments.kind; (kind, kind_id) identifies a payment
+	Kind() string
+	// Fetch returns the transactions to store
+	Fetch(ctx context.Context, logger *log.Logger) ([]Transaction, error)
+}
+
+// Committer is implemented by sources that keep a position (e.g. a sync
+// cursor). Commit is called only after all fetched transactions were stored.
+type Committer interface {
+	Commit(ctx context.Context, logger *log.Logger) error
+}
+
+// Actions taken for a single transaction
+const (
+	ActionInsert = "insert"
+	ActionUpdate = "update"
+	ActionSkip   = "skip"
+	ActionError  = "error"
+)
+
+// Outcome describes what happened (or, in a dry run, would happen) to one
+// transaction
+type Outcome struct {
+	Transaction    Transaction
+	Action         string
+	VariableSymbol string        // VS used for matching (may come from the message)
+	UserID         sql.NullInt64 // Matched user
+	ProjectID      sql.NullInt64 // Matched project
+	Note           string
+}
+
+// Result summarizes storing a batch of transactions
+type Result struct {
+	Fetched     int
+	Inserted    int
+	Updated     int
+	Skipped     int
+	Errors      int
+	UnmatchedVS []Transaction // VS doesn't match any user's or project's payments_id
+	EmptyVS     []Transaction
+	Outcomes    []Outcome
+}
+
+// Unmatched returns the number of payments that could not be assigned
+func (r *Result) Unmatched() int {
+	return len(r.UnmatchedVS) + len(r.EmptyVS)
+}
+
+// LogSummary writes the counters and the list of unmatched payments
+func (r *Result) LogSummary(logger *log.Logger) {
+	logger.Println(strings.Repeat("=", 80))
+	logger.Println("SYNC SUMMARY")
+	logger.Println(strings.Repeat("=", 80))
+	logger.Printf("Total transactions fetched: %d", r.Fetched)
+	logger.Printf("  ✓ Inserted: %d", r.Inserted)
+	logger.Printf("  ↻ Updated: %d", r.Updated)
+	logger.Printf("  - Skipped (negative/zero): %d", r.Skipped)
+	logger.Printf("  ✗ Errors: %d", r.Errors)
+	logger.Println(strings.Repeat("-", 80))
+
+	// Report problematic payments
+	if r.Unmatched() > 0 {
+		logger.Printf("⚠️  PROBLEMATIC PAYMENTS: %d", r.Unmatched())
+
+		if len(r.EmptyVS) > 0 {
+			totalAmount := money.Zero
+			logger.Printf("  📝 Empty variable symbol: %d payments", len(r.EmptyVS))
+			for _, tx := range r.EmptyVS {
+				totalAmount += tx.Amount
+				logger.Printf("     - %s from %s on %s", tx.Amount.Format(), tx.RemoteName, tx.Date.Format("2006-01-02"))
+			}
+			logger.Printf("     Total: %s", totalAmount.Format())
+		}
+
+		if len(r.UnmatchedVS) > 0 {
+			totalAmount := money.Zero
+			logger.Printf("  ❌ User not found: %d payments", len(r.UnmatchedVS))
+			for _, tx := range r.UnmatchedVS {
+				totalAmount += tx.Amount
+				logger.Printf("     - %s (VS/payments_id: %s) from %s", tx.Amount.Format(), tx.VariableSymbol, tx.RemoteName)
+			}
+			logger.Printf("     Total: %s", totalAmount.Format())
+			logger.Println("     💡 These payments have VS that doesn't match any user's payments_id.")
+			logger.Println("        Check if users need to be imported or VS is incorrect.")
+		}
+
+		logger.Printf("💡 Run the unmatched_report job for a detailed report")
+	}
+
+	logger.Println(strings.Repeat("=", 80))
+}
+
+// RawMessage returns the message for the recipient from the raw_data of a
+// FIO payment (column16), falling back to the payer's comment (column25)
+func RawMessage(rawData sql.NullString) string {
+	if !rawData.Valid || rawData.String == "" {
+		return ""
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(rawData.String), &raw); err != nil {
+		return ""
+	}
+	for _, key := range []string{"column16", "column25"} {
+		if s, ok := raw[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
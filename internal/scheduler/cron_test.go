@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // Europe/Prague without the system zoneinfo
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		expr  string
+		match []string // Times in UTC the schedule fires at
+		miss  []string // and does not
+	}{
+		{"* * * * *", []string{"2026-01-01 00:00", "2026-07-15 13:47"}, nil},
+		{"0 3 * * *", []string{"2026-01-01 03:00"}, []string{"2026-01-01 03:01", "2026-01-01 04:00"}},
+		{"@daily", []string{"2026-05-05 00:00"}, []string{"2026-05-05 01:00"}},
+		{"@hourly", []string{"2026-05-05 07:00"}, []string{"2026-05-05 07:30"}},
+		{"@monthly", []string{"2026-05-01 00:00"}, []string{"2026-05-02 00:00"}},
+		{"@weekly", []string{"2026-05-03 00:00"}, []string{"2026-05-04 00:00"}}, // Sunday, Monday
+		{"@yearly", []string{"2027-01-01 00:00"}, []string{"2027-02-01 00:00"}},
+		// Ranges, lists and steps
+		{"0-10 * * * *", []string{"2026-01-01 00:00", "2026-01-01 00:10"}, []string{"2026-01-01 00:11"}},
+		{"5,35 * * * *", []string{"2026-01-01 00:05", "2026-01-01 00:35"}, []string{"2026-01-01 00:06"}},
+		{"*/15 * * * *", []string{"2026-01-01 00:00", "2026-01-01 00:45"}, []string{"2026-01-01 00:50"}},
+		{"0-30/10 * * * *", []string{"2026-01-01 00:20", "2026-01-01 00:30"}, []string{"2026-01-01 00:40"}},
+		{"5/20 * * * *", []string{"2026-01-01 00:05", "2026-01-01 00:45"}, []string{"2026-01-01 00:00"}},
+		{"0 9-17/4 * * 1-5", []string{"2026-01-05 09:00", "2026-01-05 17:00"}, []string{"2026-01-05 11:00", "2026-01-04 09:00"}},
+		{"0 0 1,15 1-3 *", []string{"2026-03-15 00:00"}, []string{"2026-04-15 00:00"}},
+		// Sunday is 0 and 7
+		{"0 0 * * 7", []string{"2026-05-03 00:00"}, []string{"2026-05-02 00:00"}},
+		{"0 0 * * 5-7", []string{"2026-05-01 00:00", "2026-05-03 00:00"}, []string{"2026-05-04 00:00"}},
+		// Both day fields restricted: either matches
+		{"0 0 1 * 1", []string{"2026-05-01 00:00", "2026-05-04 00:00"}, []string{"2026-05-05 00:00"}},
+		// Only one restricted: that one decides
+		{"0 0 1 * *", []string{"2026-05-01 00:00"}, []string{"2026-05-04 00:00"}},
+		{"0 0 * * 1", []string{"2026-05-04 00:00"}, []string{"2026-05-01 00:00"}},
+		{"  0 0 * * *  ", []string{"2026-05-01 00:00"}, nil},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.expr, err)
+			continue
+		}
+		for _, at := range tt.match {
+			if !s.Matches(parseTime(t, at, time.UTC)) {
+				t.Errorf("%q does not match %s", tt.expr, at)
+			}
+		}
+		for _, at := range tt.miss {
+			if s.Matches(parseTime(t, at, time.UTC)) {
+				t.Errorf("%q matches %s", tt.expr, at)
+			}
+		}
+	}
+
+	for _, expr := range []string{
+		"", "* * * *", "* * * * * *", "@often",
+		"60 * * * *", "* 24 * * *", "* * 0 * *", "* * 32 * *", "* * * 0 *", "* * * 13 *", "* * * * 8",
+		"a * * * *", "1-x * * * *", "5-1 * * * *", "*/0 * * * *", "*/x * * * *", "1,,2 * * * *", "-1 * * * *",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q): no error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		loc  *time.Location
+		from string
+		want string // Empty: never
+	}{
+		{"0 3 * * *", time.UTC, "2026-01-01 02:59", "2026-01-01 03:00"},
+		{"0 3 * * *", time.UTC, "2026-01-01 03:00", "2026-01-02 03:00"},
+		{"*/15 * * * *", time.UTC, "2026-01-01 10:14", "2026-01-01 10:15"},
+		{"0 0 1 * *", time.UTC, "2026-01-15 12:00", "2026-02-01 00:00"},
+		{"0 6 1 1 *", time.UTC, "2026-12-31 23:59", "2027-01-01 06:00"},
+		// Across month boundaries to the next month with the day
+		{"0 0 31 * *", time.UTC, "2026-01-31 00:00", "2026-03-31 00:00"},
+		{"0 0 30 * *", time.UTC, "2026-01-30 00:00", "2026-03-30 00:00"},
+		{"0 0 29 2 *", time.UTC, "2026-01-01 00:00", "2028-02-29 00:00"},
+		{"0 0 31 2 *", time.UTC, "2026-01-01 00:00", ""},
+		{"0 0 1 * 1", time.UTC, "2026-05-01 00:00", "2026-05-04 00:00"},
+		{"30 23 * * 0", time.UTC, "2026-05-03 23:30", "2026-05-10 23:30"},
+		// Seconds are ignored
+		{"* * * * *", time.UTC, "2026-01-01 10:00:59", "2026-01-01 10:01"},
+		// The clocks go forward from 2:00 to 3:00 on 29 March 2026: 2:30
+		// does not exist that day
+		{"30 2 * * *", prague, "2026-03-29 00:00", "2026-03-30 02:30"},
+		{"0 3 * * *", prague, "2026-03-29 00:00", "2026-03-29 03:00"},
+		{"*/30 * * * *", prague, "2026-03-29 01:45", "2026-03-29 03:00"},
+		// The clocks go back from 3:00 to 2:00 on 25 October 2026: a fixed
+		// hour fires once, every hour fires in both
+		{"30 2 * * *", prague, "2026-10-25 00:00", "2026-10-25 02:30 CEST"},
+		{"30 2 * * *", prague, "2026-10-25 02:30 CEST", "2026-10-26 02:30"},
+		{"30 * * * *", prague, "2026-10-25 02:30 CEST", "2026-10-25 02:30 CET"},
+		{"0 3 * * *", prague, "2026-10-25 02:30 CET", "2026-10-25 03:00"},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q): %v", tt.expr, err)
+		}
+		got := s.Next(parseTime(t, tt.from, tt.loc))
+		var want time.Time
+		if tt.want != "" {
+			want = parseTime(t, tt.want, tt.loc)
+		}
+		if !got.Equal(want) {
+			t.Errorf("%q after %s: got %s, want %s", tt.expr, tt.from, got, want)
+		}
+		if !got.IsZero() && !s.Matches(got) {
+			t.Errorf("%q: Next %s does not match", tt.expr, got)
+		}
+	}
+
+	// The run loop checks every minute: the repeated hour does not fire twice
+	s, _ := ParseSchedule("30 2 * * *")
+	if s.Matches(parseTime(t, "2026-10-25 02:30 CET", prague)) {
+		t.Error("fixed hour matches in the repeated hour")
+	}
+}
+
+// parseTime parses "2006-01-02 15:04[:05][ MST]" in loc. The zone name picks
+// the first or the second pass of a repeated hour.
+func parseTime(t *testing.T, s string, loc *time.Location) time.Time {
+	t.Helper()
+
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02 15:04 MST"} {
+		if v, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return v
+		}
+	}
+	t.Fatalf("invalid time %q", s)
+	return time.Time{}
+}
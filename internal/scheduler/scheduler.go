@@ -0,0 +1,453 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+)
+
+// Job run sources (job_runs.source)
+const (
+	SourceSchedule = "schedule"
+	SourceManual   = "manual"
+	SourceCLI      = "cli"
+)
+
+// Job run statuses (job_runs.status)
+const (
+	StatusRunning     = "running"
+	StatusSuccess     = "success"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// maxOutput limits how much of a job's log is stored in job_runs.output
+const maxOutput = 64 * 1024
+
+var (
+	// ErrAlreadyRunning is returned when a job is started while another run of
+	// the same job (in this or another process) has not finished yet
+	ErrAlreadyRunning = errors.New("job is already running")
+
+	// ErrUnknownJob is returned for job names that were never registered
+	ErrUnknownJob = errors.New("unknown job")
+)
+
+// RunFunc executes a job. Everything written to logger is shown on the console
+// and stored in the job run history. The returned summary is a one-line result
+// shown on /admin/jobs.
+type RunFunc func(ctx context.Context, logger *log.Logger) (summary string, err error)
+
+// Job is a named task that can run on a cron schedule and on demand
+type Job struct {
+	Name        string
+	Description string
+	Schedule    string // Cron expression, empty = only manual runs
+	Run         RunFunc
+}
+
+// JobStatus describes a registered job for the admin UI
+type JobStatus struct {
+	Job
+	NextRun time.Time // Zero if the job has no schedule or the scheduler is stopped
+	Running bool
+	LastRun *db.JobRun
+}
+
+type entry struct {
+	job      Job
+	schedule *Schedule
+}
+
+// Scheduler runs registered jobs on their cron schedules inside the server
+// process and records every run in job_runs
+type Scheduler struct {
+	queries *db.Queries
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	started bool
+	stop    chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	loop   sync.WaitGroup
+	runs   sync.WaitGroup
+}
+
+// New creates a scheduler. Jobs can be run with Run or Trigger even if the
+// scheduler is never started.
+func New(queries *db.Queries) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		queries: queries,
+		entries: make(map[string]*entry),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Register adds a job. The schedule is validated immediately so a typo in the
+// configuration fails at startup rather than silently never running.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("job must have a name and a run function")
+	}
+
+	e := &entry{job: job}
+	if strings.TrimSpace(job.Schedule) != "" {
+		schedule, err := ParseSchedule(job.Schedule)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		e.schedule = schedule
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.entries[job.Name]; exists {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.entries[job.Name] = e
+	return nil
+}
+
+// Start begins running jobs on their schedules in the background
+func (s *Scheduler) Start() error {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return nil
+	}
+
+	// Runs still marked as running were interrupted by a previous shutdown
+	if n, err := s.queries.InterruptStaleJobRuns(s.ctx); err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("failed to clean up stale job runs: %w", err)
+	} else if n > 0 {
+		log.Printf("⚠ Marked %d stale job run(s) as interrupted", n)
+	}
+
+	s.started = true
+	s.stop = make(chan struct{})
+	s.loop.Add(1)
+	go s.run(s.stop)
+	s.mu.Unlock()
+
+	for _, e := range s.sortedEntries() {
+		if e.schedule != nil {
+			log.Printf("✓ Scheduled job %s (%s), next run %s",
+				e.job.Name, e.schedule, e.schedule.Next(time.Now()).Format("2006-01-02 15:04"))
+		}
+	}
+
+	return nil
+}
+
+// Stop stops scheduling new runs and waits for running jobs to finish. If ctx
+// expires first, running jobs are cancelled.
+func (s *Scheduler) Stop(ctx context.Context) {
+	s.mu.Lock()
+	if s.started {
+		close(s.stop)
+		s.started = false
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.loop.Wait()
+		s.runs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("⚠ Cancelling running jobs")
+		s.cancel()
+		<-done
+	}
+	s.cancel()
+}
+
+// run is the scheduling loop. It wakes up at the start of every minute and
+// starts all jobs whose schedule matches that minute.
+func (s *Scheduler) run(stop <-chan struct{}) {
+	defer s.loop.Done()
+
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(next.Sub(now))
+
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, e := range s.sortedEntries() {
+			if e.schedule == nil || !e.schedule.Matches(next) {
+				continue
+			}
+
+			run, err := s.begin(e, SourceSchedule, sql.NullInt64{})
+			if errors.Is(err, ErrAlreadyRunning) {
+				log.Printf("⊘ Skipping scheduled run of %s - previous run still in progress", e.job.Name)
+				continue
+			} else if err != nil {
+				log.Printf("✗ Failed to start job %s: %v", e.job.Name, err)
+				continue
+			}
+
+			s.runs.Add(1)
+			go func(e *entry, run db.JobRun) {
+				defer s.runs.Done()
+				s.execute(e, run)
+			}(e, run)
+		}
+	}
+}
+
+// Run executes a job synchronously (used by the CLI wrappers)
+func (s *Scheduler) Run(name, source string) (db.JobRun, error) {
+	e, err := s.lookup(name)
+	if err != nil {
+		return db.JobRun{}, err
+	}
+
+	run, err := s.begin(e, source, sql.NullInt64{})
+	if err != nil {
+		return db.JobRun{}, err
+	}
+
+	s.runs.Add(1)
+	defer s.runs.Done()
+
+	finished := s.execute(e, run)
+	if finished.Status != StatusSuccess {
+		return finished, errors.New(finished.Error.String)
+	}
+	return finished, nil
+}
+
+// Trigger starts a job in the background on behalf of an admin ("run now").
+// It returns as soon as the run is recorded.
+func (s *Scheduler) Trigger(name string, triggeredBy sql.NullInt64) (db.JobRun, error) {
+	e, err := s.lookup(name)
+	if err != nil {
+		return db.JobRun{}, err
+	}
+
+	run, err := s.begin(e, SourceManual, triggeredBy)
+	if err != nil {
+		return db.JobRun{}, err
+	}
+
+	s.runs.Add(1)
+	go func() {
+		defer s.runs.Done()
+		s.execute(e, run)
+	}()
+
+	return run, nil
+}
+
+// Status returns all registered jobs with their next and last runs
+func (s *Scheduler) Status(ctx context.Context) ([]JobStatus, error) {
+	lastRuns, err := s.queries.ListLastJobRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]db.JobRun, len(lastRuns))
+	for _, run := range lastRuns {
+		byName[run.JobName] = run
+	}
+
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+
+	now := time.Now()
+	var statuses []JobStatus
+	for _, e := range s.sortedEntries() {
+		st := JobStatus{Job: e.job}
+		if e.schedule != nil && started {
+			st.NextRun = e.schedule.Next(now)
+		}
+		if run, ok := byName[e.job.Name]; ok {
+			run := run
+			st.LastRun = &run
+			st.Running = run.Status == StatusRunning
+		}
+		statuses = append(statuses, st)
+	}
+
+	return statuses, nil
+}
+
+// Started reports whether the scheduling loop is running
+func (s *Scheduler) Started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+func (s *Scheduler) lookup(name string) (*entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	return e, nil
+}
+
+func (s *Scheduler) sortedEntries() []*entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]*entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].job.Name < list[j].job.Name
+	})
+	return list
+}
+
+// begin records a new run. The unique index on running jobs makes this the
+// overlap check, so it also works across the server and CLI processes.
+func (s *Scheduler) begin(e *entry, source string, triggeredBy sql.NullInt64) (db.JobRun, error) {
+	run, err := s.queries.CreateJobRun(s.ctx, db.CreateJobRunParams{
+		JobName:     e.job.Name,
+		Source:      source,
+		TriggeredBy: triggeredBy,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return db.JobRun{}, fmt.Errorf("%w: %s", ErrAlreadyRunning, e.job.Name)
+		}
+		return db.JobRun{}, fmt.Errorf("failed to record job run: %w", err)
+	}
+	return run, nil
+}
+
+// execute runs the job and stores its result
+func (s *Scheduler) execute(e *entry, run db.JobRun) db.JobRun {
+	output := &tailBuffer{limit: maxOutput}
+	logger := log.New(io.MultiWriter(os.Stderr, output), "["+e.job.Name+"] ", log.LstdFlags)
+
+	log.Printf("▶ Starting job %s (%s)", e.job.Name, run.Source)
+	start := time.Now()
+
+	summary, err := s.safeRun(e, logger)
+	duration := time.Since(start)
+
+	status := StatusSuccess
+	var errMsg sql.NullString
+	if err != nil {
+		status = StatusFailed
+		errMsg = sql.NullString{String: err.Error(), Valid: true}
+		log.Printf("✗ Job %s failed after %s: %v", e.job.Name, duration.Round(time.Millisecond), err)
+	} else {
+		log.Printf("✓ Job %s finished in %s: %s", e.job.Name, duration.Round(time.Millisecond), summary)
+	}
+
+	// Record the result even if the jobs were cancelled during shutdown
+	finished, dbErr := s.queries.FinishJobRun(context.Background(), db.FinishJobRunParams{
+		Status:     status,
+		DurationMs: sql.NullInt64{Int64: duration.Milliseconds(), Valid: true},
+		Summary:    sql.NullString{String: summary, Valid: summary != ""},
+		Error:      errMsg,
+		Output:     sql.NullString{String: output.String(), Valid: output.Len() > 0},
+		ID:         run.ID,
+	})
+	if dbErr != nil {
+		log.Printf("⚠ Failed to record result of job %s: %v", e.job.Name, dbErr)
+		run.Status = status
+		run.Summary = sql.NullString{String: summary, Valid: summary != ""}
+		run.Error = errMsg
+		return run
+	}
+
+	if err != nil {
+		metadata, _ := json.Marshal(struct {
+			Job    string `json:"job"`
+			RunID  int64  `json:"run_id"`
+			Source string `json:"source"`
+		}{e.job.Name, run.ID, run.Source})
+		s.queries.CreateLog(context.Background(), db.CreateLogParams{
+			Subsystem: "scheduler",
+			Level:     "error",
+			UserID:    sql.NullInt64{},
+			Message:   fmt.Sprintf("Job %s failed: %v", e.job.Name, err),
+			Metadata:  sql.NullString{String: string(metadata), Valid: true},
+		})
+	}
+
+	return finished
+}
+
+// safeRun converts a panic in a job into an error so one broken job cannot
+// take down the server
+func (s *Scheduler) safeRun(e *entry, logger *log.Logger) (summary string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return e.job.Run(s.ctx, logger)
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf.Write(p)
+	if over := b.buf.Len() - b.limit; over > 0 {
+		b.buf.Next(over)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return "… (output truncated)\n" + b.buf.String()
+	}
+	return b.buf.String()
+}
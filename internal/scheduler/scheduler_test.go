@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+)
+
+func TestOverlap(t *testing.T) {
+	queries := dbtest.New(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	job := Job{
+		Name: "slow",
+		Run: func(ctx context.Context, logger *log.Logger) (string, error) {
+			close(started)
+			<-release
+			logger.Println("done")
+			return "ok", nil
+		},
+	}
+
+	s := New(queries)
+	if err := s.Register(job); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := s.Register(job); err == nil {
+		t.Error("second Register: no error")
+	}
+
+	first, err := s.Trigger("slow", sql.NullInt64{Int64: 7, Valid: true})
+	if err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+	<-started
+
+	// Refused in this process and in another one (a CLI run)
+	if _, err := s.Trigger("slow", sql.NullInt64{}); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("second Trigger: %v", err)
+	}
+	other := New(queries)
+	other.Register(job)
+	if _, err := other.Run("slow", SourceCLI); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("Run in another scheduler: %v", err)
+	}
+
+	statuses, err := s.Status(context.Background())
+	if err != nil || len(statuses) != 1 || !statuses[0].Running || statuses[0].LastRun.ID != first.ID {
+		t.Fatalf("Status %+v, %v", statuses, err)
+	}
+
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.Stop(ctx)
+
+	runs, err := queries.ListJobRuns(context.Background(), db.ListJobRunsParams{Column1: "slow", JobName: "slow", Limit: 10})
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("runs %+v, %v", runs, err)
+	}
+	if r := runs[0]; r.Status != StatusSuccess || r.Summary.String != "ok" || r.TriggeredBy.Int64 != 7 || !r.FinishedAt.Valid {
+		t.Errorf("run %+v", r)
+	}
+
+	// Once finished, the job runs again
+	started, release = make(chan struct{}), make(chan struct{})
+	close(release)
+	if run, err := other.Run("slow", SourceCLI); err != nil || run.Status != StatusSuccess {
+		t.Errorf("Run after the first finished: %+v, %v", run, err)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	queries := dbtest.New(t)
+	s := New(queries)
+
+	s.Register(Job{Name: "fails", Run: func(ctx context.Context, logger *log.Logger) (string, error) {
+		return "", errors.New("boom")
+	}})
+	s.Register(Job{Name: "panics", Run: func(ctx context.Context, logger *log.Logger) (string, error) {
+		panic("oops")
+	}})
+
+	if run, err := s.Run("fails", SourceCLI); err == nil || run.Status != StatusFailed || run.Error.String != "boom" {
+		t.Errorf("failing job: %+v, %v", run, err)
+	}
+	if run, err := s.Run("panics", SourceCLI); err == nil || run.Status != StatusFailed || run.Error.String != "panic: oops" {
+		t.Errorf("panicking job: %+v, %v", run, err)
+	}
+	if _, err := s.Run("missing", SourceCLI); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("unknown job: %v", err)
+	}
+
+	// A failed run does not block the next one
+	if _, err := s.Run("fails", SourceCLI); errors.Is(err, ErrAlreadyRunning) {
+		t.Error("failed run is still running")
+	}
+
+	logs, err := queries.ListLogsBySubsystem(context.Background(), db.ListLogsBySubsystemParams{Subsystem: "scheduler", Limit: 10})
+	if err != nil || len(logs) != 3 {
+		t.Errorf("logs %+v, %v", logs, err)
+	}
+
+	if err := s.Register(Job{Name: "bad", Schedule: "61 * * * *", Run: func(ctx context.Context, logger *log.Logger) (string, error) { return "", nil }}); err == nil {
+		t.Error("invalid schedule registered")
+	}
+}
+
+func TestStartInterruptsStaleRuns(t *testing.T) {
+	database := dbtest.Open(t)
+	queries := db.New(database)
+	ctx := context.Background()
+
+	// Left running by a crashed server, by a CLI run that is still going and
+	// by a CLI run that never finished
+	server, err := queries.CreateJobRun(ctx, db.CreateJobRunParams{JobName: "a", Source: SourceSchedule})
+	if err != nil {
+		t.Fatalf("CreateJobRun: %v", err)
+	}
+	cli, _ := queries.CreateJobRun(ctx, db.CreateJobRunParams{JobName: "b", Source: SourceCLI})
+	oldCLI, _ := queries.CreateJobRun(ctx, db.CreateJobRunParams{JobName: "c", Source: SourceCLI})
+	if _, err := database.Exec(`UPDATE job_runs SET started_at = datetime('now', '-7 hours') WHERE id = ?`, oldCLI.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(queries)
+	s.Register(Job{Name: "a", Schedule: "@daily", Run: func(ctx context.Context, logger *log.Logger) (string, error) { return "ok", nil }})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer s.Stop(ctx)
+
+	want := map[int64]string{server.ID: StatusInterrupted, cli.ID: StatusRunning, oldCLI.ID: StatusInterrupted}
+	runs, err := queries.ListJobRuns(ctx, db.ListJobRunsParams{Column1: "", Limit: 10})
+	if err != nil || len(runs) != 3 {
+		t.Fatalf("runs %+v, %v", runs, err)
+	}
+	for _, r := range runs {
+		if r.Status != want[r.ID] {
+			t.Errorf("run %d (%s): %s, want %s", r.ID, r.Source, r.Status, want[r.ID])
+		}
+	}
+
+	// The interrupted job can run again
+	if run, err := s.Run("a", SourceManual); err != nil || run.Status != StatusSuccess {
+		t.Errorf("Run after the interruption: %+v, %v", run, err)
+	}
+
+	statuses, _ := s.Status(ctx)
+	if len(statuses) != 1 || statuses[0].NextRun.IsZero() || statuses[0].Running {
+		t.Errorf("Status %+v", statuses)
+	}
+}
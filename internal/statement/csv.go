@@ -0,0 +1,44 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// WriteCSV writes the statement as semicolon separated UTF-8 with a BOM, the
+// same dialect as the payment ledger export. The opening and closing balances
+// are the first and last rows.
+func WriteCSV(w io.Writer, s *Statement) error {
+	if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	cw.Write([]string{"date", "kind", "description", "charge", "credit", "balance"})
+
+	opening := ""
+	if !s.From.IsZero() {
+		opening = s.From.Format("2006-01-02")
+	}
+	cw.Write([]string{opening, "opening", "Počáteční zůstatek", "", "", s.Opening.String()})
+
+	for _, e := range s.Entries {
+		charge, credit := "", ""
+		if e.IsFee() {
+			charge = e.Charge.String()
+		} else {
+			credit = e.Credit.String()
+		}
+		cw.Write([]string{e.Date.Format("2006-01-02"), e.Kind, e.Description, charge, credit, e.Balance.String()})
+	}
+
+	closing := ""
+	if !s.To.IsZero() {
+		closing = s.To.Format("2006-01-02")
+	}
+	cw.Write([]string{closing, "closing", "Konečný zůstatek", s.Charged.String(), s.Paid.String(), s.Closing.String()})
+
+	cw.Flush()
+	return cw.Error()
+}
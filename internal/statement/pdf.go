@@ -0,0 +1,285 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The PDF is written by hand: one A4 table using the built-in Helvetica
+// fonts, so no font files or third-party libraries are needed. Text is encoded
+// as Windows-1250 and the fonts get a WinAnsi encoding with the Czech glyphs
+// patched in via /Differences.
+
+const (
+	pageWidth    = 595 // A4 in points
+	pageHeight   = 842
+	marginLeft   = 50
+	marginRight  = 545
+	marginTop    = 792
+	marginBottom = 60
+	fontSize     = 9
+	lineHeight   = 14
+
+	colDate        = marginLeft
+	colDescription = marginLeft + 60
+	colCharge      = 385 // Right edges of the amount columns
+	colCredit      = 465
+	colBalance     = marginRight
+	descriptionMax = colCharge - 70 - colDescription
+)
+
+// WritePDF writes the statement as a PDF document
+func WritePDF(w io.Writer, s *Statement) error {
+	pages := layoutPages(s)
+
+	var doc pdfDocument
+	doc.add("<< /Type /Catalog /Pages 2 0 R >>")
+	doc.add("") // Pages, filled in once page objects are known
+	doc.add(fontObject("Helvetica"))
+	doc.add(fontObject("Helvetica-Bold"))
+
+	var kids []string
+	for i, content := range pages {
+		footer := fmt.Sprintf("Strana %d z %d", i+1, len(pages))
+		content.text(marginRight-textWidth(footer, fontSize), marginBottom-25, fontSize-1, false, footer)
+
+		stream := content.buf.Bytes()
+		contentID := doc.add(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+		pageID := doc.add(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, contentID))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+	}
+	doc.objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	return doc.write(w)
+}
+
+// layoutPages draws the statement onto as many pages as needed
+func layoutPages(s *Statement) []*pdfPage {
+	var pages []*pdfPage
+	var page *pdfPage
+	y := 0
+
+	newPage := func() {
+		page = &pdfPage{}
+		pages = append(pages, page)
+		y = marginTop
+
+		if len(pages) == 1 {
+			page.text(marginLeft, y, 16, true, "Výpis členského účtu")
+			y -= 24
+			if s.Member != "" {
+				page.text(marginLeft, y, 10, false, s.Member)
+				y -= lineHeight
+			}
+			if s.VariableSymbol != "" {
+				page.text(marginLeft, y, 10, false, "Variabilní symbol: "+s.VariableSymbol)
+				y -= lineHeight
+			}
+			page.text(marginLeft, y, 10, false, "Období: "+s.Period())
+			y -= lineHeight
+			if !s.Generated.IsZero() {
+				page.text(marginLeft, y, 10, false, "Vystaveno: "+s.Generated.Format("02.01.2006"))
+				y -= lineHeight
+			}
+			y -= lineHeight
+		}
+
+		page.text(colDate, y, fontSize, true, "Datum")
+		page.text(colDescription, y, fontSize, true, "Popis")
+		page.right(colCharge, y, true, "Předpis")
+		page.right(colCredit, y, true, "Platba")
+		page.right(colBalance, y, true, "Zůstatek")
+		y -= 4
+		page.line(marginLeft, y, marginRight, y)
+		y -= lineHeight
+	}
+
+	row := func(date, description, charge, credit, balance string, bold bool) {
+		if page == nil || y < marginBottom {
+			newPage()
+		}
+		page.text(colDate, y, fontSize, bold, date)
+		page.text(colDescription, y, fontSize, bold, truncate(description, descriptionMax))
+		page.right(colCharge, y, bold, charge)
+		page.right(colCredit, y, bold, credit)
+		page.right(colBalance, y, bold, balance)
+		y -= lineHeight
+	}
+
+	opening := ""
+	if !s.From.IsZero() {
+		opening = s.From.Format("02.01.2006")
+	}
+	row(opening, "Počáteční zůstatek", "", "", s.Opening.Format(), true)
+
+	for _, e := range s.Entries {
+		charge, credit := "", ""
+		if e.IsFee() {
+			charge = e.Charge.Format()
+		} else {
+			credit = e.Credit.Format()
+		}
+		row(e.Date.Format("02.01.2006"), e.Description, charge, credit, e.Balance.Format(), false)
+	}
+
+	if y < marginBottom+lineHeight {
+		newPage()
+	}
+	y += lineHeight - 4
+	page.line(marginLeft, y, marginRight, y)
+	y -= lineHeight
+	row("", "Konečný zůstatek", s.Charged.Format(), s.Paid.Format(), s.Closing.Format(), true)
+
+	return pages
+}
+
+// pdfPage is the content stream of one page
+type pdfPage struct {
+	buf bytes.Buffer
+}
+
+// text draws a string with its baseline starting at x, y
+func (p *pdfPage) text(x, y int, size float64, bold bool, s string) {
+	if s == "" {
+		return
+	}
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.buf, "BT /%s %g Tf %d %d Td (%s) Tj ET\n", font, size, x, y, encodeText(s))
+}
+
+// right draws a table cell right-aligned to x
+func (p *pdfPage) right(x, y int, bold bool, s string) {
+	p.text(x-textWidth(s, fontSize), y, fontSize, bold, s)
+}
+
+// line draws a thin horizontal rule
+func (p *pdfPage) line(x1, y1, x2, y2 int) {
+	fmt.Fprintf(&p.buf, "0.5 w %d %d m %d %d l S\n", x1, y1, x2, y2)
+}
+
+// pdfDocument collects numbered objects and writes them with a cross-reference table
+type pdfDocument struct {
+	objects []string
+}
+
+// add appends an object and returns its number
+func (d *pdfDocument) add(obj string) int {
+	d.objects = append(d.objects, obj)
+	return len(d.objects)
+}
+
+func (d *pdfDocument) write(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets := make([]int, len(d.objects))
+	for i, obj := range d.objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// fontObject is a standard font with Windows-1250 Czech letters mapped
+func fontObject(name string) string {
+	return fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding << /Type /Encoding "+
+		"/BaseEncoding /WinAnsiEncoding /Differences [141 /Tcaron 157 /tcaron 200 /Ccaron 204 /Ecaron "+
+		"207 /Dcaron 210 /Ncaron 216 /Rcaron 217 /Uring 232 /ccaron 236 /ecaron 239 /dcaron 242 /ncaron "+
+		"248 /rcaron 249 /uring] >> >>", name)
+}
+
+// cp1250 maps the Czech letters outside ASCII to their Windows-1250 codes
+var cp1250 = map[rune]byte{
+	'Á': 0xC1, 'Č': 0xC8, 'Ď': 0xCF, 'É': 0xC9, 'Ě': 0xCC, 'Í': 0xCD, 'Ň': 0xD2, 'Ó': 0xD3,
+	'Ř': 0xD8, 'Š': 0x8A, 'Ť': 0x8D, 'Ú': 0xDA, 'Ů': 0xD9, 'Ý': 0xDD, 'Ž': 0x8E,
+	'á': 0xE1, 'č': 0xE8, 'ď': 0xEF, 'é': 0xE9, 'ě': 0xEC, 'í': 0xED, 'ň': 0xF2, 'ó': 0xF3,
+	'ř': 0xF8, 'š': 0x9A, 'ť': 0x9D, 'ú': 0xFA, 'ů': 0xF9, 'ý': 0xFD, 'ž': 0x9E,
+	'–': 0x96, // en dash
+}
+
+// encodeText converts s to an escaped Windows-1250 PDF string. Characters
+// the fonts cannot show are replaced by '?'.
+func encodeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte(' ')
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		default:
+			if c, ok := cp1250[r]; ok {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
+
+// helveticaWidths are the Helvetica glyph widths (1/1000 em) of ASCII 32-126
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space - /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 - ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ - O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P - _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` - o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p - ~
+}
+
+// baseLetters maps accented letters to the letter with the same width
+var baseLetters = map[rune]rune{
+	'Á': 'A', 'Č': 'C', 'Ď': 'D', 'É': 'E', 'Ě': 'E', 'Í': 'I', 'Ň': 'N', 'Ó': 'O',
+	'Ř': 'R', 'Š': 'S', 'Ť': 'T', 'Ú': 'U', 'Ů': 'U', 'Ý': 'Y', 'Ž': 'Z',
+	'á': 'a', 'č': 'c', 'ď': 'd', 'é': 'e', 'ě': 'e', 'í': 'i', 'ň': 'n', 'ó': 'o',
+	'ř': 'r', 'š': 's', 'ť': 't', 'ú': 'u', 'ů': 'u', 'ý': 'y', 'ž': 'z',
+	'–': '_', ' ': ' ',
+}
+
+// textWidth approximates the width of s in points (bold text is close enough)
+func textWidth(s string, size float64) int {
+	total := 0
+	for _, r := range s {
+		if base, ok := baseLetters[r]; ok {
+			r = base
+		}
+		if r >= 32 && r <= 126 {
+			total += helveticaWidths[r-32]
+		} else {
+			total += 556
+		}
+	}
+	return int(float64(total)*size/1000 + 0.5)
+}
+
+// truncate shortens s with an ellipsis to fit into width points
+func truncate(s string, width int) string {
+	if textWidth(s, fontSize) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(string(runes)+"...", fontSize) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
@@ -0,0 +1,187 @@
+// Package statement builds a member's account statement: membership fees and
+// membership payments merged chronologically with a running balance.
+package statement
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/base48/member-portal/internal/dates"
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/payments"
+)
+
+// Entry kinds
+const (
+	KindFee     = "fee"
+	KindPayment = "payment"
+)
+
+// Entry is one line of the statement
+type Entry struct {
+	Date        time.Time
+	Kind        string // KindFee or KindPayment
+	Description string
+	Charge      money.Amount // Fee (positive), zero for payments
+	Credit      money.Amount // Payment, zero for fees
+	Balance     money.Amount // Running balance after this entry
+}
+
+// IsFee reports whether the entry is a membership fee
+func (e Entry) IsFee() bool {
+	return e.Kind == KindFee
+}
+
+// Statement is a member's account statement for a period. The balance uses
+// the same fees and payments as GetUserBalance, so the closing balance of a
+// statement without an end date equals the profile balance.
+type Statement struct {
+	From time.Time // Zero means since the first entry
+	To   time.Time // Zero means up to now
+
+	Opening money.Amount // Balance before From
+	Closing money.Amount // Balance after the last entry in the period
+	Charged money.Amount // Sum of fees in the period
+	Paid    money.Amount // Sum of payments in the period
+	Entries []Entry
+
+	// Filled in by the caller, used in the PDF and CSV headers
+	Member         string
+	VariableSymbol string
+	Generated      time.Time
+}
+
+// Build merges fees and membership payments (as returned by ListFeesByUser
+// and ListMembershipPaymentsByUser) into a statement for [from, to]. Both
+// bounds are days and inclusive; a zero bound is open. levels maps level IDs
+// to names for fee descriptions and may be nil.
+//
+// On the same day fees come before payments, so paying on the day a fee is
+// charged never shows as a debt.
+func Build(fees []db.Fee, pays []db.Payment, levels map[int64]string, from, to time.Time) *Statement {
+	entries := make([]Entry, 0, len(fees)+len(pays))
+	for _, f := range fees {
+		entries = append(entries, Entry{
+			Date:        f.PeriodStart,
+			Kind:        KindFee,
+			Description: feeDescription(f, levels),
+			Charge:      f.Amount,
+		})
+	}
+	for _, p := range pays {
+		if p.VoidedAt.Valid {
+			continue
+		}
+		entries = append(entries, Entry{
+			Date:        p.Date,
+			Kind:        KindPayment,
+			Description: paymentDescription(p),
+			Credit:      p.Amount,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		di, dj := dates.Day(entries[i].Date), dates.Day(entries[j].Date)
+		if !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return entries[i].Kind == KindFee && entries[j].Kind != KindFee
+	})
+
+	st := &Statement{From: from, To: to}
+	balance := money.Zero
+	for _, e := range entries {
+		balance += e.Credit - e.Charge
+		e.Balance = balance
+
+		d := dates.Day(e.Date)
+		if !from.IsZero() && d.Before(dates.Day(from)) {
+			st.Opening = balance
+			continue
+		}
+		if !to.IsZero() && d.After(dates.Day(to)) {
+			break
+		}
+
+		st.Charged += e.Charge
+		st.Paid += e.Credit
+		st.Entries = append(st.Entries, e)
+	}
+	st.Closing = st.Opening + st.Paid - st.Charged
+
+	return st
+}
+
+// Period describes the statement period in Czech
+func (s *Statement) Period() string {
+	switch {
+	case s.From.IsZero() && s.To.IsZero():
+		return "celá historie"
+	case s.From.IsZero():
+		return "do " + s.To.Format("02.01.2006")
+	case s.To.IsZero():
+		return "od " + s.From.Format("02.01.2006")
+	}
+	return s.From.Format("02.01.2006") + " – " + s.To.Format("02.01.2006")
+}
+
+// DebtSince returns the day since which the balance has been negative and
+// at least threshold in debt without interruption, or false if it is not now.
+// Balances within a day count, so a payment on the day of a fee still ends
+// the debt. Meant for statements of the whole history.
+func (s *Statement) DebtSince(threshold money.Amount) (time.Time, bool) {
+	inDebt := func(balance money.Amount) bool {
+		return balance.IsNegative() && balance <= threshold.Neg()
+	}
+
+	var since time.Time
+	debt := inDebt(s.Opening)
+	if debt {
+		since = dates.Day(s.From)
+	}
+	for _, e := range s.Entries {
+		switch {
+		case !inDebt(e.Balance):
+			debt = false
+		case !debt:
+			debt = true
+			since = dates.Day(e.Date)
+		}
+	}
+
+	if !debt {
+		return time.Time{}, false
+	}
+	return since, true
+}
+
+// feeDescription describes a fee, e.g. "Členský příspěvek 03/2024 (Member)"
+func feeDescription(f db.Fee, levels map[int64]string) string {
+	desc := "Členský příspěvek " + f.PeriodStart.Format("01/2006")
+	if name, ok := levels[f.LevelID]; ok && name != "" {
+		desc += " (" + name + ")"
+	}
+	return desc
+}
+
+// paymentDescription describes a payment by its source and message
+func paymentDescription(p db.Payment) string {
+	var desc, note string
+	switch {
+	case p.Kind == payments.KindManual && p.LocalAccount == payments.MethodInKind:
+		desc, note = "Věcné plnění", p.StaffComment.String
+	case p.Kind == payments.KindManual:
+		desc, note = "Platba v hotovosti", p.StaffComment.String
+	default:
+		desc, note = "Platba na účet", payments.RawMessage(p.RawData)
+		if p.RemoteAccount != "" {
+			desc = fmt.Sprintf("Platba z účtu %s", p.RemoteAccount)
+		}
+	}
+	if note != "" {
+		desc += " – " + note
+	}
+	return desc
+}
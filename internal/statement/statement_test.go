@@ -0,0 +1,194 @@
+package statement
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/money"
+	"github.com/base48/member-portal/internal/payments"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func testData() ([]db.Fee, []db.Payment) {
+	// As returned by the queries: newest first
+	fees := []db.Fee{
+		{LevelID: 1, PeriodStart: date("2024-03-01"), Amount: money.FromKoruny(1000)},
+		{LevelID: 1, PeriodStart: date("2024-02-01"), Amount: money.FromKoruny(1000)},
+		{LevelID: 1, PeriodStart: date("2024-01-01"), Amount: money.FromKoruny(1000)},
+	}
+	pays := []db.Payment{
+		{Kind: payments.KindManual, LocalAccount: payments.MethodCash, Date: date("2024-03-15"), Amount: money.FromKoruny(500),
+			VoidedAt: sql.NullTime{Time: date("2024-03-16"), Valid: true}},
+		{Kind: payments.KindManual, LocalAccount: payments.MethodCash, Date: date("2024-03-10"), Amount: money.FromKoruny(2000),
+			StaffComment: sql.NullString{String: "Převzal Pepa", Valid: true}},
+		{Kind: payments.KindFIO, RemoteAccount: "123/0800", Date: date("2024-01-01"), Amount: money.FromKoruny(1000),
+			RawData: sql.NullString{String: `{"column16":"leden"}`, Valid: true}},
+	}
+	return fees, pays
+}
+
+func TestBuild(t *testing.T) {
+	fees, pays := testData()
+	st := Build(fees, pays, map[int64]string{1: "Member"}, time.Time{}, time.Time{})
+
+	want := []struct {
+		kind    string
+		desc    string
+		balance int64
+	}{
+		{KindFee, "Členský příspěvek 01/2024 (Member)", -1000},
+		{KindPayment, "Platba z účtu 123/0800 – leden", 0},
+		{KindFee, "Členský příspěvek 02/2024 (Member)", -1000},
+		{KindFee, "Členský příspěvek 03/2024 (Member)", -2000},
+		{KindPayment, "Platba v hotovosti – Převzal Pepa", 0},
+	}
+	if len(st.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(st.Entries), len(want))
+	}
+	for i, w := range want {
+		e := st.Entries[i]
+		if e.Kind != w.kind || e.Description != w.desc || e.Balance != money.FromKoruny(w.balance) {
+			t.Errorf("#%d: got %s %q %s, want %s %q %d", i, e.Kind, e.Description, e.Balance, w.kind, w.desc, w.balance)
+		}
+	}
+	if st.Opening != 0 || st.Closing != 0 || st.Charged != money.FromKoruny(3000) || st.Paid != money.FromKoruny(3000) {
+		t.Errorf("got opening %s, closing %s, charged %s, paid %s", st.Opening, st.Closing, st.Charged, st.Paid)
+	}
+}
+
+func TestBuildPeriod(t *testing.T) {
+	fees, pays := testData()
+	st := Build(fees, pays, nil, date("2024-02-01"), date("2024-03-01"))
+
+	if len(st.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(st.Entries))
+	}
+	if st.Entries[0].Description != "Členský příspěvek 02/2024" {
+		t.Errorf("first entry %q", st.Entries[0].Description)
+	}
+	if st.Opening != 0 || st.Closing != money.FromKoruny(-2000) || st.Charged != money.FromKoruny(2000) || st.Paid != 0 {
+		t.Errorf("got opening %s, closing %s, charged %s, paid %s", st.Opening, st.Closing, st.Charged, st.Paid)
+	}
+	if got := st.Period(); got != "01.02.2024 – 01.03.2024" {
+		t.Errorf("Period() = %q", got)
+	}
+
+	st = Build(fees, pays, nil, date("2024-03-05"), time.Time{})
+	if st.Opening != money.FromKoruny(-2000) || st.Closing != 0 || len(st.Entries) != 1 {
+		t.Errorf("got opening %s, closing %s, %d entries", st.Opening, st.Closing, len(st.Entries))
+	}
+}
+
+func TestDebtSince(t *testing.T) {
+	fees, pays := testData()
+	if since, ok := Build(fees, pays, nil, time.Time{}, time.Time{}).DebtSince(money.FromKoruny(1000)); ok {
+		t.Errorf("paid up member in debt since %s", since)
+	}
+
+	// Without the cash payment of March the debt lasts since February
+	st := Build(fees, pays[2:], nil, time.Time{}, time.Time{})
+	tests := []struct {
+		threshold money.Amount
+		want      time.Time // Zero when not in debt
+	}{
+		{money.Zero, date("2024-02-01")},
+		{money.FromKoruny(1000), date("2024-02-01")},
+		{money.FromKoruny(1500), date("2024-03-01")},
+		{money.FromKoruny(2500), time.Time{}},
+	}
+	for _, tt := range tests {
+		since, ok := st.DebtSince(tt.threshold)
+		if ok != !tt.want.IsZero() || !since.Equal(tt.want) {
+			t.Errorf("DebtSince(%s) = %s, %v, want %s", tt.threshold, since, ok, tt.want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	fees, pays := testData()
+	st := Build(fees, pays, nil, time.Time{}, time.Time{})
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, st); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+
+	r := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\uFEFF")))
+	r.Comma = ';'
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	// Header, opening, 5 entries, closing
+	if len(records) != 8 {
+		t.Fatalf("got %d records, want 8", len(records))
+	}
+	if got := records[2]; got[0] != "2024-01-01" || got[3] != "1000" || got[5] != "-1000" {
+		t.Errorf("first entry: %v", got)
+	}
+	if got := records[7]; got[1] != "closing" || got[5] != "0" {
+		t.Errorf("closing: %v", got)
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	fees, pays := testData()
+	// Enough entries for several pages
+	for i := 0; i < 120; i++ {
+		fees = append(fees, db.Fee{PeriodStart: date("2020-01-01").AddDate(0, i/10, 0), Amount: money.FromKoruny(100)})
+	}
+	st := Build(fees, pays, nil, time.Time{}, time.Time{})
+	st.Member = "Jan Novák <novak@example.com>"
+
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, st); err != nil {
+		t.Fatalf("WritePDF: %v", err)
+	}
+	pdf := buf.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+
+	// Every cross-reference entry points at its object
+	m := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	lines := strings.Split(string(pdf[xref:]), "\n")
+	if lines[0] != "xref" {
+		t.Fatalf("startxref points at %q", lines[0])
+	}
+	var count int
+	fmt.Sscanf(lines[1], "0 %d", &count)
+	for i := 1; i < count; i++ {
+		off, _ := strconv.Atoi(lines[2+i][:10])
+		if !bytes.HasPrefix(pdf[off:], []byte(fmt.Sprintf("%d 0 obj", i))) {
+			t.Errorf("xref entry %d points at the wrong offset", i)
+		}
+	}
+
+	if pages := bytes.Count(pdf, []byte("/Type /Page ")); pages < 2 {
+		t.Errorf("got %d pages, want at least 2", pages)
+	}
+	// Czech letters are encoded as Windows-1250
+	if !bytes.Contains(pdf, []byte("V\xfdpis \xe8lensk\xe9ho \xfa\xe8tu")) {
+		t.Error("title not encoded as Windows-1250")
+	}
+}
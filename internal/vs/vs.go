@@ -0,0 +1,201 @@
+// Package vs allocates variable symbols (VS) for members. Bank payments are
+// matched to members by VS, so every member needs one that no other member
+// (present or past) and no fundraising project uses. How new symbols look is
+// configurable, see the Scheme constants.
+package vs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+)
+
+// Allocation schemes (VS_SCHEME)
+const (
+	SchemeSequential = "sequential" // Next number of a range: 1000, 1001, ...
+	SchemeYear       = "year"       // Year of acceptance and a sequence: 2026001, 2026002, ...
+	SchemeCheckDigit = "checkdigit" // Next number of a range with a Luhn check digit: 10009, 10017, ...
+)
+
+// maxLength is the length of a Czech variable symbol
+const maxLength = 10
+
+// ErrExhausted is returned when every VS of the scheme is taken
+var ErrExhausted = errors.New("no free variable symbol left in the configured range")
+
+// Config selects and parametrizes the scheme
+type Config struct {
+	Scheme     string
+	RangeStart int64 // sequential, checkdigit: first number (without the check digit)
+	RangeEnd   int64 // sequential, checkdigit: last number (without the check digit)
+	YearDigits int   // year: digits of the sequence after the year
+}
+
+// Allocator generates the next free VS according to the configured scheme
+type Allocator struct {
+	queries *db.Queries
+	config  Config
+	now     func() time.Time
+}
+
+// New validates the config and returns an allocator
+func New(queries *db.Queries, cfg Config) (*Allocator, error) {
+	switch cfg.Scheme {
+	case SchemeSequential, SchemeCheckDigit:
+		maxEnd := pow10(maxLength) - 1
+		if cfg.Scheme == SchemeCheckDigit {
+			maxEnd = pow10(maxLength-1) - 1
+		}
+		if cfg.RangeStart < 1 || cfg.RangeEnd < cfg.RangeStart || cfg.RangeEnd > maxEnd {
+			return nil, fmt.Errorf("invalid VS range %d-%d for scheme %s (1-%d)", cfg.RangeStart, cfg.RangeEnd, cfg.Scheme, maxEnd)
+		}
+	case SchemeYear:
+		if cfg.YearDigits < 1 || cfg.YearDigits > maxLength-4 {
+			return nil, fmt.Errorf("invalid VS year sequence digits %d (1-%d)", cfg.YearDigits, maxLength-4)
+		}
+	default:
+		return nil, fmt.Errorf("unknown VS scheme '%s' (use %s, %s or %s)", cfg.Scheme, SchemeSequential, SchemeYear, SchemeCheckDigit)
+	}
+
+	return &Allocator{queries: queries, config: cfg, now: time.Now}, nil
+}
+
+// Scheme returns the configured scheme
+func (a *Allocator) Scheme() string {
+	return a.config.Scheme
+}
+
+// WithQueries returns a copy of the allocator that reads through queries, so
+// that a VS can be allocated and stored in one transaction
+func (a *Allocator) WithQueries(queries *db.Queries) *Allocator {
+	c := *a
+	c.queries = queries
+	return &c
+}
+
+// Next returns the next free VS. Numbering continues after the highest
+// member VS of the scheme; when the range is used up, gaps from its start
+// are filled. Symbols of projects are skipped.
+func (a *Allocator) Next(ctx context.Context) (string, error) {
+	members, err := a.queries.ListMemberPaymentsIDs(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list variable symbols: %w", err)
+	}
+	projects, err := a.queries.ListProjects(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list projects: %w", err)
+	}
+
+	taken := make(map[string]bool, len(members)+len(projects))
+	for _, p := range projects {
+		if p.PaymentsID.Valid {
+			taken[p.PaymentsID.String] = true
+		}
+	}
+	var memberSymbols []string
+	for _, m := range members {
+		if m.Valid {
+			taken[m.String] = true
+			memberSymbols = append(memberSymbols, m.String)
+		}
+	}
+
+	format, parse, start, end := a.sequence()
+
+	// Continue after the highest sequence number members have
+	highest := start - 1
+	for _, vs := range memberSymbols {
+		if n, ok := parse(vs); ok && n >= start && n <= end && n > highest {
+			highest = n
+		}
+	}
+
+	for n := highest + 1; n <= end; n++ {
+		if vs := format(n); !taken[vs] {
+			return vs, nil
+		}
+	}
+	for n := start; n <= highest; n++ {
+		if vs := format(n); !taken[vs] {
+			return vs, nil
+		}
+	}
+	return "", ErrExhausted
+}
+
+// sequence describes the scheme as a numbered sequence: how the n-th VS
+// looks, how to get n back from a VS (false if the VS is not of the scheme)
+// and the range of n
+func (a *Allocator) sequence() (format func(int64) string, parse func(string) (int64, bool), start, end int64) {
+	switch a.config.Scheme {
+	case SchemeYear:
+		year := int64(a.now().Year())
+		digits := a.config.YearDigits
+		format = func(n int64) string {
+			return fmt.Sprintf("%d%0*d", year, digits, n)
+		}
+		parse = func(vs string) (int64, bool) {
+			if len(vs) != 4+digits || vs[:4] != strconv.FormatInt(year, 10) {
+				return 0, false
+			}
+			n, err := strconv.ParseInt(vs[4:], 10, 64)
+			return n, err == nil
+		}
+		return format, parse, 1, pow10(digits) - 1
+
+	case SchemeCheckDigit:
+		format = func(n int64) string {
+			return strconv.FormatInt(n, 10) + strconv.Itoa(CheckDigit(n))
+		}
+		parse = func(vs string) (int64, bool) {
+			v, err := strconv.ParseInt(vs, 10, 64)
+			if err != nil || v < 10 || CheckDigit(v/10) != int(v%10) {
+				return 0, false
+			}
+			return v / 10, true
+		}
+		return format, parse, a.config.RangeStart, a.config.RangeEnd
+
+	default: // SchemeSequential
+		format = func(n int64) string {
+			return strconv.FormatInt(n, 10)
+		}
+		parse = func(vs string) (int64, bool) {
+			n, err := strconv.ParseInt(vs, 10, 64)
+			return n, err == nil && strconv.FormatInt(n, 10) == vs
+		}
+		return format, parse, a.config.RangeStart, a.config.RangeEnd
+	}
+}
+
+// CheckDigit returns the Luhn check digit of n. It catches a mistyped digit
+// and most swapped neighbouring digits in a VS.
+func CheckDigit(n int64) int {
+	sum := 0
+	double := true // The rightmost digit of n is doubled, the check digit goes after it
+	for ; n > 0; n /= 10 {
+		d := int(n % 10)
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
+
+// pow10 returns 10^n
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
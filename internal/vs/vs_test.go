@@ -0,0 +1,119 @@
+package vs
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/base48/member-portal/internal/db"
+	"github.com/base48/member-portal/internal/dbtest"
+	"github.com/base48/member-portal/internal/money"
+)
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want int
+	}{
+		{1000, 9},
+		{1001, 7},
+		{7992739871, 3}, // The usual Luhn example
+		{0, 0},
+	}
+	for _, tt := range tests {
+		if got := CheckDigit(tt.n); got != tt.want {
+			t.Errorf("CheckDigit(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	invalid := []Config{
+		{Scheme: "random"},
+		{Scheme: SchemeSequential, RangeStart: 0, RangeEnd: 10},
+		{Scheme: SchemeSequential, RangeStart: 100, RangeEnd: 99},
+		{Scheme: SchemeSequential, RangeStart: 1, RangeEnd: 99999999999},
+		{Scheme: SchemeCheckDigit, RangeStart: 1, RangeEnd: 9999999999},
+		{Scheme: SchemeYear, YearDigits: 0},
+		{Scheme: SchemeYear, YearDigits: 7},
+	}
+	for _, cfg := range invalid {
+		if _, err := New(nil, cfg); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	queries := dbtest.New(t)
+	ctx := context.Background()
+
+	member := func(vs string) db.User {
+		t.Helper()
+		u, err := queries.CreateUser(ctx, db.CreateUserParams{
+			Email:             vs + "@example.com",
+			LevelID:           1,
+			LevelActualAmount: money.Zero,
+			PaymentsID:        sql.NullString{String: vs, Valid: true},
+			State:             "accepted",
+		})
+		if err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		return u
+	}
+
+	old := member("1001")
+	member("1002")
+	member("2026001")
+	member("10009")
+	member("10017")
+	member("123456789012") // Out of every range
+	if _, err := queries.CreatePaymentsIDHistory(ctx, db.CreatePaymentsIDHistoryParams{
+		UserID:     old.ID,
+		PaymentsID: "1003", // Previous VS, never reused
+	}); err != nil {
+		t.Fatalf("create history: %v", err)
+	}
+	if _, err := queries.CreateProject(ctx, db.CreateProjectParams{
+		Name:       "3D tiskárna",
+		PaymentsID: sql.NullString{String: "1004", Valid: true},
+	}); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"sequential", Config{Scheme: SchemeSequential, RangeStart: 1000, RangeEnd: 1999}, "1005"},
+		{"sequential empty range", Config{Scheme: SchemeSequential, RangeStart: 5000, RangeEnd: 5999}, "5000"},
+		{"sequential fills gaps when full", Config{Scheme: SchemeSequential, RangeStart: 999, RangeEnd: 1004}, "999"},
+		{"year", Config{Scheme: SchemeYear, YearDigits: 3}, "2026002"},
+		{"year without members", Config{Scheme: SchemeYear, YearDigits: 2}, "202601"},
+		{"checkdigit", Config{Scheme: SchemeCheckDigit, RangeStart: 1000, RangeEnd: 1999}, "10025"},
+	}
+	for _, tt := range tests {
+		a, err := New(queries, tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: New: %v", tt.name, err)
+		}
+		a.now = func() time.Time { return time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC) }
+
+		got, err := a.Next(ctx)
+		if err != nil {
+			t.Errorf("%s: Next: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Next = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	full, _ := New(queries, Config{Scheme: SchemeSequential, RangeStart: 1001, RangeEnd: 1004})
+	if _, err := full.Next(ctx); err != ErrExhausted {
+		t.Errorf("full range: got %v, want ErrExhausted", err)
+	}
+}
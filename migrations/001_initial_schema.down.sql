@@ -0,0 +1,16 @@
+-- Migration: 001_initial_schema.down.sql
+-- Reverts 001_initial_schema.sql (WARNING: drops all member data)
+
+DROP INDEX IF EXISTS idx_fees_period;
+DROP INDEX IF EXISTS idx_fees_user;
+DROP INDEX IF EXISTS idx_payments_date;
+DROP INDEX IF EXISTS idx_payments_user;
+DROP INDEX IF EXISTS idx_users_username;
+DROP INDEX IF EXISTS idx_users_keycloak;
+DROP INDEX IF EXISTS idx_users_level;
+DROP INDEX IF EXISTS idx_users_state;
+
+DROP TABLE IF EXISTS fees;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS levels;
@@ -20,18 +20,18 @@ DELETE FROM levels WHERE id > 1;
 -- Note: We're using the same IDs as the old system for easier mapping
 -- Using INSERT OR REPLACE for compatibility with older SQLite versions
 INSERT OR REPLACE INTO levels (id, name, amount, active) VALUES
-    (1, 'Regular member', '1000', 1),
-    (2, 'Student member', '600', 1),
-    (3, 'vpsFree.cz org', '0', 1),
-    (4, 'Support member', '600', 1),
-    (5, 'Regular + 3 m2 + 100W', '2260', 1),
-    (6, 'Regular + 1.5 m2', '1280', 1),
-    (7, 'Regular + 1 m2', '1120', 1),
-    (8, 'Regular + 0.5 m2', '960', 1),
-    (9, 'Regular + 2 m2', '1440', 1),
-    (10, 'Regular + 3 m2', '1760', 1),
-    (11, 'Regular + 4 m2', '2080', 1),
-    (12, 'Regular + 5 m2', '2400', 1);
+    (1, 'Regular member', '1000.00', 1),
+    (2, 'Student member', '600.00', 1),
+    (3, 'vpsFree.cz org', '0.00', 1),
+    (4, 'Support member', '600.00', 1),
+    (5, 'Regular + 3 m2 + 100W', '2260.00', 1),
+    (6, 'Regular + 1.5 m2', '1280.00', 1),
+    (7, 'Regular + 1 m2', '1120.00', 1),
+    (8, 'Regular + 0.5 m2', '960.00', 1),
+    (9, 'Regular + 2 m2', '1440.00', 1),
+    (10, 'Regular + 3 m2', '1760.00', 1),
+    (11, 'Regular + 4 m2', '2080.00', 1),
+    (12, 'Regular + 5 m2', '2400.00', 1);
 
 -- =============================================================================
 -- PART 2: Import Users
@@ -71,7 +71,7 @@ SELECT
     u.phone,
     u.altcontact,
     COALESCE(u.level, 1),                   -- Default to level 1 if NULL
-    CAST(u.level_actual_amount AS TEXT),
+    printf('%.2f', COALESCE(u.level_actual_amount, 0)),
     CAST(u.payments_id AS TEXT),
     u.date_joined,
     u.keys_granted,
@@ -115,7 +115,7 @@ INSERT INTO payments (
 SELECT
     COALESCE(m.new_id, p.user),  -- Map to new user ID (or keep old if mapping missing)
     p.date,
-    CAST(p.amount AS TEXT),      -- Convert numeric to TEXT for precision
+    printf('%.2f', p.amount), -- Two decimals, as the portal stores amounts
     p.kind,
     p.kind_id,
     p.local_account,
@@ -146,7 +146,7 @@ INSERT INTO payments (
 SELECT
     NULL,                        -- No user assigned
     p.date,
-    CAST(p.amount AS TEXT),
+    printf('%.2f', p.amount),
     p.kind,
     p.kind_id,
     p.local_account,
@@ -175,7 +175,7 @@ SELECT
     COALESCE(m.new_id, f.user),  -- Map to new user ID
     f.level,                      -- Level ID should match
     DATE(f.period_start),         -- Ensure it's stored as DATE
-    CAST(f.amount AS TEXT),       -- Convert numeric to TEXT
+    printf('%.2f', f.amount),    -- Two decimals, as the portal stores amounts
     f.period_start                -- Use period_start as created_at
 FROM old.fee f
 LEFT JOIN user_id_map m ON f.user = m.old_id
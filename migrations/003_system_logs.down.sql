@@ -0,0 +1,9 @@
+-- Migration: 003_system_logs.down.sql
+-- Reverts 003_system_logs.sql
+
+DROP INDEX IF EXISTS idx_system_logs_created_at;
+DROP INDEX IF EXISTS idx_system_logs_user;
+DROP INDEX IF EXISTS idx_system_logs_level;
+DROP INDEX IF EXISTS idx_system_logs_subsystem;
+
+DROP TABLE IF EXISTS system_logs;
@@ -0,0 +1,7 @@
+-- Migration 005 (down): Remove projects table and payments.project_id
+
+DROP INDEX IF EXISTS idx_payments_project;
+
+ALTER TABLE payments DROP COLUMN project_id;
+
+DROP TABLE IF EXISTS projects;
@@ -0,0 +1,7 @@
+-- Migration: 006_job_runs.down.sql
+-- Reverts 006_job_runs.sql
+
+DROP INDEX IF EXISTS idx_job_runs_running;
+DROP INDEX IF EXISTS idx_job_runs_job_name;
+
+DROP TABLE IF EXISTS job_runs;
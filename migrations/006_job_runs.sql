@@ -0,0 +1,22 @@
+-- Migration: 006_job_runs.sql
+-- Run history of background jobs executed by the in-process scheduler,
+-- the "run now" button on /admin/jobs and the cmd/cron wrappers
+
+CREATE TABLE IF NOT EXISTS job_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_name TEXT NOT NULL,            -- 'fio_sync', 'monthly_fees', 'debt_status', 'unmatched_report'
+    source TEXT NOT NULL,              -- 'schedule', 'manual', 'cli'
+    status TEXT NOT NULL DEFAULT 'running', -- 'running', 'success', 'failed', 'interrupted'
+    triggered_by INTEGER REFERENCES users(id), -- Admin who pressed "run now"
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP,
+    duration_ms INTEGER,
+    summary TEXT,                      -- One-line result, e.g. "12 new, 0 updated"
+    error TEXT,
+    output TEXT                        -- Captured job log (truncated)
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job_name ON job_runs(job_name, started_at);
+
+-- At most one running instance per job, across the server and CLI processes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_job_runs_running ON job_runs(job_name) WHERE status = 'running';
@@ -0,0 +1,4 @@
+-- Migration: 007_sync_cursors.down.sql
+-- Reverts 007_sync_cursors.sql
+
+DROP TABLE IF EXISTS sync_cursors;
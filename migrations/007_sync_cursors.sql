@@ -0,0 +1,9 @@
+-- Migration: 007_sync_cursors.sql
+-- Persisted position of incremental imports (e.g. last FIO transaction ID),
+-- so a sync only downloads transactions it has not seen yet
+
+CREATE TABLE IF NOT EXISTS sync_cursors (
+    name TEXT PRIMARY KEY,             -- 'fio'
+    last_id INTEGER NOT NULL,          -- FIO: idTo of the last processed statement
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+-- Migration: 008_manual_payments.down.sql
+-- Reverts 008_manual_payments.sql (voided payments become valid again)
+
+ALTER TABLE payments DROP COLUMN voided_at;
+ALTER TABLE payments DROP COLUMN recorded_by;
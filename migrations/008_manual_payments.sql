@@ -0,0 +1,7 @@
+-- Migration: 008_manual_payments.sql
+-- Payments entered by hand in the admin UI (kind = 'manual': cash paid at the
+-- space, in-kind contributions). Manual payments are never deleted, a wrong
+-- entry is voided and stays in the ledger for the audit trail.
+
+ALTER TABLE payments ADD COLUMN recorded_by INTEGER REFERENCES users(id); -- Admin who entered a manual payment
+ALTER TABLE payments ADD COLUMN voided_at TIMESTAMP;                      -- Voided payments are excluded from balances
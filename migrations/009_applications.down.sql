@@ -0,0 +1,8 @@
+-- Migration: 009_applications.down.sql
+-- Reverts 009_applications.sql
+
+DROP INDEX IF EXISTS idx_applications_pending;
+DROP INDEX IF EXISTS idx_applications_user;
+DROP INDEX IF EXISTS idx_applications_status;
+
+DROP TABLE IF EXISTS applications;
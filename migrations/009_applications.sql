@@ -0,0 +1,26 @@
+-- Migration: 009_applications.sql
+-- Membership applications. A new Keycloak login starts as 'awaiting', fills in
+-- the application (contact details, level, monthly fee) and council or an
+-- admin approves or rejects it. Decided applications are kept as history.
+
+CREATE TABLE IF NOT EXISTS applications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    realname TEXT NOT NULL,
+    phone TEXT,
+    alt_contact TEXT,
+    level_id INTEGER NOT NULL REFERENCES levels(id),
+    level_actual_amount TEXT NOT NULL,         -- Monthly fee the applicant chose (decimal string, CZK)
+    motivation TEXT,                           -- Free text for council: who they are, what they want to do
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'approved', 'rejected')),
+    decided_by INTEGER REFERENCES users(id),   -- Council member / admin who decided
+    decided_at TIMESTAMP,
+    decision_comment TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_applications_status ON applications(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_applications_user ON applications(user_id);
+
+-- At most one pending application per user
+CREATE UNIQUE INDEX IF NOT EXISTS idx_applications_pending ON applications(user_id) WHERE status = 'pending';
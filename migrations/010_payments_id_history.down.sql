@@ -0,0 +1,8 @@
+-- Migration: 010_payments_id_history.down.sql
+-- Reverts 010_payments_id_history.sql (payments under previous VS stop counting
+-- toward the balance)
+
+DROP INDEX IF EXISTS idx_payments_id_history_vs;
+DROP INDEX IF EXISTS idx_payments_id_history_user;
+
+DROP TABLE IF EXISTS payments_id_history;
@@ -0,0 +1,17 @@
+-- Migration: 010_payments_id_history.sql
+-- Previous variable symbols of members. When a member's VS is regenerated or
+-- reassigned, the old one is kept here: payments sent with it still count
+-- toward the member's balance and it is never given to anyone else.
+
+CREATE TABLE IF NOT EXISTS payments_id_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    payments_id TEXT NOT NULL,                 -- The previous VS
+    replaced_by TEXT,                          -- The VS it was replaced with (NULL if removed)
+    changed_by INTEGER REFERENCES users(id),   -- Admin who changed it
+    reason TEXT,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_id_history_user ON payments_id_history(user_id);
+CREATE INDEX IF NOT EXISTS idx_payments_id_history_vs ON payments_id_history(payments_id);
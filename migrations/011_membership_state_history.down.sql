@@ -0,0 +1,6 @@
+-- Migration: 011_membership_state_history.down.sql
+-- Reverts 011_membership_state_history.sql (the state history is lost)
+
+DROP INDEX IF EXISTS idx_membership_state_history_user;
+
+DROP TABLE IF EXISTS membership_state_history;
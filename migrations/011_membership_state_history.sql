@@ -0,0 +1,15 @@
+-- Migration: 011_membership_state_history.sql
+-- Every change of a member's state (who, when, why), whether made by an admin,
+-- by approving an application or by the automatic debt suspension.
+
+CREATE TABLE IF NOT EXISTS membership_state_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    from_state TEXT NOT NULL,
+    to_state TEXT NOT NULL,
+    changed_by INTEGER REFERENCES users(id),   -- NULL for automatic changes
+    reason TEXT,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_membership_state_history_user ON membership_state_history(user_id);
@@ -0,0 +1,7 @@
+-- Migration: 012_membership_level_history.down.sql
+-- Reverts 012_membership_level_history.sql (the level history and pending
+-- level changes are lost, members keep their current level)
+
+DROP INDEX IF EXISTS idx_membership_level_history_user;
+
+DROP TABLE IF EXISTS membership_level_history;
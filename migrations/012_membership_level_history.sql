@@ -0,0 +1,22 @@
+-- Migration: 012_membership_level_history.sql
+-- A member's membership level and fee over time. Fees of a period are billed
+-- at the level in effect then; a member's own level change is recorded ahead
+-- with effective_from in the next month and is pending until then.
+
+CREATE TABLE IF NOT EXISTS membership_level_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    level_id INTEGER NOT NULL REFERENCES levels(id),
+    level_actual_amount TEXT NOT NULL DEFAULT '0', -- '0' = the level's amount
+    effective_from DATE NOT NULL,                 -- First day the level applies
+    changed_by INTEGER REFERENCES users(id),      -- Admin who changed it (NULL when the member asked for it)
+    reason TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_membership_level_history_user ON membership_level_history(user_id);
+
+-- Members keep their current level since they joined
+INSERT INTO membership_level_history (user_id, level_id, level_actual_amount, effective_from, reason)
+SELECT id, level_id, level_actual_amount, substr(date_joined, 1, 10), 'Úroveň před zavedením historie'
+FROM users;
@@ -0,0 +1,7 @@
+-- Migration: 013_level_price_changes.down.sql
+-- Reverts 013_level_price_changes.sql (scheduled price changes are lost, the
+-- fees they put into the members' level history stay)
+
+DROP INDEX IF EXISTS idx_level_price_changes_level;
+
+DROP TABLE IF EXISTS level_price_changes;
@@ -0,0 +1,19 @@
+-- Migration: 013_level_price_changes.sql
+-- Scheduled changes of a level's price (levels.amount). Members on the level
+-- get the new fee in their level history from effective_from; the level's
+-- amount is updated once the change takes effect (applied_at).
+
+CREATE TABLE IF NOT EXISTS level_price_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    level_id INTEGER NOT NULL REFERENCES levels(id),
+    old_amount TEXT NOT NULL,                   -- Price before the change
+    new_amount TEXT NOT NULL,
+    effective_from DATE NOT NULL,               -- First day of the month the price applies
+    members_affected INTEGER NOT NULL DEFAULT 0,
+    members_notified INTEGER NOT NULL DEFAULT 0,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    applied_at TIMESTAMP                        -- When levels.amount was updated (NULL while scheduled)
+);
+
+CREATE INDEX IF NOT EXISTS idx_level_price_changes_level ON level_price_changes(level_id);
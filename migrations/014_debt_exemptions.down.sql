@@ -0,0 +1,7 @@
+-- Migration: 014_debt_exemptions.down.sql
+-- Reverts 014_debt_exemptions.sql (exempted members are flagged again by the
+-- debt policy)
+
+DROP INDEX IF EXISTS idx_debt_exemptions_user;
+
+DROP TABLE IF EXISTS debt_exemptions;
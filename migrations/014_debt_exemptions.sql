@@ -0,0 +1,14 @@
+-- Migration: 014_debt_exemptions.sql
+-- Members the debt policy never flags (e.g. honorary members). An exemption
+-- without valid_until lasts until it is removed.
+
+CREATE TABLE IF NOT EXISTS debt_exemptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    reason TEXT NOT NULL,
+    valid_until DATE,                           -- Last day of the exemption, NULL for no end
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_debt_exemptions_user ON debt_exemptions(user_id);
@@ -0,0 +1,7 @@
+-- Migration: 015_dunning_notices.down.sql
+-- Reverts 015_dunning_notices.sql (the history of sent reminders is lost,
+-- members in debt get the friendly reminder again)
+
+DROP INDEX IF EXISTS idx_dunning_notices_user;
+
+DROP TABLE IF EXISTS dunning_notices;
@@ -0,0 +1,16 @@
+-- Migration: 015_dunning_notices.sql
+-- Reminders sent to members in debt (see internal/dunning). The notices of a
+-- member without resolved_at are the open case: the next notice escalates
+-- from the last one. Once the balance recovers the case is resolved and the
+-- next debt starts from the friendly reminder again.
+
+CREATE TABLE IF NOT EXISTS dunning_notices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    stage TEXT NOT NULL,                        -- reminder, warning, final_notice, suspension
+    balance TEXT NOT NULL,                      -- Balance when the notice was sent
+    sent_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP                       -- Debt paid off (or exempted), NULL while open
+);
+
+CREATE INDEX IF NOT EXISTS idx_dunning_notices_user ON dunning_notices(user_id, resolved_at);
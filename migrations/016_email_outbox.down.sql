@@ -0,0 +1,8 @@
+-- Migration: 016_email_outbox.down.sql
+-- Reverts 016_email_outbox.sql (queued emails that were not delivered yet are
+-- lost)
+
+DROP INDEX IF EXISTS idx_email_outbox_user;
+DROP INDEX IF EXISTS idx_email_outbox_due;
+
+DROP TABLE IF EXISTS email_outbox;
@@ -0,0 +1,24 @@
+-- Migration: 016_email_outbox.sql
+-- Outgoing emails. Handlers and jobs only enqueue a rendered message; the
+-- worker in the server delivers it, retrying failed attempts with an
+-- exponential backoff until max_attempts, after which the message stays
+-- failed (dead letter) until an admin resends it from /admin/emails.
+
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER REFERENCES users(id),
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    template TEXT NOT NULL,
+    body TEXT NOT NULL,                         -- Rendered HTML
+    status TEXT NOT NULL DEFAULT 'queued',      -- queued, sending, sent, failed, cancelled
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_due ON email_outbox(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_email_outbox_user ON email_outbox(user_id);
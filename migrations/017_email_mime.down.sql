@@ -0,0 +1,9 @@
+-- Migration: 017_email_mime.down.sql
+-- Reverts 017_email_mime.sql (queued emails lose their plain-text part and
+-- attachments)
+
+ALTER TABLE email_outbox DROP COLUMN attachments;
+ALTER TABLE email_outbox DROP COLUMN message_id;
+ALTER TABLE email_outbox DROP COLUMN list_unsubscribe;
+ALTER TABLE email_outbox DROP COLUMN reply_to;
+ALTER TABLE email_outbox DROP COLUMN text_body;
@@ -0,0 +1,11 @@
+-- Migration: 017_email_mime.sql
+-- Parts and headers of a queued email for the MIME composer: the plain-text
+-- alternative, Reply-To, List-Unsubscribe of bulk mail, a Message-ID kept
+-- across retries and the attachments (JSON list of filename, content type and
+-- base64 data).
+
+ALTER TABLE email_outbox ADD COLUMN text_body TEXT NOT NULL DEFAULT '';
+ALTER TABLE email_outbox ADD COLUMN reply_to TEXT;
+ALTER TABLE email_outbox ADD COLUMN list_unsubscribe TEXT;
+ALTER TABLE email_outbox ADD COLUMN message_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE email_outbox ADD COLUMN attachments TEXT;
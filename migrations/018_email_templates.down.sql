@@ -0,0 +1,4 @@
+-- Migration: 018_email_templates.down.sql
+-- Reverts 018_email_templates.sql (the emails fall back to the template files)
+
+DROP TABLE IF EXISTS email_template_versions;
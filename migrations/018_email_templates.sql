@@ -0,0 +1,19 @@
+-- Migration: 018_email_templates.sql
+-- Overrides of the email templates edited on /admin/email-templates. Every
+-- save adds a version, the latest version of a template is in use. An empty
+-- subject or body falls back to the default (the file in web/templates/email,
+-- the subject given by the code sending the email), so saving an empty
+-- version restores the defaults.
+
+CREATE TABLE IF NOT EXISTS email_template_versions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    template TEXT NOT NULL,                     -- File name, e.g. welcome.html
+    version INTEGER NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    html_body TEXT NOT NULL DEFAULT '',         -- html/template source
+    text_body TEXT NOT NULL DEFAULT '',         -- text/template source of the plain-text part
+    note TEXT,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (template, version)
+);
@@ -0,0 +1,4 @@
+-- Migration: 019_announcements.down.sql
+-- Reverts 019_announcements.sql (the queued emails stay in email_outbox)
+
+DROP TABLE IF EXISTS announcements;
@@ -0,0 +1,17 @@
+-- Migration: 019_announcements.sql
+-- Announcements sent to a segment of members from /admin/announcements (e.g. a
+-- general assembly invitation). The emails go through email_outbox, spread by
+-- EMAIL_BULK_RATE; every recipient is logged to system_logs (subsystem
+-- announcement) with the announcement ID.
+
+CREATE TABLE IF NOT EXISTS announcements (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subject TEXT NOT NULL,                      -- text/template source
+    body TEXT NOT NULL,                         -- text/template source
+    segment TEXT NOT NULL,                      -- JSON of announcements.Segment
+    recipients INTEGER NOT NULL DEFAULT 0,
+    queued INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
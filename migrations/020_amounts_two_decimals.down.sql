@@ -0,0 +1,4 @@
+-- Migration: 020_amounts_two_decimals.down.sql
+-- Reverts 020_amounts_two_decimals.sql: nothing to do, the previous version
+-- reads amounts with two decimals as well (but computes balances from REAL)
+SELECT 1;
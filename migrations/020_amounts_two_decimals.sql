@@ -0,0 +1,51 @@
+-- Migration: 020_amounts_two_decimals.sql
+-- Stores every amount with exactly two decimals ("1000" -> "1000.00", "1000.5"
+-- -> "1000.50"), as money.Amount writes them. SQL then gets whole haléře by
+-- dropping the decimal point, CAST(REPLACE(amount, '.', '') AS INTEGER),
+-- without rounding a REAL (see GetUserBalance). Only string functions are
+-- used, so no amount goes through floating point.
+
+UPDATE levels SET amount = CASE
+    WHEN instr(amount, '.') = 0 THEN amount || '.00'
+    ELSE substr(amount, 1, instr(amount, '.')) || substr(substr(amount, instr(amount, '.') + 1) || '00', 1, 2)
+END;
+
+UPDATE users SET level_actual_amount = CASE
+    WHEN instr(level_actual_amount, '.') = 0 THEN level_actual_amount || '.00'
+    ELSE substr(level_actual_amount, 1, instr(level_actual_amount, '.')) || substr(substr(level_actual_amount, instr(level_actual_amount, '.') + 1) || '00', 1, 2)
+END;
+
+UPDATE payments SET amount = CASE
+    WHEN instr(amount, '.') = 0 THEN amount || '.00'
+    ELSE substr(amount, 1, instr(amount, '.')) || substr(substr(amount, instr(amount, '.') + 1) || '00', 1, 2)
+END;
+
+UPDATE fees SET amount = CASE
+    WHEN instr(amount, '.') = 0 THEN amount || '.00'
+    ELSE substr(amount, 1, instr(amount, '.')) || substr(substr(amount, instr(amount, '.') + 1) || '00', 1, 2)
+END;
+
+UPDATE applications SET level_actual_amount = CASE
+    WHEN instr(level_actual_amount, '.') = 0 THEN level_actual_amount || '.00'
+    ELSE substr(level_actual_amount, 1, instr(level_actual_amount, '.')) || substr(substr(level_actual_amount, instr(level_actual_amount, '.') + 1) || '00', 1, 2)
+END;
+
+UPDATE membership_level_history SET level_actual_amount = CASE
+    WHEN instr(level_actual_amount, '.') = 0 THEN level_actual_amount || '.00'
+    ELSE substr(level_actual_amount, 1, instr(level_actual_amount, '.')) || substr(substr(level_actual_amount, instr(level_actual_amount, '.') + 1) || '00', 1, 2)
+END;
+
+UPDATE level_price_changes SET old_amount = CASE
+    WHEN instr(old_amount, '.') = 0 THEN old_amount || '.00'
+    ELSE substr(old_amount, 1, instr(old_amount, '.')) || substr(substr(old_amount, instr(old_amount, '.') + 1) || '00', 1, 2)
+END;
+
+UPDATE level_price_changes SET new_amount = CASE
+    WHEN instr(new_amount, '.') = 0 THEN new_amount || '.00'
+    ELSE substr(new_amount, 1, instr(new_amount, '.')) || substr(substr(new_amount, instr(new_amount, '.') + 1) || '00', 1, 2)
+END;
+
+UPDATE dunning_notices SET balance = CASE
+    WHEN instr(balance, '.') = 0 THEN balance || '.00'
+    ELSE substr(balance, 1, instr(balance, '.')) || substr(substr(balance, instr(balance, '.') + 1) || '00', 1, 2)
+END;
@@ -0,0 +1,33 @@
+// Package migrations embeds the versioned SQL schema migrations so that the
+// server, cron jobs and the migrate command all apply the same files.
+package migrations
+
+import "embed"
+
+// FS contains the up (NNN_name.sql) and down (NNN_name.down.sql) migrations
+// applied by internal/migrate.
+//
+// Files are listed explicitly (like the schema list in sqlc.yaml) because
+// 002_import_old_data.sql is a one-off import of the old rememberportal
+// database and must never run automatically. New migrations have to be added
+// here as well as to sqlc.yaml.
+//
+//go:embed 001_initial_schema.sql 001_initial_schema.down.sql
+//go:embed 003_system_logs.sql 003_system_logs.down.sql
+//go:embed 005_projects_and_payment_updates.sql 005_projects_and_payment_updates.down.sql
+//go:embed 006_job_runs.sql 006_job_runs.down.sql
+//go:embed 007_sync_cursors.sql 007_sync_cursors.down.sql
+//go:embed 008_manual_payments.sql 008_manual_payments.down.sql
+//go:embed 009_applications.sql 009_applications.down.sql
+//go:embed 010_payments_id_history.sql 010_payments_id_history.down.sql
+//go:embed 011_membership_state_history.sql 011_membership_state_history.down.sql
+//go:embed 012_membership_level_history.sql 012_membership_level_history.down.sql
+//go:embed 013_level_price_changes.sql 013_level_price_changes.down.sql
+//go:embed 014_debt_exemptions.sql 014_debt_exemptions.down.sql
+//go:embed 015_dunning_notices.sql 015_dunning_notices.down.sql
+//go:embed 016_email_outbox.sql 016_email_outbox.down.sql
+//go:embed 017_email_mime.sql 017_email_mime.down.sql
+//go:embed 018_email_templates.sql 018_email_templates.down.sql
+//go:embed 019_announcements.sql 019_announcements.down.sql
+//go:embed 020_amounts_two_decimals.sql 020_amounts_two_decimals.down.sql
+var FS embed.FS